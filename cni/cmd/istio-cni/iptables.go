@@ -35,6 +35,12 @@ func newIPTables() InterceptRuleMgr {
 // Program defines a method which programs iptables based on the parameters
 // provided in Redirect.
 func (ipt *iptables) Program(netns string, rdrct *Redirect) error {
+	return programRedirect(netns, rdrct)
+}
+
+// programRedirect runs istio-iptables in the network namespace of the pod, with the parameters provided in
+// Redirect and the extra arguments.
+func programRedirect(netns string, rdrct *Redirect, extraArgs ...string) error {
 	netnsArg := fmt.Sprintf("--net=%s", netns)
 	nsSetupExecutable := fmt.Sprintf("%s/%s", nsSetupBinDir, nsSetupProg)
 	nsenterArgs := []string{
@@ -51,6 +57,7 @@ func (ipt *iptables) Program(netns string, rdrct *Redirect) error {
 		"-x", rdrct.excludeIPCidrs,
 		"-k", rdrct.kubevirtInterfaces,
 	}
+	nsenterArgs = append(nsenterArgs, extraArgs...)
 	log.Infof("nsenter args: %s", strings.Join(nsenterArgs, " "))
 	out, err := exec.Command("nsenter", nsenterArgs...).CombinedOutput()
 	if err != nil {
@@ -0,0 +1,28 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+type nftables struct{}
+
+func newNftables() InterceptRuleMgr {
+	return &nftables{}
+}
+
+// Program defines a method which programs an nftables ruleset based on the parameters
+// provided in Redirect. The rules are the same as with iptables, applied atomically
+// in the "inet istio" table.
+func (nft *nftables) Program(netns string, rdrct *Redirect) error {
+	return programRedirect(netns, rdrct, "--nftables")
+}
@@ -332,6 +332,21 @@ var testGrid = []testCase{
 			{msg.ReferencedResourceNotFound, "AuthorizationPolicy httpbin-bogus-not-ns.httpbin"},
 		},
 	},
+	{
+		name: "authorizationpolicies conflicts",
+		inputFiles: []string{
+			"testdata/authorizationpolicies-conflicts.yaml",
+		},
+		meshConfigFile: "testdata/mesh-with-trustdomain-aliases.yaml",
+		analyzer:       &authz.AuthorizationPolicyConflictsAnalyzer{},
+		expected: []message{
+			{msg.AuthorizationPolicyShadowedRule, "AuthorizationPolicy allow-admin.bookinfo"},
+			{msg.AuthorizationPolicyShadowedRule, "AuthorizationPolicy allow-api.bookinfo"},
+			{msg.AuthorizationPolicyShadowedRule, "AuthorizationPolicy allow-api.bookinfo"},
+			{msg.AuthorizationPolicyUnknownTrustDomain, "AuthorizationPolicy allow-reviews.bookinfo"},
+			{msg.AuthorizationPolicyUnknownServiceAccount, "AuthorizationPolicy allow-reviews.bookinfo"},
+		},
+	},
 	{
 		name: "destinationrule with no cacert, simple at destinationlevel",
 		inputFiles: []string{
@@ -0,0 +1,484 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authz
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	k8s_labels "k8s.io/apimachinery/pkg/labels"
+
+	"istio.io/api/mesh/v1alpha1"
+	"istio.io/api/security/v1beta1"
+	"istio.io/istio/galley/pkg/config/analysis"
+	"istio.io/istio/galley/pkg/config/analysis/analyzers/util"
+	"istio.io/istio/galley/pkg/config/analysis/diag"
+	"istio.io/istio/galley/pkg/config/analysis/msg"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/resource"
+	"istio.io/istio/pkg/config/schema/collection"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+// AuthorizationPolicyConflictsAnalyzer checks authorization policies for rules that can never apply:
+// ALLOW rules shadowed by DENY rules on every workload they select, and principals that no workload of
+// the mesh can have.
+type AuthorizationPolicyConflictsAnalyzer struct{}
+
+var _ analysis.Analyzer = &AuthorizationPolicyConflictsAnalyzer{}
+
+func (a *AuthorizationPolicyConflictsAnalyzer) Metadata() analysis.Metadata {
+	return analysis.Metadata{
+		Name:        "auth.AuthorizationPolicyConflictsAnalyzer",
+		Description: "Checks for authorization policy rules shadowed by DENY rules and for principals that can never match",
+		Inputs: collection.Names{
+			collections.IstioMeshV1Alpha1MeshConfig.Name(),
+			collections.IstioSecurityV1Beta1Authorizationpolicies.Name(),
+			collections.K8SCoreV1Namespaces.Name(),
+			collections.K8SCoreV1Pods.Name(),
+		},
+	}
+}
+
+// workload is an in-mesh pod, as seen by the authorization policies.
+type workload struct {
+	namespace      string
+	labels         k8s_labels.Set
+	serviceAccount string
+}
+
+func (a *AuthorizationPolicyConflictsAnalyzer) Analyze(c analysis.Context) {
+	mesh := readMeshConfig(c)
+	workloads := initWorkloads(c)
+
+	var policies []*resource.Instance
+	c.ForEach(collections.IstioSecurityV1Beta1Authorizationpolicies.Name(), func(r *resource.Instance) bool {
+		policies = append(policies, r)
+		return true
+	})
+	// Report the first shadowing rule in a stable order.
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Metadata.FullName.String() < policies[j].Metadata.FullName.String()
+	})
+
+	for _, r := range policies {
+		if r.Message.(*v1beta1.AuthorizationPolicy).Action == v1beta1.AuthorizationPolicy_ALLOW {
+			a.analyzeShadowedRules(r, c, mesh, policies, workloads)
+		}
+		a.analyzePrincipals(r, c, mesh, workloads)
+	}
+}
+
+// analyzeShadowedRules reports the rules of an ALLOW policy that are shadowed, on every workload the policy
+// applies to, by a rule of a DENY policy applying to the same workload.
+func (a *AuthorizationPolicyConflictsAnalyzer) analyzeShadowedRules(r *resource.Instance, c analysis.Context, mesh *v1alpha1.MeshConfig,
+	policies []*resource.Instance, workloads []workload) {
+	ap := r.Message.(*v1beta1.AuthorizationPolicy)
+
+	var selected []workload
+	for _, w := range workloads {
+		if appliesTo(r, mesh, w) {
+			selected = append(selected, w)
+		}
+	}
+	// Policies without workloads are reported by AuthorizationPoliciesAnalyzer.
+	if len(selected) == 0 {
+		return
+	}
+
+	for i, rule := range ap.Rules {
+		var denyPolicy *resource.Instance
+		denyRule := -1
+		shadowed := true
+		for _, w := range selected {
+			p, dr := findShadowingRule(rule, mesh, policies, w)
+			if p == nil {
+				shadowed = false
+				break
+			}
+			if denyPolicy == nil {
+				denyPolicy, denyRule = p, dr
+			}
+		}
+		if !shadowed {
+			continue
+		}
+
+		m := msg.NewAuthorizationPolicyShadowedRule(r, i, denyRule, denyPolicy.Metadata.FullName.String())
+		if line, ok := ruleLine(r, i); ok {
+			m.Line = line
+		}
+		c.Report(collections.IstioSecurityV1Beta1Authorizationpolicies.Name(), m)
+	}
+}
+
+// findShadowingRule returns the first DENY policy applying to the workload with a rule denying all the requests
+// matched by the ALLOW rule, and the index of that rule.
+func findShadowingRule(rule *v1beta1.Rule, mesh *v1alpha1.MeshConfig, policies []*resource.Instance, w workload) (*resource.Instance, int) {
+	for _, p := range policies {
+		dp := p.Message.(*v1beta1.AuthorizationPolicy)
+		if dp.Action != v1beta1.AuthorizationPolicy_DENY || !appliesTo(p, mesh, w) {
+			continue
+		}
+		for i, deny := range dp.Rules {
+			if ruleCovers(deny, rule) {
+				return p, i
+			}
+		}
+	}
+	return nil, -1
+}
+
+// ruleLine returns the first line of the rule in the policy.
+func ruleLine(r *resource.Instance, rule int) (int, bool) {
+	prefix := fmt.Sprintf("{.spec.rules[%d].", rule)
+	line, found := 0, false
+	for path, l := range r.Origin.FieldMap() {
+		if strings.HasPrefix(path, prefix) && (!found || l < line) {
+			line, found = l, true
+		}
+	}
+	return line, found
+}
+
+// analyzePrincipals reports the principals of the policy that can never match: principals of unknown trust
+// domains, and principals of service accounts that no in-mesh workload uses.
+func (a *AuthorizationPolicyConflictsAnalyzer) analyzePrincipals(r *resource.Instance, c analysis.Context, mesh *v1alpha1.MeshConfig,
+	workloads []workload) {
+	ap := r.Message.(*v1beta1.AuthorizationPolicy)
+
+	trustDomains := map[string]bool{
+		constants.DefaultKubernetesDomain: true,
+		mesh.GetTrustDomain():             true,
+	}
+	for _, td := range mesh.GetTrustDomainAliases() {
+		trustDomains[td] = true
+	}
+
+	for i, rule := range ap.Rules {
+		for j, from := range rule.From {
+			if from.Source == nil {
+				continue
+			}
+			for k, principal := range from.Source.Principals {
+				// Principals are <trust domain>/ns/<namespace>/sa/<service account>. Other forms are not checked.
+				parts := strings.Split(principal, "/")
+				if len(parts) != 5 || parts[1] != "ns" || parts[3] != "sa" {
+					continue
+				}
+				td, ns, sa := parts[0], parts[2], parts[4]
+
+				var m diag.Message
+				switch {
+				case !strings.Contains(td, "*") && !trustDomains[td]:
+					m = msg.NewAuthorizationPolicyUnknownTrustDomain(r, principal, td)
+				case strings.Contains(ns, "*") || strings.Contains(sa, "*"):
+					continue
+				case namespaceExists(ns, c) && !serviceAccountUsed(ns, sa, workloads):
+					m = msg.NewAuthorizationPolicyUnknownServiceAccount(r, principal, sa, ns)
+				default:
+					continue
+				}
+
+				if line, ok := util.ErrorLine(r, fmt.Sprintf(util.AuthorizationPolicyPrincipal, i, j, k)); ok {
+					m.Line = line
+				}
+				c.Report(collections.IstioSecurityV1Beta1Authorizationpolicies.Name(), m)
+			}
+		}
+	}
+}
+
+func namespaceExists(ns string, c analysis.Context) bool {
+	return c.Exists(collections.K8SCoreV1Namespaces.Name(), resource.NewFullName("", resource.LocalName(ns)))
+}
+
+func serviceAccountUsed(ns, sa string, workloads []workload) bool {
+	for _, w := range workloads {
+		if w.namespace == ns && w.serviceAccount == sa {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesTo returns true if the policy applies to the workload.
+func appliesTo(r *resource.Instance, mesh *v1alpha1.MeshConfig, w workload) bool {
+	ns := r.Metadata.FullName.Namespace.String()
+	if ns != mesh.GetRootNamespace() && ns != w.namespace {
+		return false
+	}
+	ap := r.Message.(*v1beta1.AuthorizationPolicy)
+	if ap.Selector == nil {
+		return true
+	}
+	return k8s_labels.SelectorFromSet(ap.Selector.MatchLabels).Matches(w.labels)
+}
+
+// readMeshConfig returns the mesh config named istio, or the last one found. Unlike fetchMeshConfig, the result
+// is not cached across analyses.
+func readMeshConfig(c analysis.Context) *v1alpha1.MeshConfig {
+	mesh := &v1alpha1.MeshConfig{}
+	c.ForEach(collections.IstioMeshV1Alpha1MeshConfig.Name(), func(r *resource.Instance) bool {
+		mesh = r.Message.(*v1alpha1.MeshConfig)
+		return r.Metadata.FullName.Name != util.MeshConfigName
+	})
+	return mesh
+}
+
+// initWorkloads returns the in-mesh pods.
+func initWorkloads(c analysis.Context) []workload {
+	var workloads []workload
+	c.ForEach(collections.K8SCoreV1Pods.Name(), func(r *resource.Instance) bool {
+		if !util.PodInMesh(r, c) {
+			return true
+		}
+		p := r.Message.(*v1.Pod)
+		sa := p.Spec.ServiceAccountName
+		if sa == "" {
+			sa = "default"
+		}
+		workloads = append(workloads, workload{
+			namespace:      p.Namespace,
+			labels:         k8s_labels.Set(p.Labels),
+			serviceAccount: sa,
+		})
+		return true
+	})
+	return workloads
+}
+
+// ruleCovers returns true if every request matched by the allow rule is also matched by the deny rule. The check
+// is conservative: it may return false for rules that do overlap, but never returns true for rules that don't.
+func ruleCovers(deny, allow *v1beta1.Rule) bool {
+	if deny == nil {
+		return false
+	}
+	if allow == nil {
+		allow = &v1beta1.Rule{}
+	}
+
+	if len(deny.From) > 0 {
+		if len(allow.From) == 0 {
+			return false
+		}
+		for _, af := range allow.From {
+			covered := false
+			for _, df := range deny.From {
+				if sourceCovers(df.GetSource(), af.GetSource()) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				return false
+			}
+		}
+	}
+
+	if len(deny.To) > 0 {
+		if len(allow.To) == 0 {
+			return false
+		}
+		for _, at := range allow.To {
+			covered := false
+			for _, dt := range deny.To {
+				if operationCovers(dt.GetOperation(), at.GetOperation()) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				return false
+			}
+		}
+	}
+
+	// All the conditions of the deny rule must hold, each must be implied by a condition of the allow rule.
+	for _, dc := range deny.When {
+		covered := false
+		for _, ac := range allow.When {
+			if ac.Key == dc.Key && fieldCovers(dc.Values, dc.NotValues, ac.Values, ac.NotValues, conditionMatcher(dc.Key)) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func sourceCovers(deny, allow *v1beta1.Source) bool {
+	if deny == nil {
+		deny = &v1beta1.Source{}
+	}
+	if allow == nil {
+		allow = &v1beta1.Source{}
+	}
+	return fieldCovers(deny.Principals, deny.NotPrincipals, allow.Principals, allow.NotPrincipals, stringMatcher{}) &&
+		fieldCovers(deny.RequestPrincipals, deny.NotRequestPrincipals, allow.RequestPrincipals, allow.NotRequestPrincipals, stringMatcher{}) &&
+		fieldCovers(deny.Namespaces, deny.NotNamespaces, allow.Namespaces, allow.NotNamespaces, stringMatcher{}) &&
+		fieldCovers(deny.IpBlocks, deny.NotIpBlocks, allow.IpBlocks, allow.NotIpBlocks, cidrMatcher{}) &&
+		fieldCovers(deny.RemoteIpBlocks, deny.NotRemoteIpBlocks, allow.RemoteIpBlocks, allow.NotRemoteIpBlocks, cidrMatcher{})
+}
+
+func operationCovers(deny, allow *v1beta1.Operation) bool {
+	if deny == nil {
+		deny = &v1beta1.Operation{}
+	}
+	if allow == nil {
+		allow = &v1beta1.Operation{}
+	}
+	return fieldCovers(deny.Hosts, deny.NotHosts, allow.Hosts, allow.NotHosts, stringMatcher{}) &&
+		fieldCovers(deny.Ports, deny.NotPorts, allow.Ports, allow.NotPorts, stringMatcher{}) &&
+		fieldCovers(deny.Methods, deny.NotMethods, allow.Methods, allow.NotMethods, stringMatcher{}) &&
+		fieldCovers(deny.Paths, deny.NotPaths, allow.Paths, allow.NotPaths, stringMatcher{})
+}
+
+func conditionMatcher(key string) matcher {
+	if strings.HasSuffix(key, ".ip") {
+		return cidrMatcher{}
+	}
+	return stringMatcher{}
+}
+
+// matcher compares the values of a field of a rule.
+type matcher interface {
+	// covers returns true if every value matched by b is matched by a.
+	covers(a, b string) bool
+	// disjoint returns true if no value is matched by both a and b.
+	disjoint(a, b string) bool
+}
+
+// fieldCovers returns true if every value matched by the allow values is matched by the deny values. A value is
+// matched by a field if it matches one of the positive values, if any, and none of the negative values.
+func fieldCovers(denyValues, denyNotValues, allowValues, allowNotValues []string, m matcher) bool {
+	if len(denyValues) > 0 {
+		if len(allowValues) == 0 {
+			return false
+		}
+		for _, av := range allowValues {
+			if !anyCovers(denyValues, av, m) {
+				return false
+			}
+		}
+	}
+
+	if len(denyNotValues) > 0 {
+		// Either the allowed values never match the excluded values...
+		disjoint := len(allowValues) > 0
+		for _, av := range allowValues {
+			for _, dv := range denyNotValues {
+				if !m.disjoint(av, dv) {
+					disjoint = false
+				}
+			}
+		}
+		if disjoint {
+			return true
+		}
+		// ... or the allow rule excludes them as well.
+		for _, dv := range denyNotValues {
+			if !anyCovers(allowNotValues, dv, m) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func anyCovers(values []string, v string, m matcher) bool {
+	for _, value := range values {
+		if m.covers(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// stringMatcher compares values with the exact, prefix ("abc*"), suffix ("*abc") and presence ("*") matches
+// of authorization policies.
+type stringMatcher struct{}
+
+func (stringMatcher) covers(a, b string) bool {
+	switch {
+	case a == "*":
+		return true
+	case b == "*":
+		return false
+	case strings.HasSuffix(a, "*"):
+		return !strings.HasPrefix(b, "*") && strings.HasPrefix(strings.TrimSuffix(b, "*"), strings.TrimSuffix(a, "*"))
+	case strings.HasPrefix(a, "*"):
+		return !strings.HasSuffix(b, "*") && strings.HasSuffix(strings.TrimPrefix(b, "*"), strings.TrimPrefix(a, "*"))
+	default:
+		return a == b
+	}
+}
+
+func (m stringMatcher) disjoint(a, b string) bool {
+	if m.covers(a, b) || m.covers(b, a) {
+		return false
+	}
+	aPrefix, bPrefix := strings.HasSuffix(a, "*"), strings.HasSuffix(b, "*")
+	aSuffix, bSuffix := strings.HasPrefix(a, "*"), strings.HasPrefix(b, "*")
+	// A prefix and a suffix match always have values in common.
+	return !(aPrefix && bSuffix) && !(aSuffix && bPrefix)
+}
+
+// cidrMatcher compares IP addresses and CIDR ranges.
+type cidrMatcher struct{}
+
+func parseCIDR(s string) *net.IPNet {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 8 * net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil
+	}
+	return n
+}
+
+func (cidrMatcher) covers(a, b string) bool {
+	an, bn := parseCIDR(a), parseCIDR(b)
+	if an == nil || bn == nil {
+		return a == b
+	}
+	aOnes, aBits := an.Mask.Size()
+	bOnes, bBits := bn.Mask.Size()
+	return aBits == bBits && aOnes <= bOnes && an.Contains(bn.IP)
+}
+
+func (m cidrMatcher) disjoint(a, b string) bool {
+	an, bn := parseCIDR(a), parseCIDR(b)
+	if an == nil || bn == nil {
+		return false
+	}
+	return !an.Contains(bn.IP) && !bn.Contains(an.IP)
+}
@@ -0,0 +1,138 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"istio.io/api/security/v1beta1"
+)
+
+func TestStringMatcher(t *testing.T) {
+	assert := assert.New(t)
+	m := stringMatcher{}
+
+	assert.True(m.covers("*", "/api"))
+	assert.True(m.covers("/api*", "/api/v1"))
+	assert.True(m.covers("/api*", "/api/v1*"))
+	assert.False(m.covers("/api/v1*", "/api*"))
+	assert.True(m.covers("*.com", "*.example.com"))
+	assert.False(m.covers("/api*", "*/api"))
+	assert.False(m.covers("/api", "*"))
+
+	assert.True(m.disjoint("/api*", "/admin*"))
+	assert.True(m.disjoint("GET", "POST"))
+	assert.False(m.disjoint("/api*", "*.json"))
+	assert.False(m.disjoint("/api/v1", "/api*"))
+}
+
+func TestCidrMatcher(t *testing.T) {
+	assert := assert.New(t)
+	m := cidrMatcher{}
+
+	assert.True(m.covers("10.0.0.0/8", "10.1.0.0/16"))
+	assert.True(m.covers("10.0.0.0/8", "10.1.2.3"))
+	assert.False(m.covers("10.1.0.0/16", "10.0.0.0/8"))
+	assert.False(m.covers("10.0.0.0/8", "2001:db8::1"))
+
+	assert.True(m.disjoint("10.0.0.0/8", "192.168.0.0/16"))
+	assert.False(m.disjoint("10.0.0.0/8", "10.1.2.3"))
+}
+
+func TestRuleCovers(t *testing.T) {
+	from := func(s *v1beta1.Source) []*v1beta1.Rule_From {
+		return []*v1beta1.Rule_From{{Source: s}}
+	}
+	to := func(o *v1beta1.Operation) []*v1beta1.Rule_To {
+		return []*v1beta1.Rule_To{{Operation: o}}
+	}
+
+	cases := []struct {
+		name  string
+		deny  *v1beta1.Rule
+		allow *v1beta1.Rule
+		want  bool
+	}{
+		{
+			name:  "empty deny rule",
+			deny:  &v1beta1.Rule{},
+			allow: &v1beta1.Rule{To: to(&v1beta1.Operation{Paths: []string{"/api"}})},
+			want:  true,
+		},
+		{
+			name:  "deny prefix covers allowed paths",
+			deny:  &v1beta1.Rule{To: to(&v1beta1.Operation{Paths: []string{"/api*"}})},
+			allow: &v1beta1.Rule{To: to(&v1beta1.Operation{Paths: []string{"/api/v1", "/api/v2*"}, Methods: []string{"GET"}})},
+			want:  true,
+		},
+		{
+			name:  "allowed path outside of deny prefix",
+			deny:  &v1beta1.Rule{To: to(&v1beta1.Operation{Paths: []string{"/api*"}})},
+			allow: &v1beta1.Rule{To: to(&v1beta1.Operation{Paths: []string{"/api/v1", "/health"}})},
+			want:  false,
+		},
+		{
+			name:  "deny constraint missing in allow rule",
+			deny:  &v1beta1.Rule{To: to(&v1beta1.Operation{Methods: []string{"POST"}})},
+			allow: &v1beta1.Rule{From: from(&v1beta1.Source{Namespaces: []string{"foo"}})},
+			want:  false,
+		},
+		{
+			name:  "deny all but excluded namespace",
+			deny:  &v1beta1.Rule{From: from(&v1beta1.Source{NotNamespaces: []string{"istio-system"}})},
+			allow: &v1beta1.Rule{From: from(&v1beta1.Source{Namespaces: []string{"foo", "bar"}})},
+			want:  true,
+		},
+		{
+			name:  "allow the excluded namespace",
+			deny:  &v1beta1.Rule{From: from(&v1beta1.Source{NotNamespaces: []string{"istio-system"}})},
+			allow: &v1beta1.Rule{From: from(&v1beta1.Source{Namespaces: []string{"istio-*"}})},
+			want:  false,
+		},
+		{
+			name:  "allow excludes the excluded namespace too",
+			deny:  &v1beta1.Rule{From: from(&v1beta1.Source{NotNamespaces: []string{"istio-system"}})},
+			allow: &v1beta1.Rule{From: from(&v1beta1.Source{NotNamespaces: []string{"istio-*"}})},
+			want:  true,
+		},
+		{
+			name:  "ip blocks",
+			deny:  &v1beta1.Rule{From: from(&v1beta1.Source{IpBlocks: []string{"10.0.0.0/8"}})},
+			allow: &v1beta1.Rule{From: from(&v1beta1.Source{IpBlocks: []string{"10.1.0.0/16"}})},
+			want:  true,
+		},
+		{
+			name:  "conditions",
+			deny:  &v1beta1.Rule{When: []*v1beta1.Condition{{Key: "source.ip", Values: []string{"10.0.0.0/8"}}}},
+			allow: &v1beta1.Rule{When: []*v1beta1.Condition{{Key: "source.ip", Values: []string{"10.1.2.3"}}}},
+			want:  true,
+		},
+		{
+			name:  "condition on another key",
+			deny:  &v1beta1.Rule{When: []*v1beta1.Condition{{Key: "request.headers[x-user]", Values: []string{"admin"}}}},
+			allow: &v1beta1.Rule{When: []*v1beta1.Condition{{Key: "request.headers[x-role]", Values: []string{"admin"}}}},
+			want:  false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ruleCovers(tc.deny, tc.allow); got != tc.want {
+				t.Errorf("ruleCovers() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -38,6 +38,7 @@ var fieldMap = map[string]int{
 	"{.spec.ports[0].port}":                            1,
 	"{.spec.containers[0].image}":                      1,
 	"{.spec.rules[0].from[0].source.namespaces[0]}":    1,
+	"{.spec.rules[0].from[0].source.principals[0]}":    1,
 	"{.spec.selector.test}":                            1,
 	"{.spec.servers[0].tls.credentialName}":            1,
 	"{.networks.test.endpoints[0]}":                    1,
@@ -75,6 +76,7 @@ func TestConstants(t *testing.T) {
 		fmt.Sprintf(FromRegistry, "test", 0),
 		fmt.Sprintf(ImageInContainer, 0),
 		fmt.Sprintf(AuthorizationPolicyNameSpace, 0, 0, 0),
+		fmt.Sprintf(AuthorizationPolicyPrincipal, 0, 0, 0),
 		fmt.Sprintf(Annotation, "test"),
 		fmt.Sprintf(GatewaySelector, "test"),
 		fmt.Sprintf(CredentialName, 0),
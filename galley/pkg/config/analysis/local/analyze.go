@@ -306,7 +306,12 @@ func (sa *SourceAnalyzer) AddFileKubeMeshConfig(file string) error {
 		return err
 	}
 
-	cfg, err := mesh.ApplyMeshConfigDefaults(string(by))
+	return sa.AddKubeMeshConfig(string(by))
+}
+
+// AddKubeMeshConfig gets mesh config from the specified yaml text
+func (sa *SourceAnalyzer) AddKubeMeshConfig(text string) error {
+	cfg, err := mesh.ApplyMeshConfigDefaults(text)
 	if err != nil {
 		return err
 	}
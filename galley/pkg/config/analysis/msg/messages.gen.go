@@ -156,6 +156,18 @@ var (
 	// IngressRouteRulesNotAffected defines a diag.MessageType for message "IngressRouteRulesNotAffected".
 	// Description: Route rules have no effect on ingress gateway requests
 	IngressRouteRulesNotAffected = diag.NewMessageType(diag.Warning, "IST0140", "Subset in virtual service %s has no effect on ingress gateway %s requests")
+
+	// AuthorizationPolicyShadowedRule defines a diag.MessageType for message "AuthorizationPolicyShadowedRule".
+	// Description: An ALLOW rule of an authorization policy never allows requests because a DENY rule denies all the requests it matches.
+	AuthorizationPolicyShadowedRule = diag.NewMessageType(diag.Warning, "IST0141", "ALLOW rule %d never allows requests: all the requests it matches are denied by rule %d of the DENY policy %s.")
+
+	// AuthorizationPolicyUnknownTrustDomain defines a diag.MessageType for message "AuthorizationPolicyUnknownTrustDomain".
+	// Description: An authorization policy references a principal of a trust domain that is not used by the mesh.
+	AuthorizationPolicyUnknownTrustDomain = diag.NewMessageType(diag.Warning, "IST0142", "Principal %q can never match: the trust domain %q is neither the mesh trust domain nor one of its aliases.")
+
+	// AuthorizationPolicyUnknownServiceAccount defines a diag.MessageType for message "AuthorizationPolicyUnknownServiceAccount".
+	// Description: An authorization policy references a principal of a service account that no workload in the mesh uses.
+	AuthorizationPolicyUnknownServiceAccount = diag.NewMessageType(diag.Warning, "IST0143", "Principal %q can never match: no workload in the mesh uses the service account %q of namespace %q.")
 )
 
 // All returns a list of all known message types.
@@ -198,6 +210,9 @@ func All() []*diag.MessageType {
 		GatewayDuplicateCertificate,
 		InvalidWebhook,
 		IngressRouteRulesNotAffected,
+		AuthorizationPolicyShadowedRule,
+		AuthorizationPolicyUnknownTrustDomain,
+		AuthorizationPolicyUnknownServiceAccount,
 	}
 }
 
@@ -572,3 +587,35 @@ func NewIngressRouteRulesNotAffected(r *resource.Instance, virtualservicesubset
 		virtualservice,
 	)
 }
+
+// NewAuthorizationPolicyShadowedRule returns a new diag.Message based on AuthorizationPolicyShadowedRule.
+func NewAuthorizationPolicyShadowedRule(r *resource.Instance, rule int, denyRule int, denyPolicy string) diag.Message {
+	return diag.NewMessage(
+		AuthorizationPolicyShadowedRule,
+		r,
+		rule,
+		denyRule,
+		denyPolicy,
+	)
+}
+
+// NewAuthorizationPolicyUnknownTrustDomain returns a new diag.Message based on AuthorizationPolicyUnknownTrustDomain.
+func NewAuthorizationPolicyUnknownTrustDomain(r *resource.Instance, principal string, trustDomain string) diag.Message {
+	return diag.NewMessage(
+		AuthorizationPolicyUnknownTrustDomain,
+		r,
+		principal,
+		trustDomain,
+	)
+}
+
+// NewAuthorizationPolicyUnknownServiceAccount returns a new diag.Message based on AuthorizationPolicyUnknownServiceAccount.
+func NewAuthorizationPolicyUnknownServiceAccount(r *resource.Instance, principal string, serviceAccount string, namespace string) diag.Message {
+	return diag.NewMessage(
+		AuthorizationPolicyUnknownServiceAccount,
+		r,
+		principal,
+		serviceAccount,
+		namespace,
+	)
+}
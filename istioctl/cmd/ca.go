@@ -0,0 +1,328 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"istio.io/istio/security/pkg/pki/ca"
+)
+
+var (
+	revokedSerialNumber string
+	revokedIdentity     string
+	revocationReason    string
+)
+
+func caCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ca",
+		Short: "Command group used to interact with the Istio CA",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("unknown subcommand %q", args[0])
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.HelpFunc()(cmd, args)
+			return nil
+		},
+	}
+
+	cmd.AddCommand(caRevocationCommand())
+
+	return cmd
+}
+
+func caRevocationCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "revocation",
+		Short: "Command group used to revoke certificates issued by the Istio CA",
+		Long: fmt.Sprintf(`Command group used to revoke certificates issued by the Istio CA.
+
+The revocations are kept in the %q ConfigMap of the Istio namespace. Istiod publishes them in a certificate
+revocation list (CRL) signed by the CA, which the Istio agents started with CRL_XDS_AGENT=true add to the
+validation context of their proxy.
+
+A certificate is revoked by serial number, or all the certificates of a workload by SPIFFE identity. The CA refuses
+to sign certificates for a revoked identity. Only the certificates issued for it by the running istiod instances are
+listed in the CRL: revoke the certificates issued before by serial number.
+
+When the CA uses an intermediate certificate, the CRLs of its parent CAs must be set in the %q key of the ConfigMap.`,
+			ca.RevocationsConfigMap, ca.ParentCRLConfigMapKey),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("unknown subcommand %q", args[0])
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.HelpFunc()(cmd, args)
+			return nil
+		},
+	}
+
+	cmd.AddCommand(caRevokeCommand())
+	cmd.AddCommand(caRevocationListCommand())
+	cmd.AddCommand(caRevocationRemoveCommand())
+
+	return cmd
+}
+
+func caRevokeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add",
+		Short: "Revoke a certificate or the certificates of an identity",
+		Example: ` # Revoke the certificate with the serial number 1f:4a:2b, as printed by "istioctl proxy-config secret"
+ istioctl x ca revocation add --serial 1f:4a:2b --reason keyCompromise
+
+ # Revoke the certificates of the "legacy" service account of the "default" namespace
+ istioctl x ca revocation add --identity spiffe://cluster.local/ns/default/sa/legacy`,
+		Aliases: []string{"revoke"},
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("revocation add command does not accept arguments")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := kubeClient(kubeconfig, configContext)
+			if err != nil {
+				return fmt.Errorf("failed to create Kubernetes client: %v", err)
+			}
+			r := ca.Revocation{
+				SerialNumber: revokedSerialNumber,
+				Identity:     revokedIdentity,
+				Reason:       revocationReason,
+				RevokedAt:    time.Now().UTC().Truncate(time.Second),
+			}
+			return addRevocation(context.Background(), client.Kube(), istioNamespace, r, cmd.OutOrStdout())
+		},
+	}
+
+	cmd.Flags().StringVar(&revokedSerialNumber, "serial", "", "Serial number of the certificate to revoke, in hexadecimal")
+	cmd.Flags().StringVar(&revokedIdentity, "identity", "", "SPIFFE identity of the certificates to revoke")
+	cmd.Flags().StringVar(&revocationReason, "reason", "",
+		fmt.Sprintf("Reason of the revocation, one of %s", strings.Join(ca.RevocationReasons(), ", ")))
+	return cmd
+}
+
+func caRevocationListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List the revoked certificates and identities",
+		Example: "istioctl x ca revocation list",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("revocation list command does not accept arguments")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := kubeClient(kubeconfig, configContext)
+			if err != nil {
+				return fmt.Errorf("failed to create Kubernetes client: %v", err)
+			}
+			return listRevocations(context.Background(), client.Kube(), istioNamespace, cmd.OutOrStdout())
+		},
+	}
+
+	return cmd
+}
+
+func caRevocationRemoveCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "remove",
+		Short: "Remove the revocation of a certificate or an identity",
+		Example: ` # Remove the revocation of the "legacy" service account of the "default" namespace
+ istioctl x ca revocation remove --identity spiffe://cluster.local/ns/default/sa/legacy`,
+		Aliases: []string{"delete"},
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("revocation remove command does not accept arguments")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := kubeClient(kubeconfig, configContext)
+			if err != nil {
+				return fmt.Errorf("failed to create Kubernetes client: %v", err)
+			}
+			return removeRevocation(context.Background(), client.Kube(), istioNamespace,
+				revokedSerialNumber, revokedIdentity, cmd.OutOrStdout())
+		},
+	}
+
+	cmd.Flags().StringVar(&revokedSerialNumber, "serial", "", "Serial number of the revoked certificate, in hexadecimal")
+	cmd.Flags().StringVar(&revokedIdentity, "identity", "", "Revoked SPIFFE identity")
+	return cmd
+}
+
+// getRevocations returns the revocations and the ConfigMap holding them, or nil if it doesn't exist.
+func getRevocations(ctx context.Context, client kubernetes.Interface, namespace string) ([]ca.Revocation, *corev1.ConfigMap, error) {
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, ca.RevocationsConfigMap, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get ConfigMap %s/%s: %v", namespace, ca.RevocationsConfigMap, err)
+	}
+	revocations, err := ca.ParseRevocations(cm.Data[ca.RevocationsConfigMapKey])
+	if err != nil {
+		return nil, nil, fmt.Errorf("ConfigMap %s/%s: %v", namespace, ca.RevocationsConfigMap, err)
+	}
+	return revocations, cm, nil
+}
+
+// saveRevocations creates or updates the ConfigMap holding the revocations.
+func saveRevocations(ctx context.Context, client kubernetes.Interface, namespace string, cm *corev1.ConfigMap,
+	revocations []ca.Revocation) error {
+	data, err := ca.MarshalRevocations(revocations)
+	if err != nil {
+		return err
+	}
+	if cm == nil {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      ca.RevocationsConfigMap,
+				Namespace: namespace,
+			},
+			Data: map[string]string{ca.RevocationsConfigMapKey: data},
+		}
+		_, err = client.CoreV1().ConfigMaps(namespace).Create(ctx, cm, metav1.CreateOptions{})
+	} else {
+		cm = cm.DeepCopy()
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[ca.RevocationsConfigMapKey] = data
+		_, err = client.CoreV1().ConfigMaps(namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save ConfigMap %s/%s: %v", namespace, ca.RevocationsConfigMap, err)
+	}
+	return nil
+}
+
+// matchesRevocation returns true if the revocation is for the serial number or identity.
+func matchesRevocation(r ca.Revocation, serial, identity string) bool {
+	if identity != "" {
+		return r.Identity == identity
+	}
+	if r.SerialNumber == "" {
+		return false
+	}
+	a, errA := ca.ParseSerialNumber(r.SerialNumber)
+	b, errB := ca.ParseSerialNumber(serial)
+	return errA == nil && errB == nil && a.Cmp(b) == 0
+}
+
+func addRevocation(ctx context.Context, client kubernetes.Interface, namespace string, r ca.Revocation, w io.Writer) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	revocations, cm, err := getRevocations(ctx, client, namespace)
+	if err != nil {
+		return err
+	}
+	for _, existing := range revocations {
+		if matchesRevocation(existing, r.SerialNumber, r.Identity) {
+			return fmt.Errorf("%s is already revoked", revocationTarget(r))
+		}
+	}
+	if err := saveRevocations(ctx, client, namespace, cm, append(revocations, r)); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Revoked %s\n", revocationTarget(r))
+	return err
+}
+
+func removeRevocation(ctx context.Context, client kubernetes.Interface, namespace, serial, identity string, w io.Writer) error {
+	if (serial == "") == (identity == "") {
+		return fmt.Errorf("either --serial or --identity must be set")
+	}
+	revocations, cm, err := getRevocations(ctx, client, namespace)
+	if err != nil {
+		return err
+	}
+	kept := []ca.Revocation{}
+	var removed *ca.Revocation
+	for i, r := range revocations {
+		if matchesRevocation(r, serial, identity) {
+			removed = &revocations[i]
+			continue
+		}
+		kept = append(kept, r)
+	}
+	if removed == nil {
+		return fmt.Errorf("no revocation found for %s", revocationTarget(ca.Revocation{SerialNumber: serial, Identity: identity}))
+	}
+	if err := saveRevocations(ctx, client, namespace, cm, kept); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Removed the revocation of %s\n", revocationTarget(*removed))
+	return err
+}
+
+func listRevocations(ctx context.Context, client kubernetes.Interface, namespace string, w io.Writer) error {
+	revocations, _, err := getRevocations(ctx, client, namespace)
+	if err != nil {
+		return err
+	}
+	if len(revocations) == 0 {
+		_, err := fmt.Fprintln(w, "No revoked certificates found.")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+	fmt.Fprintln(tw, "SERIAL NUMBER\tIDENTITY\tREASON\tREVOKED AT")
+	for _, r := range revocations {
+		reason := r.Reason
+		if reason == "" {
+			reason = "unspecified"
+		}
+		revokedAt := "-"
+		if !r.RevokedAt.IsZero() {
+			revokedAt = r.RevokedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", dashIfEmpty(r.SerialNumber), dashIfEmpty(r.Identity), reason, revokedAt)
+	}
+	return tw.Flush()
+}
+
+func revocationTarget(r ca.Revocation) string {
+	if r.Identity != "" {
+		return "identity " + r.Identity
+	}
+	return "certificate " + r.SerialNumber
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,122 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"istio.io/istio/security/pkg/pki/ca"
+)
+
+func TestRevocations(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	revokedAt := time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+	identity := "spiffe://cluster.local/ns/default/sa/legacy"
+
+	var out bytes.Buffer
+	if err := listRevocations(ctx, client, "istio-system", &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "No revoked certificates found") {
+		t.Errorf("unexpected output without revocations: %q", out.String())
+	}
+
+	for _, r := range []ca.Revocation{
+		{Identity: identity, RevokedAt: revokedAt},
+		{SerialNumber: "1f:4a:2b", Reason: "keyCompromise", RevokedAt: revokedAt},
+	} {
+		out.Reset()
+		if err := addRevocation(ctx, client, "istio-system", r, &out); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(out.String(), "Revoked ") {
+			t.Errorf("unexpected output: %q", out.String())
+		}
+	}
+	err := addRevocation(ctx, client, "istio-system", ca.Revocation{SerialNumber: "1F4A2B"}, &out)
+	if err == nil || !strings.Contains(err.Error(), "already revoked") {
+		t.Errorf("got error %v, want the serial number to be already revoked", err)
+	}
+	if err := addRevocation(ctx, client, "istio-system", ca.Revocation{Identity: identity, SerialNumber: "1f"}, &out); err == nil {
+		t.Errorf("expected an error for a revocation with both a serial number and an identity")
+	}
+
+	cm, err := client.CoreV1().ConfigMaps("istio-system").Get(ctx, ca.RevocationsConfigMap, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocations, err := ca.ParseRevocations(cm.Data[ca.RevocationsConfigMapKey])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revocations) != 2 {
+		t.Fatalf("got revocations %+v, want 2", revocations)
+	}
+
+	out.Reset()
+	if err := listRevocations(ctx, client, "istio-system", &out); err != nil {
+		t.Fatal(err)
+	}
+	want := `SERIAL NUMBER IDENTITY                                    REASON        REVOKED AT
+-             spiffe://cluster.local/ns/default/sa/legacy unspecified   2021-05-01T10:00:00Z
+1f:4a:2b      -                                           keyCompromise 2021-05-01T10:00:00Z
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := removeRevocation(ctx, client, "istio-system", "", identity, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeRevocation(ctx, client, "istio-system", "", identity, &out); err == nil {
+		t.Errorf("expected an error when removing a missing revocation")
+	}
+	revocations, _, err = getRevocations(ctx, client, "istio-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revocations) != 1 || revocations[0].SerialNumber != "1f:4a:2b" {
+		t.Errorf("got revocations %+v, want the serial number only", revocations)
+	}
+}
+
+func TestRevocationsKeepParentCRL(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: ca.RevocationsConfigMap, Namespace: "istio-system"},
+		Data:       map[string]string{ca.ParentCRLConfigMapKey: "parent"},
+	})
+	var out bytes.Buffer
+	if err := addRevocation(ctx, client, "istio-system", ca.Revocation{SerialNumber: "1f"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	cm, err := client.CoreV1().ConfigMaps("istio-system").Get(ctx, ca.RevocationsConfigMap, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Data[ca.ParentCRLConfigMapKey] != "parent" {
+		t.Errorf("expected the CRLs of the parent CAs to be kept, got %v", cm.Data)
+	}
+}
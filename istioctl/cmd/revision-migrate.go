@@ -0,0 +1,613 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"istio.io/api/label"
+	pilotxds "istio.io/istio/pilot/pkg/xds"
+)
+
+const (
+	// istioInjectionLabel is the legacy namespace label enabling injection with the default revision.
+	istioInjectionLabel = "istio-injection"
+	// restartedAtAnnotation is the pod template annotation set by "kubectl rollout restart".
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+	deploymentKind  = "Deployment"
+	statefulSetKind = "StatefulSet"
+	daemonSetKind   = "DaemonSet"
+)
+
+type revisionMigrateArgs struct {
+	from             string
+	to               string
+	tag              string
+	namespaces       []string
+	concurrency      int
+	timeout          time.Duration
+	rollback         bool
+	dryRun           bool
+	skipConfirmation bool
+}
+
+var migrateArgs = revisionMigrateArgs{}
+
+func revisionMigrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Move the workloads of a control plane revision to another revision",
+		Long: `Move the workloads of a control plane revision to another revision.
+
+The namespaces labeled with the --from revision are relabeled with the --to revision, or the --tag revision tag is
+changed to reference the --to revision. The workloads injected by the --from revision are then restarted in batches
+of --concurrency workloads. Each batch must complete its rollout, with all its pods ready, injected by the --to
+revision and with their proxies synced with it, before the next batch starts.
+
+When a batch fails, it is rolled back to the --from revision, along with its namespace label or the revision tag, and
+the migration stops. The workloads of the batches migrated before are left on the --to revision.`,
+		Example: `  # Move the namespaces using the "1-9-5" revision to the "1-10-0" revision, 5 workloads at a time
+  istioctl x revision migrate --from 1-9-5 --to 1-10-0 --concurrency 5
+
+  # Point the "prod" revision tag at the "1-10-0" revision, and restart its workloads
+  istioctl x revision migrate --from 1-9-5 --to 1-10-0 --tag prod
+
+  # Show the workloads that would be restarted
+  istioctl x revision migrate --from 1-9-5 --to 1-10-0 --dry-run`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("revision migrate command does not accept arguments")
+			}
+			return nil
+		},
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return migrateArgs.validate()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := kubeClient(kubeconfig, configContext)
+			if err != nil {
+				return fmt.Errorf("failed to create Kubernetes client: %v", err)
+			}
+			m := newRevisionMigrator(client.Kube(), migrateArgs, cmd.OutOrStdout())
+			m.retargetTag = func(ctx context.Context, tag, revision string) error {
+				prevOverwrite, prevSkipConfirmation := overwrite, skipConfirmation
+				overwrite, skipConfirmation = true, true
+				defer func() {
+					overwrite, skipConfirmation = prevOverwrite, prevSkipConfirmation
+				}()
+				return setTag(ctx, client, tag, revision, false, io.Discard)
+			}
+			m.proxiesSynced = func(ctx context.Context, revision string, pods []v1.Pod) (bool, error) {
+				revClient, err := kubeClientWithRevision(kubeconfig, configContext, revision)
+				if err != nil {
+					return false, err
+				}
+				statuses, err := revClient.AllDiscoveryDo(ctx, istioNamespace, "/debug/syncz")
+				if err != nil {
+					return false, err
+				}
+				return proxiesSynced(statuses, pods)
+			}
+			return m.run(context.Background())
+		},
+	}
+
+	cmd.Flags().StringVar(&migrateArgs.from, "from", "", "Control plane revision to move the workloads from")
+	cmd.Flags().StringVar(&migrateArgs.to, "to", "", "Control plane revision to move the workloads to")
+	cmd.Flags().StringVar(&migrateArgs.tag, "tag", "",
+		"Revision tag to change to the --to revision, instead of relabeling the namespaces")
+	cmd.Flags().StringSliceVar(&migrateArgs.namespaces, "namespaces", nil,
+		"Namespaces to migrate, all the namespaces using the --from revision or the --tag revision tag if not set")
+	cmd.Flags().IntVar(&migrateArgs.concurrency, "concurrency", 5, "Number of workloads restarted at a time")
+	cmd.Flags().DurationVar(&migrateArgs.timeout, "timeout", 5*time.Minute,
+		"Maximum time for a batch of workloads to be ready and synced")
+	cmd.Flags().BoolVar(&migrateArgs.rollback, "rollback", true, "Roll back a batch of workloads if it fails")
+	cmd.Flags().BoolVar(&migrateArgs.dryRun, "dry-run", false, "Print the workloads to restart, without changing anything")
+	cmd.Flags().BoolVarP(&migrateArgs.skipConfirmation, "skip-confirmation", "y", false, skipConfirmationFlagHelpStr)
+	_ = cmd.MarkFlagRequired("from")
+	_ = cmd.MarkFlagRequired("to")
+	return cmd
+}
+
+func (a revisionMigrateArgs) validate() error {
+	if a.from == "" || a.to == "" {
+		return fmt.Errorf("both --from and --to must be set")
+	}
+	if a.from == a.to {
+		return fmt.Errorf("--from and --to must be different revisions")
+	}
+	if a.concurrency < 1 {
+		return fmt.Errorf("--concurrency must be at least 1")
+	}
+	if a.timeout <= 0 {
+		return fmt.Errorf("--timeout must be positive")
+	}
+	return nil
+}
+
+// migrationWorkload is a workload restarted to move to another revision.
+type migrationWorkload struct {
+	kind      string
+	namespace string
+	name      string
+	selector  *metav1.LabelSelector
+}
+
+func (w migrationWorkload) String() string {
+	return fmt.Sprintf("%s/%s.%s", strings.ToLower(w.kind), w.name, w.namespace)
+}
+
+// revisionMigrator moves the workloads of a revision to another revision.
+type revisionMigrator struct {
+	client kubernetes.Interface
+	args   revisionMigrateArgs
+	w      io.Writer
+
+	pollInterval time.Duration
+	// retargetTag changes the revision referenced by a revision tag.
+	retargetTag func(ctx context.Context, tag, revision string) error
+	// proxiesSynced returns whether the proxies of the pods are connected and synced with the revision.
+	proxiesSynced func(ctx context.Context, revision string, pods []v1.Pod) (bool, error)
+	// confirm asks the user to confirm the migration.
+	confirm func(msg string, w io.Writer) bool
+}
+
+func newRevisionMigrator(client kubernetes.Interface, args revisionMigrateArgs, w io.Writer) *revisionMigrator {
+	return &revisionMigrator{
+		client:       client,
+		args:         args,
+		w:            w,
+		pollInterval: 2 * time.Second,
+		confirm:      confirm,
+	}
+}
+
+// migrationNamespace is a namespace to migrate and its workloads.
+type migrationNamespace struct {
+	name      string
+	workloads []migrationWorkload
+}
+
+func (m *revisionMigrator) run(ctx context.Context) error {
+	if err := m.checkRevision(ctx, m.args.to); err != nil {
+		return err
+	}
+	namespaces, err := m.namespaces(ctx)
+	if err != nil {
+		return err
+	}
+	plan := make([]migrationNamespace, 0, len(namespaces))
+	total := 0
+	for _, ns := range namespaces {
+		workloads, err := m.workloads(ctx, ns, m.args.from)
+		if err != nil {
+			return err
+		}
+		plan = append(plan, migrationNamespace{name: ns, workloads: workloads})
+		total += len(workloads)
+	}
+	if len(plan) == 0 {
+		fmt.Fprintf(m.w, "No namespaces found using %s.\n", m.source())
+		return nil
+	}
+
+	fmt.Fprintf(m.w, "Moving %d workloads in %d namespaces from revision %q to revision %q:\n",
+		total, len(plan), m.args.from, m.args.to)
+	for _, ns := range plan {
+		fmt.Fprintf(m.w, "  %s:", ns.name)
+		if len(ns.workloads) == 0 {
+			fmt.Fprint(m.w, " no workloads")
+		}
+		for _, wl := range ns.workloads {
+			fmt.Fprintf(m.w, " %s/%s", strings.ToLower(wl.kind), wl.name)
+		}
+		fmt.Fprintln(m.w)
+	}
+	if m.args.dryRun {
+		return nil
+	}
+	if !m.args.skipConfirmation && !m.confirm("Proceed? (y/N)", m.w) {
+		fmt.Fprintf(m.w, "Aborting operation.\n")
+		return nil
+	}
+
+	if m.args.tag != "" {
+		if err := m.retargetTag(ctx, m.args.tag, m.args.to); err != nil {
+			return fmt.Errorf("failed to change revision tag %q to revision %q: %v", m.args.tag, m.args.to, err)
+		}
+		fmt.Fprintf(m.w, "Revision tag %q now references revision %q.\n", m.args.tag, m.args.to)
+	}
+	migrated := 0
+	for _, ns := range plan {
+		var original map[string]string
+		if m.args.tag == "" {
+			if original, err = m.relabel(ctx, ns.name, m.args.to, nil); err != nil {
+				return err
+			}
+			fmt.Fprintf(m.w, "Namespace %s now uses revision %q.\n", ns.name, m.args.to)
+		}
+		for start := 0; start < len(ns.workloads); start += m.args.concurrency {
+			end := start + m.args.concurrency
+			if end > len(ns.workloads) {
+				end = len(ns.workloads)
+			}
+			batch := ns.workloads[start:end]
+			if err := m.migrateBatch(ctx, batch, m.args.to); err != nil {
+				err = fmt.Errorf("batch %v failed: %v", batch, err)
+				if m.args.rollback {
+					err = multierror.Append(err, m.rollbackBatch(ctx, ns.name, original, batch))
+				}
+				fmt.Fprintf(m.w, "Migration stopped, %d of %d workloads moved to revision %q.\n", migrated, total, m.args.to)
+				return err
+			}
+			migrated += len(batch)
+			fmt.Fprintf(m.w, "Moved %v to revision %q (%d/%d).\n", batch, m.args.to, migrated, total)
+		}
+	}
+	fmt.Fprintf(m.w, "Migration completed, %d workloads moved to revision %q.\n", migrated, m.args.to)
+	return nil
+}
+
+// source describes what the migrated namespaces use.
+func (m *revisionMigrator) source() string {
+	if m.args.tag != "" {
+		return fmt.Sprintf("revision tag %q", m.args.tag)
+	}
+	return fmt.Sprintf("revision %q", m.args.from)
+}
+
+// checkRevision verifies the injector of the revision is installed.
+func (m *revisionMigrator) checkRevision(ctx context.Context, revision string) error {
+	webhooks, err := getWebhooksWithRevision(ctx, m.client, revision)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return fmt.Errorf("cannot find MutatingWebhookConfiguration with revision %q", revision)
+	}
+	return nil
+}
+
+// namespaces returns the sorted namespaces to migrate.
+func (m *revisionMigrator) namespaces(ctx context.Context) ([]string, error) {
+	selectors := []string{fmt.Sprintf("%s=%s", label.IoIstioRev.Name, m.args.from)}
+	if m.args.tag != "" {
+		selectors = []string{fmt.Sprintf("%s=%s", label.IoIstioRev.Name, m.args.tag)}
+	} else if m.args.from == defaultRevisionName {
+		selectors = append(selectors, fmt.Sprintf("%s=enabled", istioInjectionLabel))
+	}
+	found := map[string]bool{}
+	for _, selector := range selectors {
+		list, err := m.client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list namespaces: %v", err)
+		}
+		for _, ns := range list.Items {
+			found[ns.Name] = true
+		}
+	}
+	namespaces := []string{}
+	if len(m.args.namespaces) > 0 {
+		for _, ns := range m.args.namespaces {
+			if !found[ns] {
+				return nil, fmt.Errorf("namespace %s does not use %s", ns, m.source())
+			}
+			namespaces = append(namespaces, ns)
+		}
+	} else {
+		for ns := range found {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// workloads returns the workloads of the namespace with pods injected by the revision.
+func (m *revisionMigrator) workloads(ctx context.Context, namespace, revision string) ([]migrationWorkload, error) {
+	var candidates []migrationWorkload
+	deployments, err := m.client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deployments.Items {
+		candidates = append(candidates, migrationWorkload{deploymentKind, namespace, d.Name, d.Spec.Selector})
+	}
+	statefulSets, err := m.client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range statefulSets.Items {
+		candidates = append(candidates, migrationWorkload{statefulSetKind, namespace, s.Name, s.Spec.Selector})
+	}
+	daemonSets, err := m.client.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range daemonSets.Items {
+		candidates = append(candidates, migrationWorkload{daemonSetKind, namespace, d.Name, d.Spec.Selector})
+	}
+
+	var workloads []migrationWorkload
+	for _, wl := range candidates {
+		pods, err := m.pods(ctx, wl)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods {
+			if pod.Labels[label.IoIstioRev.Name] == revision {
+				workloads = append(workloads, wl)
+				break
+			}
+		}
+	}
+	return workloads, nil
+}
+
+func (m *revisionMigrator) pods(ctx context.Context, wl migrationWorkload) ([]v1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(wl.selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector of %v: %v", wl, err)
+	}
+	pods, err := m.client.CoreV1().Pods(wl.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// relabel sets the revision label of the namespace, or restores its original labels if set. It returns the labels
+// of the namespace before the change.
+func (m *revisionMigrator) relabel(ctx context.Context, namespace, revision string, original map[string]string) (
+	map[string]string, error) {
+	ns, err := m.client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	previous := map[string]string{}
+	for _, key := range []string{label.IoIstioRev.Name, istioInjectionLabel} {
+		if v, ok := ns.Labels[key]; ok {
+			previous[key] = v
+		}
+	}
+	ns = ns.DeepCopy()
+	if ns.Labels == nil {
+		ns.Labels = map[string]string{}
+	}
+	if original != nil {
+		delete(ns.Labels, label.IoIstioRev.Name)
+		delete(ns.Labels, istioInjectionLabel)
+		for k, v := range original {
+			ns.Labels[k] = v
+		}
+	} else {
+		// The legacy injection label takes precedence over the revision label.
+		delete(ns.Labels, istioInjectionLabel)
+		ns.Labels[label.IoIstioRev.Name] = revision
+	}
+	if _, err := m.client.CoreV1().Namespaces().Update(ctx, ns, metav1.UpdateOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to relabel namespace %s: %v", namespace, err)
+	}
+	return previous, nil
+}
+
+// migrateBatch restarts the workloads and waits for them to use the revision.
+func (m *revisionMigrator) migrateBatch(ctx context.Context, batch []migrationWorkload, revision string) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs error
+	for _, wl := range batch {
+		wl := wl
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.restart(ctx, wl); err != nil {
+				mu.Lock()
+				errs = multierror.Append(errs, fmt.Errorf("failed to restart %v: %v", wl, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if errs != nil {
+		return errs
+	}
+	return m.waitForBatch(ctx, batch, revision)
+}
+
+// rollbackBatch moves the namespace or revision tag and the workloads back to the original revision.
+func (m *revisionMigrator) rollbackBatch(ctx context.Context, namespace string, original map[string]string,
+	batch []migrationWorkload) error {
+	fmt.Fprintf(m.w, "Rolling back %v to revision %q.\n", batch, m.args.from)
+	if m.args.tag != "" {
+		if err := m.retargetTag(ctx, m.args.tag, m.args.from); err != nil {
+			return fmt.Errorf("failed to roll back revision tag %q: %v", m.args.tag, err)
+		}
+	} else if _, err := m.relabel(ctx, namespace, m.args.from, original); err != nil {
+		return fmt.Errorf("failed to roll back namespace %s: %v", namespace, err)
+	}
+	if err := m.migrateBatch(ctx, batch, m.args.from); err != nil {
+		return fmt.Errorf("failed to roll back %v: %v", batch, err)
+	}
+	fmt.Fprintf(m.w, "Rolled back %v to revision %q.\n", batch, m.args.from)
+	return nil
+}
+
+// restart triggers a rollout of the workload, like "kubectl rollout restart".
+func (m *revisionMigrator) restart(ctx context.Context, wl migrationWorkload) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{restartedAtAnnotation: time.Now().Format(time.RFC3339)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	switch wl.kind {
+	case deploymentKind:
+		_, err = m.client.AppsV1().Deployments(wl.namespace).Patch(ctx, wl.name, types.StrategicMergePatchType, patch,
+			metav1.PatchOptions{})
+	case statefulSetKind:
+		_, err = m.client.AppsV1().StatefulSets(wl.namespace).Patch(ctx, wl.name, types.StrategicMergePatchType, patch,
+			metav1.PatchOptions{})
+	case daemonSetKind:
+		_, err = m.client.AppsV1().DaemonSets(wl.namespace).Patch(ctx, wl.name, types.StrategicMergePatchType, patch,
+			metav1.PatchOptions{})
+	default:
+		err = fmt.Errorf("unsupported workload kind %s", wl.kind)
+	}
+	return err
+}
+
+// waitForBatch waits for the rollouts of the workloads to complete, with all their pods ready, injected by the
+// revision and synced with it.
+func (m *revisionMigrator) waitForBatch(ctx context.Context, batch []migrationWorkload, revision string) error {
+	var reason string
+	err := wait.PollImmediate(m.pollInterval, m.args.timeout, func() (bool, error) {
+		for _, wl := range batch {
+			done, why, err := m.workloadMigrated(ctx, wl, revision)
+			if err != nil {
+				return false, err
+			}
+			if !done {
+				reason = fmt.Sprintf("%v: %s", wl, why)
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("timed out after %v, %s", m.args.timeout, reason)
+	}
+	return err
+}
+
+// workloadMigrated returns whether the workload is rolled out to the revision, or the reason why not.
+func (m *revisionMigrator) workloadMigrated(ctx context.Context, wl migrationWorkload, revision string) (bool, string, error) {
+	if done, err := m.rolledOut(ctx, wl); err != nil || !done {
+		return false, "rollout in progress", err
+	}
+	pods, err := m.pods(ctx, wl)
+	if err != nil {
+		return false, "", err
+	}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			return false, fmt.Sprintf("pod %s is terminating", pod.Name), nil
+		}
+		if rev := pod.Labels[label.IoIstioRev.Name]; rev != revision {
+			return false, fmt.Sprintf("pod %s uses revision %q", pod.Name, rev), nil
+		}
+		if !podReady(&pod) {
+			return false, fmt.Sprintf("pod %s is not ready", pod.Name), nil
+		}
+	}
+	synced, err := m.proxiesSynced(ctx, revision, pods)
+	if err != nil {
+		return false, "", err
+	}
+	if !synced {
+		return false, "proxies are not synced", nil
+	}
+	return true, "", nil
+}
+
+// rolledOut returns whether the rollout of the workload is complete, as "kubectl rollout status".
+func (m *revisionMigrator) rolledOut(ctx context.Context, wl migrationWorkload) (bool, error) {
+	switch wl.kind {
+	case deploymentKind:
+		d, err := m.client.AppsV1().Deployments(wl.namespace).Get(ctx, wl.name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		replicas := int32(1)
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+		return d.Status.ObservedGeneration >= d.Generation && d.Status.UpdatedReplicas == replicas &&
+			d.Status.Replicas == replicas && d.Status.AvailableReplicas == replicas, nil
+	case statefulSetKind:
+		s, err := m.client.AppsV1().StatefulSets(wl.namespace).Get(ctx, wl.name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		replicas := int32(1)
+		if s.Spec.Replicas != nil {
+			replicas = *s.Spec.Replicas
+		}
+		return s.Status.ObservedGeneration >= s.Generation && s.Status.UpdatedReplicas == replicas &&
+			s.Status.ReadyReplicas == replicas && s.Status.CurrentRevision == s.Status.UpdateRevision, nil
+	case daemonSetKind:
+		d, err := m.client.AppsV1().DaemonSets(wl.namespace).Get(ctx, wl.name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return d.Status.ObservedGeneration >= d.Generation &&
+			d.Status.UpdatedNumberScheduled == d.Status.DesiredNumberScheduled &&
+			d.Status.NumberAvailable == d.Status.DesiredNumberScheduled, nil
+	}
+	return false, fmt.Errorf("unsupported workload kind %s", wl.kind)
+}
+
+func podReady(pod *v1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// proxiesSynced returns whether all the pods are connected to one of the Istiod instances, and have acked the
+// configuration sent to them, as reported by "istioctl proxy-status".
+func proxiesSynced(statuses map[string][]byte, pods []v1.Pod) (bool, error) {
+	synced := map[string]bool{}
+	for istiod, status := range statuses {
+		var ss []pilotxds.SyncStatus
+		if err := json.Unmarshal(status, &ss); err != nil {
+			return false, fmt.Errorf("failed to parse the sync status of %s: %v", istiod, err)
+		}
+		for _, s := range ss {
+			synced[s.ProxyID] = s.ClusterSent == s.ClusterAcked && s.ListenerSent == s.ListenerAcked &&
+				s.RouteSent == s.RouteAcked && s.EndpointSent == s.EndpointAcked
+		}
+	}
+	for _, pod := range pods {
+		if !synced[pod.Name+"."+pod.Namespace] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
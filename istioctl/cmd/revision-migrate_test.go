@@ -0,0 +1,234 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"istio.io/api/label"
+	pilotxds "istio.io/istio/pilot/pkg/xds"
+)
+
+func migrationNamespaceObj(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func migrationDeployment(namespace, name string) *appsv1.Deployment {
+	replicas := int32(1)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+		},
+		Status: appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+	}
+}
+
+func migrationPod(namespace, app, revision string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      app + "-pod",
+			Namespace: namespace,
+			Labels:    map[string]string{"app": app, label.IoIstioRev.Name: revision},
+		},
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+// newMigrationClient returns a fake client where restarting a deployment re-injects its pods with the revision
+// returned by injectedRevision for the namespace labels.
+func newMigrationClient(t *testing.T, injectedRevision func(labels map[string]string) string,
+	objs ...runtime.Object) *fake.Clientset {
+	t.Helper()
+	objs = append(objs, revisionCanonicalWebhook.DeepCopy())
+	client := fake.NewSimpleClientset(objs...)
+	client.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		ns := action.GetNamespace()
+		nsObj, err := client.Tracker().Get(corev1.SchemeGroupVersion.WithResource("namespaces"), "", ns)
+		if err != nil {
+			return true, nil, err
+		}
+		name := action.(k8stesting.PatchAction).GetName()
+		podObj, err := client.Tracker().Get(corev1.SchemeGroupVersion.WithResource("pods"), ns, name+"-pod")
+		if err != nil {
+			return true, nil, err
+		}
+		pod := podObj.(*corev1.Pod).DeepCopy()
+		pod.Labels[label.IoIstioRev.Name] = injectedRevision(nsObj.(*corev1.Namespace).Labels)
+		if err := client.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), pod, ns); err != nil {
+			return true, nil, err
+		}
+		return false, nil, nil
+	})
+	return client
+}
+
+func podRevision(t *testing.T, client *fake.Clientset, namespace, app string) string {
+	t.Helper()
+	pod, err := client.CoreV1().Pods(namespace).Get(context.TODO(), app+"-pod", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pod.Labels[label.IoIstioRev.Name]
+}
+
+func TestRevisionMigrate(t *testing.T) {
+	client := newMigrationClient(t,
+		func(labels map[string]string) string {
+			if labels[istioInjectionLabel] == "enabled" {
+				return defaultRevisionName
+			}
+			return labels[label.IoIstioRev.Name]
+		},
+		migrationNamespaceObj("ns1", map[string]string{istioInjectionLabel: "enabled", "team": "a"}),
+		migrationNamespaceObj("ns2", map[string]string{label.IoIstioRev.Name: "other"}),
+		migrationDeployment("ns1", "a"),
+		migrationDeployment("ns1", "b"),
+		migrationDeployment("ns1", "c"),
+		migrationDeployment("ns2", "d"),
+		migrationPod("ns1", "a", defaultRevisionName),
+		migrationPod("ns1", "b", defaultRevisionName),
+		migrationPod("ns1", "c", defaultRevisionName),
+		migrationPod("ns2", "d", "other"),
+	)
+	var out bytes.Buffer
+	m := newRevisionMigrator(client, revisionMigrateArgs{
+		from:             defaultRevisionName,
+		to:               "revision",
+		concurrency:      2,
+		timeout:          time.Second,
+		rollback:         true,
+		skipConfirmation: true,
+	}, &out)
+	m.pollInterval = 10 * time.Millisecond
+	synced := 0
+	m.proxiesSynced = func(_ context.Context, revision string, pods []corev1.Pod) (bool, error) {
+		if revision != "revision" {
+			t.Errorf("unexpected revision %q", revision)
+		}
+		synced += len(pods)
+		return true, nil
+	}
+	if err := m.run(context.TODO()); err != nil {
+		t.Fatalf("migration failed: %v\n%s", err, out.String())
+	}
+	for _, app := range []string{"a", "b", "c"} {
+		if rev := podRevision(t, client, "ns1", app); rev != "revision" {
+			t.Errorf("pod of %s uses revision %q, want %q", app, rev, "revision")
+		}
+	}
+	if rev := podRevision(t, client, "ns2", "d"); rev != "other" {
+		t.Errorf("pod of d uses revision %q, should not be migrated", rev)
+	}
+	ns, _ := client.CoreV1().Namespaces().Get(context.TODO(), "ns1", metav1.GetOptions{})
+	if ns.Labels[label.IoIstioRev.Name] != "revision" || ns.Labels[istioInjectionLabel] != "" || ns.Labels["team"] != "a" {
+		t.Errorf("unexpected namespace labels %v", ns.Labels)
+	}
+	if synced != 3 {
+		t.Errorf("got %d synced pods, want 3", synced)
+	}
+	if !strings.Contains(out.String(), "3 workloads moved") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestRevisionMigrateRollback(t *testing.T) {
+	tagTarget := "1-9"
+	client := newMigrationClient(t,
+		func(labels map[string]string) string {
+			if labels[label.IoIstioRev.Name] == "prod" {
+				return tagTarget
+			}
+			return labels[label.IoIstioRev.Name]
+		},
+		migrationNamespaceObj("ns1", map[string]string{label.IoIstioRev.Name: "prod"}),
+		migrationDeployment("ns1", "a"),
+		migrationPod("ns1", "a", "1-9"),
+	)
+	var out bytes.Buffer
+	m := newRevisionMigrator(client, revisionMigrateArgs{
+		from:             "1-9",
+		to:               "revision",
+		tag:              "prod",
+		concurrency:      1,
+		timeout:          50 * time.Millisecond,
+		rollback:         true,
+		skipConfirmation: true,
+	}, &out)
+	m.pollInterval = 10 * time.Millisecond
+	m.retargetTag = func(_ context.Context, tag, revision string) error {
+		if tag != "prod" {
+			t.Errorf("unexpected tag %q", tag)
+		}
+		tagTarget = revision
+		return nil
+	}
+	m.proxiesSynced = func(_ context.Context, revision string, _ []corev1.Pod) (bool, error) {
+		return revision == "1-9", nil
+	}
+	err := m.run(context.TODO())
+	if err == nil || !strings.Contains(err.Error(), "proxies are not synced") {
+		t.Fatalf("expected the migration to fail on unsynced proxies, got %v", err)
+	}
+	if tagTarget != "1-9" {
+		t.Errorf("revision tag references %q, want it rolled back", tagTarget)
+	}
+	if rev := podRevision(t, client, "ns1", "a"); rev != "1-9" {
+		t.Errorf("pod uses revision %q, want it rolled back", rev)
+	}
+	if !strings.Contains(out.String(), "Rolled back") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestProxiesSynced(t *testing.T) {
+	status := func(ss ...pilotxds.SyncStatus) []byte {
+		b, err := json.Marshal(ss)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	pods := []corev1.Pod{*migrationPod("ns1", "a", "revision"), *migrationPod("ns1", "b", "revision")}
+	statuses := map[string][]byte{
+		"istiod-1": status(pilotxds.SyncStatus{ProxyID: "a-pod.ns1", ClusterSent: "1", ClusterAcked: "1"}),
+		"istiod-2": status(pilotxds.SyncStatus{ProxyID: "b-pod.ns1", ListenerSent: "2", ListenerAcked: "1"}),
+	}
+	if synced, err := proxiesSynced(statuses, pods); err != nil || synced {
+		t.Errorf("expected an unacked listener to be reported, got %v %v", synced, err)
+	}
+	statuses["istiod-2"] = status(pilotxds.SyncStatus{ProxyID: "b-pod.ns1", ListenerSent: "2", ListenerAcked: "2"})
+	if synced, err := proxiesSynced(statuses, pods); err != nil || !synced {
+		t.Errorf("expected the proxies to be synced, got %v %v", synced, err)
+	}
+	if synced, err := proxiesSynced(statuses, append(pods, *migrationPod("ns1", "c", "revision"))); err != nil || synced {
+		t.Errorf("expected a disconnected proxy to be reported, got %v %v", synced, err)
+	}
+}
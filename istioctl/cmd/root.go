@@ -227,6 +227,8 @@ debug and diagnose their Istio mesh.
 	experimentalCmd.AddCommand(workloadCommands())
 	experimentalCmd.AddCommand(revisionCommand())
 	experimentalCmd.AddCommand(debugCommand())
+	experimentalCmd.AddCommand(simulateCmd())
+	experimentalCmd.AddCommand(caCommand())
 
 	analyzeCmd := Analyze()
 	hideInheritedFlags(analyzeCmd, "istioNamespace")
@@ -0,0 +1,421 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/spf13/cobra"
+
+	"istio.io/istio/istioctl/pkg/util/configdump"
+	"istio.io/istio/istioctl/pkg/util/handlers"
+	"istio.io/istio/pilot/pkg/config/kube/crd"
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
+	"istio.io/istio/pilot/pkg/serviceregistry/serviceentry"
+	"istio.io/istio/pilot/pkg/simulation/traffic"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/pkg/version"
+)
+
+type simulateArgs struct {
+	// Source of the proxy configuration
+	configDumpFile string
+	configFiles    []string
+
+	// Proxy used to generate the configuration from configFiles
+	proxyType      string
+	proxyNamespace string
+	proxyLabels    map[string]string
+	proxyIP        string
+
+	// The simulated call
+	address  string
+	port     int
+	protocol string
+	tls      string
+	host     string
+	path     string
+	sni      string
+	alpn     string
+	headers  []string
+	mode     string
+}
+
+func simulateCmd() *cobra.Command {
+	args := simulateArgs{}
+	cmd := &cobra.Command{
+		Use:   "simulate [<type>/]<name>[.<namespace>]",
+		Short: "Simulate where a request would be routed by a proxy",
+		Long: `Simulate evaluates a request against the listeners, routes and clusters of a proxy, and prints the
+listener, filter chain, virtual host, route and cluster that would handle it, along with why the other
+candidates were skipped.
+
+The configuration is read from the Envoy config dump of a pod, from a config dump file (-f), or generated
+offline from Istio configuration files (--config-file). In offline mode, services are declared with
+ServiceEntries and the proxy is described with the --proxy-* flags.
+
+Only the path of HTTP requests is matched against the routes.`,
+		Example: `  # Where does a request from productpage to reviews:9080/health go?
+  istioctl x simulate productpage-v1-123456-abcde --host reviews --port 9080 --path /health
+
+  # Simulate an inbound mTLS request to the pod
+  istioctl x simulate reviews-v1-123456-abcde --mode inbound --address 10.0.0.1 --port 9080 --tls mtls
+
+  # Simulate against a config dump file
+  istioctl x simulate -f productpage_config_dump.json --host reviews --port 9080
+
+  # Simulate against configuration generated offline for a sidecar in namespace default
+  istioctl x simulate --config-file services.yaml --config-file routing.yaml --proxy-namespace default \
+    --host reviews.default.svc.cluster.local --port 9080 --path /api`,
+		Args: func(cmd *cobra.Command, positional []string) error {
+			if len(positional) > 1 {
+				cmd.Println(cmd.UsageString())
+				return fmt.Errorf("simulate requires at most one <pod-name>[.<pod-namespace>]")
+			}
+			sources := 0
+			for _, set := range []bool{len(positional) == 1, args.configDumpFile != "", len(args.configFiles) > 0} {
+				if set {
+					sources++
+				}
+			}
+			if sources != 1 {
+				cmd.Println(cmd.UsageString())
+				return fmt.Errorf("expecting exactly one of a pod name, --file or --config-file")
+			}
+			if args.port <= 0 {
+				return fmt.Errorf("--port is required")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, positional []string) error {
+			call, err := args.call()
+			if err != nil {
+				return err
+			}
+
+			var configDump *configdump.Wrapper
+			if args.configDumpFile != "" {
+				configDump, err = getConfigDumpFromFile(args.configDumpFile)
+				if err != nil {
+					return fmt.Errorf("failed to get config dump from file %s: %s", args.configDumpFile, err)
+				}
+			} else if len(positional) == 1 {
+				kubeClient, err := kubeClient(kubeconfig, configContext)
+				if err != nil {
+					return fmt.Errorf("failed to create k8s client: %w", err)
+				}
+				podName, podNamespace, err := handlers.InferPodInfoFromTypedResource(positional[0],
+					handlers.HandleNamespace(namespace, defaultNamespace),
+					kubeClient.UtilFactory())
+				if err != nil {
+					return err
+				}
+				configDump, err = getConfigDumpFromPod(podName, podNamespace)
+				if err != nil {
+					return fmt.Errorf("failed to get config dump from pod %s in %s: %v", podName, podNamespace, err)
+				}
+			}
+
+			var offlineConfig string
+			if len(args.configFiles) > 0 {
+				if offlineConfig, err = readConfigFiles(args.configFiles); err != nil {
+					return err
+				}
+			}
+
+			var sim *traffic.Simulator
+			if configDump != nil {
+				sim, err = simulatorFromConfigDump(configDump)
+			} else {
+				sim, err = args.offlineSimulator(offlineConfig)
+			}
+			if err != nil {
+				return err
+			}
+			var trace []string
+			sim.Trace = func(format string, a ...interface{}) {
+				trace = append(trace, fmt.Sprintf(format, a...))
+			}
+			result, err := sim.Run(call)
+			if err != nil {
+				return fmt.Errorf("simulation failed: %v", err)
+			}
+			printSimulation(cmd.OutOrStdout(), result, trace)
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVarP(&args.configDumpFile, "file", "f", "",
+		"Envoy config dump JSON file to simulate the request against")
+	cmd.PersistentFlags().StringSliceVar(&args.configFiles, "config-file", nil,
+		"Istio configuration files to generate the proxy configuration from, instead of using a live proxy")
+	cmd.PersistentFlags().StringVar(&args.proxyType, "proxy-type", string(model.SidecarProxy),
+		"Type of the offline proxy, sidecar or router")
+	cmd.PersistentFlags().StringVar(&args.proxyNamespace, "proxy-namespace", "default",
+		"Namespace of the offline proxy")
+	cmd.PersistentFlags().StringToStringVar(&args.proxyLabels, "proxy-labels", nil,
+		"Labels of the offline proxy, used to select Sidecars, Gateways and policies")
+	cmd.PersistentFlags().StringVar(&args.proxyIP, "proxy-ip", "1.1.1.1",
+		"IP address of the offline proxy")
+
+	cmd.PersistentFlags().StringVar(&args.address, "address", "",
+		"Destination IP address of the request. Defaults to an address not matching any listener")
+	cmd.PersistentFlags().IntVar(&args.port, "port", 0, "Destination port of the request")
+	cmd.PersistentFlags().StringVar(&args.protocol, "protocol", string(traffic.HTTP),
+		"Protocol of the request, one of http, http2 or tcp")
+	cmd.PersistentFlags().StringVar(&args.tls, "tls", string(traffic.Plaintext),
+		"TLS mode of the request, one of plaintext, tls or mtls")
+	cmd.PersistentFlags().StringVar(&args.host, "host", "", "Host header of the request")
+	cmd.PersistentFlags().StringVar(&args.path, "path", "/", "Path of the request")
+	cmd.PersistentFlags().StringVar(&args.sni, "sni", "", "SNI of the request. Defaults to the host for TLS")
+	cmd.PersistentFlags().StringVar(&args.alpn, "alpn", "", "ALPN of the request. Defaults based on the protocol for TLS")
+	cmd.PersistentFlags().StringSliceVar(&args.headers, "header", nil, "Headers of the request, as name=value")
+	cmd.PersistentFlags().StringVar(&args.mode, "mode", string(traffic.CallModeOutbound),
+		"How the request reaches the proxy: outbound (from the application), inbound (to the application) "+
+			"or gateway (without traffic capture)")
+	return cmd
+}
+
+// call returns the simulated call described by the flags.
+func (a simulateArgs) call() (traffic.Call, error) {
+	call := traffic.Call{
+		Address:    a.address,
+		Port:       a.port,
+		Path:       a.path,
+		Protocol:   traffic.Protocol(a.protocol),
+		TLS:        traffic.TLSMode(a.tls),
+		Alpn:       a.alpn,
+		HostHeader: a.host,
+		Headers:    http.Header{},
+		Sni:        a.sni,
+		CallMode:   traffic.CallMode(a.mode),
+	}
+	switch call.Protocol {
+	case traffic.HTTP, traffic.HTTP2, traffic.TCP:
+	default:
+		return call, fmt.Errorf("unknown protocol %q", a.protocol)
+	}
+	switch call.TLS {
+	case traffic.Plaintext, traffic.TLS, traffic.MTLS:
+	default:
+		return call, fmt.Errorf("unknown TLS mode %q", a.tls)
+	}
+	switch call.CallMode {
+	case traffic.CallModeOutbound, traffic.CallModeInbound, traffic.CallModeGateway:
+	default:
+		return call, fmt.Errorf("unknown mode %q", a.mode)
+	}
+	for _, h := range a.headers {
+		kv := strings.SplitN(h, "=", 2)
+		if len(kv) != 2 {
+			return call, fmt.Errorf("invalid header %q, expected name=value", h)
+		}
+		call.Headers.Add(kv[0], kv[1])
+	}
+	return call, nil
+}
+
+// offlineSimulator generates the configuration of the proxy described by the flags from the Istio config,
+// the same way istiod would: services come from the ServiceEntries, and the rest of the config is read
+// from an in-memory store.
+func (a simulateArgs) offlineSimulator(configString string) (*traffic.Simulator, error) {
+	proxyType := model.NodeType(a.proxyType)
+	if !model.IsApplicationNodeType(proxyType) {
+		return nil, fmt.Errorf("unknown proxy type %q", a.proxyType)
+	}
+	configs, _, err := crd.ParseInputs(configString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	store := memory.Make(collections.Pilot)
+	for _, cfg := range configs {
+		if cfg.Namespace == "" {
+			cfg.Namespace = a.proxyNamespace
+		}
+		if _, err := store.Create(cfg); err != nil {
+			return nil, fmt.Errorf("invalid %s %s/%s: %v", cfg.GroupVersionKind.Kind, cfg.Namespace, cfg.Name, err)
+		}
+	}
+	configStore := model.MakeIstioStore(store)
+
+	// The store is fully populated, so the ServiceEntry registry does not need to watch it.
+	serviceDiscovery := aggregate.NewController(aggregate.Options{})
+	serviceDiscovery.AddRegistry(serviceentry.NewServiceDiscovery(nil, configStore, nil))
+
+	meshConfig := mesh.DefaultMeshConfig()
+	env := &model.Environment{
+		ServiceDiscovery: serviceDiscovery,
+		IstioConfigStore: configStore,
+		Watcher:          mesh.NewFixedWatcher(&meshConfig),
+		NetworksWatcher:  mesh.NewFixedNetworksWatcher(nil),
+	}
+	env.Init()
+	push := model.NewPushContext()
+	if err := push.InitContext(env, nil, nil); err != nil {
+		return nil, fmt.Errorf("failed to initialize push context: %v", err)
+	}
+	env.PushContext = push
+
+	proxy := &model.Proxy{
+		Type:            proxyType,
+		ID:              "simulated." + a.proxyNamespace,
+		ConfigNamespace: a.proxyNamespace,
+		DNSDomain:       a.proxyNamespace + ".svc." + env.DomainSuffix,
+		IPAddresses:     []string{a.proxyIP},
+		Metadata: &model.NodeMetadata{
+			Namespace:    a.proxyNamespace,
+			Labels:       a.proxyLabels,
+			IstioVersion: version.Info.Version,
+		},
+	}
+	proxy.IstioVersion = model.ParseIstioVersion(proxy.Metadata.IstioVersion)
+	proxy.SetSidecarScope(push)
+	proxy.SetGatewaysForProxy(push)
+	proxy.SetServiceInstances(env.ServiceDiscovery)
+	proxy.DiscoverIPVersions()
+
+	// The plugins istiod runs by default.
+	plugins := []string{plugin.AuthzCustom, plugin.Authn, plugin.Authz}
+	cg := core.NewConfigGenerator(plugins, &model.DisabledCache{})
+	return traffic.NewSimulatorFromConfigGen(cg, proxy, push)
+}
+
+func readConfigFiles(files []string) (string, error) {
+	configs := make([]string, 0, len(files))
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %v", f, err)
+		}
+		configs = append(configs, string(b))
+	}
+	return strings.Join(configs, "\n---\n"), nil
+}
+
+// simulatorFromConfigDump creates a simulator from the active listeners, routes and clusters in the config dump.
+func simulatorFromConfigDump(configDump *configdump.Wrapper) (*traffic.Simulator, error) {
+	listenerDump, err := configDump.GetListenerConfigDump()
+	if err != nil {
+		return nil, err
+	}
+	listeners := []*listener.Listener{}
+	for _, l := range listenerDump.StaticListeners {
+		ll := &listener.Listener{}
+		if err := l.GetListener().UnmarshalTo(ll); err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, ll)
+	}
+	for _, l := range listenerDump.DynamicListeners {
+		if l.GetActiveState() == nil {
+			continue
+		}
+		ll := &listener.Listener{}
+		if err := l.GetActiveState().GetListener().UnmarshalTo(ll); err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, ll)
+	}
+
+	routeDump, err := configDump.GetRouteConfigDump()
+	if err != nil {
+		return nil, err
+	}
+	routes := []*route.RouteConfiguration{}
+	for _, r := range routeDump.StaticRouteConfigs {
+		rc := &route.RouteConfiguration{}
+		if err := r.GetRouteConfig().UnmarshalTo(rc); err != nil {
+			return nil, err
+		}
+		routes = append(routes, rc)
+	}
+	for _, r := range routeDump.DynamicRouteConfigs {
+		rc := &route.RouteConfiguration{}
+		if err := r.GetRouteConfig().UnmarshalTo(rc); err != nil {
+			return nil, err
+		}
+		routes = append(routes, rc)
+	}
+
+	clusterDump, err := configDump.GetClusterConfigDump()
+	if err != nil {
+		return nil, err
+	}
+	clusters := []*cluster.Cluster{}
+	for _, c := range clusterDump.StaticClusters {
+		cc := &cluster.Cluster{}
+		if err := c.GetCluster().UnmarshalTo(cc); err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, cc)
+	}
+	for _, c := range clusterDump.DynamicActiveClusters {
+		cc := &cluster.Cluster{}
+		if err := c.GetCluster().UnmarshalTo(cc); err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, cc)
+	}
+
+	return &traffic.Simulator{
+		Listeners: listeners,
+		Clusters:  clusters,
+		Routes:    routes,
+	}, nil
+}
+
+func printSimulation(writer io.Writer, result traffic.Result, trace []string) {
+	w := new(tabwriter.Writer).Init(writer, 0, 8, 1, ' ', 0)
+	stages := []struct {
+		name  string
+		value string
+	}{
+		{"Listener", result.ListenerMatched},
+		{"Filter chain", result.FilterChainMatched},
+		{"Route config", result.RouteConfigMatched},
+		{"Virtual host", result.VirtualHostMatched},
+		{"Route", result.RouteMatched},
+		{"Cluster", result.ClusterMatched},
+	}
+	for _, s := range stages {
+		if s.value != "" {
+			_, _ = fmt.Fprintf(w, "%s:\t%s\n", s.name, s.value)
+		}
+	}
+	if result.Error != nil {
+		_, _ = fmt.Fprintf(w, "Error:\t%v\n", result.Error)
+	}
+	_ = w.Flush()
+
+	if len(trace) > 0 {
+		_, _ = fmt.Fprintln(writer, "\nTrace:")
+		for _, t := range trace {
+			_, _ = fmt.Fprintf(writer, "  %s\n", t)
+		}
+	}
+}
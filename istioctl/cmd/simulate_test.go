@@ -0,0 +1,109 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const simulateConfig = `
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: reviews
+  namespace: default
+spec:
+  hosts:
+  - reviews.default.svc.cluster.local
+  addresses:
+  - 10.10.0.1
+  ports:
+  - number: 9080
+    name: http
+    protocol: HTTP
+  location: MESH_INTERNAL
+  resolution: STATIC
+  endpoints:
+  - address: 10.20.0.1
+---
+apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: reviews
+  namespace: default
+spec:
+  hosts:
+  - reviews.default.svc.cluster.local
+  http:
+  - name: api
+    match:
+    - uri:
+        prefix: /api
+    route:
+    - destination:
+        host: reviews.default.svc.cluster.local
+        subset: v2
+  - route:
+    - destination:
+        host: reviews.default.svc.cluster.local
+`
+
+func TestSimulate(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(configFile, []byte(simulateConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	simulate := "x simulate --config-file " + configFile + " --host reviews.default.svc.cluster.local --port 9080"
+
+	cases := []testCase{
+		{
+			args: strings.Split(simulate+" --path /api/v1", " "),
+			expectedRegexp: regexp.MustCompile(`(?s)Listener: +0\.0\.0\.0_9080\n.*` +
+				`Route config: +9080\n.*` +
+				`Virtual host: +reviews\.default\.svc\.cluster\.local:9080\n.*` +
+				`Route: +api\n.*` +
+				`Cluster: +outbound\|9080\|v2\|reviews\.default\.svc\.cluster\.local\n.*` +
+				`Trace:\n`),
+		},
+		{
+			args:           strings.Split(simulate+" --path /other", " "),
+			expectedRegexp: regexp.MustCompile(`(?s)Cluster: +outbound\|9080\|\|reviews\.default\.svc\.cluster\.local\n.*route "api" skipped`),
+		},
+		{
+			args:           strings.Split(simulate+" --protocol ftp", " "),
+			expectedRegexp: regexp.MustCompile(`unknown protocol "ftp"`),
+			wantException:  true,
+		},
+		{
+			args:           strings.Split("x simulate --config-file "+configFile+" --host reviews", " "),
+			expectedRegexp: regexp.MustCompile("--port is required"),
+			wantException:  true,
+		},
+		{
+			args:           strings.Split("x simulate pod-1 --config-file "+configFile+" --port 9080", " "),
+			expectedRegexp: regexp.MustCompile("expecting exactly one of a pod name, --file or --config-file"),
+			wantException:  true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(strings.Join(c.args, " "), func(t *testing.T) {
+			verifyOutput(t, c)
+		})
+	}
+}
@@ -15,15 +15,32 @@
 package mesh
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	klabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"istio.io/api/label"
 	"istio.io/istio/operator/pkg/compare"
+	"istio.io/istio/operator/pkg/helm"
+	"istio.io/istio/operator/pkg/helmreconciler"
+	"istio.io/istio/operator/pkg/manifest"
+	"istio.io/istio/operator/pkg/name"
+	"istio.io/istio/operator/pkg/object"
 	"istio.io/istio/operator/pkg/util"
+	"istio.io/istio/operator/pkg/util/clog"
 )
 
 // YAMLSuffix is the suffix of a YAML file.
@@ -46,6 +63,21 @@ type manifestDiffArgs struct {
 	// The format of each renaming pair is A->B, all renaming pairs are comma separated.
 	// e.g. Service:*:istio-pilot->Service:*:istio-control - rename istio-pilot service into istio-control
 	renameResources string
+	// cluster compares the manifest rendered for an IstioOperator with the live objects installed by it.
+	cluster bool
+	// inFilenames is an array of paths to the input IstioOperator CR files, when comparing with the cluster.
+	inFilenames []string
+	// set is a string with element format "path=value" where path is an IstioOperator path and the value is a
+	// value to set the node at that path to.
+	set []string
+	// manifestsPath is a path to a charts and profiles directory in the local filesystem, or URL with a release tgz.
+	manifestsPath string
+	// force proceeds even if there are validation errors
+	force bool
+	// kubeConfigPath is the path to kube config file.
+	kubeConfigPath string
+	// context is the cluster context in the kube config.
+	context string
 }
 
 func addManifestDiffFlags(cmd *cobra.Command, diffArgs *manifestDiffArgs) {
@@ -65,14 +97,40 @@ func addManifestDiffFlags(cmd *cobra.Command, diffArgs *manifestDiffArgs) {
 		"Rename resources before comparison.\n"+
 			"The format of each renaming pair is A->B, all renaming pairs are comma separated.\n"+
 			"e.g. Service:*:istiod->Service:*:istio-control - rename istiod service into istio-control")
+	cmd.PersistentFlags().BoolVar(&diffArgs.cluster, "cluster", false,
+		"Compare the manifest rendered for the IstioOperator with the objects installed in the cluster.")
+	cmd.PersistentFlags().StringSliceVarP(&diffArgs.inFilenames, "filename", "f", nil, filenameFlagHelpStr)
+	cmd.PersistentFlags().StringArrayVarP(&diffArgs.set, "set", "s", nil, setFlagHelpStr)
+	cmd.PersistentFlags().StringVarP(&diffArgs.manifestsPath, "manifests", "d", "", ManifestsFlagHelpStr)
+	cmd.PersistentFlags().BoolVar(&diffArgs.force, "force", false, ForceFlagHelpStr)
+	cmd.PersistentFlags().StringVarP(&diffArgs.kubeConfigPath, "kubeconfig", "c", "", KubeConfigFlagHelpStr)
+	cmd.PersistentFlags().StringVar(&diffArgs.context, "context", "", ContextFlagHelpStr)
 }
 
 func manifestDiffCmd(rootArgs *rootArgs, diffArgs *manifestDiffArgs) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "diff <file|dir> <file|dir>",
 		Short: "Compare manifests and generate diff",
-		Long:  "The diff subcommand compares manifests from two files or directories.",
+		Long: "The diff subcommand compares manifests from two files or directories.\n\n" +
+			"With --cluster, it compares the manifest rendered for an IstioOperator (A) with the objects installed " +
+			"in the cluster for its revision (B), to detect the objects edited since they were installed. The fields " +
+			"no one manages, such as the fields defaulted by the API server, and the fields managed by the " +
+			"Kubernetes controllers are ignored. The fields added by hand are reported.",
+		Example: `  # Compare two manifest files
+  istioctl manifest diff manifest1.yaml manifest2.yaml
+
+  # Compare the manifest rendered for an IstioOperator with the cluster
+  istioctl manifest diff --cluster -f iop.yaml
+
+  # Compare the istiod deployment with the cluster
+  istioctl manifest diff --cluster -f iop.yaml --select Deployment:istio-system:istiod`,
 		Args: func(cmd *cobra.Command, args []string) error {
+			if diffArgs.cluster {
+				if len(args) != 0 {
+					return fmt.Errorf("diff --cluster accepts no positional arguments, got %#v", args)
+				}
+				return nil
+			}
 			if len(args) != 2 {
 				return fmt.Errorf("diff requires two files or directories")
 			}
@@ -81,6 +139,17 @@ func manifestDiffCmd(rootArgs *rootArgs, diffArgs *manifestDiffArgs) *cobra.Comm
 		RunE: func(cmd *cobra.Command, args []string) error {
 			var err error
 			var equal bool
+			if diffArgs.cluster {
+				l := clog.NewConsoleLogger(cmd.OutOrStdout(), cmd.ErrOrStderr(), installerScope)
+				equal, err = compareManifestWithCluster(rootArgs, diffArgs, l)
+				if err != nil {
+					return err
+				}
+				if !equal {
+					os.Exit(1)
+				}
+				return nil
+			}
 			if diffArgs.compareDir {
 				equal, err = compareManifestsFromDirs(rootArgs, diffArgs.verbose, args[0], args[1],
 					diffArgs.renameResources, diffArgs.selectResources, diffArgs.ignoreResources)
@@ -166,3 +235,272 @@ func compareManifestsFromDirs(rootArgs *rootArgs, verbose bool, dirName1, dirNam
 	fmt.Println("Manifests are identical")
 	return true, nil
 }
+
+// compareManifestWithCluster compares the manifest rendered for an IstioOperator with the live objects installed by it
+func compareManifestWithCluster(rootArgs *rootArgs, diffArgs *manifestDiffArgs, l clog.Logger) (bool, error) {
+	initLogsOrExit(rootArgs)
+
+	restConfig, _, cl, err := K8sConfig(diffArgs.kubeConfigPath, diffArgs.context)
+	if err != nil {
+		return false, err
+	}
+	manifests, iop, err := manifest.GenManifests(diffArgs.inFilenames,
+		applyFlagAliases(diffArgs.set, diffArgs.manifestsPath, ""), diffArgs.force, restConfig, l)
+	if err != nil {
+		return false, err
+	}
+	ordered, err := orderedManifests(manifests)
+	if err != nil {
+		return false, fmt.Errorf("failed to order manifests: %v", err)
+	}
+	rendered, err := object.ParseK8sObjectsFromYAMLManifest(strings.Join(ordered, helm.YAMLSeparator))
+	if err != nil {
+		return false, err
+	}
+	live, err := liveObjectsForDiff(cl, revisionLabelValue(iop.Spec.Revision), rendered)
+	if err != nil {
+		return false, err
+	}
+	renderedManifest, err := rendered.YAMLManifest()
+	if err != nil {
+		return false, err
+	}
+	liveManifest, err := live.YAMLManifest()
+	if err != nil {
+		return false, err
+	}
+
+	diff, err := compare.ManifestDiffWithRenameSelectIgnore(renderedManifest, liveManifest, diffArgs.renameResources,
+		diffArgs.selectResources, diffArgs.ignoreResources, diffArgs.verbose)
+	if err != nil {
+		return false, err
+	}
+	if diff != "" {
+		fmt.Printf("Differences between the rendered manifest (A) and the cluster (B) are:\n%s\n", diff)
+		return false, nil
+	}
+
+	fmt.Println("The cluster matches the rendered manifest")
+	return true, nil
+}
+
+// liveObjectsForDiff returns the live objects installed for the revision, identified by the labels set by the
+// operator, prepared for the comparison with the rendered objects.
+func liveObjectsForDiff(cl client.Client, revision string, rendered object.K8sObjects) (object.K8sObjects, error) {
+	componentRequirement, err := klabels.NewRequirement(helmreconciler.IstioComponentLabelStr, selection.Exists, nil)
+	if err != nil {
+		return nil, err
+	}
+	selector := klabels.Set{label.IoIstioRev.Name: revision}.AsSelectorPreValidated().Add(*componentRequirement)
+
+	// List the types of the rendered objects first, so that the live objects listed under several API versions are
+	// compared in the version of the rendered object.
+	var gvks []schema.GroupVersionKind
+	for _, o := range rendered {
+		gvks = append(gvks, o.GroupVersionKind())
+	}
+	gvks = append(gvks, helmreconciler.NamespacedResources...)
+	gvks = append(gvks, helmreconciler.AllClusterResources...)
+
+	renderedLabels := map[string]map[string]string{}
+	for _, o := range rendered {
+		renderedLabels[o.Hash()] = o.UnstructuredObject().GetLabels()
+	}
+
+	var out object.K8sObjects
+	listed := map[schema.GroupVersionKind]bool{}
+	seen := map[string]bool{}
+	for _, gvk := range gvks {
+		if listed[gvk] {
+			continue
+		}
+		listed[gvk] = true
+		objects := &unstructured.UnstructuredList{}
+		objects.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := cl.List(context.TODO(), objects, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			if meta.IsNoMatchError(err) {
+				// The type is not served by the cluster.
+				continue
+			}
+			return nil, fmt.Errorf("failed to list the %s objects: %v", gvk.Kind, err)
+		}
+		for i := range objects.Items {
+			obj := object.NewK8sObject(&objects.Items[i], nil, nil)
+			if seen[obj.Hash()] {
+				continue
+			}
+			seen[obj.Hash()] = true
+			cleaned, err := cleanLiveObject(&objects.Items[i], renderedLabels[obj.Hash()])
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, object.NewK8sObject(cleaned, nil, nil))
+		}
+	}
+	out.Sort(object.DefaultObjectOrder())
+	return out, nil
+}
+
+// liveOnlyAnnotations are the annotations set on the live objects by Kubernetes or by the installation.
+var liveOnlyAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"deployment.kubernetes.io/revision",
+}
+
+// controllerManagers are the field managers of the Kubernetes controllers. The fields they set, like the token
+// secrets of a service account or the replicas scaled by an autoscaler, are not drift.
+var controllerManagers = map[string]bool{
+	"kube-controller-manager": true,
+}
+
+// injectedLabels are the labels outside of the operator namespaces that the reconciler adds to every object it
+// applies.
+var injectedLabels = []string{label.IoIstioRev.Name}
+
+// cleanLiveObject returns a copy of the live object without the fields set by the API server and the operator
+// labels. The labels injected by the reconciler are removed too when the rendered object, whose labels are
+// renderedLabels, does not have them. The fields that no one manages, which were set to their default value by the
+// API server, are removed too, while the fields managed by the operator or edited by hand are kept.
+func cleanLiveObject(obj *unstructured.Unstructured,
+	renderedLabels map[string]string) (*unstructured.Unstructured, error) {
+	fields, err := managedFields(obj)
+	if err != nil {
+		return nil, err
+	}
+	obj = cleanSnapshotObject(obj)
+	if fields != nil {
+		owned := &unstructured.Unstructured{Object: ownedFields(obj.Object, fields).(map[string]interface{})}
+		owned.SetAPIVersion(obj.GetAPIVersion())
+		owned.SetKind(obj.GetKind())
+		owned.SetName(obj.GetName())
+		owned.SetNamespace(obj.GetNamespace())
+		obj = owned
+	}
+	labels := obj.GetLabels()
+	for k := range labels {
+		if strings.HasPrefix(k, name.OperatorAPINamespace+"/") || strings.HasPrefix(k, helmreconciler.MetadataNamespace+"/") {
+			delete(labels, k)
+		}
+	}
+	for _, k := range injectedLabels {
+		if _, ok := renderedLabels[k]; !ok {
+			delete(labels, k)
+		}
+	}
+	annotations := obj.GetAnnotations()
+	for _, k := range liveOnlyAnnotations {
+		delete(annotations, k)
+	}
+	if len(labels) == 0 {
+		labels = nil
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetLabels(labels)
+	obj.SetAnnotations(annotations)
+	return obj, nil
+}
+
+// managedFields returns the union of the fields of the object managed by the operator and by the users, in the
+// FieldsV1 format, or nil if the object does not track its managed fields.
+func managedFields(obj *unstructured.Unstructured) (map[string]interface{}, error) {
+	entries := obj.GetManagedFields()
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	out := map[string]interface{}{}
+	for _, e := range entries {
+		if controllerManagers[e.Manager] || e.FieldsV1 == nil {
+			continue
+		}
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(e.FieldsV1.Raw, &fields); err != nil {
+			return nil, fmt.Errorf("invalid managed fields of %s %s/%s: %v", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+		}
+		mergeFields(out, fields)
+	}
+	return out, nil
+}
+
+// mergeFields adds the fields of src to dst. A field without children is managed as a whole.
+func mergeFields(dst, src map[string]interface{}) {
+	for k, v := range src {
+		sv, _ := v.(map[string]interface{})
+		if sv == nil {
+			sv = map[string]interface{}{}
+		}
+		dv, ok := dst[k].(map[string]interface{})
+		switch {
+		case !ok || len(sv) == 0:
+			dst[k] = sv
+		case len(dv) != 0:
+			mergeFields(dv, sv)
+		}
+	}
+}
+
+// ownedFields returns the parts of the value that are in the managed fields.
+func ownedFields(value interface{}, fields map[string]interface{}) interface{} {
+	if len(fields) == 0 || (len(fields) == 1 && fields["."] != nil) {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, item := range v {
+			if f, ok := fields["f:"+k].(map[string]interface{}); ok {
+				out[k] = ownedFields(item, f)
+			}
+		}
+		return out
+	case []interface{}:
+		out := []interface{}{}
+		for i, item := range v {
+			if f := listItemFields(fields, i, item); f != nil {
+				out = append(out, ownedFields(item, f))
+			}
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// listItemFields returns the managed fields of an item of a list, identified by its keys, its value or its index,
+// or nil if the item is not managed.
+func listItemFields(fields map[string]interface{}, index int, item interface{}) map[string]interface{} {
+	for k, f := range fields {
+		child, _ := f.(map[string]interface{})
+		switch {
+		case strings.HasPrefix(k, "k:"):
+			keys := map[string]interface{}{}
+			m, ok := item.(map[string]interface{})
+			if !ok || json.Unmarshal([]byte(strings.TrimPrefix(k, "k:")), &keys) != nil {
+				continue
+			}
+			matches := true
+			for key, want := range keys {
+				matches = matches && jsonEqual(m[key], want)
+			}
+			if matches {
+				return child
+			}
+		case strings.HasPrefix(k, "v:"):
+			var want interface{}
+			if json.Unmarshal([]byte(strings.TrimPrefix(k, "v:")), &want) == nil && jsonEqual(item, want) {
+				return child
+			}
+		case k == "i:"+strconv.Itoa(index):
+			return child
+		}
+	}
+	return nil
+}
+
+// jsonEqual returns true if the values have the same JSON encoding, whatever the types of their numbers.
+func jsonEqual(a, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
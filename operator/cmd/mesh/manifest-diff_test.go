@@ -0,0 +1,345 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mesh
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"istio.io/istio/operator/pkg/compare"
+	"istio.io/istio/operator/pkg/object"
+)
+
+func TestOwnedFields(t *testing.T) {
+	cases := []struct {
+		name   string
+		value  interface{}
+		fields string
+		want   interface{}
+	}{
+		{
+			name:   "defaulted fields",
+			value:  map[string]interface{}{"replicas": 1, "revisionHistoryLimit": 10},
+			fields: `{"f:replicas": {}}`,
+			want:   map[string]interface{}{"replicas": 1},
+		},
+		{
+			name:   "managed as a whole",
+			value:  map[string]interface{}{"data": map[string]interface{}{"a": "b"}},
+			fields: `{"f:data": {}}`,
+			want:   map[string]interface{}{"data": map[string]interface{}{"a": "b"}},
+		},
+		{
+			name: "list items by key",
+			value: []interface{}{
+				map[string]interface{}{"name": "a", "image": "x", "imagePullPolicy": "IfNotPresent"},
+				map[string]interface{}{"name": "b", "image": "y"},
+			},
+			fields: `{"k:{\"name\":\"a\"}": {".": {}, "f:name": {}, "f:image": {}}}`,
+			want:   []interface{}{map[string]interface{}{"name": "a", "image": "x"}},
+		},
+		{
+			name:   "list items by key with numbers",
+			value:  []interface{}{map[string]interface{}{"containerPort": int64(8080), "protocol": "TCP"}},
+			fields: `{"k:{\"containerPort\":8080,\"protocol\":\"TCP\"}": {".": {}}}`,
+			want:   []interface{}{map[string]interface{}{"containerPort": int64(8080), "protocol": "TCP"}},
+		},
+		{
+			name:   "list items by value and index",
+			value:  map[string]interface{}{"finalizers": []interface{}{"a", "b"}, "args": []interface{}{"c", "d"}},
+			fields: `{"f:finalizers": {"v:\"a\"": {}}, "f:args": {"i:1": {}}}`,
+			want:   map[string]interface{}{"finalizers": []interface{}{"a"}, "args": []interface{}{"d"}},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(tt.fields), &fields); err != nil {
+				t.Fatal(err)
+			}
+			if got := ownedFields(tt.value, fields); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+const renderedDiffManifest = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: istio-reader-istio-system
+  labels:
+    app: istio-reader
+rules:
+- apiGroups: [""]
+  resources: ["pods"]
+  verbs: ["get", "list", "watch"]
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: istiod-canary
+  namespace: istio-system
+  labels:
+    app: istiod
+    istio.io/rev: canary
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: istio-canary
+  namespace: istio-system
+  labels:
+    istio.io/rev: canary
+data:
+  mesh: "enableTracing: false"
+`
+
+const liveDiffManifest = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: istio-reader-istio-system
+  labels:
+    app: istio-reader
+    istio.io/rev: canary
+    operator.istio.io/component: Base
+  managedFields:
+  - manager: istio-operator
+    operation: Apply
+    apiVersion: rbac.authorization.k8s.io/v1
+    fieldsType: FieldsV1
+    fieldsV1:
+      f:metadata:
+        f:labels:
+          f:app: {}
+          f:istio.io/rev: {}
+          f:operator.istio.io/component: {}
+      f:rules: {}
+rules:
+- apiGroups: [""]
+  resources: ["pods"]
+  verbs: ["get", "list", "watch"]
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: istiod-canary
+  namespace: istio-system
+  resourceVersion: "10"
+  uid: 0c9b4c3f
+  labels:
+    app: istiod
+    istio.io/rev: canary
+    install.operator.istio.io/owning-resource: installed-state-canary
+    operator.istio.io/component: Pilot
+    operator.istio.io/managed: Reconcile
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: "{}"
+  managedFields:
+  - manager: istio-operator
+    operation: Apply
+    apiVersion: v1
+    fieldsType: FieldsV1
+    fieldsV1:
+      f:metadata:
+        f:labels:
+          f:app: {}
+          f:istio.io/rev: {}
+          f:install.operator.istio.io/owning-resource: {}
+          f:operator.istio.io/component: {}
+          f:operator.istio.io/managed: {}
+  - manager: kube-controller-manager
+    operation: Update
+    apiVersion: v1
+    fieldsType: FieldsV1
+    fieldsV1:
+      f:secrets:
+        .: {}
+        k:{"name":"istiod-canary-token-x8k2f"}:
+          .: {}
+          f:name: {}
+secrets:
+- name: istiod-canary-token-x8k2f
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: istio-canary
+  namespace: istio-system
+  labels:
+    istio.io/rev: canary
+    operator.istio.io/component: Pilot
+  annotations:
+    edited-by: admin
+  managedFields:
+  - manager: istio-operator
+    operation: Apply
+    apiVersion: v1
+    fieldsType: FieldsV1
+    fieldsV1:
+      f:data:
+        f:mesh: {}
+      f:metadata:
+        f:labels:
+          f:istio.io/rev: {}
+          f:operator.istio.io/component: {}
+  - manager: kubectl-edit
+    operation: Update
+    apiVersion: v1
+    fieldsType: FieldsV1
+    fieldsV1:
+      f:data:
+        f:extra-key: {}
+      f:metadata:
+        f:annotations:
+          .: {}
+          f:edited-by: {}
+data:
+  mesh: "enableTracing: true"
+  extra-key: added
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: extra
+  namespace: istio-system
+  labels:
+    istio.io/rev: canary
+    operator.istio.io/component: Pilot
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other-revision
+  namespace: istio-system
+  labels:
+    istio.io/rev: stable
+    operator.istio.io/component: Pilot
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: not-installed
+  namespace: istio-system
+  labels:
+    istio.io/rev: canary
+`
+
+// clusterClient fails to list the types unknown to the scheme like a cluster that does not serve them, and the types
+// of forbidden like a cluster denying access to them.
+type clusterClient struct {
+	client.Client
+	forbidden string
+}
+
+func (c clusterClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	gvk := list.GetObjectKind().GroupVersionKind()
+	if gvk.Kind == c.forbidden+"List" {
+		return kerrors.NewForbidden(schema.GroupResource{Resource: strings.ToLower(c.forbidden) + "s"}, "", nil)
+	}
+	err := c.Client.List(ctx, list, opts...)
+	if runtime.IsNotRegisteredError(err) {
+		return &meta.NoKindMatchError{GroupKind: gvk.GroupKind(), SearchedVersions: []string{gvk.Version}}
+	}
+	return err
+}
+
+func TestLiveObjectsForDiff(t *testing.T) {
+	liveObjects, err := object.ParseK8sObjectsFromYAMLManifest(liveDiffManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := fake.NewClientBuilder()
+	for _, o := range liveObjects {
+		// The fake client only lists the objects of the known types when they are added as typed objects.
+		typed, err := scheme.Scheme.New(o.GroupVersionKind())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(o.UnstructuredObject().Object, typed); err != nil {
+			t.Fatal(err)
+		}
+		builder = builder.WithRuntimeObjects(typed)
+	}
+	rendered, err := object.ParseK8sObjectsFromYAMLManifest(renderedDiffManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := liveObjectsForDiff(clusterClient{Client: builder.Build(), forbidden: "ConfigMap"}, "canary", rendered); err == nil {
+		t.Fatal("expected an error when the objects of a type cannot be listed")
+	}
+	live, err := liveObjectsForDiff(clusterClient{Client: builder.Build()}, "canary", rendered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, o := range live {
+		got = append(got, o.Hash())
+	}
+	want := []string{"ServiceAccount:istio-system:istiod-canary", "ClusterRole::istio-reader-istio-system",
+		"ConfigMap:istio-system:extra", "ConfigMap:istio-system:istio-canary"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got live objects %v, want %v", got, want)
+	}
+
+	renderedManifest, err := rendered.YAMLManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	liveManifest, err := live.YAMLManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := compare.ManifestDiffWithRenameSelectIgnore(renderedManifest, liveManifest, "", "::", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"ConfigMap:istio-system:extra is missing in A", "enableTracing: false -> true", "edited-by",
+		"extra-key"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("diff does not contain %q:\n%s", want, diff)
+		}
+	}
+	for _, unwanted := range []string{"ServiceAccount", "ClusterRole", "operator.istio.io", "resourceVersion", "last-applied-configuration",
+		"managedFields"} {
+		if strings.Contains(diff, unwanted) {
+			t.Errorf("diff contains %q:\n%s", unwanted, diff)
+		}
+	}
+
+	// Drift outside of the selected resources is not reported.
+	diff, err = compare.ManifestDiffWithRenameSelectIgnore(renderedManifest, liveManifest, "",
+		"ServiceAccount:*:*", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != "" {
+		t.Errorf("unexpected diff of the selected resources:\n%s", diff)
+	}
+}
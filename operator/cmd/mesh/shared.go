@@ -25,6 +25,7 @@ import (
 	"time"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -251,3 +252,14 @@ func saveIOPToCluster(reconciler *helmreconciler.HelmReconciler, iop string) err
 	}
 	return reconciler.ApplyObject(obj.UnstructuredObject(), false)
 }
+
+// cleanSnapshotObject returns a copy of the live object without its status and server populated metadata, so that
+// it can be reapplied.
+func cleanSnapshotObject(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	obj = obj.DeepCopy()
+	unstructured.RemoveNestedField(obj.Object, "status")
+	for _, field := range []string{"resourceVersion", "uid", "creationTimestamp", "generation", "managedFields", "selfLink"} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	return obj
+}
@@ -0,0 +1,426 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mesh
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"istio.io/api/label"
+	iopv1alpha1 "istio.io/istio/operator/pkg/apis/istio/v1alpha1"
+	"istio.io/istio/operator/pkg/helmreconciler"
+	"istio.io/istio/operator/pkg/object"
+	"istio.io/istio/operator/pkg/util"
+	"istio.io/istio/operator/pkg/util/clog"
+	"istio.io/istio/pilot/pkg/xds/debugapi"
+	"istio.io/istio/pkg/kube"
+)
+
+const (
+	// upgradeSnapshotPrefix is the prefix of the Secrets holding the control plane objects saved before an upgrade.
+	// They are Secrets, as the saved objects include the Secrets of the control plane.
+	upgradeSnapshotPrefix = "istio-upgrade-snapshot"
+	// upgradeSnapshotKey is the Secret key of the gzipped manifest of the saved objects.
+	upgradeSnapshotKey = "manifest.yaml.gz"
+	// upgradeSnapshotMaxSize is the maximum size of the gzipped manifest. Kubernetes objects are limited to 1MiB,
+	// some room is left for the metadata of the Secret.
+	upgradeSnapshotMaxSize = 1024*1024 - 16*1024
+
+	// The duration between two checks of the upgrade health gate.
+	upgradeHealthGateInterval = 10 * time.Second
+	// The number of consecutive successful checks needed to pass the upgrade health gate. This gives the
+	// proxies time to connect to the upgraded control plane and to accept or reject its configuration.
+	upgradeHealthGatePasses = 3
+)
+
+// upgradeSnapshotName returns the name of the Secret holding the snapshot of the revision.
+func upgradeSnapshotName(revision string) string {
+	if revision == "" {
+		return upgradeSnapshotPrefix
+	}
+	return upgradeSnapshotPrefix + "-" + revision
+}
+
+// revisionLabelValue returns the value of the revision label of the control plane objects of the revision.
+func revisionLabelValue(revision string) string {
+	if revision == "" {
+		return "default"
+	}
+	return revision
+}
+
+// snapshotControlPlane returns the manifest of the live objects of the control plane of the IstioOperator, along
+// with its installed state. The CRDs and the other base resources are not included: a rollback does not remove or
+// downgrade them.
+func snapshotControlPlane(reconciler *helmreconciler.HelmReconciler, cl client.Client, iop *iopv1alpha1.IstioOperator) (
+	string, error) {
+	lists, err := reconciler.GetPrunedResources(revisionLabelValue(iop.Spec.Revision), false, "")
+	if err != nil {
+		return "", err
+	}
+	var objs object.K8sObjects
+	seen := map[string]bool{}
+	for _, list := range lists {
+		for i := range list.Items {
+			obj := object.NewK8sObject(cleanSnapshotObject(&list.Items[i]), nil, nil)
+			// The same object can be listed under several API versions.
+			if seen[obj.Hash()] {
+				continue
+			}
+			seen[obj.Hash()] = true
+			objs = append(objs, obj)
+		}
+	}
+	if len(objs) == 0 {
+		return "", fmt.Errorf("no control plane objects found for revision %s", revisionLabelValue(iop.Spec.Revision))
+	}
+
+	installed := &unstructured.Unstructured{}
+	installed.SetGroupVersionKind(iopv1alpha1.IstioOperatorGVK)
+	err = cl.Get(context.TODO(), client.ObjectKey{Namespace: iop.Namespace, Name: savedIOPName(iop)}, installed)
+	switch {
+	case err == nil:
+		objs = append(objs, object.NewK8sObject(cleanSnapshotObject(installed), nil, nil))
+	case !kerrors.IsNotFound(err):
+		return "", fmt.Errorf("failed to read the installed state: %v", err)
+	}
+
+	objs.Sort(object.DefaultObjectOrder())
+	return objs.YAMLManifest()
+}
+
+// saveUpgradeSnapshot stores the snapshot of the revision in a Secret of the namespace, replacing the previous one.
+func saveUpgradeSnapshot(cl client.Client, namespace, revision, manifest string) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(manifest)); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	key := client.ObjectKey{Namespace: namespace, Name: upgradeSnapshotName(revision)}
+	if buf.Len() > upgradeSnapshotMaxSize {
+		return fmt.Errorf("the snapshot of the control plane is %d bytes gzipped, more than the %d bytes that fit in %s/%s",
+			buf.Len(), upgradeSnapshotMaxSize, key.Namespace, key.Name)
+	}
+	secret := &v1.Secret{}
+	err := cl.Get(context.TODO(), key, secret)
+	if kerrors.IsNotFound(err) {
+		secret = &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+			Type:       v1.SecretTypeOpaque,
+			Data:       map[string][]byte{upgradeSnapshotKey: buf.Bytes()},
+		}
+		err = cl.Create(context.TODO(), secret)
+	} else if err == nil {
+		secret.StringData = nil
+		secret.Data = map[string][]byte{upgradeSnapshotKey: buf.Bytes()}
+		err = cl.Update(context.TODO(), secret)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save the snapshot of the control plane in %s/%s: %v", key.Namespace, key.Name, err)
+	}
+	return nil
+}
+
+// loadUpgradeSnapshot returns the snapshot of the revision saved by the last upgrade.
+func loadUpgradeSnapshot(cl client.Client, namespace, revision string) (string, error) {
+	secret := &v1.Secret{}
+	key := client.ObjectKey{Namespace: namespace, Name: upgradeSnapshotName(revision)}
+	if err := cl.Get(context.TODO(), key, secret); err != nil {
+		if kerrors.IsNotFound(err) {
+			return "", fmt.Errorf("no snapshot of the control plane found in %s/%s, "+
+				"the control plane was not upgraded with istioctl upgrade", key.Namespace, key.Name)
+		}
+		return "", err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(secret.Data[upgradeSnapshotKey]))
+	if err != nil {
+		return "", fmt.Errorf("invalid snapshot of the control plane in %s/%s: %v", key.Namespace, key.Name, err)
+	}
+	manifest, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return "", fmt.Errorf("invalid snapshot of the control plane in %s/%s: %v", key.Namespace, key.Name, err)
+	}
+	return string(manifest), nil
+}
+
+// restoreSnapshot reapplies the objects of the snapshot, and removes the control plane objects of the revision
+// that are not part of it.
+func restoreSnapshot(reconciler *helmreconciler.HelmReconciler, revision, manifest string, l clog.Logger) error {
+	objs, err := object.ParseK8sObjectsFromYAMLManifest(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to parse the snapshot of the control plane: %v", err)
+	}
+	serverSideApply := reconciler.CheckSSAEnabled()
+	var errs util.Errors
+	inSnapshot := map[string]bool{}
+	for _, obj := range objs {
+		inSnapshot[obj.Hash()] = true
+		if err := reconciler.ApplyObject(obj.UnstructuredObject(), serverSideApply); err != nil {
+			errs = util.AppendErr(errs, err)
+		}
+	}
+	if err := errs.ToError(); err != nil {
+		return fmt.Errorf("failed to reapply the snapshot of the control plane: %v", err)
+	}
+	l.LogAndPrintf("Reapplied %d objects of the control plane.", len(objs))
+
+	lists, err := reconciler.GetPrunedResources(revisionLabelValue(revision), false, "")
+	if err != nil {
+		return err
+	}
+	var added []*unstructured.UnstructuredList
+	for _, list := range lists {
+		extra := &unstructured.UnstructuredList{}
+		for _, o := range list.Items {
+			if !inSnapshot[object.NewK8sObject(&o, nil, nil).Hash()] {
+				extra.Items = append(extra.Items, o)
+			}
+		}
+		if len(extra.Items) != 0 {
+			added = append(added, extra)
+		}
+	}
+	if err := reconciler.DeleteObjectsList(added); err != nil {
+		return fmt.Errorf("failed to remove the objects added by the upgrade: %v", err)
+	}
+	return nil
+}
+
+// upgradeHealthGate checks the health of a control plane revision: its istiod deployments must be ready, its
+// injection webhooks must have ready endpoints, and at most maxNackRatio of the connected proxies may reject their
+// configuration.
+type upgradeHealthGate struct {
+	client    kubernetes.Interface
+	namespace string
+	revision  string
+	// maxNackRatio is the maximum fraction of the proxies rejecting their configuration.
+	maxNackRatio float64
+	// syncStatus returns the syncz output of each istiod instance of the revision.
+	syncStatus func(ctx context.Context) (map[string][]byte, error)
+
+	interval time.Duration
+}
+
+func newUpgradeHealthGate(kubeClient kube.ExtendedClient, namespace, revision string, maxNackRatio float64) *upgradeHealthGate {
+	return &upgradeHealthGate{
+		client:       kubeClient.Kube(),
+		namespace:    namespace,
+		revision:     revision,
+		maxNackRatio: maxNackRatio,
+		syncStatus: func(ctx context.Context) (map[string][]byte, error) {
+			return kubeClient.AllDiscoveryDo(ctx, namespace, "/debug/syncz")
+		},
+		interval: upgradeHealthGateInterval,
+	}
+}
+
+// check returns the reason the control plane is unhealthy, or nil.
+func (g *upgradeHealthGate) check(ctx context.Context) error {
+	if err := g.istiodReady(ctx); err != nil {
+		return err
+	}
+	if err := g.webhooksReachable(ctx); err != nil {
+		return err
+	}
+	return g.proxiesAccepting(ctx)
+}
+
+// wait waits for the checks to pass upgradeHealthGatePasses times in a row, for at most timeout.
+func (g *upgradeHealthGate) wait(ctx context.Context, timeout time.Duration, l clog.Logger) error {
+	deadline := time.Now().Add(timeout)
+	passes := 0
+	for {
+		err := g.check(ctx)
+		if err == nil {
+			passes++
+			if passes >= upgradeHealthGatePasses {
+				return nil
+			}
+		} else {
+			passes = 0
+			l.LogAndPrintf("Health gate: %v", err)
+		}
+		if time.Now().Add(g.interval).After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("the checks did not pass %d times in a row", upgradeHealthGatePasses)
+			}
+			return fmt.Errorf("the control plane is not healthy after %v: %v", timeout, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(g.interval):
+		}
+	}
+}
+
+func (g *upgradeHealthGate) istiodReady(ctx context.Context) error {
+	selector := fmt.Sprintf("app=istiod,%s=%s", label.IoIstioRev.Name, revisionLabelValue(g.revision))
+	deployments, err := g.client.AppsV1().Deployments(g.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list the istiod deployments: %v", err)
+	}
+	if len(deployments.Items) == 0 {
+		return fmt.Errorf("no istiod deployment found in namespace %s for revision %s",
+			g.namespace, revisionLabelValue(g.revision))
+	}
+	for _, d := range deployments.Items {
+		replicas := int32(1)
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+		if d.Status.ObservedGeneration < d.Generation || d.Status.UpdatedReplicas < replicas ||
+			d.Status.AvailableReplicas < replicas {
+			return fmt.Errorf("istiod deployment %s is not ready: %d updated and %d available of %d replicas",
+				d.Name, d.Status.UpdatedReplicas, d.Status.AvailableReplicas, replicas)
+		}
+	}
+	return nil
+}
+
+func (g *upgradeHealthGate) webhooksReachable(ctx context.Context) error {
+	selector := fmt.Sprintf("%s=%s", label.IoIstioRev.Name, revisionLabelValue(g.revision))
+	configs, err := g.client.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx,
+		metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list the injection webhooks: %v", err)
+	}
+	for _, config := range configs.Items {
+		for _, wh := range config.Webhooks {
+			svc := wh.ClientConfig.Service
+			if svc == nil {
+				continue
+			}
+			endpoints, err := g.client.CoreV1().Endpoints(svc.Namespace).Get(ctx, svc.Name, metav1.GetOptions{})
+			if err != nil {
+				return fmt.Errorf("webhook %s of %s is not reachable: %v", wh.Name, config.Name, err)
+			}
+			if !hasReadyAddress(endpoints) {
+				return fmt.Errorf("webhook %s of %s is not reachable: service %s/%s has no ready endpoint",
+					wh.Name, config.Name, svc.Namespace, svc.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func hasReadyAddress(endpoints *v1.Endpoints) bool {
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Addresses) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *upgradeHealthGate) proxiesAccepting(ctx context.Context) error {
+	statuses, err := g.syncStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the sync status of the proxies: %v", err)
+	}
+	nacking, total, err := countNackingProxies(statuses)
+	if err != nil {
+		return err
+	}
+	if total != 0 && float64(nacking)/float64(total) > g.maxNackRatio {
+		return fmt.Errorf("%d of %d proxies reject their configuration", nacking, total)
+	}
+	return nil
+}
+
+// countNackingProxies returns the number of proxies that rejected the last configuration sent to them, and the
+// number of proxies, from the syncz output of each istiod instance.
+func countNackingProxies(statuses map[string][]byte) (int, int, error) {
+	nacking := map[string]bool{}
+	for istiod, status := range statuses {
+		var ss []debugapi.SyncStatus
+		if err := json.Unmarshal(status, &ss); err != nil {
+			return 0, 0, fmt.Errorf("failed to parse the sync status of %s: %v", istiod, err)
+		}
+		for _, s := range ss {
+			nacking[s.ProxyID] = nacking[s.ProxyID] || s.ClusterNacked != "" || s.ListenerNacked != "" ||
+				s.RouteNacked != "" || s.EndpointNacked != ""
+		}
+	}
+	count := 0
+	for _, n := range nacking {
+		if n {
+			count++
+		}
+	}
+	return count, len(nacking), nil
+}
+
+// newSnapshotReconciler returns a reconciler to take and restore the snapshots of the control plane of the iop.
+func newSnapshotReconciler(cl client.Client, restConfig *rest.Config, iop *iopv1alpha1.IstioOperator, dryRun bool,
+	l clog.Logger) (*helmreconciler.HelmReconciler, error) {
+	return helmreconciler.NewHelmReconciler(cl, restConfig, iop, &helmreconciler.Options{DryRun: dryRun, Log: l})
+}
+
+// saveControlPlaneSnapshot saves the objects of the control plane of the iop before its upgrade, and returns them.
+func saveControlPlaneSnapshot(cl client.Client, restConfig *rest.Config, iop *iopv1alpha1.IstioOperator,
+	l clog.Logger) (string, error) {
+	reconciler, err := newSnapshotReconciler(cl, restConfig, iop, false, l)
+	if err != nil {
+		return "", err
+	}
+	snapshot, err := snapshotControlPlane(reconciler, cl, iop)
+	if err != nil {
+		return "", fmt.Errorf("failed to take a snapshot of the control plane: %v", err)
+	}
+	if err := saveUpgradeSnapshot(cl, iop.Namespace, iop.Spec.Revision, snapshot); err != nil {
+		return "", err
+	}
+	l.LogAndPrintf("Saved the control plane objects in %s/%s.\n", iop.Namespace, upgradeSnapshotName(iop.Spec.Revision))
+	return snapshot, nil
+}
+
+// rollbackUpgrade restores the control plane of the iop saved by the last upgrade.
+func rollbackUpgrade(cl client.Client, restConfig *rest.Config, iop *iopv1alpha1.IstioOperator, dryRun,
+	skipConfirmation bool, l clog.Logger) error {
+	snapshot, err := loadUpgradeSnapshot(cl, iop.Namespace, iop.Spec.Revision)
+	if err != nil {
+		return err
+	}
+	l.LogAndPrintf("Rolling back the control plane of revision %s to the installation saved before the last upgrade.",
+		revisionLabelValue(iop.Spec.Revision))
+	waitForConfirmation(skipConfirmation || dryRun, l)
+	reconciler, err := newSnapshotReconciler(cl, restConfig, iop, dryRun, l)
+	if err != nil {
+		return err
+	}
+	if err := restoreSnapshot(reconciler, iop.Spec.Revision, snapshot, l); err != nil {
+		return err
+	}
+	l.LogAndPrintf("Rollback completed.")
+	return nil
+}
@@ -0,0 +1,295 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mesh
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"istio.io/istio/operator/pkg/util/clog"
+	"istio.io/istio/pilot/pkg/xds/debugapi"
+)
+
+func TestUpgradeSnapshot(t *testing.T) {
+	cl := fake.NewClientBuilder().Build()
+	if _, err := loadUpgradeSnapshot(cl, "istio-system", "canary"); err == nil {
+		t.Fatal("expected an error loading a missing snapshot")
+	}
+	for _, manifest := range []string{"kind: Deployment\n", "kind: Service\n"} {
+		if err := saveUpgradeSnapshot(cl, "istio-system", "canary", manifest); err != nil {
+			t.Fatal(err)
+		}
+		got, err := loadUpgradeSnapshot(cl, "istio-system", "canary")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != manifest {
+			t.Errorf("got snapshot %q, want %q", got, manifest)
+		}
+	}
+	if _, err := loadUpgradeSnapshot(cl, "istio-system", ""); err == nil {
+		t.Fatal("expected an error loading the snapshot of another revision")
+	}
+	// The snapshot holds the Secrets of the control plane, it is only readable with access to Secrets.
+	if err := cl.Get(context.TODO(), client.ObjectKey{Namespace: "istio-system", Name: "istio-upgrade-snapshot-canary"},
+		&v1.Secret{}); err != nil {
+		t.Errorf("expected the snapshot to be saved in a Secret: %v", err)
+	}
+
+	// A snapshot too large for a Secret is not saved.
+	large := make([]byte, upgradeSnapshotMaxSize)
+	if _, err := rand.Read(large); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveUpgradeSnapshot(cl, "istio-system", "canary", base64.StdEncoding.EncodeToString(large)); err == nil {
+		t.Error("expected an error saving a snapshot over the size limit")
+	}
+	if got, err := loadUpgradeSnapshot(cl, "istio-system", "canary"); err != nil || got != "kind: Service\n" {
+		t.Errorf("got snapshot %q, %v, want the previous snapshot", got, err)
+	}
+}
+
+func TestCleanSnapshotObject(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":            "istiod",
+			"namespace":       "istio-system",
+			"resourceVersion": "12",
+			"uid":             "abc",
+			"generation":      int64(3),
+			"labels":          map[string]interface{}{"app": "istiod"},
+		},
+		"spec":   map[string]interface{}{"replicas": int64(2)},
+		"status": map[string]interface{}{"readyReplicas": int64(2)},
+	}}
+	got := cleanSnapshotObject(obj)
+	want := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      "istiod",
+			"namespace": "istio-system",
+			"labels":    map[string]interface{}{"app": "istiod"},
+		},
+		"spec": map[string]interface{}{"replicas": int64(2)},
+	}
+	gotJSON, _ := json.Marshal(got.Object)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("got %s, want %s", gotJSON, wantJSON)
+	}
+	if obj.GetResourceVersion() != "12" {
+		t.Errorf("the live object was modified")
+	}
+}
+
+func syncz(t *testing.T, statuses ...debugapi.SyncStatus) []byte {
+	t.Helper()
+	out, err := json.Marshal(statuses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestCountNackingProxies(t *testing.T) {
+	nacking, total, err := countNackingProxies(map[string][]byte{
+		"istiod-1": syncz(t,
+			debugapi.SyncStatus{ProxyID: "a.ns", ClusterSent: "1", ClusterAcked: "1"},
+			debugapi.SyncStatus{ProxyID: "b.ns", ListenerSent: "2", ListenerAcked: "1", ListenerNacked: "2"}),
+		"istiod-2": syncz(t,
+			debugapi.SyncStatus{ProxyID: "c.ns", EndpointNacked: "5"},
+			debugapi.SyncStatus{ProxyID: "d.ns"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nacking != 2 || total != 4 {
+		t.Errorf("got %d of %d proxies nacking, want 2 of 4", nacking, total)
+	}
+	if _, _, err := countNackingProxies(map[string][]byte{"istiod-1": []byte("not json")}); err == nil {
+		t.Error("expected an error for an invalid sync status")
+	}
+}
+
+func istiodDeployment(revision string, ready int32) *appsv1.Deployment {
+	replicas := int32(2)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "istiod-" + revision,
+			Namespace: "istio-system",
+			Labels:    map[string]string{"app": "istiod", "istio.io/rev": revision},
+		},
+		Spec:   appsv1.DeploymentSpec{Replicas: &replicas},
+		Status: appsv1.DeploymentStatus{UpdatedReplicas: ready, AvailableReplicas: ready},
+	}
+}
+
+func injectorWebhook(revision string) *admissionv1.MutatingWebhookConfiguration {
+	return &admissionv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "istio-sidecar-injector-" + revision,
+			Labels: map[string]string{"istio.io/rev": revision},
+		},
+		Webhooks: []admissionv1.MutatingWebhook{{
+			Name: "sidecar-injector.istio.io",
+			ClientConfig: admissionv1.WebhookClientConfig{
+				Service: &admissionv1.ServiceReference{Namespace: "istio-system", Name: "istiod-" + revision},
+			},
+		}},
+	}
+}
+
+func istiodEndpoints(revision string, addresses ...string) *v1.Endpoints {
+	subset := v1.EndpointSubset{}
+	for _, a := range addresses {
+		subset.Addresses = append(subset.Addresses, v1.EndpointAddress{IP: a})
+	}
+	return &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "istiod-" + revision, Namespace: "istio-system"},
+		Subsets:    []v1.EndpointSubset{subset},
+	}
+}
+
+func TestUpgradeHealthGate(t *testing.T) {
+	healthySyncz := map[string][]byte{"istiod-1": syncz(t, debugapi.SyncStatus{ProxyID: "a.ns"})}
+	cases := []struct {
+		name         string
+		objects      []runtime.Object
+		syncz        map[string][]byte
+		maxNackRatio float64
+		wantErr      string
+	}{
+		{
+			name:    "healthy",
+			objects: []runtime.Object{istiodDeployment("canary", 2), injectorWebhook("canary"), istiodEndpoints("canary", "10.0.0.1")},
+			syncz:   healthySyncz,
+		},
+		{
+			name:    "no istiod",
+			objects: []runtime.Object{istiodDeployment("stable", 2)},
+			syncz:   healthySyncz,
+			wantErr: "no istiod deployment found",
+		},
+		{
+			name:    "istiod not ready",
+			objects: []runtime.Object{istiodDeployment("canary", 1)},
+			syncz:   healthySyncz,
+			wantErr: "1 updated and 1 available of 2 replicas",
+		},
+		{
+			name:    "webhook without endpoints",
+			objects: []runtime.Object{istiodDeployment("canary", 2), injectorWebhook("canary"), istiodEndpoints("canary")},
+			syncz:   healthySyncz,
+			wantErr: "has no ready endpoint",
+		},
+		{
+			name:    "webhook service missing",
+			objects: []runtime.Object{istiodDeployment("canary", 2), injectorWebhook("canary")},
+			syncz:   healthySyncz,
+			wantErr: "is not reachable",
+		},
+		{
+			name:    "proxies nacking",
+			objects: []runtime.Object{istiodDeployment("canary", 2), injectorWebhook("canary"), istiodEndpoints("canary", "10.0.0.1")},
+			syncz: map[string][]byte{"istiod-1": syncz(t,
+				debugapi.SyncStatus{ProxyID: "a.ns"},
+				debugapi.SyncStatus{ProxyID: "b.ns", RouteNacked: "3"})},
+			wantErr: "1 of 2 proxies reject their configuration",
+		},
+		{
+			name:    "proxies nacking under the threshold",
+			objects: []runtime.Object{istiodDeployment("canary", 2), injectorWebhook("canary"), istiodEndpoints("canary", "10.0.0.1")},
+			syncz: map[string][]byte{"istiod-1": syncz(t,
+				debugapi.SyncStatus{ProxyID: "a.ns"},
+				debugapi.SyncStatus{ProxyID: "b.ns", RouteNacked: "3"})},
+			maxNackRatio: 0.5,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &upgradeHealthGate{
+				client:       kubefake.NewSimpleClientset(tt.objects...),
+				namespace:    "istio-system",
+				revision:     "canary",
+				maxNackRatio: tt.maxNackRatio,
+				syncStatus: func(ctx context.Context) (map[string][]byte, error) {
+					return tt.syncz, nil
+				},
+			}
+			err := g.check(context.Background())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpgradeHealthGateWait(t *testing.T) {
+	client := kubefake.NewSimpleClientset(istiodDeployment("default", 2))
+	calls := 0
+	g := &upgradeHealthGate{
+		client:    client,
+		namespace: "istio-system",
+		syncStatus: func(ctx context.Context) (map[string][]byte, error) {
+			calls++
+			if calls == 2 {
+				return nil, fmt.Errorf("istiod unreachable")
+			}
+			return map[string][]byte{}, nil
+		},
+		interval: time.Millisecond,
+	}
+	l := clog.NewDefaultLogger()
+	if err := g.wait(context.Background(), time.Minute, l); err != nil {
+		t.Fatal(err)
+	}
+	// The failure resets the count of successful checks.
+	if calls != upgradeHealthGatePasses+2 {
+		t.Errorf("got %d checks, want %d", calls, upgradeHealthGatePasses+2)
+	}
+
+	g.syncStatus = func(ctx context.Context) (map[string][]byte, error) {
+		return nil, fmt.Errorf("istiod unreachable")
+	}
+	err := g.wait(context.Background(), 10*time.Millisecond, l)
+	if err == nil || !strings.Contains(err.Error(), "istiod unreachable") {
+		t.Fatalf("got error %v, want the last check error", err)
+	}
+}
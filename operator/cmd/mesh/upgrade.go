@@ -41,6 +41,7 @@ import (
 	"istio.io/istio/operator/pkg/util"
 	"istio.io/istio/operator/pkg/util/clog"
 	pkgversion "istio.io/istio/operator/pkg/version"
+	"istio.io/istio/pkg/kube"
 	"istio.io/pkg/log"
 )
 
@@ -83,6 +84,16 @@ type upgradeArgs struct {
 	manifestsPath string
 	// verify verifies control plane health
 	verify bool
+	// healthGate checks the health of the control plane after the upgrade.
+	healthGate bool
+	// healthGateTimeout is the maximum time to wait for the control plane to be healthy after the upgrade.
+	healthGateTimeout time.Duration
+	// maxNackRatio is the maximum fraction of the proxies rejecting their configuration for the health gate to pass.
+	maxNackRatio float64
+	// autoRollback restores the previous installation if the upgrade fails or does not pass the health gate.
+	autoRollback bool
+	// rollback restores the installation saved before the last upgrade instead of upgrading.
+	rollback bool
 }
 
 // addUpgradeFlags adds upgrade related flags into cobra command
@@ -103,6 +114,18 @@ func addUpgradeFlags(cmd *cobra.Command, args *upgradeArgs) {
 	cmd.PersistentFlags().StringVarP(&args.manifestsPath, "charts", "", "", ChartsDeprecatedStr)
 	cmd.PersistentFlags().StringVarP(&args.manifestsPath, "manifests", "d", "", ManifestsFlagHelpStr)
 	cmd.PersistentFlags().BoolVar(&args.verify, "verify", false, VerifyCRInstallHelpStr)
+	cmd.PersistentFlags().BoolVar(&args.healthGate, "health-gate", false,
+		"Check that the istiod deployments are ready, that the injection webhooks are reachable and that the proxies "+
+			"accept their configuration after the upgrade. The health of the control plane before the upgrade is "+
+			"only reported")
+	cmd.PersistentFlags().DurationVar(&args.healthGateTimeout, "health-gate-timeout", 5*time.Minute,
+		"Maximum time to wait for the control plane to pass the health gate after the upgrade")
+	cmd.PersistentFlags().Float64Var(&args.maxNackRatio, "max-nack-ratio", 0,
+		"Maximum fraction of the proxies rejecting their configuration for the control plane to pass the health gate")
+	cmd.PersistentFlags().BoolVar(&args.autoRollback, "auto-rollback", false,
+		"Restore the previous installation if the upgrade fails or does not pass the health gate")
+	cmd.PersistentFlags().BoolVar(&args.rollback, "rollback", false,
+		"Restore the installation saved before the last upgrade of the control plane, instead of upgrading it")
 }
 
 // UpgradeCmd upgrades Istio control plane in-place with eligibility checks
@@ -115,7 +138,10 @@ func UpgradeCmd() *cobra.Command {
 		Long: "The upgrade command checks for upgrade version eligibility and," +
 			" if eligible, upgrades the Istio control plane components in-place. Warning: " +
 			"traffic may be disrupted during upgrade. Please ensure PodDisruptionBudgets " +
-			"are defined to maintain service continuity.",
+			"are defined to maintain service continuity.\n\n" +
+			"The control plane objects are saved before the upgrade. With --auto-rollback, the saved objects are " +
+			"reapplied if the upgrade fails, or if the control plane does not pass the --health-gate after it. " +
+			"Use --rollback to reapply them manually.",
 		RunE: func(cmd *cobra.Command, args []string) (e error) {
 			l := clog.NewConsoleLogger(cmd.OutOrStdout(), cmd.OutOrStderr(), installerScope)
 			initLogsOrExit(rootArgs)
@@ -151,6 +177,9 @@ func upgrade(rootArgs *rootArgs, args *upgradeArgs, l clog.Logger) (err error) {
 	if err != nil {
 		return fmt.Errorf("failed to generate Istio configs from file %s, error: %s", args.inFilenames, err)
 	}
+	if args.rollback {
+		return rollbackUpgrade(client, restConfig, targetIOP, rootArgs.dryRun, args.skipConfirmation, l)
+	}
 
 	// Get the target version from the tag in the IOPS
 	targetTag := targetIOP.Spec.Tag
@@ -214,12 +243,51 @@ func upgrade(rootArgs *rootArgs, args *upgradeArgs, l clog.Logger) (err error) {
 	}
 	checkUpgradeIOPS(currentProfileIOPSYaml, targetIOPYaml, overrideIOPYaml, l)
 
+	var gate *upgradeHealthGate
+	if args.healthGate && !rootArgs.dryRun {
+		extendedClient, err := kube.NewExtendedClient(kube.BuildClientCmd(args.kubeConfigPath, args.context),
+			targetIOP.Spec.Revision)
+		if err != nil {
+			return fmt.Errorf("failed to connect Kubernetes API server, error: %v", err)
+		}
+		gate = newUpgradeHealthGate(extendedClient, istioNamespace, targetIOP.Spec.Revision, args.maxNackRatio)
+		// The gate only applies after the upgrade, which may be what fixes the control plane.
+		if err := gate.check(context.Background()); err != nil {
+			l.LogAndPrintf("Warning: the control plane is not healthy before the upgrade: %v", err)
+		} else {
+			l.LogAndPrintf("Pre-upgrade health check passed.\n")
+		}
+	}
+
 	waitForConfirmation(args.skipConfirmation && !rootArgs.dryRun, l)
 
+	// Save the objects of the current installation, to restore them if the upgrade fails.
+	snapshot := ""
+	if !rootArgs.dryRun {
+		snapshot, err = saveControlPlaneSnapshot(client, restConfig, targetIOP, l)
+		if err != nil {
+			return err
+		}
+	}
+	rollbackOnFailure := func(upgradeErr error) error {
+		if snapshot == "" || !args.autoRollback {
+			return upgradeErr
+		}
+		l.LogAndPrintf("Upgrade failed: %v\nRestoring the previous installation.", upgradeErr)
+		reconciler, err := newSnapshotReconciler(client, restConfig, targetIOP, false, l)
+		if err == nil {
+			err = restoreSnapshot(reconciler, targetIOP.Spec.Revision, snapshot, l)
+		}
+		if err != nil {
+			return fmt.Errorf("%v. The previous installation could not be restored: %v", upgradeErr, err)
+		}
+		return fmt.Errorf("%v. The previous installation was restored", upgradeErr)
+	}
+
 	// Apply the Istio Control Plane specs reading from inFilenames to the cluster
 	iop, err := InstallManifests(targetIOP, args.force, rootArgs.dryRun, restConfig, client, args.readinessTimeout, l)
 	if err != nil {
-		return fmt.Errorf("failed to apply the Istio Control Plane specs. Error: %v", err)
+		return rollbackOnFailure(fmt.Errorf("failed to apply the Istio Control Plane specs. Error: %v", err))
 	}
 
 	if !rootArgs.dryRun {
@@ -227,7 +295,15 @@ func upgrade(rootArgs *rootArgs, args *upgradeArgs, l clog.Logger) (err error) {
 		// component version to the target version.
 		err = waitUpgradeComplete(kubeClient, istioNamespace, targetVersion, l)
 		if err != nil {
-			return fmt.Errorf("failed to wait for the upgrade to complete. Error: %v", err)
+			return rollbackOnFailure(fmt.Errorf("failed to wait for the upgrade to complete. Error: %v", err))
+		}
+
+		if gate != nil {
+			l.LogAndPrintf("Checking the health of the upgraded control plane.")
+			if err := gate.wait(context.Background(), args.healthGateTimeout, l); err != nil {
+				return rollbackOnFailure(fmt.Errorf("the upgraded control plane did not pass the health gate: %v", err))
+			}
+			l.LogAndPrintf("Health gate passed.\n")
 		}
 
 		// Read the upgraded Istio version from the the cluster
@@ -25,6 +25,7 @@ import (
 	"github.com/spf13/cobra"
 	"go.opencensus.io/stats/view"
 
+	"k8s.io/client-go/kubernetes"
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
@@ -35,6 +36,7 @@ import (
 
 	"istio.io/istio/operator/pkg/apis"
 	"istio.io/istio/operator/pkg/controller"
+	"istio.io/istio/operator/pkg/helm"
 	"istio.io/istio/operator/pkg/metrics"
 	"istio.io/pkg/ctrlz"
 	"istio.io/pkg/log"
@@ -106,6 +108,20 @@ func getRenewDeadline() *time.Duration {
 	return &duration
 }
 
+// getChartCredentialsSecret returns the namespace and name of the secret holding the credentials used to fetch
+// installation packages, set as namespace/name.
+func getChartCredentialsSecret() (string, string, bool, error) {
+	secret, found := os.LookupEnv("CHART_CREDENTIALS_SECRET")
+	if !found || secret == "" {
+		return "", "", false, nil
+	}
+	parts := strings.Split(secret, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false, fmt.Errorf("CHART_CREDENTIALS_SECRET must be set as namespace/name, got %q", secret)
+	}
+	return parts[0], parts[1], true, nil
+}
+
 func run() {
 	watchNS, err := getWatchNamespace()
 	if err != nil {
@@ -124,6 +140,19 @@ func run() {
 		log.Fatalf("Could not get apiserver config: %v", err)
 	}
 
+	secretNS, secretName, found, err := getChartCredentialsSecret()
+	if err != nil {
+		log.Fatalf("Failed to get chart credentials secret: %v", err)
+	}
+	if found {
+		client, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			log.Fatalf("Could not create a Kubernetes client: %v", err)
+		}
+		log.Infof("Fetching installation packages with the credentials of secret %s/%s", secretNS, secretName)
+		helm.SetCredentialStore(helm.NewSecretCredentialStore(client, secretNS, secretName))
+	}
+
 	var mgrOpt manager.Options
 	leaderElectionID := "istio-operator-lock"
 	if operatorRevision, found := os.LookupEnv("REVISION"); found && operatorRevision != "" {
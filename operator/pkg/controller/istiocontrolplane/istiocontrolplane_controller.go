@@ -355,7 +355,15 @@ func (r *ReconcileIstioOperator) Reconcile(_ context.Context, request reconcile.
 // mergeIOPSWithProfile overlays the values in iop on top of the defaults for the profile given by iop.profile and
 // returns the merged result.
 func mergeIOPSWithProfile(iop *iopv1alpha1.IstioOperator) (*v1alpha1.IstioOperatorSpec, error) {
-	profileYAML, err := helm.GetProfileYAML(iop.Spec.InstallPackagePath, iop.Spec.Profile)
+	installPackagePath := iop.Spec.InstallPackagePath
+	if helm.IsRemoteInstallPackage(installPackagePath) {
+		var err error
+		if installPackagePath, err = helm.FetchInstallPackage(installPackagePath); err != nil {
+			metrics.CountCRMergeFail(metrics.CannotFetchProfileError)
+			return nil, err
+		}
+	}
+	profileYAML, err := helm.GetProfileYAML(installPackagePath, iop.Spec.Profile)
 	if err != nil {
 		metrics.CountCRMergeFail(metrics.CannotFetchProfileError)
 		return nil, err
@@ -408,7 +416,12 @@ func mergeIOPSWithProfile(iop *iopv1alpha1.IstioOperator) (*v1alpha1.IstioOperat
 		return nil, err
 	}
 
-	return istio.UnmarshalAndValidateIOPS(mergedYAMLSpec)
+	spec, err := istio.UnmarshalAndValidateIOPS(mergedYAMLSpec)
+	if spec != nil {
+		// Render the charts from the fetched installation package rather than the remote one.
+		spec.InstallPackagePath = installPackagePath
+	}
+	return spec, err
 }
 
 // Add creates a new IstioOperator Controller and adds it to the Manager. The Manager will set fields on the Controller
@@ -0,0 +1,124 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"istio.io/istio/pkg/oci"
+)
+
+const (
+	// ChartCredentialsFileEnv is the environment variable holding the path of the Docker config JSON with the
+	// credentials used to fetch installation packages. It defaults to the Docker config of the user.
+	ChartCredentialsFileEnv = "ISTIO_CHART_CREDENTIALS_FILE"
+)
+
+// Credentials authenticate requests to a chart repository or registry. Either the username and password or the
+// token are set.
+type Credentials = oci.Credentials
+
+// CredentialStore provides the credentials for the hosts serving installation packages.
+type CredentialStore interface {
+	// Credentials returns the credentials for the host, or nil if the host is accessed anonymously.
+	Credentials(host string) (*Credentials, error)
+}
+
+// credentialStore is used by the fetchers unless they are given another store.
+var credentialStore CredentialStore = NewFileCredentialStore("")
+
+// SetCredentialStore sets the store providing the credentials used to fetch installation packages.
+func SetCredentialStore(store CredentialStore) {
+	credentialStore = store
+}
+
+type fileCredentialStore struct {
+	path string
+}
+
+// NewFileCredentialStore returns a store reading the credentials from a Docker config JSON file. If path is "",
+// the file is the one set in ISTIO_CHART_CREDENTIALS_FILE, or the Docker config of the user. The file is read on
+// each lookup, so that updated credentials are picked up; a missing file means no credentials.
+func NewFileCredentialStore(path string) CredentialStore {
+	return &fileCredentialStore{path: path}
+}
+
+func (s *fileCredentialStore) Credentials(host string) (*Credentials, error) {
+	path := s.path
+	if path == "" {
+		path = defaultCredentialsFile()
+	}
+	if path == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read credentials file: %v", err)
+	}
+	return oci.DockerConfigCredentials(b, host)
+}
+
+func defaultCredentialsFile() string {
+	if path := os.Getenv(ChartCredentialsFileEnv); path != "" {
+		return path
+	}
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+type secretCredentialStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewSecretCredentialStore returns a store reading the credentials from a kubernetes.io/dockerconfigjson or
+// kubernetes.io/dockercfg secret. The secret is read on each lookup, so that rotated credentials are picked up.
+func NewSecretCredentialStore(client kubernetes.Interface, namespace, name string) CredentialStore {
+	return &secretCredentialStore{client: client, namespace: namespace, name: name}
+}
+
+func (s *secretCredentialStore) Credentials(host string) (*Credentials, error) {
+	secret, err := s.client.CoreV1().Secrets(s.namespace).Get(context.TODO(), s.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not read credentials secret %s/%s: %v", s.namespace, s.name, err)
+	}
+	config, f := secret.Data[v1.DockerConfigJsonKey]
+	if !f {
+		config, f = secret.Data[v1.DockerConfigKey]
+	}
+	if !f {
+		return nil, fmt.Errorf("credentials secret %s/%s has neither a %s nor a %s key",
+			s.namespace, s.name, v1.DockerConfigJsonKey, v1.DockerConfigKey)
+	}
+	return oci.DockerConfigCredentials(config, host)
+}
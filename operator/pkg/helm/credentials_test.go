@@ -0,0 +1,78 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testDockerConfig = `{
+  "auths": {
+    "https://registry.example.com/v1/": {"auth": "dXNlcjpwYXNz"},
+    "charts.example.com": {"username": "bob", "password": "secret"},
+    "localhost:5000": {"registrytoken": "token"}
+  }
+}`
+
+func TestFileCredentialStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	store := NewFileCredentialStore(path)
+	if got, err := store.Credentials("registry.example.com"); err != nil || got != nil {
+		t.Fatalf("got %+v, %v for a missing file, want no credentials", got, err)
+	}
+	if err := ioutil.WriteFile(path, []byte(testDockerConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Credentials("registry.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&Credentials{Username: "user", Password: "pass"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	os.Setenv(ChartCredentialsFileEnv, path)
+	defer os.Unsetenv(ChartCredentialsFileEnv)
+	if got, err := NewFileCredentialStore("").Credentials("localhost:5000"); err != nil || got == nil || got.Token != "token" {
+		t.Errorf("got %+v, %v from %s", got, err, ChartCredentialsFileEnv)
+	}
+}
+
+func TestSecretCredentialStore(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "chart-credentials", Namespace: "istio-operator"},
+		Type:       v1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{v1.DockerConfigJsonKey: []byte(testDockerConfig)},
+	})
+	got, err := NewSecretCredentialStore(client, "istio-operator", "chart-credentials").Credentials("charts.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&Credentials{Username: "bob", Password: "secret"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if _, err := NewSecretCredentialStore(client, "istio-operator", "missing").Credentials("charts.example.com"); err == nil {
+		t.Error("expected an error reading a missing secret")
+	}
+}
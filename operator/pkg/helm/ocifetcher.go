@@ -0,0 +1,187 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mholt/archiver/v3"
+
+	"istio.io/istio/pkg/oci"
+)
+
+const (
+	// OCIScheme is the prefix of installation package references to OCI registries.
+	OCIScheme = oci.Scheme
+
+	// Media types of the layers holding the installation package as a gzipped tar.
+	helmChartContentMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	ociLayerMediaType         = "application/vnd.oci.image.layer.v1.tar+gzip"
+	dockerLayerMediaType      = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+
+	// ociCacheDirectory is the subdirectory of the destination root where packages are extracted by manifest digest.
+	ociCacheDirectory = "oci"
+)
+
+// IsOCIReference reports whether the installation package path is a reference to an OCI registry.
+func IsOCIReference(path string) bool {
+	return strings.HasPrefix(path, OCIScheme)
+}
+
+// OCIFetcher fetches installation packages stored as a single gzipped tar layer in an OCI registry, such as Helm
+// charts pushed with helm chart push. Packages are extracted by manifest digest, so that a package is downloaded
+// only once.
+type OCIFetcher struct {
+	// ref is the reference of the package, in the form oci://registry/repository:tag or oci://registry/repository@digest.
+	ref string
+	// destDirRoot is the root dir where packages are downloaded and extracted.
+	destDirRoot string
+
+	client      *http.Client
+	credentials CredentialStore
+	// destDir is the dir the package was extracted to.
+	destDir string
+}
+
+// NewOCIFetcher creates an OCIFetcher for the package reference and the root dir to extract it into. If destDirRoot
+// is "", the default root dir of URLFetcher is used.
+func NewOCIFetcher(ref string, destDirRoot string) *OCIFetcher {
+	if destDirRoot == "" {
+		destDirRoot = filepath.Join(os.TempDir(), InstallationDirectory)
+	}
+	return &OCIFetcher{
+		ref:         ref,
+		destDirRoot: destDirRoot,
+		client:      &http.Client{Timeout: fetchTimeout},
+		credentials: credentialStore,
+	}
+}
+
+// DestDir returns the path of the dir that the package was extracted to. It is only set once Fetch succeeds.
+func (f *OCIFetcher) DestDir() string {
+	return f.destDir
+}
+
+// Fetch downloads and extracts the package, unless the package with the same digest was extracted already.
+// Packages referenced by digest are not looked up in the registry once cached.
+func (f *OCIFetcher) Fetch() error {
+	ref, err := oci.ParseReference(f.ref)
+	if err != nil {
+		return err
+	}
+	if ref.IsDigest() {
+		if dir := f.cacheDir(ref.Reference); isDir(dir) {
+			f.destDir = dir
+			return nil
+		}
+	}
+	creds, err := f.credentials.Credentials(ref.Registry)
+	if err != nil {
+		return err
+	}
+	client := oci.NewClient(f.client, creds, false)
+	m, digest, err := client.FetchManifest(ref)
+	if err != nil {
+		return fmt.Errorf("could not fetch manifest for %v: %v", f.ref, err)
+	}
+	dir := f.cacheDir(digest)
+	if isDir(dir) {
+		f.destDir = dir
+		return nil
+	}
+	layer, err := packageLayer(m)
+	if err != nil {
+		return fmt.Errorf("could not fetch %v: %v", f.ref, err)
+	}
+	if err := f.extractLayer(client, ref, layer, dir); err != nil {
+		return fmt.Errorf("could not fetch %v: %v", f.ref, err)
+	}
+	f.destDir = dir
+	return nil
+}
+
+func (f *OCIFetcher) cacheDir(digest string) string {
+	return filepath.Join(f.destDirRoot, ociCacheDirectory, strings.TrimPrefix(digest, "sha256:"))
+}
+
+// packageLayer returns the layer holding the package. Helm chart layers are preferred, so that charts pushed
+// along with their provenance are supported.
+func packageLayer(m *oci.Manifest) (oci.Descriptor, error) {
+	for _, mediaType := range []string{helmChartContentMediaType, ociLayerMediaType, dockerLayerMediaType} {
+		for _, l := range m.Layers {
+			if l.MediaType == mediaType {
+				return l, nil
+			}
+		}
+	}
+	var mediaTypes []string
+	for _, l := range m.Layers {
+		mediaTypes = append(mediaTypes, l.MediaType)
+	}
+	return oci.Descriptor{}, fmt.Errorf("no gzipped tar layer found in the manifest, got layers of types %v", mediaTypes)
+}
+
+// extractLayer downloads the layer, verifies its digest and size, and extracts it into dir.
+func (f *OCIFetcher) extractLayer(client *oci.Client, ref *oci.Reference, layer oci.Descriptor, dir string) error {
+	root := filepath.Join(f.destDirRoot, ociCacheDirectory)
+	if err := os.MkdirAll(root, os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(root, filepath.Base(dir)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	blob, err := client.FetchBlob(ref, layer)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	archive := filepath.Join(tmp, "package.tar.gz")
+	file, err := os.Create(archive)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, blob)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	// Extract next to the final dir and rename it once complete, so that a partially extracted package is never used.
+	extracted := filepath.Join(tmp, "package")
+	targz := archiver.TarGz{Tar: &archiver.Tar{OverwriteExisting: true}}
+	if err := targz.Unarchive(archive, extracted); err != nil {
+		return err
+	}
+	if err := os.Rename(extracted, dir); err != nil && !isDir(dir) {
+		return err
+	}
+	return nil
+}
+
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
@@ -0,0 +1,163 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"istio.io/istio/pkg/oci/ocitest"
+)
+
+func newTestOCIFetcher(r *ocitest.Registry, ref, destDirRoot string, creds *Credentials) *OCIFetcher {
+	f := NewOCIFetcher(ref, destDirRoot)
+	f.client = r.Client()
+	f.credentials = staticCredentialStore{r.Host(): creds}
+	return f
+}
+
+type staticCredentialStore map[string]*Credentials
+
+func (s staticCredentialStore) Credentials(host string) (*Credentials, error) {
+	return s[host], nil
+}
+
+func TestOCIFetcher(t *testing.T) {
+	r := ocitest.NewTLSRegistry(t, "istio/manifests")
+	r.Username, r.Password = "user", "pass"
+	pkg := ocitest.TarGz(t, map[string]string{
+		"istio-manifests/profiles/default.yaml":  "kind: IstioOperator\n",
+		"istio-manifests/charts/base/Chart.yaml": "name: base\n",
+	})
+	digest := r.Push(t, "1.10.0", ocitest.Layer{MediaType: helmChartContentMediaType, Data: pkg})
+	root := t.TempDir()
+	ref := "oci://" + r.Host() + "/istio/manifests"
+
+	if err := newTestOCIFetcher(r, ref+":1.10.0", root, nil).Fetch(); err == nil {
+		t.Fatal("expected an error fetching without credentials")
+	}
+
+	f := newTestOCIFetcher(r, ref+":1.10.0", root, &Credentials{Username: "user", Password: "pass"})
+	if err := f.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(root, ociCacheDirectory, strings.TrimPrefix(digest, "sha256:")); f.DestDir() != want {
+		t.Fatalf("got dest dir %v, want %v", f.DestDir(), want)
+	}
+	dir, err := findInstallPackageDir(f.DestDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "profiles", "default.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "kind: IstioOperator\n" {
+		t.Errorf("got profile %q", b)
+	}
+
+	// The package is fetched once by tag, and not looked up again by digest.
+	f = newTestOCIFetcher(r, ref+":1.10.0", root, &Credentials{Username: "user", Password: "pass"})
+	if err := f.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	f = newTestOCIFetcher(r, ref+"@"+digest, root, nil)
+	if err := f.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if r.BlobRequests != 1 || r.ManifestRequests != 2 {
+		t.Errorf("got %d manifest and %d blob requests, want 2 and 1", r.ManifestRequests, r.BlobRequests)
+	}
+}
+
+func TestOCIFetcherRegistryToken(t *testing.T) {
+	r := ocitest.NewTLSRegistry(t, "istio/manifests")
+	r.Username = "unused"
+	r.Push(t, "latest", ocitest.Layer{MediaType: ociLayerMediaType, Data: ocitest.TarGz(t, map[string]string{"profiles/default.yaml": ""})})
+	f := newTestOCIFetcher(r, "oci://"+r.Host()+"/istio/manifests:latest", t.TempDir(), &Credentials{Token: "secret-token"})
+	if err := f.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if dir, err := findInstallPackageDir(f.DestDir()); err != nil || dir != f.DestDir() {
+		t.Errorf("got package dir %v, %v, want %v", dir, err, f.DestDir())
+	}
+}
+
+func TestOCIFetcherVerification(t *testing.T) {
+	pkg := ocitest.TarGz(t, map[string]string{"manifests/profiles/default.yaml": ""})
+	cases := []struct {
+		name    string
+		prepare func(r *ocitest.Registry) string
+		wantErr string
+	}{
+		{
+			name: "pinned digest mismatch",
+			prepare: func(r *ocitest.Registry) string {
+				r.Push(t, "other", ocitest.Layer{MediaType: helmChartContentMediaType, Data: ocitest.TarGz(t, nil)})
+				other := r.Manifests["other"]
+				digest := r.Push(t, "1.10.0", ocitest.Layer{MediaType: helmChartContentMediaType, Data: pkg})
+				r.Manifests[digest] = other
+				return "@" + digest
+			},
+			wantErr: "does not match",
+		},
+		{
+			name: "reported digest mismatch",
+			prepare: func(r *ocitest.Registry) string {
+				r.Push(t, "1.10.0", ocitest.Layer{MediaType: helmChartContentMediaType, Data: pkg})
+				r.ReportedDigest = "sha256:" + strings.Repeat("0", 64)
+				return ":1.10.0"
+			},
+			wantErr: "reported by the registry",
+		},
+		{
+			name: "layer digest mismatch",
+			prepare: func(r *ocitest.Registry) string {
+				r.Push(t, "1.10.0", ocitest.Layer{MediaType: helmChartContentMediaType, Data: pkg})
+				for digest := range r.Blobs {
+					r.Blobs[digest] = append([]byte{}, pkg...)
+					r.Blobs[digest][len(pkg)-1]++
+				}
+				return ":1.10.0"
+			},
+			wantErr: "layer has digest",
+		},
+		{
+			name: "no package layer",
+			prepare: func(r *ocitest.Registry) string {
+				r.Push(t, "1.10.0", ocitest.Layer{MediaType: "application/vnd.cncf.helm.chart.provenance.v1.prov", Data: []byte("prov")})
+				return ":1.10.0"
+			},
+			wantErr: "no gzipped tar layer",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ocitest.NewTLSRegistry(t, "istio/manifests")
+			suffix := tt.prepare(r)
+			root := t.TempDir()
+			err := newTestOCIFetcher(r, "oci://"+r.Host()+"/istio/manifests"+suffix, root, nil).Fetch()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+			// Nothing is left in the cache.
+			if entries, _ := ioutil.ReadDir(filepath.Join(root, ociCacheDirectory)); len(entries) != 0 {
+				t.Errorf("got cache entries %v", entries)
+			}
+		})
+	}
+}
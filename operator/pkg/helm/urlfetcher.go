@@ -15,17 +15,20 @@
 package helm
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/mholt/archiver/v3"
 
-	"istio.io/istio/operator/pkg/httprequest"
+	"istio.io/istio/operator/pkg/util"
 	"istio.io/istio/operator/pkg/version"
 )
 
@@ -37,6 +40,11 @@ const (
 	// OperatorSubdirFilePath15 is the file path of installation packages to helm charts for 1.5 and earlier.
 	// TODO: remove in 1.7.
 	OperatorSubdirFilePath15 = "install/kubernetes/operator"
+
+	// fetchTimeout is the timeout of the requests fetching installation packages.
+	fetchTimeout = 5 * time.Minute
+	// digestFileSuffix is the suffix of the file recording the digest of an extracted installation package.
+	digestFileSuffix = ".sha256"
 )
 
 // URLFetcher is used to fetch and manipulate charts from remote url
@@ -47,6 +55,12 @@ type URLFetcher struct {
 	// destDirRoot is the root dir where charts are downloaded and extracted. If set to "", the destination dir will be
 	// set to the default value, which is static for caching purposes.
 	destDirRoot string
+	// digest is the expected digest of the release tar, in the form sha256:<hex>. If set, the tar is verified and
+	// only downloaded if the release tar with that digest was not extracted already.
+	digest string
+
+	client      *http.Client
+	credentials CredentialStore
 }
 
 // NewURLFetcher creates an URLFetcher pointing to installation package URL and destination dir to extract it into,
@@ -55,13 +69,23 @@ type URLFetcher struct {
 // i.e. the full URL path to the Istio release tar.
 // destDirRoot is the root dir where charts are downloaded and extracted. If set to "", the destination dir will be set
 // to the default value, which is static for caching purposes.
+// The url may end with a fragment #sha256:<hex> pinning the digest of the release tar. Credentials for the host are
+// sent over HTTPS if the credential store has any.
 func NewURLFetcher(url string, destDirRoot string) *URLFetcher {
 	if destDirRoot == "" {
 		destDirRoot = filepath.Join(os.TempDir(), InstallationDirectory)
 	}
+	digest := ""
+	if i := strings.Index(url, "#"); i >= 0 {
+		digest = url[i+1:]
+		url = url[:i]
+	}
 	return &URLFetcher{
 		url:         url,
 		destDirRoot: destDirRoot,
+		digest:      digest,
+		client:      &http.Client{Timeout: fetchTimeout},
+		credentials: credentialStore,
 	}
 }
 
@@ -77,33 +101,83 @@ func (f *URLFetcher) Fetch() error {
 	if _, _, err := URLToDirname(f.url); err != nil {
 		return err
 	}
+	if f.digest != "" && !strings.HasPrefix(f.digest, "sha256:") {
+		return fmt.Errorf("unsupported digest %s of %s, expect sha256:<hex>", f.digest, f.url)
+	}
+	digestFile := f.DestDir() + digestFileSuffix
+	if f.digest != "" && isDir(f.DestDir()) {
+		if b, err := ioutil.ReadFile(digestFile); err == nil && string(b) == f.digest {
+			return nil
+		}
+	}
 	if _, err := os.Stat(f.destDirRoot); os.IsNotExist(err) {
 		err := os.Mkdir(f.destDirRoot, os.ModeDir|os.ModePerm)
 		if err != nil {
 			return err
 		}
 	}
-	saved, err := DownloadTo(f.url, f.destDirRoot)
+	saved, err := downloadTo(f.client, f.credentials, f.url, f.destDirRoot)
 	if err != nil {
 		return err
 	}
-	file, err := os.Open(saved)
-	if err != nil {
-		return err
+	if f.digest != "" {
+		b, err := ioutil.ReadFile(saved)
+		if err != nil {
+			return err
+		}
+		if digest := fmt.Sprintf("sha256:%x", sha256.Sum256(b)); digest != f.digest {
+			return fmt.Errorf("%s has digest %s, which does not match %s", f.url, digest, f.digest)
+		}
+		// Do not leave files of another release tar extracted to the same dir.
+		if err := os.RemoveAll(f.DestDir()); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(digestFile); err != nil {
+			return err
+		}
 	}
-	defer file.Close()
 
 	targz := archiver.TarGz{Tar: &archiver.Tar{OverwriteExisting: true}}
-	return targz.Unarchive(saved, f.destDirRoot)
+	if err := targz.Unarchive(saved, f.destDirRoot); err != nil {
+		return err
+	}
+	if f.digest != "" {
+		return ioutil.WriteFile(digestFile, []byte(f.digest), 0o644)
+	}
+	return nil
 }
 
 // DownloadTo downloads from remote srcURL to dest local file path
 func DownloadTo(srcURL, dest string) (string, error) {
+	return downloadTo(&http.Client{Timeout: fetchTimeout}, credentialStore, srcURL, dest)
+}
+
+func downloadTo(client *http.Client, credentials CredentialStore, srcURL, dest string) (string, error) {
 	u, err := url.Parse(srcURL)
 	if err != nil {
 		return "", fmt.Errorf("invalid chart URL: %s", srcURL)
 	}
-	data, err := httprequest.Get(u.String())
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	// Credentials are never sent in clear text. They are dropped by the client if redirected to another host.
+	if u.Scheme == "https" {
+		creds, err := credentials.Credentials(u.Host)
+		if err != nil {
+			return "", err
+		}
+		creds.SetAuth(req)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch URL %s : %s", u, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return "", err
 	}
@@ -117,6 +191,51 @@ func DownloadTo(srcURL, dest string) (string, error) {
 	return destFile, nil
 }
 
+// IsRemoteInstallPackage reports whether the installation package path is an oci:// reference or an HTTP(S) URL,
+// which must be fetched with FetchInstallPackage.
+func IsRemoteInstallPackage(path string) bool {
+	isURL, _ := util.IsHTTPURL(path)
+	return isURL || IsOCIReference(path)
+}
+
+// FetchInstallPackage downloads and extracts the installation package at the oci:// reference or HTTP(S) URL, and
+// returns the local path of the dir holding its charts and profiles.
+func FetchInstallPackage(path string) (string, error) {
+	if IsOCIReference(path) {
+		f := NewOCIFetcher(path, "")
+		if err := f.Fetch(); err != nil {
+			return "", err
+		}
+		return findInstallPackageDir(f.DestDir())
+	}
+	uf := NewURLFetcher(path, "")
+	if err := uf.Fetch(); err != nil {
+		return "", err
+	}
+	// Release tars hold the charts and profiles in manifests, or install/kubernetes/operator before 1.6.
+	baseDir := filepath.Join(uf.DestDir(), OperatorSubdirFilePath15)
+	if _, err := os.Stat(baseDir); os.IsNotExist(err) {
+		baseDir = filepath.Join(uf.DestDir(), OperatorSubdirFilePath)
+	}
+	return baseDir, nil
+}
+
+// findInstallPackageDir returns the dir holding the profiles in the extracted package: the package itself, its
+// manifests dir, or those of its single top level dir, as in Helm chart archives.
+func findInstallPackageDir(dir string) (string, error) {
+	candidates := []string{dir, filepath.Join(dir, OperatorSubdirFilePath)}
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) == 1 && entries[0].IsDir() {
+		top := filepath.Join(dir, entries[0].Name())
+		candidates = append(candidates, top, filepath.Join(top, OperatorSubdirFilePath))
+	}
+	for _, c := range candidates {
+		if isDir(filepath.Join(c, "profiles")) {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("could not find the profiles of the installation package extracted to %s", dir)
+}
+
 // URLToDirname, given an input URL pointing to an Istio release tar, returns the subdirectory name that the tar would
 // be extracted to and the version in the URL. The input URLs are expected to have the form
 // https://.../istio-{version}-{platform}[optional suffix].tar.gz.
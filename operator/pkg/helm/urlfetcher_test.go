@@ -15,12 +15,19 @@
 package helm
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"istio.io/istio/operator/pkg/util/httpserver"
+	"istio.io/istio/pkg/oci/ocitest"
 )
 
 func TestFetch(t *testing.T) {
@@ -64,3 +71,136 @@ func TestFetch(t *testing.T) {
 		}
 	}
 }
+
+func TestFetchAuthenticated(t *testing.T) {
+	release := ocitest.TarGz(t, map[string]string{"istio-1.10.0/manifests/profiles/default.yaml": "kind: IstioOperator\n"})
+	downloads := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if u, p, _ := req.BasicAuth(); u != "user" || p != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Path != "/istio-1.10.0-linux-amd64.tar.gz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		downloads++
+		_, _ = w.Write(release)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	releaseURL := server.URL + "/istio-1.10.0-linux-amd64.tar.gz"
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(release))
+	fetcher := func(url, root string, creds *Credentials) *URLFetcher {
+		f := NewURLFetcher(url, root)
+		f.client = server.Client()
+		f.credentials = staticCredentialStore{u.Host: creds}
+		return f
+	}
+	creds := &Credentials{Username: "user", Password: "pass"}
+
+	cases := []struct {
+		name    string
+		url     string
+		creds   *Credentials
+		wantErr string
+	}{
+		{
+			name:    "no credentials",
+			url:     releaseURL,
+			wantErr: "401 Unauthorized",
+		},
+		{
+			name:  "credentials",
+			url:   releaseURL,
+			creds: creds,
+		},
+		{
+			name:  "pinned digest",
+			url:   releaseURL + "#" + digest,
+			creds: creds,
+		},
+		{
+			name:    "pinned digest mismatch",
+			url:     releaseURL + "#sha256:" + strings.Repeat("0", 64),
+			creds:   creds,
+			wantErr: "does not match",
+		},
+		{
+			name:    "unsupported digest",
+			url:     releaseURL + "#md5:abc",
+			creds:   creds,
+			wantErr: "unsupported digest",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			f := fetcher(tt.url, t.TempDir(), tt.creds)
+			err := f.Fetch()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(filepath.Join(f.DestDir(), "manifests", "profiles", "default.yaml")); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// Release tars pinned by digest are only downloaded once.
+	root := t.TempDir()
+	downloads = 0
+	for i := 0; i < 2; i++ {
+		if err := fetcher(releaseURL+"#"+digest, root, creds).Fetch(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("got %d downloads, want 1", downloads)
+	}
+}
+
+func TestFindInstallPackageDir(t *testing.T) {
+	cases := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{name: "package", files: []string{"profiles/default.yaml", "charts/base/Chart.yaml"}, want: "."},
+		{name: "release", files: []string{"manifests/profiles/default.yaml", "bin/istioctl"}, want: "manifests"},
+		{name: "chart archive", files: []string{"istio/profiles/default.yaml"}, want: "istio"},
+		{name: "release archive", files: []string{"istio-1.10.0/manifests/profiles/default.yaml"}, want: "istio-1.10.0/manifests"},
+		{name: "no profiles", files: []string{"istio/charts/base/Chart.yaml"}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range tt.files {
+				if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(f)), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := findInstallPackageDir(dir)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dir, tt.want); got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
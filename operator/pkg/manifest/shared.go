@@ -333,40 +333,25 @@ func validateSetFlags(setFlags []string) error {
 	return nil
 }
 
-// fetchExtractInstallPackageHTTP downloads installation tar from the URL specified and extracts it to a local
-// filesystem dir. If successful, it returns the path to the filesystem path where the charts were extracted.
-func fetchExtractInstallPackageHTTP(releaseTarURL string) (string, error) {
-	uf := helm.NewURLFetcher(releaseTarURL, "")
-	if err := uf.Fetch(); err != nil {
-		return "", err
-	}
-	return uf.DestDir(), nil
-}
-
-// rewriteURLToLocalInstallPath checks installPackagePath and if it is a URL, it tries to download and extract the
-// Istio release tar at the URL to a local file path. If successful, it returns the resulting local paths to the
-// installation charts and profile file.
-// If installPackagePath is not a URL, it returns installPackagePath and profileOrPath unmodified.
+// rewriteURLToLocalInstallPath checks installPackagePath and if it is a URL or an oci:// reference, it tries to
+// download and extract the Istio installation package to a local file path. If successful, it returns the resulting
+// local paths to the installation charts and profile file.
+// If installPackagePath is not remote, it returns installPackagePath and profileOrPath unmodified.
 func rewriteURLToLocalInstallPath(installPackagePath, profileOrPath string, skipValidation bool) (string, string, error) {
 	isURL, err := util.IsHTTPURL(installPackagePath)
 	if err != nil && !skipValidation {
 		return "", "", err
 	}
-	if isURL {
-		installPackagePath, err = fetchExtractInstallPackageHTTP(installPackagePath)
+	if isURL || helm.IsOCIReference(installPackagePath) {
+		// Rewrite installPackagePath to the local file path for further processing, like
+		// /tmp/istio-install-packages/istio-1.5.1/manifests.
+		installPackagePath, err = helm.FetchInstallPackage(installPackagePath)
 		if err != nil {
 			return "", "", err
 		}
 		// Transform a profileOrPath like "default" or "demo" into a filesystem path like
-		// /tmp/istio-install-packages/istio-1.5.1/manifests/profiles/default.yaml OR
-		// /tmp/istio-install-packages/istio-1.5.1/install/kubernetes/operator/profiles/default.yaml (before 1.6).
-		baseDir := filepath.Join(installPackagePath, helm.OperatorSubdirFilePath15)
-		if _, err := os.Stat(baseDir); os.IsNotExist(err) {
-			baseDir = filepath.Join(installPackagePath, helm.OperatorSubdirFilePath)
-		}
-		profileOrPath = filepath.Join(baseDir, "profiles", profileOrPath+".yaml")
-		// Rewrite installPackagePath to the local file path for further processing.
-		installPackagePath = baseDir
+		// /tmp/istio-install-packages/istio-1.5.1/manifests/profiles/default.yaml.
+		profileOrPath = filepath.Join(installPackagePath, "profiles", profileOrPath+".yaml")
 	}
 
 	return installPackagePath, profileOrPath, nil
@@ -178,6 +178,9 @@ var (
 				log.Error("Failed to extract node metadata: ", err)
 				os.Exit(1)
 			}
+			if err := agent.GenerateGRPCBootstrap(node); err != nil {
+				return err
+			}
 			envoyProxy := envoy.NewProxy(envoy.ProxyConfig{
 				Node:              node,
 				LogLevel:          proxyLogLevel,
@@ -35,11 +35,21 @@ func NewAgentOptions(proxy *model.Proxy) *istioagent.AgentOptions {
 		IsIPv6:                   proxy.SupportsIPv6(),
 		ProxyType:                proxy.Type,
 		EnableDynamicProxyConfig: enableProxyConfigXdsEnv,
+		EnableCRL:                enableCRLXdsEnv,
+		WASMPullSecretPath:       wasmPullSecretPath,
+		GRPCBootstrapPath:        grpcBootstrapEnv,
+		XDSCacheDir:              xdsCacheDirEnv,
+		XDSCacheMaxSize:          xdsCacheMaxSizeEnv,
+		XDSCacheMaxStaleness:     xdsCacheMaxStalenessEnv,
 	}
 	extractXDSHeadersFromEnv(o)
+	if wasmInsecureRegistries != "" {
+		o.WASMInsecureRegistries = strings.Split(wasmInsecureRegistries, ",")
+	}
 	if proxyXDSViaAgent {
 		o.ProxyXDSViaAgent = true
 		o.DNSCapture = dnsCaptureByAgent
+		o.DNSUpstreamCacheSize = dnsUpstreamCacheSize
 		o.ProxyNamespace = PodNamespaceVar.Get()
 		o.ProxyDomain = proxy.DNSDomain
 	}
@@ -62,6 +62,17 @@ var (
 
 	caProviderEnv = env.RegisterStringVar("CA_PROVIDER", "Citadel", "name of authentication provider").Get()
 	caEndpointEnv = env.RegisterStringVar("CA_ADDR", "", "Address of the spiffe certificate provider. Defaults to discoveryAddress").Get()
+	caHeadersEnv  = env.RegisterStringVar("CA_HEADERS", "",
+		"Comma separated list of key=value gRPC metadata sent with the CSR requests of the ExternalCA provider").Get()
+	caClientCertEnv = env.RegisterStringVar("CA_CLIENT_CERT", "",
+		"Certificate used by the ExternalCA provider to authenticate with the CA using mTLS").Get()
+	caClientKeyEnv = env.RegisterStringVar("CA_CLIENT_KEY", "",
+		"Private key used by the ExternalCA provider to authenticate with the CA using mTLS").Get()
+	caTLSServerNameEnv = env.RegisterStringVar("CA_TLS_SERVER_NAME", "",
+		"Server name used by the ExternalCA provider to verify the certificate of the CA, if not the CA_ADDR host").Get()
+	caSendWorkloadTokenEnv = env.RegisterBoolVar("CA_SEND_WORKLOAD_TOKEN", false,
+		"If enabled, the ExternalCA provider sends the token of the workload to the CA. The token is also accepted by Istiod, "+
+			"so it should only be enabled for a trusted CA").Get()
 
 	trustDomainEnv = env.RegisterStringVar("TRUST_DOMAIN", "cluster.local",
 		"The trust domain for spiffe certificates").Get()
@@ -84,8 +95,33 @@ var (
 	// This is a copy of the env var in the init code.
 	dnsCaptureByAgent = env.RegisterBoolVar("ISTIO_META_DNS_CAPTURE", false,
 		"If set to true, enable the capture of outgoing DNS packets on port 53, redirecting to istio-agent on :15053").Get()
+	dnsUpstreamCacheSize = env.RegisterIntVar("DNS_UPSTREAM_CACHE_SIZE", 1024,
+		"The number of responses of the upstream DNS servers, including NXDOMAIN responses, cached by the agent "+
+			"when DNS capture is enabled. Responses are cached for their TTL. 0 disables the cache.").Get()
 
 	// Ability of istio-agent to retrieve proxyConfig via XDS for dynamic configuration updates
 	enableProxyConfigXdsEnv = env.RegisterBoolVar("PROXY_CONFIG_XDS_AGENT", false,
 		"If set to true, agent retrieves dynamic proxy-config updates via xds channel").Get()
+
+	enableCRLXdsEnv = env.RegisterBoolVar("CRL_XDS_AGENT", false,
+		"If set to true, agent retrieves the certificate revocation list of the Istio CA via xds channel, "+
+			"and adds it to the validation context of the root certificate").Get()
+
+	wasmInsecureRegistries = env.RegisterStringVar("WASM_INSECURE_REGISTRIES", "",
+		"Comma separated list of registries, for example 'localhost:5000,docker-registry:5000', "+
+			"from which Wasm module images are pulled over plain HTTP").Get()
+	wasmPullSecretPath = env.RegisterStringVar("WASM_PULL_SECRET_PATH", "",
+		"Path to a Docker config JSON holding the credentials used to pull Wasm module images").Get()
+
+	xdsCacheDirEnv = env.RegisterStringVar("XDS_CACHE_DIR", "",
+		"If set, the agent persists the last XDS responses ACKed by Envoy to this directory, and serves them to "+
+			"Envoy when istiod is unreachable, for example when Envoy restarts during an istiod outage.").Get()
+	xdsCacheMaxSizeEnv = env.RegisterIntVar("XDS_CACHE_MAX_SIZE", 64*1024*1024,
+		"The maximum size in bytes of the XDS responses persisted to XDS_CACHE_DIR.").Get()
+	xdsCacheMaxStalenessEnv = env.RegisterDurationVar("XDS_CACHE_MAX_STALENESS", 24*time.Hour,
+		"The maximum age of the cached XDS responses served to Envoy. 0 disables the limit.").Get()
+
+	grpcBootstrapEnv = env.RegisterStringVar("GRPC_XDS_BOOTSTRAP", "",
+		"If set, the agent writes the bootstrap for proxyless gRPC applications to this path, along with "+
+			"the workload certificates used for mTLS.").Get()
 )
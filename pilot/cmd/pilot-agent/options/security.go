@@ -47,9 +47,18 @@ func NewSecurityOptions(proxyConfig *meshconfig.ProxyConfig, stsPort int, tokenM
 		ECCSigAlg:                      eccSigAlgEnv,
 		SecretTTL:                      secretTTLEnv,
 		SecretRotationGracePeriodRatio: secretRotationGracePeriodRatioEnv,
+		CAClientCertFile:               caClientCertEnv,
+		CAClientKeyFile:                caClientKeyEnv,
+		CATLSServerName:                caTLSServerNameEnv,
+		CASendWorkloadToken:            caSendWorkloadTokenEnv,
 	}
+	caHeaders, err := parseCAHeaders(caHeadersEnv)
+	if err != nil {
+		return nil, err
+	}
+	o.CAHeaders = caHeaders
 
-	o, err := SetupSecurityOptions(proxyConfig, o, jwtPolicy.Get(),
+	o, err = SetupSecurityOptions(proxyConfig, o, jwtPolicy.Get(),
 		credFetcherTypeEnv, credIdentityProvider)
 	if err != nil {
 		return o, err
@@ -106,5 +115,25 @@ func SetupSecurityOptions(proxyConfig *meshconfig.ProxyConfig, secOpt *security.
 	if o.ProvCert != "" && o.FileMountedCerts {
 		return nil, fmt.Errorf("invalid options: PROV_CERT and FILE_MOUNTED_CERTS are mutually exclusive")
 	}
+	if (o.CAClientCertFile == "") != (o.CAClientKeyFile == "") {
+		return nil, fmt.Errorf("invalid options: CA_CLIENT_CERT and CA_CLIENT_KEY must be set together")
+	}
 	return o, nil
 }
+
+// parseCAHeaders parses a comma separated list of key=value headers.
+func parseCAHeaders(headers string) (map[string]string, error) {
+	if headers == "" {
+		return nil, nil
+	}
+	res := map[string]string{}
+	for _, kv := range strings.Split(headers, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		if len(parts) != 2 || key == "" {
+			return nil, fmt.Errorf("invalid CA_HEADERS entry %q, expected key=value", kv)
+		}
+		res[key] = strings.TrimSpace(parts[1])
+	}
+	return res, nil
+}
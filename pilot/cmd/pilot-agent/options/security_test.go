@@ -0,0 +1,57 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCAHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  string
+		expected map[string]string
+		wantErr  bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "multiple headers",
+			headers:  "X-API-Key=secret, x-tenant = mesh=1",
+			expected: map[string]string{"x-api-key": "secret", "x-tenant": "mesh=1"},
+		},
+		{
+			name:    "missing value",
+			headers: "x-api-key",
+			wantErr: true,
+		},
+		{
+			name:    "missing key",
+			headers: "=secret",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		result, err := parseCAHeaders(tt.headers)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Test %s failed, unexpected error: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("Test %s failed, expected: %v got: %v", tt.name, tt.expected, result)
+		}
+	}
+}
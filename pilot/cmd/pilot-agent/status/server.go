@@ -38,6 +38,8 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/expfmt"
 	"go.opencensus.io/stats/view"
+	"google.golang.org/grpc"
+	ghc "google.golang.org/grpc/health/grpc_health_v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"istio.io/istio/pilot/cmd/pilot-agent/metrics"
@@ -54,7 +56,7 @@ const (
 	// quitPath is to notify the pilot agent to quit.
 	quitPath = "/quitquitquit"
 	// KubeAppProberEnvName is the name of the command line flag for pilot agent to pass app prober config.
-	// The json encoded string to pass app HTTP probe information from injector(istioctl or webhook).
+	// The json encoded string to pass app HTTP, TCP and gRPC probe information from injector(istioctl or webhook).
 	// For example, ISTIO_KUBE_APP_PROBERS='{"/app-health/httpbin/livez":{"httpGet":{"path": "/hello", "port": 8080}}.
 	// indicates that httpbin container liveness prober port is 8080 and probing path is /hello.
 	// This environment variable should never be set manually.
@@ -62,6 +64,10 @@ const (
 
 	localHostIPv4 = "127.0.0.1"
 	localHostIPv6 = "[::1]"
+
+	// defaultProbeTimeout is the timeout of TCP and gRPC probes without timeoutSeconds, matching the
+	// Kubernetes default.
+	defaultProbeTimeout = time.Second
 )
 
 var (
@@ -86,10 +92,20 @@ var (
 // container "hello-world".
 type KubeAppProbers map[string]*Prober
 
-// Prober represents a single container prober
+// Prober represents a single container prober. Exactly one of HTTPGet, TCPSocket and GRPC is set.
 type Prober struct {
-	HTTPGet        *apimirror.HTTPGetAction `json:"httpGet"`
-	TimeoutSeconds int32                    `json:"timeoutSeconds,omitempty"`
+	HTTPGet        *apimirror.HTTPGetAction   `json:"httpGet,omitempty"`
+	TCPSocket      *apimirror.TCPSocketAction `json:"tcpSocket,omitempty"`
+	GRPC           *apimirror.GRPCAction      `json:"grpc,omitempty"`
+	TimeoutSeconds int32                      `json:"timeoutSeconds,omitempty"`
+}
+
+// timeout returns the timeout of the probe, or the Kubernetes default if not set.
+func (p *Prober) timeout() time.Duration {
+	if p.TimeoutSeconds > 0 {
+		return time.Duration(p.TimeoutSeconds) * time.Second
+	}
+	return defaultProbeTimeout
 }
 
 // Options for the status server.
@@ -114,6 +130,7 @@ type Server struct {
 	appProbersDestination string
 	appKubeProbers        KubeAppProbers
 	appProbeClient        map[string]*http.Client
+	appProbeDialer        *net.Dialer
 	statusPort            uint16
 	lastProbeSuccessful   bool
 	envoyStatsPort        int
@@ -188,24 +205,24 @@ func NewServer(config Options) (*Server, error) {
 		return nil, fmt.Errorf("failed to decode app prober err = %v, json string = %v", err, config.KubeAppProbers)
 	}
 
+	localAddr := upstreamLocalAddressIPv4
+	if config.IPv6 {
+		localAddr = upstreamLocalAddressIPv6
+	}
+	s.appProbeDialer = &net.Dialer{
+		LocalAddr: localAddr,
+	}
 	s.appProbeClient = make(map[string]*http.Client, len(s.appKubeProbers))
 	// Validate the map key matching the regex pattern.
 	for path, prober := range s.appKubeProbers {
 		if !appProberPattern.Match([]byte(path)) {
 			return nil, fmt.Errorf(`invalid key, must be in form of regex pattern ^/app-health/[^\/]+/(livez|readyz)$`)
 		}
-		if prober.HTTPGet == nil {
-			return nil, fmt.Errorf(`invalid prober type, must be of type httpGet`)
-		}
-		if prober.HTTPGet.Port.Type != intstr.Int {
-			return nil, fmt.Errorf("invalid prober config for %v, the port must be int type", path)
-		}
-		localAddr := upstreamLocalAddressIPv4
-		if config.IPv6 {
-			localAddr = upstreamLocalAddressIPv6
+		if err := validateProber(prober); err != nil {
+			return nil, fmt.Errorf("invalid prober config for %v: %v", path, err)
 		}
-		d := &net.Dialer{
-			LocalAddr: localAddr,
+		if prober.HTTPGet == nil {
+			continue
 		}
 		// Construct a http client and cache it in order to reuse the connection.
 		s.appProbeClient[path] = &http.Client{
@@ -214,7 +231,7 @@ func NewServer(config Options) (*Server, error) {
 			// https://kubernetes.io/docs/tasks/configure-pod-container/configure-liveness-readiness-probes/#configure-probes
 			Transport: &http.Transport{
 				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-				DialContext:     d.DialContext,
+				DialContext:     s.appProbeDialer.DialContext,
 			},
 		}
 	}
@@ -222,6 +239,36 @@ func NewServer(config Options) (*Server, error) {
 	return s, nil
 }
 
+// validateProber checks the prober has exactly one supported action, using a resolved port.
+func validateProber(prober *Prober) error {
+	if prober == nil {
+		return fmt.Errorf("invalid prober type, must be one of httpGet, tcpSocket or grpc")
+	}
+	actions := 0
+	if prober.HTTPGet != nil {
+		actions++
+		if prober.HTTPGet.Port.Type != intstr.Int {
+			return fmt.Errorf("the port must be int type")
+		}
+	}
+	if prober.TCPSocket != nil {
+		actions++
+		if prober.TCPSocket.Port.Type != intstr.Int {
+			return fmt.Errorf("the port must be int type")
+		}
+	}
+	if prober.GRPC != nil {
+		actions++
+		if prober.GRPC.Port <= 0 || prober.GRPC.Port > 65535 {
+			return fmt.Errorf("invalid grpc port %d", prober.GRPC.Port)
+		}
+	}
+	if actions != 1 {
+		return fmt.Errorf("invalid prober type, must be one of httpGet, tcpSocket or grpc")
+	}
+	return nil
+}
+
 // FormatProberURL returns a set of HTTP URLs that pilot agent will serve to take over Kubernetes
 // app probers.
 func FormatProberURL(container string) (string, string, string) {
@@ -519,6 +566,15 @@ func (s *Server) handleAppProbe(w http.ResponseWriter, req *http.Request) {
 		_, _ = w.Write([]byte(fmt.Sprintf("app prober config does not exists for %v", path)))
 		return
 	}
+	switch {
+	case prober.TCPSocket != nil:
+		s.handleAppProbeTCPSocket(w, path, prober)
+		return
+	case prober.GRPC != nil:
+		s.handleAppProbeGRPC(w, req, path, prober)
+		return
+	}
+
 	// get the http client must exist because
 	httpClient := s.appProbeClient[path]
 
@@ -572,6 +628,71 @@ func (s *Server) handleAppProbe(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(response.StatusCode)
 }
 
+// handleAppProbeTCPSocket probes the application by opening a TCP connection, like the kubelet does for
+// tcpSocket probes.
+func (s *Server) handleAppProbeTCPSocket(w http.ResponseWriter, path string, prober *Prober) {
+	addr := net.JoinHostPort(s.appProbeHost(prober.TCPSocket.Host), strconv.Itoa(prober.TCPSocket.Port.IntValue()))
+	ctx, cancel := context.WithTimeout(context.Background(), prober.timeout())
+	defer cancel()
+	conn, err := s.appProbeDialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		log.Errorf("TCP probe of app failed: %v, original URL path = %v\napp address = %v", err, path, addr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_ = conn.Close()
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleAppProbeGRPC probes the application with the gRPC health checking protocol, like the kubelet does
+// for grpc probes. Only the SERVING status is reported as healthy.
+func (s *Server) handleAppProbeGRPC(w http.ResponseWriter, req *http.Request, path string, prober *Prober) {
+	addr := net.JoinHostPort(s.appProbeHost(prober.GRPC.Host), strconv.Itoa(int(prober.GRPC.Port)))
+	ctx, cancel := context.WithTimeout(req.Context(), prober.timeout())
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, addr,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return s.appProbeDialer.DialContext(ctx, "tcp", addr)
+		}),
+		// Forward the user agent of the prober, so that the application sees the requests from the kubelet.
+		grpc.WithUserAgent(req.UserAgent()))
+	if err != nil {
+		log.Errorf("Failed to connect to app for gRPC probe: %v, original URL path = %v\napp address = %v", err, path, addr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	var service string
+	if prober.GRPC.Service != nil {
+		service = *prober.GRPC.Service
+	}
+	resp, err := ghc.NewHealthClient(conn).Check(ctx, &ghc.HealthCheckRequest{Service: service})
+	if err != nil {
+		log.Errorf("gRPC probe of app failed: %v, original URL path = %v\napp address = %v", err, path, addr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if resp.GetStatus() != ghc.HealthCheckResponse_SERVING {
+		log.Warnf("gRPC probe of app returned %v, original URL path = %v\napp address = %v", resp.GetStatus(), path, addr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// appProbeHost returns the host the TCP and gRPC probes connect to: the host of the probe if set, like the
+// kubelet, or the pod.
+func (s *Server) appProbeHost(host string) string {
+	if host != "" {
+		return host
+	}
+	return strings.Trim(s.appProbersDestination, "[]")
+}
+
 // notifyExit sends SIGTERM to itself
 func notifyExit() {
 	p, err := os.FindProcess(os.Getpid())
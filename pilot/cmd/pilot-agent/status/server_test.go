@@ -31,6 +31,9 @@ import (
 	"time"
 
 	"github.com/prometheus/common/expfmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	ghc "google.golang.org/grpc/health/grpc_health_v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"istio.io/istio/pilot/cmd/pilot-agent/status/ready"
@@ -85,9 +88,29 @@ func TestNewServer(t *testing.T) {
 		},
 		// invalid probe type
 		{
-			probe: `{"/app-health/hello-world/readyz": {"tcpSocket": {"port": "8888"}}}`,
+			probe: `{"/app-health/hello-world/readyz": {"exec": {"command": ["cat", "/tmp/healthy"]}}}`,
 			err:   "invalid prober type",
 		},
+		// more than one probe type
+		{
+			probe: `{"/app-health/hello-world/readyz": {"httpGet": {"port": 8080}, "tcpSocket": {"port": 8080}}}`,
+			err:   "invalid prober type",
+		},
+		// TCP port is not Int typed.
+		{
+			probe: `{"/app-health/hello-world/readyz": {"tcpSocket": {"port": "8888"}}}`,
+			err:   "must be int type",
+		},
+		// gRPC port is not set.
+		{
+			probe: `{"/app-health/hello-world/readyz": {"grpc": {"service": "hello"}}}`,
+			err:   "invalid grpc port",
+		},
+		// A valid TCP and gRPC input.
+		{
+			probe: `{"/app-health/hello-world/readyz": {"tcpSocket": {"port": 8080}},` +
+				`"/app-health/business/livez": {"grpc": {"port": 9090, "service": "business"}}}`,
+		},
 		// Port is not Int typed.
 		{
 			probe: `{"/app-health/hello-world/readyz": {"httpGet": {"path": "/hello/sunnyvale", "port": "container-port-dontknow"}}}`,
@@ -483,6 +506,141 @@ func TestAppProbe(t *testing.T) {
 	}
 }
 
+func TestTCPAndGRPCAppProbe(t *testing.T) {
+	// Starts a gRPC application serving the health checking protocol.
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("failed to allocate unused port %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("serving", ghc.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("not-serving", ghc.HealthCheckResponse_NOT_SERVING)
+	ghc.RegisterHealthServer(grpcServer, healthServer)
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+	appPort := listener.Addr().(*net.TCPAddr).Port
+
+	// A port nothing listens on.
+	closed, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("failed to allocate unused port %v", err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	service := func(s string) *string {
+		return &s
+	}
+	config := KubeAppProbers{
+		"/app-health/tcp/readyz": &Prober{
+			TCPSocket: &apimirror.TCPSocketAction{Port: intstr.FromInt(appPort)},
+		},
+		"/app-health/tcp/livez": &Prober{
+			TCPSocket: &apimirror.TCPSocketAction{Port: intstr.FromInt(closedPort)},
+		},
+		"/app-health/grpc/readyz": &Prober{
+			GRPC: &apimirror.GRPCAction{Port: int32(appPort)},
+		},
+		"/app-health/grpc/livez": &Prober{
+			GRPC: &apimirror.GRPCAction{Port: int32(appPort), Service: service("serving")},
+		},
+		"/app-health/grpc/startupz": &Prober{
+			GRPC: &apimirror.GRPCAction{Port: int32(appPort), Service: service("not-serving")},
+		},
+		"/app-health/unknown-service/readyz": &Prober{
+			GRPC: &apimirror.GRPCAction{Port: int32(appPort), Service: service("unknown")},
+		},
+		"/app-health/not-grpc/readyz": &Prober{
+			GRPC: &apimirror.GRPCAction{Port: int32(closedPort)},
+		},
+	}
+	appProber, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("invalid app probers")
+	}
+	server, err := NewServer(Options{
+		StatusPort:     0,
+		KubeAppProbers: string(appProber),
+	})
+	if err != nil {
+		t.Fatalf("failed to create status server %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Run(ctx)
+
+	var statusPort uint16
+	if err := retry.UntilSuccess(func() error {
+		server.mutex.RLock()
+		statusPort = server.statusPort
+		server.mutex.RUnlock()
+		if statusPort == 0 {
+			return fmt.Errorf("no port allocated")
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to getport: %v", err)
+	}
+
+	testCases := []struct {
+		probePath  string
+		statusCode int
+	}{
+		{"app-health/tcp/readyz", http.StatusOK},
+		{"app-health/tcp/livez", http.StatusInternalServerError},
+		{"app-health/grpc/readyz", http.StatusOK},
+		{"app-health/grpc/livez", http.StatusOK},
+		{"app-health/grpc/startupz", http.StatusInternalServerError},
+		{"app-health/unknown-service/readyz", http.StatusInternalServerError},
+		{"app-health/not-grpc/readyz", http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.probePath, func(t *testing.T) {
+			resp, err := http.Get(fmt.Sprintf("http://localhost:%v/%s", statusPort, tc.probePath))
+			if err != nil {
+				t.Fatal("request failed: ", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.statusCode {
+				t.Errorf("[%v] unexpected status code, want = %v, got = %v", tc.probePath, tc.statusCode, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestGRPCAppProbeHost(t *testing.T) {
+	// The application only listens on the loopback interface.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to allocate unused port %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	ghc.RegisterHealthServer(grpcServer, health.NewServer())
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+	appPort := int32(listener.Addr().(*net.TCPAddr).Port)
+
+	// The pod IP is not reachable, so only the probes connecting to the loopback interface succeed.
+	server := &Server{appProbersDestination: "192.0.2.1", appProbeDialer: &net.Dialer{}}
+	for _, tc := range []struct {
+		host       string
+		statusCode int
+	}{
+		{"127.0.0.1", http.StatusOK},
+		{"", http.StatusInternalServerError},
+	} {
+		t.Run(tc.host, func(t *testing.T) {
+			prober := &Prober{GRPC: &apimirror.GRPCAction{Port: appPort, Host: tc.host}, TimeoutSeconds: 1}
+			rr := httptest.NewRecorder()
+			server.handleAppProbeGRPC(rr, httptest.NewRequest(http.MethodGet, "/app-health/grpc/readyz", nil), "/app-health/grpc/readyz", prober)
+			if rr.Code != tc.statusCode {
+				t.Errorf("unexpected status code, want = %v, got = %v", tc.statusCode, rr.Code)
+			}
+		})
+	}
+}
+
 func TestHttpsAppProbe(t *testing.T) {
 	// Starts the application first.
 	listener, err := net.Listen("tcp", ":0")
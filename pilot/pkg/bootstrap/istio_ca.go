@@ -27,22 +27,31 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 
 	"istio.io/api/security/v1beta1"
 	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/leaderelection"
+	"istio.io/istio/pilot/pkg/model"
 	securityModel "istio.io/istio/pilot/pkg/security/model"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
+	tb "istio.io/istio/pilot/pkg/trustbundle"
+	"istio.io/istio/pilot/pkg/xds"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/jwt"
 	kubelib "istio.io/istio/pkg/kube"
+	"istio.io/istio/pkg/kube/configmapwatcher"
 	"istio.io/istio/pkg/security"
 	"istio.io/istio/security/pkg/cmd"
+	"istio.io/istio/security/pkg/k8s/csrsigner"
 	"istio.io/istio/security/pkg/pki/ca"
 	"istio.io/istio/security/pkg/pki/ra"
 	caserver "istio.io/istio/security/pkg/server/ca"
+	"istio.io/istio/security/pkg/server/ca/audit"
 	"istio.io/istio/security/pkg/server/ca/authenticate"
 	"istio.io/pkg/env"
 	"istio.io/pkg/log"
@@ -55,6 +64,7 @@ type caOptions struct {
 	// domain to use in SPIFFE identity URLs
 	TrustDomain    string
 	Namespace      string
+	PodName        string
 	Authenticators []security.Authenticator
 }
 
@@ -139,6 +149,49 @@ var (
 	// TODO: Likely to be removed and added to mesh config
 	k8sSigner = env.RegisterStringVar("K8S_SIGNER", "",
 		"Kubernates CA Signer type. Valid from Kubernates 1.18").Get()
+
+	pluggedCACertCheckInterval = env.RegisterDurationVar("PLUGGED_CA_CERT_CHECK_INTERVAL", 0,
+		"The interval istiod checks the plugged-in CA certificates for a rotation to a new root, disabled if 0. "+
+			"New roots are distributed along with the old ones, the CA signs with the new certificates after "+
+			"PLUGGED_CA_ROOT_SOAK_PERIOD, and the old roots are dropped after PLUGGED_CA_OLD_ROOT_GRACE_PERIOD. "+
+			"The leader istiod runs the rotation, and saves its progress in the istio-ca-rotation ConfigMap.")
+
+	pluggedCARootSoakPeriod = env.RegisterDurationVar("PLUGGED_CA_ROOT_SOAK_PERIOD", 48*time.Hour,
+		"The time new plugged-in CA roots are distributed before the CA signs with the new certificates. "+
+			"It should be longer than the workload certificate TTL.")
+
+	pluggedCAOldRootGracePeriod = env.RegisterDurationVar("PLUGGED_CA_OLD_ROOT_GRACE_PERIOD", 48*time.Hour,
+		"The time the old plugged-in CA roots are distributed after the CA signs with the new certificates. "+
+			"It should be longer than the workload certificate TTL.")
+
+	caAuditLogFile = env.RegisterStringVar("CA_AUDIT_LOG_FILE", "",
+		"If set, the certificate signing requests handled by the CA are written to this file, as JSON lines.")
+
+	caAuditLogMaxSize = env.RegisterIntVar("CA_AUDIT_LOG_MAX_SIZE_MB", 100,
+		"The size in megabytes of the CA audit log file before it is rotated.")
+
+	caAuditLogMaxBackups = env.RegisterIntVar("CA_AUDIT_LOG_MAX_BACKUPS", 10,
+		"The maximum number of rotated CA audit log files to keep, all if 0.")
+
+	caAuditLogMaxAge = env.RegisterIntVar("CA_AUDIT_LOG_MAX_AGE_DAYS", 30,
+		"The maximum number of days to keep the rotated CA audit log files, forever if 0.")
+
+	caAuditLogEndpoint = env.RegisterStringVar("CA_AUDIT_LOG_HTTP_ENDPOINT", "",
+		"If set, the certificate signing requests handled by the CA are posted to this URL, as batches of JSON lines.")
+
+	caAuditLogRecentSize = env.RegisterIntVar("CA_AUDIT_LOG_RECENT_SIZE", 1000,
+		"The number of recent certificate signing requests kept in memory and listed by the /debug/ca_auditz "+
+			"endpoint, 0 to disable the CA audit log.")
+
+	csrSignerNames = env.RegisterStringVar("CSR_SIGNER_NAMES", "",
+		"Comma separated list of signer names of the Kubernetes CertificateSigningRequests signed by the Istio CA, "+
+			"for example istio.io/mesh. Istiod is only allowed to sign for signer names in the istio.io domain "+
+			"by default.")
+	csrSignerAutoApprove = env.RegisterBoolVar("CSR_SIGNER_AUTO_APPROVE", false,
+		"If enabled, the CertificateSigningRequests of the CSR_SIGNER_NAMES signers requesting the identity "+
+			"of their service account are approved, and the others denied. Otherwise, the default, they must be "+
+			"approved by another approver, as any principal allowed to create CSRs for these signers would get "+
+			"mesh certificates.")
 )
 
 // EnableCA returns whether CA functionality is enabled in istiod.
@@ -201,6 +254,7 @@ func (s *Server) RunCA(grpc *grpc.Server, ca caserver.CertificateAuthority, opts
 	if startErr != nil {
 		log.Fatalf("failed to create istio ca server: %v", startErr)
 	}
+	caServer.AuditLog = s.XDSServer.CAAuditLog
 
 	// TODO: if not set, parse Istiod's own token (if present) and get the issuer. The same issuer is used
 	// for all tokens - no need to configure twice. The token may also include cluster info to auto-configure
@@ -396,6 +450,18 @@ func (s *Server) createIstioCA(client corev1.CoreV1Interface, opts *caOptions) (
 		if err != nil {
 			return nil, fmt.Errorf("failed to create an istiod CA: %v", err)
 		}
+		if _, err := os.Stat(signingKeyFile); err == nil {
+			caOpts.PluggedCertRotatorConfig = &ca.PluggedCertRotatorConfig{
+				CertDir:            LocalCertDir.Get(),
+				CheckInterval:      pluggedCACertCheckInterval.Get(),
+				SoakPeriod:         pluggedCARootSoakPeriod.Get(),
+				OldRootGracePeriod: pluggedCAOldRootGracePeriod.Get(),
+				OnRootsChanged:     s.onCARootsChanged,
+			}
+			if client != nil {
+				caOpts.PluggedCertRotatorConfig.Store = ca.NewConfigMapPluggedCertRotationStore(client, opts.Namespace)
+			}
+		}
 	}
 	istioCA, err := ca.NewIstioCA(caOpts)
 	if err != nil {
@@ -408,9 +474,42 @@ func (s *Server) createIstioCA(client corev1.CoreV1Interface, opts *caOptions) (
 	rootCertRotatorChan := make(chan struct{})
 	// Start root cert rotator in a separate goroutine.
 	istioCA.Run(rootCertRotatorChan)
+	if rotator := istioCA.PluggedCertRotator(); rotator != nil {
+		s.XDSServer.CARootRotator = rotator
+		s.addStartFunc(func(stop <-chan struct{}) error {
+			if s.kubeClient == nil {
+				go rotator.Lead(stop)
+				return nil
+			}
+			// The replicas follow the rotation saved by the leader.
+			go leaderelection.
+				NewLeaderElection(opts.Namespace, opts.PodName, leaderelection.PluggedCARotator, s.kubeClient).
+				AddRunFunction(rotator.Lead).
+				Run(stop)
+			return nil
+		})
+	}
 	return istioCA, nil
 }
 
+// onCARootsChanged distributes the roots and signing certificate of the CA after a rotation of the plugged-in
+// certificates. The istio-ca-root-cert ConfigMaps are updated by the namespace controller on its next resync.
+func (s *Server) onCARootsChanged() {
+	if features.MultiRootMesh.Get() {
+		rootCerts := []string{string(s.CA.GetCAKeyCertBundle().GetRootCertPem())}
+		if err := s.workloadTrustBundle.UpdateTrustAnchor(&tb.TrustAnchorUpdate{
+			TrustAnchorConfig: tb.TrustAnchorConfig{Certs: rootCerts},
+			Source:            tb.SourceIstioCA,
+		}); err != nil {
+			log.Errorf("failed to update the CA roots in the trust bundle: %v", err)
+		}
+	}
+	s.XDSServer.ConfigUpdate(&model.PushRequest{
+		Full:   true,
+		Reason: []model.TriggerReason{model.GlobalUpdate},
+	})
+}
+
 // createIstioRA initializes the Istio RA signing functionality.
 // the caOptions defines the external provider
 func (s *Server) createIstioRA(client kubelib.Client,
@@ -445,3 +544,117 @@ func getJwtPath() string {
 		return ""
 	}
 }
+
+// initCARevocations watches the revocations of the CA and pushes the CRL to the proxies when they change. The
+// CRL is also pushed before its next update, while certificates are revoked.
+func (s *Server) initCARevocations(namespace string) {
+	if s.CA == nil || s.kubeClient == nil {
+		return
+	}
+	s.XDSServer.Generators[v3.CRLType] = &xds.CrlGenerator{CRL: s.CA.CRL}
+	// Only the CRL generator handles the pushes of the CRL, the other types and the XDS cache are left untouched.
+	pushCRL := func() {
+		s.XDSServer.ConfigUpdate(&model.PushRequest{
+			Full: true,
+			ConfigsUpdated: map[model.ConfigKey]struct{}{{
+				Kind:      xds.CRLKind,
+				Name:      ca.RevocationsConfigMap,
+				Namespace: namespace,
+			}: {}},
+			Reason: []model.TriggerReason{model.ConfigUpdate},
+		})
+	}
+
+	c := configmapwatcher.NewController(s.kubeClient, namespace, ca.RevocationsConfigMap, func(cm *v1.ConfigMap) {
+		var revocations []ca.Revocation
+		var parentCRLs []byte
+		if cm != nil {
+			var err error
+			if revocations, err = ca.ParseRevocations(cm.Data[ca.RevocationsConfigMapKey]); err != nil {
+				// Keep the last known revocations in case there's a misconfiguration issue.
+				log.Errorf("failed to read the CA revocations from ConfigMap %s/%s: %v", namespace, ca.RevocationsConfigMap, err)
+				return
+			}
+			parentCRLs = []byte(cm.Data[ca.ParentCRLConfigMapKey])
+		}
+		hadRevocations := s.CA.HasRevocations()
+		s.CA.SetRevocations(revocations, parentCRLs)
+		if len(revocations) > 0 {
+			if _, err := s.CA.CRL(); err != nil {
+				log.Errorf("failed to generate the CRL: %v", err)
+			}
+		}
+		if hadRevocations || len(revocations) > 0 {
+			log.Infof("CA revocations updated, %d entries", len(revocations))
+			pushCRL()
+		}
+	})
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go c.Run(stop)
+		go func() {
+			ticker := time.NewTicker(ca.CRLValidity / 2)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if s.CA.HasRevocations() {
+						pushCRL()
+					}
+				case <-stop:
+					return
+				}
+			}
+		}()
+		return nil
+	})
+}
+
+// initCAAuditLog creates the audit log of the certificate signing requests handled by the CA, listed by the
+// /debug/ca_auditz endpoint and written to the configured file and HTTP endpoint.
+func (s *Server) initCAAuditLog() {
+	opts := audit.Options{
+		FileOptions: audit.FileOptions{
+			Path:       caAuditLogFile.Get(),
+			MaxSizeMB:  caAuditLogMaxSize.Get(),
+			MaxBackups: caAuditLogMaxBackups.Get(),
+			MaxAgeDays: caAuditLogMaxAge.Get(),
+		},
+		HTTPEndpoint: caAuditLogEndpoint.Get(),
+		RecentSize:   caAuditLogRecentSize.Get(),
+	}
+	if opts.RecentSize <= 0 && opts.Path == "" && opts.HTTPEndpoint == "" {
+		return
+	}
+	auditLog := audit.NewFromOptions(opts)
+	s.XDSServer.CAAuditLog = auditLog
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go func() {
+			<-stop
+			if err := auditLog.Close(); err != nil {
+				log.Warnf("failed to close the CA audit log: %v", err)
+			}
+		}()
+		return nil
+	})
+}
+
+// initCSRSigner starts the signer of the Kubernetes CertificateSigningRequests of the configured signer names, if
+// any, while this istiod is the leader.
+func (s *Server) initCSRSigner(opts *caOptions) {
+	if csrSignerNames.Get() == "" || s.kubeClient == nil || s.CA == nil {
+		return
+	}
+	signer := csrsigner.NewController(s.kubeClient, s.CA, csrsigner.Options{
+		SignerNames: strings.Split(csrSignerNames.Get(), ","),
+		TrustDomain: opts.TrustDomain,
+		CertTTL:     workloadCertTTL.Get(),
+		AutoApprove: csrSignerAutoApprove.Get(),
+	})
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go leaderelection.
+			NewLeaderElection(opts.Namespace, opts.PodName, leaderelection.CSRSigner, s.kubeClient).
+			AddRunFunction(signer.Run).
+			Run(stop)
+		return nil
+	})
+}
@@ -36,6 +36,9 @@ type RegistryOptions struct {
 
 	Registries []string
 
+	// ServiceFileDir is the directory of service definition files of the File registry.
+	ServiceFileDir string
+
 	// Kubernetes controller options
 	KubeOptions kubecontroller.Options
 	// ClusterRegistriesNamespace specifies where the multi-cluster secret resides
@@ -244,6 +244,7 @@ func NewServer(args *PilotArgs, initFuncs ...func(*Server)) (*Server, error) {
 	caOpts := &caOptions{
 		TrustDomain:    s.environment.Mesh().TrustDomain,
 		Namespace:      args.Namespace,
+		PodName:        args.PodName,
 		ExternalCAType: ra.CaExternalType(externalCaType),
 	}
 
@@ -1119,6 +1120,9 @@ func (s *Server) maybeCreateCA(caOpts *caOptions) error {
 		if s.CA, err = s.createIstioCA(corev1, caOpts); err != nil {
 			return fmt.Errorf("failed to create CA: %v", err)
 		}
+		s.initCARevocations(caOpts.Namespace)
+		s.initCAAuditLog()
+		s.initCSRSigner(caOpts)
 		if caOpts.ExternalCAType != "" {
 			if s.RA, err = s.createIstioRA(s.kubeClient, caOpts); err != nil {
 				return fmt.Errorf("failed to create RA: %v", err)
@@ -20,6 +20,7 @@ import (
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/serviceregistry"
 	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
+	"istio.io/istio/pilot/pkg/serviceregistry/file"
 	kubecontroller "istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
 	"istio.io/istio/pilot/pkg/serviceregistry/mock"
 	"istio.io/istio/pilot/pkg/serviceregistry/serviceentry"
@@ -54,6 +55,10 @@ func (s *Server) initServiceControllers(args *PilotArgs) error {
 			}
 		case serviceregistry.Mock:
 			s.initMockRegistry()
+		case serviceregistry.File:
+			if err := s.initFileRegistry(args); err != nil {
+				return err
+			}
 		default:
 			return fmt.Errorf("service registry %s is not supported", r)
 		}
@@ -114,6 +119,19 @@ func (s *Server) initKubeRegistry(args *PilotArgs) (err error) {
 	return
 }
 
+// initFileRegistry creates the registry of the services defined in the files of ServiceFileDir.
+func (s *Server) initFileRegistry(args *PilotArgs) error {
+	if args.RegistryOptions.ServiceFileDir == "" {
+		return fmt.Errorf("%s registry requires --serviceFileDir", serviceregistry.File)
+	}
+	s.ServiceController().AddRegistry(file.NewController(file.Options{
+		Root:       args.RegistryOptions.ServiceFileDir,
+		ClusterID:  s.clusterID,
+		XDSUpdater: s.XDSServer,
+	}))
+	return nil
+}
+
 func (s *Server) initMockRegistry() {
 	// MemServiceDiscovery implementation
 	discovery := mock.NewDiscovery(map[host.Name]*model.Service{}, 2)
@@ -0,0 +1,172 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/miekg/dns"
+)
+
+const (
+	// maxUpstreamCacheTTL caps the time upstream responses are cached, so that changes of external
+	// names are picked up even if the upstream server returns long TTLs.
+	maxUpstreamCacheTTL = 5 * time.Minute
+)
+
+type upstreamCacheKey struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+	// DNSSEC records are only returned when requested
+	dnssec bool
+}
+
+type upstreamCacheEntry struct {
+	response *dns.Msg
+	stored   time.Time
+	expires  time.Time
+}
+
+// upstreamCache is a bounded cache of the responses of the upstream DNS servers, including negative
+// responses (NXDOMAIN, or no records of the requested type). The responses are cached for their TTL,
+// as defined by RFC 2308 for negative responses.
+type upstreamCache struct {
+	mu    sync.Mutex
+	cache simplelru.LRUCache
+	// now is overridden in tests.
+	now func() time.Time
+}
+
+func newUpstreamCache(size int) *upstreamCache {
+	cache, err := simplelru.NewLRU(size, nil)
+	if err != nil {
+		// Only happens for a non positive size, which the caller checks.
+		panic(err.Error())
+	}
+	return &upstreamCache{
+		cache: cache,
+		now:   time.Now,
+	}
+}
+
+func cacheKey(req *dns.Msg) upstreamCacheKey {
+	q := req.Question[0]
+	key := upstreamCacheKey{
+		name:   strings.ToLower(q.Name),
+		qtype:  q.Qtype,
+		qclass: q.Qclass,
+	}
+	if o := req.IsEdns0(); o != nil {
+		key.dnssec = o.Do()
+	}
+	return key
+}
+
+// get returns the cached response for the request, with the TTLs decremented by the time spent in the
+// cache, or nil if there is no valid cached response.
+func (c *upstreamCache) get(req *dns.Msg) *dns.Msg {
+	key := cacheKey(req)
+	now := c.now()
+	c.mu.Lock()
+	v, ok := c.cache.Get(key)
+	if ok && !now.Before(v.(*upstreamCacheEntry).expires) {
+		c.cache.Remove(key)
+		ok = false
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	entry := v.(*upstreamCacheEntry)
+
+	response := entry.response.Copy()
+	response.Id = req.Id
+	// Keep the case of the question of the request.
+	response.Question = req.Question
+	elapsed := uint32(now.Sub(entry.stored) / time.Second)
+	for _, section := range [][]dns.RR{response.Answer, response.Ns, response.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			if rr.Header().Ttl > elapsed {
+				rr.Header().Ttl -= elapsed
+			} else {
+				rr.Header().Ttl = 0
+			}
+		}
+	}
+	return response
+}
+
+// set caches the upstream response for the request, if it is cacheable.
+func (c *upstreamCache) set(req *dns.Msg, response *dns.Msg) {
+	ttl, ok := cacheTTL(response)
+	if !ok {
+		return
+	}
+	now := c.now()
+	entry := &upstreamCacheEntry{
+		response: response.Copy(),
+		stored:   now,
+		expires:  now.Add(ttl),
+	}
+	c.mu.Lock()
+	c.cache.Add(cacheKey(req), entry)
+	c.mu.Unlock()
+}
+
+// cacheTTL returns how long the response can be cached. Only complete successful and NXDOMAIN
+// responses are cached: server failures are transient, and truncated responses must be retried
+// over TCP.
+func cacheTTL(response *dns.Msg) (time.Duration, bool) {
+	if response.Truncated || (response.Rcode != dns.RcodeSuccess && response.Rcode != dns.RcodeNameError) {
+		return 0, false
+	}
+	var ttl uint32
+	found := false
+	minTTL := func(t uint32) {
+		if !found || t < ttl {
+			ttl = t
+		}
+		found = true
+	}
+	if response.Rcode == dns.RcodeSuccess && len(response.Answer) > 0 {
+		for _, rr := range response.Answer {
+			minTTL(rr.Header().Ttl)
+		}
+	} else {
+		// Negative response: the TTL is the minimum of the SOA record TTL and its MINIMUM field.
+		// Without SOA, negative responses must not be cached.
+		for _, rr := range response.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				minTTL(soa.Hdr.Ttl)
+				minTTL(soa.Minttl)
+			}
+		}
+	}
+	if !found || ttl == 0 {
+		return 0, false
+	}
+	d := time.Duration(ttl) * time.Second
+	if d > maxUpstreamCacheTTL {
+		d = maxUpstreamCacheTTL
+	}
+	return d, true
+}
@@ -0,0 +1,196 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/atomic"
+
+	nds "istio.io/istio/pilot/pkg/proto"
+)
+
+func soa(ttl, minTTL uint32) dns.RR {
+	return &dns.SOA{
+		Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+		Ns:     "ns.example.com.",
+		Mbox:   "admin.example.com.",
+		Minttl: minTTL,
+	}
+}
+
+func aRecord(host string, ttl uint32) dns.RR {
+	r := a(host, []net.IP{net.ParseIP("1.2.3.4").To4()})[0]
+	r.Header().Ttl = ttl
+	return r
+}
+
+func TestCacheTTL(t *testing.T) {
+	cases := []struct {
+		name     string
+		response *dns.Msg
+		want     time.Duration
+		cached   bool
+	}{
+		{
+			name:     "positive response uses the minimum TTL",
+			response: &dns.Msg{Answer: []dns.RR{aRecord("a.", 60), aRecord("a.", 20)}},
+			want:     20 * time.Second,
+			cached:   true,
+		},
+		{
+			name:     "TTL is capped",
+			response: &dns.Msg{Answer: []dns.RR{aRecord("a.", 86400)}},
+			want:     maxUpstreamCacheTTL,
+			cached:   true,
+		},
+		{
+			name:     "NXDOMAIN uses the SOA minimum",
+			response: &dns.Msg{MsgHdr: dns.MsgHdr{Rcode: dns.RcodeNameError}, Ns: []dns.RR{soa(300, 30)}},
+			want:     30 * time.Second,
+			cached:   true,
+		},
+		{
+			name:     "no data uses the SOA TTL",
+			response: &dns.Msg{Ns: []dns.RR{soa(10, 30)}},
+			want:     10 * time.Second,
+			cached:   true,
+		},
+		{
+			name:     "NXDOMAIN without SOA",
+			response: &dns.Msg{MsgHdr: dns.MsgHdr{Rcode: dns.RcodeNameError}},
+		},
+		{
+			name:     "server failure",
+			response: &dns.Msg{MsgHdr: dns.MsgHdr{Rcode: dns.RcodeServerFailure}, Ns: []dns.RR{soa(10, 30)}},
+		},
+		{
+			name:     "truncated",
+			response: &dns.Msg{MsgHdr: dns.MsgHdr{Truncated: true}, Answer: []dns.RR{aRecord("a.", 60)}},
+		},
+		{
+			name:     "zero TTL",
+			response: &dns.Msg{Answer: []dns.RR{aRecord("a.", 0)}},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cached := cacheTTL(tt.response)
+			if cached != tt.cached || got != tt.want {
+				t.Fatalf("got %v (cached=%v), want %v (cached=%v)", got, cached, tt.want, tt.cached)
+			}
+		})
+	}
+}
+
+func TestUpstreamCache(t *testing.T) {
+	now := time.Now()
+	c := newUpstreamCache(2)
+	c.now = func() time.Time { return now }
+
+	req := new(dns.Msg).SetQuestion("www.example.com.", dns.TypeA)
+	response := new(dns.Msg).SetReply(req)
+	response.Answer = []dns.RR{aRecord("www.example.com.", 30)}
+	c.set(req, response)
+
+	// Lookups are case insensitive, and use the ID and question of the request.
+	now = now.Add(10 * time.Second)
+	req2 := new(dns.Msg).SetQuestion("WWW.example.com.", dns.TypeA)
+	got := c.get(req2)
+	if got == nil {
+		t.Fatal("expected cached response")
+	}
+	if got.Id != req2.Id || got.Question[0].Name != "WWW.example.com." {
+		t.Fatalf("unexpected response header %v", got)
+	}
+	if ttl := got.Answer[0].Header().Ttl; ttl != 20 {
+		t.Fatalf("expected TTL decremented to 20, got %d", ttl)
+	}
+	// The cached response is not modified.
+	if ttl := c.get(req).Answer[0].Header().Ttl; ttl != 20 {
+		t.Fatalf("expected TTL 20, got %d", ttl)
+	}
+
+	if c.get(new(dns.Msg).SetQuestion("www.example.com.", dns.TypeAAAA)) != nil {
+		t.Fatal("unexpected cached response for another type")
+	}
+
+	now = now.Add(20 * time.Second)
+	if c.get(req) != nil {
+		t.Fatal("expected the response to expire")
+	}
+
+	// The cache is bounded.
+	for _, host := range []string{"a.", "b.", "c."} {
+		r := new(dns.Msg).SetQuestion(host, dns.TypeA)
+		resp := new(dns.Msg).SetReply(r)
+		resp.Answer = []dns.RR{aRecord(host, 30)}
+		c.set(r, resp)
+	}
+	if c.get(new(dns.Msg).SetQuestion("a.", dns.TypeA)) != nil {
+		t.Fatal("expected the least recently used response to be evicted")
+	}
+	if c.get(new(dns.Msg).SetQuestion("c.", dns.TypeA)) == nil {
+		t.Fatal("expected cached response")
+	}
+}
+
+type recordingWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *recordingWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+func TestServeDNSCachesUpstream(t *testing.T) {
+	queries := atomic.NewInt32(0)
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", func(resp dns.ResponseWriter, msg *dns.Msg) {
+		queries.Inc()
+		answer := new(dns.Msg).SetReply(msg)
+		answer.Rcode = dns.RcodeNameError
+		answer.Ns = []dns.RR{soa(60, 60)}
+		_ = resp.WriteMsg(answer)
+	})
+	up := make(chan struct{})
+	server := &dns.Server{Addr: "127.0.0.1:0", Net: "udp", Handler: mux, NotifyStartedFunc: func() { close(up) }}
+	go server.ListenAndServe()
+	<-up
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	h := &LocalDNSServer{
+		resolvConfServers: []string{server.PacketConn.LocalAddr().String()},
+		upstreamCache:     newUpstreamCache(10),
+	}
+	h.UpdateLookupTable(&nds.NameTable{})
+	proxy := &dnsProxy{upstreamClient: &dns.Client{Net: "udp", Timeout: time.Second}, protocol: "udp"}
+
+	for i := 0; i < 3; i++ {
+		w := &recordingWriter{}
+		h.ServeDNS(proxy, w, new(dns.Msg).SetQuestion("missing.example.com.", dns.TypeA))
+		if w.msg == nil || w.msg.Rcode != dns.RcodeNameError {
+			t.Fatalf("expected NXDOMAIN, got %v", w.msg)
+		}
+	}
+	if got := queries.Load(); got != 1 {
+		t.Fatalf("expected a single upstream query, got %d", got)
+	}
+}
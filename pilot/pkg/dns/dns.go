@@ -16,6 +16,7 @@ package dns
 
 import (
 	"net"
+	"sort"
 	"strings"
 	"sync/atomic"
 
@@ -44,6 +45,9 @@ type LocalDNSServer struct {
 	// Optimizations to save space and time
 	proxyDomain      string
 	proxyDomainParts []string
+
+	// Cache of the upstream responses, nil if disabled
+	upstreamCache *upstreamCache
 }
 
 // Borrowed from https://github.com/coredns/coredns/blob/master/plugin/hosts/hostsfile.go
@@ -63,6 +67,11 @@ type LookupTable struct {
 	// The cname records here (comprised of different variants of the hosts above,
 	// expanded by the search namespaces) pointing to the actual host.
 	cname map[string][]dns.RR
+	// The SRV records of the service ports, keyed by _<port name>._<protocol>.<host>. The records of
+	// all the ports are also stored for the host itself.
+	srv map[string][]dns.RR
+	// The PTR records of the service and workload IPs, keyed by the reverse lookup name.
+	ptr map[string][]dns.RR
 }
 
 const (
@@ -72,10 +81,15 @@ const (
 	defaultTTLInSeconds = 30
 )
 
-func NewLocalDNSServer(proxyNamespace, proxyDomain string) (*LocalDNSServer, error) {
+// NewLocalDNSServer creates the DNS server of the agent. If upstreamCacheSize is positive, up to
+// upstreamCacheSize responses of the upstream servers are cached, honoring their TTL.
+func NewLocalDNSServer(proxyNamespace, proxyDomain string, upstreamCacheSize int) (*LocalDNSServer, error) {
 	h := &LocalDNSServer{
 		proxyNamespace: proxyNamespace,
 	}
+	if upstreamCacheSize > 0 {
+		h.upstreamCache = newUpstreamCache(upstreamCacheSize)
+	}
 
 	// proxyDomain could contain the namespace making it redundant.
 	// we just need the .svc.cluster.local piece
@@ -133,6 +147,8 @@ func (h *LocalDNSServer) UpdateLookupTable(nt *nds.NameTable) {
 		name4:    map[string][]dns.RR{},
 		name6:    map[string][]dns.RR{},
 		cname:    map[string][]dns.RR{},
+		srv:      map[string][]dns.RR{},
+		ptr:      map[string][]dns.RR{},
 	}
 	for host, ni := range nt.Table {
 		// Given a host
@@ -151,7 +167,10 @@ func (h *LocalDNSServer) UpdateLookupTable(nt *nds.NameTable) {
 			continue
 		}
 		lookupTable.buildDNSAnswers(altHosts, ipv4, ipv6, h.searchNamespaces)
+		lookupTable.buildSRVAnswers(host, altHosts, ni.Ports, h.searchNamespaces)
+		lookupTable.buildPTRAnswers(host, append(ipv4, ipv6...))
 	}
+	lookupTable.sortPTRAnswers()
 	h.lookupTable.Store(lookupTable)
 	log.Debugf("updated lookup table with %d hosts", len(lookupTable.allHosts))
 }
@@ -217,8 +236,18 @@ func (h *LocalDNSServer) ServeDNS(proxy *dnsProxy, w dns.ResponseWriter, req *dn
 	}
 
 	// We did not find the host in our internal cache. Query upstream and return the response as is.
-	log.Debugf("response for hostname %q (found=false): %v", hostname, response)
-	response = h.queryUpstream(proxy.upstreamClient, req, log)
+	if h.upstreamCache != nil {
+		response = h.upstreamCache.get(req)
+	}
+	if response != nil {
+		log.Debugf("response for hostname %q (found=false, cached=true): %v", hostname, response)
+	} else {
+		response = h.queryUpstream(proxy.upstreamClient, req, log)
+		log.Debugf("response for hostname %q (found=false): %v", hostname, response)
+		if h.upstreamCache != nil {
+			h.upstreamCache.set(req, response)
+		}
+	}
 	// Compress the response - we don't know if the incoming response was compressed or not. If it was,
 	// but we don't compress on the outbound, we will run into issues. For example, if the compressed
 	// size is 450 bytes but uncompressed 1000 bytes now we are outside of the non-eDNS UDP size limits
@@ -358,6 +387,7 @@ func generateAltHosts(hostname string, nameinfo *nds.NameTable_NameInfo, proxyNa
 // Given a host, this function first decides if the host is part of our service registry.
 // If it is not part of the registry, return nil so that caller queries upstream. If it is part
 // of registry, we will look it up in one of our tables, failing which we will return NXDOMAIN.
+// SRV queries are the exception: those without records are forwarded upstream as well.
 func (table *LookupTable) lookupHost(qtype uint16, hostname string) ([]dns.RR, bool) {
 	var hostFound bool
 	if _, hostFound = table.allHosts[hostname]; !hostFound {
@@ -380,8 +410,15 @@ func (table *LookupTable) lookupHost(qtype uint16, hostname string) ([]dns.RR, b
 		ipAnswers = table.name4[hostname]
 	case dns.TypeAAAA:
 		ipAnswers = table.name6[hostname]
+	case dns.TypeSRV:
+		ipAnswers = table.srv[hostname]
+		if len(ipAnswers) == 0 {
+			// The host has no port we know of, which other resolvers may know of.
+			return nil, false
+		}
+	case dns.TypePTR:
+		ipAnswers = table.ptr[hostname]
 	default:
-		// TODO: handle PTR records for reverse dns lookups
 		return nil, false
 	}
 
@@ -422,26 +459,94 @@ func (table *LookupTable) buildDNSAnswers(altHosts map[string]struct{}, ipv4 []n
 		if len(ipv6) > 0 {
 			table.name6[h] = aaaa(h, ipv6)
 		}
-		if len(searchNamespaces) > 0 {
-			// NOTE: Right now, rather than storing one expanded host for each one of the search namespace
-			// entries, we are going to store just the first one (assuming that most clients will
-			// do sequential dns resolution, starting with the first search namespace)
-
-			// host h already ends with a .
-			// search namespace might not. So we append one in the end if needed
-			expandedHost := strings.ToLower(h + searchNamespaces[0])
-			if !strings.HasSuffix(searchNamespaces[0], ".") {
-				expandedHost += "."
+		if expandedHost := expandHost(h, altHosts, searchNamespaces); expandedHost != "" {
+			table.cname[expandedHost] = cname(expandedHost, h)
+			table.allHosts[expandedHost] = struct{}{}
+		}
+	}
+}
+
+// expandHost returns the variant of the host h expanded by the first search namespace, or an empty string
+// if there is none or the variant is one of the alt hosts.
+func expandHost(h string, altHosts map[string]struct{}, searchNamespaces []string) string {
+	if len(searchNamespaces) == 0 {
+		return ""
+	}
+	// NOTE: Right now, rather than storing one expanded host for each one of the search namespace
+	// entries, we are going to store just the first one (assuming that most clients will
+	// do sequential dns resolution, starting with the first search namespace)
+
+	// host h already ends with a .
+	// search namespace might not. So we append one in the end if needed
+	expandedHost := strings.ToLower(h + searchNamespaces[0])
+	if !strings.HasSuffix(searchNamespaces[0], ".") {
+		expandedHost += "."
+	}
+	// make sure this is not a proper hostname
+	// if host is productpage, and search namespace is ns1.svc.cluster.local
+	// then the expanded host productpage.ns1.svc.cluster.local is a valid hostname
+	// that is likely to be already present in the altHosts
+	if _, exists := altHosts[expandedHost]; exists {
+		return ""
+	}
+	return expandedHost
+}
+
+// buildSRVAnswers stores the SRV records of the ports of a host, following the Kubernetes DNS
+// specification: _<port name>._<protocol>.<host> resolves to the port of the named port, and the
+// host itself to all the ports. The target of the records is the FQDN of the host. As for the A/AAAA
+// records, the names of the ports expanded by the first search namespace are stored with a CNAME record
+// pointing to the name of the port.
+func (table *LookupTable) buildSRVAnswers(host string, altHosts map[string]struct{}, ports []*nds.NameTable_Port, searchNamespaces []string) {
+	if len(ports) == 0 {
+		return
+	}
+	target := strings.ToLower(host) + "."
+	for h := range altHosts {
+		h = strings.ToLower(h)
+		expandedHost := expandHost(h, altHosts, searchNamespaces)
+		for _, port := range ports {
+			record := srv(h, target, port.Port)
+			table.srv[h] = append(table.srv[h], record)
+			if port.Name == "" {
+				continue
 			}
-			// make sure this is not a proper hostname
-			// if host is productpage, and search namespace is ns1.svc.cluster.local
-			// then the expanded host productpage.ns1.svc.cluster.local is a valid hostname
-			// that is likely to be already present in the altHosts
-			if _, exists := altHosts[expandedHost]; !exists {
-				table.cname[expandedHost] = cname(expandedHost, h)
-				table.allHosts[expandedHost] = struct{}{}
+			proto := "_tcp."
+			if strings.EqualFold(port.Protocol, "UDP") {
+				proto = "_udp."
 			}
+			name := "_" + strings.ToLower(port.Name) + "." + proto + h
+			table.srv[name] = append(table.srv[name], srv(name, target, port.Port))
+			table.allHosts[name] = struct{}{}
+			if expandedHost != "" {
+				expandedName := "_" + strings.ToLower(port.Name) + "." + proto + expandedHost
+				table.cname[expandedName] = cname(expandedName, name)
+				table.allHosts[expandedName] = struct{}{}
+			}
+		}
+	}
+}
+
+// buildPTRAnswers stores the PTR records for reverse lookups of the IPs of a host.
+func (table *LookupTable) buildPTRAnswers(host string, ips []net.IP) {
+	target := strings.ToLower(host) + "."
+	for _, ip := range ips {
+		name, err := dns.ReverseAddr(ip.String())
+		if err != nil {
+			continue
 		}
+		table.ptr[name] = append(table.ptr[name], ptr(name, target))
+		table.allHosts[name] = struct{}{}
+	}
+}
+
+// sortPTRAnswers orders the PTR records of IPs shared by several hosts - like the pods of a headless
+// service - so that the responses don't depend on the order of the name table.
+func (table *LookupTable) sortPTRAnswers() {
+	for _, records := range table.ptr {
+		sort.Slice(records, func(i, j int) bool {
+			return records[i].(*dns.PTR).Ptr < records[j].(*dns.PTR).Ptr
+		})
 	}
 }
 
@@ -482,6 +587,33 @@ func cname(host string, targetHost string) []dns.RR {
 	return []dns.RR{answer}
 }
 
+func srv(host string, target string, port uint32) dns.RR {
+	answer := new(dns.SRV)
+	answer.Hdr = dns.RR_Header{
+		Name:   host,
+		Rrtype: dns.TypeSRV,
+		Class:  dns.ClassINET,
+		Ttl:    defaultTTLInSeconds,
+	}
+	answer.Priority = 0
+	answer.Weight = 100
+	answer.Port = uint16(port)
+	answer.Target = target
+	return answer
+}
+
+func ptr(name string, targetHost string) dns.RR {
+	answer := new(dns.PTR)
+	answer.Hdr = dns.RR_Header{
+		Name:   name,
+		Rrtype: dns.TypePTR,
+		Class:  dns.ClassINET,
+		Ttl:    defaultTTLInSeconds,
+	}
+	answer.Ptr = targetHost
+	return answer
+}
+
 // Size returns if buffer size *advertised* in the requests OPT record.
 // Or when the request was over TCP, we return the maximum allowed size of 64K.
 func size(proto string, r *dns.Msg) int {
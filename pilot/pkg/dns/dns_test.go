@@ -38,6 +38,7 @@ func TestDNS(t *testing.T) {
 		host                     string
 		id                       int
 		queryAAAA                bool
+		qtype                    uint16
 		expected                 []dns.RR
 		expectResolutionFailure  int
 		expectExternalResolution bool
@@ -156,6 +157,69 @@ func TestDNS(t *testing.T) {
 			host:      "ipv4.localhost.",
 			queryAAAA: true,
 		},
+		{
+			name:     "success: SRV query for a named port",
+			host:     "_http._tcp.productpage.ns1.svc.cluster.local.",
+			qtype:    dns.TypeSRV,
+			expected: []dns.RR{srv("_http._tcp.productpage.ns1.svc.cluster.local.", "productpage.ns1.svc.cluster.local.", 9080)},
+		},
+		{
+			name:     "success: SRV query for a named UDP port with shortname",
+			host:     "_dns._udp.productpage.",
+			qtype:    dns.TypeSRV,
+			expected: []dns.RR{srv("_dns._udp.productpage.", "productpage.ns1.svc.cluster.local.", 53)},
+		},
+		{
+			name:  "success: SRV query for a host returns all ports",
+			host:  "productpage.ns1.svc.cluster.local.",
+			qtype: dns.TypeSRV,
+			expected: []dns.RR{
+				srv("productpage.ns1.svc.cluster.local.", "productpage.ns1.svc.cluster.local.", 9080),
+				srv("productpage.ns1.svc.cluster.local.", "productpage.ns1.svc.cluster.local.", 53),
+			},
+		},
+		{
+			name:  "success: SRV query for a named port with search namespace yields cname+SRV record",
+			host:  "_http._tcp.productpage.ns1.svc.cluster.local.ns1.svc.cluster.local.",
+			qtype: dns.TypeSRV,
+			expected: append(cname("_http._tcp.productpage.ns1.svc.cluster.local.ns1.svc.cluster.local.",
+				"_http._tcp.productpage.ns1.svc.cluster.local."),
+				srv("_http._tcp.productpage.ns1.svc.cluster.local.", "productpage.ns1.svc.cluster.local.", 9080)),
+		},
+		{
+			name:                    "failure: SRV query for a host without ports is forwarded upstream",
+			host:                    "example.ns2.svc.cluster.local.",
+			qtype:                   dns.TypeSRV,
+			expectResolutionFailure: dns.RcodeNameError,
+		},
+		{
+			// Names of unknown ports are not in the table, and are forwarded upstream
+			name:                    "failure: SRV query for an unknown port",
+			host:                    "_grpc._tcp.productpage.ns1.svc.cluster.local.",
+			qtype:                   dns.TypeSRV,
+			expectResolutionFailure: dns.RcodeNameError,
+		},
+		{
+			name:     "success: PTR query for a service IP",
+			host:     "9.9.9.9.in-addr.arpa.",
+			qtype:    dns.TypePTR,
+			expected: []dns.RR{ptr("9.9.9.9.in-addr.arpa.", "productpage.ns1.svc.cluster.local.")},
+		},
+		{
+			name:  "success: PTR query for an IPv6 address shared by hosts",
+			host:  "9.2.3.8.2.4.0.0.0.0.f.f.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+			qtype: dns.TypePTR,
+			expected: []dns.RR{
+				ptr("9.2.3.8.2.4.0.0.0.0.f.f.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", "dual.localhost."),
+				ptr("9.2.3.8.2.4.0.0.0.0.f.f.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", "ipv6.localhost."),
+			},
+		},
+		{
+			name:                    "failure: PTR query for an unknown IP is forwarded upstream",
+			host:                    "1.0.0.127.in-addr.arpa.",
+			qtype:                   dns.TypePTR,
+			expectResolutionFailure: dns.RcodeNameError,
+		},
 		{
 			name: "udp: large request",
 			host: "giant.",
@@ -213,6 +277,9 @@ func TestDNS(t *testing.T) {
 				if tt.queryAAAA {
 					q = dns.TypeAAAA
 				}
+				if tt.qtype != 0 {
+					q = tt.qtype
+				}
 				m.SetQuestion(tt.host, q)
 				if tt.modifyReq != nil {
 					tt.modifyReq(m)
@@ -399,7 +466,7 @@ func makeUpstream(t test.Failer, responses map[string]string) string {
 
 func initDNS(t test.Failer) *LocalDNSServer {
 	srv := makeUpstream(t, map[string]string{"www.bing.com.": "1.1.1.1"})
-	testAgentDNS, err := NewLocalDNSServer("ns1", "ns1.svc.cluster.local")
+	testAgentDNS, err := NewLocalDNSServer("ns1", "ns1.svc.cluster.local", 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -417,6 +484,10 @@ func initDNS(t test.Failer) *LocalDNSServer {
 				Registry:  "Kubernetes",
 				Namespace: "ns1",
 				Shortname: "productpage",
+				Ports: []*nds.NameTable_Port{
+					{Name: "http", Port: 9080, Protocol: "HTTP"},
+					{Name: "dns", Port: 53, Protocol: "UDP"},
+				},
 			},
 			"example.ns2.svc.cluster.local": {
 				Ips:       []string{"10.10.10.10"},
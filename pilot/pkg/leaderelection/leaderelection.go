@@ -37,6 +37,8 @@ const (
 	IngressController = "istio-leader"
 	StatusController  = "istio-status-leader"
 	AnalyzeController = "istio-analyze-leader"
+	CSRSigner         = "istio-csr-signer-leader"
+	PluggedCARotator  = "istio-plugged-ca-rotator-leader"
 )
 
 type LeaderElection struct {
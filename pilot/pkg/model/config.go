@@ -77,6 +77,19 @@ func ConfigNamesOfKind(configs map[ConfigKey]struct{}, kind config.GroupVersionK
 	return ret
 }
 
+// HasConfigsOfKindOnly returns true if configs is not empty and all of them are of the specified kind.
+func HasConfigsOfKindOnly(configs map[ConfigKey]struct{}, kind config.GroupVersionKind) bool {
+	if len(configs) == 0 {
+		return false
+	}
+	for conf := range configs {
+		if conf.Kind != kind {
+			return false
+		}
+	}
+	return true
+}
+
 // ConfigStore describes a set of platform agnostic APIs that must be supported
 // by the underlying platform to store and retrieve Istio configuration.
 //
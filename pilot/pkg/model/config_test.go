@@ -206,6 +206,27 @@ func TestConfigKey(t *testing.T) {
 	}
 }
 
+func TestHasConfigsOfKindOnly(t *testing.T) {
+	se := model.ConfigKey{Kind: gvk.ServiceEntry, Name: "foo.com", Namespace: "ns"}
+	dr := model.ConfigKey{Kind: gvk.DestinationRule, Name: "foo", Namespace: "ns"}
+	cases := []struct {
+		name    string
+		configs map[model.ConfigKey]struct{}
+		want    bool
+	}{
+		{"empty", nil, false},
+		{"only service entries", map[model.ConfigKey]struct{}{se: {}}, true},
+		{"mixed kinds", map[model.ConfigKey]struct{}{se: {}, dr: {}}, false},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := model.HasConfigsOfKindOnly(tt.configs, gvk.ServiceEntry); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestResolveShortnameToFQDN(t *testing.T) {
 	tests := []struct {
 		name string
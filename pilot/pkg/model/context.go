@@ -181,6 +181,16 @@ type XdsResourceGenerator interface {
 	Generate(proxy *Proxy, push *PushContext, w *WatchedResource, updates *PushRequest) (Resources, error)
 }
 
+// XdsDeltaResourceGenerator is implemented by generators that can compute the resources affected by a push, for
+// Delta XDS. GenerateDeltas returns the updated resources and the names of the removed ones. If usedDelta is false,
+// the generator returned the complete set of resources, as Generate does, and removed resources are inferred by the
+// caller.
+type XdsDeltaResourceGenerator interface {
+	XdsResourceGenerator
+	GenerateDeltas(proxy *Proxy, push *PushContext, updates *PushRequest, w *WatchedResource) (res Resources,
+		deleted []string, usedDelta bool, err error)
+}
+
 // Proxy contains information about an specific instance of a proxy (envoy sidecar, gateway,
 // etc). The Proxy is initialized when a sidecar connects to Pilot, and populated from
 // 'node' info in the protocol as well as data extracted from registries.
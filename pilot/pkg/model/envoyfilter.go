@@ -20,6 +20,7 @@ import (
 	"github.com/gogo/protobuf/proto"
 
 	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/util/sets"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/labels"
 	"istio.io/istio/pkg/config/xds"
@@ -44,6 +45,9 @@ type EnvoyFilterConfigPatchWrapper struct {
 	// regex match, but as an optimization we can reduce this to a prefix match for common cases.
 	// If this is set, ProxyVersionRegex is ignored.
 	ProxyPrefixMatch string
+	// Name and Namespace identify the EnvoyFilter this patch originates from.
+	Name      string
+	Namespace string
 }
 
 // wellKnownVersions defines a mapping of well known regex matches to prefix matches
@@ -84,6 +88,8 @@ func convertToEnvoyFilterWrapper(local *config.Config) *EnvoyFilterWrapper {
 			ApplyTo:   cp.ApplyTo,
 			Match:     cp.Match,
 			Operation: cp.Patch.Operation,
+			Name:      local.Name,
+			Namespace: local.Namespace,
 		}
 		var err error
 		// Use non-strict building to avoid issues where EnvoyFilter is valid but meant
@@ -129,6 +135,29 @@ func convertToEnvoyFilterWrapper(local *config.Config) *EnvoyFilterWrapper {
 	return out
 }
 
+// Key returns the namespace/name of the EnvoyFilter this patch originates from.
+func (cpw *EnvoyFilterConfigPatchWrapper) Key() string {
+	return cpw.Namespace + "/" + cpw.Name
+}
+
+// KeysApplyingTo returns the sorted, de-duplicated keys of the EnvoyFilters with patches
+// for any of the given types. This is used to track which EnvoyFilters a cached resource depends on.
+func (efw *EnvoyFilterWrapper) KeysApplyingTo(applyTo ...networking.EnvoyFilter_ApplyTo) []string {
+	if efw == nil {
+		return nil
+	}
+	keys := sets.NewSet()
+	for _, a := range applyTo {
+		for _, cp := range efw.Patches[a] {
+			keys.Insert(cp.Key())
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return keys.SortedList()
+}
+
 func proxyMatch(proxy *Proxy, cp *EnvoyFilterConfigPatchWrapper) bool {
 	if cp.Match.Proxy == nil {
 		return true
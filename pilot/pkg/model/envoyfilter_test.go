@@ -15,6 +15,7 @@
 package model
 
 import (
+	"reflect"
 	"testing"
 
 	networking "istio.io/api/networking/v1alpha3"
@@ -114,3 +115,42 @@ func TestEnvoyFilterMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestEnvoyFilterKeysApplyingTo(t *testing.T) {
+	efw := &EnvoyFilterWrapper{
+		Patches: map[networking.EnvoyFilter_ApplyTo][]*EnvoyFilterConfigPatchWrapper{
+			networking.EnvoyFilter_CLUSTER: {
+				{Name: "b", Namespace: "ns"},
+				{Name: "a", Namespace: "ns"},
+				{Name: "b", Namespace: "ns"},
+			},
+			networking.EnvoyFilter_VIRTUAL_HOST: {
+				{Name: "c", Namespace: "other"},
+			},
+		},
+	}
+	cases := []struct {
+		name    string
+		efw     *EnvoyFilterWrapper
+		applyTo []networking.EnvoyFilter_ApplyTo
+		want    []string
+	}{
+		{"nil wrapper", nil, []networking.EnvoyFilter_ApplyTo{networking.EnvoyFilter_CLUSTER}, nil},
+		{"no patches", efw, []networking.EnvoyFilter_ApplyTo{networking.EnvoyFilter_LISTENER}, nil},
+		{"de-duplicated", efw, []networking.EnvoyFilter_ApplyTo{networking.EnvoyFilter_CLUSTER}, []string{"ns/a", "ns/b"}},
+		{
+			"multiple types",
+			efw,
+			[]networking.EnvoyFilter_ApplyTo{networking.EnvoyFilter_VIRTUAL_HOST, networking.EnvoyFilter_CLUSTER},
+			[]string{"ns/a", "ns/b", "other/c"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.efw.KeysApplyingTo(tt.applyTo...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -15,10 +15,8 @@
 package core
 
 import (
-	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
-	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
 	"istio.io/istio/pilot/pkg/model"
@@ -35,10 +33,15 @@ type ConfigGenerator interface {
 	BuildListeners(node *model.Proxy, push *model.PushContext) []*listener.Listener
 
 	// BuildClusters returns the list of clusters for the given proxy. This is the CDS output
-	BuildClusters(node *model.Proxy, push *model.PushContext) []*cluster.Cluster
+	BuildClusters(node *model.Proxy, push *model.PushContext) model.Resources
+
+	// BuildDeltaClusters returns the clusters affected by the updates and the names of the removed clusters.
+	// If the clusters cannot be computed incrementally, all the clusters are returned and usedDelta is false.
+	BuildDeltaClusters(node *model.Proxy, push *model.PushContext, updates *model.PushRequest,
+		watched *model.WatchedResource) (clusters model.Resources, deleted []string, usedDelta bool)
 
 	// BuildHTTPRoutes returns the list of HTTP routes for the given proxy. This is the RDS output
-	BuildHTTPRoutes(node *model.Proxy, push *model.PushContext, routeNames []string) []*route.RouteConfiguration
+	BuildHTTPRoutes(node *model.Proxy, push *model.PushContext, routeNames []string) model.Resources
 
 	// BuildNameTable returns list of hostnames and the associated IPs
 	BuildNameTable(node *model.Proxy, push *model.PushContext) *nds.NameTable
@@ -15,6 +15,7 @@
 package v1alpha3
 
 import (
+	"fmt"
 	"math"
 	"strconv"
 	"strings"
@@ -23,8 +24,11 @@ import (
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	xdstype "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/golang/protobuf/ptypes/any"
 	structpb "github.com/golang/protobuf/ptypes/struct"
 	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
 	networking "istio.io/api/networking/v1alpha3"
@@ -34,8 +38,10 @@ import (
 	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/loadbalancer"
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pilot/pkg/serviceregistry"
+	"istio.io/istio/pilot/pkg/util/sets"
 	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schema/gvk"
 	"istio.io/istio/pkg/util/gogo"
 )
 
@@ -74,17 +80,18 @@ func getDefaultCircuitBreakerThresholds() *cluster.CircuitBreakers_Thresholds {
 // For outbound: Cluster for each service/subset hostname or cidr with SNI set to service hostname
 // Cluster type based on resolution
 // For inbound (sidecar only): Cluster for each inbound endpoint port and for each service port
-func (configgen *ConfigGeneratorImpl) BuildClusters(proxy *model.Proxy, push *model.PushContext) []*cluster.Cluster {
+func (configgen *ConfigGeneratorImpl) BuildClusters(proxy *model.Proxy, push *model.PushContext) model.Resources {
 	clusters := make([]*cluster.Cluster, 0)
+	resources := make([]clusterResource, 0)
 	envoyFilterPatches := push.EnvoyFilters(proxy)
-	cb := NewClusterBuilder(proxy, push)
+	cb := NewClusterBuilder(proxy, push, configgen.Cache)
 	instances := proxy.ServiceInstances
 
 	switch proxy.Type {
 	case model.SidecarProxy:
 		// Setup outbound clusters
 		outboundPatcher := clusterPatcher{envoyFilterPatches, networking.EnvoyFilter_SIDECAR_OUTBOUND}
-		clusters = append(clusters, configgen.buildOutboundClusters(cb, outboundPatcher)...)
+		resources = append(resources, configgen.buildOutboundClusters(cb, outboundPatcher, outboundServices(cb))...)
 		// Add a blackhole and passthrough cluster for catching traffic to unresolved routes
 		clusters = outboundPatcher.conditionallyAppend(clusters, nil, cb.buildBlackHoleCluster(), cb.buildDefaultPassthroughCluster())
 		clusters = append(clusters, outboundPatcher.insertedClusters()...)
@@ -97,7 +104,7 @@ func (configgen *ConfigGeneratorImpl) BuildClusters(proxy *model.Proxy, push *mo
 		clusters = append(clusters, inboundPatcher.insertedClusters()...)
 	default: // Gateways
 		patcher := clusterPatcher{envoyFilterPatches, networking.EnvoyFilter_GATEWAY}
-		clusters = append(clusters, configgen.buildOutboundClusters(cb, patcher)...)
+		resources = append(resources, configgen.buildOutboundClusters(cb, patcher, outboundServices(cb))...)
 		// Gateways do not require the default passthrough cluster as they do not have original dst listeners.
 		clusters = patcher.conditionallyAppend(clusters, nil, cb.buildBlackHoleCluster())
 		if proxy.Type == model.Router && proxy.GetRouterMode() == model.SniDnatRouter {
@@ -106,29 +113,105 @@ func (configgen *ConfigGeneratorImpl) BuildClusters(proxy *model.Proxy, push *mo
 		clusters = append(clusters, patcher.insertedClusters()...)
 	}
 
-	return cb.normalizeClusters(clusters)
+	for _, c := range clusters {
+		resources = append(resources, clusterResource{name: c.Name, resource: util.MessageToAny(c)})
+	}
+	return cb.normalizeClusters(resources)
 }
 
-func (configgen *ConfigGeneratorImpl) buildOutboundClusters(cb *ClusterBuilder, cp clusterPatcher) []*cluster.Cluster {
-	clusters := make([]*cluster.Cluster, 0)
-	networkView := model.GetNetworkView(cb.proxy)
+// BuildDeltaClusters returns the clusters affected by the updates, along with the names of the watched clusters
+// that were removed, for a Delta XDS push. Only ServiceEntry updates to sidecars are computed incrementally: the
+// outbound clusters of the updated hosts are rebuilt. In any other case, all the clusters are returned and
+// usedDelta is false.
+func (configgen *ConfigGeneratorImpl) BuildDeltaClusters(proxy *model.Proxy, push *model.PushContext, updates *model.PushRequest,
+	watched *model.WatchedResource) (model.Resources, []string, bool) {
+	updatedHosts := deltaClusterHosts(proxy, updates, watched)
+	if updatedHosts == nil {
+		return configgen.BuildClusters(proxy, push), nil, false
+	}
+	cb := NewClusterBuilder(proxy, push, configgen.Cache)
+	services := make([]*model.Service, 0, len(updatedHosts))
+	for _, service := range outboundServices(cb) {
+		if _, f := updatedHosts[string(service.Hostname)]; f {
+			services = append(services, service)
+		}
+	}
+	outboundPatcher := clusterPatcher{push.EnvoyFilters(proxy), networking.EnvoyFilter_SIDECAR_OUTBOUND}
+	resources := configgen.buildOutboundClusters(cb, outboundPatcher, services)
 
-	var services []*model.Service
+	built := sets.NewSet()
+	for _, r := range resources {
+		built.Insert(r.name)
+	}
+	var deleted []string
+	for _, name := range watched.ResourceNames {
+		direction, _, hostname, _ := model.ParseSubsetKey(name)
+		if direction != model.TrafficDirectionOutbound || built.Contains(name) {
+			continue
+		}
+		if _, f := updatedHosts[string(hostname)]; f {
+			deleted = append(deleted, name)
+		}
+	}
+	return cb.normalizeClusters(resources), deleted, true
+}
+
+// deltaClusterHosts returns the hosts whose clusters must be rebuilt for the updates, or nil if the clusters
+// cannot be computed incrementally.
+func deltaClusterHosts(proxy *model.Proxy, updates *model.PushRequest, watched *model.WatchedResource) map[string]struct{} {
+	if proxy.Type != model.SidecarProxy || watched == nil || updates == nil || !updates.Full ||
+		!model.HasConfigsOfKindOnly(updates.ConfigsUpdated, gvk.ServiceEntry) {
+		return nil
+	}
+	hosts := model.ConfigNamesOfKind(updates.ConfigsUpdated, gvk.ServiceEntry)
+	// The inbound clusters depend on the services selecting the proxy.
+	for _, instance := range proxy.ServiceInstances {
+		if _, f := hosts[string(instance.Service.Hostname)]; f {
+			return nil
+		}
+	}
+	return hosts
+}
+
+// clusterResource is a marshaled cluster along with its name. Outbound clusters may be served
+// directly from the cache, so the name is kept around to normalize clusters without unmarshaling.
+type clusterResource struct {
+	name     string
+	resource *any.Any
+}
+
+// outboundServices returns the services to build outbound clusters for.
+func outboundServices(cb *ClusterBuilder) []*model.Service {
 	if features.FilterGatewayClusterConfig && cb.proxy.Type == model.Router {
-		services = cb.push.GatewayServices(cb.proxy)
-	} else {
-		services = cb.push.Services(cb.proxy)
+		return cb.push.GatewayServices(cb.proxy)
 	}
+	return cb.push.Services(cb.proxy)
+}
+
+func (configgen *ConfigGeneratorImpl) buildOutboundClusters(cb *ClusterBuilder, cp clusterPatcher, services []*model.Service) []clusterResource {
+	resources := make([]clusterResource, 0)
+	networkView := model.GetNetworkView(cb.proxy)
+	efKeys := cp.efw.KeysApplyingTo(networking.EnvoyFilter_CLUSTER)
+
 	for _, service := range services {
 		for _, port := range service.Ports {
 			if port.Protocol == protocol.UDP {
 				continue
 			}
+			clusterName := model.BuildSubsetKey(model.TrafficDirectionOutbound, "", service.Hostname, port.Port)
+			clusterKey := newClusterCache(cb, clusterName, service, port.Port, efKeys)
+			cached, tokens, allFound := cb.getAllCachedSubsetClusters(clusterKey)
+			// With unsafe assertions, the clusters are built anyway and compared to the cached ones below.
+			if allFound && !features.EnableUnsafeAssertions {
+				resources = appendCachedClusters(resources, clusterKey, cached)
+				continue
+			}
+
+			// We have a cache miss, so we will re-generate the cluster and later store it in the cache.
 			lbEndpoints := cb.buildLocalityLbEndpoints(networkView, service, port.Port, nil)
 
 			// create default cluster
 			discoveryType := convertResolution(cb.proxy, service)
-			clusterName := model.BuildSubsetKey(model.TrafficDirectionOutbound, "", service.Hostname, port.Port)
 			defaultCluster := cb.buildDefaultCluster(clusterName, discoveryType, lbEndpoints, model.TrafficDirectionOutbound, port, service, nil)
 			if defaultCluster == nil {
 				continue
@@ -142,12 +225,53 @@ func (configgen *ConfigGeneratorImpl) buildOutboundClusters(cb *ClusterBuilder,
 
 			subsetClusters := cb.applyDestinationRule(defaultCluster, DefaultClusterMode, service, port, networkView)
 
-			clusters = cp.conditionallyAppend(clusters, nil, defaultCluster.build())
-			clusters = cp.conditionallyAppend(clusters, nil, subsetClusters...)
+			built := make([]clusterResource, 0, 1+len(subsetClusters))
+			for _, c := range cp.conditionallyAppend(nil, nil, append([]*cluster.Cluster{defaultCluster.build()}, subsetClusters...)...) {
+				built = append(built, clusterResource{name: c.Name, resource: util.MessageToAny(c)})
+			}
+			if allFound {
+				// Serve the cached clusters, so that the cached path is exercised along with the assertion.
+				cachedResources := appendCachedClusters(nil, clusterKey, cached)
+				assertCachedClusters(cachedResources, built)
+				resources = append(resources, cachedResources...)
+				continue
+			}
+			for _, c := range built {
+				resources = append(resources, c)
+				if features.EnableCDSCaching {
+					clusterKey.clusterName = c.name
+					cb.cache.Add(&clusterKey, tokens[c.name], c.resource)
+				}
+			}
 		}
 	}
 
-	return clusters
+	return resources
+}
+
+// assertCachedClusters panics if the cached clusters differ from the built ones, which means that the cache
+// was not invalidated when it should have been.
+func assertCachedClusters(cached, built []clusterResource) {
+	if len(cached) != len(built) {
+		panic(fmt.Sprintf("assertion failed, got %d cached clusters but built %d", len(cached), len(built)))
+	}
+	for i := range cached {
+		if cached[i].name != built[i].name || !cmp.Equal(cached[i].resource, built[i].resource, protocmp.Transform()) {
+			panic(fmt.Sprintf("assertion failed, cached cluster %s changed but not cleared: %v",
+				cached[i].name, cmp.Diff(cached[i].resource, built[i].resource, protocmp.Transform())))
+		}
+	}
+}
+
+// appendCachedClusters appends the cached default and subset clusters, which are ordered as returned
+// by getAllCachedSubsetClusters.
+func appendCachedClusters(resources []clusterResource, clusterKey clusterCache, cached []*any.Any) []clusterResource {
+	resources = append(resources, clusterResource{name: clusterKey.clusterName, resource: cached[0]})
+	dir, _, host, port := model.ParseSubsetKey(clusterKey.clusterName)
+	for i, ss := range castDestinationRuleOrDefault(clusterKey.destinationRule).Subsets {
+		resources = append(resources, clusterResource{name: model.BuildSubsetKey(dir, ss.Name, host, port), resource: cached[i+1]})
+	}
+	return resources
 }
 
 var NilClusterPatcher = clusterPatcher{}
@@ -182,7 +306,7 @@ func (p clusterPatcher) hasPatches() bool {
 func (configgen *ConfigGeneratorImpl) buildOutboundSniDnatClusters(proxy *model.Proxy, push *model.PushContext,
 	cp clusterPatcher) []*cluster.Cluster {
 	clusters := make([]*cluster.Cluster, 0)
-	cb := NewClusterBuilder(proxy, push)
+	cb := NewClusterBuilder(proxy, push, nil)
 
 	networkView := model.GetNetworkView(proxy)
 
@@ -16,6 +16,8 @@ package v1alpha3
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
@@ -39,6 +41,7 @@ import (
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/schema/gvk"
 	"istio.io/istio/pkg/util/gogo"
 	"istio.io/pkg/log"
 )
@@ -83,14 +86,141 @@ type MutableCluster struct {
 type ClusterBuilder struct {
 	proxy *model.Proxy
 	push  *model.PushContext
+	cache model.XdsCache
 }
 
 // NewClusterBuilder builds an instance of ClusterBuilder.
-func NewClusterBuilder(proxy *model.Proxy, push *model.PushContext) *ClusterBuilder {
+func NewClusterBuilder(proxy *model.Proxy, push *model.PushContext, cache model.XdsCache) *ClusterBuilder {
+	if cache == nil {
+		cache = model.DisabledCache{}
+	}
 	return &ClusterBuilder{
 		proxy: proxy,
 		push:  push,
+		cache: cache,
+	}
+}
+
+// clusterCache includes the variables that can influence an outbound Cluster.
+// Implements XdsCacheEntry interface.
+type clusterCache struct {
+	clusterName string
+
+	// proxy related cache fields
+	proxyType      model.NodeType
+	proxyVersion   string         // will be matched by envoyfilter patches
+	locality       *core.Locality // identifies the locality the cluster is generated for
+	proxyClusterID string         // identifies the kubernetes cluster a proxy is in
+	networkView    map[string]bool
+	metadataCerts  [3]string // TLS client cert chain, key and root cert set in the proxy metadata
+
+	// Dependent configs
+	service         *model.Service
+	destinationRule *config.Config
+	envoyFilterKeys []string
+	peerAuthVersion string   // identifies the versions of all peer authentications
+	serviceAccounts []string // the service accounts of the service port, used for the SANs of the cluster
+}
+
+func newClusterCache(cb *ClusterBuilder, clusterName string, service *model.Service, port int, envoyFilterKeys []string) clusterCache {
+	clusterKey := clusterCache{
+		clusterName:     clusterName,
+		proxyType:       cb.proxy.Type,
+		locality:        cb.proxy.Locality,
+		networkView:     model.GetNetworkView(cb.proxy),
+		service:         service,
+		destinationRule: cb.push.DestinationRule(cb.proxy, service),
+		envoyFilterKeys: envoyFilterKeys,
+		serviceAccounts: cb.push.ServiceAccounts[service.Hostname][port],
+	}
+	if cb.proxy.Metadata != nil {
+		clusterKey.proxyVersion = cb.proxy.Metadata.IstioVersion
+		clusterKey.proxyClusterID = cb.proxy.Metadata.ClusterID
+		clusterKey.metadataCerts = [3]string{
+			cb.proxy.Metadata.TLSClientCertChain, cb.proxy.Metadata.TLSClientKey, cb.proxy.Metadata.TLSClientRootCert,
+		}
+	}
+	if cb.push.AuthnPolicies != nil {
+		clusterKey.peerAuthVersion = cb.push.AuthnPolicies.AggregateVersion
+	}
+	return clusterKey
+}
+
+// Key provides the cds cache key and should include any information that could change the way the cluster is generated.
+func (t *clusterCache) Key() string {
+	params := []string{
+		t.clusterName, string(t.proxyType), t.proxyVersion, util.LocalityToString(t.locality), t.proxyClusterID,
+		t.metadataCerts[0], t.metadataCerts[1], t.metadataCerts[2], t.peerAuthVersion,
+	}
+	if t.service != nil {
+		params = append(params, string(t.service.Hostname)+"/"+t.service.Attributes.Namespace)
+	}
+	if t.destinationRule != nil {
+		params = append(params, t.destinationRule.Name+"/"+t.destinationRule.Namespace)
+	}
+	params = append(params, t.envoyFilterKeys...)
+	// The service accounts change with the endpoints, which do not invalidate the cache.
+	sas := append([]string{}, t.serviceAccounts...)
+	sort.Strings(sas)
+	params = append(params, "sa:"+strings.Join(sas, ","))
+	if t.networkView != nil {
+		nv := make([]string, 0, len(t.networkView))
+		for nw := range t.networkView {
+			nv = append(nv, nw)
+		}
+		sort.Strings(nv)
+		params = append(params, nv...)
+	}
+	return strings.Join(params, "~")
+}
+
+func (t *clusterCache) DependentConfigs() []model.ConfigKey {
+	configs := []model.ConfigKey{}
+	if t.destinationRule != nil {
+		configs = append(configs, model.ConfigKey{Kind: gvk.DestinationRule, Name: t.destinationRule.Name, Namespace: t.destinationRule.Namespace})
+	}
+	if t.service != nil {
+		configs = append(configs, model.ConfigKey{Kind: gvk.ServiceEntry, Name: string(t.service.Hostname), Namespace: t.service.Attributes.Namespace})
+	}
+	for _, efKey := range t.envoyFilterKeys {
+		items := strings.Split(efKey, "/")
+		configs = append(configs, model.ConfigKey{Kind: gvk.EnvoyFilter, Name: items[1], Namespace: items[0]})
+	}
+	return configs
+}
+
+var cdsDependentTypes = []config.GroupVersionKind{gvk.PeerAuthentication}
+
+func (t *clusterCache) DependentTypes() []config.GroupVersionKind {
+	return cdsDependentTypes
+}
+
+func (t *clusterCache) Cacheable() bool {
+	// Without a service there is no way to invalidate the cluster.
+	return t.service != nil
+}
+
+// getAllCachedSubsetClusters fetches the default cluster and all subset clusters for the given key. If any of them
+// is not cached, allFound is false. In either case, the tokens needed for subsequent writes are returned keyed by
+// cluster name.
+func (cb *ClusterBuilder) getAllCachedSubsetClusters(clusterKey clusterCache) ([]*any.Any, map[string]model.CacheToken, bool) {
+	destinationRule := castDestinationRuleOrDefault(clusterKey.destinationRule)
+	res := make([]*any.Any, 0, 1+len(destinationRule.Subsets))
+	tokens := make(map[string]model.CacheToken, 1+len(destinationRule.Subsets))
+	cachedCluster, token, allFound := cb.cache.Get(&clusterKey)
+	res = append(res, cachedCluster)
+	tokens[clusterKey.clusterName] = token
+	dir, _, host, port := model.ParseSubsetKey(clusterKey.clusterName)
+	for _, ss := range destinationRule.Subsets {
+		clusterKey.clusterName = model.BuildSubsetKey(dir, ss.Name, host, port)
+		cachedCluster, token, f := cb.cache.Get(&clusterKey)
+		if !f {
+			allFound = false
+		}
+		res = append(res, cachedCluster)
+		tokens[clusterKey.clusterName] = token
 	}
+	return res, tokens, allFound
 }
 
 // NewMutalbeCluster initializes MutableCluster with the cluser passed.
@@ -926,21 +1056,21 @@ func (cb *ClusterBuilder) setUpstreamProtocol(node *model.Proxy, mc *MutableClus
 	}
 }
 
-// finalizeClusters does any final cluster field marshaling. This should be called
-// at the end before adding the cluster to list of clusters.
-func (cb *ClusterBuilder) normalizeClusters(clusters []*cluster.Cluster) []*cluster.Cluster {
+// normalizeClusters does any final cluster normalization. This should be called
+// at the end before sending the list of clusters.
+func (cb *ClusterBuilder) normalizeClusters(clusters []clusterResource) model.Resources {
 	// resolve cluster name conflicts. there can be duplicate cluster names if there are conflicting service definitions.
 	// for any clusters that share the same name the first cluster is kept and the others are discarded.
 	have := sets.Set{}
-	out := make([]*cluster.Cluster, 0, len(clusters))
+	out := make(model.Resources, 0, len(clusters))
 	for _, c := range clusters {
-		if !have.Contains(c.Name) {
-			out = append(out, c)
+		if !have.Contains(c.name) {
+			out = append(out, c.resource)
 		} else {
-			cb.push.AddMetric(model.DuplicatedClusters, c.Name, cb.proxy.ID,
-				fmt.Sprintf("Duplicate cluster %s found while pushing CDS", c.Name))
+			cb.push.AddMetric(model.DuplicatedClusters, c.name, cb.proxy.ID,
+				fmt.Sprintf("Duplicate cluster %s found while pushing CDS", c.name))
 		}
-		have.Insert(c.Name)
+		have.Insert(c.name)
 	}
 	return out
 }
@@ -270,7 +270,7 @@ func TestApplyDestinationRule(t *testing.T) {
 				Services:       []*model.Service{tt.service},
 			})
 			cg.MemRegistry.WantGetProxyServiceInstances = instances
-			cb := NewClusterBuilder(cg.SetupProxy(nil), cg.PushContext())
+			cb := NewClusterBuilder(cg.SetupProxy(nil), cg.PushContext(), nil)
 
 			ec := NewMutableCluster(tt.cluster)
 			subsetClusters := cb.applyDestinationRule(ec, tt.clusterMode, tt.service, tt.port, tt.networkView)
@@ -788,7 +788,7 @@ func TestBuildDefaultCluster(t *testing.T) {
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
 			cg := NewConfigGenTest(t, TestOptions{MeshConfig: &testMesh})
-			cb := NewClusterBuilder(cg.SetupProxy(nil), cg.PushContext())
+			cb := NewClusterBuilder(cg.SetupProxy(nil), cg.PushContext(), nil)
 
 			defaultCluster := cb.buildDefaultCluster(tt.clusterName, tt.discovery, tt.endpoints, tt.direction, servicePort, &model.Service{
 				Ports: model.PortList{
@@ -1077,7 +1077,7 @@ func TestBuildLocalityLbEndpoints(t *testing.T) {
 				Instances:  tt.instances,
 			})
 
-			cb := NewClusterBuilder(cg.SetupProxy(proxy), cg.PushContext())
+			cb := NewClusterBuilder(cg.SetupProxy(proxy), cg.PushContext(), nil)
 			nv := map[string]bool{
 				"nw-0":               true,
 				"nw-1":               true,
@@ -1123,7 +1123,7 @@ func TestBuildPassthroughClusters(t *testing.T) {
 			proxy := &model.Proxy{IPAddresses: tt.ips}
 			cg := NewConfigGenTest(t, TestOptions{})
 
-			cb := NewClusterBuilder(cg.SetupProxy(proxy), cg.PushContext())
+			cb := NewClusterBuilder(cg.SetupProxy(proxy), cg.PushContext(), nil)
 			clusters := cb.buildInboundPassthroughClusters()
 
 			var hasIpv4, hasIpv6 bool
@@ -1445,7 +1445,7 @@ func TestApplyUpstreamTLSSettings(t *testing.T) {
 	push := model.NewPushContext()
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			cb := NewClusterBuilder(proxy, push)
+			cb := NewClusterBuilder(proxy, push, nil)
 			customMetadataMutual := features.AllowMetadataCertsInMutualTLS
 			if test.allowCustomMetadataMutual {
 				features.AllowMetadataCertsInMutualTLS = true
@@ -2220,7 +2220,7 @@ func TestBuildUpstreamClusterTLSContext(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			cb := NewClusterBuilder(nil, nil)
+			cb := NewClusterBuilder(nil, nil, nil)
 			if tc.h2 {
 				cb.setH2Options(tc.opts.mutable)
 			}
@@ -2241,7 +2241,7 @@ func newTestCluster() *MutableCluster {
 }
 
 func newH2TestCluster() *MutableCluster {
-	cb := NewClusterBuilder(nil, nil)
+	cb := NewClusterBuilder(nil, nil, nil)
 	mc := NewMutableCluster(&cluster.Cluster{
 		Name: "test-cluster",
 	})
@@ -2250,7 +2250,7 @@ func newH2TestCluster() *MutableCluster {
 }
 
 func newDownstreamTestCluster() *MutableCluster {
-	cb := NewClusterBuilder(nil, nil)
+	cb := NewClusterBuilder(nil, nil, nil)
 	mc := NewMutableCluster(&cluster.Cluster{
 		Name: "test-cluster",
 	})
@@ -2376,7 +2376,7 @@ func TestShouldH2Upgrade(t *testing.T) {
 		},
 	}
 
-	cb := NewClusterBuilder(nil, nil)
+	cb := NewClusterBuilder(nil, nil, nil)
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -2413,7 +2413,7 @@ func TestIsHttp2Cluster(t *testing.T) {
 		},
 	}
 
-	cb := NewClusterBuilder(nil, nil)
+	cb := NewClusterBuilder(nil, nil, nil)
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -2474,3 +2474,197 @@ func TestTelemetryMetadata(t *testing.T) {
 		})
 	}
 }
+
+func TestOutboundClusterCaching(t *testing.T) {
+	for _, assertions := range []bool{false, true} {
+		t.Run(fmt.Sprintf("assertions=%v", assertions), func(t *testing.T) {
+			// With assertions, the clusters are built on cache hits too and compared to the cached ones.
+			defer func(old bool) { features.EnableUnsafeAssertions = old }(features.EnableUnsafeAssertions)
+			features.EnableUnsafeAssertions = assertions
+			testOutboundClusterCaching(t)
+		})
+	}
+}
+
+func testOutboundClusterCaching(t *testing.T) {
+	service := &model.Service{
+		Hostname: host.Name("cached.test"),
+		Address:  "1.1.1.1",
+		Ports: []*model.Port{
+			{
+				Name:     "default",
+				Port:     8080,
+				Protocol: protocol.HTTP,
+			},
+		},
+		Resolution: model.ClientSideLB,
+		Attributes: model.ServiceAttributes{Namespace: "default"},
+	}
+	destRule := config.Config{
+		Meta: config.Meta{
+			GroupVersionKind: gvk.DestinationRule,
+			Name:             "cached",
+			Namespace:        "default",
+		},
+		Spec: &networking.DestinationRule{
+			Host: "cached.test",
+			Subsets: []*networking.Subset{
+				{Name: "v1", Labels: map[string]string{"version": "v1"}},
+			},
+		},
+	}
+	cg := NewConfigGenTest(t, TestOptions{Configs: []config.Config{destRule}, Services: []*model.Service{service}})
+	cache := model.NewXdsCache()
+	cg.ConfigGen.Cache = cache
+	proxy := cg.SetupProxy(nil)
+
+	first := cg.Clusters(proxy)
+	// The default and subset cluster of the service are cached; the remaining clusters are not.
+	if got := len(cache.Keys()); got != 2 {
+		t.Fatalf("expected 2 cached clusters, got %d: %v", got, cache.Keys())
+	}
+	second := cg.Clusters(proxy)
+	if diff := cmp.Diff(first, second, protocmp.Transform()); diff != "" {
+		t.Fatalf("cached clusters differ from generated clusters: %v", diff)
+	}
+	if !cmp.Equal(xdstest.MapKeys(xdstest.ExtractClusters(second)), []string{
+		"BlackHoleCluster", "InboundPassthroughClusterIpv4", "PassthroughCluster",
+		"outbound|8080|v1|cached.test", "outbound|8080||cached.test",
+	}) {
+		t.Fatalf("unexpected clusters: %v", xdstest.MapKeys(xdstest.ExtractClusters(second)))
+	}
+
+	// A proxy with a different version must not share cached clusters.
+	cg.Clusters(cg.SetupProxy(&model.Proxy{Metadata: &model.NodeMetadata{IstioVersion: "1.10.0"}}))
+	if got := len(cache.Keys()); got != 4 {
+		t.Fatalf("expected 4 cached clusters, got %d: %v", got, cache.Keys())
+	}
+
+	// The service accounts of the endpoints change without invalidating the cache, so they must be part of the key.
+	cg.PushContext().ServiceAccounts[service.Hostname] = map[int][]string{8080: {"spiffe://cluster.local/ns/default/sa/new"}}
+	third := cg.Clusters(proxy)
+	if got := len(cache.Keys()); got != 6 {
+		t.Fatalf("expected 6 cached clusters, got %d: %v", got, cache.Keys())
+	}
+	if c := xdstest.ExtractClusters(third)["outbound|8080||cached.test"]; !strings.Contains(c.String(), "sa/new") {
+		t.Fatalf("cluster does not use the new service account: %v", c)
+	}
+
+	// Updating the destination rule invalidates all clusters depending on it.
+	cache.Clear(map[model.ConfigKey]struct{}{
+		{Kind: gvk.DestinationRule, Name: "cached", Namespace: "default"}: {},
+	})
+	if got := len(cache.Keys()); got != 0 {
+		t.Fatalf("expected cache to be cleared, got %v", cache.Keys())
+	}
+}
+
+func TestAssertCachedClusters(t *testing.T) {
+	resource := func(name string, timeout time.Duration) clusterResource {
+		return clusterResource{name: name, resource: util.MessageToAny(&cluster.Cluster{Name: name, ConnectTimeout: durationpb.New(timeout)})}
+	}
+	cached := []clusterResource{resource("a", time.Second), resource("b", time.Second)}
+	assertCachedClusters(cached, []clusterResource{resource("a", time.Second), resource("b", time.Second)})
+
+	for name, built := range map[string][]clusterResource{
+		"changed": {resource("a", time.Second), resource("b", time.Minute)},
+		"missing": {resource("a", time.Second)},
+		"renamed": {resource("a", time.Second), resource("c", time.Second)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected the assertion to fail")
+				}
+			}()
+			assertCachedClusters(cached, built)
+		})
+	}
+}
+
+func TestBuildDeltaClusters(t *testing.T) {
+	newService := func(hostname string) *model.Service {
+		return &model.Service{
+			Hostname:   host.Name(hostname),
+			Address:    "1.1.1.1",
+			Ports:      model.PortList{{Name: "http", Port: 80, Protocol: protocol.HTTP}},
+			Resolution: model.ClientSideLB,
+			Attributes: model.ServiceAttributes{Namespace: "default"},
+		}
+	}
+	serviceEntries := func(hostnames ...string) map[model.ConfigKey]struct{} {
+		configs := map[model.ConfigKey]struct{}{}
+		for _, h := range hostnames {
+			configs[model.ConfigKey{Kind: gvk.ServiceEntry, Name: h, Namespace: "default"}] = struct{}{}
+		}
+		return configs
+	}
+	watched := &model.WatchedResource{
+		TypeUrl:       v3.ClusterType,
+		ResourceNames: []string{"BlackHoleCluster", "outbound|80||a.com", "outbound|80||b.com", "outbound|80||removed.com"},
+	}
+	cases := []struct {
+		name          string
+		proxyType     model.NodeType
+		updates       *model.PushRequest
+		wantUsedDelta bool
+		wantClusters  []string
+		wantDeleted   []string
+	}{
+		{
+			name:          "service entry update",
+			proxyType:     model.SidecarProxy,
+			updates:       &model.PushRequest{Full: true, ConfigsUpdated: serviceEntries("a.com", "removed.com")},
+			wantUsedDelta: true,
+			wantClusters:  []string{"outbound|80||a.com"},
+			wantDeleted:   []string{"outbound|80||removed.com"},
+		},
+		{
+			name:      "destination rule update",
+			proxyType: model.SidecarProxy,
+			updates: &model.PushRequest{Full: true, ConfigsUpdated: map[model.ConfigKey]struct{}{
+				{Kind: gvk.DestinationRule, Name: "a", Namespace: "default"}: {},
+			}},
+		},
+		{
+			name:      "full push",
+			proxyType: model.SidecarProxy,
+			updates:   &model.PushRequest{Full: true},
+		},
+		{
+			name:      "gateway",
+			proxyType: model.Router,
+			updates:   &model.PushRequest{Full: true, ConfigsUpdated: serviceEntries("a.com")},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			cg := NewConfigGenTest(t, TestOptions{Services: []*model.Service{newService("a.com"), newService("b.com")}})
+			proxy := cg.SetupProxy(&model.Proxy{Type: tt.proxyType})
+			raw, deleted, usedDelta := cg.ConfigGen.BuildDeltaClusters(proxy, cg.PushContext(), tt.updates, watched)
+			if usedDelta != tt.wantUsedDelta {
+				t.Fatalf("got usedDelta %v, want %v", usedDelta, tt.wantUsedDelta)
+			}
+			if !usedDelta {
+				if len(raw) != len(cg.Clusters(proxy)) || len(deleted) != 0 {
+					t.Fatalf("expected all the clusters and no deletion, got %d clusters and deleted %v", len(raw), deleted)
+				}
+				return
+			}
+			clusters := make([]string, 0, len(raw))
+			for _, r := range raw {
+				c := &cluster.Cluster{}
+				if err := r.UnmarshalTo(c); err != nil {
+					t.Fatal(err)
+				}
+				clusters = append(clusters, c.Name)
+			}
+			if !reflect.DeepEqual(clusters, tt.wantClusters) {
+				t.Errorf("got clusters %v, want %v", clusters, tt.wantClusters)
+			}
+			if !reflect.DeepEqual(deleted, tt.wantDeleted) {
+				t.Errorf("got deleted clusters %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
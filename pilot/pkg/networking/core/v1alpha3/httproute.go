@@ -44,13 +44,26 @@ const (
 
 // BuildHTTPRoutes produces a list of routes for the proxy
 func (configgen *ConfigGeneratorImpl) BuildHTTPRoutes(node *model.Proxy, push *model.PushContext,
-	routeNames []string) []*route.RouteConfiguration {
-	routeConfigurations := make([]*route.RouteConfiguration, 0)
+	routeNames []string) model.Resources {
+	routeConfigurations := model.Resources{}
 
 	switch node.Type {
 	case model.SidecarProxy:
 		vHostCache := make(map[int][]*route.VirtualHost)
+		efKeys := push.EnvoyFilters(node).KeysApplyingTo(networking.EnvoyFilter_ROUTE_CONFIGURATION,
+			networking.EnvoyFilter_VIRTUAL_HOST, networking.EnvoyFilter_HTTP_ROUTE)
 		for _, routeName := range routeNames {
+			var routeCache *istio_route.Cache
+			var token model.CacheToken
+			if features.EnableRDSCaching {
+				routeCache = buildSidecarOutboundRouteCache(node, push, routeName, efKeys)
+				cached, tok, found := configgen.Cache.Get(routeCache)
+				if found && !features.EnableUnsafeAssertions {
+					routeConfigurations = append(routeConfigurations, cached)
+					continue
+				}
+				token = tok
+			}
 			rc := configgen.buildSidecarOutboundHTTPRouteConfig(node, push, routeName, vHostCache)
 			if rc != nil {
 				rc = envoyfilter.ApplyRouteConfigurationPatches(networking.EnvoyFilter_SIDECAR_OUTBOUND, node, push, rc)
@@ -61,7 +74,11 @@ func (configgen *ConfigGeneratorImpl) BuildHTTPRoutes(node *model.Proxy, push *m
 					ValidateClusters: proto.BoolFalse,
 				}
 			}
-			routeConfigurations = append(routeConfigurations, rc)
+			resource := util.MessageToAny(rc)
+			if features.EnableRDSCaching {
+				configgen.Cache.Add(routeCache, token, resource)
+			}
+			routeConfigurations = append(routeConfigurations, resource)
 		}
 	case model.Router:
 		for _, routeName := range routeNames {
@@ -75,12 +92,53 @@ func (configgen *ConfigGeneratorImpl) BuildHTTPRoutes(node *model.Proxy, push *m
 					ValidateClusters: proto.BoolFalse,
 				}
 			}
-			routeConfigurations = append(routeConfigurations, rc)
+			routeConfigurations = append(routeConfigurations, util.MessageToAny(rc))
 		}
 	}
 	return routeConfigurations
 }
 
+// buildSidecarOutboundRouteCache builds the cache entry for an outbound sidecar route. It returns nil, which is
+// not cacheable, if the route has no egress listener or is not bound to a single port.
+func buildSidecarOutboundRouteCache(node *model.Proxy, push *model.PushContext, routeName string,
+	efKeys []string) *istio_route.Cache {
+	listenerPort, _, err := parseSidecarOutboundRouteName(routeName)
+	if err != nil || listenerPort == 0 {
+		return nil
+	}
+	egressListener := node.SidecarScope.GetEgressListenerForRDS(listenerPort, routeName)
+	if egressListener == nil {
+		return nil
+	}
+	if egressListener.IstioListener != nil && egressListener.IstioListener.Port != nil &&
+		protocol.Parse(egressListener.IstioListener.Port.Protocol) == protocol.HTTP_PROXY {
+		return nil
+	}
+
+	// Only services listening on the route's port contribute virtual hosts.
+	services := make([]*model.Service, 0)
+	for _, svc := range egressListener.Services() {
+		if _, exists := svc.Ports.GetByPort(listenerPort); exists {
+			services = append(services, svc)
+		}
+	}
+	virtualServices := egressListener.VirtualServices()
+
+	return &istio_route.Cache{
+		RouteName:               routeName,
+		ProxyVersion:            node.Metadata.IstioVersion,
+		ClusterID:               node.Metadata.ClusterID,
+		DNSDomain:               node.DNSDomain,
+		OutboundTrafficPolicy:   node.SidecarScope.OutboundTrafficPolicy.String(),
+		ListenerPort:            listenerPort,
+		Services:                services,
+		VirtualServices:         virtualServices,
+		DelegateVirtualServices: push.DelegateVirtualServicesConfigKey(virtualServices),
+		DestinationRules:        istio_route.DestinationRulesForRoutes(node, push, services, virtualServices),
+		EnvoyFilterKeys:         efKeys,
+	}
+}
+
 // buildSidecarInboundHTTPRouteConfig builds the route config with a single wildcard virtual host on the inbound path
 // TODO: trace decorators, inbound timeouts
 func (configgen *ConfigGeneratorImpl) buildSidecarInboundHTTPRouteConfig(
@@ -114,25 +172,25 @@ func traceOperation(host string, port int) string {
 	return host + ":" + strconv.Itoa(port) + "/*"
 }
 
-// buildSidecarOutboundHTTPRouteConfig builds an outbound HTTP Route for sidecar.
-// Based on port, will determine all virtual hosts that listen on the port.
-func (configgen *ConfigGeneratorImpl) buildSidecarOutboundHTTPRouteConfig(node *model.Proxy, push *model.PushContext,
-	routeName string, vHostCache map[int][]*route.VirtualHost) *route.RouteConfiguration {
-	var virtualHosts []*route.VirtualHost
-	listenerPort := 0
-	useSniffing := false
-	var err error
+// parseSidecarOutboundRouteName returns the listener port of an outbound route name, and whether the
+// route is for a sniffed host:port. An error is returned for http_proxy and unix domain socket routes.
+func parseSidecarOutboundRouteName(routeName string) (int, bool, error) {
 	if features.EnableProtocolSniffingForOutbound &&
 		!strings.HasPrefix(routeName, model.UnixAddressPrefix) {
 		index := strings.IndexRune(routeName, ':')
-		if index != -1 {
-			useSniffing = true
-		}
-		listenerPort, err = strconv.Atoi(routeName[index+1:])
-	} else {
-		listenerPort, err = strconv.Atoi(routeName)
+		listenerPort, err := strconv.Atoi(routeName[index+1:])
+		return listenerPort, index != -1, err
 	}
+	listenerPort, err := strconv.Atoi(routeName)
+	return listenerPort, false, err
+}
 
+// buildSidecarOutboundHTTPRouteConfig builds an outbound HTTP Route for sidecar.
+// Based on port, will determine all virtual hosts that listen on the port.
+func (configgen *ConfigGeneratorImpl) buildSidecarOutboundHTTPRouteConfig(node *model.Proxy, push *model.PushContext,
+	routeName string, vHostCache map[int][]*route.VirtualHost) *route.RouteConfiguration {
+	var virtualHosts []*route.VirtualHost
+	listenerPort, useSniffing, err := parseSidecarOutboundRouteName(routeName)
 	if err != nil {
 		// we have a port whose name is http_proxy or unix:///foo/bar
 		// check for both.
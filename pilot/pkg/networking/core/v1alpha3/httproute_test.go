@@ -22,6 +22,8 @@ import (
 	"time"
 
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
 
 	meshapi "istio.io/api/mesh/v1alpha1"
 	networking "istio.io/api/networking/v1alpha3"
@@ -1169,3 +1171,65 @@ func buildHTTPService(hostname string, v visibility.Instance, ip, namespace stri
 	service.Ports = Ports
 	return service
 }
+
+func TestSidecarOutboundRouteCaching(t *testing.T) {
+	service := &model.Service{
+		Hostname: host.Name("cached.test"),
+		Address:  "1.1.1.1",
+		Ports: []*model.Port{
+			{
+				Name:     "http",
+				Port:     8080,
+				Protocol: protocol.HTTP,
+			},
+		},
+		Resolution: model.ClientSideLB,
+		Attributes: model.ServiceAttributes{Namespace: "default"},
+	}
+	virtualService := func(match *networking.HTTPMatchRequest) config.Config {
+		return config.Config{
+			Meta: config.Meta{
+				GroupVersionKind: gvk.VirtualService,
+				Name:             "cached",
+				Namespace:        "default",
+			},
+			Spec: &networking.VirtualService{
+				Hosts: []string{"cached.test"},
+				Http: []*networking.HTTPRoute{{
+					Match: []*networking.HTTPMatchRequest{match},
+					Route: []*networking.HTTPRouteDestination{{Destination: &networking.Destination{Host: "cached.test"}}},
+				}},
+			},
+		}
+	}
+	cases := []struct {
+		name       string
+		match      *networking.HTTPMatchRequest
+		wantCached bool
+	}{
+		{"uri match", &networking.HTTPMatchRequest{Uri: &networking.StringMatch{
+			MatchType: &networking.StringMatch_Prefix{Prefix: "/"},
+		}}, true},
+		{"source labels", &networking.HTTPMatchRequest{SourceLabels: map[string]string{"app": "foo"}}, false},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			cg := NewConfigGenTest(t, TestOptions{
+				Configs:  []config.Config{virtualService(tt.match)},
+				Services: []*model.Service{service},
+			})
+			cache := model.NewXdsCache()
+			cg.ConfigGen.Cache = cache
+			proxy := cg.SetupProxy(nil)
+
+			first := cg.Routes(proxy)
+			if got := len(cache.Keys()) > 0; got != tt.wantCached {
+				t.Fatalf("expected cached %v, got keys %v", tt.wantCached, cache.Keys())
+			}
+			second := cg.Routes(proxy)
+			if diff := cmp.Diff(first, second, protocmp.Transform()); diff != "" {
+				t.Fatalf("cached routes differ from generated routes: %v", diff)
+			}
+		})
+	}
+}
@@ -131,6 +131,15 @@ func (configgen *ConfigGeneratorImpl) BuildNameTable(node *model.Proxy, push *mo
 		nameInfo := &nds.NameTable_NameInfo{
 			Ips:      addressList,
 			Registry: svc.Attributes.ServiceRegistry,
+			Ports:    make([]*nds.NameTable_Port, 0, len(svc.Ports)),
+		}
+		// The ports are used by the agent to answer SRV queries.
+		for _, port := range svc.Ports {
+			nameInfo.Ports = append(nameInfo.Ports, &nds.NameTable_Port{
+				Name:     port.Name,
+				Port:     uint32(port.Port),
+				Protocol: string(port.Protocol),
+			})
 		}
 		if svc.Attributes.ServiceRegistry == string(serviceregistry.Kubernetes) {
 			// The agent will take care of resolving a, a.ns, a.ns.svc, etc.
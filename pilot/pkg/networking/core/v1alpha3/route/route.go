@@ -486,7 +486,7 @@ func translateRoute(push *model.PushContext, node *model.Proxy, in *networking.H
 		Operation: getRouteOperation(out, virtualService.Name, port),
 	}
 	if fault := in.Fault; fault != nil {
-		out.TypedPerFilterConfig[wellknown.Fault] = util.MessageToAny(translateFault(in.Fault))
+		out.TypedPerFilterConfig[wellknown.Fault] = util.MessageToAny(TranslateFault(in.Fault))
 	}
 
 	return out
@@ -595,12 +595,12 @@ func translateRouteMatch(in *networking.HTTPMatchRequest) *route.RouteMatch {
 	}
 
 	for name, stringMatch := range in.Headers {
-		matcher := translateHeaderMatch(name, stringMatch)
+		matcher := TranslateHeaderMatch(name, stringMatch)
 		out.Headers = append(out.Headers, matcher)
 	}
 
 	for name, stringMatch := range in.WithoutHeaders {
-		matcher := translateHeaderMatch(name, stringMatch)
+		matcher := TranslateHeaderMatch(name, stringMatch)
 		matcher.InvertMatch = true
 		out.Headers = append(out.Headers, matcher)
 	}
@@ -630,17 +630,17 @@ func translateRouteMatch(in *networking.HTTPMatchRequest) *route.RouteMatch {
 	out.CaseSensitive = &wrappers.BoolValue{Value: !in.IgnoreUriCase}
 
 	if in.Method != nil {
-		matcher := translateHeaderMatch(HeaderMethod, in.Method)
+		matcher := TranslateHeaderMatch(HeaderMethod, in.Method)
 		out.Headers = append(out.Headers, matcher)
 	}
 
 	if in.Authority != nil {
-		matcher := translateHeaderMatch(HeaderAuthority, in.Authority)
+		matcher := TranslateHeaderMatch(HeaderAuthority, in.Authority)
 		out.Headers = append(out.Headers, matcher)
 	}
 
 	if in.Scheme != nil {
-		matcher := translateHeaderMatch(HeaderScheme, in.Scheme)
+		matcher := TranslateHeaderMatch(HeaderScheme, in.Scheme)
 		out.Headers = append(out.Headers, matcher)
 	}
 
@@ -696,8 +696,8 @@ func isCatchAllHeaderMatch(in *networking.StringMatch) bool {
 	return catchall
 }
 
-// translateHeaderMatch translates to HeaderMatcher
-func translateHeaderMatch(name string, in *networking.StringMatch) *route.HeaderMatcher {
+// TranslateHeaderMatch translates to HeaderMatcher
+func TranslateHeaderMatch(name string, in *networking.StringMatch) *route.HeaderMatcher {
 	out := &route.HeaderMatcher{
 		Name: name,
 	}
@@ -875,8 +875,8 @@ func translateIntegerToFractionalPercent(p int32) *xdstype.FractionalPercent {
 	}
 }
 
-// translateFault translates networking.HTTPFaultInjection into Envoy's HTTPFault
-func translateFault(in *networking.HTTPFaultInjection) *xdshttpfault.HTTPFault {
+// TranslateFault translates networking.HTTPFaultInjection into Envoy's HTTPFault
+func TranslateFault(in *networking.HTTPFaultInjection) *xdshttpfault.HTTPFault {
 	if in == nil {
 		return nil
 	}
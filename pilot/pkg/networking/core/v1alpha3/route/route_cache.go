@@ -0,0 +1,152 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"crypto/md5"
+	"fmt"
+	"strconv"
+	"strings"
+
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/schema/gvk"
+)
+
+// Cache includes the variables that can influence a Route Configuration.
+// Implements XdsCacheEntry interface.
+type Cache struct {
+	RouteName string
+
+	ProxyVersion string
+	// proxy cluster ID
+	ClusterID string
+	// proxy dns domain
+	DNSDomain string
+	// OutboundTrafficPolicy is the serialized outbound traffic policy of the proxy's sidecar scope,
+	// which determines the catch all virtual host.
+	OutboundTrafficPolicy string
+
+	ListenerPort            int
+	Services                []*model.Service
+	VirtualServices         []config.Config
+	DelegateVirtualServices []model.ConfigKey
+	DestinationRules        []*config.Config
+	EnvoyFilterKeys         []string
+}
+
+func (r *Cache) Cacheable() bool {
+	if r == nil {
+		return false
+	}
+	// http_proxy and unix domain socket routes take all ports of all services, skip them.
+	if r.ListenerPort == 0 {
+		return false
+	}
+
+	for _, cfg := range r.VirtualServices {
+		vs := cfg.Spec.(*networking.VirtualService)
+		for _, httpRoute := range vs.Http {
+			for _, match := range httpRoute.Match {
+				// if vs has source match, the route depends on the proxy labels and namespace, so it is not cacheable
+				if len(match.SourceLabels) > 0 || match.SourceNamespace != "" {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
+
+func (r *Cache) DependentConfigs() []model.ConfigKey {
+	configs := make([]model.ConfigKey, 0, len(r.Services)+len(r.VirtualServices)+
+		len(r.DelegateVirtualServices)+len(r.DestinationRules)+len(r.EnvoyFilterKeys))
+	for _, svc := range r.Services {
+		configs = append(configs, model.ConfigKey{Kind: gvk.ServiceEntry, Name: string(svc.Hostname), Namespace: svc.Attributes.Namespace})
+	}
+	for _, vs := range r.VirtualServices {
+		configs = append(configs, model.ConfigKey{Kind: gvk.VirtualService, Name: vs.Name, Namespace: vs.Namespace})
+	}
+	// Delegate virtual services are merged into their root, so updates to them need to clear the root's routes.
+	configs = append(configs, r.DelegateVirtualServices...)
+	for _, dr := range r.DestinationRules {
+		configs = append(configs, model.ConfigKey{Kind: gvk.DestinationRule, Name: dr.Name, Namespace: dr.Namespace})
+	}
+	for _, efKey := range r.EnvoyFilterKeys {
+		items := strings.Split(efKey, "/")
+		configs = append(configs, model.ConfigKey{Kind: gvk.EnvoyFilter, Name: items[1], Namespace: items[0]})
+	}
+	return configs
+}
+
+func (r *Cache) DependentTypes() []config.GroupVersionKind {
+	return nil
+}
+
+// Key provides the rds cache key. Since a route can reference a large number of services, the parameters
+// are hashed to keep the size of the cache index bounded.
+func (r *Cache) Key() string {
+	params := []string{
+		r.RouteName, r.ProxyVersion, r.ClusterID, r.DNSDomain, r.OutboundTrafficPolicy, strconv.Itoa(r.ListenerPort),
+	}
+	for _, svc := range r.Services {
+		params = append(params, string(svc.Hostname)+"/"+svc.Attributes.Namespace)
+	}
+	for _, vs := range r.VirtualServices {
+		params = append(params, vs.Name+"/"+vs.Namespace)
+	}
+	for _, dr := range r.DestinationRules {
+		params = append(params, dr.Name+"/"+dr.Namespace)
+	}
+	params = append(params, r.EnvoyFilterKeys...)
+
+	return fmt.Sprintf("%x", md5.Sum([]byte(strings.Join(params, "~"))))
+}
+
+// DestinationRulesForRoutes returns the destination rules that may influence the routes generated for the given
+// services and virtual services, de-duplicated by name. These are the rules consulted for consistent hash policies.
+func DestinationRulesForRoutes(node *model.Proxy, push *model.PushContext,
+	services []*model.Service, virtualServices []config.Config) []*config.Config {
+	out := make([]*config.Config, 0)
+	seen := map[string]struct{}{}
+	add := func(dr *config.Config) {
+		if dr == nil {
+			return
+		}
+		k := dr.Namespace + "/" + dr.Name
+		if _, f := seen[k]; f {
+			return
+		}
+		seen[k] = struct{}{}
+		out = append(out, dr)
+	}
+	for _, svc := range services {
+		add(push.DestinationRule(node, svc))
+	}
+	for _, vs := range virtualServices {
+		for _, httpRoute := range vs.Spec.(*networking.VirtualService).Http {
+			for _, dst := range httpRoute.Route {
+				add(push.DestinationRule(node, &model.Service{
+					Hostname:   host.Name(dst.GetDestination().GetHost()),
+					Attributes: model.ServiceAttributes{Namespace: vs.Namespace},
+				}))
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,144 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"reflect"
+	"testing"
+
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/schema/gvk"
+)
+
+func TestRouteCacheCacheable(t *testing.T) {
+	virtualService := func(match *networking.HTTPMatchRequest) config.Config {
+		return config.Config{
+			Meta: config.Meta{Name: "vs", Namespace: "default"},
+			Spec: &networking.VirtualService{
+				Http: []*networking.HTTPRoute{{Match: []*networking.HTTPMatchRequest{match}}},
+			},
+		}
+	}
+	cases := []struct {
+		name  string
+		cache *Cache
+		want  bool
+	}{
+		{"nil", nil, false},
+		{"unknown port", &Cache{RouteName: "http_proxy"}, false},
+		{"port", &Cache{RouteName: "80", ListenerPort: 80}, true},
+		{
+			"uri match",
+			&Cache{ListenerPort: 80, VirtualServices: []config.Config{virtualService(&networking.HTTPMatchRequest{
+				Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: "/"}},
+			})}},
+			true,
+		},
+		{
+			"source labels",
+			&Cache{ListenerPort: 80, VirtualServices: []config.Config{virtualService(&networking.HTTPMatchRequest{
+				SourceLabels: map[string]string{"app": "foo"},
+			})}},
+			false,
+		},
+		{
+			"source namespace",
+			&Cache{ListenerPort: 80, VirtualServices: []config.Config{virtualService(&networking.HTTPMatchRequest{
+				SourceNamespace: "foo",
+			})}},
+			false,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cache.Cacheable(); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteCacheDependentConfigs(t *testing.T) {
+	delegate := model.ConfigKey{Kind: gvk.VirtualService, Name: "delegate", Namespace: "other"}
+	r := &Cache{
+		ListenerPort: 80,
+		Services: []*model.Service{
+			{Hostname: "foo.default.svc.cluster.local", Attributes: model.ServiceAttributes{Namespace: "default"}},
+		},
+		VirtualServices: []config.Config{
+			{Meta: config.Meta{Name: "vs", Namespace: "default"}, Spec: &networking.VirtualService{}},
+		},
+		DelegateVirtualServices: []model.ConfigKey{delegate},
+		DestinationRules: []*config.Config{
+			{Meta: config.Meta{Name: "dr", Namespace: "default"}},
+		},
+		EnvoyFilterKeys: []string{"istio-system/ef"},
+	}
+	want := []model.ConfigKey{
+		{Kind: gvk.ServiceEntry, Name: "foo.default.svc.cluster.local", Namespace: "default"},
+		{Kind: gvk.VirtualService, Name: "vs", Namespace: "default"},
+		delegate,
+		{Kind: gvk.DestinationRule, Name: "dr", Namespace: "default"},
+		{Kind: gvk.EnvoyFilter, Name: "ef", Namespace: "istio-system"},
+	}
+	if got := r.DependentConfigs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestRouteCacheKey(t *testing.T) {
+	base := func() *Cache {
+		return &Cache{
+			RouteName:             "80",
+			ProxyVersion:          "1.10",
+			ClusterID:             "Kubernetes",
+			DNSDomain:             "default.svc.cluster.local",
+			OutboundTrafficPolicy: "mode:ALLOW_ANY",
+			ListenerPort:          80,
+			Services: []*model.Service{
+				{Hostname: "foo.default.svc.cluster.local", Attributes: model.ServiceAttributes{Namespace: "default"}},
+			},
+		}
+	}
+	if base().Key() != base().Key() {
+		t.Fatalf("expected key to be stable")
+	}
+	mutations := map[string]func(c *Cache){
+		"route name":      func(c *Cache) { c.RouteName = "8080" },
+		"proxy version":   func(c *Cache) { c.ProxyVersion = "1.11" },
+		"cluster id":      func(c *Cache) { c.ClusterID = "remote" },
+		"dns domain":      func(c *Cache) { c.DNSDomain = "other.svc.cluster.local" },
+		"outbound policy": func(c *Cache) { c.OutboundTrafficPolicy = "mode:REGISTRY_ONLY" },
+		"envoy filter":    func(c *Cache) { c.EnvoyFilterKeys = []string{"istio-system/ef"} },
+		"destination rule": func(c *Cache) {
+			c.DestinationRules = []*config.Config{{Meta: config.Meta{Name: "dr", Namespace: "default"}}}
+		},
+		"virtual service": func(c *Cache) {
+			c.VirtualServices = []config.Config{{Meta: config.Meta{Name: "vs", Namespace: "default"}}}
+		},
+		"service namespace": func(c *Cache) { c.Services[0].Attributes.Namespace = "other" },
+	}
+	for name, mutate := range mutations {
+		t.Run(name, func(t *testing.T) {
+			c := base()
+			mutate(c)
+			if c.Key() == base().Key() {
+				t.Errorf("expected key to change")
+			}
+		})
+	}
+}
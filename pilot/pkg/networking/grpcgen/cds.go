@@ -0,0 +1,83 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcgen
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/golang/protobuf/ptypes/any"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/pkg/log"
+)
+
+// Handle a gRPC CDS request, used with the 'ApiListener' style of requests.
+// The main difference is that the request includes Resources.
+func (g *GrpcConfigGenerator) BuildClusters(node *model.Proxy, push *model.PushContext, names []string) []*any.Any {
+	resp := []*any.Any{}
+	// gRPC doesn't currently support any of the APIs - returning just the expected EDS result.
+	// Since the code is relatively strict - we'll add info as needed.
+	for _, n := range names {
+		hostname, port, subset, err := parseClusterName(n)
+		if err != nil {
+			log.Warn("Failed to parse ", n, " ", err)
+			continue
+		}
+		rc := &cluster.Cluster{
+			Name:                 n,
+			ClusterDiscoveryType: &cluster.Cluster_Type{Type: cluster.Cluster_EDS},
+			EdsClusterConfig: &cluster.Cluster_EdsClusterConfig{
+				ServiceName: model.BuildSubsetKey(model.TrafficDirectionOutbound, subset, hostname, port),
+				EdsConfig: &core.ConfigSource{
+					ConfigSourceSpecifier: &core.ConfigSource_Ads{
+						Ads: &core.AggregatedConfigSource{},
+					},
+				},
+			},
+			TransportSocket: buildUpstreamTransportSocket(node, push, hostname, port, subset),
+		}
+		resp = append(resp, util.MessageToAny(rc))
+	}
+	return resp
+}
+
+// parseClusterName returns the destination of the cluster. The default route refers to clusters as host:port,
+// while VirtualService routes refer to the standard outbound|port|subset|host clusters, so that DestinationRule
+// subsets are resolved to the endpoints with the subset labels.
+func parseClusterName(clusterName string) (host.Name, int, string, error) {
+	if strings.HasPrefix(clusterName, string(model.TrafficDirectionOutbound)+"|") {
+		_, subset, hostname, port := model.ParseSubsetKey(clusterName)
+		if hostname == "" || port == 0 {
+			return "", 0, "", fmt.Errorf("invalid cluster name %v", clusterName)
+		}
+		return hostname, port, subset, nil
+	}
+	hn, portn, err := net.SplitHostPort(clusterName)
+	if err != nil {
+		return "", 0, "", err
+	}
+	port, err := strconv.Atoi(portn)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("invalid port in cluster name %v", clusterName)
+	}
+	return host.Name(hn), port, "", nil
+}
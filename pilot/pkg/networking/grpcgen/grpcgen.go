@@ -19,17 +19,16 @@ import (
 	"strconv"
 	"strings"
 
-	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
-	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	"github.com/golang/protobuf/ptypes/any"
 
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
+	xdsfilters "istio.io/istio/pilot/pkg/xds/filters"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
-	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/istio-agent/grpcxds"
 	"istio.io/pkg/log"
 )
 
@@ -73,6 +72,12 @@ func (g *GrpcConfigGenerator) BuildListeners(node *model.Proxy, push *model.Push
 
 	filter := map[string]bool{}
 	for _, name := range names {
+		if strings.HasPrefix(name, grpcxds.ServerListenerNamePrefix) {
+			if ll := buildInboundListener(node, push, name); ll != nil {
+				resp = append(resp, util.MessageToAny(ll))
+			}
+			continue
+		}
 		if strings.Contains(name, ":") {
 			n, _, err := net.SplitHostPort(name)
 			if err == nil {
@@ -82,6 +87,11 @@ func (g *GrpcConfigGenerator) BuildListeners(node *model.Proxy, push *model.Push
 		filter[name] = true
 	}
 
+	if len(names) > 0 && len(filter) == 0 {
+		// Only server listeners were requested.
+		return resp
+	}
+
 	for _, el := range node.SidecarScope.EgressListeners {
 		for _, sv := range el.Services() {
 			shost := string(sv.Hostname)
@@ -118,6 +128,8 @@ func (g *GrpcConfigGenerator) BuildListeners(node *model.Proxy, push *model.Push
 							RouteConfigName: hp,
 						},
 					},
+					// The fault filter applies the fault injection configured in the routes.
+					HttpFilters: []*hcm.HttpFilter{xdsfilters.Fault, xdsfilters.Router},
 				}
 				hcmAny := util.MessageToAny(hcm)
 				// TODO: for TCP listeners don't generate RDS, but some indication of cluster name.
@@ -132,89 +144,34 @@ func (g *GrpcConfigGenerator) BuildListeners(node *model.Proxy, push *model.Push
 	return resp
 }
 
-// Handle a gRPC CDS request, used with the 'ApiListener' style of requests.
-// The main difference is that the request includes Resources.
-func (g *GrpcConfigGenerator) BuildClusters(node *model.Proxy, push *model.PushContext, names []string) []*any.Any {
-	resp := []*any.Any{}
-	// gRPC doesn't currently support any of the APIs - returning just the expected EDS result.
-	// Since the code is relatively strict - we'll add info as needed.
-	for _, n := range names {
-		hn, portn, err := net.SplitHostPort(n)
-		if err != nil {
-			log.Warn("Failed to parse ", n, " ", err)
-			continue
-		}
-		rc := &cluster.Cluster{
-			Name:                 n,
-			ClusterDiscoveryType: &cluster.Cluster_Type{Type: cluster.Cluster_EDS},
-			EdsClusterConfig: &cluster.Cluster_EdsClusterConfig{
-				ServiceName: "outbound|" + portn + "||" + hn,
-				EdsConfig: &core.ConfigSource{
-					ConfigSourceSpecifier: &core.ConfigSource_Ads{
-						Ads: &core.AggregatedConfigSource{},
+// buildInboundListener returns the listener for a gRPC server, named after its listening address. gRPC only
+// reads the security configuration of the single filter chain.
+func buildInboundListener(node *model.Proxy, push *model.PushContext, name string) *listener.Listener {
+	address := strings.TrimPrefix(name, grpcxds.ServerListenerNamePrefix)
+	h, p, err := net.SplitHostPort(address)
+	if err != nil {
+		log.Warnf("gRPC: invalid server listener name %s: %v", name, err)
+		return nil
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		log.Warnf("gRPC: invalid port in server listener name %s: %v", name, err)
+		return nil
+	}
+	return &listener.Listener{
+		Name: name,
+		Address: &core.Address{
+			Address: &core.Address_SocketAddress{
+				SocketAddress: &core.SocketAddress{
+					Address: h,
+					PortSpecifier: &core.SocketAddress_PortValue{
+						PortValue: uint32(port),
 					},
 				},
 			},
-		}
-		resp = append(resp, util.MessageToAny(rc))
-	}
-	return resp
-}
-
-// handleSplitRDS supports per-VIP routes, as used by GRPC.
-// This mode is indicated by using names containing full host:port instead of just port.
-// Returns true of the request is of this type.
-func (g *GrpcConfigGenerator) BuildHTTPRoutes(node *model.Proxy, push *model.PushContext, routeNames []string) []*any.Any {
-	resp := []*any.Any{}
-
-	// Currently this mode is only used by GRPC, to extract Cluster for the default
-	// route.
-	for _, n := range routeNames {
-		hn, portn, err := net.SplitHostPort(n)
-		if err != nil {
-			log.Warn("Failed to parse ", n, " ", err)
-			continue
-		}
-		port, err := strconv.Atoi(portn)
-		if err != nil {
-			log.Warn("Failed to parse port ", n, " ", err)
-			continue
-		}
-		el := node.SidecarScope.GetEgressListenerForRDS(port, "")
-		// TODO: use VirtualServices instead !
-		// Currently gRPC doesn't support matching the path.
-		svc := el.Services()
-		for _, s := range svc {
-			if s.Hostname.Matches(host.Name(hn)) {
-				// Only generate the required route for grpc. Will need to generate more
-				// as GRPC adds more features.
-				rc := &route.RouteConfiguration{
-					Name: n,
-					VirtualHosts: []*route.VirtualHost{
-						{
-							Name:    hn,
-							Domains: []string{hn, n},
-
-							Routes: []*route.Route{
-								{
-									Match: &route.RouteMatch{
-										PathSpecifier: &route.RouteMatch_Prefix{Prefix: ""},
-									},
-									Action: &route.Route_Route{
-										Route: &route.RouteAction{
-											ClusterSpecifier: &route.RouteAction_Cluster{
-												Cluster: n,
-											},
-										},
-									},
-								},
-							},
-						},
-					},
-				}
-				resp = append(resp, util.MessageToAny(rc))
-			}
-		}
+		},
+		FilterChains: []*listener.FilterChain{{
+			TransportSocket: buildDownstreamTransportSocket(node, push, uint32(port)),
+		}},
 	}
-	return resp
 }
@@ -0,0 +1,349 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcgen
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/model"
+	istioroute "istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/route/retry"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pilot/pkg/util/sets"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/pkg/log"
+)
+
+// grpcRetryOn are the retry conditions supported by gRPC, which only retries on gRPC status codes.
+var grpcRetryOn = sets.NewSet("cancelled", "deadline-exceeded", "internal", "resource-exhausted", "unavailable")
+
+// handleSplitRDS supports per-VIP routes, as used by GRPC.
+// This mode is indicated by using names containing full host:port instead of just port.
+// Returns true of the request is of this type.
+func (g *GrpcConfigGenerator) BuildHTTPRoutes(node *model.Proxy, push *model.PushContext, routeNames []string) []*any.Any {
+	resp := []*any.Any{}
+
+	// Currently this mode is only used by GRPC, to extract Cluster for the default
+	// route.
+	for _, n := range routeNames {
+		if rc := buildHTTPRoute(node, push, n); rc != nil {
+			resp = append(resp, util.MessageToAny(rc))
+		}
+	}
+	return resp
+}
+
+func buildHTTPRoute(node *model.Proxy, push *model.PushContext, routeName string) *route.RouteConfiguration {
+	hn, portn, err := net.SplitHostPort(routeName)
+	if err != nil {
+		log.Warn("Failed to parse ", routeName, " ", err)
+		return nil
+	}
+	port, err := strconv.Atoi(portn)
+	if err != nil {
+		log.Warn("Failed to parse port ", routeName, " ", err)
+		return nil
+	}
+	el := node.SidecarScope.GetEgressListenerForRDS(port, "")
+	if el == nil {
+		return nil
+	}
+	for _, s := range el.Services() {
+		if !s.Hostname.Matches(host.Name(hn)) {
+			continue
+		}
+		routes := buildRoutesFromVirtualService(node, push, el.VirtualServices(), host.Name(hn), port)
+		if len(routes) == 0 {
+			// Only generate the required route for grpc. Will need to generate more
+			// as GRPC adds more features.
+			routes = []*route.Route{defaultSingleClusterRoute(routeName)}
+		}
+		return &route.RouteConfiguration{
+			Name: routeName,
+			VirtualHosts: []*route.VirtualHost{
+				{
+					Name:    hn,
+					Domains: []string{hn, routeName},
+					Routes:  routes,
+				},
+			},
+		}
+	}
+	return nil
+}
+
+// defaultSingleClusterRoute routes all requests to the cluster of the host. gRPC expects "" instead of "/"
+// as the default prefix.
+func defaultSingleClusterRoute(clusterName string) *route.Route {
+	return &route.Route{
+		Match: &route.RouteMatch{
+			PathSpecifier: &route.RouteMatch_Prefix{Prefix: ""},
+		},
+		Action: &route.Route_Route{
+			Route: &route.RouteAction{
+				ClusterSpecifier: &route.RouteAction_Cluster{
+					Cluster: clusterName,
+				},
+			},
+		},
+	}
+}
+
+// buildRoutesFromVirtualService translates the HTTP routes of the first VirtualService for the host into the
+// subset of route configuration supported by gRPC: weighted clusters, path and header matches, timeouts,
+// retries and fault injection. Returns nil if there is no VirtualService for the host.
+func buildRoutesFromVirtualService(node *model.Proxy, push *model.PushContext, virtualServices []config.Config,
+	hostname host.Name, port int) []*route.Route {
+	var vs *networking.VirtualService
+	var vsConfig config.Config
+	for _, cfg := range virtualServices {
+		spec := cfg.Spec.(*networking.VirtualService)
+		for _, h := range spec.Hosts {
+			if hostname.SubsetOf(host.Name(h)) {
+				vs, vsConfig = spec, cfg
+				break
+			}
+		}
+		if vs != nil {
+			break
+		}
+	}
+	if vs == nil {
+		return nil
+	}
+
+	out := make([]*route.Route, 0, len(vs.Http))
+allroutes:
+	for _, http := range vs.Http {
+		if len(http.Match) == 0 {
+			if r := translateRoute(node, push, http, nil, port); r != nil {
+				out = append(out, r)
+			}
+			// We have a rule with catch all match. Other rules are of no use.
+			break
+		}
+		for _, match := range http.Match {
+			if r := translateRoute(node, push, http, match, port); r != nil {
+				out = append(out, r)
+				if isCatchAllMatch(match) {
+					break allroutes
+				}
+			}
+		}
+	}
+	if len(out) == 0 {
+		log.Debugf("no gRPC routes generated from virtual service %s/%s for %s", vsConfig.Namespace, vsConfig.Name, hostname)
+	}
+	return out
+}
+
+func translateRoute(node *model.Proxy, push *model.PushContext, in *networking.HTTPRoute,
+	match *networking.HTTPMatchRequest, port int) *route.Route {
+	if in.Redirect != nil {
+		log.Debugf("skipping route %s: redirects are not supported by gRPC", in.Name)
+		return nil
+	}
+	if !sourceMatch(node, match, port) {
+		return nil
+	}
+	routeMatch, ok := translateRouteMatch(match)
+	if !ok {
+		log.Debugf("skipping route %s: match conditions are not supported by gRPC", in.Name)
+		return nil
+	}
+
+	action := &route.RouteAction{
+		RetryPolicy: translateRetryPolicy(in.Retries),
+	}
+	if in.Timeout != nil {
+		if timeout := util.GogoDurationToDuration(in.Timeout); timeout.AsDuration() > 0 {
+			action.MaxStreamDuration = &route.RouteAction_MaxStreamDuration{MaxStreamDuration: timeout}
+		}
+	}
+
+	weighted := make([]*route.WeightedCluster_ClusterWeight, 0, len(in.Route))
+	totalWeight := uint32(0)
+	for _, dst := range in.Route {
+		weight := uint32(dst.Weight)
+		if weight == 0 {
+			// Ignore 0 weighted clusters if there are other clusters in the route.
+			if len(in.Route) != 1 {
+				continue
+			}
+			weight = 100
+		}
+		svc := push.ServiceForHostname(node, host.Name(dst.GetDestination().GetHost()))
+		weighted = append(weighted, &route.WeightedCluster_ClusterWeight{
+			Name:   istioroute.GetDestinationCluster(dst.Destination, svc, port),
+			Weight: &wrappers.UInt32Value{Value: weight},
+		})
+		totalWeight += weight
+	}
+	if len(weighted) == 0 {
+		return nil
+	}
+	if len(weighted) == 1 {
+		action.ClusterSpecifier = &route.RouteAction_Cluster{Cluster: weighted[0].Name}
+	} else {
+		action.ClusterSpecifier = &route.RouteAction_WeightedClusters{
+			WeightedClusters: &route.WeightedCluster{
+				Clusters:    weighted,
+				TotalWeight: &wrappers.UInt32Value{Value: totalWeight},
+			},
+		}
+	}
+
+	out := &route.Route{
+		Name:   in.Name,
+		Match:  routeMatch,
+		Action: &route.Route_Route{Route: action},
+	}
+	if match != nil && match.Name != "" {
+		out.Name = out.Name + "." + match.Name
+	}
+	if fault := istioroute.TranslateFault(in.Fault); fault != nil {
+		out.TypedPerFilterConfig = map[string]*any.Any{wellknown.Fault: util.MessageToAny(fault)}
+	}
+	return out
+}
+
+// sourceMatch checks the conditions of the match which depend on the client and the listener port.
+func sourceMatch(node *model.Proxy, match *networking.HTTPMatchRequest, port int) bool {
+	if match == nil {
+		return true
+	}
+	if match.Port != 0 && match.Port != uint32(port) {
+		return false
+	}
+	if len(match.Gateways) > 0 {
+		found := false
+		for _, gw := range match.Gateways {
+			if gw == constants.IstioMeshGateway {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if node.Metadata == nil {
+		return len(match.SourceLabels) == 0 && match.SourceNamespace == ""
+	}
+	if len(match.SourceLabels) > 0 && !labels.Instance(match.SourceLabels).SubsetOf(node.Metadata.Labels) {
+		return false
+	}
+	if match.SourceNamespace != "" && match.SourceNamespace != node.Metadata.Namespace {
+		return false
+	}
+	return true
+}
+
+// translateRouteMatch translates the match conditions supported by gRPC. If the match has conditions
+// gRPC can not evaluate, false is returned, as skipping the conditions would make the route match too broadly.
+func translateRouteMatch(in *networking.HTTPMatchRequest) (*route.RouteMatch, bool) {
+	out := &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: ""}}
+	if in == nil {
+		return out, true
+	}
+	if len(in.QueryParams) > 0 || in.Method != nil || in.Scheme != nil || in.Authority != nil {
+		return nil, false
+	}
+
+	for name, stringMatch := range in.Headers {
+		out.Headers = append(out.Headers, istioroute.TranslateHeaderMatch(name, stringMatch))
+	}
+	for name, stringMatch := range in.WithoutHeaders {
+		matcher := istioroute.TranslateHeaderMatch(name, stringMatch)
+		matcher.InvertMatch = true
+		out.Headers = append(out.Headers, matcher)
+	}
+	// guarantee ordering of headers
+	sort.Slice(out.Headers, func(i, j int) bool {
+		return out.Headers[i].Name < out.Headers[j].Name
+	})
+
+	if in.Uri != nil {
+		switch m := in.Uri.MatchType.(type) {
+		case *networking.StringMatch_Exact:
+			out.PathSpecifier = &route.RouteMatch_Path{Path: m.Exact}
+		case *networking.StringMatch_Prefix:
+			out.PathSpecifier = &route.RouteMatch_Prefix{Prefix: m.Prefix}
+		case *networking.StringMatch_Regex:
+			out.PathSpecifier = &route.RouteMatch_SafeRegex{
+				SafeRegex: &matcher.RegexMatcher{
+					// nolint: staticcheck
+					EngineType: &matcher.RegexMatcher_GoogleRe2{GoogleRe2: &matcher.RegexMatcher_GoogleRE2{}},
+					Regex:      m.Regex,
+				},
+			}
+		}
+	}
+	if in.IgnoreUriCase {
+		out.CaseSensitive = &wrappers.BoolValue{Value: false}
+	}
+	return out, true
+}
+
+// isCatchAllMatch returns true if the match routes all requests, so that following routes are never matched.
+func isCatchAllMatch(m *networking.HTTPMatchRequest) bool {
+	if m == nil {
+		return true
+	}
+	if len(m.Headers) > 0 || len(m.WithoutHeaders) > 0 || len(m.QueryParams) > 0 || m.Method != nil ||
+		m.Scheme != nil || m.Authority != nil || len(m.SourceLabels) > 0 || m.SourceNamespace != "" || m.Port != 0 {
+		return false
+	}
+	if m.Uri == nil {
+		return true
+	}
+	prefix, ok := m.Uri.MatchType.(*networking.StringMatch_Prefix)
+	return ok && (prefix.Prefix == "" || prefix.Prefix == "/")
+}
+
+// translateRetryPolicy converts the retry policy, keeping only the retry conditions and settings supported by gRPC.
+func translateRetryPolicy(in *networking.HTTPRetry) *route.RetryPolicy {
+	policy := retry.ConvertPolicy(in)
+	if policy == nil {
+		return nil
+	}
+	retryOn := make([]string, 0)
+	for _, r := range strings.Split(policy.RetryOn, ",") {
+		if r = strings.TrimSpace(r); grpcRetryOn.Contains(r) {
+			retryOn = append(retryOn, r)
+		}
+	}
+	if len(retryOn) == 0 {
+		return nil
+	}
+	return &route.RetryPolicy{
+		RetryOn:      strings.Join(retryOn, ","),
+		NumRetries:   policy.NumRetries,
+		RetryBackOff: policy.RetryBackOff,
+	}
+}
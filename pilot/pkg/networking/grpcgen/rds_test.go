@@ -0,0 +1,291 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcgen_test
+
+import (
+	"testing"
+	"time"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	fault "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/fault/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3"
+	"istio.io/istio/pilot/pkg/networking/grpcgen"
+)
+
+const grpcServices = `
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: echo
+  namespace: default
+spec:
+  hosts:
+  - echo.default.svc.cluster.local
+  addresses:
+  - 1.2.3.4
+  ports:
+  - number: 7070
+    name: grpc
+    protocol: GRPC
+  location: MESH_INTERNAL
+  resolution: STATIC
+  endpoints:
+  - address: 10.0.0.1
+    labels:
+      version: v1
+  - address: 10.0.0.2
+    labels:
+      version: v2
+---
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: plain
+  namespace: default
+spec:
+  hosts:
+  - plain.default.svc.cluster.local
+  addresses:
+  - 1.2.3.5
+  ports:
+  - number: 7070
+    name: grpc
+    protocol: GRPC
+  location: MESH_INTERNAL
+  resolution: STATIC
+  endpoints:
+  - address: 10.0.0.3
+---
+apiVersion: networking.istio.io/v1alpha3
+kind: DestinationRule
+metadata:
+  name: echo
+  namespace: default
+spec:
+  host: echo.default.svc.cluster.local
+  subsets:
+  - name: v1
+    labels:
+      version: v1
+  - name: v2
+    labels:
+      version: v2
+`
+
+func TestBuildHTTPRoutes(t *testing.T) {
+	cases := []struct {
+		name           string
+		virtualService string
+		want           []*route.Route
+	}{
+		{
+			name: "no virtual service",
+			want: []*route.Route{{
+				Match:  &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: ""}},
+				Action: clusterAction("echo.default.svc.cluster.local:7070"),
+			}},
+		},
+		{
+			name: "weighted subsets",
+			virtualService: `
+apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: echo
+  namespace: default
+spec:
+  hosts:
+  - echo.default.svc.cluster.local
+  http:
+  - name: split
+    retries:
+      attempts: 3
+      retryOn: unavailable,5xx,deadline-exceeded
+    timeout: 5s
+    route:
+    - destination:
+        host: echo.default.svc.cluster.local
+        subset: v1
+      weight: 80
+    - destination:
+        host: echo.default.svc.cluster.local
+        subset: v2
+      weight: 20
+`,
+			want: []*route.Route{{
+				Name:  "split",
+				Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: ""}},
+				Action: &route.Route_Route{Route: &route.RouteAction{
+					ClusterSpecifier: &route.RouteAction_WeightedClusters{WeightedClusters: &route.WeightedCluster{
+						Clusters: []*route.WeightedCluster_ClusterWeight{
+							{Name: "outbound|7070|v1|echo.default.svc.cluster.local", Weight: uint32Value(80)},
+							{Name: "outbound|7070|v2|echo.default.svc.cluster.local", Weight: uint32Value(20)},
+						},
+						TotalWeight: uint32Value(100),
+					}},
+					RetryPolicy: &route.RetryPolicy{
+						RetryOn:    "unavailable,deadline-exceeded",
+						NumRetries: uint32Value(3),
+					},
+					MaxStreamDuration: &route.RouteAction_MaxStreamDuration{MaxStreamDuration: durationpb.New(5 * time.Second)},
+				}},
+			}},
+		},
+		{
+			name: "matches and fault",
+			virtualService: `
+apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: echo
+  namespace: default
+spec:
+  hosts:
+  - echo.default.svc.cluster.local
+  http:
+  - name: unsupported
+    match:
+    - queryParams:
+        debug:
+          exact: "true"
+    route:
+    - destination:
+        host: echo.default.svc.cluster.local
+        subset: v2
+  - name: header
+    match:
+    - headers:
+        x-user:
+          exact: tester
+      uri:
+        prefix: /echo.EchoTestService/
+    fault:
+      abort:
+        httpStatus: 503
+        percentage:
+          value: 50
+    retries:
+      attempts: 0
+    route:
+    - destination:
+        host: echo.default.svc.cluster.local
+        subset: v2
+  - name: default
+    route:
+    - destination:
+        host: echo.default.svc.cluster.local
+        subset: v1
+`,
+			want: []*route.Route{
+				{
+					Name: "header",
+					Match: &route.RouteMatch{
+						PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/echo.EchoTestService/"},
+						Headers: []*route.HeaderMatcher{{
+							Name:                 "x-user",
+							HeaderMatchSpecifier: &route.HeaderMatcher_ExactMatch{ExactMatch: "tester"},
+						}},
+					},
+					Action: clusterAction("outbound|7070|v2|echo.default.svc.cluster.local"),
+				},
+				{
+					Name:  "default",
+					Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: ""}},
+					Action: &route.Route_Route{Route: &route.RouteAction{
+						ClusterSpecifier: &route.RouteAction_Cluster{Cluster: "outbound|7070|v1|echo.default.svc.cluster.local"},
+						RetryPolicy:      &route.RetryPolicy{RetryOn: "unavailable,cancelled", NumRetries: uint32Value(2)},
+					}},
+				},
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{ConfigString: grpcServices + "---" + tt.virtualService})
+			g := &grpcgen.GrpcConfigGenerator{}
+			resources := g.BuildHTTPRoutes(cg.SetupProxy(nil), cg.PushContext(), []string{"echo.default.svc.cluster.local:7070"})
+			if len(resources) != 1 {
+				t.Fatalf("expected 1 route configuration, got %d", len(resources))
+			}
+			rc := &route.RouteConfiguration{}
+			if err := resources[0].UnmarshalTo(rc); err != nil {
+				t.Fatal(err)
+			}
+			if len(rc.VirtualHosts) != 1 {
+				t.Fatalf("expected 1 virtual host, got %v", rc.VirtualHosts)
+			}
+			got := rc.VirtualHosts[0].Routes
+			// Fault injection is checked separately, as the typed config is opaque.
+			var faults []*fault.HTTPFault
+			for _, r := range got {
+				if cfg, f := r.TypedPerFilterConfig[wellknown.Fault]; f {
+					hf := &fault.HTTPFault{}
+					if err := cfg.UnmarshalTo(hf); err != nil {
+						t.Fatal(err)
+					}
+					faults = append(faults, hf)
+					r.TypedPerFilterConfig = nil
+				}
+			}
+			if diff := cmp.Diff(tt.want, got, protocmp.Transform()); diff != "" {
+				t.Fatalf("unexpected routes: %v", diff)
+			}
+			if tt.name == "matches and fault" {
+				if len(faults) != 1 || faults[0].GetAbort().GetHttpStatus() != 503 {
+					t.Fatalf("expected abort fault, got %v", faults)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildClusters(t *testing.T) {
+	cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{ConfigString: grpcServices})
+	g := &grpcgen.GrpcConfigGenerator{}
+	names := []string{"echo.default.svc.cluster.local:7070", "outbound|7070|v1|echo.default.svc.cluster.local", "invalid"}
+	resources := g.BuildClusters(cg.SetupProxy(nil), cg.PushContext(), names)
+	got := map[string]string{}
+	for _, r := range resources {
+		c := &cluster.Cluster{}
+		if err := r.UnmarshalTo(c); err != nil {
+			t.Fatal(err)
+		}
+		got[c.Name] = c.GetEdsClusterConfig().GetServiceName()
+	}
+	want := map[string]string{
+		"echo.default.svc.cluster.local:7070":             "outbound|7070||echo.default.svc.cluster.local",
+		"outbound|7070|v1|echo.default.svc.cluster.local": "outbound|7070|v1|echo.default.svc.cluster.local",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected clusters: %v", diff)
+	}
+}
+
+func clusterAction(cluster string) *route.Route_Route {
+	return &route.Route_Route{Route: &route.RouteAction{
+		ClusterSpecifier: &route.RouteAction_Cluster{Cluster: cluster},
+	}}
+}
+
+func uint32Value(v uint32) *wrappers.UInt32Value {
+	return &wrappers.UInt32Value{Value: v}
+}
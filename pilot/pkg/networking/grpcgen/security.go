@@ -0,0 +1,131 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcgen
+
+import (
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pilot/pkg/security/authn/factory"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/istio-agent/grpcxds"
+	protovalue "istio.io/istio/pkg/proto"
+	"istio.io/pkg/log"
+)
+
+// gRPC doesn't use SDS: the certificates are read by the certificate provider instance configured in the
+// bootstrap generated by the agent, and the security configuration only references the instance.
+
+// buildUpstreamTransportSocket returns the mTLS transport socket for a cluster, or nil if the destination
+// is plaintext.
+//
+// Unlike Envoy, gRPC can't pick TLS per endpoint, so auto mTLS is only used for destinations known to
+// require it - i.e. in a STRICT mesh or namespace. PERMISSIVE destinations accept plaintext.
+func buildUpstreamTransportSocket(node *model.Proxy, push *model.PushContext,
+	hostname host.Name, portNum int, subset string) *core.TransportSocket {
+	svc := push.ServiceForHostname(node, hostname)
+	if svc == nil {
+		return nil
+	}
+	port, f := svc.Ports.GetByPort(portNum)
+	if !f {
+		return nil
+	}
+
+	var policy *networking.TrafficPolicy
+	if cfg := push.DestinationRule(node, svc); cfg != nil {
+		dr := cfg.Spec.(*networking.DestinationRule)
+		policy = v1alpha3.MergeTrafficPolicy(nil, dr.TrafficPolicy, port)
+		for _, s := range dr.Subsets {
+			if s.Name == subset {
+				policy = v1alpha3.MergeTrafficPolicy(policy, s.TrafficPolicy, port)
+				break
+			}
+		}
+	}
+
+	tlsSettings := policy.GetTls()
+	switch {
+	case tlsSettings == nil:
+		if !push.Mesh.GetEnableAutoMtls().GetValue() ||
+			push.BestEffortInferServiceMTLSMode(policy, svc, port) != model.MTLSStrict {
+			return nil
+		}
+	case tlsSettings.Mode == networking.ClientTLSSettings_DISABLE:
+		return nil
+	case tlsSettings.Mode != networking.ClientTLSSettings_ISTIO_MUTUAL:
+		// SIMPLE and MUTUAL use certificates from secrets, which aren't available to gRPC.
+		log.Warnf("gRPC: TLS mode %v of %s is not supported, using plaintext", tlsSettings.Mode, hostname)
+		return nil
+	}
+
+	sans := tlsSettings.GetSubjectAltNames()
+	if len(sans) == 0 {
+		sans = push.ServiceAccounts[hostname][portNum]
+	}
+	ctx := &tls.UpstreamTlsContext{
+		CommonTlsContext: buildCommonTLSContext(sans),
+	}
+	return &core.TransportSocket{
+		Name:       util.EnvoyTLSSocketName,
+		ConfigType: &core.TransportSocket_TypedConfig{TypedConfig: util.MessageToAny(ctx)},
+	}
+}
+
+// buildDownstreamTransportSocket returns the mTLS transport socket for a gRPC server listening on the
+// given port, or nil if the server accepts plaintext.
+//
+// gRPC servers can't detect the protocol of the connection, so PERMISSIVE mode accepts plaintext only.
+func buildDownstreamTransportSocket(node *model.Proxy, push *model.PushContext, port uint32) *core.TransportSocket {
+	applier := factory.NewPolicyApplier(push, node.Metadata.Namespace, labels.Collection{node.Metadata.Labels})
+	if applier.GetMutualTLSModeForPort(port) != model.MTLSStrict {
+		return nil
+	}
+	ctx := &tls.DownstreamTlsContext{
+		CommonTlsContext:         buildCommonTLSContext(nil),
+		RequireClientCertificate: protovalue.BoolTrue,
+	}
+	return &core.TransportSocket{
+		Name:       util.EnvoyTLSSocketName,
+		ConfigType: &core.TransportSocket_TypedConfig{TypedConfig: util.MessageToAny(ctx)},
+	}
+}
+
+// buildCommonTLSContext returns the TLS context using the workload certificate and the mesh root from the
+// file watcher certificate provider, verifying the peer identity against the subject alt names if set.
+func buildCommonTLSContext(sans []string) *tls.CommonTlsContext {
+	return &tls.CommonTlsContext{
+		TlsCertificateCertificateProviderInstance: &tls.CommonTlsContext_CertificateProviderInstance{
+			InstanceName:    grpcxds.FileWatcherCertProviderInstance,
+			CertificateName: grpcxds.WorkloadCertName,
+		},
+		ValidationContextType: &tls.CommonTlsContext_CombinedValidationContext{
+			CombinedValidationContext: &tls.CommonTlsContext_CombinedCertificateValidationContext{
+				DefaultValidationContext: &tls.CertificateValidationContext{
+					MatchSubjectAltNames: util.StringToExactMatch(sans),
+				},
+				ValidationContextCertificateProviderInstance: &tls.CommonTlsContext_CertificateProviderInstance{
+					InstanceName:    grpcxds.FileWatcherCertProviderInstance,
+					CertificateName: grpcxds.RootCertName,
+				},
+			},
+		},
+	}
+}
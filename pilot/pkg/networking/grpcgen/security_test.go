@@ -0,0 +1,209 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcgen_test
+
+import (
+	"testing"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"github.com/golang/protobuf/ptypes/any"
+
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3"
+	"istio.io/istio/pilot/pkg/networking/grpcgen"
+	"istio.io/istio/pkg/istio-agent/grpcxds"
+)
+
+const strictPeerAuthentication = `
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: default
+  namespace: default
+spec:
+  mtls:
+    mode: STRICT
+`
+
+const plainDestinationRule = `
+apiVersion: networking.istio.io/v1alpha3
+kind: DestinationRule
+metadata:
+  name: plain
+  namespace: default
+spec:
+  host: plain.default.svc.cluster.local
+  trafficPolicy:
+    tls:
+      mode: ISTIO_MUTUAL
+      subjectAltNames:
+      - spiffe://cluster.local/ns/default/sa/plain
+  subsets:
+  - name: legacy
+    labels:
+      version: legacy
+    trafficPolicy:
+      tls:
+        mode: DISABLE
+`
+
+func TestBuildClustersSecurity(t *testing.T) {
+	cases := []struct {
+		name    string
+		configs string
+		// Expected SANs per cluster, nil for plaintext clusters.
+		want map[string][]string
+	}{
+		{
+			name:    "permissive",
+			configs: grpcServices,
+			want: map[string][]string{
+				"echo.default.svc.cluster.local:7070":             nil,
+				"outbound|7070|v1|echo.default.svc.cluster.local": nil,
+			},
+		},
+		{
+			name:    "strict",
+			configs: grpcServices + "---" + strictPeerAuthentication,
+			want: map[string][]string{
+				"echo.default.svc.cluster.local:7070":             {},
+				"outbound|7070|v1|echo.default.svc.cluster.local": {},
+			},
+		},
+		{
+			name:    "destination rule",
+			configs: grpcServices + "---" + plainDestinationRule,
+			want: map[string][]string{
+				"plain.default.svc.cluster.local:7070":                 {"spiffe://cluster.local/ns/default/sa/plain"},
+				"outbound|7070|legacy|plain.default.svc.cluster.local": nil,
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{ConfigString: tt.configs})
+			g := &grpcgen.GrpcConfigGenerator{}
+			names := make([]string, 0, len(tt.want))
+			for n := range tt.want {
+				names = append(names, n)
+			}
+			resources := g.BuildClusters(cg.SetupProxy(nil), cg.PushContext(), names)
+			if len(resources) != len(tt.want) {
+				t.Fatalf("expected %d clusters, got %d", len(tt.want), len(resources))
+			}
+			for _, r := range resources {
+				c := &cluster.Cluster{}
+				if err := r.UnmarshalTo(c); err != nil {
+					t.Fatal(err)
+				}
+				want := tt.want[c.Name]
+				if want == nil {
+					if c.TransportSocket != nil {
+						t.Errorf("%s: expected plaintext, got %v", c.Name, c.TransportSocket)
+					}
+					continue
+				}
+				ctx := &tls.UpstreamTlsContext{}
+				if err := transportSocketConfig(t, c.TransportSocket).UnmarshalTo(ctx); err != nil {
+					t.Fatal(err)
+				}
+				validation := checkCommonTLSContext(t, ctx.CommonTlsContext)
+				var sans []string
+				for _, m := range validation.GetDefaultValidationContext().GetMatchSubjectAltNames() {
+					sans = append(sans, m.GetExact())
+				}
+				if len(sans) != len(want) || (len(want) > 0 && sans[0] != want[0]) {
+					t.Errorf("%s: expected SANs %v, got %v", c.Name, want, sans)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildServerListenerSecurity(t *testing.T) {
+	name := grpcxds.ServerListenerNamePrefix + "1.1.1.1:8080"
+	cases := []struct {
+		name    string
+		configs string
+		mtls    bool
+	}{
+		{"permissive", grpcServices, false},
+		{"strict", grpcServices + "---" + strictPeerAuthentication, true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{ConfigString: tt.configs})
+			g := &grpcgen.GrpcConfigGenerator{}
+			resources := g.BuildListeners(cg.SetupProxy(nil), cg.PushContext(), []string{name})
+			if len(resources) != 1 {
+				t.Fatalf("expected 1 listener, got %d", len(resources))
+			}
+			l := &listener.Listener{}
+			if err := resources[0].UnmarshalTo(l); err != nil {
+				t.Fatal(err)
+			}
+			if l.Name != name || l.GetAddress().GetSocketAddress().GetAddress() != "1.1.1.1" ||
+				l.GetAddress().GetSocketAddress().GetPortValue() != 8080 {
+				t.Fatalf("unexpected listener %v", l)
+			}
+			if len(l.FilterChains) != 1 {
+				t.Fatalf("expected 1 filter chain, got %v", l.FilterChains)
+			}
+			ts := l.FilterChains[0].TransportSocket
+			if !tt.mtls {
+				if ts != nil {
+					t.Fatalf("expected plaintext, got %v", ts)
+				}
+				return
+			}
+			ctx := &tls.DownstreamTlsContext{}
+			if err := transportSocketConfig(t, ts).UnmarshalTo(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if !ctx.GetRequireClientCertificate().GetValue() {
+				t.Fatalf("expected client certificate to be required")
+			}
+			checkCommonTLSContext(t, ctx.CommonTlsContext)
+		})
+	}
+}
+
+func transportSocketConfig(t *testing.T, ts *core.TransportSocket) *any.Any {
+	t.Helper()
+	if ts == nil {
+		t.Fatalf("expected mTLS transport socket")
+	}
+	if ts.Name != "envoy.transport_sockets.tls" {
+		t.Fatalf("unexpected transport socket %v", ts.Name)
+	}
+	return ts.GetTypedConfig()
+}
+
+// checkCommonTLSContext verifies the TLS context references the certificate provider instance of the gRPC bootstrap.
+func checkCommonTLSContext(t *testing.T, ctx *tls.CommonTlsContext) *tls.CommonTlsContext_CombinedCertificateValidationContext {
+	t.Helper()
+	identity := ctx.GetTlsCertificateCertificateProviderInstance()
+	if identity.GetInstanceName() != grpcxds.FileWatcherCertProviderInstance || identity.GetCertificateName() != grpcxds.WorkloadCertName {
+		t.Fatalf("unexpected identity certificate provider %v", identity)
+	}
+	validation := ctx.GetCombinedValidationContext()
+	root := validation.GetValidationContextCertificateProviderInstance()
+	if root.GetInstanceName() != grpcxds.FileWatcherCertProviderInstance || root.GetCertificateName() != grpcxds.RootCertName {
+		t.Fatalf("unexpected root certificate provider %v", root)
+	}
+	return validation
+}
@@ -0,0 +1,451 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package file implements a service registry backed by a directory of YAML or JSON files describing services and
+// their endpoints, for workloads that are catalogued outside of Kubernetes. The directory is watched, and the
+// registry is updated when the files change.
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/atomic"
+
+	"istio.io/api/label"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/spiffe"
+	"istio.io/pkg/log"
+)
+
+var supportedExtensions = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+}
+
+const watchDebounceDelay = 100 * time.Millisecond
+
+// Options for the file registry.
+type Options struct {
+	// Root is the directory containing the definition files. Sub directories are ignored.
+	Root string
+	// ClusterID of the registry, used as the shard of the endpoints.
+	ClusterID string
+	// XDSUpdater is notified of the service and endpoint changes.
+	XDSUpdater model.XDSUpdater
+}
+
+// service is a service of the registry, with the definition it was built from.
+type service struct {
+	definition *ServiceDefinition
+	// file the service is defined in.
+	file      string
+	service   *model.Service
+	instances []*model.ServiceInstance
+}
+
+func (s *service) endpoints() []*model.IstioEndpoint {
+	out := make([]*model.IstioEndpoint, 0, len(s.instances))
+	for _, instance := range s.instances {
+		out = append(out, instance.Endpoint)
+	}
+	return out
+}
+
+// Controller is a service registry reading the services from a directory. Each file is loaded independently: a
+// file that can't be read or is invalid keeps its last valid content, without affecting the other files.
+type Controller struct {
+	opts Options
+
+	mutex sync.RWMutex
+	// definitions are the last valid definitions of each file, keyed by path.
+	definitions map[string]*Definitions
+	services    map[host.Name]*service
+	// ip2instances indexes the instances by endpoint address, to find the instances of proxies.
+	ip2instances map[string][]*model.ServiceInstance
+
+	handlers []func(*model.Service, model.Event)
+	synced   *atomic.Bool
+}
+
+var _ serviceregistry.Instance = &Controller{}
+
+// NewController creates a file registry. The files are loaded when the controller runs.
+func NewController(opts Options) *Controller {
+	return &Controller{
+		opts:         opts,
+		definitions:  map[string]*Definitions{},
+		services:     map[host.Name]*service{},
+		ip2instances: map[string][]*model.ServiceInstance{},
+		synced:       atomic.NewBool(false),
+	}
+}
+
+// Provider implements serviceregistry.Instance.
+func (c *Controller) Provider() serviceregistry.ProviderID {
+	return serviceregistry.File
+}
+
+// Cluster implements serviceregistry.Instance.
+func (c *Controller) Cluster() string {
+	return c.opts.ClusterID
+}
+
+// AppendServiceHandler implements model.Controller.
+func (c *Controller) AppendServiceHandler(f func(*model.Service, model.Event)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.handlers = append(c.handlers, f)
+}
+
+// AppendWorkloadHandler implements model.Controller. The endpoints of the registry are not workloads known to the
+// other registries, so there are no workload events.
+func (c *Controller) AppendWorkloadHandler(func(*model.WorkloadInstance, model.Event)) {}
+
+// HasSynced implements model.Controller, it returns true once the directory has been loaded.
+func (c *Controller) HasSynced() bool {
+	return c.synced.Load()
+}
+
+// Run implements model.Controller. It loads the directory, then reloads it whenever it changes.
+func (c *Controller) Run(stop <-chan struct{}) {
+	c.Reload()
+	c.synced.Store(true)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Errorf("file registry: failed to watch %s, changes will be ignored: %v", c.opts.Root, err)
+		return
+	}
+	defer watcher.Close()
+	if err := watcher.Add(c.opts.Root); err != nil {
+		log.Errorf("file registry: failed to watch %s, changes will be ignored: %v", c.opts.Root, err)
+		return
+	}
+	var debounceC <-chan time.Time
+	for {
+		select {
+		case <-debounceC:
+			debounceC = nil
+			c.Reload()
+		case <-watcher.Events:
+			if debounceC == nil {
+				debounceC = time.After(watchDebounceDelay)
+			}
+		case err := <-watcher.Errors:
+			log.Warnf("file registry: error watching %s: %v", c.opts.Root, err)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Reload reads the directory and updates the registry.
+func (c *Controller) Reload() {
+	entries, err := os.ReadDir(c.opts.Root)
+	if err != nil {
+		// Keep the current services, the directory may be temporarily unavailable.
+		log.Errorf("file registry: failed to read %s: %v", c.opts.Root, err)
+		return
+	}
+
+	c.mutex.RLock()
+	previous := c.definitions
+	c.mutex.RUnlock()
+
+	definitions := map[string]*Definitions{}
+	for _, entry := range entries {
+		if !supportedExtensions[filepath.Ext(entry.Name())] {
+			continue
+		}
+		path := filepath.Join(c.opts.Root, entry.Name())
+		// Stat follows the symlinks of mounted config maps.
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		defs, err := readDefinitions(path)
+		if err != nil {
+			if prev, f := previous[path]; f {
+				log.Errorf("file registry: %v, keeping the previous content", err)
+				definitions[path] = prev
+			} else {
+				log.Errorf("file registry: %v", err)
+			}
+			continue
+		}
+		definitions[path] = defs
+	}
+
+	c.update(definitions)
+}
+
+// update replaces the definitions of the registry and sends the events of the changed services.
+func (c *Controller) update(definitions map[string]*Definitions) {
+	paths := make([]string, 0, len(definitions))
+	for path := range definitions {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	c.mutex.Lock()
+	previous := c.services
+	services := map[host.Name]*service{}
+	for _, path := range paths {
+		for _, def := range definitions[path].Services {
+			hostname := host.Name(def.Hostname)
+			if existing, f := services[hostname]; f {
+				log.Warnf("file registry: service %s of %s is already defined in %s, ignoring it", hostname, path, existing.file)
+				continue
+			}
+			old := previous[hostname]
+			if old != nil && old.file == path && reflect.DeepEqual(old.definition, def) {
+				services[hostname] = old
+				continue
+			}
+			svc := &service{definition: def, file: path}
+			svc.service = c.convertService(def)
+			if old != nil && serviceEqual(old.definition, def) {
+				// Keep the model service when only the endpoints change, so that it stays the same for the
+				// instances that were already pushed.
+				svc.service = old.service
+			}
+			svc.instances = c.convertInstances(svc.service, def)
+			services[hostname] = svc
+		}
+	}
+	ip2instances := map[string][]*model.ServiceInstance{}
+	for _, svc := range services {
+		for _, instance := range svc.instances {
+			ip2instances[instance.Endpoint.Address] = append(ip2instances[instance.Endpoint.Address], instance)
+		}
+	}
+	c.definitions = definitions
+	c.services = services
+	c.ip2instances = ip2instances
+	handlers := c.handlers
+	c.mutex.Unlock()
+
+	notify := func(svc *model.Service, event model.Event) {
+		for _, h := range handlers {
+			h(svc, event)
+		}
+	}
+	for hostname, old := range previous {
+		if _, f := services[hostname]; !f {
+			log.Infof("file registry: deleted service %s", hostname)
+			c.svcUpdate(old.service, model.EventDelete)
+			notify(old.service, model.EventDelete)
+		}
+	}
+	for hostname, svc := range services {
+		old, f := previous[hostname]
+		switch {
+		case !f:
+			log.Infof("file registry: added service %s", hostname)
+			c.svcUpdate(svc.service, model.EventAdd)
+			c.edsUpdate(svc)
+			notify(svc.service, model.EventAdd)
+		case old == svc:
+		case old.service != svc.service:
+			log.Infof("file registry: updated service %s", hostname)
+			c.svcUpdate(svc.service, model.EventUpdate)
+			c.edsUpdate(svc)
+			notify(svc.service, model.EventUpdate)
+		default:
+			// Only the endpoints changed, an EDS push is enough.
+			c.edsUpdate(svc)
+		}
+	}
+}
+
+func (c *Controller) svcUpdate(svc *model.Service, event model.Event) {
+	if c.opts.XDSUpdater == nil {
+		return
+	}
+	c.opts.XDSUpdater.SvcUpdate(c.Cluster(), string(svc.Hostname), svc.Attributes.Namespace, event)
+}
+
+func (c *Controller) edsUpdate(svc *service) {
+	if c.opts.XDSUpdater == nil {
+		return
+	}
+	c.opts.XDSUpdater.EDSUpdate(c.Cluster(), string(svc.service.Hostname), svc.service.Attributes.Namespace, svc.endpoints())
+}
+
+// serviceEqual returns true if the definitions only differ by their endpoints.
+func serviceEqual(a, b *ServiceDefinition) bool {
+	ac, bc := *a, *b
+	ac.Endpoints, bc.Endpoints = nil, nil
+	return reflect.DeepEqual(ac, bc)
+}
+
+func (c *Controller) convertService(def *ServiceDefinition) *model.Service {
+	address := def.Address
+	if address == "" {
+		address = constants.UnspecifiedIP
+	}
+	ports := make(model.PortList, 0, len(def.Ports))
+	for _, p := range def.Ports {
+		ports = append(ports, &model.Port{
+			Name:     p.Name,
+			Port:     int(p.Port),
+			Protocol: protocol.Parse(p.Protocol),
+		})
+	}
+	return &model.Service{
+		CreationTime: time.Now(),
+		Hostname:     host.Name(def.Hostname),
+		Address:      address,
+		Ports:        ports,
+		Resolution:   model.ClientSideLB,
+		Attributes: model.ServiceAttributes{
+			ServiceRegistry: string(serviceregistry.File),
+			Name:            def.Hostname,
+			Namespace:       def.Namespace,
+			Labels:          def.Labels,
+		},
+		ServiceAccounts: def.SubjectAltNames,
+	}
+}
+
+func (c *Controller) convertInstances(svc *model.Service, def *ServiceDefinition) []*model.ServiceInstance {
+	out := make([]*model.ServiceInstance, 0, len(def.Endpoints)*len(def.Ports))
+	for _, ep := range def.Endpoints {
+		tlsMode := model.DisabledTLSModeLabel
+		if val, f := ep.Labels[label.SecurityTlsMode.Name]; f {
+			tlsMode = val
+		} else if ep.ServiceAccount != "" {
+			tlsMode = model.IstioMutualTLSModeLabel
+		}
+		sa := ""
+		if ep.ServiceAccount != "" {
+			sa = spiffe.MustGenSpiffeURI(def.Namespace, ep.ServiceAccount)
+		}
+		for i, p := range def.Ports {
+			port := ep.Ports[p.Name]
+			if port == 0 {
+				port = p.TargetPort
+			}
+			if port == 0 {
+				port = p.Port
+			}
+			out = append(out, &model.ServiceInstance{
+				Service:     svc,
+				ServicePort: svc.Ports[i],
+				Endpoint: &model.IstioEndpoint{
+					Address:         ep.Address,
+					EndpointPort:    port,
+					ServicePortName: p.Name,
+					Labels:          ep.Labels,
+					ServiceAccount:  sa,
+					Network:         ep.Network,
+					Locality: model.Locality{
+						Label:     ep.Locality,
+						ClusterID: c.opts.ClusterID,
+					},
+					LbWeight:  ep.Weight,
+					TLSMode:   tlsMode,
+					Namespace: def.Namespace,
+				},
+			})
+		}
+	}
+	return out
+}
+
+// Services implements model.ServiceDiscovery.
+func (c *Controller) Services() ([]*model.Service, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	out := make([]*model.Service, 0, len(c.services))
+	for _, svc := range c.services {
+		out = append(out, svc.service)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Hostname < out[j].Hostname
+	})
+	return out, nil
+}
+
+// GetService implements model.ServiceDiscovery.
+func (c *Controller) GetService(hostname host.Name) (*model.Service, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if svc, f := c.services[hostname]; f {
+		return svc.service, nil
+	}
+	return nil, nil
+}
+
+// InstancesByPort implements model.ServiceDiscovery.
+func (c *Controller) InstancesByPort(svc *model.Service, port int, labels labels.Collection) []*model.ServiceInstance {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	s, f := c.services[svc.Hostname]
+	if !f {
+		return nil
+	}
+	out := make([]*model.ServiceInstance, 0)
+	for _, instance := range s.instances {
+		if (port == 0 || instance.ServicePort.Port == port) && labels.HasSubsetOf(instance.Endpoint.Labels) {
+			out = append(out, instance)
+		}
+	}
+	return out
+}
+
+// GetProxyServiceInstances implements model.ServiceDiscovery.
+func (c *Controller) GetProxyServiceInstances(node *model.Proxy) []*model.ServiceInstance {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	out := make([]*model.ServiceInstance, 0)
+	for _, ip := range node.IPAddresses {
+		out = append(out, c.ip2instances[ip]...)
+	}
+	return out
+}
+
+// GetProxyWorkloadLabels implements model.ServiceDiscovery.
+func (c *Controller) GetProxyWorkloadLabels(proxy *model.Proxy) labels.Collection {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	out := make(labels.Collection, 0)
+	for _, ip := range proxy.IPAddresses {
+		for _, instance := range c.ip2instances[ip] {
+			out = append(out, instance.Endpoint.Labels)
+		}
+	}
+	return out
+}
+
+// GetIstioServiceAccounts implements model.ServiceDiscovery.
+func (c *Controller) GetIstioServiceAccounts(svc *model.Service, ports []int) []string {
+	return model.GetServiceAccounts(svc, ports, c)
+}
+
+// NetworkGateways implements model.ServiceDiscovery.
+func (c *Controller) NetworkGateways() map[string][]*model.Gateway {
+	return nil
+}
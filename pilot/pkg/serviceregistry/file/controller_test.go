@@ -0,0 +1,325 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+type fakeXdsUpdater struct {
+	mu     sync.Mutex
+	events []string
+}
+
+var _ model.XDSUpdater = &fakeXdsUpdater{}
+
+func (fx *fakeXdsUpdater) record(event string) {
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	fx.events = append(fx.events, event)
+}
+
+// take returns the sorted events received since the last call.
+func (fx *fakeXdsUpdater) take() []string {
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	events := fx.events
+	fx.events = nil
+	sort.Strings(events)
+	return events
+}
+
+func (fx *fakeXdsUpdater) EDSUpdate(_, hostname string, _ string, entry []*model.IstioEndpoint) {
+	fx.record(fmt.Sprintf("eds %s %d", hostname, len(entry)))
+}
+
+func (fx *fakeXdsUpdater) EDSCacheUpdate(_, _, _ string, _ []*model.IstioEndpoint) {}
+
+func (fx *fakeXdsUpdater) ConfigUpdate(*model.PushRequest) {}
+
+func (fx *fakeXdsUpdater) ProxyUpdate(_, _ string) {}
+
+func (fx *fakeXdsUpdater) SvcUpdate(_, hostname string, _ string, event model.Event) {
+	fx.record(fmt.Sprintf("svc %s %v", hostname, event))
+}
+
+const (
+	dbYAML = `
+services:
+- hostname: db.legacy.example.com
+  namespace: legacy
+  address: 10.10.0.5
+  ports:
+  - name: tcp-postgres
+    port: 5432
+    protocol: TCP
+  endpoints:
+  - address: 10.20.0.1
+    labels:
+      version: v1
+  - address: 10.20.0.2
+    labels:
+      version: v2
+    ports:
+      tcp-postgres: 15432
+`
+	dbScaledYAML = `
+services:
+- hostname: db.legacy.example.com
+  namespace: legacy
+  address: 10.10.0.5
+  ports:
+  - name: tcp-postgres
+    port: 5432
+    protocol: TCP
+  endpoints:
+  - address: 10.20.0.1
+    labels:
+      version: v1
+`
+	webJSON = `{
+  "services": [{
+    "hostname": "web.legacy.example.com",
+    "namespace": "legacy",
+    "ports": [{"name": "http", "port": 80, "protocol": "HTTP", "targetPort": 8080}],
+    "endpoints": [{"address": "10.20.0.1", "serviceAccount": "web"}]
+  }]
+}`
+	duplicateYAML = `
+services:
+- hostname: web.legacy.example.com
+  namespace: other
+  ports:
+  - name: http
+    port: 80
+    protocol: HTTP
+`
+	invalidYAML = `
+services:
+- hostname: broken.legacy.example.com
+  ports:
+  - name: http
+    port: 80
+    protocol: HTTP
+`
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func hostnames(t *testing.T, c *Controller) []string {
+	t.Helper()
+	svcs, err := c.Services()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := []string{}
+	for _, svc := range svcs {
+		out = append(out, string(svc.Hostname))
+	}
+	return out
+}
+
+func expectEvents(t *testing.T, fx *fakeXdsUpdater, expected ...string) {
+	t.Helper()
+	if got := fx.take(); !reflect.DeepEqual(got, expected) && !(len(got) == 0 && len(expected) == 0) {
+		t.Fatalf("got events %v, want %v", got, expected)
+	}
+}
+
+func TestController(t *testing.T) {
+	dir := t.TempDir()
+	fx := &fakeXdsUpdater{}
+	c := NewController(Options{Root: dir, ClusterID: "cluster-1", XDSUpdater: fx})
+	handled := map[string]model.Event{}
+	c.AppendServiceHandler(func(svc *model.Service, event model.Event) {
+		handled[string(svc.Hostname)] = event
+	})
+
+	writeFile(t, dir, "db.yaml", dbYAML)
+	writeFile(t, dir, "web.json", webJSON)
+	writeFile(t, dir, "ignored.txt", "not a definition")
+	c.Reload()
+	if got := hostnames(t, c); !reflect.DeepEqual(got, []string{"db.legacy.example.com", "web.legacy.example.com"}) {
+		t.Fatalf("unexpected services %v", got)
+	}
+	expectEvents(t, fx,
+		"eds db.legacy.example.com 2", "eds web.legacy.example.com 1",
+		"svc db.legacy.example.com add", "svc web.legacy.example.com add")
+	if !reflect.DeepEqual(handled, map[string]model.Event{
+		"db.legacy.example.com":  model.EventAdd,
+		"web.legacy.example.com": model.EventAdd,
+	}) {
+		t.Fatalf("unexpected service events %v", handled)
+	}
+
+	t.Run("service discovery", func(t *testing.T) {
+		db, _ := c.GetService("db.legacy.example.com")
+		if db == nil || db.Address != "10.10.0.5" || db.Attributes.Namespace != "legacy" || db.Attributes.ServiceRegistry != "File" {
+			t.Fatalf("unexpected service %+v", db)
+		}
+		instances := c.InstancesByPort(db, 5432, labels.Collection{{"version": "v2"}})
+		if len(instances) != 1 || instances[0].Endpoint.Address != "10.20.0.2" || instances[0].Endpoint.EndpointPort != 15432 {
+			t.Fatalf("unexpected instances %v", instances)
+		}
+		if instances := c.InstancesByPort(db, 80, nil); len(instances) != 0 {
+			t.Fatalf("unexpected instances for unknown port %v", instances)
+		}
+
+		web, _ := c.GetService("web.legacy.example.com")
+		if web.Address != "0.0.0.0" {
+			t.Fatalf("expected unspecified address, got %v", web.Address)
+		}
+		ep := c.InstancesByPort(web, 80, nil)[0].Endpoint
+		if ep.EndpointPort != 8080 || ep.TLSMode != model.IstioMutualTLSModeLabel ||
+			ep.ServiceAccount != "spiffe://cluster.local/ns/legacy/sa/web" || ep.Locality.ClusterID != "cluster-1" {
+			t.Fatalf("unexpected endpoint %+v", ep)
+		}
+		if got := c.GetIstioServiceAccounts(web, []int{80}); !reflect.DeepEqual(got, []string{"spiffe://cluster.local/ns/legacy/sa/web"}) {
+			t.Fatalf("unexpected service accounts %v", got)
+		}
+
+		proxy := &model.Proxy{IPAddresses: []string{"10.20.0.1"}}
+		if got := c.GetProxyServiceInstances(proxy); len(got) != 2 {
+			t.Fatalf("expected the instances of both services, got %v", got)
+		}
+		if got := c.GetProxyWorkloadLabels(proxy); len(got) != 2 {
+			t.Fatalf("unexpected labels %v", got)
+		}
+	})
+
+	t.Run("endpoints update", func(t *testing.T) {
+		handled = map[string]model.Event{}
+		writeFile(t, dir, "db.yaml", dbScaledYAML)
+		c.Reload()
+		expectEvents(t, fx, "eds db.legacy.example.com 1")
+		if len(handled) != 0 {
+			t.Fatalf("endpoint changes should not trigger service events, got %v", handled)
+		}
+	})
+
+	t.Run("invalid files are isolated", func(t *testing.T) {
+		writeFile(t, dir, "web.json", "{invalid")
+		writeFile(t, dir, "broken.yaml", invalidYAML)
+		c.Reload()
+		if got := hostnames(t, c); !reflect.DeepEqual(got, []string{"db.legacy.example.com", "web.legacy.example.com"}) {
+			t.Fatalf("unexpected services %v", got)
+		}
+		expectEvents(t, fx)
+	})
+
+	t.Run("duplicate hostname", func(t *testing.T) {
+		writeFile(t, dir, "web.json", webJSON)
+		writeFile(t, dir, "z-duplicate.yaml", duplicateYAML)
+		c.Reload()
+		web, _ := c.GetService("web.legacy.example.com")
+		if web.Attributes.Namespace != "legacy" {
+			t.Fatalf("expected the service of the first file, got namespace %v", web.Attributes.Namespace)
+		}
+		expectEvents(t, fx)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		handled = map[string]model.Event{}
+		if err := os.Remove(filepath.Join(dir, "db.yaml")); err != nil {
+			t.Fatal(err)
+		}
+		c.Reload()
+		if got := hostnames(t, c); !reflect.DeepEqual(got, []string{"web.legacy.example.com"}) {
+			t.Fatalf("unexpected services %v", got)
+		}
+		expectEvents(t, fx, "svc db.legacy.example.com delete")
+		if handled["db.legacy.example.com"] != model.EventDelete {
+			t.Fatalf("unexpected service events %v", handled)
+		}
+		if got := c.GetProxyServiceInstances(&model.Proxy{IPAddresses: []string{"10.20.0.1"}}); len(got) != 1 {
+			t.Fatalf("expected the web instance only, got %v", got)
+		}
+	})
+}
+
+func TestControllerWatch(t *testing.T) {
+	dir := t.TempDir()
+	c := NewController(Options{Root: dir})
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.Run(stop)
+	retry.UntilSuccessOrFail(t, func() error {
+		if !c.HasSynced() {
+			return fmt.Errorf("not synced")
+		}
+		return nil
+	})
+
+	writeFile(t, dir, "db.yaml", dbYAML)
+	retry.UntilSuccessOrFail(t, func() error {
+		if svc, _ := c.GetService("db.legacy.example.com"); svc == nil {
+			return fmt.Errorf("service not loaded")
+		}
+		return nil
+	})
+	if err := os.Remove(filepath.Join(dir, "db.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		if svc, _ := c.GetService(host.Name("db.legacy.example.com")); svc != nil {
+			return fmt.Errorf("service not deleted")
+		}
+		return nil
+	})
+}
+
+func TestReadDefinitionsErrors(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"unknown field", "services:\n- hostname: a.example.com\n  unknown: true\n", "unknown field"},
+		{"missing namespace", invalidYAML, "namespace is required"},
+		{"no ports", "services:\n- hostname: a.example.com\n  namespace: ns\n", "at least one port"},
+		{"bad protocol", "services:\n- hostname: a.example.com\n  namespace: ns\n  ports:\n  - {name: p, port: 80, protocol: FOO}\n",
+			"unsupported protocol"},
+		{"bad endpoint", "services:\n- hostname: a.example.com\n  namespace: ns\n  ports:\n  - {name: p, port: 80, protocol: TCP}\n" +
+			"  endpoints:\n  - address: host.example.com\n    ports: {q: 90}\n", "unknown port name"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			writeFile(t, dir, "file.yaml", tc.content)
+			_, err := readDefinitions(filepath.Join(dir, "file.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
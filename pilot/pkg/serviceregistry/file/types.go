@@ -0,0 +1,183 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	"github.com/hashicorp/go-multierror"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/validation"
+)
+
+// Definitions is the content of a file of the registry directory, for example:
+//
+//	services:
+//	- hostname: db.legacy.example.com
+//	  namespace: legacy
+//	  address: 10.10.0.5
+//	  ports:
+//	  - name: tcp-postgres
+//	    port: 5432
+//	    protocol: TCP
+//	  endpoints:
+//	  - address: 10.20.0.1
+//	    labels:
+//	      version: v1
+//	    locality: us-east1/us-east1-b
+//
+// JSON files use the same fields.
+type Definitions struct {
+	Services []*ServiceDefinition `json:"services"`
+}
+
+// ServiceDefinition describes a service and its endpoints.
+type ServiceDefinition struct {
+	// Hostname is the fully qualified name of the service.
+	Hostname string `json:"hostname"`
+	// Namespace the service belongs to, used for the visibility and the identities of the service.
+	Namespace string `json:"namespace"`
+	// Address is the virtual IP of the service. If not set, the service is only reachable by its hostname.
+	Address string `json:"address,omitempty"`
+	// Ports of the service.
+	Ports []PortDefinition `json:"ports"`
+	// Labels of the service.
+	Labels map[string]string `json:"labels,omitempty"`
+	// SubjectAltNames are the identities of the servers of the service, used when the endpoints don't have
+	// a service account.
+	SubjectAltNames []string `json:"subjectAltNames,omitempty"`
+	// Endpoints of the service.
+	Endpoints []EndpointDefinition `json:"endpoints,omitempty"`
+}
+
+// PortDefinition describes a port of a service.
+type PortDefinition struct {
+	// Name of the port, unique in the service.
+	Name string `json:"name"`
+	// Port number of the service.
+	Port uint32 `json:"port"`
+	// Protocol of the port, for example HTTP or TCP.
+	Protocol string `json:"protocol"`
+	// TargetPort is the port of the endpoints. Defaults to the port of the service.
+	TargetPort uint32 `json:"targetPort,omitempty"`
+}
+
+// EndpointDefinition describes an instance of a service.
+type EndpointDefinition struct {
+	// Address is the IP address of the endpoint.
+	Address string `json:"address"`
+	// Ports overrides the target ports of the service for this endpoint, keyed by service port name.
+	Ports map[string]uint32 `json:"ports,omitempty"`
+	// Labels of the endpoint, used for subsets.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Network the endpoint belongs to.
+	Network string `json:"network,omitempty"`
+	// Locality of the endpoint, <region>/<zone>/<subzone>.
+	Locality string `json:"locality,omitempty"`
+	// Weight of the endpoint for load balancing.
+	Weight uint32 `json:"weight,omitempty"`
+	// ServiceAccount of the workload, if it runs a sidecar. The endpoint uses Istio mutual TLS if set, unless the
+	// security.istio.io/tlsMode label says otherwise.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+}
+
+// readDefinitions reads and validates a file of the registry directory.
+func readDefinitions(path string) (*Definitions, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defs := &Definitions{}
+	if err := yaml.UnmarshalStrict(b, defs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if err := defs.validate(); err != nil {
+		return nil, fmt.Errorf("invalid definitions in %s: %v", path, err)
+	}
+	return defs, nil
+}
+
+func (d *Definitions) validate() error {
+	var errs error
+	hostnames := map[string]bool{}
+	for i, svc := range d.Services {
+		if svc == nil {
+			errs = multierror.Append(errs, fmt.Errorf("services[%d]: empty service", i))
+			continue
+		}
+		if hostnames[svc.Hostname] {
+			errs = multierror.Append(errs, fmt.Errorf("services[%d]: duplicate hostname %q", i, svc.Hostname))
+		}
+		hostnames[svc.Hostname] = true
+		if err := svc.validate(); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("services[%d]: %v", i, err))
+		}
+	}
+	return errs
+}
+
+func (s *ServiceDefinition) validate() error {
+	var errs error
+	if err := validation.ValidateFQDN(s.Hostname); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("invalid hostname %q: %v", s.Hostname, err))
+	}
+	if s.Namespace == "" {
+		errs = multierror.Append(errs, fmt.Errorf("namespace is required"))
+	}
+	if s.Address != "" && net.ParseIP(s.Address) == nil {
+		errs = multierror.Append(errs, fmt.Errorf("invalid address %q", s.Address))
+	}
+	if len(s.Ports) == 0 {
+		errs = multierror.Append(errs, fmt.Errorf("at least one port is required"))
+	}
+	portNames := map[string]bool{}
+	for _, p := range s.Ports {
+		if p.Name == "" {
+			errs = multierror.Append(errs, fmt.Errorf("port %d has no name", p.Port))
+		} else if portNames[p.Name] {
+			errs = multierror.Append(errs, fmt.Errorf("duplicate port name %q", p.Name))
+		}
+		portNames[p.Name] = true
+		if err := validation.ValidatePort(int(p.Port)); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("port %q: %v", p.Name, err))
+		}
+		if p.TargetPort != 0 {
+			if err := validation.ValidatePort(int(p.TargetPort)); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("target port of %q: %v", p.Name, err))
+			}
+		}
+		if protocol.Parse(p.Protocol).IsUnsupported() {
+			errs = multierror.Append(errs, fmt.Errorf("port %q: unsupported protocol %q", p.Name, p.Protocol))
+		}
+	}
+	for i, ep := range s.Endpoints {
+		if net.ParseIP(ep.Address) == nil {
+			errs = multierror.Append(errs, fmt.Errorf("endpoints[%d]: invalid address %q", i, ep.Address))
+		}
+		for name, port := range ep.Ports {
+			if !portNames[name] {
+				errs = multierror.Append(errs, fmt.Errorf("endpoints[%d]: unknown port name %q", i, name))
+			}
+			if err := validation.ValidatePort(int(port)); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("endpoints[%d]: port %q: %v", i, name, err))
+			}
+		}
+	}
+	return errs
+}
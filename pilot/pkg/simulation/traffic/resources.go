@@ -0,0 +1,143 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package traffic
+
+import (
+	"fmt"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tcpproxy "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core"
+)
+
+// NewSimulatorFromConfigGen creates a simulator from the configuration generated for the proxy. The proxy
+// must already be initialized against the push context.
+func NewSimulatorFromConfigGen(cg core.ConfigGenerator, proxy *model.Proxy, push *model.PushContext) (*Simulator, error) {
+	listeners := cg.BuildListeners(proxy, push)
+
+	clusters := []*cluster.Cluster{}
+	for _, r := range cg.BuildClusters(proxy, push) {
+		c := &cluster.Cluster{}
+		if err := r.UnmarshalTo(c); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal cluster: %v", err)
+		}
+		clusters = append(clusters, c)
+	}
+
+	routeNames, err := rdsRouteNames(listeners)
+	if err != nil {
+		return nil, err
+	}
+	routes := []*route.RouteConfiguration{}
+	for _, r := range cg.BuildHTTPRoutes(proxy, push, routeNames) {
+		rc := &route.RouteConfiguration{}
+		if err := r.UnmarshalTo(rc); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal route configuration: %v", err)
+		}
+		routes = append(routes, rc)
+	}
+
+	return &Simulator{
+		Listeners: listeners,
+		Clusters:  clusters,
+		Routes:    routes,
+	}, nil
+}
+
+// rdsRouteNames returns the names of the route configurations the listeners fetch over RDS.
+func rdsRouteNames(listeners []*listener.Listener) ([]string, error) {
+	names := []string{}
+	for _, l := range listeners {
+		for _, fc := range l.FilterChains {
+			h, err := httpConnectionManager(fc)
+			if err != nil {
+				return nil, err
+			}
+			if rds := h.GetRds(); rds != nil {
+				names = append(names, rds.RouteConfigName)
+			}
+		}
+	}
+	return names, nil
+}
+
+func httpConnectionManager(fc *listener.FilterChain) (*hcm.HttpConnectionManager, error) {
+	for _, f := range fc.Filters {
+		if f.Name == wellknown.HTTPConnectionManager {
+			h := &hcm.HttpConnectionManager{}
+			if f.GetTypedConfig() != nil {
+				if err := f.GetTypedConfig().UnmarshalTo(h); err != nil {
+					return nil, fmt.Errorf("failed to unmarshal hcm of filter chain %q: %v", fc.Name, err)
+				}
+			}
+			return h, nil
+		}
+	}
+	return nil, nil
+}
+
+func tcpProxy(fc *listener.FilterChain) (*tcpproxy.TcpProxy, error) {
+	for _, f := range fc.Filters {
+		if f.Name == wellknown.TCPProxy {
+			t := &tcpproxy.TcpProxy{}
+			if f.GetTypedConfig() != nil {
+				if err := f.GetTypedConfig().UnmarshalTo(t); err != nil {
+					return nil, fmt.Errorf("failed to unmarshal tcp proxy of filter chain %q: %v", fc.Name, err)
+				}
+			}
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+// hasFilterOnPort returns true if the listener runs the listener filter for connections to the port.
+func hasFilterOnPort(l *listener.Listener, filter string, port int) bool {
+	for _, lf := range l.ListenerFilters {
+		if lf.Name != filter {
+			continue
+		}
+		return !filterDisabled(lf.FilterDisabled, port)
+	}
+	return false
+}
+
+// filterDisabled evaluates the FilterDisabled predicate of a listener filter. Rules Istio does not
+// generate are treated as not matching.
+func filterDisabled(predicate *listener.ListenerFilterChainMatchPredicate, port int) bool {
+	if predicate == nil {
+		return false
+	}
+	switch r := predicate.Rule.(type) {
+	case *listener.ListenerFilterChainMatchPredicate_NotMatch:
+		return !filterDisabled(r.NotMatch, port)
+	case *listener.ListenerFilterChainMatchPredicate_OrMatch:
+		matches := false
+		for _, r := range r.OrMatch.Rules {
+			matches = matches || filterDisabled(r, port)
+		}
+		return matches
+	case *listener.ListenerFilterChainMatchPredicate_DestinationPortRange:
+		return int32(port) >= r.DestinationPortRange.GetStart() && int32(port) < r.DestinationPortRange.GetEnd()
+	default:
+		return false
+	}
+}
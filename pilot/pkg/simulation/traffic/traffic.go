@@ -0,0 +1,655 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package traffic evaluates a request against the listeners, routes and clusters of a proxy, following the
+// matching rules of Envoy.
+package traffic
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"github.com/yl2chen/cidranger"
+
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3"
+	"istio.io/istio/pilot/pkg/util/sets"
+	xdsfilters "istio.io/istio/pilot/pkg/xds/filters"
+	"istio.io/istio/pkg/config/host"
+)
+
+type Protocol string
+
+const (
+	HTTP  Protocol = "http"
+	HTTP2 Protocol = "http2"
+	TCP   Protocol = "tcp"
+)
+
+type TLSMode string
+
+const (
+	Plaintext TLSMode = "plaintext"
+	TLS       TLSMode = "tls"
+	MTLS      TLSMode = "mtls"
+)
+
+func (c Call) IsHTTP() bool {
+	return httpProtocols.Contains(string(c.Protocol)) && (c.TLS == Plaintext || c.TLS == "")
+}
+
+var httpProtocols = sets.NewSet(string(HTTP), string(HTTP2))
+
+var (
+	ErrNoListener          = errors.New("no listener matched")
+	ErrNoFilterChain       = errors.New("no filter chains matched")
+	ErrNoRoute             = errors.New("no route matched")
+	ErrTLSRedirect         = errors.New("tls required, sending 301")
+	ErrNoVirtualHost       = errors.New("no virtual host matched")
+	ErrMultipleFilterChain = errors.New("multiple filter chains matched")
+	// ErrProtocolError happens when sending TLS/TCP request to HCM, for example
+	ErrProtocolError = errors.New("protocol error")
+	ErrTLSError      = errors.New("invalid TLS")
+	ErrMTLSError     = errors.New("invalid mTLS")
+)
+
+type CallMode string
+
+var (
+	// CallModeGateway simulate no iptables
+	CallModeGateway CallMode = "gateway"
+	// CallModeOutbound simulate iptables redirect to 15001
+	CallModeOutbound CallMode = "outbound"
+	// CallModeInbound simulate iptables redirect to 15006
+	CallModeInbound CallMode = "inbound"
+)
+
+type Call struct {
+	Address string
+	Port    int
+	Path    string
+
+	// Protocol describes the protocol type. TLS encapsulation is separate
+	Protocol Protocol
+	// TLS describes the connection tls parameters
+	// TODO: currently this does not verify TLS vs mTLS
+	TLS  TLSMode
+	Alpn string
+
+	// HostHeader is a convenience field for Headers
+	HostHeader string
+	Headers    http.Header
+
+	Sni string
+
+	// CallMode describes the type of call to make.
+	CallMode CallMode
+}
+
+func (c Call) FillDefaults() Call {
+	if c.Headers == nil {
+		c.Headers = http.Header{}
+	}
+	if c.HostHeader != "" {
+		c.Headers["Host"] = []string{c.HostHeader}
+	}
+	// For simplicity, set SNI automatically for TLS traffic.
+	if c.Sni == "" && (c.TLS == TLS) {
+		c.Sni = c.HostHeader
+	}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	if c.TLS == "" {
+		c.TLS = Plaintext
+	}
+	if c.Address == "" {
+		// pick a random address, assumption is the test does not care
+		c.Address = "1.3.3.7"
+	}
+	if c.TLS == MTLS && c.Alpn == "" {
+		c.Alpn = protocolToMTLSAlpn(c.Protocol)
+	}
+	if c.TLS == TLS && c.Alpn == "" {
+		c.Alpn = protocolToTLSAlpn(c.Protocol)
+	}
+	return c
+}
+
+// Result describes how a call was handled by the proxy. Error is set when the proxy would reject the call.
+type Result struct {
+	Error              error
+	ListenerMatched    string
+	FilterChainMatched string
+	RouteMatched       string
+	RouteConfigMatched string
+	VirtualHostMatched string
+	ClusterMatched     string
+}
+
+// Tracer receives a description of each matching decision made while running a call, including why
+// alternatives were skipped.
+type Tracer func(format string, args ...interface{})
+
+// Simulator runs calls against the configuration of a single proxy.
+type Simulator struct {
+	Listeners []*listener.Listener
+	Clusters  []*cluster.Cluster
+	Routes    []*route.RouteConfiguration
+	// Trace, if set, is called for each matching decision.
+	Trace Tracer
+}
+
+func (sim *Simulator) trace(format string, args ...interface{}) {
+	if sim.Trace != nil {
+		sim.Trace(format, args...)
+	}
+}
+
+// Run evaluates the call against the configuration. An error is returned if the configuration itself
+// cannot be evaluated, for example because it holds an invalid regex; calls rejected by the proxy are
+// reported in the Result instead.
+func (sim *Simulator) Run(input Call) (Result, error) {
+	result := Result{}
+	input = input.FillDefaults()
+	if input.Alpn != "" && input.TLS == Plaintext {
+		result.Error = fmt.Errorf("invalid call, ALPN can only be sent in TLS requests")
+		return result, nil
+	}
+
+	// First we will match a listener
+	l := sim.matchListener(input)
+	if l == nil {
+		result.Error = ErrNoListener
+		return result, nil
+	}
+	result.ListenerMatched = l.Name
+
+	hasTLSInspector := hasFilterOnPort(l, xdsfilters.TLSInspector.Name, input.Port)
+	if !hasTLSInspector {
+		// Without tls inspector, Envoy would not read the ALPN in the TLS handshake
+		// HTTP inspector still may set it though
+		input.Alpn = ""
+	}
+
+	// Apply listener filters
+	if hasFilterOnPort(l, xdsfilters.HTTPInspector.Name, input.Port) {
+		if alpn := protocolToAlpn(input.Protocol); alpn != "" && input.TLS == Plaintext {
+			input.Alpn = alpn
+		}
+	}
+
+	fc, err := sim.matchFilterChain(l.FilterChains, l.DefaultFilterChain, input, hasTLSInspector)
+	if err != nil {
+		if errors.Is(err, ErrNoFilterChain) || errors.Is(err, ErrMultipleFilterChain) {
+			result.Error = err
+			return result, nil
+		}
+		return result, err
+	}
+	result.FilterChainMatched = fc.Name
+	// Plaintext to TLS is an error
+	if fc.TransportSocket != nil && input.TLS == Plaintext {
+		sim.trace("filter chain %q terminates TLS, but the call is plaintext", fc.Name)
+		result.Error = ErrTLSError
+		return result, nil
+	}
+	// mTLS listener will only accept mTLS traffic
+	if fc.TransportSocket != nil {
+		mtls, err := requiresMTLS(fc)
+		if err != nil {
+			return result, err
+		}
+		if mtls != (input.TLS == MTLS) {
+			sim.trace("filter chain %q requires mTLS %v, but the call uses %v", fc.Name, mtls, input.TLS)
+			result.Error = ErrMTLSError
+			return result, nil
+		}
+	}
+
+	hcm, err := httpConnectionManager(fc)
+	if err != nil {
+		return result, err
+	}
+	if hcm != nil {
+		// We matched HCM and didn't terminate TLS, but we are sending TLS traffic - decoding will fail
+		if input.TLS != Plaintext && fc.TransportSocket == nil {
+			sim.trace("filter chain %q expects plaintext HTTP, but the call uses %v", fc.Name, input.TLS)
+			result.Error = ErrProtocolError
+			return result, nil
+		}
+		// TCP to HCM is invalid
+		if input.Protocol != HTTP && input.Protocol != HTTP2 {
+			sim.trace("filter chain %q expects HTTP, but the call uses %v", fc.Name, input.Protocol)
+			result.Error = ErrProtocolError
+			return result, nil
+		}
+
+		// Fetch inline route
+		rc := hcm.GetRouteConfig()
+		if rc == nil {
+			// If not set, fallback to RDS
+			routeName := hcm.GetRds().RouteConfigName
+			result.RouteConfigMatched = routeName
+			rc = sim.routeConfiguration(routeName)
+			if rc == nil {
+				sim.trace("route config %q was not found", routeName)
+				result.Error = ErrNoVirtualHost
+				return result, nil
+			}
+		}
+		hostHeader := ""
+		if len(input.Headers["Host"]) > 0 {
+			hostHeader = input.Headers["Host"][0]
+		}
+		vh := sim.matchVirtualHost(rc, hostHeader)
+		if vh == nil {
+			result.Error = ErrNoVirtualHost
+			return result, nil
+		}
+		result.VirtualHostMatched = vh.Name
+		if vh.RequireTls == route.VirtualHost_ALL && input.TLS == Plaintext {
+			sim.trace("virtual host %q requires TLS", vh.Name)
+			result.Error = ErrTLSRedirect
+			return result, nil
+		}
+
+		r, err := sim.matchRoute(vh, input)
+		if err != nil {
+			return result, err
+		}
+		if r == nil {
+			result.Error = ErrNoRoute
+			return result, nil
+		}
+		result.RouteMatched = r.Name
+		switch t := r.GetAction().(type) {
+		case *route.Route_Route:
+			result.ClusterMatched = t.Route.GetCluster()
+			if wc := t.Route.GetWeightedClusters(); wc != nil {
+				sim.trace("route %q splits traffic across %d weighted clusters", r.Name, len(wc.Clusters))
+			}
+		case *route.Route_Redirect:
+			sim.trace("route %q redirects the request", r.Name)
+		case *route.Route_DirectResponse:
+			sim.trace("route %q returns a direct response with status %d", r.Name, t.DirectResponse.GetStatus())
+		}
+		return result, nil
+	}
+
+	tcp, err := tcpProxy(fc)
+	if err != nil {
+		return result, err
+	}
+	if tcp != nil {
+		result.ClusterMatched = tcp.GetCluster()
+		if wc := tcp.GetWeightedClusters(); wc != nil {
+			sim.trace("TCP proxy splits traffic across %d weighted clusters", len(wc.Clusters))
+		}
+	}
+	return result, nil
+}
+
+func requiresMTLS(fc *listener.FilterChain) (bool, error) {
+	if fc.TransportSocket == nil {
+		return false, nil
+	}
+	t := &tls.DownstreamTlsContext{}
+	if err := fc.GetTransportSocket().GetTypedConfig().UnmarshalTo(t); err != nil {
+		return false, fmt.Errorf("failed to unmarshal the TLS context of filter chain %q: %v", fc.Name, err)
+	}
+
+	if len(t.GetCommonTlsContext().GetTlsCertificateSdsSecretConfigs()) == 0 {
+		return false, nil
+	}
+	// This is a lazy heuristic, we could check for explicit default resource or spiffe if it becomes necessary
+	return t.GetCommonTlsContext().GetTlsCertificateSdsSecretConfigs()[0].Name == "default", nil
+}
+
+func (sim *Simulator) matchRoute(vh *route.VirtualHost, input Call) (*route.Route, error) {
+	for _, r := range vh.Routes {
+		// check path
+		switch pt := r.Match.GetPathSpecifier().(type) {
+		case *route.RouteMatch_Prefix:
+			if !strings.HasPrefix(input.Path, pt.Prefix) {
+				sim.trace("route %q skipped: path %q does not have prefix %q", r.Name, input.Path, pt.Prefix)
+				continue
+			}
+		case *route.RouteMatch_Path:
+			if input.Path != pt.Path {
+				sim.trace("route %q skipped: path %q is not %q", r.Name, input.Path, pt.Path)
+				continue
+			}
+		case *route.RouteMatch_SafeRegex:
+			re, err := regexp.Compile(pt.SafeRegex.GetRegex())
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex %v: %v", pt.SafeRegex.GetRegex(), err)
+			}
+			if !re.MatchString(input.Path) {
+				sim.trace("route %q skipped: path %q does not match regex %q", r.Name, input.Path, pt.SafeRegex.GetRegex())
+				continue
+			}
+		default:
+			return nil, fmt.Errorf("unknown path type of route %q", r.Name)
+		}
+
+		// TODO this only handles path - we need to add headers, query params, etc to be complete.
+
+		sim.trace("route %q matched path %q", r.Name, input.Path)
+		return r, nil
+	}
+	return nil, nil
+}
+
+func (sim *Simulator) matchVirtualHost(rc *route.RouteConfiguration, host string) *route.VirtualHost {
+	// Exact match
+	for _, vh := range rc.VirtualHosts {
+		for _, d := range vh.Domains {
+			if d == host {
+				sim.trace("virtual host %q matched host %q exactly", vh.Name, host)
+				return vh
+			}
+		}
+	}
+	// prefix match
+	var bestMatch *route.VirtualHost
+	longest := 0
+	for _, vh := range rc.VirtualHosts {
+		for _, d := range vh.Domains {
+			if d[0] != '*' {
+				continue
+			}
+			if len(host) >= len(d) && strings.HasSuffix(host, d[1:]) && len(d) > longest {
+				bestMatch = vh
+				longest = len(d)
+			}
+		}
+	}
+	if bestMatch != nil {
+		sim.trace("virtual host %q matched host %q by wildcard prefix, no exact match", bestMatch.Name, host)
+		return bestMatch
+	}
+	// Suffix match
+	longest = 0
+	for _, vh := range rc.VirtualHosts {
+		for _, d := range vh.Domains {
+			if d[len(d)-1] != '*' {
+				continue
+			}
+			if len(host) >= len(d) && strings.HasPrefix(host, d[:len(d)-1]) && len(d) > longest {
+				bestMatch = vh
+				longest = len(d)
+			}
+		}
+	}
+	if bestMatch != nil {
+		sim.trace("virtual host %q matched host %q by wildcard suffix, no exact or prefix match", bestMatch.Name, host)
+		return bestMatch
+	}
+	// wildcard match
+	for _, vh := range rc.VirtualHosts {
+		for _, d := range vh.Domains {
+			if d == "*" {
+				sim.trace("virtual host %q matched host %q by the catch-all domain", vh.Name, host)
+				return vh
+			}
+		}
+	}
+	sim.trace("none of the %d virtual hosts of route config %q match host %q", len(rc.VirtualHosts), rc.Name, host)
+	return nil
+}
+
+// Follow the 8 step Sieve as in
+// https://www.envoyproxy.io/docs/envoy/latest/api-v3/config/listener/v3/listener_components.proto.html#config-listener-v3-filterchainmatch
+// The implementation may initially be confusing because of a property of the
+// Envoy algorithm - at each level we will filter out all FilterChains that do
+// not match. This means an empty match (`{}`) may not match if another chain
+// matches one criteria but not another.
+func (sim *Simulator) matchFilterChain(chains []*listener.FilterChain, defaultChain *listener.FilterChain,
+	input Call, hasTLSInspector bool) (*listener.FilterChain, error) {
+	chains = sim.filter("destination port", chains, func(fc *listener.FilterChainMatch) bool {
+		return fc.GetDestinationPort() == nil
+	}, func(fc *listener.FilterChainMatch) bool {
+		return int(fc.GetDestinationPort().GetValue()) == input.Port
+	})
+	var cidrErr error
+	chains = sim.filter("destination address", chains, func(fc *listener.FilterChainMatch) bool {
+		return fc.GetPrefixRanges() == nil
+	}, func(fc *listener.FilterChainMatch) bool {
+		f, err := prefixRangesContain(fc.GetPrefixRanges(), input.Address)
+		if err != nil && cidrErr == nil {
+			cidrErr = err
+		}
+		return f
+	})
+	if cidrErr != nil {
+		return nil, cidrErr
+	}
+	chains = sim.filter("server name", chains, func(fc *listener.FilterChainMatch) bool {
+		return fc.GetServerNames() == nil
+	}, func(fc *listener.FilterChainMatch) bool {
+		sni := host.Name(input.Sni)
+		for _, s := range fc.GetServerNames() {
+			if sni.SubsetOf(host.Name(s)) {
+				return true
+			}
+		}
+		return false
+	})
+	chains = sim.filter("transport protocol", chains, func(fc *listener.FilterChainMatch) bool {
+		return fc.GetTransportProtocol() == ""
+	}, func(fc *listener.FilterChainMatch) bool {
+		if !hasTLSInspector {
+			// Without tls inspector, transport protocol will always be raw buffer
+			return fc.GetTransportProtocol() == xdsfilters.RawBufferTransportProtocol
+		}
+		switch fc.GetTransportProtocol() {
+		case xdsfilters.TLSTransportProtocol:
+			return input.TLS == TLS || input.TLS == MTLS
+		case xdsfilters.RawBufferTransportProtocol:
+			return input.TLS == Plaintext
+		}
+		return false
+	})
+	chains = sim.filter("application protocol", chains, func(fc *listener.FilterChainMatch) bool {
+		return fc.GetApplicationProtocols() == nil
+	}, func(fc *listener.FilterChainMatch) bool {
+		return sets.NewSet(fc.GetApplicationProtocols()...).Contains(input.Alpn)
+	})
+	// We do not implement the "source" based filters as we do not use them
+	if len(chains) > 1 {
+		return nil, ErrMultipleFilterChain
+	}
+	if len(chains) == 0 {
+		if defaultChain != nil {
+			sim.trace("no filter chain matched, using the default filter chain %q", defaultChain.Name)
+			return defaultChain, nil
+		}
+		return nil, ErrNoFilterChain
+	}
+	sim.trace("filter chain %q matched", chains[0].Name)
+	return chains[0], nil
+}
+
+func prefixRangesContain(ranges []*core.CidrRange, address string) (bool, error) {
+	ranger := cidranger.NewPCTrieRanger()
+	for _, a := range ranges {
+		s := fmt.Sprintf("%s/%d", a.AddressPrefix, a.GetPrefixLen().GetValue())
+		_, cidr, err := net.ParseCIDR(s)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse cidr %v: %v", s, err)
+		}
+		if err := ranger.Insert(cidranger.NewBasicRangerEntry(*cidr)); err != nil {
+			return false, fmt.Errorf("failed to insert cidr %v: %v", cidr, err)
+		}
+	}
+	f, err := ranger.Contains(net.ParseIP(address))
+	if err != nil {
+		return false, fmt.Errorf("cidr containers %v failed: %v", address, err)
+	}
+	return f, nil
+}
+
+// filter returns the chains matching a single criteria of the filter chain match. Chains that don't set
+// the criteria are only kept if no chain matches it.
+func (sim *Simulator) filter(criteria string, chains []*listener.FilterChain,
+	empty func(fc *listener.FilterChainMatch) bool,
+	match func(fc *listener.FilterChainMatch) bool) []*listener.FilterChain {
+	res := filterChains(chains, empty, match)
+	if sim.Trace != nil {
+		kept := map[*listener.FilterChain]struct{}{}
+		for _, c := range res {
+			kept[c] = struct{}{}
+		}
+		for _, c := range chains {
+			if _, f := kept[c]; f {
+				continue
+			}
+			if empty(c.GetFilterChainMatch()) {
+				sim.trace("filter chain %q skipped: another filter chain matches the %s", c.Name, criteria)
+			} else {
+				sim.trace("filter chain %q skipped: %s does not match", c.Name, criteria)
+			}
+		}
+	}
+	return res
+}
+
+func filterChains(chains []*listener.FilterChain,
+	empty func(fc *listener.FilterChainMatch) bool,
+	match func(fc *listener.FilterChainMatch) bool) []*listener.FilterChain {
+	res := []*listener.FilterChain{}
+	anySet := false
+	for _, c := range chains {
+		if !empty(c.GetFilterChainMatch()) {
+			anySet = true
+		}
+	}
+	if !anySet {
+		return chains
+	}
+	for _, c := range chains {
+		if match(c.GetFilterChainMatch()) {
+			res = append(res, c)
+		}
+	}
+	// Return all matching filter chains
+	if len(res) > 0 {
+		return res
+	}
+	// Unless there were no matches - in which case we return all filter chains that did not have a
+	// match set
+	for _, c := range chains {
+		if empty(c.GetFilterChainMatch()) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func protocolToMTLSAlpn(s Protocol) string {
+	switch s {
+	case HTTP:
+		return "istio-http/1.1"
+	case HTTP2:
+		return "istio-h2"
+	default:
+		return "istio"
+	}
+}
+
+func protocolToTLSAlpn(s Protocol) string {
+	switch s {
+	case HTTP:
+		return "http/1.1"
+	case HTTP2:
+		return "h2"
+	default:
+		return ""
+	}
+}
+
+func protocolToAlpn(s Protocol) string {
+	switch s {
+	case HTTP:
+		return "http/1.1"
+	case HTTP2:
+		return "h2c"
+	default:
+		return ""
+	}
+}
+
+func (sim *Simulator) matchListener(input Call) *listener.Listener {
+	if input.CallMode == CallModeInbound {
+		sim.trace("inbound calls are redirected to listener %q", v1alpha3.VirtualInboundListenerName)
+		for _, l := range sim.Listeners {
+			if l.Name == v1alpha3.VirtualInboundListenerName {
+				return l
+			}
+		}
+		return nil
+	}
+	// First find exact match for the IP/Port, then fallback to wildcard IP/Port
+	// There is no wildcard port
+	for _, l := range sim.Listeners {
+		if matchAddress(l.GetAddress(), input.Address, input.Port) {
+			sim.trace("listener %q matched address %s:%d", l.Name, input.Address, input.Port)
+			return l
+		}
+	}
+	for _, l := range sim.Listeners {
+		if matchAddress(l.GetAddress(), "0.0.0.0", input.Port) {
+			sim.trace("listener %q matched port %d, no listener for address %s", l.Name, input.Port, input.Address)
+			return l
+		}
+	}
+
+	// Fallback to the outbound listener
+	// TODO - support inbound
+	for _, l := range sim.Listeners {
+		if l.Name == v1alpha3.VirtualOutboundListenerName {
+			sim.trace("no listener for %s:%d, using listener %q", input.Address, input.Port, l.Name)
+			return l
+		}
+	}
+	return nil
+}
+
+func matchAddress(a *core.Address, address string, port int) bool {
+	if a.GetSocketAddress().GetAddress() != address {
+		return false
+	}
+	if int(a.GetSocketAddress().GetPortValue()) != port {
+		return false
+	}
+	return true
+}
+
+func (sim *Simulator) routeConfiguration(name string) *route.RouteConfiguration {
+	for _, rc := range sim.Routes {
+		if rc.Name == name {
+			return rc
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package traffic
+
+import (
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+func httpListener(routes ...*route.Route) *listener.Listener {
+	h := &hcm.HttpConnectionManager{
+		RouteSpecifier: &hcm.HttpConnectionManager_RouteConfig{RouteConfig: &route.RouteConfiguration{
+			Name: "inline",
+			VirtualHosts: []*route.VirtualHost{{
+				Name:    "vh",
+				Domains: []string{"*"},
+				Routes:  routes,
+			}},
+		}},
+	}
+	return &listener.Listener{
+		Name: "0.0.0.0_80",
+		Address: &core.Address{Address: &core.Address_SocketAddress{SocketAddress: &core.SocketAddress{
+			Address:       "0.0.0.0",
+			PortSpecifier: &core.SocketAddress_PortValue{PortValue: 80},
+		}}},
+		FilterChains: []*listener.FilterChain{{
+			Name: "http",
+			Filters: []*listener.Filter{{
+				Name:       wellknown.HTTPConnectionManager,
+				ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(h)},
+			}},
+		}},
+	}
+}
+
+func routeTo(name string, match *route.RouteMatch) *route.Route {
+	return &route.Route{
+		Name:   name,
+		Match:  match,
+		Action: &route.Route_Route{Route: &route.RouteAction{ClusterSpecifier: &route.RouteAction_Cluster{Cluster: name}}},
+	}
+}
+
+func TestSimulatorRun(t *testing.T) {
+	sim := &Simulator{Listeners: []*listener.Listener{httpListener(
+		routeTo("exact", &route.RouteMatch{PathSpecifier: &route.RouteMatch_Path{Path: "/exact"}}),
+		routeTo("default", &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"}}),
+	)}}
+	var trace []string
+	sim.Trace = func(format string, args ...interface{}) {
+		trace = append(trace, format)
+	}
+	got, err := sim.Run(Call{Port: 80, Protocol: HTTP, Path: "/other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Result{
+		ListenerMatched:    "0.0.0.0_80",
+		FilterChainMatched: "http",
+		VirtualHostMatched: "vh",
+		RouteMatched:       "default",
+		ClusterMatched:     "default",
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if len(trace) == 0 {
+		t.Error("expected the matching decisions to be traced")
+	}
+
+	if got, err := sim.Run(Call{Port: 81, Protocol: HTTP}); err != nil || got.Error != ErrNoListener {
+		t.Errorf("got %+v, %v, want %v", got, err, ErrNoListener)
+	}
+}
+
+func TestSimulatorRunInvalidConfig(t *testing.T) {
+	sim := &Simulator{Listeners: []*listener.Listener{httpListener(
+		routeTo("regex", &route.RouteMatch{PathSpecifier: &route.RouteMatch_SafeRegex{
+			SafeRegex: &matcher.RegexMatcher{Regex: "("},
+		}}),
+	)}}
+	if _, err := sim.Run(Call{Port: 80, Protocol: HTTP}); err == nil {
+		t.Fatal("expected an error for an invalid route regex")
+	}
+}
@@ -108,6 +108,10 @@ type Connection struct {
 	// (last push not ACKed). When we get an ACK from Envoy, if the type is populated here, we will trigger
 	// the push.
 	blockedPushes map[string]*model.PushRequest
+
+	// sentResources is a map of TypeUrl to the resources sent to the client, by name. It is only set for Delta
+	// XDS, and only accessed from the stream goroutine.
+	sentResources map[string]map[string]sentResource
 }
 
 // Event represents a config or registry event that results in a push.
@@ -956,6 +960,16 @@ func (conn *Connection) NonceAcked(typeUrl string) string {
 	return ""
 }
 
+// nolint
+func (conn *Connection) NonceNacked(typeUrl string) string {
+	conn.proxy.RLock()
+	defer conn.proxy.RUnlock()
+	if conn.proxy.WatchedResources != nil && conn.proxy.WatchedResources[typeUrl] != nil {
+		return conn.proxy.WatchedResources[typeUrl].NonceNacked
+	}
+	return ""
+}
+
 // nolint
 func (conn *Connection) NonceSent(typeUrl string) string {
 	conn.proxy.RLock()
@@ -0,0 +1,64 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config"
+)
+
+// CRLKind is the kind of the config updated by the pushes of the CRL, which only the CrlGenerator handles.
+var CRLKind = config.GroupVersionKind{Group: "security.istio.io", Version: "v1", Kind: "CertificateRevocationList"}
+
+// CrlGenerator generates the certificate revocation list of the Istio CA. Istio agents add it to the validation
+// context of the root certificate they send to their proxy.
+type CrlGenerator struct {
+	// CRL returns the PEM encoded CRL, or nil if no certificate is revoked. The generator sends nothing if it
+	// isn't set, for example when istiod doesn't run the CA.
+	CRL func() ([]byte, error)
+}
+
+var _ model.XdsResourceGenerator = &CrlGenerator{}
+
+func crlNeedsPush(req *model.PushRequest) bool {
+	if req == nil {
+		return true
+	}
+	if !req.Full {
+		return false
+	}
+	// If none set, we will always push
+	if len(req.ConfigsUpdated) == 0 {
+		return true
+	}
+	// The CRL only changes with the revocations and the CA certificate, which trigger a push of CRLKind.
+	return len(model.ConfigNamesOfKind(req.ConfigsUpdated, CRLKind)) > 0
+}
+
+// Generate returns a BytesValue holding the PEM encoded CRL, empty when no certificate is revoked so that the
+// agents remove the CRL they have.
+func (c *CrlGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource, req *model.PushRequest) (model.Resources, error) {
+	if !crlNeedsPush(req) || c.CRL == nil {
+		return nil, nil
+	}
+	crl, err := c.CRL()
+	if err != nil {
+		return nil, err
+	}
+	return model.Resources{util.MessageToAny(&wrappers.BytesValue{Value: crl})}, nil
+}
@@ -0,0 +1,104 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds_test
+
+import (
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/xds"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pkg/config/schema/gvk"
+)
+
+func TestCRL(t *testing.T) {
+	crl := []byte("-----BEGIN X509 CRL-----\ncrl\n-----END X509 CRL-----\n")
+	cases := []struct {
+		name     string
+		crl      []byte
+		expected []byte
+	}{
+		{
+			name:     "revoked certificates",
+			crl:      crl,
+			expected: crl,
+		},
+		{
+			name: "no revoked certificates",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+			s.Discovery.Generators[v3.CRLType] = &xds.CrlGenerator{CRL: func() ([]byte, error) {
+				return tt.crl, nil
+			}}
+
+			ads := s.ConnectADS().WithType(v3.CRLType)
+			res := ads.RequestResponseAck(&discovery.DiscoveryRequest{})
+			if len(res.Resources) != 1 {
+				t.Fatalf("got %d resources, want 1", len(res.Resources))
+			}
+			var got wrappers.BytesValue
+			// nolint: staticcheck
+			if err := ptypes.UnmarshalAny(res.Resources[0], &got); err != nil {
+				t.Fatal(err)
+			}
+			if string(got.Value) != string(tt.expected) {
+				t.Errorf("got CRL %q, want %q", got.Value, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCRLPush(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	crl := &xds.CrlGenerator{CRL: func() ([]byte, error) {
+		return []byte("crl"), nil
+	}}
+	req := &model.PushRequest{
+		Full:           true,
+		ConfigsUpdated: map[model.ConfigKey]struct{}{{Kind: xds.CRLKind, Name: "istio-ca-revocations", Namespace: "istio-system"}: {}},
+	}
+	proxy := s.SetupProxy(nil)
+
+	if res, err := crl.Generate(proxy, s.PushContext(), &model.WatchedResource{}, req); err != nil || len(res) != 1 {
+		t.Errorf("got %d resources, error %v, want the CRL to be pushed", len(res), err)
+	}
+	// The other types are left untouched by the pushes of the CRL.
+	for name, gen := range map[string]model.XdsResourceGenerator{
+		"cds": xds.CdsGenerator{Server: s.Discovery},
+		"lds": xds.LdsGenerator{Server: s.Discovery},
+		"rds": xds.RdsGenerator{Server: s.Discovery},
+		"eds": &xds.EdsGenerator{Server: s.Discovery},
+		"nds": xds.NdsGenerator{Server: s.Discovery},
+	} {
+		if res, err := gen.Generate(proxy, s.PushContext(), &model.WatchedResource{}, req); err != nil || res != nil {
+			t.Errorf("%s: got %d resources, error %v, want none", name, len(res), err)
+		}
+	}
+	// Pushes of other configs don't regenerate the CRL.
+	other := &model.PushRequest{
+		Full:           true,
+		ConfigsUpdated: map[model.ConfigKey]struct{}{{Kind: gvk.VirtualService, Name: "vs", Namespace: "default"}: {}},
+	}
+	if res, err := crl.Generate(proxy, s.PushContext(), &model.WatchedResource{}, other); err != nil || res != nil {
+		t.Errorf("got %d resources, error %v, want none", len(res), err)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"net/http/pprof"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -38,9 +39,11 @@ import (
 	"istio.io/istio/pilot/pkg/serviceregistry"
 	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
 	"istio.io/istio/pilot/pkg/serviceregistry/memory"
+	"istio.io/istio/pilot/pkg/xds/debugapi"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/collection"
+	"istio.io/istio/security/pkg/server/ca/audit"
 	istiolog "istio.io/pkg/log"
 )
 
@@ -101,19 +104,7 @@ type AdsClients struct {
 }
 
 // SyncStatus is the synchronization status between Pilot and a given Envoy
-type SyncStatus struct {
-	ProxyID       string `json:"proxy,omitempty"`
-	ProxyVersion  string `json:"proxy_version,omitempty"`
-	IstioVersion  string `json:"istio_version,omitempty"`
-	ClusterSent   string `json:"cluster_sent,omitempty"`
-	ClusterAcked  string `json:"cluster_acked,omitempty"`
-	ListenerSent  string `json:"listener_sent,omitempty"`
-	ListenerAcked string `json:"listener_acked,omitempty"`
-	RouteSent     string `json:"route_sent,omitempty"`
-	RouteAcked    string `json:"route_acked,omitempty"`
-	EndpointSent  string `json:"endpoint_sent,omitempty"`
-	EndpointAcked string `json:"endpoint_acked,omitempty"`
-}
+type SyncStatus = debugapi.SyncStatus
 
 // SyncedVersions shows what resourceVersion of a given resource has been acked by Envoy.
 type SyncedVersions struct {
@@ -192,6 +183,10 @@ func (s *DiscoveryServer) AddDebugHandlers(mux *http.ServeMux, enableProfiling b
 	s.addDebugHandler(mux, "/debug/inject", "Active inject template", s.InjectTemplateHandler(webhook))
 	s.addDebugHandler(mux, "/debug/mesh", "Active mesh config", s.MeshHandler)
 	s.addDebugHandler(mux, "/debug/networkz", "List cross-network gateways", s.networkz)
+	s.addDebugHandler(mux, "/debug/ca_auditz", "Recent certificate signing requests handled by the CA", s.caAuditz)
+	s.addDebugHandler(mux, "/debug/ca_rotationz", "Status of the rotation of the plugged-in CA certificates", s.caRotationz)
+
+	s.addVersionedDebugHandlers(mux)
 }
 
 func (s *DiscoveryServer) addDebugHandler(mux *http.ServeMux, path string, help string,
@@ -207,16 +202,20 @@ func (s *DiscoveryServer) Syncz(w http.ResponseWriter, _ *http.Request) {
 		node := con.proxy
 		if node != nil {
 			syncz = append(syncz, SyncStatus{
-				ProxyID:       node.ID,
-				IstioVersion:  node.Metadata.IstioVersion,
-				ClusterSent:   con.NonceSent(v3.ClusterType),
-				ClusterAcked:  con.NonceAcked(v3.ClusterType),
-				ListenerSent:  con.NonceSent(v3.ListenerType),
-				ListenerAcked: con.NonceAcked(v3.ListenerType),
-				RouteSent:     con.NonceSent(v3.RouteType),
-				RouteAcked:    con.NonceAcked(v3.RouteType),
-				EndpointSent:  con.NonceSent(v3.EndpointType),
-				EndpointAcked: con.NonceAcked(v3.EndpointType),
+				ProxyID:        node.ID,
+				IstioVersion:   node.Metadata.IstioVersion,
+				ClusterSent:    con.NonceSent(v3.ClusterType),
+				ClusterAcked:   con.NonceAcked(v3.ClusterType),
+				ClusterNacked:  con.NonceNacked(v3.ClusterType),
+				ListenerSent:   con.NonceSent(v3.ListenerType),
+				ListenerAcked:  con.NonceAcked(v3.ListenerType),
+				ListenerNacked: con.NonceNacked(v3.ListenerType),
+				RouteSent:      con.NonceSent(v3.RouteType),
+				RouteAcked:     con.NonceAcked(v3.RouteType),
+				RouteNacked:    con.NonceNacked(v3.RouteType),
+				EndpointSent:   con.NonceSent(v3.EndpointType),
+				EndpointAcked:  con.NonceAcked(v3.EndpointType),
+				EndpointNacked: con.NonceNacked(v3.EndpointType),
 			})
 		}
 	}
@@ -578,11 +577,7 @@ func (s *DiscoveryServer) configDump(conn *Connection) (*adminapi.ConfigDump, er
 	clusters := s.ConfigGenerator.BuildClusters(conn.proxy, s.globalPushContext())
 
 	for _, cs := range clusters {
-		cluster, err := anypb.New(cs)
-		if err != nil {
-			return nil, err
-		}
-		dynamicActiveClusters = append(dynamicActiveClusters, &adminapi.ClustersConfigDump_DynamicCluster{Cluster: cluster})
+		dynamicActiveClusters = append(dynamicActiveClusters, &adminapi.ClustersConfigDump_DynamicCluster{Cluster: cs})
 	}
 	clustersAny, err := util.MessageToAnyWithError(&adminapi.ClustersConfigDump{
 		VersionInfo:           versionInfo(),
@@ -617,11 +612,7 @@ func (s *DiscoveryServer) configDump(conn *Connection) (*adminapi.ConfigDump, er
 	if len(routes) > 0 {
 		dynamicRouteConfig := make([]*adminapi.RoutesConfigDump_DynamicRouteConfig, 0)
 		for _, rs := range routes {
-			route, err := anypb.New(rs)
-			if err != nil {
-				return nil, err
-			}
-			dynamicRouteConfig = append(dynamicRouteConfig, &adminapi.RoutesConfigDump_DynamicRouteConfig{RouteConfig: route})
+			dynamicRouteConfig = append(dynamicRouteConfig, &adminapi.RoutesConfigDump_DynamicRouteConfig{RouteConfig: rs})
 		}
 		routeConfigAny, err = util.MessageToAnyWithError(&adminapi.RoutesConfigDump{DynamicRouteConfigs: dynamicRouteConfig})
 		if err != nil {
@@ -630,27 +621,11 @@ func (s *DiscoveryServer) configDump(conn *Connection) (*adminapi.ConfigDump, er
 	}
 
 	secretsDump := &adminapi.SecretsConfigDump{}
-	if s.Generators[v3.SecretType] != nil {
-		secrets, _ := s.Generators[v3.SecretType].Generate(conn.proxy, s.globalPushContext(), conn.Watched(v3.SecretType), nil)
-		if len(secrets) > 0 {
-			for _, secretAny := range secrets {
-				secret := &tls.Secret{}
-				if err := secretAny.UnmarshalTo(secret); err != nil {
-					istiolog.Warnf("failed to unmarshal secret: %v", err)
-				}
-				if secret.GetTlsCertificate() != nil {
-					secret.GetTlsCertificate().PrivateKey = &core.DataSource{
-						Specifier: &core.DataSource_InlineBytes{
-							InlineBytes: []byte("[redacted]"),
-						},
-					}
-				}
-				secretsDump.DynamicActiveSecrets = append(secretsDump.DynamicActiveSecrets, &adminapi.SecretsConfigDump_DynamicSecret{
-					Name:   secret.Name,
-					Secret: util.MessageToAny(secret),
-				})
-			}
-		}
+	for _, secret := range s.redactedSecrets(conn) {
+		secretsDump.DynamicActiveSecrets = append(secretsDump.DynamicActiveSecrets, &adminapi.SecretsConfigDump_DynamicSecret{
+			Name:   secret.Name,
+			Secret: util.MessageToAny(secret),
+		})
 	}
 
 	bootstrapAny := util.MessageToAny(&adminapi.BootstrapConfigDump{})
@@ -669,6 +644,30 @@ func (s *DiscoveryServer) configDump(conn *Connection) (*adminapi.ConfigDump, er
 	return configDump, nil
 }
 
+// redactedSecrets returns the secrets generated for the connection, without their private keys.
+func (s *DiscoveryServer) redactedSecrets(conn *Connection) []*tls.Secret {
+	if s.Generators[v3.SecretType] == nil {
+		return nil
+	}
+	secrets, _ := s.Generators[v3.SecretType].Generate(conn.proxy, s.globalPushContext(), conn.Watched(v3.SecretType), nil)
+	res := make([]*tls.Secret, 0, len(secrets))
+	for _, secretAny := range secrets {
+		secret := &tls.Secret{}
+		if err := secretAny.UnmarshalTo(secret); err != nil {
+			istiolog.Warnf("failed to unmarshal secret: %v", err)
+		}
+		if secret.GetTlsCertificate() != nil {
+			secret.GetTlsCertificate().PrivateKey = &core.DataSource{
+				Specifier: &core.DataSource_InlineBytes{
+					InlineBytes: []byte("[redacted]"),
+				},
+			}
+		}
+		res = append(res, secret)
+	}
+	return res
+}
+
 // InjectTemplateHandler dumps the injection template
 // Replaces dumping the template at startup.
 func (s *DiscoveryServer) InjectTemplateHandler(webhook func() map[string]string) func(http.ResponseWriter, *http.Request) {
@@ -903,3 +902,53 @@ func (s *DiscoveryServer) networkz(w http.ResponseWriter, req *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
+
+// caAuditz lists the recent certificate signing requests handled by the CA, the most recent first. They are filtered
+// by caller identity with the "identity" parameter, by result ("issued" or "denied") with the "result" parameter, and
+// limited in number with the "limit" parameter.
+func (s *DiscoveryServer) caAuditz(w http.ResponseWriter, req *http.Request) {
+	if s.CAAuditLog == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("CA audit log is not enabled"))
+		return
+	}
+	_ = req.ParseForm()
+	filter := audit.Filter{
+		Identity: req.Form.Get("identity"),
+		Result:   req.Form.Get("result"),
+	}
+	if limit := req.Form.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, "invalid limit %q", limit)
+			return
+		}
+		filter.Limit = n
+	}
+	b, err := json.MarshalIndent(s.CAAuditLog.Recent(filter), "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(w, "unable to marshal the CA audit records: %v", err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// caRotationz returns the status of the rotation of the plugged-in CA certificates to a new root.
+func (s *DiscoveryServer) caRotationz(w http.ResponseWriter, _ *http.Request) {
+	if s.CARootRotator == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("CA root rotation is not enabled"))
+		return
+	}
+	b, err := json.MarshalIndent(s.CARootRotator.Status(), "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(w, "unable to marshal the CA rotation status: %v", err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
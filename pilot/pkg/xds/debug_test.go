@@ -27,6 +27,7 @@ import (
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/xds"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/security/pkg/server/ca/audit"
 	"istio.io/istio/tests/util/leak"
 )
 
@@ -217,3 +218,67 @@ func TestDebugHandlers(t *testing.T) {
 		t.Errorf("Error in generatating debug endpoint list")
 	}
 }
+
+func TestCAAuditz(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	mux := http.NewServeMux()
+	s.Discovery.AddDebugHandlers(mux, false, nil)
+	get := func(path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := get("/debug/ca_auditz"); rr.Code != http.StatusNotFound {
+		t.Errorf("got code %d without audit log, want 404", rr.Code)
+	}
+
+	s.Discovery.CAAuditLog = audit.New(10)
+	for _, id := range []string{"a", "b", "a"} {
+		s.Discovery.CAAuditLog.Add(audit.Record{Result: audit.Issued, Identities: []string{id}})
+	}
+	cases := []struct {
+		path string
+		want int
+	}{
+		{"/debug/ca_auditz", 3},
+		{"/debug/ca_auditz?identity=a", 2},
+		{"/debug/ca_auditz?identity=a&limit=1", 1},
+		{"/debug/ca_auditz?result=denied", 0},
+	}
+	for _, tt := range cases {
+		rr := get(tt.path)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: got code %d, want 200", tt.path, rr.Code)
+		}
+		var records []audit.Record
+		if err := json.Unmarshal(rr.Body.Bytes(), &records); err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		if len(records) != tt.want {
+			t.Errorf("%s: got %d records, want %d", tt.path, len(records), tt.want)
+		}
+	}
+	if rr := get("/debug/ca_auditz?limit=x"); rr.Code != http.StatusBadRequest {
+		t.Errorf("got code %d for an invalid limit, want 400", rr.Code)
+	}
+}
+
+func TestCARotationz(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	mux := http.NewServeMux()
+	s.Discovery.AddDebugHandlers(mux, false, nil)
+	req, err := http.NewRequest("GET", "/debug/ca_rotationz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("got code %d without CA root rotation, want 404", rr.Code)
+	}
+}
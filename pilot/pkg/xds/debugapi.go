@@ -0,0 +1,393 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"github.com/golang/protobuf/jsonpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/xds/debugapi"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+)
+
+// addVersionedDebugHandlers adds the handlers of the versioned debug API, see the debugapi package.
+func (s *DiscoveryServer) addVersionedDebugHandlers(mux *http.ServeMux) {
+	s.addDebugHandler(mux, debugapi.Path(debugapi.SyncStatusEndpoint),
+		"Synchronization status of the proxies connected to this Pilot instance (versioned, paginated)", s.syncStatusV1)
+	s.addDebugHandler(mux, debugapi.Path(debugapi.ConnectionsEndpoint),
+		"Info about the connected XDS clients (versioned, paginated)", s.connectionsV1)
+	s.addDebugHandler(mux, debugapi.Path(debugapi.EndpointShardsEndpoint),
+		"Info about the endpoint shards (versioned, paginated)", s.endpointShardsV1)
+	s.addDebugHandler(mux, debugapi.Path(debugapi.PushStatusEndpoint),
+		"Errors of the last push (versioned, paginated)", s.pushStatusV1)
+	s.addDebugHandler(mux, debugapi.Path(debugapi.ConfigDumpEndpoint),
+		"Resources generated for the passed in proxyID, filtered by type and resource name (versioned, paginated)", s.configDumpV1)
+}
+
+// sortedClients returns the connected clients matching the list options, sorted by connection ID.
+func (s *DiscoveryServer) sortedClients(opts debugapi.ListOptions) []*Connection {
+	clients := []*Connection{}
+	for _, con := range s.Clients() {
+		if con.proxy == nil || !opts.MatchProxy(con.proxy.ID, con.proxy.ConfigNamespace) {
+			continue
+		}
+		clients = append(clients, con)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ConID < clients[j].ConID
+	})
+	return clients
+}
+
+// pageClients returns the current page of the clients sorted by connection ID.
+func pageClients(opts debugapi.ListOptions, clients []*Connection) ([]*Connection, string) {
+	keys := make([]string, 0, len(clients))
+	for _, con := range clients {
+		keys = append(keys, con.ConID)
+	}
+	from, to, next := opts.Page(keys)
+	return clients[from:to], next
+}
+
+func (s *DiscoveryServer) syncStatusV1(w http.ResponseWriter, req *http.Request) {
+	opts, err := debugapi.ParseListOptions(req.URL.Query())
+	if err != nil {
+		writeDebugError(w, http.StatusBadRequest, err)
+		return
+	}
+	clients, next := pageClients(opts, s.sortedClients(opts))
+	out := debugapi.SyncStatusList{
+		ListMeta: debugapi.ListMeta{Version: debugapi.Version, Continue: next},
+		Items:    make([]debugapi.SyncStatus, 0, len(clients)),
+	}
+	for _, con := range clients {
+		out.Items = append(out.Items, debugapi.SyncStatus{
+			ProxyID:        con.proxy.ID,
+			IstioVersion:   con.proxy.Metadata.IstioVersion,
+			ClusterSent:    con.NonceSent(v3.ClusterType),
+			ClusterAcked:   con.NonceAcked(v3.ClusterType),
+			ClusterNacked:  con.NonceNacked(v3.ClusterType),
+			ListenerSent:   con.NonceSent(v3.ListenerType),
+			ListenerAcked:  con.NonceAcked(v3.ListenerType),
+			ListenerNacked: con.NonceNacked(v3.ListenerType),
+			RouteSent:      con.NonceSent(v3.RouteType),
+			RouteAcked:     con.NonceAcked(v3.RouteType),
+			RouteNacked:    con.NonceNacked(v3.RouteType),
+			EndpointSent:   con.NonceSent(v3.EndpointType),
+			EndpointAcked:  con.NonceAcked(v3.EndpointType),
+			EndpointNacked: con.NonceNacked(v3.EndpointType),
+		})
+	}
+	writeDebugJSON(w, out)
+}
+
+func (s *DiscoveryServer) connectionsV1(w http.ResponseWriter, req *http.Request) {
+	opts, err := debugapi.ParseListOptions(req.URL.Query())
+	if err != nil {
+		writeDebugError(w, http.StatusBadRequest, err)
+		return
+	}
+	clients, next := pageClients(opts, s.sortedClients(opts))
+	out := debugapi.ConnectionList{
+		ListMeta: debugapi.ListMeta{Version: debugapi.Version, Continue: next},
+		Items:    make([]debugapi.Connection, 0, len(clients)),
+	}
+	for _, con := range clients {
+		c := debugapi.Connection{
+			ConnectionID: con.ConID,
+			ProxyID:      con.proxy.ID,
+			Namespace:    con.proxy.ConfigNamespace,
+			ConnectedAt:  con.Connect,
+			PeerAddress:  con.PeerAddr,
+			Watches:      map[string][]string{},
+		}
+		con.proxy.RLock()
+		for typeURL, wr := range con.proxy.WatchedResources {
+			names := wr.ResourceNames
+			if names == nil {
+				names = []string{}
+			}
+			c.Watches[typeURL] = names
+		}
+		con.proxy.RUnlock()
+		out.Items = append(out.Items, c)
+	}
+	writeDebugJSON(w, out)
+}
+
+func (s *DiscoveryServer) endpointShardsV1(w http.ResponseWriter, req *http.Request) {
+	opts, err := debugapi.ParseListOptions(req.URL.Query())
+	if err != nil {
+		writeDebugError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	type serviceKey struct {
+		hostname, namespace string
+	}
+	services := map[string]serviceKey{}
+	keys := []string{}
+	s.mutex.RLock()
+	for hostname, byNamespace := range s.EndpointShardsByService {
+		for namespace := range byNamespace {
+			if opts.Namespace != "" && opts.Namespace != namespace {
+				continue
+			}
+			key := namespace + "/" + hostname
+			services[key] = serviceKey{hostname: hostname, namespace: namespace}
+			keys = append(keys, key)
+		}
+	}
+	s.mutex.RUnlock()
+	sort.Strings(keys)
+	from, to, next := opts.Page(keys)
+
+	out := debugapi.ServiceEndpointsList{
+		ListMeta: debugapi.ListMeta{Version: debugapi.Version, Continue: next},
+		Items:    make([]debugapi.ServiceEndpoints, 0, to-from),
+	}
+	for _, key := range keys[from:to] {
+		svc := services[key]
+		s.mutex.RLock()
+		shards := s.EndpointShardsByService[svc.hostname][svc.namespace]
+		s.mutex.RUnlock()
+		if shards == nil {
+			// Deleted while building the response.
+			continue
+		}
+		item := debugapi.ServiceEndpoints{
+			Hostname:  svc.hostname,
+			Namespace: svc.namespace,
+			Shards:    map[string][]debugapi.Endpoint{},
+		}
+		shards.mutex.RLock()
+		for shard, endpoints := range shards.Shards {
+			eps := make([]debugapi.Endpoint, 0, len(endpoints))
+			for _, ep := range endpoints {
+				eps = append(eps, debugapi.Endpoint{
+					Address:         ep.Address,
+					Port:            ep.EndpointPort,
+					ServicePortName: ep.ServicePortName,
+					ServiceAccount:  ep.ServiceAccount,
+					Network:         ep.Network,
+					Locality:        ep.Locality.Label,
+					Cluster:         ep.Locality.ClusterID,
+					TLSMode:         ep.TLSMode,
+					Labels:          ep.Labels,
+				})
+			}
+			item.Shards[shard] = eps
+		}
+		shards.mutex.RUnlock()
+		out.Items = append(out.Items, item)
+	}
+	writeDebugJSON(w, out)
+}
+
+func (s *DiscoveryServer) pushStatusV1(w http.ResponseWriter, req *http.Request) {
+	opts, err := debugapi.ParseListOptions(req.URL.Query())
+	if err != nil {
+		writeDebugError(w, http.StatusBadRequest, err)
+		return
+	}
+	out := debugapi.PushStatus{
+		ListMeta: debugapi.ListMeta{Version: debugapi.Version},
+		Items:    []debugapi.PushError{},
+	}
+	ps := model.LastPushStatus
+	if ps == nil {
+		writeDebugJSON(w, out)
+		return
+	}
+	out.PushVersion = ps.PushVersion
+
+	// StatusJSON copies the status under the lock of the push context.
+	b, err := ps.StatusJSON()
+	if err != nil {
+		writeDebugError(w, http.StatusInternalServerError, err)
+		return
+	}
+	status := map[string]map[string]model.ProxyPushStatus{}
+	if err := json.Unmarshal(b, &status); err != nil {
+		writeDebugError(w, http.StatusInternalServerError, err)
+		return
+	}
+	errs := []debugapi.PushError{}
+	for metric, byKey := range status {
+		for key, ps := range byKey {
+			if !opts.MatchProxy(ps.Proxy, proxyIDNamespace(ps.Proxy)) {
+				continue
+			}
+			errs = append(errs, debugapi.PushError{Metric: metric, Key: key, ProxyID: ps.Proxy, Message: ps.Message})
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		if errs[i].Metric != errs[j].Metric {
+			return errs[i].Metric < errs[j].Metric
+		}
+		return errs[i].Key < errs[j].Key
+	})
+	keys := make([]string, 0, len(errs))
+	for _, e := range errs {
+		// The metric names don't contain spaces, so the keys sort like the errors.
+		keys = append(keys, e.Metric+" "+e.Key)
+	}
+	from, to, next := opts.Page(keys)
+	out.Continue = next
+	out.Items = append(out.Items, errs[from:to]...)
+	writeDebugJSON(w, out)
+}
+
+func (s *DiscoveryServer) configDumpV1(w http.ResponseWriter, req *http.Request) {
+	opts, err := debugapi.ParseListOptions(req.URL.Query())
+	if err != nil {
+		writeDebugError(w, http.StatusBadRequest, err)
+		return
+	}
+	if opts.ProxyID == "" {
+		writeDebugError(w, http.StatusBadRequest, fmt.Errorf("you must provide a proxyID in the query string"))
+		return
+	}
+	con := s.getProxyConnection(opts.ProxyID)
+	if con == nil {
+		writeDebugError(w, http.StatusNotFound, fmt.Errorf("proxy not connected to this Pilot instance"))
+		return
+	}
+	resources, err := s.configResources(con, opts)
+	if err != nil {
+		writeDebugError(w, http.StatusInternalServerError, err)
+		return
+	}
+	keys := make([]string, 0, len(resources))
+	for _, r := range resources {
+		keys = append(keys, r.Type+"/"+r.Name)
+	}
+	from, to, next := opts.Page(keys)
+	writeDebugJSON(w, debugapi.ConfigDumpList{
+		ListMeta: debugapi.ListMeta{Version: debugapi.Version, Continue: next},
+		ProxyID:  con.proxy.ID,
+		Items:    resources[from:to],
+	})
+}
+
+// configResources returns the resources generated for the connection that match the list options, sorted
+// by type and name. Only the resources of the requested type are generated.
+func (s *DiscoveryServer) configResources(con *Connection, opts debugapi.ListOptions) ([]debugapi.ConfigResource, error) {
+	push := s.globalPushContext()
+	generated := map[string][]proto.Message{}
+	if opts.Type == "" || opts.Type == debugapi.ClusterConfig {
+		for _, r := range s.ConfigGenerator.BuildClusters(con.proxy, push) {
+			c := &cluster.Cluster{}
+			if err := r.UnmarshalTo(c); err != nil {
+				return nil, err
+			}
+			generated[debugapi.ClusterConfig] = append(generated[debugapi.ClusterConfig], c)
+		}
+	}
+	if opts.Type == "" || opts.Type == debugapi.ListenerConfig {
+		for _, l := range s.ConfigGenerator.BuildListeners(con.proxy, push) {
+			generated[debugapi.ListenerConfig] = append(generated[debugapi.ListenerConfig], l)
+		}
+	}
+	if opts.Type == "" || opts.Type == debugapi.RouteConfig {
+		for _, r := range s.ConfigGenerator.BuildHTTPRoutes(con.proxy, push, con.Routes()) {
+			rc := &route.RouteConfiguration{}
+			if err := r.UnmarshalTo(rc); err != nil {
+				return nil, err
+			}
+			generated[debugapi.RouteConfig] = append(generated[debugapi.RouteConfig], rc)
+		}
+	}
+	if opts.Type == "" || opts.Type == debugapi.SecretConfig {
+		for _, secret := range s.redactedSecrets(con) {
+			generated[debugapi.SecretConfig] = append(generated[debugapi.SecretConfig], secret)
+		}
+	}
+
+	jsonm := &jsonpb.Marshaler{}
+	resources := []debugapi.ConfigResource{}
+	for _, typ := range debugapi.ConfigTypes {
+		byName := []debugapi.ConfigResource{}
+		for _, m := range generated[typ] {
+			name := resourceName(m)
+			if !opts.MatchResource(typ, name) {
+				continue
+			}
+			a, err := anypb.New(m)
+			if err != nil {
+				return nil, err
+			}
+			b, err := jsonm.MarshalToString(a)
+			if err != nil {
+				return nil, err
+			}
+			byName = append(byName, debugapi.ConfigResource{Type: typ, Name: name, Resource: json.RawMessage(b)})
+		}
+		sort.Slice(byName, func(i, j int) bool {
+			return byName[i].Name < byName[j].Name
+		})
+		resources = append(resources, byName...)
+	}
+	return resources, nil
+}
+
+func resourceName(m proto.Message) string {
+	switch r := m.(type) {
+	case *cluster.Cluster:
+		return r.Name
+	case *listener.Listener:
+		return r.Name
+	case *route.RouteConfiguration:
+		return r.Name
+	case *tls.Secret:
+		return r.Name
+	}
+	return ""
+}
+
+// proxyIDNamespace returns the namespace of a proxy from its ID, <pod name>.<namespace>.
+func proxyIDNamespace(proxyID string) string {
+	if i := strings.LastIndex(proxyID, "."); i >= 0 {
+		return proxyID[i+1:]
+	}
+	return ""
+}
+
+func writeDebugJSON(w http.ResponseWriter, obj interface{}) {
+	b, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		writeDebugError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+func writeDebugError(w http.ResponseWriter, code int, err error) {
+	w.WriteHeader(code)
+	_, _ = fmt.Fprint(w, err.Error())
+}
@@ -0,0 +1,216 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debugapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	emptypb "github.com/golang/protobuf/ptypes/empty"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Doer sends a GET request for the path, including the query, to Istiod and returns the response body.
+type Doer func(ctx context.Context, path string) ([]byte, error)
+
+// HTTPDoer returns a Doer sending the requests to the Istiod HTTP debug server at baseURL, for example
+// http://localhost:15014.
+func HTTPDoer(baseURL string, client *http.Client) Doer {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return func(ctx context.Context, path string) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s returned %d: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		return body, nil
+	}
+}
+
+// Client reads the versioned Istiod debug endpoints. List calls follow the pagination until all pages are
+// read, the Limit of the list options sets the page size.
+type Client struct {
+	do Doer
+}
+
+// NewClient creates a client sending the requests with do.
+func NewClient(do Doer) *Client {
+	return &Client{do: do}
+}
+
+// SyncStatus returns the synchronization status of the proxies connected to Istiod.
+func (c *Client) SyncStatus(ctx context.Context, opts ListOptions) ([]SyncStatus, error) {
+	var items []SyncStatus
+	err := c.list(ctx, SyncStatusEndpoint, opts, func(b []byte) (string, error) {
+		page := SyncStatusList{}
+		if err := c.decode(b, &page.ListMeta, &page); err != nil {
+			return "", err
+		}
+		items = append(items, page.Items...)
+		return page.Continue, nil
+	})
+	return items, err
+}
+
+// Connections returns the XDS clients connected to Istiod.
+func (c *Client) Connections(ctx context.Context, opts ListOptions) ([]Connection, error) {
+	var items []Connection
+	err := c.list(ctx, ConnectionsEndpoint, opts, func(b []byte) (string, error) {
+		page := ConnectionList{}
+		if err := c.decode(b, &page.ListMeta, &page); err != nil {
+			return "", err
+		}
+		items = append(items, page.Items...)
+		return page.Continue, nil
+	})
+	return items, err
+}
+
+// EndpointShards returns the endpoints of the services known to Istiod. The ProxyID option is ignored.
+func (c *Client) EndpointShards(ctx context.Context, opts ListOptions) ([]ServiceEndpoints, error) {
+	var items []ServiceEndpoints
+	err := c.list(ctx, EndpointShardsEndpoint, opts, func(b []byte) (string, error) {
+		page := ServiceEndpointsList{}
+		if err := c.decode(b, &page.ListMeta, &page); err != nil {
+			return "", err
+		}
+		items = append(items, page.Items...)
+		return page.Continue, nil
+	})
+	return items, err
+}
+
+// PushStatus returns the errors recorded by the last push.
+func (c *Client) PushStatus(ctx context.Context, opts ListOptions) (*PushStatus, error) {
+	status := &PushStatus{}
+	err := c.list(ctx, PushStatusEndpoint, opts, func(b []byte) (string, error) {
+		page := PushStatus{}
+		if err := c.decode(b, &page.ListMeta, &page); err != nil {
+			return "", err
+		}
+		status.Version = page.Version
+		status.PushVersion = page.PushVersion
+		status.Items = append(status.Items, page.Items...)
+		return page.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// ConfigDump returns the resources Istiod generates for the proxy of the ProxyID option, which is required.
+// The Namespace option is ignored.
+func (c *Client) ConfigDump(ctx context.Context, opts ListOptions) ([]ConfigResource, error) {
+	if opts.ProxyID == "" {
+		return nil, fmt.Errorf("the proxy ID is required to get a config dump")
+	}
+	var items []ConfigResource
+	err := c.list(ctx, ConfigDumpEndpoint, opts, func(b []byte) (string, error) {
+		page := ConfigDumpList{}
+		if err := c.decode(b, &page.ListMeta, &page); err != nil {
+			return "", err
+		}
+		items = append(items, page.Items...)
+		return page.Continue, nil
+	})
+	return items, err
+}
+
+// UnmarshalResource decodes the Envoy resource of a config_dump item. Resources of types unknown to the
+// client are decoded as an empty message, so that the client keeps working with newer Envoy versions.
+func UnmarshalResource(r ConfigResource) (*any.Any, error) {
+	res := &any.Any{}
+	if err := (&jsonpb.Unmarshaler{
+		AllowUnknownFields: true,
+		AnyResolver:        nonstrictResolver{},
+	}).Unmarshal(bytes.NewReader(r.Resource), res); err != nil {
+		return nil, fmt.Errorf("failed to parse %s %s: %v", r.Type, r.Name, err)
+	}
+	return res, nil
+}
+
+// list reads all the pages of a list endpoint, passing each response to handle.
+func (c *Client) list(ctx context.Context, endpoint string, opts ListOptions, handle func([]byte) (string, error)) error {
+	for {
+		path := Path(endpoint)
+		if query := opts.Values().Encode(); query != "" {
+			path += "?" + query
+		}
+		b, err := c.do(ctx, path)
+		if err != nil {
+			return err
+		}
+		next, err := handle(b)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s response: %v", endpoint, err)
+		}
+		if next == "" || next == opts.Continue {
+			return nil
+		}
+		opts.Continue = next
+	}
+}
+
+// decode unmarshals a list response, checking it uses the schema version of the client.
+func (c *Client) decode(b []byte, meta *ListMeta, into interface{}) error {
+	if err := json.Unmarshal(b, into); err != nil {
+		return err
+	}
+	if meta.Version != Version {
+		return fmt.Errorf("unsupported debug API version %q, expected %q", meta.Version, Version)
+	}
+	return nil
+}
+
+// nonstrictResolver is an AnyResolver that ignores unknown proto messages, so that the client keeps working
+// with newer Envoy versions.
+type nonstrictResolver struct{}
+
+func (nonstrictResolver) Resolve(typeURL string) (proto.Message, error) {
+	mname := typeURL
+	if slash := strings.LastIndex(typeURL, "/"); slash >= 0 {
+		mname = mname[slash+1:]
+	}
+	// nolint: staticcheck
+	mt := proto.MessageType(mname)
+	if mt == nil {
+		return &exprpb.Type{TypeKind: &exprpb.Type_Dyn{Dyn: &emptypb.Empty{}}}, nil
+	}
+	return reflect.New(mt.Elem()).Interface().(proto.Message), nil
+}
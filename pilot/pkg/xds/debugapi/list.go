@@ -0,0 +1,163 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debugapi
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Query parameters of the list endpoints.
+const (
+	namespaceParam = "namespace"
+	proxyIDParam   = "proxyID"
+	typeParam      = "type"
+	resourceParam  = "resource"
+	limitParam     = "limit"
+	continueParam  = "continue"
+)
+
+// ListOptions filters and paginates the result of a list endpoint.
+type ListOptions struct {
+	// Namespace only returns the items of proxies or services in the namespace.
+	Namespace string
+	// ProxyID only returns the items of the proxy with this ID, <pod name>.<namespace> for Kubernetes pods.
+	ProxyID string
+	// Type only returns the config_dump resources of this type, one of the ConfigTypes.
+	Type string
+	// Resource only returns the config_dump resource with this name.
+	Resource string
+	// Limit is the maximum number of items in a response. If 0, all items are returned at once.
+	Limit int
+	// Continue is the token returned by the previous page.
+	Continue string
+}
+
+// ParseListOptions reads the list options from the query parameters of a request.
+func ParseListOptions(query url.Values) (ListOptions, error) {
+	opts := ListOptions{
+		Namespace: query.Get(namespaceParam),
+		ProxyID:   query.Get(proxyIDParam),
+		Type:      query.Get(typeParam),
+		Resource:  query.Get(resourceParam),
+		Continue:  query.Get(continueParam),
+	}
+	if opts.Type != "" && !isConfigType(opts.Type) {
+		return opts, fmt.Errorf("invalid type %q, expected one of %v", opts.Type, ConfigTypes)
+	}
+	if l := query.Get(limitParam); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			return opts, fmt.Errorf("invalid limit %q", l)
+		}
+		opts.Limit = limit
+	}
+	if opts.Continue != "" {
+		if _, err := decodeContinue(opts.Continue); err != nil {
+			return opts, fmt.Errorf("invalid continue token %q", opts.Continue)
+		}
+	}
+	return opts, nil
+}
+
+// Values returns the query parameters for the list options.
+func (o ListOptions) Values() url.Values {
+	query := url.Values{}
+	if o.Namespace != "" {
+		query.Set(namespaceParam, o.Namespace)
+	}
+	if o.ProxyID != "" {
+		query.Set(proxyIDParam, o.ProxyID)
+	}
+	if o.Type != "" {
+		query.Set(typeParam, o.Type)
+	}
+	if o.Resource != "" {
+		query.Set(resourceParam, o.Resource)
+	}
+	if o.Limit > 0 {
+		query.Set(limitParam, strconv.Itoa(o.Limit))
+	}
+	if o.Continue != "" {
+		query.Set(continueParam, o.Continue)
+	}
+	return query
+}
+
+// MatchProxy returns true if the proxy with the given ID and namespace is selected by the options.
+func (o ListOptions) MatchProxy(proxyID, namespace string) bool {
+	if o.ProxyID != "" && o.ProxyID != proxyID {
+		return false
+	}
+	if o.Namespace != "" && o.Namespace != namespace {
+		return false
+	}
+	return true
+}
+
+// MatchResource returns true if the config_dump resource with the given type and name is selected by the options.
+func (o ListOptions) MatchResource(typ, name string) bool {
+	if o.Type != "" && o.Type != typ {
+		return false
+	}
+	if o.Resource != "" && o.Resource != name {
+		return false
+	}
+	return true
+}
+
+func isConfigType(typ string) bool {
+	for _, t := range ConfigTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Page returns the range [from, to) of the items in the current page, and the continue token of the next
+// page. keys must be unique and sorted, the page starts after the key encoded in the continue token.
+func (o ListOptions) Page(keys []string) (from, to int, next string) {
+	if o.Continue != "" {
+		last, _ := decodeContinue(o.Continue)
+		from = sort.Search(len(keys), func(i int) bool {
+			return keys[i] > last
+		})
+	}
+	to = len(keys)
+	if o.Limit > 0 && from+o.Limit < to {
+		to = from + o.Limit
+		next = encodeContinue(keys[to-1])
+	}
+	return from, to, next
+}
+
+// The continue token is the last key of the previous page. It is opaque to clients, so that the
+// pagination can change without breaking them.
+func encodeContinue(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeContinue(token string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(token))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,117 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debugapi
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestListOptionsRoundTrip(t *testing.T) {
+	opts := ListOptions{
+		Namespace: "default",
+		ProxyID:   "a.default",
+		Type:      ClusterConfig,
+		Resource:  "outbound|80||a.default.svc.cluster.local",
+		Limit:     10,
+		Continue:  encodeContinue("key"),
+	}
+	got, err := ParseListOptions(opts.Values())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, opts) {
+		t.Fatalf("got %+v, want %+v", got, opts)
+	}
+
+	for _, query := range []string{"limit=-1", "limit=abc", "continue=!!", "type=endpoint"} {
+		values, _ := url.ParseQuery(query)
+		if _, err := ParseListOptions(values); err == nil {
+			t.Errorf("expected error for %q", query)
+		}
+	}
+}
+
+func TestPage(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e"}
+
+	var got []string
+	opts := ListOptions{Limit: 2}
+	pages := 0
+	for {
+		from, to, next := opts.Page(keys)
+		got = append(got, keys[from:to]...)
+		pages++
+		if next == "" {
+			break
+		}
+		opts.Continue = next
+	}
+	if !reflect.DeepEqual(got, keys) || pages != 3 {
+		t.Fatalf("got %v in %d pages", got, pages)
+	}
+
+	// All keys without a limit.
+	if from, to, next := (ListOptions{}).Page(keys); from != 0 || to != len(keys) || next != "" {
+		t.Fatalf("unexpected page [%d, %d) %q", from, to, next)
+	}
+
+	// A key removed between pages doesn't shift the next page.
+	from, to, _ := ListOptions{Limit: 2, Continue: encodeContinue("b")}.Page([]string{"a", "c", "d", "e"})
+	if from != 1 || to != 3 {
+		t.Fatalf("unexpected page [%d, %d)", from, to)
+	}
+}
+
+func TestMatchProxy(t *testing.T) {
+	cases := []struct {
+		opts      ListOptions
+		proxyID   string
+		namespace string
+		want      bool
+	}{
+		{ListOptions{}, "a.default", "default", true},
+		{ListOptions{Namespace: "default"}, "a.default", "default", true},
+		{ListOptions{Namespace: "other"}, "a.default", "default", false},
+		{ListOptions{ProxyID: "a.default"}, "a.default", "default", true},
+		{ListOptions{ProxyID: "b.default"}, "a.default", "default", false},
+	}
+	for _, tt := range cases {
+		if got := tt.opts.MatchProxy(tt.proxyID, tt.namespace); got != tt.want {
+			t.Errorf("%+v.MatchProxy(%v, %v) = %v, want %v", tt.opts, tt.proxyID, tt.namespace, got, tt.want)
+		}
+	}
+}
+
+func TestMatchResource(t *testing.T) {
+	cases := []struct {
+		opts ListOptions
+		typ  string
+		name string
+		want bool
+	}{
+		{ListOptions{}, ClusterConfig, "a", true},
+		{ListOptions{Type: ClusterConfig}, ClusterConfig, "a", true},
+		{ListOptions{Type: RouteConfig}, ClusterConfig, "a", false},
+		{ListOptions{Resource: "a"}, ClusterConfig, "a", true},
+		{ListOptions{Type: ClusterConfig, Resource: "b"}, ClusterConfig, "a", false},
+	}
+	for _, tt := range cases {
+		if got := tt.opts.MatchResource(tt.typ, tt.name); got != tt.want {
+			t.Errorf("%+v.MatchResource(%v, %v) = %v, want %v", tt.opts, tt.typ, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package debugapi defines the versioned schema of the Istiod debug endpoints, and a client for them.
+//
+// The versioned endpoints are served under /debug/<version>/ next to the legacy, unversioned ones. List
+// endpoints can be filtered by namespace and proxy ID, and are paginated with limit/continue, so
+// large meshes don't have to be dumped in a single response.
+package debugapi
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Version is the version of the debug API schema defined in this package.
+const Version = "v1"
+
+// Names of the versioned debug endpoints.
+const (
+	SyncStatusEndpoint     = "syncz"
+	ConnectionsEndpoint    = "connections"
+	EndpointShardsEndpoint = "endpointShardz"
+	PushStatusEndpoint     = "push_status"
+	ConfigDumpEndpoint     = "config_dump"
+)
+
+// Types of the resources of the config_dump endpoint.
+const (
+	ClusterConfig  = "cluster"
+	ListenerConfig = "listener"
+	RouteConfig    = "route"
+	SecretConfig   = "secret"
+)
+
+// ConfigTypes are the resource types of the config_dump endpoint, in the order they are listed.
+var ConfigTypes = []string{ClusterConfig, ListenerConfig, RouteConfig, SecretConfig}
+
+// Path returns the HTTP path of the given versioned debug endpoint.
+func Path(endpoint string) string {
+	return "/debug/" + Version + "/" + endpoint
+}
+
+// ListMeta describes a page of a list response.
+type ListMeta struct {
+	// Version is the version of the debug API schema.
+	Version string `json:"version"`
+	// Continue is set if there are more results; it is passed as the continue option to get the next page.
+	Continue string `json:"continue,omitempty"`
+}
+
+// SyncStatus is the synchronization status between Istiod and a given proxy.
+// The Nacked fields are the nonces of the last responses rejected by the proxy, if it did not ACK a response since.
+type SyncStatus struct {
+	ProxyID        string `json:"proxy,omitempty"`
+	ProxyVersion   string `json:"proxy_version,omitempty"`
+	IstioVersion   string `json:"istio_version,omitempty"`
+	ClusterSent    string `json:"cluster_sent,omitempty"`
+	ClusterAcked   string `json:"cluster_acked,omitempty"`
+	ClusterNacked  string `json:"cluster_nacked,omitempty"`
+	ListenerSent   string `json:"listener_sent,omitempty"`
+	ListenerAcked  string `json:"listener_acked,omitempty"`
+	ListenerNacked string `json:"listener_nacked,omitempty"`
+	RouteSent      string `json:"route_sent,omitempty"`
+	RouteAcked     string `json:"route_acked,omitempty"`
+	RouteNacked    string `json:"route_nacked,omitempty"`
+	EndpointSent   string `json:"endpoint_sent,omitempty"`
+	EndpointAcked  string `json:"endpoint_acked,omitempty"`
+	EndpointNacked string `json:"endpoint_nacked,omitempty"`
+}
+
+// SyncStatusList is the response of the syncz endpoint.
+type SyncStatusList struct {
+	ListMeta
+	Items []SyncStatus `json:"items"`
+}
+
+// Connection is an XDS client connected to Istiod.
+type Connection struct {
+	ConnectionID string    `json:"connectionId"`
+	ProxyID      string    `json:"proxy,omitempty"`
+	Namespace    string    `json:"namespace,omitempty"`
+	ConnectedAt  time.Time `json:"connectedAt"`
+	PeerAddress  string    `json:"address"`
+	// Watches are the resource names watched by the proxy, keyed by type URL.
+	Watches map[string][]string `json:"watches,omitempty"`
+}
+
+// ConnectionList is the response of the connections endpoint.
+type ConnectionList struct {
+	ListMeta
+	Items []Connection `json:"items"`
+}
+
+// Endpoint is an endpoint of a service, as tracked by Istiod for EDS.
+type Endpoint struct {
+	Address         string            `json:"address"`
+	Port            uint32            `json:"port"`
+	ServicePortName string            `json:"servicePortName,omitempty"`
+	ServiceAccount  string            `json:"serviceAccount,omitempty"`
+	Network         string            `json:"network,omitempty"`
+	Locality        string            `json:"locality,omitempty"`
+	Cluster         string            `json:"cluster,omitempty"`
+	TLSMode         string            `json:"tlsMode,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+}
+
+// ServiceEndpoints are the endpoints of a service, grouped by shard - the registry they come from.
+type ServiceEndpoints struct {
+	Hostname  string                `json:"hostname"`
+	Namespace string                `json:"namespace"`
+	Shards    map[string][]Endpoint `json:"shards"`
+}
+
+// ServiceEndpointsList is the response of the endpointShardz endpoint.
+type ServiceEndpointsList struct {
+	ListMeta
+	Items []ServiceEndpoints `json:"items"`
+}
+
+// PushError is an error or warning recorded by the last push.
+type PushError struct {
+	// Metric is the name of the push metric, for example pilot_conflict_inbound_listener.
+	Metric string `json:"metric"`
+	// Key identifies the erroneous resource for the metric, for example the listener or cluster name.
+	Key     string `json:"key"`
+	ProxyID string `json:"proxy,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// PushStatus is the response of the push_status endpoint.
+type PushStatus struct {
+	ListMeta
+	// PushVersion is the version of the push context the errors were recorded for.
+	PushVersion string      `json:"pushVersion,omitempty"`
+	Items       []PushError `json:"items"`
+}
+
+// ConfigResource is a resource Istiod generates for a proxy.
+type ConfigResource struct {
+	// Type is one of the ConfigTypes.
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// Resource is the Envoy resource, as a JSON encoded google.protobuf.Any. The private keys of the
+	// secrets are redacted.
+	Resource json.RawMessage `json:"resource"`
+}
+
+// ConfigDumpList is the response of the config_dump endpoint.
+type ConfigDumpList struct {
+	ListMeta
+	ProxyID string           `json:"proxy"`
+	Items   []ConfigResource `json:"items"`
+}
@@ -0,0 +1,200 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+
+	"istio.io/istio/pilot/pkg/xds"
+	"istio.io/istio/pilot/pkg/xds/debugapi"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+const debugServiceEntry = `
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: se
+  namespace: other
+spec:
+  hosts:
+  - se.other.svc.cluster.local
+  ports:
+  - number: 80
+    name: http
+    protocol: HTTP
+  location: MESH_INTERNAL
+  resolution: STATIC
+  endpoints:
+  - address: 10.0.0.1
+    labels:
+      app: se
+  - address: 10.0.0.2
+`
+
+func TestVersionedDebugHandlers(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{ConfigString: debugServiceEntry})
+	mux := http.NewServeMux()
+	s.Discovery.AddDebugHandlers(mux, false, nil)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := debugapi.NewClient(debugapi.HTTPDoer(server.URL, server.Client()))
+
+	ids := map[string]string{
+		"sidecar~1.1.1.1~a.default~default.svc.cluster.local": "a.default",
+		"sidecar~1.1.1.2~b.default~default.svc.cluster.local": "b.default",
+		"sidecar~1.1.1.3~c.other~other.svc.cluster.local":     "c.other",
+	}
+	for id := range ids {
+		ads := s.ConnectADS().WithID(id)
+		ads.RequestResponseAck(&discovery.DiscoveryRequest{TypeUrl: v3.ClusterType})
+	}
+	ctx := context.Background()
+
+	proxyIDs := func(opts debugapi.ListOptions) []string {
+		var got []string
+		retry.UntilSuccessOrFail(t, func() error {
+			statuses, err := client.SyncStatus(ctx, opts)
+			if err != nil {
+				return err
+			}
+			got = nil
+			for _, s := range statuses {
+				if s.ClusterAcked == "" {
+					return fmt.Errorf("clusters of %v not acked yet", s.ProxyID)
+				}
+				got = append(got, s.ProxyID)
+			}
+			sort.Strings(got)
+			return nil
+		})
+		return got
+	}
+	t.Run("syncz", func(t *testing.T) {
+		// A page size smaller than the number of proxies, so the client has to follow the pages.
+		if got := proxyIDs(debugapi.ListOptions{Limit: 2}); len(got) != 3 {
+			t.Fatalf("expected 3 proxies, got %v", got)
+		}
+		if got := proxyIDs(debugapi.ListOptions{Namespace: "default", Limit: 1}); len(got) != 2 ||
+			got[0] != "a.default" || got[1] != "b.default" {
+			t.Fatalf("expected proxies of namespace default, got %v", got)
+		}
+		if got := proxyIDs(debugapi.ListOptions{ProxyID: "c.other"}); len(got) != 1 || got[0] != "c.other" {
+			t.Fatalf("expected proxy c.other, got %v", got)
+		}
+	})
+
+	t.Run("connections", func(t *testing.T) {
+		connections, err := client.Connections(ctx, debugapi.ListOptions{Namespace: "other", Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(connections) != 1 || connections[0].ProxyID != "c.other" || connections[0].Namespace != "other" {
+			t.Fatalf("unexpected connections %+v", connections)
+		}
+		if _, f := connections[0].Watches[v3.ClusterType]; !f {
+			t.Fatalf("expected cluster watch, got %v", connections[0].Watches)
+		}
+	})
+
+	t.Run("endpointShardz", func(t *testing.T) {
+		services, err := client.EndpointShards(ctx, debugapi.ListOptions{Namespace: "other", Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(services) != 1 || services[0].Hostname != "se.other.svc.cluster.local" {
+			t.Fatalf("unexpected services %+v", services)
+		}
+		var addresses []string
+		for _, eps := range services[0].Shards {
+			for _, ep := range eps {
+				addresses = append(addresses, ep.Address)
+			}
+		}
+		sort.Strings(addresses)
+		if len(addresses) != 2 || addresses[0] != "10.0.0.1" || addresses[1] != "10.0.0.2" {
+			t.Fatalf("unexpected endpoints %v", addresses)
+		}
+	})
+
+	t.Run("push_status", func(t *testing.T) {
+		status, err := client.PushStatus(ctx, debugapi.ListOptions{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Version != debugapi.Version {
+			t.Fatalf("unexpected version %q", status.Version)
+		}
+	})
+
+	t.Run("config_dump", func(t *testing.T) {
+		all, err := client.ConfigDump(ctx, debugapi.ListOptions{ProxyID: "a.default", Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		types := map[string]int{}
+		for _, r := range all {
+			types[r.Type]++
+		}
+		if types[debugapi.ClusterConfig] == 0 || types[debugapi.ListenerConfig] == 0 {
+			t.Fatalf("expected clusters and listeners in the config dump, got %v", types)
+		}
+
+		clusters, err := client.ConfigDump(ctx, debugapi.ListOptions{ProxyID: "a.default", Type: debugapi.ClusterConfig})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(clusters) != types[debugapi.ClusterConfig] {
+			t.Fatalf("expected %d clusters, got %d", types[debugapi.ClusterConfig], len(clusters))
+		}
+
+		name := "outbound|80||se.other.svc.cluster.local"
+		got, err := client.ConfigDump(ctx, debugapi.ListOptions{ProxyID: "a.default", Type: debugapi.ClusterConfig, Resource: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0].Name != name {
+			t.Fatalf("expected cluster %v, got %+v", name, got)
+		}
+		a, err := debugapi.UnmarshalResource(got[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.TypeUrl != v3.ClusterType {
+			t.Fatalf("unexpected resource type %v", a.TypeUrl)
+		}
+
+		if _, err := client.ConfigDump(ctx, debugapi.ListOptions{ProxyID: "missing.default"}); err == nil {
+			t.Fatalf("expected error for a proxy not connected")
+		}
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, debugapi.Path(debugapi.SyncStatusEndpoint)+"?limit=-1", nil)
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected bad request, got %d", rr.Code)
+		}
+	})
+}
@@ -17,6 +17,8 @@ package xds
 import (
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"strconv"
 	"time"
 
 	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
@@ -27,6 +29,7 @@ import (
 	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes/any"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
@@ -314,6 +317,8 @@ func (s *DiscoveryServer) processDeltaRequest(req *discovery.DeltaDiscoveryReque
 	if s.StatusReporter != nil {
 		s.StatusReporter.RegisterEvent(con.ConID, req.TypeUrl, req.ResponseNonce)
 	}
+	// Resources the client unsubscribes from must be sent again if it subscribes back.
+	con.forgetSentResources(req.TypeUrl, req.ResourceNamesUnsubscribe...)
 	shouldRespond := s.shouldRespondDelta(con, req)
 
 	// Check if we have a blocked push. If this was an ACK, we will send it. Either way we remove the blocked push
@@ -361,6 +366,8 @@ func (s *DiscoveryServer) shouldRespondDelta(con *Connection, request *discovery
 		con.proxy.Lock()
 		con.proxy.WatchedResources[request.TypeUrl].NonceNacked = request.ResponseNonce
 		con.proxy.Unlock()
+		// We cannot tell which resources were rejected, so send all of them on the next push.
+		delete(con.sentResources, request.TypeUrl)
 		return false
 	}
 
@@ -382,6 +389,12 @@ func (s *DiscoveryServer) shouldRespondDelta(con *Connection, request *discovery
 			LastRequest:   deltaToSotwRequest(request),
 		}
 		con.proxy.Unlock()
+		// On reconnect, the client tells us the versions of the resources it already has.
+		sent := map[string]sentResource{}
+		for name, version := range request.InitialResourceVersions {
+			sent[name] = sentResource{version: version}
+		}
+		con.sentResources[request.TypeUrl] = sent
 		return true
 	}
 
@@ -446,8 +459,16 @@ func (s *DiscoveryServer) pushDeltaXds(con *Connection, push *model.PushContext,
 
 	t0 := time.Now()
 
-	res, err := gen.Generate(con.proxy, push, w, req)
-	if err != nil || res == nil {
+	var res model.Resources
+	var deletedRes []string
+	var err error
+	usedDelta := false
+	if dgen, f := gen.(model.XdsDeltaResourceGenerator); f {
+		res, deletedRes, usedDelta, err = dgen.GenerateDeltas(con.proxy, push, req, w)
+	} else {
+		res, err = gen.Generate(con.proxy, push, w, req)
+	}
+	if err != nil || (res == nil && len(deletedRes) == 0) {
 		// If we have nothing to send, report that we got an ACK for this version.
 		if s.StatusReporter != nil {
 			s.StatusReporter.RegisterEvent(con.ConID, w.TypeUrl, push.LedgerVersion)
@@ -456,12 +477,12 @@ func (s *DiscoveryServer) pushDeltaXds(con *Connection, push *model.PushContext,
 	}
 	defer func() { recordPushTime(w.TypeUrl, time.Since(t0)) }()
 
-	deltaResponse := convertResponseToDelta(currentVersion, res)
+	deltaResponse := convertResponseToDelta(res)
 	originalResponse := deltaResponse
+	subres := sets.NewSet(subscribe...)
 	if subscribe != nil {
 		// If subscribe is set, client is requesting specific resources. We should just give it the
 		// new resources it needs, rather than the entire set of known resources.
-		subres := sets.NewSet(subscribe...)
 		filteredResponse := []*discovery.Resource{}
 		for _, r := range deltaResponse {
 			if subres.Contains(r.Name) {
@@ -472,31 +493,66 @@ func (s *DiscoveryServer) pushDeltaXds(con *Connection, push *model.PushContext,
 		}
 		deltaResponse = filteredResponse
 	}
+	// Resources the client already has are not sent again, unless explicitly requested.
+	sent := con.sentResources[w.TypeUrl]
+	changedResponse := make([]*discovery.Resource, 0, len(deltaResponse))
+	for _, r := range deltaResponse {
+		if prev, f := sent[r.Name]; f && prev.version == r.Version && !subres.Contains(r.Name) {
+			continue
+		}
+		changedResponse = append(changedResponse, r)
+	}
+	if skipped := len(deltaResponse) - len(changedResponse); skipped > 0 {
+		deltaSkippedResources.With(typeTag.Value(v3.GetMetricType(w.TypeUrl))).Record(float64(skipped))
+	}
+	deltaResponse = changedResponse
+
 	resp := &discovery.DeltaDiscoveryResponse{
 		TypeUrl:           w.TypeUrl,
 		SystemVersionInfo: currentVersion,
 		Nonce:             nonce(push.LedgerVersion),
 		Resources:         deltaResponse,
 	}
-	// We take the set of watched resources and anything not in the response is sent as RemovedResources
-	// This is similar to SotW, but done on the server side instead of the client.
-	cur := sets.NewSet(w.ResourceNames...)
-	cur.Delete(extractNames(originalResponse)...)
-	resp.RemovedResources = cur.SortedList()
+	if usedDelta {
+		resp.RemovedResources = deletedRes
+	} else {
+		// We take the set of watched resources and anything not in the response is sent as RemovedResources
+		// This is similar to SotW, but done on the server side instead of the client.
+		cur := sets.NewSet(w.ResourceNames...)
+		cur.Delete(extractNames(originalResponse)...)
+		resp.RemovedResources = cur.SortedList()
+	}
 	if len(resp.RemovedResources) > 0 {
 		log.Infof("ADS:%v REMOVE %v", v3.GetShortType(w.TypeUrl), resp.RemovedResources)
 	}
 	if isWildcardTypeURL(w.TypeUrl) {
 		// this is probably a bad idea...
 		con.proxy.Lock()
-		w.ResourceNames = extractNames(originalResponse)
+		if usedDelta {
+			names := sets.NewSet(w.ResourceNames...)
+			names.Insert(extractNames(originalResponse)...)
+			names.Delete(resp.RemovedResources...)
+			w.ResourceNames = names.SortedList()
+		} else {
+			w.ResourceNames = extractNames(originalResponse)
+		}
 		con.proxy.Unlock()
 	}
 
+	if len(resp.Resources) == 0 && len(resp.RemovedResources) == 0 && w.NonceSent != "" {
+		// Nothing changed since the last response, there is no need to send anything.
+		log.Debugf("%s: SKIP PUSH for node:%s, resources are unchanged", v3.GetShortType(w.TypeUrl), con.proxy.ID)
+		if s.StatusReporter != nil {
+			s.StatusReporter.RegisterEvent(con.ConID, w.TypeUrl, push.LedgerVersion)
+		}
+		return nil
+	}
+
 	if err := con.sendDelta(resp); err != nil {
 		recordSendError(w.TypeUrl, con.ConID, err)
 		return err
 	}
+	con.recordSentResources(resp)
 
 	// Some types handle logs inside Generate, skip them here
 	// TODO because we filter out after the fact, SkipLogTypes report wrong info
@@ -504,16 +560,62 @@ func (s *DiscoveryServer) pushDeltaXds(con *Connection, push *model.PushContext,
 	if _, f := SkipLogTypes[w.TypeUrl]; !f {
 		if log.DebugEnabled() {
 			// Add additional information to logs when debug mode enabled
-			log.Infof("%s: PUSH for node:%s resources:%d size:%s nonce:%v version:%v",
-				v3.GetShortType(w.TypeUrl), con.proxy.ID, len(res), util.ByteCount(ResourceSize(res)), resp.Nonce, resp.SystemVersionInfo)
+			log.Infof("%s: PUSH for node:%s resources:%d removed:%d size:%s nonce:%v version:%v",
+				v3.GetShortType(w.TypeUrl), con.proxy.ID, len(resp.Resources), len(resp.RemovedResources),
+				util.ByteCount(deltaResourceSize(resp.Resources)), resp.Nonce, resp.SystemVersionInfo)
 		} else {
-			log.Infof("%s: PUSH for node:%s resources:%d size:%s",
-				v3.GetShortType(w.TypeUrl), con.proxy.ID, len(res), util.ByteCount(ResourceSize(res)))
+			log.Infof("%s: PUSH for node:%s resources:%d removed:%d size:%s",
+				v3.GetShortType(w.TypeUrl), con.proxy.ID, len(resp.Resources), len(resp.RemovedResources),
+				util.ByteCount(deltaResourceSize(resp.Resources)))
 		}
 	}
 	return nil
 }
 
+// sentResource is the version and size of a resource sent on a Delta XDS stream.
+type sentResource struct {
+	version string
+	size    int
+}
+
+// recordSentResources tracks the resources of a delta response, and records how many bytes were sent compared
+// to the bytes a SotW response with all the resources of the type would have needed.
+func (conn *Connection) recordSentResources(resp *discovery.DeltaDiscoveryResponse) {
+	sent := conn.sentResources[resp.TypeUrl]
+	if sent == nil {
+		sent = map[string]sentResource{}
+		conn.sentResources[resp.TypeUrl] = sent
+	}
+	for _, r := range resp.Resources {
+		sent[r.Name] = sentResource{version: r.Version, size: len(r.Resource.Value)}
+	}
+	for _, name := range resp.RemovedResources {
+		delete(sent, name)
+	}
+	sotwSize := 0
+	for _, r := range sent {
+		sotwSize += r.size
+	}
+	metricType := typeTag.Value(v3.GetMetricType(resp.TypeUrl))
+	deltaBytesSent.With(metricType).Record(float64(deltaResourceSize(resp.Resources)))
+	deltaSotwBytes.With(metricType).Record(float64(sotwSize))
+}
+
+// forgetSentResources stops tracking the given resources, so that they are sent on the next push.
+func (conn *Connection) forgetSentResources(typeURL string, names ...string) {
+	for _, name := range names {
+		delete(conn.sentResources[typeURL], name)
+	}
+}
+
+func deltaResourceSize(resources []*discovery.Resource) int {
+	size := 0
+	for _, r := range resources {
+		size += len(r.Resource.Value)
+	}
+	return size
+}
+
 func newDeltaConnection(peerAddr string, stream DeltaDiscoveryStream) *Connection {
 	return &Connection{
 		pushChannel:   make(chan *Event),
@@ -523,12 +625,14 @@ func newDeltaConnection(peerAddr string, stream DeltaDiscoveryStream) *Connectio
 		Connect:       time.Now(),
 		deltaStream:   stream,
 		blockedPushes: map[string]*model.PushRequest{},
+		sentResources: map[string]map[string]sentResource{},
 	}
 }
 
 // just for experimentation
 // TODO: make generator return discovery.Resource; then we don't need to introspect the name
-func convertResponseToDelta(ver string, resources model.Resources) []*discovery.Resource {
+// The version of each resource is a hash of its content, so that unchanged resources can be detected.
+func convertResponseToDelta(resources model.Resources) []*discovery.Resource {
 	convert := []*discovery.Resource{}
 	for _, r := range resources {
 		var name string
@@ -560,7 +664,7 @@ func convertResponseToDelta(ver string, resources model.Resources) []*discovery.
 		}
 		c := &discovery.Resource{
 			Name:     name,
-			Version:  ver,
+			Version:  resourceVersion(r),
 			Resource: r,
 		}
 		convert = append(convert, c)
@@ -568,6 +672,13 @@ func convertResponseToDelta(ver string, resources model.Resources) []*discovery.
 	return convert
 }
 
+// resourceVersion returns a hash of the marshaled resource.
+func resourceVersion(r *any.Any) string {
+	h := fnv.New64a()
+	_, _ = h.Write(r.Value)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
 // To satisfy methods that need DiscoveryRequest. Not suitable for real usage
 func deltaToSotwRequest(request *discovery.DeltaDiscoveryRequest) *discovery.DiscoveryRequest {
 	return &discovery.DiscoveryRequest{
@@ -20,8 +20,11 @@ import (
 
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 
+	"istio.io/istio/pilot/pkg/model"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pilot/test/xdstest"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schema/gvk"
 	"istio.io/istio/tests/util/leak"
 )
 
@@ -54,6 +57,67 @@ func TestDeltaAdsClusterUpdate(t *testing.T) {
 	sendEDSReqAndVerify([]string{"outbound|80||local.default.svc.cluster.local"}, nil, []string{"outbound|80||local.default.svc.cluster.local"})
 	// Only send the one that is requested
 	sendEDSReqAndVerify([]string{"outbound|81||local.default.svc.cluster.local"}, nil, []string{"outbound|81||local.default.svc.cluster.local"})
-	// TODO: should we just respond with nothing here? Probably...
-	sendEDSReqAndVerify(nil, []string{"outbound|81||local.default.svc.cluster.local"}, []string{"outbound|80||local.default.svc.cluster.local"})
+	// The remaining cluster was already sent and is unchanged, so there is nothing to respond with
+	ads.Request(&discovery.DeltaDiscoveryRequest{
+		ResourceNamesUnsubscribe: []string{"outbound|81||local.default.svc.cluster.local"},
+		ResponseNonce:            nonce,
+	})
+	ads.ExpectNoResponse()
+	// Once unsubscribed, a cluster is sent again when subscribed back
+	sendEDSReqAndVerify([]string{"outbound|81||local.default.svc.cluster.local"}, nil, []string{"outbound|81||local.default.svc.cluster.local"})
+}
+
+func TestDeltaAdsIncrementalClusters(t *testing.T) {
+	s := NewFakeDiscoveryServer(t, FakeOptions{})
+	ads := s.ConnectDeltaADS().WithType(v3.ClusterType)
+	initial := ads.RequestResponseAck(nil)
+
+	const hostname = "delta.example.com"
+	configsUpdated := map[model.ConfigKey]struct{}{
+		{Kind: gvk.ServiceEntry, Name: hostname, Namespace: "default"}: {},
+	}
+	ack := func(resp *discovery.DeltaDiscoveryResponse) {
+		t.Helper()
+		ads.Request(&discovery.DeltaDiscoveryRequest{ResponseNonce: resp.Nonce})
+	}
+
+	// Adding a service only sends its clusters
+	s.Discovery.MemRegistry.AddService(hostname, &model.Service{
+		Hostname:   hostname,
+		Address:    "10.11.0.1",
+		Ports:      []*model.Port{{Name: "http", Port: 80, Protocol: protocol.HTTP}},
+		Attributes: model.ServiceAttributes{Namespace: "default"},
+	})
+	s.Discovery.ConfigUpdate(&model.PushRequest{Full: true, ConfigsUpdated: configsUpdated})
+	resp := ads.ExpectResponse()
+	if got, want := extractNames(resp.Resources), []string{"outbound|80||" + hostname}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected clusters %v, got %v", want, got)
+	}
+	if len(resp.RemovedResources) != 0 {
+		t.Fatalf("expected no removed clusters, got %v", resp.RemovedResources)
+	}
+	ack(resp)
+
+	// A full push without changes does not send anything
+	s.Discovery.ConfigUpdate(&model.PushRequest{Full: true})
+	ads.ExpectNoResponse()
+
+	// Removing the service only removes its clusters
+	s.Discovery.MemRegistry.RemoveService(hostname)
+	s.Discovery.ConfigUpdate(&model.PushRequest{Full: true, ConfigsUpdated: configsUpdated})
+	resp = ads.ExpectRemoval()
+	if len(resp.Resources) != 0 {
+		t.Fatalf("expected no clusters, got %v", extractNames(resp.Resources))
+	}
+	if got, want := resp.RemovedResources, []string{"outbound|80||" + hostname}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected removed clusters %v, got %v", want, got)
+	}
+	ack(resp)
+
+	// Resource versions are hashes of the resources
+	for _, r := range initial.Resources {
+		if r.Version != resourceVersion(r.Resource) {
+			t.Fatalf("unexpected version %q for cluster %s", r.Version, r.Name)
+		}
+	}
 }
@@ -148,6 +148,23 @@ func (a *DeltaAdsTest) ExpectResponse() *discovery.DeltaDiscoveryResponse {
 	return nil
 }
 
+// ExpectRemoval waits until a response removing resources is received and returns it
+func (a *DeltaAdsTest) ExpectRemoval() *discovery.DeltaDiscoveryResponse {
+	a.t.Helper()
+	select {
+	case <-time.After(a.timeout):
+		a.t.Fatalf("did not get response in time")
+	case resp := <-a.responses:
+		if resp == nil || len(resp.RemovedResources) == 0 {
+			a.t.Fatalf("got response without removed resources: %v", resp)
+		}
+		return resp
+	case err := <-a.error:
+		a.t.Fatalf("got error: %v", err)
+	}
+	return nil
+}
+
 // ExpectError waits until an error is received and returns it
 func (a *DeltaAdsTest) ExpectError() error {
 	a.t.Helper()
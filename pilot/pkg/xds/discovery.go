@@ -36,6 +36,8 @@ import (
 	"istio.io/istio/pilot/pkg/util/sets"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/pki/ca"
+	"istio.io/istio/security/pkg/server/ca/audit"
 )
 
 var (
@@ -143,6 +145,12 @@ type DiscoveryServer struct {
 
 	// JwtKeyResolver holds a reference to the JWT key resolver instance.
 	JwtKeyResolver *model.JwksResolver
+
+	// CAAuditLog holds the recent certificate signing requests handled by the CA, if the CA audit log is enabled.
+	CAAuditLog *audit.Log
+
+	// CARootRotator rotates the plugged-in CA certificates to a new root, if enabled.
+	CARootRotator *ca.PluggedCertRotator
 }
 
 // EndpointShards holds the set of endpoint shards of a service. Registries update
@@ -527,6 +535,7 @@ func (s *DiscoveryServer) initGenerators(env *model.Environment, systemNameSpace
 	s.Generators[v3.NameTableType] = &NdsGenerator{Server: s}
 	s.Generators[v3.ExtensionConfigurationType] = &EcdsGenerator{Server: s}
 	s.Generators[v3.ProxyConfigType] = &PcdsGenerator{Server: s, TrustBundle: env.TrustBundle}
+	s.Generators[v3.CRLType] = &CrlGenerator{}
 
 	s.Generators["grpc"] = &grpcgen.GrpcConfigGenerator{}
 	s.Generators["grpc/"+v3.EndpointType] = edsGen
@@ -325,7 +325,7 @@ type EdsGenerator struct {
 	Server *DiscoveryServer
 }
 
-var _ model.XdsResourceGenerator = &EdsGenerator{}
+var _ model.XdsDeltaResourceGenerator = &EdsGenerator{}
 
 // Map of all configs that do not impact EDS
 var skippedEdsConfigs = map[config.GroupVersionKind]struct{}{
@@ -335,6 +335,7 @@ var skippedEdsConfigs = map[config.GroupVersionKind]struct{}{
 	gvk.AuthorizationPolicy:   {},
 	gvk.RequestAuthentication: {},
 	gvk.Secret:                {},
+	CRLKind:                   {},
 }
 
 func edsNeedsPush(updates model.XdsUpdates) bool {
@@ -358,6 +359,27 @@ func (eds *EdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w
 	if !req.Full {
 		edsUpdatedServices = model.ConfigNamesOfKind(req.ConfigsUpdated, gvk.ServiceEntry)
 	}
+	return eds.buildEndpoints(proxy, push, req, w, edsUpdatedServices), nil
+}
+
+// GenerateDeltas computes the endpoints affected by the push for a Delta XDS connection. Incremental pushes
+// and full pushes triggered by ServiceEntry updates only need the clusters of the updated services.
+// Clusters are never removed, as the proxy unsubscribes from the endpoints of removed clusters.
+func (eds *EdsGenerator) GenerateDeltas(proxy *model.Proxy, push *model.PushContext, req *model.PushRequest,
+	w *model.WatchedResource) (model.Resources, []string, bool, error) {
+	if !edsNeedsPush(req.ConfigsUpdated) {
+		return nil, nil, false, nil
+	}
+	if req.Full && !model.HasConfigsOfKindOnly(req.ConfigsUpdated, gvk.ServiceEntry) {
+		return eds.buildEndpoints(proxy, push, req, w, nil), nil, false, nil
+	}
+	edsUpdatedServices := model.ConfigNamesOfKind(req.ConfigsUpdated, gvk.ServiceEntry)
+	return eds.buildEndpoints(proxy, push, req, w, edsUpdatedServices), nil, true, nil
+}
+
+// buildEndpoints generates the load assignments of the watched clusters, limited to the updated services if set.
+func (eds *EdsGenerator) buildEndpoints(proxy *model.Proxy, push *model.PushContext, req *model.PushRequest,
+	w *model.WatchedResource, edsUpdatedServices map[string]struct{}) model.Resources {
 	resources := make([]*any.Any, 0)
 	empty := 0
 
@@ -399,7 +421,7 @@ func (eds *EdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w
 		log.Debugf("EDS: PUSH INC%s for node:%s clusters:%d size:%s empty:%v cached:%v/%v",
 			req.PushReason(), proxy.ID, len(resources), util.ByteCount(ResourceSize(resources)), empty, cached, cached+regenerated)
 	}
-	return resources, nil
+	return resources
 }
 
 func getOutlierDetectionAndLoadBalancerSettings(
@@ -32,6 +32,7 @@ var skippedLdsConfigs = map[config.GroupVersionKind]struct{}{
 	gvk.DestinationRule: {},
 	gvk.WorkloadGroup:   {},
 	gvk.Secret:          {},
+	CRLKind:             {},
 }
 
 func ldsNeedsPush(req *model.PushRequest) bool {
@@ -86,6 +86,25 @@ var (
 		monitoring.WithLabels(typeTag),
 	)
 
+	deltaBytesSent = monitoring.NewSum(
+		"pilot_xds_delta_bytes_sent",
+		"Total bytes of the resources sent in Delta XDS responses.",
+		monitoring.WithLabels(typeTag),
+	)
+
+	// The bytes of the same responses if all the resources of the type were sent, as with SotW XDS.
+	deltaSotwBytes = monitoring.NewSum(
+		"pilot_xds_delta_sotw_equivalent_bytes",
+		"Total bytes the Delta XDS responses would have needed with SotW XDS.",
+		monitoring.WithLabels(typeTag),
+	)
+
+	deltaSkippedResources = monitoring.NewSum(
+		"pilot_xds_delta_skipped_resources",
+		"Total number of unchanged resources not sent in Delta XDS responses.",
+		monitoring.WithLabels(typeTag),
+	)
+
 	monServices = monitoring.NewGauge(
 		"pilot_services",
 		"Total services known to pilot.",
@@ -262,5 +281,8 @@ func init() {
 		totalDelayedPushes,
 		totalDelayedPushTimeouts,
 		pilotSDSCertificateErrors,
+		deltaBytesSent,
+		deltaSotwBytes,
+		deltaSkippedResources,
 	)
 }
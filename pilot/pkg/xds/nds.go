@@ -43,6 +43,7 @@ var skippedNdsConfigs = map[config.GroupVersionKind]struct{}{
 	gvk.AuthorizationPolicy:   {},
 	gvk.RequestAuthentication: {},
 	gvk.PeerAuthentication:    {},
+	CRLKind:                   {},
 }
 
 func ndsNeedsPush(req *model.PushRequest) bool {
@@ -45,14 +45,17 @@ func TestNDS(t *testing.T) {
 					"random-1.host.example": {
 						Ips:      []string{"240.240.0.1"},
 						Registry: "External",
+						Ports:    []*nds.NameTable_Port{{Name: "http", Port: 80, Protocol: "HTTP"}},
 					},
 					"random-2.host.example": {
 						Ips:      []string{"9.9.9.9"},
 						Registry: "External",
+						Ports:    []*nds.NameTable_Port{{Name: "http", Port: 80, Protocol: "HTTP"}},
 					},
 					"random-3.host.example": {
 						Ips:      []string{"240.240.0.2"},
 						Registry: "External",
+						Ports:    []*nds.NameTable_Port{{Name: "http", Port: 80, Protocol: "HTTP"}},
 					},
 				},
 			},
@@ -67,6 +70,7 @@ func TestNDS(t *testing.T) {
 					"random-2.host.example": {
 						Ips:      []string{"9.9.9.9"},
 						Registry: "External",
+						Ports:    []*nds.NameTable_Port{{Name: "http", Port: 80, Protocol: "HTTP"}},
 					},
 				},
 			},
@@ -16,7 +16,6 @@ package xds
 
 import (
 	"istio.io/istio/pilot/pkg/model"
-	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/gvk"
 )
@@ -35,6 +34,7 @@ var skippedRdsConfigs = map[config.GroupVersionKind]struct{}{
 	gvk.RequestAuthentication: {},
 	gvk.PeerAuthentication:    {},
 	gvk.Secret:                {},
+	CRLKind:                   {},
 }
 
 func rdsNeedsPush(req *model.PushRequest) bool {
@@ -61,10 +61,5 @@ func (c RdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w *m
 	if !rdsNeedsPush(req) {
 		return nil, nil
 	}
-	rawRoutes := c.Server.ConfigGenerator.BuildHTTPRoutes(proxy, push, w.ResourceNames)
-	resources := model.Resources{}
-	for _, c := range rawRoutes {
-		resources = append(resources, util.MessageToAny(c))
-	}
-	return resources, nil
+	return c.Server.ConfigGenerator.BuildHTTPRoutes(proxy, push, w.ResourceNames), nil
 }
@@ -34,6 +34,8 @@ const (
 	NameTableType   = apiTypePrefix + "istio.networking.nds.v1.NameTable"
 	HealthInfoType  = apiTypePrefix + "istio.v1.HealthInformation"
 	ProxyConfigType = apiTypePrefix + "istio.mesh.v1alpha1.ProxyConfig"
+	// CRLType is the certificate revocation list of the Istio CA, sent as a google.protobuf.BytesValue.
+	CRLType = "istio.io/crl"
 
 	// nolint
 	HttpProtocolOptionsType = "envoy.extensions.upstreams.http.v3.HttpProtocolOptions"
@@ -56,6 +58,8 @@ func GetShortType(typeURL string) string {
 		return "NDS"
 	case ProxyConfigType:
 		return "PCDS"
+	case CRLType:
+		return "CRL"
 	default:
 		return typeURL
 	}
@@ -78,6 +82,8 @@ func GetMetricType(typeURL string) string {
 		return "nds"
 	case ProxyConfigType:
 		return "pcds"
+	case CRLType:
+		return "crl"
 	default:
 		return typeURL
 	}
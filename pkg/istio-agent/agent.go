@@ -20,16 +20,20 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
+	"time"
 
 	mesh "istio.io/api/mesh/v1alpha1"
 	"istio.io/istio/pilot/pkg/dns"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/istio-agent/grpcxds"
 	"istio.io/istio/pkg/security"
 	"istio.io/istio/security/pkg/nodeagent/cache"
 	"istio.io/istio/security/pkg/nodeagent/caclient"
 	citadel "istio.io/istio/security/pkg/nodeagent/caclient/providers/citadel"
+	externalca "istio.io/istio/security/pkg/nodeagent/caclient/providers/external"
 	gca "istio.io/istio/security/pkg/nodeagent/caclient/providers/google"
 	"istio.io/istio/security/pkg/nodeagent/sds"
 	"istio.io/pkg/log"
@@ -104,6 +108,9 @@ type AgentOptions struct {
 	// DNSCapture indicates if the XDS proxy has dns capture enabled or not
 	// This option will not be considered if proxyXDSViaAgent is false.
 	DNSCapture bool
+	// DNSUpstreamCacheSize is the number of responses of the upstream DNS servers cached by the local
+	// DNS server, 0 disables the cache.
+	DNSUpstreamCacheSize int
 	// ProxyType is the type of proxy we are configured to handle
 	ProxyType model.NodeType
 	// ProxyNamespace to use for local dns resolution
@@ -131,6 +138,29 @@ type AgentOptions struct {
 
 	// Ability to retrieve ProxyConfig dynamically through XDS
 	EnableDynamicProxyConfig bool
+
+	// Ability to retrieve the certificate revocation list of the Istio CA through XDS
+	EnableCRL bool
+
+	// Registries from which Wasm module images are pulled over plain HTTP
+	WASMInsecureRegistries []string
+
+	// Path to a Docker config JSON holding the credentials used to pull Wasm module images
+	WASMPullSecretPath string
+
+	// XDSCacheDir is the directory the XDS proxy persists the last responses ACKed by Envoy to, to serve them to
+	// Envoy when istiod is unreachable. The cache is disabled if empty.
+	XDSCacheDir string
+
+	// XDSCacheMaxSize is the maximum size in bytes of the XDS cache.
+	XDSCacheMaxSize int
+
+	// XDSCacheMaxStaleness is the maximum age of the cached responses served to Envoy, 0 for no limit.
+	XDSCacheMaxStaleness time.Duration
+
+	// GRPCBootstrapPath is the path the bootstrap for proxyless gRPC applications is written to. If set,
+	// the workload certificates are also written to files, for the gRPC certificate providers.
+	GRPCBootstrapPath string
 }
 
 // NewAgent hosts the functionality for local SDS and XDS. This consists of the local SDS server and
@@ -153,6 +183,16 @@ func NewAgent(proxyConfig *mesh.ProxyConfig, agentOpts *AgentOptions, sopts *sec
 // 2. Indirect, using istiod: using K8S cert.
 func (a *Agent) Start() error {
 	var err error
+	if a.cfg.GRPCBootstrapPath != "" {
+		if !a.cfg.ProxyXDSViaAgent {
+			return fmt.Errorf("gRPC bootstrap requires the XDS proxy to be enabled")
+		}
+		// gRPC reads the certificates from files - by default next to the bootstrap.
+		if a.secOpts.OutputKeyCertToDir == "" {
+			a.secOpts.OutputKeyCertToDir = filepath.Dir(a.cfg.GRPCBootstrapPath)
+		}
+	}
+
 	a.secretCache, err = a.newSecretManager()
 	if err != nil {
 		return fmt.Errorf("failed to start workload secret manager %v", err)
@@ -163,6 +203,9 @@ func (a *Agent) Start() error {
 		return fmt.Errorf("failed to start local sds server %v", err)
 	}
 	a.secretCache.SetUpdateCallback(a.sdsServer.UpdateCallback)
+	if a.cfg.GRPCBootstrapPath != "" {
+		a.initGRPCCertificates()
+	}
 
 	if err = a.initLocalDNSServer(); err != nil {
 		return fmt.Errorf("failed to start local DNS server: %v", err)
@@ -177,10 +220,47 @@ func (a *Agent) Start() error {
 	return nil
 }
 
+// initGRPCCertificates writes the workload certificates to files and keeps them up to date on rotation.
+// Proxyless gRPC doesn't use SDS, so nothing else requests the certificates.
+func (a *Agent) initGRPCCertificates() {
+	a.secretCache.SetUpdateCallback(func(resourceName string) {
+		a.sdsServer.UpdateCallback(resourceName)
+		// Regenerate outside of the callback, which is invoked with the cache lock held.
+		go a.generateGRPCCertificate(resourceName)
+	})
+	go func() {
+		a.generateGRPCCertificate(security.WorkloadKeyCertResourceName)
+		a.generateGRPCCertificate(security.RootCertReqResourceName)
+	}()
+}
+
+func (a *Agent) generateGRPCCertificate(resourceName string) {
+	if resourceName != security.WorkloadKeyCertResourceName && resourceName != security.RootCertReqResourceName {
+		return
+	}
+	// GenerateSecret outputs the certificates to the certificate directory.
+	if _, err := a.secretCache.GenerateSecret(resourceName); err != nil {
+		log.Errorf("failed to generate %s for gRPC: %v", resourceName, err)
+	}
+}
+
+// GenerateGRPCBootstrap writes the bootstrap for proxyless gRPC applications, if enabled.
+func (a *Agent) GenerateGRPCBootstrap(node *model.Node) error {
+	if a.cfg.GRPCBootstrapPath == "" {
+		return nil
+	}
+	_, err := grpcxds.GenerateBootstrapFile(grpcxds.GenerateBootstrapOptions{
+		Node:       node,
+		XdsUdsPath: a.cfg.XdsUdsPath,
+		CertDir:    a.secOpts.OutputKeyCertToDir,
+	}, a.cfg.GRPCBootstrapPath)
+	return err
+}
+
 func (a *Agent) initLocalDNSServer() (err error) {
 	// we dont need dns server on gateways
 	if a.cfg.DNSCapture && a.cfg.ProxyXDSViaAgent && a.cfg.ProxyType == model.SidecarProxy {
-		if a.localDNSServer, err = dns.NewLocalDNSServer(a.cfg.ProxyNamespace, a.cfg.ProxyDomain); err != nil {
+		if a.localDNSServer, err = dns.NewLocalDNSServer(a.cfg.ProxyNamespace, a.cfg.ProxyDomain, a.cfg.DNSUpstreamCacheSize); err != nil {
 			return err
 		}
 		a.localDNSServer.StartDNS()
@@ -299,6 +379,22 @@ func (a *Agent) newSecretManager() (*cache.SecretManagerClient, error) {
 		return cache.NewSecretManagerClient(caClient, a.secOpts)
 	}
 
+	if a.secOpts.CAProviderName == security.ExternalCAProvider {
+		// The external CA has its own root, the Istio root is only used if explicitly set with CA_ROOT_CA.
+		var rootCert []byte
+		if a.cfg.CARootCerts != "" && a.cfg.CARootCerts != security.SystemRootCerts {
+			var err error
+			if rootCert, err = ioutil.ReadFile(a.cfg.CARootCerts); err != nil {
+				return nil, fmt.Errorf("failed to read the root certificate of the external CA: %v", err)
+			}
+		}
+		caClient, err := externalca.NewExternalCAClient(a.secOpts, rootCert)
+		if err != nil {
+			return nil, err
+		}
+		return cache.NewSecretManagerClient(caClient, a.secOpts)
+	}
+
 	// Using citadel CA
 	var rootCert []byte
 	var err error
@@ -0,0 +1,199 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grpcxds generates the bootstrap used by proxyless gRPC applications to connect to Istio.
+package grpcxds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+const (
+	// ServerListenerNamePrefix is the prefix of the listener resources requested by gRPC servers. The
+	// listening address (IP:port) is appended to it.
+	ServerListenerNamePrefix = ServerResourceNameID + "?udpa.resource.listening_address="
+
+	// ServerResourceNameID is used by gRPC servers to build the name of the listener they request.
+	ServerResourceNameID = "grpc/server"
+
+	// FileWatcherCertProviderName is the name of the gRPC certificate provider plugin reading the
+	// certificates from files.
+	FileWatcherCertProviderName = "file_watcher"
+
+	// FileWatcherCertProviderInstance is the name of the certificate provider instance that istiod
+	// references in the security configuration of clusters and listeners.
+	FileWatcherCertProviderInstance = "default"
+
+	// Names of the workload and root certificates within the provider instance. The file watcher
+	// plugin ignores them, but gRPC requires them to be set.
+	WorkloadCertName = "default"
+	RootCertName     = "ROOTCA"
+
+	// The files below are written by the agent to its certificate output directory.
+	certChainFile = "cert-chain.pem"
+	keyFile       = "key.pem"
+	rootCertFile  = "root-cert.pem"
+
+	certRefreshInterval = 15 * time.Minute
+)
+
+// Bootstrap is the gRPC xDS bootstrap, as read from the file pointed to by GRPC_XDS_BOOTSTRAP.
+type Bootstrap struct {
+	XDSServers               []XdsServer                    `json:"xds_servers,omitempty"`
+	Node                     *Node                          `json:"node,omitempty"`
+	CertProviders            map[string]CertificateProvider `json:"certificate_providers,omitempty"`
+	GRPCServerResourceNameID string                         `json:"grpc_server_resource_name_id,omitempty"`
+}
+
+// XdsServer is the management server the gRPC application connects to.
+type XdsServer struct {
+	ServerURI      string         `json:"server_uri,omitempty"`
+	ChannelCreds   []ChannelCreds `json:"channel_creds,omitempty"`
+	ServerFeatures []string       `json:"server_features,omitempty"`
+}
+
+// ChannelCreds are the credentials used to connect to the management server.
+type ChannelCreds struct {
+	Type   string      `json:"type,omitempty"`
+	Config interface{} `json:"config,omitempty"`
+}
+
+// Node is the JSON form of the xDS Node proto.
+type Node struct {
+	ID       string                 `json:"id,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Locality *Locality              `json:"locality,omitempty"`
+}
+
+// Locality is the JSON form of the xDS Locality proto.
+type Locality struct {
+	Region  string `json:"region,omitempty"`
+	Zone    string `json:"zone,omitempty"`
+	SubZone string `json:"sub_zone,omitempty"`
+}
+
+// CertificateProvider is a gRPC certificate provider plugin instance.
+type CertificateProvider struct {
+	PluginName string      `json:"plugin_name,omitempty"`
+	Config     interface{} `json:"config,omitempty"`
+}
+
+// FileWatcherCertProviderConfig is the configuration of the file_watcher certificate provider plugin.
+type FileWatcherCertProviderConfig struct {
+	CertificateFile   string `json:"certificate_file,omitempty"`
+	PrivateKeyFile    string `json:"private_key_file,omitempty"`
+	CACertificateFile string `json:"ca_certificate_file,omitempty"`
+	RefreshInterval   string `json:"refresh_interval,omitempty"`
+}
+
+// GenerateBootstrapOptions contains the inputs of the gRPC bootstrap.
+type GenerateBootstrapOptions struct {
+	// Node is the node metadata of the workload, as sent by the agent.
+	Node *model.Node
+	// XdsUdsPath is the path of the local XDS proxy socket.
+	XdsUdsPath string
+	// CertDir is the directory the agent writes the workload certificates to. If empty, no certificate
+	// providers are configured and the application can't use mTLS.
+	CertDir string
+}
+
+// GenerateBootstrap builds the gRPC bootstrap. gRPC connects to istiod through the XDS proxy in the
+// agent, and reads the workload certificates written by the agent.
+func GenerateBootstrap(opts GenerateBootstrapOptions) (*Bootstrap, error) {
+	if opts.Node == nil {
+		return nil, fmt.Errorf("node is required")
+	}
+	xdsUdsPath, err := filepath.Abs(opts.XdsUdsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the typed metadata, so that the values have the same JSON form as in the Envoy bootstrap.
+	metadata := map[string]interface{}{}
+	if opts.Node.Metadata != nil {
+		b, err := json.Marshal(opts.Node.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &metadata); err != nil {
+			return nil, err
+		}
+	}
+	// Istiod uses the gRPC generator for this node.
+	metadata["GENERATOR"] = "grpc"
+
+	bootstrap := &Bootstrap{
+		XDSServers: []XdsServer{{
+			ServerURI: "unix://" + xdsUdsPath,
+			// The XDS proxy connects to istiod over mTLS, the local socket is plaintext.
+			ChannelCreds:   []ChannelCreds{{Type: "insecure"}},
+			ServerFeatures: []string{"xds_v3"},
+		}},
+		Node: &Node{
+			ID:       opts.Node.ID,
+			Metadata: metadata,
+		},
+		GRPCServerResourceNameID: ServerResourceNameID,
+	}
+	if l := opts.Node.Locality; l != nil {
+		bootstrap.Node.Locality = &Locality{Region: l.Region, Zone: l.Zone, SubZone: l.SubZone}
+	}
+
+	if opts.CertDir != "" {
+		certDir, err := filepath.Abs(opts.CertDir)
+		if err != nil {
+			return nil, err
+		}
+		bootstrap.CertProviders = map[string]CertificateProvider{
+			FileWatcherCertProviderInstance: {
+				PluginName: FileWatcherCertProviderName,
+				Config: FileWatcherCertProviderConfig{
+					CertificateFile:   path.Join(certDir, certChainFile),
+					PrivateKeyFile:    path.Join(certDir, keyFile),
+					CACertificateFile: path.Join(certDir, rootCertFile),
+					RefreshInterval:   fmt.Sprintf("%.0fs", certRefreshInterval.Seconds()),
+				},
+			},
+		}
+	}
+
+	return bootstrap, nil
+}
+
+// GenerateBootstrapFile generates the gRPC bootstrap and writes it to the given path.
+func GenerateBootstrapFile(opts GenerateBootstrapOptions, bootstrapPath string) (*Bootstrap, error) {
+	bootstrap, err := GenerateBootstrap(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed generating gRPC XDS bootstrap: %v", err)
+	}
+	out, err := json.MarshalIndent(bootstrap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(bootstrapPath), 0o700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(bootstrapPath, out, 0o644); err != nil {
+		return nil, fmt.Errorf("failed writing gRPC XDS bootstrap to %s: %v", bootstrapPath, err)
+	}
+	return bootstrap, nil
+}
@@ -0,0 +1,125 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcxds
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"google.golang.org/grpc/credentials/tls/certprovider"
+	// To register the file_watcher certificate provider.
+	_ "google.golang.org/grpc/credentials/tls/certprovider/pemfile"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestGenerateBootstrapFile(t *testing.T) {
+	dir := t.TempDir()
+	bootstrapPath := filepath.Join(dir, "grpc-bootstrap.json")
+	node := &model.Node{
+		ID: "sidecar~1.1.1.1~echo.default~default.svc.cluster.local",
+		Metadata: &model.BootstrapNodeMetadata{
+			NodeMetadata: model.NodeMetadata{Namespace: "default"},
+		},
+		Locality: &core.Locality{Region: "region", Zone: "zone"},
+	}
+	if _, err := GenerateBootstrapFile(GenerateBootstrapOptions{
+		Node:       node,
+		XdsUdsPath: "/etc/istio/proxy/XDS",
+		CertDir:    dir,
+	}, bootstrapPath); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(bootstrapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Decode the raw JSON, to check the field names read by gRPC.
+	bootstrap := struct {
+		XDSServers []struct {
+			ServerURI string `json:"server_uri"`
+		} `json:"xds_servers"`
+		Node struct {
+			ID       string            `json:"id"`
+			Metadata map[string]string `json:"metadata"`
+			Locality map[string]string `json:"locality"`
+		} `json:"node"`
+		CertProviders map[string]struct {
+			PluginName string          `json:"plugin_name"`
+			Config     json.RawMessage `json:"config"`
+		} `json:"certificate_providers"`
+		ServerResourceNameID string `json:"grpc_server_resource_name_id"`
+	}{}
+	if err := json.Unmarshal(b, &bootstrap); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bootstrap.XDSServers) != 1 || bootstrap.XDSServers[0].ServerURI != "unix:///etc/istio/proxy/XDS" {
+		t.Errorf("unexpected xds servers %+v", bootstrap.XDSServers)
+	}
+	if bootstrap.Node.ID != node.ID {
+		t.Errorf("unexpected node id %v", bootstrap.Node.ID)
+	}
+	if bootstrap.Node.Metadata["GENERATOR"] != "grpc" || bootstrap.Node.Metadata["NAMESPACE"] != "default" {
+		t.Errorf("unexpected node metadata %v", bootstrap.Node.Metadata)
+	}
+	if bootstrap.Node.Locality["region"] != "region" || bootstrap.Node.Locality["zone"] != "zone" {
+		t.Errorf("unexpected node locality %v", bootstrap.Node.Locality)
+	}
+	if bootstrap.ServerResourceNameID != ServerResourceNameID {
+		t.Errorf("unexpected server resource name id %v", bootstrap.ServerResourceNameID)
+	}
+
+	provider, f := bootstrap.CertProviders[FileWatcherCertProviderInstance]
+	if !f || provider.PluginName != FileWatcherCertProviderName {
+		t.Fatalf("expected file watcher certificate provider, got %+v", bootstrap.CertProviders)
+	}
+	// The config must be accepted by the gRPC plugin.
+	if _, err := certprovider.ParseConfig(provider.PluginName, provider.Config); err != nil {
+		t.Fatalf("invalid certificate provider config %s: %v", provider.Config, err)
+	}
+	cfg := FileWatcherCertProviderConfig{}
+	if err := json.Unmarshal(provider.Config, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CertificateFile != filepath.Join(dir, "cert-chain.pem") || cfg.PrivateKeyFile != filepath.Join(dir, "key.pem") ||
+		cfg.CACertificateFile != filepath.Join(dir, "root-cert.pem") {
+		t.Errorf("unexpected certificate files %+v", cfg)
+	}
+}
+
+func TestGenerateBootstrapWithoutCertificates(t *testing.T) {
+	bootstrap, err := GenerateBootstrap(GenerateBootstrapOptions{
+		Node:       &model.Node{ID: "sidecar~1.1.1.1~echo.default~default.svc.cluster.local"},
+		XdsUdsPath: "/etc/istio/proxy/XDS",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bootstrap.CertProviders) != 0 {
+		t.Errorf("expected no certificate providers, got %v", bootstrap.CertProviders)
+	}
+	if bootstrap.Node.Metadata["GENERATOR"] != "grpc" {
+		t.Errorf("unexpected node metadata %v", bootstrap.Node.Metadata)
+	}
+
+	if _, err := GenerateBootstrap(GenerateBootstrapOptions{}); err == nil {
+		t.Errorf("expected error without node")
+	}
+}
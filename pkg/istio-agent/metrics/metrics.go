@@ -55,6 +55,43 @@ var (
 		"The total number of Xds Proxy Responses",
 	)
 
+	xdsCacheMissReasonTag = monitoring.MustCreateLabel("reason")
+
+	// XdsCacheWrites records total number of XDS responses persisted to the local cache.
+	XdsCacheWrites = monitoring.NewSum(
+		"xds_proxy_cache_writes",
+		"The total number of XDS responses persisted to the local cache",
+	)
+
+	// XdsCacheWriteFailures records total number of XDS responses that could not be persisted to the local cache.
+	XdsCacheWriteFailures = monitoring.NewSum(
+		"xds_proxy_cache_write_failures",
+		"The total number of XDS responses that could not be persisted to the local cache",
+	)
+
+	// XdsCacheHits records total number of cached XDS responses served to Envoy while Istiod is unreachable.
+	XdsCacheHits = monitoring.NewSum(
+		"xds_proxy_cache_hits",
+		"The total number of cached XDS responses served to Envoy while Istiod is unreachable",
+	)
+
+	// xdsCacheMisses records total number of XDS requests of Envoy that could not be served from the local cache.
+	xdsCacheMisses = monitoring.NewSum(
+		"xds_proxy_cache_misses",
+		"The total number of XDS requests that could not be served from the local cache while Istiod is unreachable",
+		monitoring.WithLabels(xdsCacheMissReasonTag),
+	)
+
+	// XdsCacheSize records the size of the local XDS cache.
+	XdsCacheSize = monitoring.NewGauge(
+		"xds_proxy_cache_size_bytes",
+		"The size of the XDS responses persisted to the local cache",
+	)
+
+	XdsCacheMissing   = xdsCacheMisses.With(xdsCacheMissReasonTag.Value("missing"))
+	XdsCacheStale     = xdsCacheMisses.With(xdsCacheMissReasonTag.Value("stale"))
+	XdsCacheCorrupted = xdsCacheMisses.With(xdsCacheMissReasonTag.Value("corrupted"))
+
 	IstiodConnectionCancellations = istiodDisconnections.With(disconnectionTypeTag.Value(Cancel))
 	IstiodConnectionErrors        = istiodDisconnections.With(disconnectionTypeTag.Value(Error))
 	EnvoyConnectionCancellations  = envoyDisconnections.With(disconnectionTypeTag.Value(Cancel))
@@ -72,5 +109,10 @@ func init() {
 		IstiodConnectionErrors,
 		istiodDisconnections,
 		envoyDisconnections,
+		XdsCacheWrites,
+		XdsCacheWriteFailures,
+		XdsCacheHits,
+		xdsCacheMisses,
+		XdsCacheSize,
 	)
 }
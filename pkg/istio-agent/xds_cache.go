@@ -0,0 +1,331 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istioagent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/protobuf/proto"
+
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pkg/istio-agent/metrics"
+)
+
+const xdsCacheFileSuffix = ".json"
+
+// xdsCache persists the last XDS response ACKed by Envoy for each type, so that it can be served to Envoy
+// when istiod cannot be reached, for example when Envoy restarts during an istiod outage. The responses of
+// the types requested by resource name, EDS and RDS, only hold some of the resources, like the incremental
+// EDS pushes of istiod: they are merged by resource name with the cached resources.
+type xdsCache struct {
+	dir          string
+	maxSize      int
+	maxStaleness time.Duration
+
+	mu sync.Mutex
+	// pending is the last response sent to Envoy for each type, until Envoy ACKs or NACKs it.
+	pending map[string]*discovery.DiscoveryResponse
+	// sizes is the size of each cache file, by file name.
+	sizes map[string]int
+}
+
+// xdsCacheEntry is the content of a cache file. The checksum is the SHA-256 of the marshaled response.
+type xdsCacheEntry struct {
+	TypeURL  string    `json:"typeUrl"`
+	Saved    time.Time `json:"saved"`
+	Checksum string    `json:"checksum"`
+	Response []byte    `json:"response"`
+}
+
+// newXdsCache creates a cache storing at most maxSize bytes in dir. Responses saved more than maxStaleness
+// ago are not served.
+func newXdsCache(dir string, maxSize int, maxStaleness time.Duration) (*xdsCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create the XDS cache directory %s: %v", dir, err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the XDS cache directory %s: %v", dir, err)
+	}
+	c := &xdsCache{
+		dir:          dir,
+		maxSize:      maxSize,
+		maxStaleness: maxStaleness,
+		pending:      map[string]*discovery.DiscoveryResponse{},
+		sizes:        map[string]int{},
+	}
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), xdsCacheFileSuffix) {
+			c.sizes[f.Name()] = int(f.Size())
+		}
+	}
+	c.recordSize()
+	return c, nil
+}
+
+func cacheFileName(typeURL string) string {
+	// Type URLs are like type.googleapis.com/envoy.config.cluster.v3.Cluster
+	return path.Base(typeURL) + xdsCacheFileSuffix
+}
+
+// sent records a response forwarded to Envoy, to be persisted once ACKed.
+func (c *xdsCache) sent(resp *discovery.DiscoveryResponse) {
+	if !v3.IsEnvoyType(resp.TypeUrl) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[resp.TypeUrl] = resp
+}
+
+// acked persists the pending response of the request type if the request ACKs it.
+func (c *xdsCache) acked(req *discovery.DiscoveryRequest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resp := c.pending[req.TypeUrl]
+	if resp == nil || req.ResponseNonce != resp.Nonce {
+		return
+	}
+	delete(c.pending, req.TypeUrl)
+	if req.ErrorDetail != nil {
+		return
+	}
+	if isNamedType(resp.TypeUrl) {
+		merged, err := c.merge(resp, req.ResourceNames)
+		if err != nil {
+			proxyLog.Warnf("failed to merge the %s response with the XDS cache: %v", v3.GetShortType(resp.TypeUrl), err)
+			metrics.XdsCacheWriteFailures.Increment()
+			return
+		}
+		resp = merged
+	}
+	if err := c.save(resp); err != nil {
+		proxyLog.Warnf("failed to persist the %s response in the XDS cache: %v", v3.GetShortType(resp.TypeUrl), err)
+		metrics.XdsCacheWriteFailures.Increment()
+		return
+	}
+	metrics.XdsCacheWrites.Increment()
+}
+
+// merge returns the response with the cached resources it doesn't update, limited to the resources Envoy
+// requests if any. The lock must be held.
+func (c *xdsCache) merge(resp *discovery.DiscoveryResponse, names []string) (*discovery.DiscoveryResponse, error) {
+	resources := map[string]*any.Any{}
+	if data, err := ioutil.ReadFile(filepath.Join(c.dir, cacheFileName(resp.TypeUrl))); err == nil {
+		// A corrupted cache file is replaced by the response.
+		if cached, _, err := decodeXdsCacheEntry(resp.TypeUrl, data); err == nil {
+			for _, r := range cached.Resources {
+				if name, err := resourceName(r); err == nil {
+					resources[name] = r
+				}
+			}
+		}
+	}
+	for _, r := range resp.Resources {
+		name, err := resourceName(r)
+		if err != nil {
+			return nil, err
+		}
+		resources[name] = r
+	}
+	merged := proto.Clone(resp).(*discovery.DiscoveryResponse)
+	merged.Resources = filterResources(resources, names)
+	return merged, nil
+}
+
+func (c *xdsCache) save(resp *discovery.DiscoveryResponse) error {
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	checksum := sha256.Sum256(data)
+	entry, err := json.Marshal(xdsCacheEntry{
+		TypeURL:  resp.TypeUrl,
+		Saved:    time.Now(),
+		Checksum: hex.EncodeToString(checksum[:]),
+		Response: data,
+	})
+	if err != nil {
+		return err
+	}
+	name := cacheFileName(resp.TypeUrl)
+	total := len(entry)
+	for f, size := range c.sizes {
+		if f != name {
+			total += size
+		}
+	}
+	if total > c.maxSize {
+		return fmt.Errorf("the cache would use %d bytes, more than the limit of %d bytes", total, c.maxSize)
+	}
+
+	// Write to a temporary file first, so that a crash never leaves a partially written file.
+	tmp, err := ioutil.TempFile(c.dir, name+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(entry); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, name)); err != nil {
+		return err
+	}
+	c.sizes[name] = len(entry)
+	c.recordSize()
+	return nil
+}
+
+// load returns the cached response of the type, or nil if there is none or it cannot be used. The responses of
+// the types requested by resource name only hold the requested resources, if any.
+func (c *xdsCache) load(typeURL string, names []string) *discovery.DiscoveryResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name := cacheFileName(typeURL)
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, name))
+	if os.IsNotExist(err) {
+		metrics.XdsCacheMissing.Increment()
+		return nil
+	}
+	if err != nil {
+		proxyLog.Warnf("failed to read the %s response from the XDS cache: %v", v3.GetShortType(typeURL), err)
+		metrics.XdsCacheCorrupted.Increment()
+		return nil
+	}
+	resp, saved, err := decodeXdsCacheEntry(typeURL, data)
+	if err != nil {
+		proxyLog.Warnf("discarding the %s response of the XDS cache: %v", v3.GetShortType(typeURL), err)
+		metrics.XdsCacheCorrupted.Increment()
+		c.remove(name)
+		return nil
+	}
+	if age := time.Since(saved); c.maxStaleness > 0 && age > c.maxStaleness {
+		proxyLog.Warnf("not serving the %s response of the XDS cache, saved %v ago", v3.GetShortType(typeURL), age)
+		metrics.XdsCacheStale.Increment()
+		return nil
+	}
+	if isNamedType(typeURL) && len(names) > 0 {
+		resources := map[string]*any.Any{}
+		for _, r := range resp.Resources {
+			if name, err := resourceName(r); err == nil {
+				resources[name] = r
+			}
+		}
+		if resp.Resources = filterResources(resources, names); len(resp.Resources) == 0 {
+			metrics.XdsCacheMissing.Increment()
+			return nil
+		}
+	}
+	metrics.XdsCacheHits.Increment()
+	return resp
+}
+
+// isNamedType returns true for the types whose resources are requested by name, rather than all at once.
+func isNamedType(typeURL string) bool {
+	return typeURL == v3.EndpointType || typeURL == v3.RouteType
+}
+
+// resourceName returns the name of an EDS or RDS resource.
+func resourceName(r *any.Any) (string, error) {
+	switch r.TypeUrl {
+	case v3.EndpointType:
+		cla := &endpoint.ClusterLoadAssignment{}
+		if err := proto.Unmarshal(r.Value, cla); err != nil {
+			return "", err
+		}
+		return cla.ClusterName, nil
+	case v3.RouteType:
+		rc := &route.RouteConfiguration{}
+		if err := proto.Unmarshal(r.Value, rc); err != nil {
+			return "", err
+		}
+		return rc.Name, nil
+	}
+	return "", fmt.Errorf("unexpected resource type %s", r.TypeUrl)
+}
+
+// filterResources returns the resources with the given names, or all of them if no name is given, sorted by name.
+func filterResources(resources map[string]*any.Any, names []string) []*any.Any {
+	keep := map[string]struct{}{}
+	for _, name := range names {
+		keep[name] = struct{}{}
+	}
+	sorted := make([]string, 0, len(resources))
+	for name := range resources {
+		if _, f := keep[name]; f || len(keep) == 0 {
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+	out := make([]*any.Any, 0, len(sorted))
+	for _, name := range sorted {
+		out = append(out, resources[name])
+	}
+	return out
+}
+
+func decodeXdsCacheEntry(typeURL string, data []byte) (*discovery.DiscoveryResponse, time.Time, error) {
+	entry := xdsCacheEntry{}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, time.Time{}, err
+	}
+	checksum := sha256.Sum256(entry.Response)
+	if hex.EncodeToString(checksum[:]) != entry.Checksum {
+		return nil, time.Time{}, fmt.Errorf("checksum mismatch")
+	}
+	resp := &discovery.DiscoveryResponse{}
+	if err := proto.Unmarshal(entry.Response, resp); err != nil {
+		return nil, time.Time{}, err
+	}
+	if entry.TypeURL != typeURL || resp.TypeUrl != typeURL {
+		return nil, time.Time{}, fmt.Errorf("unexpected type %s", resp.TypeUrl)
+	}
+	return resp, entry.Saved, nil
+}
+
+func (c *xdsCache) remove(name string) {
+	if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !os.IsNotExist(err) {
+		proxyLog.Warnf("failed to remove %s from the XDS cache: %v", name, err)
+	}
+	delete(c.sizes, name)
+	c.recordSize()
+}
+
+func (c *xdsCache) recordSize() {
+	total := 0
+	for _, size := range c.sizes {
+		total += size
+	}
+	metrics.XdsCacheSize.Record(float64(total))
+}
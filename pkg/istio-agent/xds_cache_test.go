@@ -0,0 +1,188 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istioagent
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/ptypes/any"
+	google_rpc "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"istio.io/istio/pilot/pkg/networking/util"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+)
+
+func clusterResponse(nonce string) *discovery.DiscoveryResponse {
+	return &discovery.DiscoveryResponse{
+		TypeUrl:     v3.ClusterType,
+		VersionInfo: "v1",
+		Nonce:       nonce,
+		Resources:   []*any.Any{util.MessageToAny(&cluster.Cluster{Name: "outbound|80||foo.com"})},
+	}
+}
+
+func newTestXdsCache(t *testing.T, maxSize int, maxStaleness time.Duration) (*xdsCache, string) {
+	t.Helper()
+	dir := t.TempDir()
+	c, err := newXdsCache(dir, maxSize, maxStaleness)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, dir
+}
+
+func TestXdsCache(t *testing.T) {
+	c, dir := newTestXdsCache(t, 1024*1024, time.Hour)
+	if resp := c.load(v3.ClusterType, nil); resp != nil {
+		t.Fatalf("expected an empty cache, got %v", resp)
+	}
+
+	// A NACKed response is not persisted
+	c.sent(clusterResponse("nonce1"))
+	c.acked(&discovery.DiscoveryRequest{TypeUrl: v3.ClusterType, ResponseNonce: "nonce1", ErrorDetail: &google_rpc.Status{Message: "rejected"}})
+	if resp := c.load(v3.ClusterType, nil); resp != nil {
+		t.Fatalf("expected the NACKed response not to be cached, got %v", resp)
+	}
+
+	// A request for an older response is not an ACK of the last one
+	want := clusterResponse("nonce3")
+	c.sent(want)
+	c.acked(&discovery.DiscoveryRequest{TypeUrl: v3.ClusterType, ResponseNonce: "nonce2"})
+	if resp := c.load(v3.ClusterType, nil); resp != nil {
+		t.Fatalf("expected the response not to be cached before it is ACKed, got %v", resp)
+	}
+	c.acked(&discovery.DiscoveryRequest{TypeUrl: v3.ClusterType, ResponseNonce: "nonce3"})
+	if got := c.load(v3.ClusterType, nil); !proto.Equal(got, want) {
+		t.Fatalf("got cached response %v, want %v", got, want)
+	}
+
+	// The cache survives restarts
+	c, err := newXdsCache(dir, 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.load(v3.ClusterType, nil); !proto.Equal(got, want) {
+		t.Fatalf("got cached response %v after restart, want %v", got, want)
+	}
+}
+
+func endpointsResponse(nonce, version string, clusters ...string) *discovery.DiscoveryResponse {
+	resp := &discovery.DiscoveryResponse{TypeUrl: v3.EndpointType, VersionInfo: version, Nonce: nonce}
+	for _, c := range clusters {
+		resp.Resources = append(resp.Resources, util.MessageToAny(&endpoint.ClusterLoadAssignment{
+			ClusterName: c,
+			Endpoints:   []*endpoint.LocalityLbEndpoints{{Priority: uint32(len(version))}},
+		}))
+	}
+	return resp
+}
+
+func TestXdsCacheIncrementalEDS(t *testing.T) {
+	c, dir := newTestXdsCache(t, 1024*1024, time.Hour)
+	clusters := []string{"outbound|80||a.com", "outbound|80||b.com", "outbound|80||c.com"}
+
+	// A full push of all the clusters, followed by an incremental push of a single cluster.
+	c.sent(endpointsResponse("nonce1", "v1", clusters...))
+	c.acked(&discovery.DiscoveryRequest{TypeUrl: v3.EndpointType, ResponseNonce: "nonce1", ResourceNames: clusters})
+	c.sent(endpointsResponse("nonce2", "v22", clusters[0]))
+	c.acked(&discovery.DiscoveryRequest{TypeUrl: v3.EndpointType, ResponseNonce: "nonce2", ResourceNames: clusters})
+
+	// Envoy restarts during an istiod outage, and is served all the clusters from the cache.
+	c, err := newXdsCache(dir, 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := endpointsResponse("nonce2", "v22", clusters[0])
+	want.Resources = append(want.Resources, endpointsResponse("", "v1", clusters[1:]...).Resources...)
+	if got := c.load(v3.EndpointType, clusters); !proto.Equal(got, want) {
+		t.Fatalf("got cached response %v, want %v", got, want)
+	}
+
+	// Only the requested clusters are served.
+	want.Resources = want.Resources[1:2]
+	if got := c.load(v3.EndpointType, clusters[1:2]); !proto.Equal(got, want) {
+		t.Fatalf("got cached response %v, want %v", got, want)
+	}
+	if got := c.load(v3.EndpointType, []string{"outbound|80||unknown.com"}); got != nil {
+		t.Fatalf("expected no response for unknown clusters, got %v", got)
+	}
+
+	// Clusters Envoy doesn't request anymore are dropped.
+	c.sent(endpointsResponse("nonce3", "v333", clusters[1]))
+	c.acked(&discovery.DiscoveryRequest{TypeUrl: v3.EndpointType, ResponseNonce: "nonce3", ResourceNames: clusters[1:]})
+	if got := c.load(v3.EndpointType, clusters); len(got.Resources) != 2 {
+		t.Fatalf("expected the clusters not requested anymore to be dropped, got %v", got)
+	}
+}
+
+func TestXdsCacheCorrupted(t *testing.T) {
+	c, dir := newTestXdsCache(t, 1024*1024, time.Hour)
+	c.sent(clusterResponse("nonce"))
+	c.acked(&discovery.DiscoveryRequest{TypeUrl: v3.ClusterType, ResponseNonce: "nonce"})
+
+	file := filepath.Join(dir, cacheFileName(v3.ClusterType))
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tamper with the cached response
+	entry := xdsCacheEntry{}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatal(err)
+	}
+	entry.Response[len(entry.Response)-1] ^= 1
+	corrupted, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, corrupted, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if resp := c.load(v3.ClusterType, nil); resp != nil {
+		t.Fatalf("expected the corrupted response to be discarded, got %v", resp)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("expected the corrupted file to be removed, got %v", err)
+	}
+}
+
+func TestXdsCacheLimits(t *testing.T) {
+	t.Run("size", func(t *testing.T) {
+		c, _ := newTestXdsCache(t, 10, time.Hour)
+		c.sent(clusterResponse("nonce"))
+		c.acked(&discovery.DiscoveryRequest{TypeUrl: v3.ClusterType, ResponseNonce: "nonce"})
+		if resp := c.load(v3.ClusterType, nil); resp != nil {
+			t.Fatalf("expected the response over the size limit not to be cached, got %v", resp)
+		}
+	})
+	t.Run("staleness", func(t *testing.T) {
+		c, _ := newTestXdsCache(t, 1024*1024, time.Nanosecond)
+		c.sent(clusterResponse("nonce"))
+		c.acked(&discovery.DiscoveryRequest{TypeUrl: v3.ClusterType, ResponseNonce: "nonce"})
+		time.Sleep(time.Millisecond)
+		if resp := c.load(v3.ClusterType, nil); resp != nil {
+			t.Fatalf("expected the stale response not to be served, got %v", resp)
+		}
+	})
+}
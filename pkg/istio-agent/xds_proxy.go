@@ -33,6 +33,7 @@ import (
 	gogotypes "github.com/gogo/protobuf/types"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/any"
+	"github.com/golang/protobuf/ptypes/wrappers"
 	"go.uber.org/atomic"
 	google_rpc "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
@@ -107,6 +108,9 @@ type XdsProxy struct {
 	// in case istiod changes its behavior, or a different ECDS server is used.
 	ecdsLastAckVersion atomic.String
 	ecdsLastNonce      atomic.String
+
+	// xdsCache holds the last responses ACKed by Envoy, served to Envoy when istiod is unreachable. Nil if disabled.
+	xdsCache *xdsCache
 }
 
 var proxyLog = log.RegisterScope("xdsproxy", "XDS Proxy in Istio Agent", 0)
@@ -116,6 +120,10 @@ const (
 	localHostIPv6 = "[::1]"
 )
 
+// xdsCacheServeInterval is how long Envoy is served from the XDS cache before the stream is closed, so that
+// Envoy reconnects and the connection to istiod is retried.
+var xdsCacheServeInterval = 30 * time.Second
+
 func initXdsProxy(ia *Agent) (*XdsProxy, error) {
 	var err error
 	localHostAddr := localHostIPv4
@@ -134,7 +142,11 @@ func initXdsProxy(ia *Agent) (*XdsProxy, error) {
 		healthChecker: health.NewWorkloadHealthChecker(ia.proxyConfig.ReadinessProbe, envoyProbe),
 		xdsHeaders:    ia.cfg.XDSHeaders,
 		xdsUdsPath:    ia.cfg.XdsUdsPath,
-		wasmCache:     wasm.NewLocalFileCache(constants.IstioDataDir, wasm.DefaultWasmModulePurgeInteval, wasm.DefaultWasmModuleExpiry),
+		wasmCache: wasm.NewLocalFileCache(constants.IstioDataDir, wasm.DefaultWasmModulePurgeInteval, wasm.DefaultWasmModuleExpiry,
+			wasm.ImagePullOptions{
+				InsecureRegistries: ia.cfg.WASMInsecureRegistries,
+				PullSecretPath:     ia.cfg.WASMPullSecretPath,
+			}),
 	}
 
 	if ia.localDNSServer != nil {
@@ -165,6 +177,25 @@ func initXdsProxy(ia *Agent) (*XdsProxy, error) {
 			return ia.secretCache.UpdateConfigTrustBundle(trustBundle)
 		}
 	}
+	if ia.cfg.EnableCRL && ia.secretCache != nil {
+		proxy.handlers[v3.CRLType] = func(resp *any.Any) error {
+			var crl wrappers.BytesValue
+			// nolint: staticcheck
+			if err := ptypes.UnmarshalAny(resp, &crl); err != nil {
+				log.Errorf("failed to unmarshall CRL: %v", err)
+				return err
+			}
+			log.Debugf("received new CRL of %d bytes", len(crl.Value))
+			return ia.secretCache.UpdateCRL(crl.Value)
+		}
+	}
+
+	if ia.cfg.XDSCacheDir != "" {
+		if proxy.xdsCache, err = newXdsCache(ia.cfg.XDSCacheDir, ia.cfg.XDSCacheMaxSize, ia.cfg.XDSCacheMaxStaleness); err != nil {
+			return nil, err
+		}
+		proxyLog.Infof("Persisting XDS responses to %s", ia.cfg.XDSCacheDir)
+	}
 
 	proxyLog.Infof("Initializing with upstream address %q and cluster %q", proxy.istiodAddress, proxy.clusterID)
 
@@ -301,6 +332,9 @@ func (p *XdsProxy) StreamAggregatedResources(downstream discovery.AggregatedDisc
 			}
 			// forward to istiod
 			con.requestsChan <- req
+			if p.xdsCache != nil {
+				p.xdsCache.acked(req)
+			}
 			if !initialRequestsSent && req.TypeUrl == v3.ListenerType {
 				// fire off an initial NDS request
 				if _, f := p.handlers[v3.NameTableType]; f {
@@ -314,6 +348,12 @@ func (p *XdsProxy) StreamAggregatedResources(downstream discovery.AggregatedDisc
 						TypeUrl: v3.ProxyConfigType,
 					}
 				}
+				// fire off an initial CRL request
+				if _, f := p.handlers[v3.CRLType]; f {
+					con.requestsChan <- &discovery.DiscoveryRequest{
+						TypeUrl: v3.CRLType,
+					}
+				}
 				// Fire of a configured initial request, if there is one
 				if initialRequest != nil {
 					con.requestsChan <- initialRequest
@@ -329,7 +369,7 @@ func (p *XdsProxy) StreamAggregatedResources(downstream discovery.AggregatedDisc
 	if err != nil {
 		proxyLog.Errorf("failed to connect to upstream %s: %v", p.istiodAddress, err)
 		metrics.IstiodConnectionFailures.Increment()
-		return err
+		return p.serveFromCache(con, err)
 	}
 	defer upstreamConn.Close()
 
@@ -348,7 +388,7 @@ func (p *XdsProxy) HandleUpstream(ctx context.Context, con *ProxyConnection, xds
 	if err != nil {
 		// Envoy logs errors again, so no need to log beyond debug level
 		proxyLog.Debugf("failed to create upstream grpc client: %v", err)
-		return err
+		return p.serveFromCache(con, err)
 	}
 	proxyLog.Infof("connected to upstream XDS server: %s", p.istiodAddress)
 	defer proxyLog.Debugf("disconnected from XDS server: %s", p.istiodAddress)
@@ -401,6 +441,46 @@ func (p *XdsProxy) HandleUpstream(ctx context.Context, con *ProxyConnection, xds
 	}
 }
 
+// serveFromCache answers the requests of Envoy with the cached responses while istiod is unreachable. The stream
+// is closed with the upstream error after xdsCacheServeInterval, so that Envoy reconnects and istiod is retried.
+// Envoy keeps its configuration when the stream is closed.
+func (p *XdsProxy) serveFromCache(con *ProxyConnection, upstreamErr error) error {
+	if p.xdsCache == nil {
+		return upstreamErr
+	}
+	proxyLog.Warnf("istiod is unreachable, serving Envoy from the XDS cache: %v", upstreamErr)
+	timer := time.NewTimer(xdsCacheServeInterval)
+	defer timer.Stop()
+	// served holds the resource names of the last request served for each type.
+	served := map[string]string{}
+	for {
+		select {
+		case req := <-con.requestsChan:
+			// ACKs, and requests for types not handled by Envoy or already served with the same resource names,
+			// are ignored.
+			names := strings.Join(req.ResourceNames, ",")
+			if last, f := served[req.TypeUrl]; (f && last == names) || !v3.IsEnvoyType(req.TypeUrl) {
+				continue
+			}
+			served[req.TypeUrl] = names
+			resp := p.xdsCache.load(req.TypeUrl, req.ResourceNames)
+			if resp == nil || resp.VersionInfo == req.VersionInfo && len(req.ResourceNames) == 0 {
+				continue
+			}
+			proxyLog.Infof("serving cached %s response version %s", v3.GetShortType(req.TypeUrl), resp.VersionInfo)
+			if err := sendDownstreamWithTimeout(con.downstream, resp); err != nil {
+				return err
+			}
+		case err := <-con.downstreamError:
+			return err
+		case <-timer.C:
+			return upstreamErr
+		case <-con.stopChan:
+			return nil
+		}
+	}
+}
+
 func (p *XdsProxy) handleUpstreamRequest(ctx context.Context, con *ProxyConnection) {
 	defer con.upstream.CloseSend() // nolint
 	for {
@@ -462,10 +542,10 @@ func (p *XdsProxy) handleUpstreamResponse(con *ProxyConnection) {
 					go p.rewriteAndForward(con, resp)
 				} else {
 					// Otherwise, forward ECDS resource update directly to Envoy.
-					forwardToEnvoy(con, resp)
+					p.forwardToEnvoy(con, resp)
 				}
 			default:
-				forwardToEnvoy(con, resp)
+				p.forwardToEnvoy(con, resp)
 			}
 		case <-con.stopChan:
 			return
@@ -489,14 +569,18 @@ func (p *XdsProxy) rewriteAndForward(con *ProxyConnection, resp *discovery.Disco
 		return
 	}
 	proxyLog.Debugf("forward ECDS resources %+v", resp.Resources)
-	forwardToEnvoy(con, resp)
+	p.forwardToEnvoy(con, resp)
 }
 
-func forwardToEnvoy(con *ProxyConnection, resp *discovery.DiscoveryResponse) {
+func (p *XdsProxy) forwardToEnvoy(con *ProxyConnection, resp *discovery.DiscoveryResponse) {
 	if !v3.IsEnvoyType(resp.TypeUrl) {
 		proxyLog.Errorf("Skipping forwarding type url %s to Envoy as is not a valid Envoy type", resp.TypeUrl)
 		return
 	}
+	if p.xdsCache != nil {
+		// Recorded before sending, as Envoy may ACK before the send returns.
+		p.xdsCache.sent(resp)
+	}
 	if err := sendDownstreamWithTimeout(con.downstream, resp); err != nil {
 		select {
 		case con.downstreamError <- err:
@@ -78,6 +78,12 @@ func (p *XdsProxy) DeltaAggregatedResources(downstream discovery.AggregatedDisco
 						TypeUrl: v3.ProxyConfigType,
 					}
 				}
+				// fire off an initial CRL request
+				if _, f := p.handlers[v3.CRLType]; f {
+					con.deltaRequestsChan <- &discovery.DeltaDiscoveryRequest{
+						TypeUrl: v3.CRLType,
+					}
+				}
 				// Fire of a configured initial request, if there is one
 				if initialRequest != nil {
 					con.deltaRequestsChan <- initialRequest
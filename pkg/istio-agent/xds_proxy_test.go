@@ -352,6 +352,66 @@ func TestXdsProxyReconnects(t *testing.T) {
 	})
 }
 
+// Validates that the last ACKed responses are served to Envoy when istiod is unreachable
+func TestXdsProxyCache(t *testing.T) {
+	proxy := setupXdsProxy(t)
+	cache, err := newXdsCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy.xdsCache = cache
+	f := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	setDialOptions(proxy, f.Listener)
+
+	node := &core.Node{
+		Id:       "sidecar~1.1.1.1~debug~cluster.local",
+		Metadata: model.NodeMetadata{Namespace: "default", InstanceIPs: []string{"1.1.1.1"}}.ToStruct(),
+	}
+	conn := setupDownstreamConnection(t, proxy)
+	downstream := stream(t, conn)
+	if err := downstream.Send(&discovery.DiscoveryRequest{TypeUrl: v3.ClusterType, Node: node}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := downstream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := downstream.Send(&discovery.DiscoveryRequest{
+		TypeUrl:       v3.ClusterType,
+		Node:          node,
+		VersionInfo:   resp.VersionInfo,
+		ResponseNonce: resp.Nonce,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		if cache.load(v3.ClusterType, nil) == nil {
+			return fmt.Errorf("response not cached")
+		}
+		return nil
+	}, retry.Timeout(time.Second*2))
+	downstream.CloseSend()
+
+	// Istiod is now unreachable
+	proxy.istiodDialOptions = []grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return nil, errors.New("istiod is down")
+		}),
+	}
+	downstream = stream(t, conn)
+	if err := downstream.Send(&discovery.DiscoveryRequest{TypeUrl: v3.ClusterType, Node: node}); err != nil {
+		t.Fatal(err)
+	}
+	cached, err := downstream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(cached, resp) {
+		t.Fatalf("expected the cached response %v, got %v", resp, cached)
+	}
+}
+
 type fakeAckCache struct{}
 
 func (f *fakeAckCache) Get(string, string, time.Duration) (string, error) {
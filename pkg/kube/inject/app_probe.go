@@ -18,7 +18,10 @@ package inject
 
 import (
 	"encoding/json"
+	"net"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/gogo/protobuf/types"
 	corev1 "k8s.io/api/core/v1"
@@ -26,6 +29,7 @@ import (
 
 	"istio.io/api/annotation"
 	"istio.io/istio/pilot/cmd/pilot-agent/status"
+	"istio.io/istio/pkg/kube/apimirror"
 	"istio.io/pkg/log"
 )
 
@@ -61,9 +65,28 @@ func FindContainer(name string, containers []corev1.Container) *corev1.Container
 
 // convertAppProber returns an overwritten `Probe` for pilot agent to take over.
 func convertAppProber(probe *corev1.Probe, newURL string, statusPort int) *corev1.Probe {
-	if probe == nil || probe.HTTPGet == nil {
+	if probe == nil {
 		return nil
 	}
+	if probe.HTTPGet != nil {
+		return convertAppProberHTTPGet(probe, newURL, statusPort)
+	}
+	if probe.TCPSocket != nil || grpcHealthProbeAction(probe.Exec) != nil {
+		// The TCP and gRPC probes are sent by pilot agent, kubelet sends an HTTP probe to pilot agent instead.
+		// Kubelet -> HTTP -> Pilot Agent -> TCP/gRPC -> Application
+		p := probe.DeepCopy()
+		p.Handler = corev1.Handler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: newURL,
+				Port: intstr.FromInt(statusPort),
+			},
+		}
+		return p
+	}
+	return nil
+}
+
+func convertAppProberHTTPGet(probe *corev1.Probe, newURL string, statusPort int) *corev1.Probe {
 	p := probe.DeepCopy()
 	// Change the application container prober config.
 	p.HTTPGet.Port = intstr.FromInt(statusPort)
@@ -81,8 +104,10 @@ type KubeAppProbers map[string]*Prober
 
 // Prober represents a single container prober
 type Prober struct {
-	HTTPGet        *corev1.HTTPGetAction `json:"httpGet"`
-	TimeoutSeconds int32                 `json:"timeoutSeconds,omitempty"`
+	HTTPGet        *corev1.HTTPGetAction   `json:"httpGet,omitempty"`
+	TCPSocket      *corev1.TCPSocketAction `json:"tcpSocket,omitempty"`
+	GRPC           *apimirror.GRPCAction   `json:"grpc,omitempty"`
+	TimeoutSeconds int32                   `json:"timeoutSeconds,omitempty"`
 }
 
 // DumpAppProbers returns a json encoded string as `status.KubeAppProbers`.
@@ -90,16 +115,26 @@ type Prober struct {
 func DumpAppProbers(podspec *corev1.PodSpec, targetPort int32) string {
 	out := KubeAppProbers{}
 	updateNamedPort := func(p *Prober, portMap map[string]int32) *Prober {
-		if p == nil || p.HTTPGet == nil {
+		if p == nil {
 			return nil
 		}
-		if p.HTTPGet.Port.Type == intstr.String {
-			port, exists := portMap[p.HTTPGet.Port.StrVal]
+		if p.GRPC != nil {
+			// The gRPC port is always a number.
+			return p
+		}
+		var probePort *intstr.IntOrString
+		if p.HTTPGet != nil {
+			probePort = &p.HTTPGet.Port
+		} else {
+			probePort = &p.TCPSocket.Port
+		}
+		if probePort.Type == intstr.String {
+			port, exists := portMap[probePort.StrVal]
 			if !exists {
 				return nil
 			}
-			p.HTTPGet.Port = intstr.FromInt(int(port))
-		} else if p.HTTPGet.Port.IntVal == targetPort {
+			*probePort = intstr.FromInt(int(port))
+		} else if p.HTTPGet != nil && probePort.IntVal == targetPort {
 			// Already is rewritten
 			return nil
 		}
@@ -182,12 +217,80 @@ func kubeProbeToInternalProber(probe *corev1.Probe) *Prober {
 		return nil
 	}
 
-	if probe.HTTPGet == nil {
-		return nil
+	if probe.HTTPGet != nil {
+		return &Prober{
+			HTTPGet:        probe.HTTPGet,
+			TimeoutSeconds: probe.TimeoutSeconds,
+		}
+	}
+
+	if probe.TCPSocket != nil {
+		return &Prober{
+			TCPSocket:      probe.TCPSocket,
+			TimeoutSeconds: probe.TimeoutSeconds,
+		}
 	}
 
-	return &Prober{
-		HTTPGet:        probe.HTTPGet,
-		TimeoutSeconds: probe.TimeoutSeconds,
+	if grpc := grpcHealthProbeAction(probe.Exec); grpc != nil {
+		return &Prober{
+			GRPC:           grpc,
+			TimeoutSeconds: probe.TimeoutSeconds,
+		}
+	}
+
+	return nil
+}
+
+// grpcHealthProbeAction returns the gRPC health check of an exec probe running grpc_health_probe
+// (https://github.com/grpc-ecosystem/grpc-health-probe), the usual way to define gRPC probes until
+// Kubernetes supports them natively. Probes using TLS, or checking a remote address, are not rewritten.
+// The command runs in the container, so the health check keeps connecting to the loopback interface.
+func grpcHealthProbeAction(exec *corev1.ExecAction) *apimirror.GRPCAction {
+	if exec == nil || len(exec.Command) == 0 || filepath.Base(exec.Command[0]) != "grpc_health_probe" {
+		return nil
+	}
+	var addr, service string
+	var hasService bool
+	args := exec.Command[1:]
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		value := ""
+		if eq := strings.Index(name, "="); eq >= 0 {
+			name, value = name[:eq], name[eq+1:]
+		} else if name == "addr" || name == "service" {
+			if i+1 >= len(args) {
+				return nil
+			}
+			i++
+			value = args[i]
+		}
+		switch {
+		case name == "addr":
+			addr = value
+		case name == "service":
+			service, hasService = value, true
+		case strings.HasPrefix(name, "tls"), strings.HasPrefix(name, "spiffe"), strings.HasPrefix(name, "alts"):
+			return nil
+		}
+	}
+	host, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+	if host != "" && host != "localhost" && !net.ParseIP(host).IsLoopback() {
+		return nil
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil || port <= 0 || port > 65535 {
+		return nil
+	}
+	if host == "" {
+		// grpc_health_probe connects to the local system when the host is omitted.
+		host = "localhost"
+	}
+	grpc := &apimirror.GRPCAction{Port: int32(port), Host: host}
+	if hasService {
+		grpc.Service = &service
 	}
+	return grpc
 }
@@ -14,12 +14,14 @@
 package inject
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/gogo/protobuf/types"
 	corev1 "k8s.io/api/core/v1"
 
 	"istio.io/api/annotation"
+	"istio.io/istio/pkg/kube/apimirror"
 )
 
 func TestFindSidecar(t *testing.T) {
@@ -110,3 +112,36 @@ func TestShouldRewriteAppHTTPProbers(t *testing.T) {
 		}
 	}
 }
+
+func TestGRPCHealthProbeAction(t *testing.T) {
+	service := "world"
+	for _, tc := range []struct {
+		name     string
+		command  []string
+		expected *apimirror.GRPCAction
+	}{
+		{"not-exec", nil, nil},
+		{"other-command", []string{"cat", "/tmp/healthy"}, nil},
+		{"addr", []string{"/bin/grpc_health_probe", "-addr=:90"}, &apimirror.GRPCAction{Port: 90, Host: "localhost"}},
+		{"separate-values", []string{"grpc_health_probe", "--addr", "localhost:90", "-service", "world"},
+			&apimirror.GRPCAction{Port: 90, Service: &service, Host: "localhost"}},
+		{"ignored-flags", []string{"grpc_health_probe", "-addr=127.0.0.1:90", "-connect-timeout=250ms", "-service=world"},
+			&apimirror.GRPCAction{Port: 90, Service: &service, Host: "127.0.0.1"}},
+		{"ipv6-loopback", []string{"grpc_health_probe", "-addr=[::1]:90"}, &apimirror.GRPCAction{Port: 90, Host: "::1"}},
+		{"tls", []string{"grpc_health_probe", "-addr=:90", "-tls"}, nil},
+		{"remote-addr", []string{"grpc_health_probe", "-addr=10.0.0.1:90"}, nil},
+		{"named-port", []string{"grpc_health_probe", "-addr=:grpc"}, nil},
+		{"missing-addr", []string{"grpc_health_probe"}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var exec *corev1.ExecAction
+			if tc.command != nil {
+				exec = &corev1.ExecAction{Command: tc.command}
+			}
+			got := grpcHealthProbeAction(exec)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got %+v, want %+v", got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// Media types of the manifests served by registries.
+	ManifestMediaType           = "application/vnd.oci.image.manifest.v1+json"
+	IndexMediaType              = "application/vnd.oci.image.index.v1+json"
+	DockerManifestMediaType     = "application/vnd.docker.distribution.manifest.v2+json"
+	DockerManifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// maxManifestSize caps the size of a manifest read from a registry.
+	maxManifestSize = 4 << 20
+)
+
+// Descriptor describes a blob of an artifact, such as a layer.
+type Descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// Manifest is an OCI image manifest or a Docker image manifest.
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// Credentials authenticate requests to a registry. Either the username and password or the token are set.
+type Credentials struct {
+	Username string
+	Password string
+	// Token is sent as a bearer token.
+	Token string
+}
+
+// SetAuth sets the authorization header of the request.
+func (c *Credentials) SetAuth(req *http.Request) {
+	if c == nil {
+		return
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+}
+
+// Client pulls manifests and blobs from a registry, handling the basic and bearer token authentication
+// schemes of the distribution API. A Client is not safe for concurrent use.
+type Client struct {
+	client *http.Client
+	scheme string
+	// creds are the credentials of the registry, if any.
+	creds *Credentials
+	// token is the bearer token of the credentials, or the one obtained for the repository when challenged by
+	// the registry. It is reused across requests.
+	token string
+	// authenticated is set once the challenge of the registry was handled, so that it is handled only once.
+	authenticated bool
+}
+
+// NewClient creates a client sending requests with the HTTP client and the credentials, which are nil for
+// anonymous pulls. If insecure is set, the registry is accessed over plain HTTP.
+func NewClient(client *http.Client, creds *Credentials, insecure bool) *Client {
+	c := &Client{client: client, scheme: "https", creds: creds}
+	if insecure {
+		c.scheme = "http"
+	}
+	if creds != nil {
+		c.token = creds.Token
+	}
+	return c
+}
+
+// FetchManifest returns the manifest of the artifact and its digest, which is verified against the digest of
+// the reference and the digest reported by the registry. Manifest lists and indexes are not supported.
+func (c *Client) FetchManifest(ref *Reference) (*Manifest, string, error) {
+	resp, err := c.get(ref, "manifests/"+ref.Reference, strings.Join([]string{ManifestMediaType, DockerManifestMediaType}, ","))
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	body, err := ReadAtMost(resp.Body, maxManifestSize, "manifest")
+	if err != nil {
+		return nil, "", err
+	}
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	if ref.IsDigest() && ref.Reference != digest {
+		return nil, "", fmt.Errorf("manifest has digest %v, which does not match %v", digest, ref.Reference)
+	}
+	if reported := resp.Header.Get("Docker-Content-Digest"); reported != "" && reported != digest {
+		return nil, "", fmt.Errorf("manifest has digest %v, which does not match the digest %v reported by the registry", digest, reported)
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(body, m); err != nil {
+		return nil, "", fmt.Errorf("could not parse manifest: %v", err)
+	}
+	mediaType := m.MediaType
+	if mediaType == "" {
+		mediaType = resp.Header.Get("Content-Type")
+	}
+	switch mediaType {
+	case DockerManifestListMediaType, IndexMediaType:
+		return nil, "", fmt.Errorf("unsupported manifest media type %v: multi-platform images are not supported", mediaType)
+	}
+	if len(m.Layers) == 0 {
+		return nil, "", fmt.Errorf("manifest has no layers")
+	}
+	return m, digest, nil
+}
+
+// FetchBlob returns the content of the blob. Reading the content fails once it holds more bytes than the size of
+// the descriptor, or at its end if its size or digest do not match the descriptor, so the content must only be
+// used once it was read completely.
+func (c *Client) FetchBlob(ref *Reference, blob Descriptor) (io.ReadCloser, error) {
+	resp, err := c.get(ref, "blobs/"+blob.Digest, "")
+	if err != nil {
+		return nil, err
+	}
+	return &verifyingReader{body: resp.Body, hash: sha256.New(), blob: blob}, nil
+}
+
+// verifyingReader verifies the size and digest of a blob as it is read.
+type verifyingReader struct {
+	body io.ReadCloser
+	hash hash.Hash
+	blob Descriptor
+	n    int64
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.hash.Write(p[:n])
+	r.n += int64(n)
+	if r.n > r.blob.Size {
+		return n, fmt.Errorf("layer %v is larger than %d bytes", r.blob.Digest, r.blob.Size)
+	}
+	if err == io.EOF {
+		if r.n != r.blob.Size {
+			return n, fmt.Errorf("layer has size %d, which does not match %d", r.n, r.blob.Size)
+		}
+		if digest := fmt.Sprintf("sha256:%x", r.hash.Sum(nil)); digest != r.blob.Digest {
+			return n, fmt.Errorf("layer has digest %v, which does not match %v", digest, r.blob.Digest)
+		}
+	}
+	return n, err
+}
+
+func (r *verifyingReader) Close() error {
+	return r.body.Close()
+}
+
+// ReadAtMost reads r, failing if it holds more than limit bytes rather than truncating it, as a truncated
+// artifact would be cached by digest.
+func ReadAtMost(r io.Reader, limit int64, what string) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("%s is too large: more than %d bytes", what, limit)
+	}
+	return b, nil
+}
+
+// get sends a GET request for the given resource of the repository, authenticating if challenged by the registry.
+func (c *Client) get(ref *Reference, resource, accept string) (*http.Response, error) {
+	registry := ref.Registry
+	if registry == DockerHubRegistry {
+		registry = dockerHubAPIRegistry
+	}
+	u := fmt.Sprintf("%s://%s/v2/%s/%s", c.scheme, registry, ref.Repository, resource)
+	do := func() (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		} else if c.creds != nil && c.creds.Username != "" {
+			req.SetBasicAuth(c.creds.Username, c.creds.Password)
+		}
+		return c.client.Do(req)
+	}
+	resp, err := do()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && !c.authenticated {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := c.authenticate(challenge, ref); err != nil {
+			return nil, err
+		}
+		if resp, err = do(); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("request to %v failed: %s", u, resp.Status)
+	}
+	return resp, nil
+}
+
+// authenticate handles the challenge of the registry. For the bearer token scheme, a token is requested from the
+// authorization service with the credentials of the registry; the basic scheme only needs the credentials to be set.
+func (c *Client) authenticate(challenge string, ref *Reference) error {
+	c.authenticated = true
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.creds == nil || c.creds.Username == "" {
+			return fmt.Errorf("registry %v requires credentials, but none were provided", ref.Registry)
+		}
+		c.token = ""
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("unsupported authentication challenge %q from registry %v", challenge, ref.Registry)
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("invalid authentication realm %q from registry %v", params["realm"], ref.Registry)
+	}
+	q := realm.Query()
+	if service := params["service"]; service != "" {
+		q.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", ref.Repository)
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.creds != nil && c.creds.Username != "" {
+		req.SetBasicAuth(c.creds.Username, c.creds.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not get token from %v: %v", realm.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not get token from %v: %s", realm.Host, resp.Status)
+	}
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("could not parse token from %v: %v", realm.Host, err)
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	if c.token == "" {
+		return fmt.Errorf("no token returned from %v", realm.Host)
+	}
+	return nil
+}
+
+// parseChallenge parses a WWW-Authenticate header such as `Bearer realm="https://auth",service="registry"`.
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) != 2 {
+		return parts[0], params
+	}
+	for _, kv := range splitChallengeParams(parts[1]) {
+		p := strings.SplitN(kv, "=", 2)
+		if len(p) != 2 {
+			continue
+		}
+		params[strings.ToLower(strings.TrimSpace(p[0]))] = strings.Trim(strings.TrimSpace(p[1]), `"`)
+	}
+	return parts[0], params
+}
+
+// splitChallengeParams splits challenge parameters on commas which are not within quotes,
+// as the scope parameter may contain commas.
+func splitChallengeParams(s string) []string {
+	var out []string
+	quoted := false
+	start := 0
+	for i, c := range s {
+		switch c {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				out = append(out, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(out, s[start:])
+}
@@ -0,0 +1,222 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"istio.io/istio/pkg/oci/ocitest"
+)
+
+const layerMediaType = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+func TestClient(t *testing.T) {
+	cases := []struct {
+		name    string
+		basic   bool
+		creds   *Credentials
+		wantErr string
+	}{
+		{
+			name:  "bearer token",
+			creds: &Credentials{Username: "user", Password: "pass"},
+		},
+		{
+			name:  "registry token",
+			creds: &Credentials{Token: "secret-token"},
+		},
+		{
+			name:  "basic",
+			basic: true,
+			creds: &Credentials{Username: "user", Password: "pass"},
+		},
+		{
+			name:    "bearer token without credentials",
+			wantErr: "could not get token",
+		},
+		{
+			name:    "bearer token with wrong credentials",
+			creds:   &Credentials{Username: "user", Password: "wrong"},
+			wantErr: "could not get token",
+		},
+		{
+			name:    "basic without credentials",
+			basic:   true,
+			wantErr: "requires credentials",
+		},
+		{
+			name:    "basic with wrong credentials",
+			basic:   true,
+			creds:   &Credentials{Username: "user", Password: "wrong"},
+			wantErr: "401 Unauthorized",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ocitest.NewRegistry(t, "ns/artifact")
+			r.Username, r.Password, r.Basic = "user", "pass", tt.basic
+			wantDigest := r.Push(t, "v1", ocitest.Layer{MediaType: layerMediaType, Data: []byte("layer")})
+			ref := &Reference{Registry: r.Host(), Repository: "ns/artifact", Reference: "v1"}
+
+			c := NewClient(r.Client(), tt.creds, true)
+			m, digest, err := c.FetchManifest(ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if digest != wantDigest {
+				t.Errorf("got digest %v, want %v", digest, wantDigest)
+			}
+			blob, err := c.FetchBlob(ref, m.Layers[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer blob.Close()
+			if b, err := ioutil.ReadAll(blob); err != nil || string(b) != "layer" {
+				t.Fatalf("got blob %q, %v, want %q", b, err, "layer")
+			}
+		})
+	}
+}
+
+func TestClientVerification(t *testing.T) {
+	cases := []struct {
+		name    string
+		prepare func(r *ocitest.Registry) *Reference
+		wantErr string
+	}{
+		{
+			name: "pinned digest mismatch",
+			prepare: func(r *ocitest.Registry) *Reference {
+				r.Push(t, "v1", ocitest.Layer{MediaType: layerMediaType, Data: []byte("layer")})
+				digest := "sha256:" + strings.Repeat("0", 64)
+				r.Manifests[digest] = r.Manifests["v1"]
+				return &Reference{Registry: r.Host(), Repository: "ns/artifact", Reference: digest}
+			},
+			wantErr: "does not match sha256:0000",
+		},
+		{
+			name: "reported digest mismatch",
+			prepare: func(r *ocitest.Registry) *Reference {
+				r.Push(t, "v1", ocitest.Layer{MediaType: layerMediaType, Data: []byte("layer")})
+				r.ReportedDigest = "sha256:" + strings.Repeat("0", 64)
+				return &Reference{Registry: r.Host(), Repository: "ns/artifact", Reference: "v1"}
+			},
+			wantErr: "reported by the registry",
+		},
+		{
+			name: "index",
+			prepare: func(r *ocitest.Registry) *Reference {
+				r.Manifests["v1"] = []byte(`{"schemaVersion":2,"mediaType":"` + IndexMediaType + `","manifests":[]}`)
+				return &Reference{Registry: r.Host(), Repository: "ns/artifact", Reference: "v1"}
+			},
+			wantErr: "multi-platform images are not supported",
+		},
+		{
+			name: "no layers",
+			prepare: func(r *ocitest.Registry) *Reference {
+				r.Push(t, "v1")
+				return &Reference{Registry: r.Host(), Repository: "ns/artifact", Reference: "v1"}
+			},
+			wantErr: "manifest has no layers",
+		},
+		{
+			name: "missing manifest",
+			prepare: func(r *ocitest.Registry) *Reference {
+				return &Reference{Registry: r.Host(), Repository: "ns/artifact", Reference: "v1"}
+			},
+			wantErr: "404 Not Found",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ocitest.NewRegistry(t, "ns/artifact")
+			ref := tt.prepare(r)
+			_, _, err := NewClient(r.Client(), nil, true).FetchManifest(ref)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFetchBlobVerification(t *testing.T) {
+	cases := []struct {
+		name    string
+		served  string
+		wantErr string
+	}{
+		{name: "digest mismatch", served: "LAYER", wantErr: "layer has digest"},
+		{name: "truncated", served: "lay", wantErr: "layer has size 3, which does not match 5"},
+		{name: "too large", served: "layer!", wantErr: "is larger than 5 bytes"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ocitest.NewRegistry(t, "ns/artifact")
+			r.Push(t, "v1", ocitest.Layer{MediaType: layerMediaType, Data: []byte("layer")})
+			c := NewClient(r.Client(), nil, true)
+			ref := &Reference{Registry: r.Host(), Repository: "ns/artifact", Reference: "v1"}
+			m, _, err := c.FetchManifest(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Blobs[m.Layers[0].Digest] = []byte(tt.served)
+			blob, err := c.FetchBlob(ref, m.Layers[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer blob.Close()
+			if _, err := ioutil.ReadAll(blob); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry",scope="repository:a:pull,push"`)
+	if scheme != "Bearer" {
+		t.Errorf("got scheme %v, want Bearer", scheme)
+	}
+	want := map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry",
+		"scope":   "repository:a:pull,push",
+	}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("got params %v, want %v", params, want)
+	}
+	if scheme, params := parseChallenge("Basic"); scheme != "Basic" || len(params) != 0 {
+		t.Errorf("got %v %v, want Basic without params", scheme, params)
+	}
+}
+
+func TestReadAtMost(t *testing.T) {
+	b, err := ReadAtMost(strings.NewReader("wasm"), 4, "module")
+	if err != nil || string(b) != "wasm" {
+		t.Fatalf("got %q, %v, want the whole module", b, err)
+	}
+	if _, err := ReadAtMost(strings.NewReader("wasm!"), 4, "module"); err == nil || !strings.Contains(err.Error(), "module is too large") {
+		t.Fatalf("got error %v, want the module to be too large", err)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type dockerConfigEntry struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	Auth          string `json:"auth"`
+	RegistryToken string `json:"registrytoken"`
+}
+
+// DockerConfigCredentials extracts the credentials for the host from a Docker config JSON, or returns nil if it
+// has none. Both the kubernetes.io/dockerconfigjson format ({"auths": {...}}) and the legacy kubernetes.io/dockercfg
+// format are accepted.
+func DockerConfigCredentials(config []byte, host string) (*Credentials, error) {
+	cfg := struct {
+		Auths map[string]dockerConfigEntry `json:"auths"`
+	}{}
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, fmt.Errorf("could not parse Docker config: %v", err)
+	}
+	if cfg.Auths == nil {
+		if err := json.Unmarshal(config, &cfg.Auths); err != nil {
+			return nil, fmt.Errorf("could not parse Docker config: %v", err)
+		}
+	}
+	for server, entry := range cfg.Auths {
+		if normalizeHost(server) != normalizeHost(host) {
+			continue
+		}
+		if entry.RegistryToken != "" {
+			return &Credentials{Token: entry.RegistryToken}, nil
+		}
+		if entry.Auth == "" {
+			return &Credentials{Username: entry.Username, Password: entry.Password}, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode auth of credentials for %v: %v", server, err)
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid auth of credentials for %v", server)
+		}
+		return &Credentials{Username: parts[0], Password: parts[1]}, nil
+	}
+	return nil, nil
+}
+
+// normalizeHost strips the scheme and path of a host as found in Docker config files, e.g.
+// https://index.docker.io/v1/ becomes index.docker.io. The aliases of Docker Hub are mapped to DockerHubRegistry.
+func normalizeHost(host string) string {
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	host = strings.ToLower(strings.SplitN(host, "/", 2)[0])
+	switch host {
+	case "docker.io", dockerHubAPIRegistry:
+		return DockerHubRegistry
+	}
+	return host
+}
@@ -0,0 +1,110 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testDockerConfig = `{
+  "auths": {
+    "https://registry.example.com/v1/": {"auth": "dXNlcjpwYXNz"},
+    "charts.example.com": {"username": "bob", "password": "secret"},
+    "localhost:5000": {"registrytoken": "token"},
+    "https://index.docker.io/v1/": {"username": "hub", "password": "secret"}
+  }
+}`
+
+func TestDockerConfigCredentials(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  string
+		host    string
+		want    *Credentials
+		wantErr bool
+	}{
+		{
+			name:   "auth",
+			config: testDockerConfig,
+			host:   "registry.example.com",
+			want:   &Credentials{Username: "user", Password: "pass"},
+		},
+		{
+			name:   "username and password",
+			config: testDockerConfig,
+			host:   "Charts.example.com",
+			want:   &Credentials{Username: "bob", Password: "secret"},
+		},
+		{
+			name:   "registry token",
+			config: testDockerConfig,
+			host:   "localhost:5000",
+			want:   &Credentials{Token: "token"},
+		},
+		{
+			name:   "Docker Hub",
+			config: testDockerConfig,
+			host:   DockerHubRegistry,
+			want:   &Credentials{Username: "hub", Password: "secret"},
+		},
+		{
+			name:   "Docker Hub alias",
+			config: testDockerConfig,
+			host:   "docker.io",
+			want:   &Credentials{Username: "hub", Password: "secret"},
+		},
+		{
+			name:   "unknown host",
+			config: testDockerConfig,
+			host:   "localhost:5001",
+		},
+		{
+			name:   "legacy format",
+			config: `{"registry.example.com": {"auth": "dXNlcjpwYXNz"}}`,
+			host:   "registry.example.com",
+			want:   &Credentials{Username: "user", Password: "pass"},
+		},
+		{
+			name:    "invalid auth",
+			config:  `{"auths": {"registry.example.com": {"auth": "dXNlcg=="}}}`,
+			host:    "registry.example.com",
+			wantErr: true,
+		},
+		{
+			name:    "invalid JSON",
+			config:  `auths`,
+			host:    "registry.example.com",
+			wantErr: true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DockerConfigCredentials([]byte(tt.config), tt.host)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ocitest provides a fake OCI registry for tests.
+package ocitest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const manifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+
+// Registry is a minimal OCI distribution registry serving a single repository.
+type Registry struct {
+	*httptest.Server
+	repository string
+	// Manifests by tag and digest.
+	Manifests map[string][]byte
+	// Blobs by digest.
+	Blobs map[string][]byte
+	// If Username is set, pulls require a bearer token obtained with these credentials, or the credentials
+	// themselves if Basic is set.
+	Username, Password string
+	Basic              bool
+	// ReportedDigest overrides the Docker-Content-Digest header of the manifests.
+	ReportedDigest   string
+	ManifestRequests int
+	BlobRequests     int
+}
+
+// NewRegistry starts a registry serving the repository over plain HTTP. It is closed when the test ends.
+func NewRegistry(t *testing.T, repository string) *Registry {
+	r := newRegistry(repository)
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// NewTLSRegistry starts a registry serving the repository over TLS. Its certificate is trusted by the client
+// of the server. It is closed when the test ends.
+func NewTLSRegistry(t *testing.T, repository string) *Registry {
+	r := newRegistry(repository)
+	r.Server = httptest.NewTLSServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func newRegistry(repository string) *Registry {
+	return &Registry{repository: repository, Manifests: map[string][]byte{}, Blobs: map[string][]byte{}}
+}
+
+// Host returns the host and port of the registry.
+func (r *Registry) Host() string {
+	u, _ := url.Parse(r.URL)
+	return u.Host
+}
+
+func (r *Registry) serve(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		if u, p, _ := req.BasicAuth(); u != r.Username || p != r.Password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Query().Get("scope") != fmt.Sprintf("repository:%s:pull", r.repository) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"token":"secret-token"}`)
+		return
+	}
+	if r.Username != "" && !r.authorized(req) {
+		if r.Basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="fake"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, r.URL))
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	prefix := "/v2/" + r.repository + "/"
+	switch {
+	case strings.HasPrefix(req.URL.Path, prefix+"manifests/"):
+		r.ManifestRequests++
+		m, f := r.Manifests[strings.TrimPrefix(req.URL.Path, prefix+"manifests/")]
+		if !f {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		digest := r.ReportedDigest
+		if digest == "" {
+			digest = fmt.Sprintf("sha256:%x", sha256.Sum256(m))
+		}
+		w.Header().Set("Content-Type", manifestMediaType)
+		w.Header().Set("Docker-Content-Digest", digest)
+		_, _ = w.Write(m)
+	case strings.HasPrefix(req.URL.Path, prefix+"blobs/"):
+		r.BlobRequests++
+		b, f := r.Blobs[strings.TrimPrefix(req.URL.Path, prefix+"blobs/")]
+		if !f {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(b)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (r *Registry) authorized(req *http.Request) bool {
+	if r.Basic {
+		u, p, _ := req.BasicAuth()
+		return u == r.Username && p == r.Password
+	}
+	return req.Header.Get("Authorization") == "Bearer secret-token"
+}
+
+// Layer is a layer of an artifact pushed to the registry.
+type Layer struct {
+	MediaType string
+	Data      []byte
+}
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Layers        []descriptor `json:"layers"`
+}
+
+// Push adds an artifact with the given layers to the registry and returns the digest of its manifest.
+func (r *Registry) Push(t *testing.T, tag string, layers ...Layer) string {
+	m := manifest{SchemaVersion: 2, MediaType: manifestMediaType}
+	for _, l := range layers {
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(l.Data))
+		r.Blobs[digest] = l.Data
+		m.Layers = append(m.Layers, descriptor{MediaType: l.MediaType, Digest: digest, Size: int64(len(l.Data))})
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+	r.Manifests[tag] = b
+	r.Manifests[digest] = b
+	return digest
+}
+
+// TarGz returns a gzipped tar archive holding the files.
+func TarGz(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
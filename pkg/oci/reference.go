@@ -0,0 +1,122 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oci provides a minimal client pulling artifacts, such as Wasm modules and installation packages,
+// from registries implementing the OCI distribution API.
+package oci
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Scheme is the prefix of references to artifacts in OCI registries.
+	Scheme = "oci://"
+
+	// DockerHubRegistry is the registry of references which do not name a registry, as with docker pull.
+	DockerHubRegistry = "index.docker.io"
+	// dockerHubAPIRegistry is the host serving the registry API of Docker Hub.
+	dockerHubAPIRegistry = "registry-1.docker.io"
+)
+
+// Reference identifies an artifact in an OCI registry.
+type Reference struct {
+	Registry   string
+	Repository string
+	// Reference is either a tag or a digest of the form sha256:<hex>.
+	Reference string
+}
+
+// IsDigest reports whether the reference is a digest rather than a tag.
+func (r *Reference) IsDigest() bool {
+	return strings.HasPrefix(r.Reference, "sha256:")
+}
+
+// ParseReference parses a reference of the form oci://registry/repository:tag or oci://registry/repository@digest.
+// Both the registry and the tag or digest are required.
+func ParseReference(ref string) (*Reference, error) {
+	name, out, err := parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	if out.IsDigest() && len(out.Reference) != len("sha256:")+sha256.Size*2 {
+		return nil, fmt.Errorf("invalid OCI reference %q: unsupported digest %v", ref, out.Reference)
+	}
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid OCI reference %q: expect %sregistry/repository:tag", ref, Scheme)
+	}
+	out.Registry, out.Repository = parts[0], parts[1]
+	if out.Reference == "" {
+		return nil, fmt.Errorf("invalid OCI reference %q: a tag or digest is required", ref)
+	}
+	return out, nil
+}
+
+// ParseImageReference parses an image reference of the form oci://registry/repository[:tag|@digest]. As with
+// docker pull, the registry defaults to Docker Hub and the tag to latest.
+func ParseImageReference(ref string) (*Reference, error) {
+	name, out, err := parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	if out.Reference == "" {
+		out.Reference = "latest"
+	}
+	if i := strings.Index(name, "/"); i >= 0 && isRegistryHost(name[:i]) {
+		out.Registry = name[:i]
+		out.Repository = name[i+1:]
+	} else {
+		out.Registry = DockerHubRegistry
+		out.Repository = name
+	}
+	if out.Registry == DockerHubRegistry && !strings.Contains(out.Repository, "/") {
+		out.Repository = "library/" + out.Repository
+	}
+	if out.Repository == "" {
+		return nil, fmt.Errorf("invalid OCI reference %q", ref)
+	}
+	return out, nil
+}
+
+// parse splits the reference into the name of the repository, including its registry, and its tag or digest.
+func parse(ref string) (string, *Reference, error) {
+	name := strings.TrimPrefix(ref, Scheme)
+	if name == "" || name == ref {
+		return "", nil, fmt.Errorf("invalid OCI reference %q: must start with %s", ref, Scheme)
+	}
+	out := &Reference{}
+	if i := strings.Index(name, "@"); i >= 0 {
+		out.Reference = name[i+1:]
+		name = name[:i]
+		if !out.IsDigest() {
+			return "", nil, fmt.Errorf("invalid OCI reference %q: unsupported digest %v", ref, out.Reference)
+		}
+	} else if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i+1:], "/") {
+		out.Reference = name[i+1:]
+		name = name[:i]
+		if out.Reference == "" {
+			return "", nil, fmt.Errorf("invalid OCI reference %q: empty tag", ref)
+		}
+	}
+	return name, out, nil
+}
+
+// isRegistryHost reports whether the first component of an image name is a registry host rather than
+// part of a Docker Hub repository path.
+func isRegistryHost(s string) bool {
+	return strings.ContainsAny(s, ".:") || s == "localhost"
+}
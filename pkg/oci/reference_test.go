@@ -0,0 +1,90 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	cases := []struct {
+		ref     string
+		want    *Reference
+		wantErr bool
+	}{
+		{
+			ref:  "oci://registry.example.com/istio/manifests:1.10.0",
+			want: &Reference{Registry: "registry.example.com", Repository: "istio/manifests", Reference: "1.10.0"},
+		},
+		{
+			ref:  "oci://localhost:5000/manifests@" + digest,
+			want: &Reference{Registry: "localhost:5000", Repository: "manifests", Reference: digest},
+		},
+		{ref: "oci://localhost:5000/manifests", wantErr: true},
+		{ref: "oci://manifests:1.10.0", wantErr: true},
+		{ref: "oci://localhost:5000/manifests:", wantErr: true},
+		{ref: "oci://localhost:5000/manifests@sha256:abc", wantErr: true},
+		{ref: "https://localhost:5000/manifests:1.10.0", wantErr: true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := ParseReference(tt.ref)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImageReference(t *testing.T) {
+	cases := []struct {
+		url     string
+		want    *Reference
+		wantErr bool
+	}{
+		{"oci://gcr.io/ns/plugin:v1", &Reference{"gcr.io", "ns/plugin", "v1"}, false},
+		{"oci://localhost:5000/plugin", &Reference{"localhost:5000", "plugin", "latest"}, false},
+		{"oci://localhost/ns/plugin@sha256:abc", &Reference{"localhost", "ns/plugin", "sha256:abc"}, false},
+		{"oci://plugin", &Reference{"index.docker.io", "library/plugin", "latest"}, false},
+		{"oci://ns/plugin:v2", &Reference{"index.docker.io", "ns/plugin", "v2"}, false},
+		{"oci://gcr.io/ns/plugin@md5:abc", nil, true},
+		{"oci://gcr.io/ns/plugin:", nil, true},
+		{"oci://", nil, true},
+		{"https://gcr.io/ns/plugin", nil, true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := ParseImageReference(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
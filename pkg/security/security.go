@@ -56,6 +56,10 @@ const (
 	// Credential fetcher type
 	GCE  = "GoogleComputeEngine"
 	Mock = "Mock" // testing only
+
+	// ExternalCAProvider is the CA provider name of a CA implementing the Istio certificate service
+	// at an arbitrary endpoint, authenticated with custom headers and mTLS.
+	ExternalCAProvider = "ExternalCA"
 )
 
 // TODO: For 1.8, make sure MeshConfig is updated with those settings,
@@ -163,6 +167,22 @@ type Options struct {
 
 	// Token manager for the token exchange of XDS
 	TokenManager TokenManager
+
+	// CAHeaders are additional gRPC metadata sent with the CSR requests. Used by the ExternalCA
+	// provider, for example to pass an API key to the CA.
+	CAHeaders map[string]string
+
+	// CAClientCertFile and CAClientKeyFile are the certificate and key used by the ExternalCA
+	// provider to authenticate with the CA using mTLS. They are reloaded on each connection.
+	CAClientCertFile string
+	CAClientKeyFile  string
+
+	// CATLSServerName overrides the server name used to verify the certificate of the CA.
+	CATLSServerName string
+
+	// CASendWorkloadToken sends the token of the workload with the CSR requests of the ExternalCA provider.
+	// It is off by default, as the token is also accepted by Istiod.
+	CASendWorkloadToken bool
 }
 
 // TokenManager contains methods for generating token.
@@ -240,6 +260,9 @@ type SecretItem struct {
 
 	RootCert []byte
 
+	// CRL is the PEM encoded certificate revocation list of the CA of the root cert, if any.
+	CRL []byte
+
 	// ResourceName passed from envoy SDS discovery request.
 	// "ROOTCA" for root cert request, "default" for key/cert request.
 	ResourceName string
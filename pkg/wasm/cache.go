@@ -22,9 +22,12 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"istio.io/istio/pilot/pkg/util/sets"
+	"istio.io/istio/pkg/oci"
 	"istio.io/pkg/log"
 )
 
@@ -52,6 +55,12 @@ type LocalFileCache struct {
 	// http fetcher fetches Wasm module with HTTP get.
 	httpFetcher *HTTPFetcher
 
+	// Registries which are accessed over plain HTTP when pulling Wasm module images.
+	insecureRegistries sets.Set
+
+	// Path to a Docker config JSON used to authenticate to registries when pulling Wasm module images.
+	pullSecretPath string
+
 	// directory path used to store Wasm module.
 	dir string
 
@@ -82,15 +91,26 @@ type cacheEntry struct {
 	last time.Time
 }
 
+// ImagePullOptions configures how Wasm modules packaged as OCI images are pulled.
+type ImagePullOptions struct {
+	// InsecureRegistries are accessed over plain HTTP.
+	InsecureRegistries []string
+	// PullSecretPath is the path to a Docker config JSON, such as a mounted kubernetes.io/dockerconfigjson secret,
+	// holding the registry credentials. It is read on every pull, so that rotated credentials are picked up.
+	PullSecretPath string
+}
+
 // NewLocalFileCache create a new Wasm module cache which downloads and stores Wasm module files locally.
-func NewLocalFileCache(dir string, purgeInterval, moduleExpiry time.Duration) *LocalFileCache {
+func NewLocalFileCache(dir string, purgeInterval, moduleExpiry time.Duration, pullOptions ImagePullOptions) *LocalFileCache {
 	cache := &LocalFileCache{
-		httpFetcher:      NewHTTPFetcher(),
-		modules:          make(map[cacheKey]cacheEntry),
-		dir:              dir,
-		purgeInterval:    purgeInterval,
-		wasmModuleExpiry: moduleExpiry,
-		stopChan:         make(chan struct{}),
+		httpFetcher:        NewHTTPFetcher(),
+		insecureRegistries: sets.NewSet(pullOptions.InsecureRegistries...),
+		pullSecretPath:     pullOptions.PullSecretPath,
+		modules:            make(map[cacheKey]cacheEntry),
+		dir:                dir,
+		purgeInterval:      purgeInterval,
+		wasmModuleExpiry:   moduleExpiry,
+		stopChan:           make(chan struct{}),
 	}
 	go func() {
 		cache.purge()
@@ -143,11 +163,70 @@ func (c *LocalFileCache) Get(downloadURL, checksum string, timeout time.Duration
 		}
 
 		return f, nil
+	case "oci":
+		return c.getImage(key, timeout)
 	default:
 		return "", fmt.Errorf("unsupported Wasm module downloading URL scheme: %v", url.Scheme)
 	}
 }
 
+// getImage returns the path of the Wasm module pulled from an OCI registry. Modules are cached by image digest,
+// so that an image is only pulled again if the tag has been moved to a different image.
+func (c *LocalFileCache) getImage(key cacheKey, timeout time.Duration) (string, error) {
+	// The checksum, if provided, is the digest of the image. In that case the cached module can be
+	// used without contacting the registry.
+	key.checksum = strings.TrimPrefix(key.checksum, "sha256:")
+	if key.checksum != "" {
+		if modulePath := c.getEntry(key); modulePath != "" {
+			return modulePath, nil
+		}
+	}
+
+	ref, err := oci.ParseImageReference(key.downloadURL)
+	if err != nil {
+		return "", err
+	}
+	var pullSecret []byte
+	if c.pullSecretPath != "" {
+		if pullSecret, err = ioutil.ReadFile(c.pullSecretPath); err != nil {
+			return "", fmt.Errorf("could not read pull secret: %v", err)
+		}
+	}
+	fetcher, err := NewImageFetcher(ref.Registry, pullSecret, c.insecureRegistries.Contains(ref.Registry), timeout)
+	if err != nil {
+		return "", err
+	}
+	binaryFetcher, digest, err := fetcher.PrepareFetch(key.downloadURL)
+	if err != nil {
+		wasmRemoteFetchCount.With(resultTag.Value(downloadFailure)).Increment()
+		return "", err
+	}
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if key.checksum != "" && digest != key.checksum {
+		wasmRemoteFetchCount.With(resultTag.Value(checksumMismatch)).Increment()
+		return "", fmt.Errorf("image %v has digest %v, which does not match: %v", key.downloadURL, digest, key.checksum)
+	}
+
+	// The tag may still point to an image which has already been pulled.
+	key.checksum = digest
+	if modulePath := c.getEntry(key); modulePath != "" {
+		return modulePath, nil
+	}
+
+	b, err := binaryFetcher()
+	if err != nil {
+		wasmRemoteFetchCount.With(resultTag.Value(downloadFailure)).Increment()
+		return "", fmt.Errorf("could not fetch Wasm module from image %v: %v", key.downloadURL, err)
+	}
+	wasmRemoteFetchCount.With(resultTag.Value(fetchSuccess)).Increment()
+
+	f := filepath.Join(c.dir, fmt.Sprintf("%s.wasm", digest))
+	if err := c.addEntry(key, b, f); err != nil {
+		return "", err
+	}
+	return f, nil
+}
+
 // Cleanup closes background Wasm module purge routine.
 func (c *LocalFileCache) Cleanup() {
 	close(c.stopChan)
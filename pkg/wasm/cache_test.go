@@ -78,12 +78,12 @@ func TestWasmCache(t *testing.T) {
 		{
 			name:                 "invalid scheme",
 			initialCachedModules: map[cacheKey]cacheEntry{},
-			fetchURL:             "oci://abc",
+			fetchURL:             "ftp://abc",
 			purgeInterval:        DefaultWasmModulePurgeInteval,
 			wasmModuleExpiry:     DefaultWasmModuleExpiry,
 			checksum:             dataCheckSum,
 			wantFileName:         fmt.Sprintf("%x.wasm", dataCheckSum),
-			wantErrorMsgPrefix:   "unsupported Wasm module downloading URL scheme: oci",
+			wantErrorMsgPrefix:   "unsupported Wasm module downloading URL scheme: ftp",
 			wantServerReqNum:     0,
 		},
 		{
@@ -138,7 +138,7 @@ func TestWasmCache(t *testing.T) {
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
 			tmpDir := t.TempDir()
-			cache := NewLocalFileCache(tmpDir, c.purgeInterval, c.wasmModuleExpiry)
+			cache := NewLocalFileCache(tmpDir, c.purgeInterval, c.wasmModuleExpiry, ImagePullOptions{})
 			defer close(cache.stopChan)
 			tsNumRequest = 0
 
@@ -191,7 +191,7 @@ func TestWasmCache(t *testing.T) {
 
 func TestWasmCacheMissChecksum(t *testing.T) {
 	tmpDir := t.TempDir()
-	cache := NewLocalFileCache(tmpDir, DefaultWasmModulePurgeInteval, DefaultWasmModuleExpiry)
+	cache := NewLocalFileCache(tmpDir, DefaultWasmModulePurgeInteval, DefaultWasmModuleExpiry, ImagePullOptions{})
 	defer close(cache.stopChan)
 
 	gotNumRequest := 0
@@ -0,0 +1,150 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	"istio.io/istio/pkg/oci"
+)
+
+const (
+	// wasmLayerMediaType is the media type of the layer holding the Wasm binary as is,
+	// as defined by the "compat" variant of the Wasm OCI image specification.
+	wasmLayerMediaType = "application/vnd.module.wasm.content.layer.v1+wasm"
+
+	// wasmFileName is the conventional name of the Wasm binary in a Docker or OCI image with a single layer.
+	wasmFileName = "plugin.wasm"
+
+	// maxWasmModuleSize caps the size of a single image layer read from a registry.
+	maxWasmModuleSize = 256 << 20
+)
+
+// ImageFetcher fetches Wasm modules packaged as OCI images from a registry.
+type ImageFetcher struct {
+	client *oci.Client
+}
+
+// NewImageFetcher creates a new fetcher for Wasm module images hosted in the given registry.
+// The pull secret, if set, must be a Docker config JSON, such as the content of a
+// kubernetes.io/dockerconfigjson secret. If insecure is set, the registry is accessed over plain HTTP.
+func NewImageFetcher(registry string, pullSecret []byte, insecure bool, timeout time.Duration) (*ImageFetcher, error) {
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	var creds *oci.Credentials
+	if len(pullSecret) > 0 {
+		var err error
+		if creds, err = oci.DockerConfigCredentials(pullSecret, registry); err != nil {
+			return nil, fmt.Errorf("invalid pull secret: %v", err)
+		}
+	}
+	return &ImageFetcher{client: oci.NewClient(&http.Client{Timeout: timeout}, creds, insecure)}, nil
+}
+
+// PrepareFetch resolves the image manifest and returns the digest of the image, along with a function which
+// downloads and extracts the Wasm binary. This allows callers to check if the image is already cached by
+// digest before downloading the module.
+func (f *ImageFetcher) PrepareFetch(imageURL string) (binaryFetcher func() ([]byte, error), digest string, err error) {
+	ref, err := oci.ParseImageReference(imageURL)
+	if err != nil {
+		return nil, "", err
+	}
+	m, digest, err := f.client.FetchManifest(ref)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not fetch manifest for %v: %v", imageURL, err)
+	}
+	return func() ([]byte, error) {
+		return f.extractWasm(ref, m)
+	}, digest, nil
+}
+
+// extractWasm downloads the Wasm binary of the image. Two formats are supported:
+//   - the "compat" variant of the Wasm OCI image specification, where a layer holds the Wasm binary as is.
+//   - a Docker or OCI image with a single layer, holding the Wasm binary as its only file or as plugin.wasm.
+func (f *ImageFetcher) extractWasm(ref *oci.Reference, m *oci.Manifest) ([]byte, error) {
+	for _, l := range m.Layers {
+		if l.MediaType == wasmLayerMediaType {
+			return f.fetchBlob(ref, l)
+		}
+	}
+	if len(m.Layers) != 1 {
+		return nil, fmt.Errorf("image must have a single layer holding the Wasm binary, got %d layers", len(m.Layers))
+	}
+	b, err := f.fetchBlob(ref, m.Layers[0])
+	if err != nil {
+		return nil, err
+	}
+	return extractWasmFromLayer(b)
+}
+
+// extractWasmFromLayer extracts the Wasm binary from a (possibly gzipped) tar layer.
+func extractWasmFromLayer(layer []byte) ([]byte, error) {
+	var r io.Reader = bytes.NewReader(layer)
+	if gz, err := gzip.NewReader(bytes.NewReader(layer)); err == nil {
+		defer gz.Close()
+		r = gz
+	}
+	var files []string
+	var wasm []byte
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read image layer: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		files = append(files, hdr.Name)
+		if len(files) > 1 && path.Base(hdr.Name) != wasmFileName {
+			continue
+		}
+		b, err := oci.ReadAtMost(tr, maxWasmModuleSize, "module "+hdr.Name)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %v from image layer: %v", hdr.Name, err)
+		}
+		if path.Base(hdr.Name) == wasmFileName {
+			return b, nil
+		}
+		wasm = b
+	}
+	if len(files) != 1 {
+		return nil, fmt.Errorf("could not find %v in image layer holding files %v", wasmFileName, files)
+	}
+	return wasm, nil
+}
+
+func (f *ImageFetcher) fetchBlob(ref *oci.Reference, layer oci.Descriptor) ([]byte, error) {
+	if layer.Size > maxWasmModuleSize {
+		return nil, fmt.Errorf("layer %v is too large: %d bytes, more than %d bytes", layer.Digest, layer.Size, maxWasmModuleSize)
+	}
+	blob, err := f.client.FetchBlob(ref, layer)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+	return oci.ReadAtMost(blob, maxWasmModuleSize, "layer "+layer.Digest)
+}
@@ -0,0 +1,225 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/oci"
+	"istio.io/istio/pkg/oci/ocitest"
+)
+
+func TestImageFetcher(t *testing.T) {
+	wasm := []byte("\x00asm wasm binary")
+	cases := []struct {
+		name       string
+		layers     []ocitest.Layer
+		pullSecret string
+		auth       bool
+		wantErr    string
+	}{
+		{
+			name:   "wasm layer",
+			layers: []ocitest.Layer{{MediaType: wasmLayerMediaType, Data: wasm}},
+		},
+		{
+			name: "single file image",
+			layers: []ocitest.Layer{{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Data: ocitest.TarGz(t, map[string]string{
+				"filter.wasm": string(wasm),
+			})}},
+		},
+		{
+			name: "plugin.wasm in image",
+			layers: []ocitest.Layer{{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Data: ocitest.TarGz(t, map[string]string{
+				"README.md":   "readme",
+				"plugin.wasm": string(wasm),
+			})}},
+		},
+		{
+			name: "multiple files in image",
+			layers: []ocitest.Layer{{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Data: ocitest.TarGz(t, map[string]string{
+				"README.md":   "readme",
+				"filter.wasm": string(wasm),
+			})}},
+			wantErr: "could not find plugin.wasm",
+		},
+		{
+			name:       "pull secret",
+			layers:     []ocitest.Layer{{MediaType: wasmLayerMediaType, Data: wasm}},
+			auth:       true,
+			pullSecret: `{"auths":{"%s":{"auth":"dXNlcjpwYXNz"}}}`,
+		},
+		{
+			name:       "legacy pull secret",
+			layers:     []ocitest.Layer{{MediaType: wasmLayerMediaType, Data: wasm}},
+			auth:       true,
+			pullSecret: `{"http://%s/v1/":{"username":"user","password":"pass"}}`,
+		},
+		{
+			name:    "missing pull secret",
+			layers:  []ocitest.Layer{{MediaType: wasmLayerMediaType, Data: wasm}},
+			auth:    true,
+			wantErr: "could not get token",
+		},
+		{
+			name:       "wrong pull secret",
+			layers:     []ocitest.Layer{{MediaType: wasmLayerMediaType, Data: wasm}},
+			auth:       true,
+			pullSecret: `{"auths":{"%s":{"username":"user","password":"wrong"}}}`,
+			wantErr:    "could not get token",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := ocitest.NewRegistry(t, "ns/plugin")
+			if tt.auth {
+				registry.Username, registry.Password = "user", "pass"
+			}
+			wantDigest := registry.Push(t, "v1", tt.layers...)
+			var pullSecret []byte
+			if tt.pullSecret != "" {
+				pullSecret = []byte(fmt.Sprintf(tt.pullSecret, registry.Host()))
+			}
+
+			fetcher, err := NewImageFetcher(registry.Host(), pullSecret, true, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			binaryFetcher, digest, err := fetcher.PrepareFetch(fmt.Sprintf("oci://%s/ns/plugin:v1", registry.Host()))
+			if err == nil {
+				if digest != wantDigest {
+					t.Errorf("got digest %v, want %v", digest, wantDigest)
+				}
+				var got []byte
+				got, err = binaryFetcher()
+				if err == nil && !bytes.Equal(got, wasm) {
+					t.Errorf("got Wasm binary %q, want %q", got, wasm)
+				}
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got error %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestImageFetcherDigestMismatch(t *testing.T) {
+	registry := ocitest.NewRegistry(t, "ns/plugin")
+	registry.Push(t, "v1", ocitest.Layer{MediaType: wasmLayerMediaType, Data: []byte("wasm")})
+	registry.Manifests["sha256:0000"] = registry.Manifests["v1"]
+
+	fetcher, err := NewImageFetcher(registry.Host(), nil, true, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = fetcher.PrepareFetch(fmt.Sprintf("oci://%s/ns/plugin@sha256:0000", registry.Host()))
+	if err == nil || !strings.Contains(err.Error(), "does not match sha256:0000") {
+		t.Fatalf("got error %v, want digest mismatch", err)
+	}
+}
+
+func TestImageFetcherLayerTooLarge(t *testing.T) {
+	registry := ocitest.NewRegistry(t, "ns/plugin")
+	registry.Push(t, "v1", ocitest.Layer{MediaType: wasmLayerMediaType, Data: []byte("wasm")})
+	m := oci.Manifest{}
+	if err := json.Unmarshal(registry.Manifests["v1"], &m); err != nil {
+		t.Fatal(err)
+	}
+	m.Layers[0].Size = maxWasmModuleSize + 1
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Manifests["v1"] = b
+
+	fetcher, err := NewImageFetcher(registry.Host(), nil, true, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binaryFetcher, _, err := fetcher.PrepareFetch(fmt.Sprintf("oci://%s/ns/plugin:v1", registry.Host()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := binaryFetcher(); err == nil || !strings.Contains(err.Error(), "is too large") {
+		t.Fatalf("got error %v, want the layer to be too large", err)
+	}
+	if registry.BlobRequests != 0 {
+		t.Errorf("got %d blob requests, want none", registry.BlobRequests)
+	}
+}
+
+func TestWasmCacheImage(t *testing.T) {
+	registry := ocitest.NewRegistry(t, "ns/plugin")
+	digest := registry.Push(t, "v1", ocitest.Layer{MediaType: wasmLayerMediaType, Data: []byte("wasm")})
+	digestHex := strings.TrimPrefix(digest, "sha256:")
+	imageURL := fmt.Sprintf("oci://%s/ns/plugin:v1", registry.Host())
+
+	tmpDir := t.TempDir()
+	cache := NewLocalFileCache(tmpDir, DefaultWasmModulePurgeInteval, DefaultWasmModuleExpiry,
+		ImagePullOptions{InsecureRegistries: []string{registry.Host()}})
+	defer close(cache.stopChan)
+
+	wantFilePath := filepath.Join(tmpDir, digestHex+".wasm")
+	for i := 0; i < 2; i++ {
+		gotFilePath, err := cache.Get(imageURL, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotFilePath != wantFilePath {
+			t.Fatalf("got Wasm module path %v, want %v", gotFilePath, wantFilePath)
+		}
+	}
+	if b, err := ioutil.ReadFile(wantFilePath); err != nil || string(b) != "wasm" {
+		t.Fatalf("got Wasm module %q (%v), want %q", b, err, "wasm")
+	}
+	// The second lookup resolves the tag to the same digest, so the module is not pulled again.
+	if registry.BlobRequests != 1 {
+		t.Errorf("got %d blob requests, want 1", registry.BlobRequests)
+	}
+
+	// A pinned digest is served from the cache without contacting the registry.
+	registry.Close()
+	if gotFilePath, err := cache.Get(imageURL, "sha256:"+digestHex, 0); err != nil || gotFilePath != wantFilePath {
+		t.Fatalf("got Wasm module path %v (%v), want %v", gotFilePath, err, wantFilePath)
+	}
+
+	if _, err := cache.Get(imageURL, "0000", 0); err == nil {
+		t.Fatalf("expected error for unavailable registry")
+	}
+}
+
+func TestWasmCacheImageChecksumMismatch(t *testing.T) {
+	registry := ocitest.NewRegistry(t, "ns/plugin")
+	registry.Push(t, "v1", ocitest.Layer{MediaType: wasmLayerMediaType, Data: []byte("wasm")})
+
+	cache := NewLocalFileCache(t.TempDir(), DefaultWasmModulePurgeInteval, DefaultWasmModuleExpiry,
+		ImagePullOptions{InsecureRegistries: []string{registry.Host()}})
+	defer close(cache.stopChan)
+
+	_, err := cache.Get(fmt.Sprintf("oci://%s/ns/plugin:v1", registry.Host()), "0000", 0)
+	if err == nil || !strings.Contains(err.Error(), "which does not match: 0000") {
+		t.Fatalf("got error %v, want digest mismatch", err)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package csrsigner implements a Kubernetes CertificateSigningRequest signer backed by the mesh CA, so that
+// workloads outside of the mesh can get mesh-trusted certificates through the Kubernetes CSR API.
+package csrsigner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	certv1 "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"istio.io/istio/pkg/queue"
+	"istio.io/istio/pkg/spiffe"
+	"istio.io/istio/security/pkg/pki/util"
+	caserver "istio.io/istio/security/pkg/server/ca"
+	"istio.io/pkg/log"
+)
+
+var signerLog = log.RegisterScope("csrsigner", "Kubernetes CSR signer debugging", 0)
+
+const serviceAccountUsernamePrefix = "system:serviceaccount:"
+
+// allowedUsages are the key usages a workload certificate may request.
+var allowedUsages = map[certv1.KeyUsage]bool{
+	certv1.UsageDigitalSignature: true,
+	certv1.UsageKeyEncipherment:  true,
+	certv1.UsageServerAuth:       true,
+	certv1.UsageClientAuth:       true,
+}
+
+// Options configures the signer.
+type Options struct {
+	// SignerNames are the signer names of the CSRs to sign.
+	SignerNames []string
+	// TrustDomain is the trust domain of the identities in the certificates.
+	TrustDomain string
+	// CertTTL is the lifetime of the issued certificates. The CA default applies if 0.
+	CertTTL time.Duration
+	// AutoApprove approves the valid CSRs and denies the invalid ones. If false, the CSRs must be approved by
+	// another approver before they are signed.
+	AutoApprove bool
+}
+
+// Controller signs the CSRs of the configured signer names with the mesh CA. A CSR is signed when it is requested
+// by a service account, and its only SAN is the SPIFFE identity of that service account.
+type Controller struct {
+	client  kubernetes.Interface
+	ca      caserver.CertificateAuthority
+	opts    Options
+	signers map[string]bool
+	queue   queue.Instance
+}
+
+// NewController creates a CSR signer.
+func NewController(client kubernetes.Interface, ca caserver.CertificateAuthority, opts Options) *Controller {
+	signers := map[string]bool{}
+	for _, name := range opts.SignerNames {
+		signers[name] = true
+	}
+	return &Controller{
+		client:  client,
+		ca:      ca,
+		opts:    opts,
+		signers: signers,
+		queue:   queue.NewQueue(time.Second),
+	}
+}
+
+// Run runs the signer until the stop channel is closed.
+func (c *Controller) Run(stop <-chan struct{}) {
+	csrs := c.client.CertificatesV1().CertificateSigningRequests()
+	_, informer := cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return csrs.List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return csrs.Watch(context.TODO(), options)
+			},
+		},
+		&certv1.CertificateSigningRequest{},
+		0,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				c.enqueue(obj.(*certv1.CertificateSigningRequest))
+			},
+			UpdateFunc: func(_, obj interface{}) {
+				c.enqueue(obj.(*certv1.CertificateSigningRequest))
+			},
+		},
+	)
+	go c.queue.Run(stop)
+	signerLog.Infof("signing the CSRs of signers %v", c.opts.SignerNames)
+	informer.Run(stop)
+}
+
+func (c *Controller) enqueue(csr *certv1.CertificateSigningRequest) {
+	if !c.signers[csr.Spec.SignerName] || len(csr.Status.Certificate) > 0 || finished(csr) {
+		return
+	}
+	name := csr.Name
+	c.queue.Push(func() error {
+		return c.reconcile(name)
+	})
+}
+
+// reconcile approves or denies, then signs the CSR.
+func (c *Controller) reconcile(name string) error {
+	csrs := c.client.CertificatesV1().CertificateSigningRequests()
+	csr, err := csrs.Get(context.TODO(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !c.signers[csr.Spec.SignerName] || len(csr.Status.Certificate) > 0 || finished(csr) {
+		return nil
+	}
+
+	identity, reason := c.validate(csr)
+	if reason != "" {
+		signerLog.Infof("rejecting CSR %s: %s", name, reason)
+		if approved(csr) {
+			return c.setCondition(csr, certv1.CertificateFailed, "InvalidRequest", reason)
+		}
+		if c.opts.AutoApprove {
+			return c.setCondition(csr, certv1.CertificateDenied, "InvalidRequest", reason)
+		}
+		return nil
+	}
+	if !approved(csr) {
+		if !c.opts.AutoApprove {
+			return nil
+		}
+		if err := c.setCondition(csr, certv1.CertificateApproved, "AutoApproved",
+			fmt.Sprintf("Approved for identity %s", identity)); err != nil {
+			return err
+		}
+		// Signing is triggered by the update of the CSR.
+		return nil
+	}
+
+	certChain, err := c.ca.SignWithCertChain(csr.Spec.Request, []string{identity}, c.opts.CertTTL, false)
+	if err != nil {
+		signerLog.Errorf("failed to sign CSR %s: %v", name, err)
+		return c.setCondition(csr, certv1.CertificateFailed, "SigningError", err.Error())
+	}
+	csr = csr.DeepCopy()
+	csr.Status.Certificate = certChain
+	if _, err := csrs.UpdateStatus(context.TODO(), csr, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to write the certificate of CSR %s: %v", name, err)
+	}
+	signerLog.Infof("signed CSR %s for identity %s", name, identity)
+	return nil
+}
+
+// validate returns the identity to sign the CSR for, or the reason it cannot be signed.
+func (c *Controller) validate(csr *certv1.CertificateSigningRequest) (string, string) {
+	if !strings.HasPrefix(csr.Spec.Username, serviceAccountUsernamePrefix) {
+		return "", fmt.Sprintf("requester %s is not a service account", csr.Spec.Username)
+	}
+	parts := strings.Split(strings.TrimPrefix(csr.Spec.Username, serviceAccountUsernamePrefix), ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Sprintf("invalid service account username %s", csr.Spec.Username)
+	}
+	identity := spiffe.Identity{TrustDomain: c.opts.TrustDomain, Namespace: parts[0], ServiceAccount: parts[1]}.String()
+
+	for _, usage := range csr.Spec.Usages {
+		if !allowedUsages[usage] {
+			return "", fmt.Sprintf("usage %q is not allowed", usage)
+		}
+	}
+	request, err := util.ParsePemEncodedCSR(csr.Spec.Request)
+	if err != nil {
+		return "", fmt.Sprintf("invalid request: %v", err)
+	}
+	if err := request.CheckSignature(); err != nil {
+		return "", fmt.Sprintf("invalid request signature: %v", err)
+	}
+	ids, err := util.ExtractIDs(request.Extensions)
+	if err != nil {
+		return "", fmt.Sprintf("invalid SAN: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != identity {
+		return "", fmt.Sprintf("requested SANs %v do not match the identity %s of the requester", ids, identity)
+	}
+	return identity, ""
+}
+
+// setCondition adds the condition to the CSR, through the approval subresource for approvals and denials.
+func (c *Controller) setCondition(csr *certv1.CertificateSigningRequest, conditionType certv1.RequestConditionType,
+	reason, message string) error {
+	csr = csr.DeepCopy()
+	csr.Status.Conditions = append(csr.Status.Conditions, certv1.CertificateSigningRequestCondition{
+		Type:               conditionType,
+		Status:             v1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		LastUpdateTime:     metav1.Now(),
+		LastTransitionTime: metav1.Now(),
+	})
+	csrs := c.client.CertificatesV1().CertificateSigningRequests()
+	var err error
+	if conditionType == certv1.CertificateApproved || conditionType == certv1.CertificateDenied {
+		_, err = csrs.UpdateApproval(context.TODO(), csr.Name, csr, metav1.UpdateOptions{})
+	} else {
+		_, err = csrs.UpdateStatus(context.TODO(), csr, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set the %s condition of CSR %s: %v", conditionType, csr.Name, err)
+	}
+	return nil
+}
+
+func hasCondition(csr *certv1.CertificateSigningRequest, conditionType certv1.RequestConditionType) bool {
+	for _, cond := range csr.Status.Conditions {
+		if cond.Type == conditionType && cond.Status != v1.ConditionFalse {
+			return true
+		}
+	}
+	return false
+}
+
+func approved(csr *certv1.CertificateSigningRequest) bool {
+	return hasCondition(csr, certv1.CertificateApproved)
+}
+
+// finished returns whether the CSR was denied or failed.
+func finished(csr *certv1.CertificateSigningRequest) bool {
+	return hasCondition(csr, certv1.CertificateDenied) || hasCondition(csr, certv1.CertificateFailed)
+}
@@ -0,0 +1,226 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csrsigner
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	certv1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"istio.io/istio/pkg/test/util/retry"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+const (
+	testSigner   = "istio.io/mesh"
+	testIdentity = "spiffe://cluster.local/ns/foo/sa/bar"
+	testUsername = "system:serviceaccount:foo:bar"
+)
+
+type fakeCA struct {
+	signedIDs [][]string
+}
+
+func (f *fakeCA) Sign(csrPEM []byte, subjectIDs []string, ttl time.Duration, forCA bool) ([]byte, error) {
+	f.signedIDs = append(f.signedIDs, subjectIDs)
+	return []byte("cert"), nil
+}
+
+func (f *fakeCA) SignWithCertChain(csrPEM []byte, subjectIDs []string, ttl time.Duration, forCA bool) ([]byte, error) {
+	cert, _ := f.Sign(csrPEM, subjectIDs, ttl, forCA)
+	return append(cert, []byte("chain")...), nil
+}
+
+func (f *fakeCA) GetCAKeyCertBundle() *util.KeyCertBundle {
+	return nil
+}
+
+func genCSR(t *testing.T, host string) []byte {
+	t.Helper()
+	csr, _, err := util.GenCSR(util.CertOptions{Host: host, RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
+
+func newCSR(name, signer, username string, request []byte, usages ...certv1.KeyUsage) *certv1.CertificateSigningRequest {
+	if len(usages) == 0 {
+		usages = []certv1.KeyUsage{certv1.UsageDigitalSignature, certv1.UsageKeyEncipherment, certv1.UsageClientAuth}
+	}
+	return &certv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: certv1.CertificateSigningRequestSpec{
+			SignerName: signer,
+			Username:   username,
+			Request:    request,
+			Usages:     usages,
+		},
+	}
+}
+
+func getCSR(t *testing.T, client *fake.Clientset, name string) *certv1.CertificateSigningRequest {
+	t.Helper()
+	csr, err := client.CertificatesV1().CertificateSigningRequests().Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
+
+func TestReconcile(t *testing.T) {
+	validRequest := genCSR(t, testIdentity)
+	cases := []struct {
+		name        string
+		csr         *certv1.CertificateSigningRequest
+		autoApprove bool
+		wantCert    bool
+		wantCond    certv1.RequestConditionType
+		wantReason  string
+	}{
+		{
+			name:        "valid request",
+			csr:         newCSR("valid", testSigner, testUsername, validRequest),
+			autoApprove: true,
+			wantCert:    true,
+			wantCond:    certv1.CertificateApproved,
+		},
+		{
+			name:        "other signer",
+			csr:         newCSR("other", "example.com/signer", testUsername, validRequest),
+			autoApprove: true,
+		},
+		{
+			name:        "not a service account",
+			csr:         newCSR("user", testSigner, "alice", validRequest),
+			autoApprove: true,
+			wantCond:    certv1.CertificateDenied,
+			wantReason:  "is not a service account",
+		},
+		{
+			name:        "identity of another service account",
+			csr:         newCSR("impersonation", testSigner, "system:serviceaccount:foo:other", validRequest),
+			autoApprove: true,
+			wantCond:    certv1.CertificateDenied,
+			wantReason:  "do not match the identity spiffe://cluster.local/ns/foo/sa/other",
+		},
+		{
+			name: "extra DNS SAN",
+			csr: newCSR("dns", testSigner, testUsername,
+				genCSR(t, testIdentity+",bar.foo.svc.cluster.local")),
+			autoApprove: true,
+			wantCond:    certv1.CertificateDenied,
+			wantReason:  "do not match",
+		},
+		{
+			name: "CA usage",
+			csr: newCSR("ca", testSigner, testUsername, validRequest,
+				certv1.UsageDigitalSignature, certv1.UsageCertSign),
+			autoApprove: true,
+			wantCond:    certv1.CertificateDenied,
+			wantReason:  `usage "cert sign" is not allowed`,
+		},
+		{
+			name: "awaiting approval",
+			csr:  newCSR("pending", testSigner, testUsername, validRequest),
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(tt.csr)
+			ca := &fakeCA{}
+			c := NewController(client, ca, Options{
+				SignerNames: []string{testSigner},
+				TrustDomain: "cluster.local",
+				AutoApprove: tt.autoApprove,
+			})
+			// The first pass approves or denies the CSR, the second one signs it.
+			for i := 0; i < 2; i++ {
+				if err := c.reconcile(tt.csr.Name); err != nil {
+					t.Fatal(err)
+				}
+			}
+			csr := getCSR(t, client, tt.csr.Name)
+			if got := len(csr.Status.Certificate) > 0; got != tt.wantCert {
+				t.Errorf("got certificate %q, want certificate: %v", csr.Status.Certificate, tt.wantCert)
+			}
+			if tt.wantCert {
+				if string(csr.Status.Certificate) != "certchain" {
+					t.Errorf("unexpected certificate %q", csr.Status.Certificate)
+				}
+				if !reflect.DeepEqual(ca.signedIDs, [][]string{{testIdentity}}) {
+					t.Errorf("unexpected signed identities %v", ca.signedIDs)
+				}
+			}
+			if tt.wantCond == "" {
+				if len(csr.Status.Conditions) != 0 {
+					t.Errorf("unexpected conditions %v", csr.Status.Conditions)
+				}
+				return
+			}
+			if !hasCondition(csr, tt.wantCond) {
+				t.Fatalf("expected condition %v, got %v", tt.wantCond, csr.Status.Conditions)
+			}
+			if tt.wantReason != "" && !strings.Contains(csr.Status.Conditions[0].Message, tt.wantReason) {
+				t.Errorf("got message %q, want %q", csr.Status.Conditions[0].Message, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestReconcileApprovedInvalidRequest(t *testing.T) {
+	csr := newCSR("invalid", testSigner, "alice", genCSR(t, testIdentity))
+	csr.Status.Conditions = []certv1.CertificateSigningRequestCondition{{Type: certv1.CertificateApproved, Status: "True"}}
+	client := fake.NewSimpleClientset(csr)
+	c := NewController(client, &fakeCA{}, Options{SignerNames: []string{testSigner}, TrustDomain: "cluster.local"})
+	if err := c.reconcile(csr.Name); err != nil {
+		t.Fatal(err)
+	}
+	if got := getCSR(t, client, csr.Name); !hasCondition(got, certv1.CertificateFailed) || len(got.Status.Certificate) > 0 {
+		t.Errorf("expected the CSR approved by another approver to fail, got %+v", got.Status)
+	}
+}
+
+func TestControllerRun(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	c := NewController(client, &fakeCA{}, Options{
+		SignerNames: []string{testSigner},
+		TrustDomain: "cluster.local",
+		AutoApprove: true,
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.Run(stop)
+
+	csrs := client.CertificatesV1().CertificateSigningRequests()
+	if _, err := csrs.Create(context.TODO(), newCSR("csr", testSigner, testUsername, genCSR(t, testIdentity)),
+		metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		csr := getCSR(t, client, "csr")
+		if len(csr.Status.Certificate) == 0 {
+			return fmt.Errorf("CSR not signed yet: %+v", csr.Status)
+		}
+		return nil
+	}, retry.Timeout(10*time.Second))
+}
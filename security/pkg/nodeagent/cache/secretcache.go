@@ -113,6 +113,10 @@ type SecretManagerClient struct {
 	// Dynamically configured Trust Bundle
 	configTrustBundle []byte
 
+	// crlMutex protects the certificate revocation list of the CA, received from istiod
+	crlMutex sync.RWMutex
+	crl      []byte
+
 	// queue maintains all certificate rotation events that need to be triggered when they are about to expire
 	queue queue.Delayed
 	stop  chan struct{}
@@ -220,6 +224,7 @@ func (sc *SecretManagerClient) getCachedSecret(resourceName string) (secret *sec
 			ns = &security.SecretItem{
 				ResourceName: resourceName,
 				RootCert:     rootCertBundle,
+				CRL:          sc.getCRL(),
 			}
 			cacheLog.WithLabels("ttl", time.Until(c.ExpireTime)).Info("returned workload trust anchor from cache")
 
@@ -301,6 +306,7 @@ func (sc *SecretManagerClient) GenerateSecret(resourceName string) (secret *secu
 
 	if resourceName == security.RootCertReqResourceName {
 		ns.RootCert = sc.mergeConfigTrustBundle(ns.RootCert)
+		ns.CRL = sc.getCRL()
 	} else {
 		// If periodic cert refresh resulted in discovery of a new root, trigger a ROOTCA request to refresh trust anchor
 		oldRoot := sc.cache.GetRoot()
@@ -713,3 +719,23 @@ func (sc *SecretManagerClient) UpdateConfigTrustBundle(trustBundle []byte) error
 func (sc *SecretManagerClient) mergeConfigTrustBundle(rootCert []byte) []byte {
 	return pkiutil.AppendCertByte(sc.getConfigTrustBundle(), rootCert)
 }
+
+func (sc *SecretManagerClient) getCRL() []byte {
+	sc.crlMutex.RLock()
+	defer sc.crlMutex.RUnlock()
+	return sc.crl
+}
+
+// UpdateCRL updates the certificate revocation list of the CA, sent to the proxy with the root cert. An empty CRL
+// removes it.
+func (sc *SecretManagerClient) UpdateCRL(crl []byte) error {
+	sc.crlMutex.Lock()
+	if bytes.Equal(sc.crl, crl) {
+		sc.crlMutex.Unlock()
+		return nil
+	}
+	sc.crl = crl
+	sc.crlMutex.Unlock()
+	sc.CallUpdateCallback(security.RootCertReqResourceName)
+	return nil
+}
@@ -479,6 +479,9 @@ func verifySecret(t *testing.T, gotSecret *security.SecretItem, expectedSecret *
 			t.Fatalf("root cert: expected %v but got %v", expectedSecret.RootCert,
 				gotSecret.RootCert)
 		}
+		if !bytes.Equal(expectedSecret.CRL, gotSecret.CRL) {
+			t.Fatalf("crl: expected %s but got %s", string(expectedSecret.CRL), string(gotSecret.CRL))
+		}
 	} else {
 		if !bytes.Equal(expectedSecret.CertificateChain, gotSecret.CertificateChain) {
 			t.Fatalf("cert chain: expected %s but got %s", string(expectedSecret.CertificateChain),
@@ -594,3 +597,54 @@ func TestProxyConfigAnchors(t *testing.T) {
 		RootCert:     rootCert,
 	})
 }
+
+func TestCRL(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	u := NewUpdateTracker(t)
+
+	sc := createCache(t, fakeCACli, u.Callback, security.Options{})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+	u.Reset()
+	caClientRootCert := []byte(fakeCACli.GeneratedCerts[0][2])
+
+	crl := []byte("-----BEGIN X509 CRL-----\ncrl\n-----END X509 CRL-----\n")
+	if err := sc.UpdateCRL(crl); err != nil {
+		t.Fatal(err)
+	}
+	// Ensure Callback gets invoked when the CRL changes, and only then
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+	if err := sc.UpdateCRL(crl); err != nil {
+		t.Fatal(err)
+	}
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+	u.Reset()
+
+	checkSecret(t, sc, security.RootCertReqResourceName, security.SecretItem{
+		ResourceName: security.RootCertReqResourceName,
+		RootCert:     caClientRootCert,
+		CRL:          crl,
+	})
+	// The CRL is only sent with the root cert
+	workload, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workload.CRL) != 0 {
+		t.Errorf("expected no CRL with the workload certificate, got %q", workload.CRL)
+	}
+
+	if err := sc.UpdateCRL(nil); err != nil {
+		t.Fatal(err)
+	}
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+	checkSecret(t, sc, security.RootCertReqResourceName, security.SecretItem{
+		ResourceName: security.RootCertReqResourceName,
+		RootCert:     caClientRootCert,
+	})
+}
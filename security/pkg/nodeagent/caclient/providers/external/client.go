@@ -0,0 +1,182 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package caclient implements the ExternalCA provider, which lets the agent get its workload certificates from a
+// CA outside of the mesh.
+//
+// The CA must implement the Istio certificate service (istio.v1.auth.IstioCertificateService in
+// istio.io/api/security/v1alpha1), a single unary gRPC method:
+//
+//	rpc CreateCertificate(IstioCertificateRequest) returns (IstioCertificateResponse)
+//
+// The request holds the PEM encoded CSR, with the SPIFFE identity of the workload as URI SAN, and the requested
+// certificate lifetime in seconds. The response holds the certificate chain, as PEM encoded certificates: the
+// workload certificate first, then the intermediates if any, and the root certificate last.
+//
+// The agent always connects to the CA over TLS, verifying the CA certificate with CA_ROOT_CA or the system roots.
+// It authenticates with the CA with any of:
+//   - the workload JWT, as an "authorization: Bearer <token>" header, when one is available
+//   - custom gRPC metadata set with CA_HEADERS, which take precedence over the JWT
+//   - a client certificate set with CA_CLIENT_CERT and CA_CLIENT_KEY
+//
+// The ClusterID of the workload is sent as "clusterid" metadata.
+package caclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	pb "istio.io/api/security/v1alpha1"
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient"
+	"istio.io/pkg/log"
+)
+
+var externalCAClientLog = log.RegisterScope("externalca", "external CA client debugging", 0)
+
+// ExternalCAClient is a CA client for a CA implementing the Istio certificate service at an arbitrary endpoint.
+type ExternalCAClient struct {
+	opts   *security.Options
+	conn   *grpc.ClientConn
+	client pb.IstioCertificateServiceClient
+}
+
+var _ security.Client = &ExternalCAClient{}
+
+// NewExternalCAClient creates a CA client for an external CA. The CA certificate is verified with rootCert, or with
+// the system roots if nil.
+func NewExternalCAClient(opts *security.Options, rootCert []byte) (*ExternalCAClient, error) {
+	if (opts.CAClientCertFile == "") != (opts.CAClientKeyFile == "") {
+		return nil, errors.New("the client certificate and key of the external CA must be set together")
+	}
+	tlsOpt, err := getTLSDialOption(opts, rootCert)
+	if err != nil {
+		return nil, err
+	}
+	creds := &headerCredentials{headers: opts.CAHeaders}
+	if opts.CASendWorkloadToken {
+		creds.token = caclient.NewCATokenProvider(opts)
+	}
+	conn, err := grpc.Dial(opts.CAEndpoint,
+		tlsOpt,
+		grpc.WithPerRPCCredentials(creds),
+		security.CARetryInterceptor())
+	if err != nil {
+		externalCAClientLog.Errorf("Failed to connect to endpoint %s: %v", opts.CAEndpoint, err)
+		return nil, fmt.Errorf("failed to connect to endpoint %s", opts.CAEndpoint)
+	}
+	return &ExternalCAClient{
+		opts:   opts,
+		conn:   conn,
+		client: pb.NewIstioCertificateServiceClient(conn),
+	}, nil
+}
+
+// CSRSign calls the external CA to sign a CSR.
+func (c *ExternalCAClient) CSRSign(csrPEM []byte, certValidTTLInSec int64) ([]string, error) {
+	req := &pb.IstioCertificateRequest{
+		Csr:              string(csrPEM),
+		ValidityDuration: certValidTTLInSec,
+	}
+	ctx := context.Background()
+	if c.opts.ClusterID != "" {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("ClusterID", c.opts.ClusterID))
+	}
+	resp, err := c.client.CreateCertificate(ctx, req)
+	if err != nil {
+		externalCAClientLog.Errorf("Failed to create certificate: %v", err)
+		return nil, fmt.Errorf("create certificate: %v", err)
+	}
+	if len(resp.CertChain) <= 1 {
+		externalCAClientLog.Errorf("CertChain length is %d, expected more than 1", len(resp.CertChain))
+		return nil, errors.New("invalid response cert chain")
+	}
+	return resp.CertChain, nil
+}
+
+// Close closes the connection to the external CA.
+func (c *ExternalCAClient) Close() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+func getTLSDialOption(opts *security.Options, rootCert []byte) (grpc.DialOption, error) {
+	var certPool *x509.CertPool
+	var err error
+	if rootCert == nil {
+		if certPool, err = x509.SystemCertPool(); err != nil {
+			return nil, err
+		}
+		externalCAClientLog.Infof("External CA client using system roots: %s", opts.CAEndpoint)
+	} else {
+		certPool = x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(rootCert) {
+			return nil, errors.New("failed to append certificates")
+		}
+		externalCAClientLog.Infof("External CA client using custom root cert: %s", opts.CAEndpoint)
+	}
+	config := &tls.Config{
+		RootCAs:    certPool,
+		ServerName: opts.CATLSServerName,
+	}
+	if opts.CAClientCertFile != "" {
+		// Load the client certificate on each handshake, so that it can be rotated on disk.
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(opts.CAClientCertFile, opts.CAClientKeyFile)
+			if err != nil {
+				externalCAClientLog.Warnf("cannot load the client certificate of the external CA: %v", err)
+				return &tls.Certificate{}, nil
+			}
+			return &cert, nil
+		}
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(config)), nil
+}
+
+// headerCredentials attaches the custom headers, and the workload token if enabled, to each call.
+type headerCredentials struct {
+	headers map[string]string
+	// token is nil unless the workload token is sent to the CA.
+	token *caclient.TokenProvider
+}
+
+var _ credentials.PerRPCCredentials = &headerCredentials{}
+
+func (h *headerCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	tokenMD, err := h.token.GetRequestMetadata(ctx, uri...)
+	if err != nil {
+		return nil, err
+	}
+	md := make(map[string]string, len(tokenMD)+len(h.headers))
+	for k, v := range tokenMD {
+		md[k] = v
+	}
+	for k, v := range h.headers {
+		md[k] = v
+	}
+	return md, nil
+}
+
+// RequireTransportSecurity returns true, the headers may hold credentials.
+func (h *headerCredentials) RequireTransportSecurity() bool {
+	return true
+}
@@ -0,0 +1,209 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"crypto/x509"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/nodeagent/caclient"
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/external/server"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+const testIdentity = "spiffe://cluster.local/ns/default/sa/test"
+
+// writeClientCerts writes a client CA and a client certificate signed by it, and returns their paths.
+func writeClientCerts(t *testing.T) (caFile, certFile, keyFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	caPem, caKeyPem, err := util.GenCertKeyFromOptions(util.CertOptions{
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		Org:          "client CA",
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := util.ParsePemEncodedCertificate(caPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := util.ParsePemEncodedKey(caKeyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem, keyPem, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Host:       "agent.example.com",
+		TTL:        time.Hour,
+		IsClient:   true,
+		RSAKeySize: 2048,
+		SignerCert: caCert,
+		SignerPriv: caKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile, certFile, keyFile = filepath.Join(dir, "ca.pem"), filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	for f, data := range map[string][]byte{caFile: caPem, certFile: certPem, keyFile: keyPem} {
+		if err := ioutil.WriteFile(f, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return caFile, certFile, keyFile
+}
+
+func genCSR(t *testing.T) []byte {
+	t.Helper()
+	csr, _, err := util.GenCSR(util.CertOptions{Host: testIdentity, RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
+
+func TestExternalCAClient(t *testing.T) {
+	clientCA, clientCert, clientKey := writeClientCerts(t)
+	ca, err := server.New(server.Options{
+		ClientCAFile:    clientCA,
+		RequiredHeaders: map[string]string{"x-api-key": "secret"},
+		MaxTTL:          time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.Start("localhost:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Stop()
+
+	cases := []struct {
+		name    string
+		opts    security.Options
+		wantErr string
+	}{
+		{
+			name: "headers and mTLS",
+			opts: security.Options{
+				CAHeaders:        map[string]string{"x-api-key": "secret"},
+				CAClientCertFile: clientCert,
+				CAClientKeyFile:  clientKey,
+			},
+		},
+		{
+			name: "missing header",
+			opts: security.Options{
+				CAClientCertFile: clientCert,
+				CAClientKeyFile:  clientKey,
+			},
+			wantErr: `missing or invalid "x-api-key" header`,
+		},
+		{
+			name: "missing client certificate",
+			opts: security.Options{
+				CAHeaders: map[string]string{"x-api-key": "secret"},
+			},
+			wantErr: "create certificate",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.CAEndpoint = ca.Address()
+			opts.ClusterID = "cluster1"
+			client, err := NewExternalCAClient(&opts, ca.RootCertPem())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			chain, err := client.CSRSign(genCSR(t), 7200)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chain) != 2 || chain[1] != string(ca.RootCertPem()) {
+				t.Fatalf("unexpected chain %v", chain)
+			}
+			cert, err := util.ParsePemEncodedCertificate([]byte(chain[0]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cert.URIs) != 1 || cert.URIs[0].String() != testIdentity {
+				t.Errorf("unexpected identities %v", cert.URIs)
+			}
+			if ttl := cert.NotAfter.Sub(cert.NotBefore); ttl > time.Hour+time.Minute {
+				t.Errorf("expected the lifetime to be capped to 1h, got %v", ttl)
+			}
+			roots := x509.NewCertPool()
+			roots.AppendCertsFromPEM(ca.RootCertPem())
+			if _, err := cert.Verify(x509.VerifyOptions{
+				Roots:     roots,
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			}); err != nil {
+				t.Errorf("the certificate is not signed by the CA: %v", err)
+			}
+		})
+	}
+	if ca.Requests() != 1 {
+		t.Errorf("got %d issued certificates, want 1", ca.Requests())
+	}
+}
+
+func TestExternalCAClientInvalidOptions(t *testing.T) {
+	if _, err := NewExternalCAClient(&security.Options{CAEndpoint: "localhost:0", CAClientCertFile: "cert.pem"}, nil); err == nil {
+		t.Error("expected an error for a client certificate without key")
+	}
+}
+
+func TestHeaderCredentialsWorkloadToken(t *testing.T) {
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(jwtPath, []byte("workload-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{"x-api-key": "secret"}
+	opts := &security.Options{JWTPath: jwtPath}
+
+	// The workload token is only sent if enabled.
+	got, err := (&headerCredentials{headers: headers}).GetRequestMetadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, headers) {
+		t.Errorf("got metadata %v, want %v", got, headers)
+	}
+
+	got, err = (&headerCredentials{headers: headers, token: caclient.NewCATokenProvider(opts)}).GetRequestMetadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"x-api-key": "secret", "authorization": "Bearer workload-token"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got metadata %v, want %v", got, want)
+	}
+}
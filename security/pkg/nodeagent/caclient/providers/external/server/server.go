@@ -0,0 +1,234 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server implements a stand-in external CA, serving the Istio certificate service with a local signing
+// certificate. It is meant to test the ExternalCA provider of the agent, and to develop against before plugging in
+// the real CA.
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "istio.io/api/security/v1alpha1"
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/log"
+)
+
+var serverLog = log.RegisterScope("externalcaserver", "stand-in external CA server debugging", 0)
+
+// Options configures the stand-in CA.
+type Options struct {
+	// SigningCertFile and SigningKeyFile are the PEM encoded CA certificate and key. A self-signed root is
+	// generated if not set.
+	SigningCertFile string
+	SigningKeyFile  string
+
+	// TLSCertFile and TLSKeyFile are the serving certificate and key. If not set, a certificate for localhost
+	// signed by the CA is generated.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// ClientCAFile holds the roots used to verify client certificates. Client certificates are required if set.
+	ClientCAFile string
+
+	// RequiredHeaders are the gRPC metadata every request must carry, with their values.
+	RequiredHeaders map[string]string
+
+	// MaxTTL caps the lifetime of the issued certificates. Defaults to 24 hours.
+	MaxTTL time.Duration
+}
+
+// Server is the stand-in external CA.
+type Server struct {
+	opts       Options
+	signer     *x509.Certificate
+	signerKey  crypto.PrivateKey
+	signerPem  []byte
+	grpcServer *grpc.Server
+	address    string
+
+	mu       sync.Mutex
+	requests int
+}
+
+// New creates a stand-in CA.
+func New(opts Options) (*Server, error) {
+	if opts.MaxTTL == 0 {
+		opts.MaxTTL = 24 * time.Hour
+	}
+	s := &Server{opts: opts}
+	var err error
+	if opts.SigningCertFile != "" {
+		if s.signerPem, err = ioutil.ReadFile(opts.SigningCertFile); err != nil {
+			return nil, err
+		}
+		if s.signer, s.signerKey, err = util.LoadSignerCredsFromFiles(opts.SigningCertFile, opts.SigningKeyFile); err != nil {
+			return nil, err
+		}
+	} else {
+		var keyPem []byte
+		s.signerPem, keyPem, err = util.GenCertKeyFromOptions(util.CertOptions{
+			IsCA:         true,
+			IsSelfSigned: true,
+			TTL:          365 * 24 * time.Hour,
+			Org:          "Stand-in External CA",
+			RSAKeySize:   2048,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate the CA certificate: %v", err)
+		}
+		if s.signer, err = util.ParsePemEncodedCertificate(s.signerPem); err != nil {
+			return nil, err
+		}
+		if s.signerKey, err = util.ParsePemEncodedKey(keyPem); err != nil {
+			return nil, err
+		}
+	}
+
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	s.grpcServer = grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	pb.RegisterIstioCertificateServiceServer(s.grpcServer, s)
+	return s, nil
+}
+
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	if s.opts.TLSCertFile != "" {
+		if cert, err = tls.LoadX509KeyPair(s.opts.TLSCertFile, s.opts.TLSKeyFile); err != nil {
+			return nil, err
+		}
+	} else {
+		certPem, keyPem, err := util.GenCertKeyFromOptions(util.CertOptions{
+			Host:       "localhost,127.0.0.1",
+			TTL:        365 * 24 * time.Hour,
+			IsServer:   true,
+			RSAKeySize: 2048,
+			SignerCert: s.signer,
+			SignerPriv: s.signerKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate the serving certificate: %v", err)
+		}
+		if cert, err = tls.X509KeyPair(certPem, keyPem); err != nil {
+			return nil, err
+		}
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if s.opts.ClientCAFile != "" {
+		roots, err := ioutil.ReadFile(s.opts.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(roots) {
+			return nil, fmt.Errorf("no certificates found in %s", s.opts.ClientCAFile)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// Start serves the CA on the address, in the background.
+func (s *Server) Start(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+	s.address = lis.Addr().String()
+	go func() {
+		if err := s.grpcServer.Serve(lis); err != nil {
+			serverLog.Errorf("stand-in CA stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop stops the CA.
+func (s *Server) Stop() {
+	s.grpcServer.Stop()
+}
+
+// Address returns the address the CA listens on.
+func (s *Server) Address() string {
+	return s.address
+}
+
+// RootCertPem returns the CA certificate, which verifies both the serving and the issued certificates unless a
+// serving certificate is set.
+func (s *Server) RootCertPem() []byte {
+	return s.signerPem
+}
+
+// Requests returns the number of certificates issued.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// CreateCertificate signs the CSR with the identities of its SAN.
+func (s *Server) CreateCertificate(ctx context.Context, req *pb.IstioCertificateRequest) (
+	*pb.IstioCertificateResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, v := range s.opts.RequiredHeaders {
+		if got := md.Get(k); len(got) == 0 || got[0] != v {
+			return nil, status.Errorf(codes.Unauthenticated, "missing or invalid %q header", k)
+		}
+	}
+	csr, err := util.ParsePemEncodedCSR([]byte(req.Csr))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid CSR: %v", err)
+	}
+	ids, err := util.ExtractIDs(csr.Extensions)
+	if err != nil || len(ids) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "the CSR has no identity: %v", err)
+	}
+	ttl := time.Duration(req.ValidityDuration) * time.Second
+	if ttl <= 0 || ttl > s.opts.MaxTTL {
+		ttl = s.opts.MaxTTL
+	}
+	der, err := util.GenCertFromCSR(csr, s.signer, csr.PublicKey, s.signerKey, ids, ttl, false)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to sign the CSR: %v", err)
+	}
+	s.mu.Lock()
+	s.requests++
+	s.mu.Unlock()
+	serverLog.Infof("issued certificate for %v, valid for %v", ids, ttl)
+	return &pb.IstioCertificateResponse{
+		CertChain: []string{
+			string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+			string(s.signerPem),
+		},
+	}, nil
+}
@@ -39,6 +39,7 @@ var (
 
 	fakePushCertificateChain = []byte{03}
 	fakePushPrivateKey       = []byte{04}
+	fakeCRL                  = []byte{05}
 	pushSecret               = &ca2.SecretItem{
 		CertificateChain: fakePushCertificateChain,
 		PrivateKey:       fakePushPrivateKey,
@@ -78,6 +79,7 @@ type Expectation struct {
 	CertChain    []byte
 	Key          []byte
 	RootCert     []byte
+	CRL          []byte
 }
 
 func (s *TestServer) Verify(resp *discovery.DiscoveryResponse, expectations ...Expectation) *discovery.DiscoveryResponse {
@@ -93,6 +95,7 @@ func (s *TestServer) Verify(resp *discovery.DiscoveryResponse, expectations ...E
 			Key:          scrt.GetTlsCertificate().GetPrivateKey().GetInlineBytes(),
 			CertChain:    scrt.GetTlsCertificate().GetCertificateChain().GetInlineBytes(),
 			RootCert:     scrt.GetValidationContext().GetTrustedCa().GetInlineBytes(),
+			CRL:          scrt.GetValidationContext().GetCrl().GetInlineBytes(),
 		}
 		if diff := cmp.Diff(e, r); diff != "" {
 			s.t.Fatalf("got diff: %v", diff)
@@ -243,6 +246,22 @@ func TestSDS(t *testing.T) {
 		// No need to push a new root if just the cert changes
 		root.ExpectNoResponse()
 	})
+	t.Run("push crl", func(t *testing.T) {
+		s := setupSDS(t)
+		root := s.Connect()
+		s.Verify(root.RequestResponseAck(&discovery.DiscoveryRequest{ResourceNames: []string{rootResourceName}}), expectRoot)
+
+		s.UpdateSecret(rootResourceName, &ca2.SecretItem{
+			RootCert:     fakeRootCert,
+			CRL:          fakeCRL,
+			ResourceName: rootResourceName,
+		})
+		s.Verify(root.ExpectResponse(), Expectation{
+			ResourceName: rootResourceName,
+			RootCert:     fakeRootCert,
+			CRL:          fakeCRL,
+		})
+	})
 	t.Run("reconnect", func(t *testing.T) {
 		s := setupSDS(t)
 		c := s.Connect()
@@ -86,6 +86,9 @@ type IstioCAOptions struct {
 
 	// Config for creating self-signed root cert rotator.
 	RotatorConfig *SelfSignedCARootCertRotatorConfig
+
+	// Config for rotating the plugged-in certs to a new root, disabled if nil.
+	PluggedCertRotatorConfig *PluggedCertRotatorConfig
 }
 
 // NewSelfSignedIstioCAOptions returns a new IstioCAOptions instance using self-signed certificate.
@@ -255,6 +258,13 @@ type IstioCA struct {
 	// rootCertRotator periodically rotates self-signed root cert for CA. It is nil
 	// if CA is not self-signed CA.
 	rootCertRotator *SelfSignedCARootCertRotator
+
+	// pluggedCertRotator rotates the plugged-in certs to a new root. It is nil if the CA is not
+	// a plugged-in cert CA, or if the rotation is disabled.
+	pluggedCertRotator *PluggedCertRotator
+
+	// revocations holds the revoked certificates and identities.
+	revocations revocationState
 }
 
 // NewIstioCA returns a new IstioCA instance.
@@ -269,6 +279,14 @@ func NewIstioCA(opts *IstioCAOptions) (*IstioCA, error) {
 	if opts.CAType == selfSignedCA && opts.RotatorConfig.CheckInterval > time.Duration(0) {
 		ca.rootCertRotator = NewSelfSignedCARootCertRotator(opts.RotatorConfig, ca)
 	}
+	if opts.CAType == pluggedCertCA && opts.PluggedCertRotatorConfig != nil &&
+		opts.PluggedCertRotatorConfig.CheckInterval > time.Duration(0) {
+		rotator, err := NewPluggedCertRotator(opts.PluggedCertRotatorConfig, ca)
+		if err != nil {
+			return nil, err
+		}
+		ca.pluggedCertRotator = rotator
+	}
 
 	// if CA cert becomes invalid before workload cert it's going to cause workload cert to be invalid too,
 	// however citatel won't rotate if that happens, this function will prevent that using cert chain TTL as
@@ -287,6 +305,14 @@ func (ca *IstioCA) Run(stopChan chan struct{}) {
 		// Start root cert rotator in a separate goroutine.
 		go ca.rootCertRotator.Run(stopChan)
 	}
+	if ca.pluggedCertRotator != nil {
+		go ca.pluggedCertRotator.Run(stopChan)
+	}
+}
+
+// PluggedCertRotator returns the rotator of the plugged-in certs, or nil if it is not enabled.
+func (ca *IstioCA) PluggedCertRotator() *PluggedCertRotator {
+	return ca.pluggedCertRotator
 }
 
 // Sign takes a PEM-encoded CSR, subject IDs and lifetime, and returns a signed certificate. If forCA is true,
@@ -368,6 +394,10 @@ func (ca *IstioCA) sign(csrPEM []byte, subjectIDs []string, requestedLifetime ti
 		return nil, caerror.NewError(caerror.CSRError, err)
 	}
 
+	if id, revoked := ca.revokedIdentity(subjectIDs); revoked {
+		return nil, caerror.NewError(caerror.RevokedIdentity, fmt.Errorf("identity %s is revoked", id))
+	}
+
 	lifetime := requestedLifetime
 	// If the requested requestedLifetime is non-positive, apply the default TTL.
 	if requestedLifetime.Seconds() <= 0 {
@@ -383,6 +413,7 @@ func (ca *IstioCA) sign(csrPEM []byte, subjectIDs []string, requestedLifetime ti
 	if err != nil {
 		return nil, caerror.NewError(caerror.CertGenError, err)
 	}
+	ca.recordIssued(certBytes, subjectIDs, signingCert, *signingKey)
 
 	block := &pem.Block{
 		Type:  "CERTIFICATE",
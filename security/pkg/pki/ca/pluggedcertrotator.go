@@ -0,0 +1,677 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/log"
+)
+
+var pluggedCertRotatorLog = log.RegisterScope("pluggedcertrotator", "Plugged-in CA cert rotator log", 0)
+
+const (
+	// PluggedCertRotationConfigMap stores the state of the rotation of the plugged-in certs. The state only holds
+	// the progress of the rotation and public certificates: the keys are always read from the CA directory.
+	PluggedCertRotationConfigMap = "istio-ca-rotation"
+	// pluggedCertRotationStateID is the key of the state in PluggedCertRotationConfigMap.
+	pluggedCertRotationStateID = "state.json"
+)
+
+// RotationPhase is the phase of the rotation of the plugged-in CA certificates to a new root.
+type RotationPhase string
+
+const (
+	// RotationIdle means no rotation is in progress: the CA signs with the certificates of the CA directory, and
+	// only trusts its roots.
+	RotationIdle RotationPhase = "Idle"
+	// RotationDistributingRoots means the new roots are distributed with the old ones, while the CA keeps signing
+	// with the old certificates until the end of the soak period.
+	RotationDistributingRoots RotationPhase = "DistributingRoots"
+	// RotationSigningWithNewRoot means the CA signs with the new certificates, and still distributes the old roots
+	// until the certificates it signed before expire.
+	RotationSigningWithNewRoot RotationPhase = "SigningWithNewRoot"
+)
+
+// PluggedCertRotatorConfig configures the rotation of the plugged-in CA certificates.
+type PluggedCertRotatorConfig struct {
+	// CertDir holds the ca-cert.pem, ca-key.pem, cert-chain.pem and root-cert.pem files, usually mounted from the
+	// "cacerts" Secret.
+	CertDir string
+	// CheckInterval is the interval between the checks of the files.
+	CheckInterval time.Duration
+	// SoakPeriod is the time the new roots are distributed before the CA signs with the new certificates. It should
+	// be longer than the workload certificate TTL, for all the workloads to trust the new roots.
+	SoakPeriod time.Duration
+	// OldRootGracePeriod is the time the old roots are kept after the CA signs with the new certificates. It
+	// should be longer than the workload certificate TTL, for the certificates signed before to expire.
+	OldRootGracePeriod time.Duration
+	// OnRootsChanged is called when the trusted roots or the signing certificate change.
+	OnRootsChanged func()
+	// Store persists the state of the rotation. The state is only kept in memory if nil.
+	Store PluggedCertRotationStore
+}
+
+// PluggedCertRotationStore persists the state of the rotation of the plugged-in certificates.
+type PluggedCertRotationStore interface {
+	// Load returns the saved state, or nil if no state was saved.
+	Load() ([]byte, error)
+	// Save saves the state.
+	Save(state []byte) error
+}
+
+// CertInfo describes a certificate in the rotation status.
+type CertInfo struct {
+	Subject      string    `json:"subject"`
+	SerialNumber string    `json:"serialNumber"`
+	NotAfter     time.Time `json:"notAfter"`
+	// SHA256 is the fingerprint of the certificate.
+	SHA256 string `json:"sha256"`
+}
+
+// PluggedCertRotationStatus is the status of the rotation of the plugged-in CA certificates.
+type PluggedCertRotationStatus struct {
+	Phase RotationPhase `json:"phase"`
+	// SigningCert is the certificate the CA signs with.
+	SigningCert *CertInfo `json:"signingCert,omitempty"`
+	// PendingSigningCert is the certificate the CA will sign with at the end of the soak period.
+	PendingSigningCert *CertInfo `json:"pendingSigningCert,omitempty"`
+	// TrustedRoots are the roots distributed to the workloads.
+	TrustedRoots []CertInfo `json:"trustedRoots"`
+	// StagedAt is the time the new certificates were detected.
+	StagedAt *time.Time `json:"stagedAt,omitempty"`
+	// SwitchAt is the time the CA will sign with the new certificates.
+	SwitchAt *time.Time `json:"switchAt,omitempty"`
+	// OldRootsRemovalAt is the time the old roots will stop being distributed.
+	OldRootsRemovalAt *time.Time `json:"oldRootsRemovalAt,omitempty"`
+	LastCheck         *time.Time `json:"lastCheck,omitempty"`
+	LastError         string     `json:"lastError,omitempty"`
+}
+
+// pluggedCerts are the PEM encoded certificates and key of the CA directory.
+type pluggedCerts struct {
+	cert, key, chain, roots []byte
+}
+
+func (c *pluggedCerts) equal(o *pluggedCerts) bool {
+	return bytes.Equal(c.cert, o.cert) && bytes.Equal(c.key, o.key) &&
+		bytes.Equal(c.chain, o.chain) && bytes.Equal(c.roots, o.roots)
+}
+
+// fingerprint returns the SHA-256 fingerprint of a PEM encoded certificate, or an empty string if it is invalid.
+func (c *pluggedCerts) fingerprint() string {
+	if c == nil {
+		return ""
+	}
+	if info := certInfo(c.cert); info != nil {
+		return info.SHA256
+	}
+	return ""
+}
+
+// pluggedCertRotationState is the state of the rotation saved in the store. It holds no key: the certificates are
+// identified by their fingerprint, and their keys read from the CA directory.
+type pluggedCertRotationState struct {
+	Phase RotationPhase `json:"phase"`
+	// SigningCert is the fingerprint of the certificate the CA signs with, and PendingCert the one of the
+	// certificate it signs with at the end of the soak period.
+	SigningCert string `json:"signingCert"`
+	PendingCert string `json:"pendingCert,omitempty"`
+	// OldRoots are the roots distributed along with the roots of the CA directory during the rotation.
+	OldRoots string    `json:"oldRoots,omitempty"`
+	StagedAt time.Time `json:"stagedAt"`
+	SwitchAt time.Time `json:"switchAt"`
+	RemoveAt time.Time `json:"removeAt"`
+}
+
+// PluggedCertRotator watches the plugged-in CA certificates, and rotates them to a new root in stages: the new roots
+// are first distributed along with the old ones, the CA signs with the new certificates after a soak period, and
+// the old roots are dropped once the certificates signed with the old ones have expired.
+//
+// Certificates renewed under a trusted root are used right away. Only the leader istiod checks the CA directory and
+// moves the rotation to its next phase, and saves its state in the store. The other replicas, and the leader after a
+// restart, follow the saved state with the certificates of the CA directory. The keys are never saved: an istiod
+// restarted during the soak period no longer has the old key, so it signs with the new certificates right away while
+// still distributing the old roots. The CA directory wins when its certificates don't match the saved state.
+type PluggedCertRotator struct {
+	config *PluggedCertRotatorConfig
+	ca     *IstioCA
+	now    func() time.Time
+
+	mutex sync.Mutex
+	// loaded are the certificates of the CA directory the last time they were used.
+	loaded *pluggedCerts
+	// pending are the certificates of the CA directory, used after the soak period.
+	pending   *pluggedCerts
+	oldRoots  []byte
+	phase     RotationPhase
+	stagedAt  time.Time
+	switchAt  time.Time
+	removeAt  time.Time
+	lastCheck time.Time
+	lastError string
+	// leading is true while the rotator leads the rotation, and synced once it applied the saved state.
+	leading bool
+	synced  bool
+	// saved is the state last loaded from or saved in the store.
+	saved []byte
+}
+
+// NewPluggedCertRotator returns a rotator of the plugged-in certificates of the CA, and applies the state saved in
+// the store if any.
+func NewPluggedCertRotator(config *PluggedCertRotatorConfig, ca *IstioCA) (*PluggedCertRotator, error) {
+	cert, key, chain, roots := ca.GetCAKeyCertBundle().GetAllPem()
+	r := &PluggedCertRotator{
+		config: config,
+		ca:     ca,
+		now:    time.Now,
+		loaded: &pluggedCerts{cert: cert, key: key, chain: chain, roots: roots},
+		phase:  RotationIdle,
+	}
+	// The CA is not serving yet, there is nothing to notify.
+	if err := r.load(false); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Run applies the state saved by the leader periodically, until the stop channel is closed.
+func (r *PluggedCertRotator) Run(stopCh chan struct{}) {
+	if r.config.Store == nil {
+		return
+	}
+	ticker := time.NewTicker(r.config.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.follow()
+		case <-stopCh:
+			pluggedCertRotatorLog.Info("Received stop signal, so stop following the plugged-in cert rotation.")
+			return
+		}
+	}
+}
+
+// Lead checks the CA directory periodically and rotates the certificates, until the stop channel is closed. Only one
+// istiod, elected leader, should lead the rotation.
+func (r *PluggedCertRotator) Lead(stop <-chan struct{}) {
+	r.mutex.Lock()
+	r.leading = true
+	r.synced = false
+	r.mutex.Unlock()
+	defer func() {
+		r.mutex.Lock()
+		r.leading = false
+		r.mutex.Unlock()
+	}()
+	pluggedCertRotatorLog.Info("Leading the rotation of the plugged-in CA certificates.")
+	ticker := time.NewTicker(r.config.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.check()
+		case <-stop:
+			pluggedCertRotatorLog.Info("Received stop signal, so stop the plugged-in cert rotator.")
+			return
+		}
+	}
+}
+
+// follow applies the state saved by the leader, unless this rotator is the leader.
+func (r *PluggedCertRotator) follow() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.leading {
+		return
+	}
+	if err := r.load(true); err != nil {
+		pluggedCertRotatorLog.Errorf("Failed to apply the saved rotation of the plugged-in CA certificates: %v", err)
+		r.lastError = err.Error()
+		return
+	}
+	r.lastError = ""
+}
+
+// readCerts reads the certificates of the CA directory. The cert chain and root files are optional.
+func (r *PluggedCertRotator) readCerts() (*pluggedCerts, error) {
+	c := &pluggedCerts{}
+	var err error
+	if c.cert, err = ioutil.ReadFile(path.Join(r.config.CertDir, CaCertID)); err != nil {
+		return nil, err
+	}
+	if c.key, err = ioutil.ReadFile(path.Join(r.config.CertDir, caPrivateKeyID)); err != nil {
+		return nil, err
+	}
+	if c.chain, err = ioutil.ReadFile(path.Join(r.config.CertDir, CertChainID)); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if c.roots, err = ioutil.ReadFile(path.Join(r.config.CertDir, RootCertID)); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(c.chain) == 0 {
+		c.chain = []byte{}
+	}
+	return c, nil
+}
+
+// check reads the CA directory and moves the rotation to its next phase when due.
+func (r *PluggedCertRotator) check() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.lastCheck = r.now()
+	// A new leader first takes over the state saved by the previous one.
+	if !r.synced {
+		if err := r.load(true); err != nil {
+			pluggedCertRotatorLog.Errorf("Failed to load the rotation of the plugged-in CA certificates: %v", err)
+			r.lastError = err.Error()
+			return
+		}
+		r.synced = true
+	}
+	files, err := r.readCerts()
+	if err == nil {
+		err = r.advance(files)
+	}
+	if err == nil {
+		err = r.save()
+	}
+	if err != nil {
+		pluggedCertRotatorLog.Errorf("Failed to rotate the plugged-in CA certificates: %v", err)
+		r.lastError = err.Error()
+		return
+	}
+	r.lastError = ""
+}
+
+func (r *PluggedCertRotator) advance(files *pluggedCerts) error {
+	now := r.now()
+	switch r.phase {
+	case RotationIdle:
+		if files.equal(r.loaded) {
+			return nil
+		}
+		return r.stage(files, r.loaded.roots, now)
+	case RotationDistributingRoots:
+		if files.equal(r.loaded) {
+			// The new certificates were removed from the CA directory: abort the rotation.
+			if err := r.set(r.loaded.cert, r.loaded.key, r.loaded.chain, r.oldRoots); err != nil {
+				return err
+			}
+			pluggedCertRotatorLog.Info("The plugged-in CA certificates were reverted, aborted the rotation.")
+			r.reset()
+			return nil
+		}
+		if !files.equal(r.pending) {
+			pluggedCertRotatorLog.Info("The plugged-in CA certificates changed again, restarting the rotation.")
+			return r.stage(files, r.oldRoots, now)
+		}
+		if now.Before(r.switchAt) {
+			return nil
+		}
+		if err := r.set(files.cert, files.key, files.chain, mergeRoots(r.oldRoots, files.roots)); err != nil {
+			return err
+		}
+		r.loaded = files
+		r.phase = RotationSigningWithNewRoot
+		r.removeAt = now.Add(r.config.OldRootGracePeriod)
+		pluggedCertRotatorLog.Infof("The CA signs with the new plugged-in certificates, the old roots are "+
+			"distributed until %v.", r.removeAt)
+		return nil
+	case RotationSigningWithNewRoot:
+		if !files.equal(r.loaded) {
+			pluggedCertRotatorLog.Warnf("The plugged-in CA certificates changed during the rotation, the change " +
+				"is deferred until the old roots are dropped.")
+		}
+		if now.Before(r.removeAt) {
+			return nil
+		}
+		if err := r.set(r.loaded.cert, r.loaded.key, r.loaded.chain, r.loaded.roots); err != nil {
+			return err
+		}
+		pluggedCertRotatorLog.Info("Dropped the old roots, the rotation of the plugged-in CA certificates is completed.")
+		r.reset()
+		return nil
+	}
+	return fmt.Errorf("unknown rotation phase %q", r.phase)
+}
+
+// stage starts a rotation to the certificates of the CA directory, or uses them right away when their roots are
+// already trusted.
+func (r *PluggedCertRotator) stage(files *pluggedCerts, trustedRoots []byte, now time.Time) error {
+	if err := util.Verify(files.cert, files.key, files.chain, files.roots); err != nil {
+		return fmt.Errorf("invalid plugged-in CA certificates: %v", err)
+	}
+	newRoots, err := untrustedRoots(files.roots, trustedRoots)
+	if err != nil {
+		return err
+	}
+	if len(newRoots) == 0 {
+		if err := r.set(files.cert, files.key, files.chain, files.roots); err != nil {
+			return err
+		}
+		pluggedCertRotatorLog.Info("Reloaded the plugged-in CA certificates, their roots are already trusted.")
+		r.loaded = files
+		r.reset()
+		return nil
+	}
+	if err := r.set(r.loaded.cert, r.loaded.key, r.loaded.chain, mergeRoots(trustedRoots, files.roots)); err != nil {
+		return err
+	}
+	r.oldRoots = trustedRoots
+	r.pending = files
+	r.phase = RotationDistributingRoots
+	r.stagedAt = now
+	r.switchAt = now.Add(r.config.SoakPeriod)
+	pluggedCertRotatorLog.Infof("New plugged-in CA certificates with %d new roots detected, distributing the new roots. "+
+		"The CA signs with the new certificates at %v.", len(newRoots), r.switchAt)
+	return nil
+}
+
+func (r *PluggedCertRotator) reset() {
+	r.phase = RotationIdle
+	r.pending = nil
+	r.oldRoots = nil
+	r.stagedAt = time.Time{}
+	r.switchAt = time.Time{}
+	r.removeAt = time.Time{}
+}
+
+// load applies the state saved in the store, if it changed, with the certificates of the CA directory. The caller
+// must hold the mutex.
+func (r *PluggedCertRotator) load(notify bool) error {
+	if r.config.Store == nil {
+		return nil
+	}
+	b, err := r.config.Store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load the rotation state: %v", err)
+	}
+	if b == nil || bytes.Equal(b, r.saved) {
+		return nil
+	}
+	state := &pluggedCertRotationState{}
+	if err := json.Unmarshal(b, state); err != nil {
+		return fmt.Errorf("failed to parse the rotation state: %v", err)
+	}
+	files, err := r.readCerts()
+	if err != nil {
+		return fmt.Errorf("failed to read the plugged-in CA certificates: %v", err)
+	}
+	cert, key, chain, roots := r.ca.GetCAKeyCertBundle().GetAllPem()
+	current := &pluggedCerts{cert: cert, key: key, chain: chain, roots: roots}
+
+	// The certificates the CA signs with, and the roots it distributes, according to the saved state.
+	var signing *pluggedCerts
+	var trustedRoots []byte
+	switch {
+	case state.Phase == RotationIdle && files.fingerprint() == state.SigningCert:
+		r.reset()
+		signing, trustedRoots = files, files.roots
+	case state.Phase == RotationDistributingRoots && files.fingerprint() == state.PendingCert &&
+		current.fingerprint() == state.SigningCert:
+		r.reset()
+		r.phase, r.pending, r.oldRoots = state.Phase, files, []byte(state.OldRoots)
+		r.stagedAt, r.switchAt = state.StagedAt, state.SwitchAt
+		signing, trustedRoots = current, mergeRoots(r.oldRoots, files.roots)
+	case state.Phase == RotationDistributingRoots && files.fingerprint() == state.PendingCert:
+		// The old key is only kept in memory, and lost on restart: sign with the new certificates right away.
+		r.reset()
+		r.phase, r.oldRoots = RotationSigningWithNewRoot, []byte(state.OldRoots)
+		r.removeAt = state.SwitchAt
+		if r.removeAt.Before(r.now()) {
+			r.removeAt = r.now()
+		}
+		r.removeAt = r.removeAt.Add(r.config.OldRootGracePeriod)
+		signing, trustedRoots = files, mergeRoots(r.oldRoots, files.roots)
+		pluggedCertRotatorLog.Warnf("The key of the old plugged-in CA certificates is not available anymore, the CA "+
+			"signs with the new certificates before the end of the soak period. The old roots are distributed until %v.", r.removeAt)
+	case state.Phase == RotationSigningWithNewRoot && files.fingerprint() == state.SigningCert:
+		r.reset()
+		r.phase, r.oldRoots, r.removeAt = state.Phase, []byte(state.OldRoots), state.RemoveAt
+		signing, trustedRoots = files, mergeRoots(r.oldRoots, files.roots)
+	default:
+		// The CA directory changed since the state was saved, it wins over the saved rotation.
+		pluggedCertRotatorLog.Warnf("The plugged-in CA certificates do not match the saved rotation in phase %v, "+
+			"using the plugged-in CA certificates.", state.Phase)
+		r.reset()
+		r.loaded = current
+		r.saved = b
+		return nil
+	}
+	r.loaded = signing
+	if !bytes.Equal(current.cert, signing.cert) || !bytes.Equal(current.key, signing.key) ||
+		!bytes.Equal(current.chain, signing.chain) || !bytes.Equal(current.roots, trustedRoots) {
+		if err := r.ca.GetCAKeyCertBundle().VerifyAndSetAll(signing.cert, signing.key, signing.chain, trustedRoots); err != nil {
+			return fmt.Errorf("failed to apply the rotation state: %v", err)
+		}
+		if notify && r.config.OnRootsChanged != nil {
+			r.config.OnRootsChanged()
+		}
+		pluggedCertRotatorLog.Infof("Applied the saved rotation of the plugged-in CA certificates, in phase %v.", r.phase)
+	}
+	r.saved = b
+	return nil
+}
+
+// save saves the state of the rotation in the store, if it changed. The caller must hold the mutex.
+func (r *PluggedCertRotator) save() error {
+	if r.config.Store == nil {
+		return nil
+	}
+	b, err := json.Marshal(&pluggedCertRotationState{
+		Phase:       r.phase,
+		SigningCert: r.loaded.fingerprint(),
+		PendingCert: r.pending.fingerprint(),
+		OldRoots:    string(r.oldRoots),
+		StagedAt:    r.stagedAt,
+		SwitchAt:    r.switchAt,
+		RemoveAt:    r.removeAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal the rotation state: %v", err)
+	}
+	if bytes.Equal(b, r.saved) {
+		return nil
+	}
+	if err := r.config.Store.Save(b); err != nil {
+		return fmt.Errorf("failed to save the rotation state: %v", err)
+	}
+	r.saved = b
+	return nil
+}
+
+// set updates the key cert bundle of the CA, and notifies the change.
+func (r *PluggedCertRotator) set(cert, key, chain, roots []byte) error {
+	if err := r.ca.GetCAKeyCertBundle().VerifyAndSetAll(cert, key, chain, roots); err != nil {
+		return fmt.Errorf("failed to update the CA KeyCertBundle: %v", err)
+	}
+	if r.config.OnRootsChanged != nil {
+		r.config.OnRootsChanged()
+	}
+	return nil
+}
+
+// Status returns the status of the rotation.
+func (r *PluggedCertRotator) Status() PluggedCertRotationStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	cert, _, _, roots := r.ca.GetCAKeyCertBundle().GetAllPem()
+	s := PluggedCertRotationStatus{
+		Phase:        r.phase,
+		SigningCert:  certInfo(cert),
+		TrustedRoots: []CertInfo{},
+		LastError:    r.lastError,
+	}
+	for _, c := range parsePemCerts(roots) {
+		s.TrustedRoots = append(s.TrustedRoots, newCertInfo(c))
+	}
+	if r.pending != nil && r.phase == RotationDistributingRoots {
+		s.PendingSigningCert = certInfo(r.pending.cert)
+	}
+	s.StagedAt = timeOrNil(r.stagedAt)
+	s.SwitchAt = timeOrNil(r.switchAt)
+	s.OldRootsRemovalAt = timeOrNil(r.removeAt)
+	s.LastCheck = timeOrNil(r.lastCheck)
+	return s
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func certInfo(certPem []byte) *CertInfo {
+	c, err := util.ParsePemEncodedCertificate(certPem)
+	if err != nil {
+		return nil
+	}
+	info := newCertInfo(c)
+	return &info
+}
+
+func newCertInfo(c *x509.Certificate) CertInfo {
+	sum := sha256.Sum256(c.Raw)
+	return CertInfo{
+		Subject:      c.Subject.String(),
+		SerialNumber: fmt.Sprintf("%x", c.SerialNumber),
+		NotAfter:     c.NotAfter,
+		SHA256:       hex.EncodeToString(sum[:]),
+	}
+}
+
+// parsePemCerts returns the certificates of a PEM bundle, skipping the invalid ones.
+func parsePemCerts(b []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if c, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, c)
+		}
+	}
+}
+
+// untrustedRoots returns the roots that are not in the trusted roots.
+func untrustedRoots(roots, trusted []byte) ([]*x509.Certificate, error) {
+	certs := parsePemCerts(roots)
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no root certificate found in %s", RootCertID)
+	}
+	var out []*x509.Certificate
+	for _, c := range certs {
+		if !containsCert(parsePemCerts(trusted), c) {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func containsCert(certs []*x509.Certificate, c *x509.Certificate) bool {
+	for _, o := range certs {
+		if o.Equal(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeRoots appends the roots not already present to the trusted roots.
+func mergeRoots(trusted, roots []byte) []byte {
+	merged := trusted
+	existing := parsePemCerts(trusted)
+	for _, c := range parsePemCerts(roots) {
+		if containsCert(existing, c) {
+			continue
+		}
+		existing = append(existing, c)
+		merged = util.AppendCertByte(merged, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}))
+	}
+	return merged
+}
+
+type configMapRotationStore struct {
+	client    corev1.ConfigMapsGetter
+	namespace string
+}
+
+// NewConfigMapPluggedCertRotationStore returns a store saving the state of the rotation of the plugged-in certs in
+// PluggedCertRotationConfigMap.
+func NewConfigMapPluggedCertRotationStore(client corev1.ConfigMapsGetter, namespace string) PluggedCertRotationStore {
+	return &configMapRotationStore{client: client, namespace: namespace}
+}
+
+func (s *configMapRotationStore) Load() ([]byte, error) {
+	cm, err := s.client.ConfigMaps(s.namespace).Get(context.TODO(), PluggedCertRotationConfigMap, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state, f := cm.Data[pluggedCertRotationStateID]
+	if !f {
+		return nil, nil
+	}
+	return []byte(state), nil
+}
+
+func (s *configMapRotationStore) Save(state []byte) error {
+	configMaps := s.client.ConfigMaps(s.namespace)
+	cm, err := configMaps.Get(context.TODO(), PluggedCertRotationConfigMap, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(context.TODO(), &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: PluggedCertRotationConfigMap, Namespace: s.namespace},
+			Data:       map[string]string{pluggedCertRotationStateID: string(state)},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[pluggedCertRotationStateID] = string(state)
+	_, err = configMaps.Update(context.TODO(), cm, metav1.UpdateOptions{})
+	return err
+}
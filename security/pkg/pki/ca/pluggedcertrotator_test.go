@@ -0,0 +1,369 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"bytes"
+	"crypto/x509"
+	"io/ioutil"
+	"path"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+// genPluggedCerts returns a root and an intermediate CA signed by it.
+func genPluggedCerts(t *testing.T, org string) *pluggedCerts {
+	t.Helper()
+	rootPem, rootKeyPem, err := util.GenCertKeyFromOptions(util.CertOptions{
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          24 * time.Hour,
+		Org:          org + " Root CA",
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return genIntermediate(t, org, rootPem, rootKeyPem)
+}
+
+func genIntermediate(t *testing.T, org string, rootPem, rootKeyPem []byte) *pluggedCerts {
+	t.Helper()
+	rootCert, err := util.ParsePemEncodedCertificate(rootPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootKey, err := util.ParsePemEncodedKey(rootKeyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem, keyPem, err := util.GenCertKeyFromOptions(util.CertOptions{
+		IsCA:       true,
+		TTL:        12 * time.Hour,
+		Org:        org + " Intermediate CA",
+		RSAKeySize: 2048,
+		SignerCert: rootCert,
+		SignerPriv: rootKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pluggedCerts{cert: certPem, key: keyPem, chain: certPem, roots: rootPem}
+}
+
+func writePluggedCerts(t *testing.T, dir string, c *pluggedCerts) {
+	t.Helper()
+	for file, data := range map[string][]byte{
+		CaCertID:       c.cert,
+		caPrivateKeyID: c.key,
+		CertChainID:    c.chain,
+		RootCertID:     c.roots,
+	} {
+		if err := ioutil.WriteFile(path.Join(dir, file), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPluggedCertRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldCerts := genPluggedCerts(t, "old")
+	newCerts := genPluggedCerts(t, "new")
+	writePluggedCerts(t, dir, oldCerts)
+
+	caOpts, err := NewPluggedCertIstioCAOptions(path.Join(dir, CertChainID), path.Join(dir, CaCertID),
+		path.Join(dir, caPrivateKeyID), path.Join(dir, RootCertID), time.Hour, 2*time.Hour, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := 0
+	caOpts.PluggedCertRotatorConfig = &PluggedCertRotatorConfig{
+		CertDir:            dir,
+		CheckInterval:      time.Minute,
+		SoakPeriod:         time.Hour,
+		OldRootGracePeriod: 2 * time.Hour,
+		OnRootsChanged:     func() { changes++ },
+	}
+	ca, err := NewIstioCA(caOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotator := ca.PluggedCertRotator()
+	if rotator == nil {
+		t.Fatal("expected the plugged-in cert rotator to be enabled")
+	}
+	now := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	rotator.now = func() time.Time { return now }
+
+	expect := func(phase RotationPhase, signingCert []byte, roots int, wantChanges int) {
+		t.Helper()
+		rotator.check()
+		status := rotator.Status()
+		if status.LastError != "" {
+			t.Fatalf("unexpected error: %v", status.LastError)
+		}
+		if status.Phase != phase {
+			t.Errorf("got phase %v, want %v", status.Phase, phase)
+		}
+		if cert, _, _, _ := ca.GetCAKeyCertBundle().GetAllPem(); !bytes.Equal(cert, signingCert) {
+			t.Errorf("unexpected signing certificate %v", status.SigningCert)
+		}
+		if len(status.TrustedRoots) != roots {
+			t.Errorf("got %d trusted roots, want %d", len(status.TrustedRoots), roots)
+		}
+		if changes != wantChanges {
+			t.Errorf("got %d changes, want %d", changes, wantChanges)
+		}
+	}
+
+	expect(RotationIdle, oldCerts.cert, 1, 0)
+
+	// The new roots are distributed, and the CA keeps signing with the old certificates.
+	writePluggedCerts(t, dir, newCerts)
+	expect(RotationDistributingRoots, oldCerts.cert, 2, 1)
+	if s := rotator.Status(); s.PendingSigningCert == nil || s.SwitchAt == nil || !s.SwitchAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("unexpected status %+v", s)
+	}
+	now = now.Add(59 * time.Minute)
+	expect(RotationDistributingRoots, oldCerts.cert, 2, 1)
+
+	// The CA signs with the new certificates after the soak period, the old root is still distributed.
+	now = now.Add(time.Minute)
+	expect(RotationSigningWithNewRoot, newCerts.cert, 2, 2)
+	cert, err := ca.Sign(genCSR(t), []string{"spiffe://cluster.local/ns/default/sa/test"}, time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := util.ParsePemEncodedCertificate(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	roots.AppendCertsFromPEM(newCerts.roots)
+	intermediates.AppendCertsFromPEM(newCerts.chain)
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		t.Errorf("the certificate is not signed by the new root: %v", err)
+	}
+
+	// The old root is dropped after the grace period.
+	now = now.Add(2 * time.Hour)
+	expect(RotationIdle, newCerts.cert, 1, 3)
+	if !bytes.Equal(ca.GetCAKeyCertBundle().GetRootCertPem(), newCerts.roots) {
+		t.Errorf("expected only the new root to be trusted")
+	}
+	expect(RotationIdle, newCerts.cert, 1, 3)
+}
+
+func TestPluggedCertRotationRenewedIntermediate(t *testing.T) {
+	dir := t.TempDir()
+	rootPem, rootKeyPem, err := util.GenCertKeyFromOptions(util.CertOptions{
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          24 * time.Hour,
+		Org:          "Root CA",
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldCerts := genIntermediate(t, "old", rootPem, rootKeyPem)
+	writePluggedCerts(t, dir, oldCerts)
+	caOpts, err := NewPluggedCertIstioCAOptions(path.Join(dir, CertChainID), path.Join(dir, CaCertID),
+		path.Join(dir, caPrivateKeyID), path.Join(dir, RootCertID), time.Hour, 2*time.Hour, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caOpts.PluggedCertRotatorConfig = &PluggedCertRotatorConfig{CertDir: dir, CheckInterval: time.Minute, SoakPeriod: time.Hour}
+	ca, err := NewIstioCA(caOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An intermediate renewed under the same root is used right away.
+	newCerts := genIntermediate(t, "new", rootPem, rootKeyPem)
+	writePluggedCerts(t, dir, newCerts)
+	ca.PluggedCertRotator().check()
+	if s := ca.PluggedCertRotator().Status(); s.Phase != RotationIdle || s.LastError != "" {
+		t.Errorf("unexpected status %+v", s)
+	}
+	if cert, _, _, _ := ca.GetCAKeyCertBundle().GetAllPem(); !bytes.Equal(cert, newCerts.cert) {
+		t.Errorf("expected the CA to sign with the renewed intermediate")
+	}
+}
+
+func TestPluggedCertRotationAborted(t *testing.T) {
+	dir := t.TempDir()
+	oldCerts := genPluggedCerts(t, "old")
+	writePluggedCerts(t, dir, oldCerts)
+	caOpts, err := NewPluggedCertIstioCAOptions(path.Join(dir, CertChainID), path.Join(dir, CaCertID),
+		path.Join(dir, caPrivateKeyID), path.Join(dir, RootCertID), time.Hour, 2*time.Hour, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caOpts.PluggedCertRotatorConfig = &PluggedCertRotatorConfig{CertDir: dir, CheckInterval: time.Minute, SoakPeriod: time.Hour}
+	ca, err := NewIstioCA(caOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotator := ca.PluggedCertRotator()
+
+	invalid := genPluggedCerts(t, "invalid")
+	invalid.roots = oldCerts.roots
+	writePluggedCerts(t, dir, invalid)
+	rotator.check()
+	if s := rotator.Status(); s.Phase != RotationIdle || s.LastError == "" {
+		t.Errorf("expected an error for certificates not signed by their root, got %+v", s)
+	}
+
+	writePluggedCerts(t, dir, genPluggedCerts(t, "new"))
+	rotator.check()
+	if s := rotator.Status(); s.Phase != RotationDistributingRoots {
+		t.Fatalf("unexpected status %+v", s)
+	}
+	writePluggedCerts(t, dir, oldCerts)
+	rotator.check()
+	if s := rotator.Status(); s.Phase != RotationIdle || len(s.TrustedRoots) != 1 {
+		t.Errorf("expected the rotation to be aborted, got %+v", s)
+	}
+	if !bytes.Equal(ca.GetCAKeyCertBundle().GetRootCertPem(), oldCerts.roots) {
+		t.Errorf("expected only the old root to be trusted")
+	}
+}
+
+func TestPluggedCertRotationResumed(t *testing.T) {
+	dir := t.TempDir()
+	oldCerts := genPluggedCerts(t, "old")
+	newCerts := genPluggedCerts(t, "new")
+	writePluggedCerts(t, dir, oldCerts)
+	store := NewConfigMapPluggedCertRotationStore(fake.NewSimpleClientset().CoreV1(), "istio-system")
+	newCA := func() *IstioCA {
+		t.Helper()
+		caOpts, err := NewPluggedCertIstioCAOptions(path.Join(dir, CertChainID), path.Join(dir, CaCertID),
+			path.Join(dir, caPrivateKeyID), path.Join(dir, RootCertID), time.Hour, 2*time.Hour, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		caOpts.PluggedCertRotatorConfig = &PluggedCertRotatorConfig{
+			CertDir:            dir,
+			CheckInterval:      time.Minute,
+			SoakPeriod:         time.Hour,
+			OldRootGracePeriod: time.Hour,
+			Store:              store,
+		}
+		ca, err := NewIstioCA(caOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ca
+	}
+
+	leader := newCA()
+	follower := newCA()
+	leader.PluggedCertRotator().check()
+	writePluggedCerts(t, dir, newCerts)
+	leader.PluggedCertRotator().check()
+	expectRotation(t, leader, RotationDistributingRoots, oldCerts.cert, 2)
+
+	// The saved state holds no key.
+	state, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(state, []byte("PRIVATE KEY")) {
+		t.Errorf("the saved state holds a key: %s", state)
+	}
+
+	// The follower applies the rotation of the leader, keeping the old certificates it signs with.
+	follower.PluggedCertRotator().follow()
+	expectRotation(t, follower, RotationDistributingRoots, oldCerts.cert, 2)
+
+	// A restarted istiod only has the new key of the CA directory: it signs with the new certificates right away,
+	// and keeps distributing the old roots.
+	restarted := newCA()
+	expectRotation(t, restarted, RotationSigningWithNewRoot, newCerts.cert, 2)
+
+	// The restarted istiod takes the lead, and the follower switches to the new certificates with it.
+	rotator := restarted.PluggedCertRotator()
+	rotator.now = func() time.Time { return time.Now().Add(time.Hour) }
+	rotator.check()
+	expectRotation(t, restarted, RotationSigningWithNewRoot, newCerts.cert, 2)
+	follower.PluggedCertRotator().follow()
+	expectRotation(t, follower, RotationSigningWithNewRoot, newCerts.cert, 2)
+}
+
+func TestPluggedCertRotationCACertsWin(t *testing.T) {
+	dir := t.TempDir()
+	oldCerts := genPluggedCerts(t, "old")
+	writePluggedCerts(t, dir, oldCerts)
+	store := NewConfigMapPluggedCertRotationStore(fake.NewSimpleClientset().CoreV1(), "istio-system")
+	newCA := func() *IstioCA {
+		t.Helper()
+		caOpts, err := NewPluggedCertIstioCAOptions(path.Join(dir, CertChainID), path.Join(dir, CaCertID),
+			path.Join(dir, caPrivateKeyID), path.Join(dir, RootCertID), time.Hour, 2*time.Hour, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		caOpts.PluggedCertRotatorConfig = &PluggedCertRotatorConfig{CertDir: dir, CheckInterval: time.Minute, SoakPeriod: time.Hour, Store: store}
+		ca, err := NewIstioCA(caOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ca
+	}
+
+	leader := newCA()
+	writePluggedCerts(t, dir, genPluggedCerts(t, "new"))
+	leader.PluggedCertRotator().check()
+	expectRotation(t, leader, RotationDistributingRoots, oldCerts.cert, 2)
+
+	// The certificates of the CA directory changed again while istiod was down: they win over the saved rotation.
+	otherCerts := genPluggedCerts(t, "other")
+	writePluggedCerts(t, dir, otherCerts)
+	restarted := newCA()
+	expectRotation(t, restarted, RotationIdle, otherCerts.cert, 1)
+	restarted.PluggedCertRotator().check()
+	expectRotation(t, restarted, RotationIdle, otherCerts.cert, 1)
+}
+
+func expectRotation(t *testing.T, ca *IstioCA, phase RotationPhase, signingCert []byte, roots int) {
+	t.Helper()
+	status := ca.PluggedCertRotator().Status()
+	if status.Phase != phase || status.LastError != "" {
+		t.Errorf("got phase %v and error %q, want %v", status.Phase, status.LastError, phase)
+	}
+	if cert, _, _, _ := ca.GetCAKeyCertBundle().GetAllPem(); !bytes.Equal(cert, signingCert) {
+		t.Errorf("unexpected signing certificate %v", status.SigningCert)
+	}
+	if len(status.TrustedRoots) != roots {
+		t.Errorf("got %d trusted roots, want %d", len(status.TrustedRoots), roots)
+	}
+}
+
+func genCSR(t *testing.T) []byte {
+	t.Helper()
+	csr, _, err := util.GenCSR(util.CertOptions{Host: "spiffe://cluster.local/ns/default/sa/test", RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
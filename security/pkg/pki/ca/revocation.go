@@ -0,0 +1,435 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RevocationsConfigMap is the ConfigMap, in the namespace of istiod, holding the certificates revoked by the CA.
+	RevocationsConfigMap = "istio-ca-revocations"
+	// RevocationsConfigMapKey is the key of RevocationsConfigMap holding the JSON list of revocations.
+	RevocationsConfigMapKey = "revocations.json"
+	// ParentCRLConfigMapKey is the key of RevocationsConfigMap holding the PEM encoded CRLs of the other CAs
+	// issuing the certificates verified by the proxies: the CAs above the Istio CA in the certificate chain, and
+	// the CAs of the other roots of the mesh. Envoy rejects the certificates of a chain unless it has a CRL for
+	// every CA of the chain, so it is required when the CA uses a plugged intermediate certificate.
+	ParentCRLConfigMapKey = "parent-crl.pem"
+
+	// CRLValidity is the time between the last and the next update of the CRL. Certificates are rejected once the
+	// CRL is past its next update, so the CRL is regenerated after half of this time.
+	CRLValidity = 24 * time.Hour
+
+	// pemCRLType is the type of PEM encoded CRLs.
+	pemCRLType = "X509 CRL"
+
+	// issuedPruneInterval is the time between the removals of the expired certificates issued by the CA.
+	issuedPruneInterval = time.Hour
+)
+
+// Reasons of revocations, as defined in RFC 5280 section 5.3.1.
+var revocationReasons = map[string]int{
+	"unspecified":          0,
+	"keyCompromise":        1,
+	"cACompromise":         2,
+	"affiliationChanged":   3,
+	"superseded":           4,
+	"cessationOfOperation": 5,
+}
+
+// oidReasonCode is the CRL entry extension of the reason of a revocation.
+var oidReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// Revocation revokes a certificate, by serial number, or all the certificates of an identity.
+type Revocation struct {
+	// SerialNumber is the serial number of the revoked certificate, in hexadecimal.
+	SerialNumber string `json:"serialNumber,omitempty"`
+	// Identity is a revoked SPIFFE ID. The CA refuses to sign certificates for it, and revokes the ones it
+	// issued for it.
+	Identity string `json:"identity,omitempty"`
+	// Reason is one of the reasons of RFC 5280, for example "keyCompromise". It defaults to "unspecified".
+	Reason    string    `json:"reason,omitempty"`
+	RevokedAt time.Time `json:"revokedAt"`
+}
+
+// Validate checks that the revocation has a valid serial number or identity, and a known reason.
+func (r Revocation) Validate() error {
+	if (r.SerialNumber == "") == (r.Identity == "") {
+		return fmt.Errorf("revocation must have either a serial number or an identity")
+	}
+	if r.SerialNumber != "" {
+		if _, err := ParseSerialNumber(r.SerialNumber); err != nil {
+			return err
+		}
+	}
+	if _, f := revocationReasons[r.reason()]; !f {
+		return fmt.Errorf("unknown revocation reason %q, expected one of %s", r.Reason, strings.Join(RevocationReasons(), ", "))
+	}
+	return nil
+}
+
+func (r Revocation) reason() string {
+	if r.Reason == "" {
+		return "unspecified"
+	}
+	return r.Reason
+}
+
+// RevocationReasons returns the supported reasons of revocations.
+func RevocationReasons() []string {
+	reasons := make([]string, 0, len(revocationReasons))
+	for r := range revocationReasons {
+		reasons = append(reasons, r)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		return revocationReasons[reasons[i]] < revocationReasons[reasons[j]]
+	})
+	return reasons
+}
+
+// ParseSerialNumber parses a hexadecimal serial number, optionally with the colons printed by openssl.
+func ParseSerialNumber(serial string) (*big.Int, error) {
+	s := strings.TrimPrefix(strings.ToLower(strings.ReplaceAll(serial, ":", "")), "0x")
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok || n.Sign() < 0 {
+		return nil, fmt.Errorf("invalid serial number %q", serial)
+	}
+	return n, nil
+}
+
+// ParseRevocations parses and validates the JSON list of revocations of RevocationsConfigMap.
+func ParseRevocations(data string) ([]Revocation, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+	var revocations []Revocation
+	if err := json.Unmarshal([]byte(data), &revocations); err != nil {
+		return nil, fmt.Errorf("failed to parse the revocations: %v", err)
+	}
+	for i, r := range revocations {
+		if err := r.Validate(); err != nil {
+			return nil, fmt.Errorf("revocation %d: %v", i, err)
+		}
+	}
+	return revocations, nil
+}
+
+// MarshalRevocations returns the JSON list of revocations of RevocationsConfigMap.
+func MarshalRevocations(revocations []Revocation) (string, error) {
+	if revocations == nil {
+		revocations = []Revocation{}
+	}
+	b, err := json.MarshalIndent(revocations, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// issuedCert is a certificate signed by the CA.
+type issuedCert struct {
+	serialNumber *big.Int
+	notAfter     time.Time
+	// issuer is the fingerprint of the signing certificate of the CA which issued the certificate.
+	issuer string
+}
+
+// crlSigner is a signing certificate of the CA, and the time its last issued certificate expires.
+type crlSigner struct {
+	cert     *x509.Certificate
+	key      crypto.Signer
+	notAfter time.Time
+}
+
+// revocationState holds the revocations of the CA, the certificates it issued to each identity, the signing
+// certificates which issued them, and the last generated CRL.
+type revocationState struct {
+	mu          sync.Mutex
+	revocations []Revocation
+	parentCRLs  []byte
+	revokedIDs  map[string]Revocation
+	// issued holds the certificates issued to each identity which haven't expired yet.
+	issued    map[string][]issuedCert
+	lastPrune time.Time
+	// signers holds the signing certificates of the CA, by fingerprint, which issued certificates that haven't
+	// expired yet. A CRL is generated for each of them, as Envoy rejects the certificates of issuers without CRL,
+	// for example the ones issued before the CA certificate was rotated.
+	signers map[string]*crlSigner
+
+	crl           []byte
+	crlGeneration time.Time
+	crlSigner     []byte
+}
+
+// fingerprint identifies a signing certificate of the CA.
+func fingerprint(cert *x509.Certificate) string {
+	return fmt.Sprintf("%x", sha256.Sum256(cert.Raw))
+}
+
+// SetRevocations sets the revocations of the CA, and the CRLs of the parent CAs of its signing certificate.
+func (ca *IstioCA) SetRevocations(revocations []Revocation, parentCRLs []byte) {
+	s := &ca.revocations
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revocations = revocations
+	s.parentCRLs = parentCRLs
+	s.revokedIDs = map[string]Revocation{}
+	for _, r := range revocations {
+		if r.Identity != "" {
+			s.revokedIDs[r.Identity] = r
+		}
+	}
+	s.crl = nil
+}
+
+// HasRevocations returns true if at least one certificate or identity is revoked.
+func (ca *IstioCA) HasRevocations() bool {
+	s := &ca.revocations
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.revocations) > 0
+}
+
+// revokedIdentity returns the first revoked identity of the subject IDs, if any.
+func (ca *IstioCA) revokedIdentity(subjectIDs []string) (string, bool) {
+	s := &ca.revocations
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range subjectIDs {
+		if _, f := s.revokedIDs[id]; f {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// recordIssued keeps track of a certificate signed for the subject IDs by the signing certificate, to revoke it
+// with its identity.
+func (ca *IstioCA) recordIssued(certBytes []byte, subjectIDs []string, signingCert *x509.Certificate, signingKey crypto.PrivateKey) {
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		pkiCaLog.Warnf("failed to parse the signed certificate: %v", err)
+		return
+	}
+	s := &ca.revocations
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.issued == nil {
+		s.issued = map[string][]issuedCert{}
+		s.signers = map[string]*crlSigner{}
+	}
+	now := time.Now()
+	issuer := fingerprint(signingCert)
+	if signer, f := s.signers[issuer]; f {
+		if cert.NotAfter.After(signer.notAfter) {
+			signer.notAfter = cert.NotAfter
+		}
+	} else {
+		key, _ := signingKey.(crypto.Signer)
+		s.signers[issuer] = &crlSigner{cert: signingCert, key: key, notAfter: cert.NotAfter}
+	}
+	for _, id := range subjectIDs {
+		certs := []issuedCert{{serialNumber: cert.SerialNumber, notAfter: cert.NotAfter, issuer: issuer}}
+		for _, c := range s.issued[id] {
+			if c.notAfter.After(now) {
+				certs = append(certs, c)
+			}
+		}
+		s.issued[id] = certs
+	}
+	if now.Sub(s.lastPrune) >= issuedPruneInterval {
+		s.prune(now)
+	}
+}
+
+// prune removes the expired certificates, and the signing certificates which only issued expired certificates.
+// The lock must be held.
+func (s *revocationState) prune(now time.Time) {
+	s.lastPrune = now
+	for id, certs := range s.issued {
+		valid := certs[:0]
+		for _, c := range certs {
+			if c.notAfter.After(now) {
+				valid = append(valid, c)
+			}
+		}
+		if len(valid) == 0 {
+			delete(s.issued, id)
+		} else {
+			s.issued[id] = valid
+		}
+	}
+	for issuer, signer := range s.signers {
+		if !signer.notAfter.After(now) {
+			delete(s.signers, issuer)
+		}
+	}
+}
+
+// CRL returns the PEM encoded certificate revocation lists signed by the CA, followed by the CRLs of the other
+// CAs. A CRL is signed by the current signing certificate of the CA, and by each of the previous ones which issued
+// certificates that haven't expired yet. It returns nil if no certificate is revoked. The certificates of revoked
+// identities are only listed if they were issued by this instance of the CA since it started: other certificates
+// must be revoked by serial number.
+func (ca *IstioCA) CRL() ([]byte, error) {
+	signingCert, signingKey, _, _ := ca.keyCertBundle.GetAll()
+	if signingCert == nil || signingKey == nil {
+		return nil, fmt.Errorf("Istio CA is not ready") // nolint
+	}
+
+	s := &ca.revocations
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.revocations) == 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	if s.crl != nil && bytes.Equal(s.crlSigner, signingCert.Raw) && now.Sub(s.crlGeneration) < CRLValidity/2 {
+		return s.crl, nil
+	}
+
+	if !isSelfSigned(signingCert) && len(s.parentCRLs) == 0 {
+		return nil, fmt.Errorf("the CA certificate is an intermediate certificate, the CRLs of its parent CAs "+
+			"must be set in the %s key of the %s ConfigMap", ParentCRLConfigMapKey, RevocationsConfigMap)
+	}
+	signer, ok := (*signingKey).(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("the CA key cannot sign a CRL")
+	}
+
+	if now.Sub(s.lastPrune) >= issuedPruneInterval {
+		s.prune(now)
+	}
+	current := fingerprint(signingCert)
+	crl, err := s.signCRL(now, current, signingCert, signer)
+	if err != nil {
+		return nil, err
+	}
+	previous := make([]string, 0, len(s.signers))
+	for issuer := range s.signers {
+		if issuer != current {
+			previous = append(previous, issuer)
+		}
+	}
+	sort.Strings(previous)
+	for _, issuer := range previous {
+		signer := s.signers[issuer]
+		if signer.key == nil {
+			pkiCaLog.Warnf("the key of the previous CA certificate %v cannot sign a CRL", signer.cert.Subject)
+			continue
+		}
+		previousCRL, err := s.signCRL(now, issuer, signer.cert, signer.key)
+		if err != nil {
+			return nil, err
+		}
+		crl = append(crl, previousCRL...)
+	}
+	if len(s.parentCRLs) > 0 {
+		crl = append(crl, s.parentCRLs...)
+	}
+
+	s.crl = crl
+	s.crlGeneration = now
+	s.crlSigner = signingCert.Raw
+	return crl, nil
+}
+
+// signCRL returns the PEM encoded CRL of the certificates issued by the signing certificate. The lock must be held.
+func (s *revocationState) signCRL(now time.Time, issuer string, signingCert *x509.Certificate, signer crypto.Signer) ([]byte, error) {
+	revoked, err := s.revokedCertificates(now, issuer)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.RevocationList{
+		RevokedCertificates: revoked,
+		Number:              big.NewInt(now.UnixNano()),
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(CRLValidity),
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, signingCert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the CRL: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemCRLType, Bytes: der}), nil
+}
+
+// revokedCertificates returns the entries of the CRL of the issuer, sorted by serial number. The certificates
+// revoked by serial number are listed in the CRLs of all the issuers. The lock must be held.
+func (s *revocationState) revokedCertificates(now time.Time, issuer string) ([]pkix.RevokedCertificate, error) {
+	entries := map[string]pkix.RevokedCertificate{}
+	add := func(serial *big.Int, r Revocation) error {
+		reason, err := asn1.Marshal(asn1.Enumerated(revocationReasons[r.reason()]))
+		if err != nil {
+			return err
+		}
+		revokedAt := r.RevokedAt
+		if revokedAt.IsZero() {
+			revokedAt = now
+		}
+		entries[serial.Text(16)] = pkix.RevokedCertificate{
+			SerialNumber:   serial,
+			RevocationTime: revokedAt.UTC(),
+			Extensions:     []pkix.Extension{{Id: oidReasonCode, Value: reason}},
+		}
+		return nil
+	}
+	for _, r := range s.revocations {
+		if r.SerialNumber == "" {
+			for _, c := range s.issued[r.Identity] {
+				if c.issuer == issuer && c.notAfter.After(now) {
+					if err := add(c.serialNumber, r); err != nil {
+						return nil, err
+					}
+				}
+			}
+			continue
+		}
+		serial, err := ParseSerialNumber(r.SerialNumber)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(serial, r); err != nil {
+			return nil, err
+		}
+	}
+
+	revoked := make([]pkix.RevokedCertificate, 0, len(entries))
+	for _, e := range entries {
+		revoked = append(revoked, e)
+	}
+	sort.Slice(revoked, func(i, j int) bool {
+		return revoked[i].SerialNumber.Cmp(revoked[j].SerialNumber) < 0
+	})
+	return revoked, nil
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil
+}
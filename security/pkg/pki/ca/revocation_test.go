@@ -0,0 +1,321 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	caerror "istio.io/istio/security/pkg/pki/error"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+func createSelfSignedCA(t *testing.T) *IstioCA {
+	t.Helper()
+	certBytes, keyBytes, err := util.GenCertKeyFromOptions(util.CertOptions{
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		Org:          "Root CA",
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := util.NewVerifiedKeyCertBundleFromPem(certBytes, keyBytes, nil, certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := NewIstioCA(&IstioCAOptions{
+		DefaultCertTTL: time.Hour,
+		MaxCertTTL:     time.Hour,
+		KeyCertBundle:  bundle,
+		RotatorConfig:  &SelfSignedCARootCertRotatorConfig{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func signWorkload(t *testing.T, ca *IstioCA, id string) *x509.Certificate {
+	t.Helper()
+	csrPEM, _, err := util.GenCSR(util.CertOptions{Host: id, RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := ca.Sign(csrPEM, []string{id}, time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := util.ParsePemEncodedCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func parseCRL(t *testing.T, crlPEM []byte) *x509.RevocationList {
+	t.Helper()
+	block, _ := pem.Decode(crlPEM)
+	if block == nil || block.Type != pemCRLType {
+		t.Fatalf("expected a PEM encoded CRL, got %q", crlPEM)
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crl
+}
+
+func TestParseRevocations(t *testing.T) {
+	revokedAt := time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name string
+		data string
+		want []Revocation
+		err  string
+	}{
+		{
+			name: "empty",
+			data: "",
+		},
+		{
+			name: "serial number and identity",
+			data: `[{"serialNumber": "0a:1B", "reason": "keyCompromise", "revokedAt": "2021-05-01T10:00:00Z"},
+				{"identity": "spiffe://cluster.local/ns/default/sa/bad"}]`,
+			want: []Revocation{
+				{SerialNumber: "0a:1B", Reason: "keyCompromise", RevokedAt: revokedAt},
+				{Identity: "spiffe://cluster.local/ns/default/sa/bad"},
+			},
+		},
+		{
+			name: "both serial number and identity",
+			data: `[{"serialNumber": "0a", "identity": "spiffe://cluster.local/ns/default/sa/bad"}]`,
+			err:  "either a serial number or an identity",
+		},
+		{
+			name: "invalid serial number",
+			data: `[{"serialNumber": "xyz"}]`,
+			err:  "invalid serial number",
+		},
+		{
+			name: "unknown reason",
+			data: `[{"serialNumber": "0a", "reason": "lost"}]`,
+			err:  "unknown revocation reason",
+		},
+		{
+			name: "invalid JSON",
+			data: `{`,
+			err:  "failed to parse",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRevocations(tt.data)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			data, err := MarshalRevocations(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if roundTrip, err := ParseRevocations(data); err != nil || len(roundTrip) != len(got) {
+				t.Errorf("failed to parse the marshaled revocations %q: %v", data, err)
+			}
+		})
+	}
+}
+
+func TestSignRevokedIdentity(t *testing.T) {
+	ca := createSelfSignedCA(t)
+	revoked := "spiffe://cluster.local/ns/default/sa/bad"
+	ca.SetRevocations([]Revocation{{Identity: revoked}}, nil)
+
+	csrPEM, _, err := util.GenCSR(util.CertOptions{Host: revoked, RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ca.Sign(csrPEM, []string{revoked}, time.Hour, false)
+	if err == nil {
+		t.Fatalf("expected the CA to refuse to sign a certificate for a revoked identity")
+	}
+	if caErr, ok := err.(*caerror.Error); !ok || caErr.ErrorType() != "REVOKED_IDENTITY" {
+		t.Errorf("got error %v, want a REVOKED_IDENTITY error", err)
+	}
+
+	signWorkload(t, ca, "spiffe://cluster.local/ns/default/sa/good")
+}
+
+func TestCRL(t *testing.T) {
+	ca := createSelfSignedCA(t)
+	if crl, err := ca.CRL(); err != nil || crl != nil {
+		t.Fatalf("got CRL %q, error %v, want none without revocations", crl, err)
+	}
+
+	bad := signWorkload(t, ca, "spiffe://cluster.local/ns/default/sa/bad")
+	good := signWorkload(t, ca, "spiffe://cluster.local/ns/default/sa/good")
+	revokedAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+	ca.SetRevocations([]Revocation{
+		{Identity: "spiffe://cluster.local/ns/default/sa/bad", Reason: "keyCompromise", RevokedAt: revokedAt},
+		{SerialNumber: "1f", RevokedAt: revokedAt},
+	}, nil)
+
+	crlPEM, err := ca.CRL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl := parseCRL(t, crlPEM)
+	signingCert, _, _, _ := ca.GetCAKeyCertBundle().GetAll()
+	if err := crl.CheckSignatureFrom(signingCert); err != nil {
+		t.Errorf("CRL is not signed by the CA: %v", err)
+	}
+	if crl.NextUpdate.Sub(crl.ThisUpdate) != CRLValidity {
+		t.Errorf("got CRL validity %v, want %v", crl.NextUpdate.Sub(crl.ThisUpdate), CRLValidity)
+	}
+	serials := map[string]time.Time{}
+	// nolint: staticcheck
+	for _, r := range crl.RevokedCertificates {
+		serials[r.SerialNumber.Text(16)] = r.RevocationTime
+	}
+	want := map[string]time.Time{
+		bad.SerialNumber.Text(16): revokedAt.UTC(),
+		big.NewInt(0x1f).Text(16): revokedAt.UTC(),
+	}
+	if len(serials) != len(want) {
+		t.Errorf("got revoked serial numbers %v, want %v", serials, want)
+	}
+	for serial, at := range want {
+		if !serials[serial].Equal(at) {
+			t.Errorf("serial number %s: got revocation time %v, want %v", serial, serials[serial], at)
+		}
+	}
+	if _, f := serials[good.SerialNumber.Text(16)]; f {
+		t.Errorf("certificate of a valid identity is revoked")
+	}
+
+	// The CRL is cached until the revocations change.
+	if again, _ := ca.CRL(); string(again) != string(crlPEM) {
+		t.Errorf("expected the CRL to be cached")
+	}
+	ca.SetRevocations(nil, nil)
+	if crl, err := ca.CRL(); err != nil || crl != nil {
+		t.Errorf("got CRL %q, error %v, want none once the revocations are removed", crl, err)
+	}
+}
+
+func TestCRLIntermediateCA(t *testing.T) {
+	ca, err := createCA(time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.SetRevocations([]Revocation{{SerialNumber: "1f"}}, nil)
+	if _, err := ca.CRL(); err == nil || !strings.Contains(err.Error(), ParentCRLConfigMapKey) {
+		t.Errorf("got error %v, want the CRLs of the parent CAs to be required", err)
+	}
+
+	parentCRL := []byte("-----BEGIN X509 CRL-----\nparent\n-----END X509 CRL-----\n")
+	ca.SetRevocations([]Revocation{{SerialNumber: "1f"}}, parentCRL)
+	crlPEM, err := ca.CRL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parseCRL(t, crlPEM)
+	if !strings.HasSuffix(string(crlPEM), string(parentCRL)) {
+		t.Errorf("expected the CRL to be followed by the CRLs of the parent CAs, got %q", crlPEM)
+	}
+}
+
+func TestCRLPerIssuer(t *testing.T) {
+	ca := createSelfSignedCA(t)
+	oldSigningCert, _, _, _ := ca.GetCAKeyCertBundle().GetAll()
+	bad := signWorkload(t, ca, "spiffe://cluster.local/ns/default/sa/bad")
+
+	// Rotate the signing certificate of the CA, the certificate issued before is still valid.
+	certBytes, keyBytes, err := util.GenCertKeyFromOptions(util.CertOptions{
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		Org:          "New Root CA",
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.GetCAKeyCertBundle().VerifyAndSetAll(certBytes, keyBytes, nil, certBytes); err != nil {
+		t.Fatal(err)
+	}
+	newSigningCert, _, _, _ := ca.GetCAKeyCertBundle().GetAll()
+	signWorkload(t, ca, "spiffe://cluster.local/ns/default/sa/good")
+	ca.SetRevocations([]Revocation{{Identity: "spiffe://cluster.local/ns/default/sa/bad"}}, nil)
+
+	crlPEM, err := ca.CRL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var crls []*x509.RevocationList
+	for block, rest := pem.Decode(crlPEM); block != nil; block, rest = pem.Decode(rest) {
+		crls = append(crls, parseCRL(t, pem.EncodeToMemory(block)))
+	}
+	if len(crls) != 2 {
+		t.Fatalf("got %d CRLs, want one for each signing certificate", len(crls))
+	}
+	if err := crls[0].CheckSignatureFrom(newSigningCert); err != nil {
+		t.Errorf("first CRL is not signed by the current CA certificate: %v", err)
+	}
+	// nolint: staticcheck
+	if len(crls[0].RevokedCertificates) != 0 {
+		t.Errorf("got revoked certificates %v in the CRL of the current CA certificate, want none", crls[0].RevokedCertificates)
+	}
+	if err := crls[1].CheckSignatureFrom(oldSigningCert); err != nil {
+		t.Errorf("second CRL is not signed by the previous CA certificate: %v", err)
+	}
+	// nolint: staticcheck
+	if len(crls[1].RevokedCertificates) != 1 || crls[1].RevokedCertificates[0].SerialNumber.Cmp(bad.SerialNumber) != 0 {
+		t.Errorf("got revoked certificates %v in the CRL of the previous CA certificate, want %v",
+			crls[1].RevokedCertificates, bad.SerialNumber) // nolint: staticcheck
+	}
+}
+
+func TestPruneIssued(t *testing.T) {
+	ca := createSelfSignedCA(t)
+	signWorkload(t, ca, "spiffe://cluster.local/ns/default/sa/a")
+	signWorkload(t, ca, "spiffe://cluster.local/ns/default/sa/b")
+
+	s := &ca.revocations
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.issued) != 2 || len(s.signers) != 1 {
+		t.Fatalf("got %d identities and %d signers, want 2 and 1", len(s.issued), len(s.signers))
+	}
+	s.prune(time.Now().Add(2 * time.Hour))
+	if len(s.issued) != 0 || len(s.signers) != 0 {
+		t.Errorf("got %d identities and %d signers once their certificates expired, want none", len(s.issued), len(s.signers))
+	}
+}
@@ -32,6 +32,8 @@ const (
 	CAIllegalConfig
 	// CAInitFail means some other unexpected and fatal initilization failure
 	CAInitFail
+	// RevokedIdentity means the CA refuses to sign a certificate for a revoked identity.
+	RevokedIdentity
 )
 
 // Error encapsulates the short and long errors.
@@ -56,6 +58,8 @@ func (e Error) ErrorType() string {
 		return "TTL_ERROR"
 	case CertGenError:
 		return "CERT_GEN_ERROR"
+	case RevokedIdentity:
+		return "REVOKED_IDENTITY"
 	}
 	return "UNKNOWN"
 }
@@ -71,6 +75,8 @@ func (e Error) HTTPErrorCode() codes.Code {
 		return codes.InvalidArgument
 	case TTLError:
 		return codes.InvalidArgument
+	case RevokedIdentity:
+		return codes.PermissionDenied
 	}
 	return codes.Internal
 }
@@ -0,0 +1,235 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit records the certificate signing requests handled by the CA server, as JSON lines written to
+// sinks, and keeps the most recent records in memory for debugging.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"istio.io/pkg/log"
+	"istio.io/pkg/monitoring"
+)
+
+var auditLog = log.RegisterScope("caaudit", "CA audit log", 0)
+
+// Names of the sinks, as reported in the sink label of the metrics.
+const (
+	fileSinkName = "file"
+	httpSinkName = "http"
+)
+
+var (
+	sinkTag = monitoring.MustCreateLabel("sink")
+
+	droppedRecords = monitoring.NewSum(
+		"citadel_server_audit_records_dropped_count",
+		"The number of audit records which could not be written to a sink.",
+		monitoring.WithLabels(sinkTag),
+	)
+)
+
+func init() {
+	monitoring.MustRegister(droppedRecords)
+}
+
+// Results of the signing requests.
+const (
+	// Issued means a certificate was signed.
+	Issued = "issued"
+	// Denied means the request was refused, because the caller failed to authenticate or the CA could not sign.
+	Denied = "denied"
+)
+
+// Record is a signing request handled by the CA server.
+type Record struct {
+	Time   time.Time `json:"time"`
+	Result string    `json:"result"`
+	// Error is the reason of a denied request.
+	Error string `json:"error,omitempty"`
+	// Identities are the authenticated identities of the caller, which are the SANs of the issued certificate.
+	Identities []string `json:"identities,omitempty"`
+	// Authenticator is the type of the authenticator that authenticated the caller.
+	Authenticator string `json:"authenticator,omitempty"`
+	// RequestedSANs are the SANs of the CSR.
+	RequestedSANs []string `json:"requestedSANs,omitempty"`
+	// SerialNumber of the issued certificate, in hexadecimal.
+	SerialNumber string `json:"serialNumber,omitempty"`
+	// RequestedTTL is the TTL of the request, 0 for the default TTL of the CA.
+	RequestedTTL Duration `json:"requestedTTL"`
+	// TTL is the validity of the issued certificate.
+	TTL           Duration  `json:"ttl,omitempty"`
+	NotAfter      time.Time `json:"notAfter,omitempty"`
+	ClientAddress string    `json:"clientAddress"`
+}
+
+// Duration is a time.Duration marshaled in JSON as a string, for example "24h0m0s".
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", s, err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Sink receives the records of the audit log.
+type Sink interface {
+	// Write writes a record, as a JSON line.
+	Write(line []byte) error
+	Close() error
+}
+
+func sinkName(s Sink) string {
+	switch s.(type) {
+	case *FileSink:
+		return fileSinkName
+	case *HTTPSink:
+		return httpSinkName
+	default:
+		return fmt.Sprintf("%T", s)
+	}
+}
+
+// Filter selects the records returned by Log.Recent.
+type Filter struct {
+	// Identity only selects the records of a caller identity, if set.
+	Identity string
+	// Result only selects the records with this result, if set.
+	Result string
+	// Limit is the maximum number of records, 0 for all the records kept in memory.
+	Limit int
+}
+
+func (f Filter) matches(r *Record) bool {
+	if f.Result != "" && r.Result != f.Result {
+		return false
+	}
+	if f.Identity == "" {
+		return true
+	}
+	for _, id := range r.Identities {
+		if id == f.Identity {
+			return true
+		}
+	}
+	return false
+}
+
+// Log writes the records to its sinks, and keeps the most recent ones in memory. It is safe for concurrent use.
+type Log struct {
+	sinks []Sink
+
+	mu     sync.Mutex
+	recent []Record
+	next   int
+	full   bool
+}
+
+// New returns a Log keeping the recentSize most recent records in memory.
+func New(recentSize int, sinks ...Sink) *Log {
+	if recentSize < 0 {
+		recentSize = 0
+	}
+	return &Log{
+		sinks:  sinks,
+		recent: make([]Record, recentSize),
+	}
+}
+
+// Add records a signing request. The sinks failing to write the record are logged.
+func (l *Log) Add(r Record) {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	r.Time = r.Time.UTC()
+	if len(l.sinks) > 0 {
+		line, err := json.Marshal(r)
+		if err != nil {
+			auditLog.Errorf("failed to marshal the audit record: %v", err)
+		} else {
+			line = append(line, '\n')
+			for _, s := range l.sinks {
+				if err := s.Write(line); err != nil {
+					auditLog.Errorf("dropped the audit record of the request of %v from %v, failed to write it to the %s sink: %v",
+						r.Identities, r.ClientAddress, sinkName(s), err)
+					droppedRecords.With(sinkTag.Value(sinkName(s))).Increment()
+				}
+			}
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.recent) == 0 {
+		return
+	}
+	l.recent[l.next] = r
+	l.next = (l.next + 1) % len(l.recent)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Recent returns the records kept in memory selected by the filter, the most recent first.
+func (l *Log) Recent(f Filter) []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.recent)
+	}
+	out := []Record{}
+	for i := 0; i < n; i++ {
+		r := &l.recent[(l.next-1-i+len(l.recent))%len(l.recent)]
+		if !f.matches(r) {
+			continue
+		}
+		out = append(out, *r)
+		if f.Limit > 0 && len(out) == f.Limit {
+			break
+		}
+	}
+	return out
+}
+
+// Close closes the sinks.
+func (l *Log) Close() error {
+	var errs []error
+	for _, s := range l.sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close the audit sinks: %v", errs)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+)
+
+func record(serial string, identities ...string) Record {
+	return Record{
+		Time:          time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC),
+		Result:        Issued,
+		Identities:    identities,
+		Authenticator: "ClientCertAuthenticator",
+		RequestedSANs: identities,
+		SerialNumber:  serial,
+		TTL:           Duration(24 * time.Hour),
+		NotAfter:      time.Date(2021, 5, 2, 10, 0, 0, 0, time.UTC),
+		ClientAddress: "10.0.0.1:4321",
+	}
+}
+
+func serials(records []Record) []string {
+	out := []string{}
+	for _, r := range records {
+		out = append(out, r.SerialNumber)
+	}
+	return out
+}
+
+func TestRecent(t *testing.T) {
+	l := New(3)
+	if got := l.Recent(Filter{}); len(got) != 0 {
+		t.Fatalf("got records %v, want none", got)
+	}
+	l.Add(record("1", "a"))
+	l.Add(record("2", "b"))
+	if got, want := serials(l.Recent(Filter{})), []string{"2", "1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	l.Add(record("3", "a"))
+	l.Add(record("4", "a"))
+	denied := record("", "b")
+	denied.Result = Denied
+	l.Add(denied)
+
+	cases := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"all", Filter{}, []string{"", "4", "3"}},
+		{"limit", Filter{Limit: 2}, []string{"", "4"}},
+		{"identity", Filter{Identity: "a"}, []string{"4", "3"}},
+		{"identity and limit", Filter{Identity: "a", Limit: 1}, []string{"4"}},
+		{"result", Filter{Result: Issued}, []string{"4", "3"}},
+		{"unknown identity", Filter{Identity: "c"}, []string{}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serials(l.Recent(tt.filter)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordJSON(t *testing.T) {
+	r := record("1f", "spiffe://cluster.local/ns/default/sa/test")
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["ttl"] != "24h0m0s" || fields["requestedTTL"] != "0s" {
+		t.Errorf("unexpected durations in %s", b)
+	}
+	var got Record
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, r) {
+		t.Errorf("got %+v, want %+v", got, r)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l := NewFromOptions(Options{FileOptions: FileOptions{Path: path}})
+	l.Add(record("1", "a"))
+	l.Add(record("2", "b"))
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.Recent(Filter{}); len(got) != 0 {
+		t.Errorf("got records %v kept in memory, want none", got)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, r.SerialNumber)
+	}
+	if want := []string{"1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got serial numbers %v, want %v", got, want)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var mu sync.Mutex
+	var body bytes.Buffer
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		body.Write(b)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	l := NewFromOptions(Options{HTTPEndpoint: srv.URL, RecentSize: 10})
+	for _, serial := range []string{"1", "2", "3"} {
+		l.Add(record(serial, "a"))
+	}
+	// Close waits for the buffered records to be posted.
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var got []string
+	dec := json.NewDecoder(&body)
+	for dec.More() {
+		var r Record
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r.SerialNumber)
+	}
+	if want := []string{"1", "2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got serial numbers %v, want %v", got, want)
+	}
+}
+
+func droppedCount(t *testing.T, sink string) float64 {
+	t.Helper()
+	rows, err := view.RetrieveData("citadel_server_audit_records_dropped_count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		for _, tag := range row.Tags {
+			if tag.Key.Name() == "sink" && tag.Value == sink {
+				return row.Data.(*view.SumData).Value
+			}
+		}
+	}
+	return 0
+}
+
+func TestHTTPSinkDrops(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	before := droppedCount(t, httpSinkName)
+	sink := newHTTPSink(srv.URL, 1, 10*time.Millisecond)
+	l := New(0, sink)
+	// The first record is being posted and the second one fills the buffer, so the third one is dropped once
+	// the write times out.
+	l.Add(record("1"))
+	for len(sink.lines) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	l.Add(record("2"))
+	l.Add(record("3"))
+	if got := droppedCount(t, httpSinkName) - before; got != 1 {
+		t.Errorf("got %v dropped records, want 1", got)
+	}
+
+	// The records which could not be posted are dropped too.
+	close(release)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := droppedCount(t, httpSinkName) - before; got != 3 {
+		t.Errorf("got %v dropped records, want 3", got)
+	}
+}
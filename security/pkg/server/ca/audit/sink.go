@@ -0,0 +1,195 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// FileOptions configures a FileSink.
+type FileOptions struct {
+	// Path of the file.
+	Path string
+	// MaxSizeMB is the size of the file in megabytes before it is rotated, 100 if 0.
+	MaxSizeMB int
+	// MaxBackups is the maximum number of rotated files to keep, all if 0.
+	MaxBackups int
+	// MaxAgeDays is the maximum number of days to keep the rotated files, forever if 0.
+	MaxAgeDays int
+}
+
+// FileSink writes the records to a file, rotated when it reaches its maximum size.
+type FileSink struct {
+	logger *lumberjack.Logger
+}
+
+var _ Sink = &FileSink{}
+
+// NewFileSink returns a FileSink, creating the file on the first record.
+func NewFileSink(opts FileOptions) *FileSink {
+	return &FileSink{
+		logger: &lumberjack.Logger{
+			Filename:   opts.Path,
+			MaxSize:    opts.MaxSizeMB,
+			MaxBackups: opts.MaxBackups,
+			MaxAge:     opts.MaxAgeDays,
+		},
+	}
+}
+
+// Write implements Sink.
+func (s *FileSink) Write(line []byte) error {
+	_, err := s.logger.Write(line)
+	return err
+}
+
+// Close implements Sink.
+func (s *FileSink) Close() error {
+	return s.logger.Close()
+}
+
+const (
+	httpSinkBufferSize   = 1000
+	httpSinkBatchSize    = 100
+	httpSinkTimeout      = 10 * time.Second
+	httpSinkWriteTimeout = time.Second
+)
+
+// HTTPSink posts the records to an HTTP endpoint, in batches of JSON lines. The records are posted in the
+// background so that signing requests are not blocked by the endpoint. When the endpoint doesn't keep up and
+// the buffer is full, writes wait for up to a second before the record is dropped; dropped records are logged
+// and counted in the citadel_server_audit_records_dropped_count metric.
+type HTTPSink struct {
+	endpoint     string
+	client       *http.Client
+	writeTimeout time.Duration
+	lines        chan []byte
+	done         chan struct{}
+	once         sync.Once
+}
+
+var _ Sink = &HTTPSink{}
+
+// NewHTTPSink returns an HTTPSink posting to the endpoint.
+func NewHTTPSink(endpoint string) *HTTPSink {
+	return newHTTPSink(endpoint, httpSinkBufferSize, httpSinkWriteTimeout)
+}
+
+func newHTTPSink(endpoint string, bufferSize int, writeTimeout time.Duration) *HTTPSink {
+	s := &HTTPSink{
+		endpoint:     endpoint,
+		client:       &http.Client{Timeout: httpSinkTimeout},
+		writeTimeout: writeTimeout,
+		lines:        make(chan []byte, bufferSize),
+		done:         make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write implements Sink. It waits for room in the buffer for up to the write timeout.
+func (s *HTTPSink) Write(line []byte) error {
+	select {
+	case s.lines <- line:
+		return nil
+	default:
+	}
+	timer := time.NewTimer(s.writeTimeout)
+	defer timer.Stop()
+	select {
+	case s.lines <- line:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("the buffer of %s is full, it is not keeping up", s.endpoint)
+	}
+}
+
+// Close implements Sink. It posts the buffered records before returning.
+func (s *HTTPSink) Close() error {
+	s.once.Do(func() {
+		close(s.lines)
+	})
+	<-s.done
+	return nil
+}
+
+func (s *HTTPSink) run() {
+	defer close(s.done)
+	for line := range s.lines {
+		batch := bytes.NewBuffer(line)
+		for n := 1; n < httpSinkBatchSize; n++ {
+			next, ok := s.nextLine()
+			if !ok {
+				break
+			}
+			batch.Write(next)
+		}
+		if err := s.post(batch.Bytes()); err != nil {
+			lines := bytes.Count(batch.Bytes(), []byte{'\n'})
+			auditLog.Errorf("dropped %d audit records, failed to post them to %s: %v", lines, s.endpoint, err)
+			droppedRecords.With(sinkTag.Value(httpSinkName)).Record(float64(lines))
+		}
+	}
+}
+
+// nextLine returns the next buffered line, without waiting.
+func (s *HTTPSink) nextLine() ([]byte, bool) {
+	select {
+	case line, ok := <-s.lines:
+		return line, ok
+	default:
+		return nil, false
+	}
+}
+
+func (s *HTTPSink) post(body []byte) error {
+	resp, err := s.client.Post(s.endpoint, "application/x-ndjson", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Options configures the audit log.
+type Options struct {
+	// FileOptions configures the file sink, disabled if the path is empty.
+	FileOptions
+	// HTTPEndpoint is the URL the records are posted to, disabled if empty.
+	HTTPEndpoint string
+	// RecentSize is the number of recent records kept in memory.
+	RecentSize int
+}
+
+// NewFromOptions returns the Log configured by the options.
+func NewFromOptions(opts Options) *Log {
+	var sinks []Sink
+	if opts.Path != "" {
+		sinks = append(sinks, NewFileSink(opts.FileOptions))
+	}
+	if opts.HTTPEndpoint != "" {
+		sinks = append(sinks, NewHTTPSink(opts.HTTPEndpoint))
+	}
+	return New(opts.RecentSize, sinks...)
+}
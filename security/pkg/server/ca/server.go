@@ -28,6 +28,7 @@ import (
 	"istio.io/istio/pkg/security"
 	caerror "istio.io/istio/security/pkg/pki/error"
 	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/istio/security/pkg/server/ca/audit"
 	"istio.io/pkg/log"
 )
 
@@ -51,6 +52,8 @@ type Server struct {
 	Authenticators []security.Authenticator
 	ca             CertificateAuthority
 	serverCertTTL  time.Duration
+	// AuditLog records the signing requests, if set.
+	AuditLog *audit.Log
 }
 
 func getConnectionAddress(ctx context.Context) string {
@@ -71,9 +74,10 @@ func getConnectionAddress(ctx context.Context) string {
 func (s *Server) CreateCertificate(ctx context.Context, request *pb.IstioCertificateRequest) (
 	*pb.IstioCertificateResponse, error) {
 	s.monitoring.CSR.Increment()
-	caller := Authenticate(ctx, s.Authenticators)
+	caller, authenticator := authenticateCaller(ctx, s.Authenticators)
 	if caller == nil {
 		s.monitoring.AuthnError.Increment()
+		s.recordAudit(ctx, request, &audit.Record{Result: audit.Denied, Error: "request authenticate failure"})
 		return nil, status.Error(codes.Unauthenticated, "request authenticate failure")
 	}
 
@@ -85,6 +89,12 @@ func (s *Server) CreateCertificate(ctx context.Context, request *pb.IstioCertifi
 	if signErr != nil {
 		serverCaLog.Errorf("CSR signing error (%v)", signErr.Error())
 		s.monitoring.GetCertSignError(signErr.(*caerror.Error).ErrorType()).Increment()
+		s.recordAudit(ctx, request, &audit.Record{
+			Result:        audit.Denied,
+			Error:         signErr.Error(),
+			Identities:    caller.Identities,
+			Authenticator: authenticator,
+		})
 		return nil, status.Errorf(signErr.(*caerror.Error).HTTPErrorCode(), "CSR signing error (%v)", signErr.(*caerror.Error))
 	}
 	respCertChain := []string{string(cert)}
@@ -97,9 +107,41 @@ func (s *Server) CreateCertificate(ctx context.Context, request *pb.IstioCertifi
 	}
 	s.monitoring.Success.Increment()
 	serverCaLog.Debug("CSR successfully signed.")
+	s.recordAudit(ctx, request, issuedRecord(cert, caller.Identities, authenticator))
 	return response, nil
 }
 
+// issuedRecord returns the audit record of an issued certificate.
+func issuedRecord(cert []byte, identities []string, authenticator string) *audit.Record {
+	r := &audit.Record{
+		Result:        audit.Issued,
+		Identities:    identities,
+		Authenticator: authenticator,
+	}
+	c, err := util.ParsePemEncodedCertificate(cert)
+	if err != nil {
+		serverCaLog.Warnf("failed to parse the issued certificate for the audit log: %v", err)
+		return r
+	}
+	r.SerialNumber = fmt.Sprintf("%x", c.SerialNumber)
+	r.TTL = audit.Duration(c.NotAfter.Sub(c.NotBefore))
+	r.NotAfter = c.NotAfter
+	return r
+}
+
+// recordAudit completes the record with the request and adds it to the audit log, if enabled.
+func (s *Server) recordAudit(ctx context.Context, request *pb.IstioCertificateRequest, r *audit.Record) {
+	if s.AuditLog == nil {
+		return
+	}
+	r.ClientAddress = getConnectionAddress(ctx)
+	r.RequestedTTL = audit.Duration(time.Duration(request.ValidityDuration) * time.Second)
+	if csr, err := util.ParsePemEncodedCSR([]byte(request.Csr)); err == nil {
+		r.RequestedSANs, _ = util.ExtractIDs(csr.Extensions)
+	}
+	s.AuditLog.Add(*r)
+}
+
 func recordCertsExpiry(keyCertBundle *util.KeyCertBundle) {
 	rootCertExpiry, err := keyCertBundle.ExtractRootCertExpiryTimestamp()
 	if err != nil {
@@ -139,9 +181,15 @@ func New(ca CertificateAuthority, ttl time.Duration,
 	return server, nil
 }
 
-// authenticate goes through a list of authenticators (provided client cert, k8s jwt, and ID token)
+// Authenticate goes through a list of authenticators (provided client cert, k8s jwt, and ID token)
 // and authenticates if one of them is valid.
 func Authenticate(ctx context.Context, auth []security.Authenticator) *security.Caller {
+	caller, _ := authenticateCaller(ctx, auth)
+	return caller
+}
+
+// authenticateCaller is Authenticate, also returning the type of the authenticator that authenticated the caller.
+func authenticateCaller(ctx context.Context, auth []security.Authenticator) (*security.Caller, string) {
 	// TODO: apply different authenticators in specific order / according to configuration.
 	var errMsg string
 	for id, authn := range auth {
@@ -151,9 +199,9 @@ func Authenticate(ctx context.Context, auth []security.Authenticator) *security.
 		}
 		if u != nil && err == nil {
 			serverCaLog.Debugf("Authentication successful through auth source %v", u.AuthSource)
-			return u
+			return u, authn.AuthenticatorType()
 		}
 	}
 	serverCaLog.Warnf("Authentication failed for %v: %s", getConnectionAddress(ctx), errMsg)
-	return nil
+	return nil, ""
 }
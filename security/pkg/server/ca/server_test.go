@@ -20,7 +20,9 @@ import (
 	"crypto/x509/pkix"
 	"fmt"
 	"net"
+	"reflect"
 	"testing"
+	"time"
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
@@ -33,6 +35,7 @@ import (
 	mockca "istio.io/istio/security/pkg/pki/ca/mock"
 	caerror "istio.io/istio/security/pkg/pki/error"
 	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/istio/security/pkg/server/ca/audit"
 	"istio.io/istio/security/pkg/server/ca/authenticate"
 )
 
@@ -213,6 +216,11 @@ func TestCreateCertificate(t *testing.T) {
 			ca:             &mockca.FakeCA{SignErr: caerror.NewError(caerror.TTLError, fmt.Errorf("cannot sign"))},
 			code:           codes.InvalidArgument,
 		},
+		"Revoked identity": {
+			authenticators: []security.Authenticator{&mockAuthenticator{}},
+			ca:             &mockca.FakeCA{SignErr: caerror.NewError(caerror.RevokedIdentity, fmt.Errorf("cannot sign"))},
+			code:           codes.PermissionDenied,
+		},
 		"Failed to sign": {
 			authenticators: []security.Authenticator{&mockAuthenticator{}},
 			ca:             &mockca.FakeCA{SignErr: caerror.NewError(caerror.CertGenError, fmt.Errorf("cannot sign"))},
@@ -257,3 +265,79 @@ func TestCreateCertificate(t *testing.T) {
 		}
 	}
 }
+
+func TestCreateCertificateAudit(t *testing.T) {
+	certPEM, _, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Host:         "spiffe://cluster.local/ns/default/sa/test",
+		TTL:          time.Hour,
+		IsSelfSigned: true,
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM, _, err := util.GenCSR(util.CertOptions{
+		Host:       "spiffe://cluster.local/ns/default/sa/test",
+		RSAKeySize: 2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := util.ParsePemEncodedCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auditLog := audit.New(10)
+	identities := []string{"spiffe://cluster.local/ns/default/sa/test"}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.IPAddr{IP: net.IPv4(192, 168, 1, 1)}})
+	request := &pb.IstioCertificateRequest{Csr: string(csrPEM), ValidityDuration: 3600}
+	for _, server := range []*Server{
+		{
+			ca:             &mockca.FakeCA{SignErr: caerror.NewError(caerror.CSRError, fmt.Errorf("cannot sign"))},
+			Authenticators: []security.Authenticator{&mockAuthenticator{identities: identities}},
+		},
+		{
+			ca:             &mockca.FakeCA{},
+			Authenticators: []security.Authenticator{&mockAuthenticator{errMsg: "Not authorized"}},
+		},
+		{
+			ca: &mockca.FakeCA{
+				SignedCert:    certPEM,
+				KeyCertBundle: util.NewKeyCertBundleFromPem(nil, nil, nil, []byte("root_cert")),
+			},
+			Authenticators: []security.Authenticator{&mockAuthenticator{identities: identities}},
+		},
+	} {
+		server.monitoring = newMonitoringMetrics()
+		server.AuditLog = auditLog
+		_, _ = server.CreateCertificate(ctx, request)
+	}
+
+	records := auditLog.Recent(audit.Filter{})
+	if len(records) != 3 {
+		t.Fatalf("got %d audit records, want 3", len(records))
+	}
+	issued := records[0]
+	issued.Time = time.Time{}
+	want := audit.Record{
+		Result:        audit.Issued,
+		Identities:    identities,
+		Authenticator: "mockAuthenticator",
+		RequestedSANs: identities,
+		SerialNumber:  fmt.Sprintf("%x", cert.SerialNumber),
+		RequestedTTL:  audit.Duration(time.Hour),
+		TTL:           audit.Duration(cert.NotAfter.Sub(cert.NotBefore)),
+		NotAfter:      cert.NotAfter,
+		ClientAddress: "192.168.1.1",
+	}
+	if !reflect.DeepEqual(issued, want) {
+		t.Errorf("got issued record %+v, want %+v", issued, want)
+	}
+	if r := records[1]; r.Result != audit.Denied || r.Authenticator != "" || r.Error != "request authenticate failure" {
+		t.Errorf("unexpected record of an unauthenticated request: %+v", r)
+	}
+	if r := records[2]; r.Result != audit.Denied || r.Authenticator != "mockAuthenticator" || r.SerialNumber != "" {
+		t.Errorf("unexpected record of a failed signing: %+v", r)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Provide a stand-in external CA, to test agents configured with CA_PROVIDER=ExternalCA.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"istio.io/istio/security/pkg/nodeagent/caclient/providers/external/server"
+)
+
+var (
+	listen      = flag.String("listen", "localhost:15012", "Address to serve the CA on.")
+	signingCert = flag.String("signing-cert", "", "CA certificate file (PEM encoded). Generated if empty.")
+	signingKey  = flag.String("signing-key", "", "CA private key file (PEM encoded).")
+	tlsCert     = flag.String("tls-cert", "", "Serving certificate file. Generated for localhost if empty.")
+	tlsKey      = flag.String("tls-key", "", "Serving private key file.")
+	clientCA    = flag.String("client-ca", "", "Roots verifying the client certificates. Enables mTLS if set.")
+	headers     = flag.String("required-headers", "", "Comma separated key=value headers required on each request.")
+	maxTTL      = flag.Duration("max-ttl", 24*time.Hour, "Maximum lifetime of the issued certificates.")
+	outRootCert = flag.String("out-root-cert", "", "File to write the CA certificate to, for CA_ROOT_CA.")
+)
+
+func main() {
+	flag.Parse()
+
+	required := map[string]string{}
+	if *headers != "" {
+		for _, kv := range strings.Split(*headers, ",") {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				log.Fatalf("invalid header %q, expected key=value", kv)
+			}
+			required[strings.ToLower(parts[0])] = parts[1]
+		}
+	}
+	s, err := server.New(server.Options{
+		SigningCertFile: *signingCert,
+		SigningKeyFile:  *signingKey,
+		TLSCertFile:     *tlsCert,
+		TLSKeyFile:      *tlsKey,
+		ClientCAFile:    *clientCA,
+		RequiredHeaders: required,
+		MaxTTL:          *maxTTL,
+	})
+	if err != nil {
+		log.Fatalf("failed to create the CA: %v", err)
+	}
+	if *outRootCert != "" {
+		if err := ioutil.WriteFile(*outRootCert, s.RootCertPem(), 0644); err != nil {
+			log.Fatalf("failed to write the CA certificate: %v", err)
+		}
+	}
+	if err := s.Start(*listen); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("stand-in external CA listening on %s", s.Address())
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	s.Stop()
+}
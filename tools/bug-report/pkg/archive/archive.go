@@ -17,8 +17,11 @@ package archive
 import (
 	"archive/tar"
 	"compress/gzip"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -114,6 +117,132 @@ func Create(srcDir, outPath string) error {
 	})
 }
 
+// Read returns the files of an archive created by Create, keyed by their slash separated path relative to the
+// output root dir, for example "cluster/crs". archivePath is either the archive or the dir it was extracted to.
+func Read(archivePath string) (map[string]string, error) {
+	fi, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	if fi.IsDir() {
+		err = filepath.Walk(archivePath, func(file string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			b, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(archivePath, file)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(rel)] = string(b)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return trimRootDir(files), nil
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a bug-report archive: %v", archivePath, err)
+	}
+	defer gzr.Close()
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Clean(filepath.ToSlash(header.Name))] = string(b)
+	}
+	return trimRootDir(files), nil
+}
+
+// trimRootDir removes the bug-report subdir, created so that the archive extracts under its own dir, from the
+// paths of the files.
+func trimRootDir(files map[string]string) map[string]string {
+	prefix := bugReportSubdir + "/"
+	for name := range files {
+		if !strings.HasPrefix(name, prefix) {
+			return files
+		}
+	}
+	out := make(map[string]string, len(files))
+	for name, text := range files {
+		out[strings.TrimPrefix(name, prefix)] = text
+	}
+	return out
+}
+
+// PodFiles are the files of the pods of a kind, keyed by namespace/pod, and then by their path relative to the
+// dir of the pod.
+type PodFiles map[string]map[string]string
+
+// ProxyFiles returns the files of the proxies read from an archive.
+func ProxyFiles(files map[string]string) PodFiles {
+	return podFiles(files, proxyLogsPathSubdir)
+}
+
+// IstiodFiles returns the files of the Istiod pods read from an archive.
+func IstiodFiles(files map[string]string) PodFiles {
+	return podFiles(files, istioLogsPathSubdir)
+}
+
+// OperatorFiles returns the files of the istio-operator pods read from an archive.
+func OperatorFiles(files map[string]string) PodFiles {
+	return podFiles(files, operatorLogsPathSubdir)
+}
+
+// ClusterInfoFiles returns the cluster info files read from an archive, keyed by their name.
+func ClusterInfoFiles(files map[string]string) map[string]string {
+	out := make(map[string]string)
+	for name, text := range files {
+		if path.Dir(name) == clusterInfoSubdir {
+			out[path.Base(name)] = text
+		}
+	}
+	return out
+}
+
+func podFiles(files map[string]string, subdir string) PodFiles {
+	out := make(PodFiles)
+	for name, text := range files {
+		parts := strings.SplitN(name, "/", 4)
+		if len(parts) != 4 || parts[0] != subdir {
+			continue
+		}
+		pod := parts[1] + "/" + parts[2]
+		if out[pod] == nil {
+			out[pod] = make(map[string]string)
+		}
+		out[pod][parts[3]] = text
+	}
+	return out
+}
+
 func getRootDir(rootDir string) string {
 	if rootDir != "" {
 		return rootDir
@@ -0,0 +1,75 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCreateRead(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "bug-report-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	rootDir := filepath.Join(tmp, "bug-report", "bug-report")
+	want := map[string]string{
+		"versions":                              "1.8.0",
+		"cluster/crs":                           "kind: List",
+		"proxies/default/pod/istio-proxy.log":   "log",
+		"istio/istio-system/istiod/debug/syncz": "[]",
+	}
+	for name, text := range want {
+		path := filepath.Join(rootDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outPath := filepath.Join(tmp, "bug-report.tar.gz")
+	if err := Create(DirToArchive(rootDir), outPath); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{outPath, DirToArchive(rootDir)} {
+		got, err := Read(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Read(%s) got %v, want %v", path, got, want)
+		}
+	}
+
+	files, _ := Read(outPath)
+	if got := ClusterInfoFiles(files); !reflect.DeepEqual(got, map[string]string{"crs": "kind: List"}) {
+		t.Errorf("got cluster info files %v", got)
+	}
+	wantProxies := PodFiles{"default/pod": {"istio-proxy.log": "log"}}
+	if got := ProxyFiles(files); !reflect.DeepEqual(got, wantProxies) {
+		t.Errorf("got proxy files %v, want %v", got, wantProxies)
+	}
+	wantIstiods := PodFiles{"istio-system/istiod": {"debug/syncz": "[]"}}
+	if got := IstiodFiles(files); !reflect.DeepEqual(got, wantIstiods) {
+		t.Errorf("got Istiod files %v, want %v", got, wantIstiods)
+	}
+}
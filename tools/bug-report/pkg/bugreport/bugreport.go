@@ -24,6 +24,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -45,7 +46,9 @@ import (
 	"istio.io/istio/tools/bug-report/pkg/filter"
 	"istio.io/istio/tools/bug-report/pkg/kubeclient"
 	"istio.io/istio/tools/bug-report/pkg/kubectlcmd"
+	"istio.io/istio/tools/bug-report/pkg/offline"
 	"istio.io/istio/tools/bug-report/pkg/processlog"
+	"istio.io/istio/tools/bug-report/pkg/redact"
 	"istio.io/pkg/log"
 	"istio.io/pkg/version"
 )
@@ -53,6 +56,7 @@ import (
 const (
 	bugReportDefaultTimeout = 30 * time.Minute
 	istioRevisionLabel      = "istio.io/rev"
+	redactionManifestFile   = "redaction-manifest.json"
 )
 
 var (
@@ -85,6 +89,7 @@ e.g.
 		},
 	}
 	rootCmd.AddCommand(version.CobraCommand())
+	rootCmd.AddCommand(analyzeCmd())
 	addFlags(rootCmd, gConfig)
 
 	return rootCmd
@@ -99,8 +104,41 @@ var (
 	// Aggregated errors for all fetch operations.
 	gErrors util.Errors
 	lock    = sync.RWMutex{}
+	// redactor redacts the files written to the archive.
+	redactor *redact.Redactor
 )
 
+func analyzeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "analyze <archive>",
+		Short: "Analyzes a bug-report archive without cluster access.",
+		Long: `analyze loads an archive created by bug-report, or the dir it was extracted to, and reports:
+- the messages of the Istio config analyzers run on the captured resources
+- the proxies not synced with Istiod, from the captured Istiod syncz debug output
+- the proxies with another version than the Istiod they are connected to
+- the most frequent error and warning patterns of the captured logs
+
+The --istio-namespace and --ignore-errs flags apply to the analysis.`,
+		Example: "  istioctl bug-report analyze bug-report.tar.gz",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := parseConfig()
+			if err != nil {
+				return err
+			}
+			files, err := archive.Read(args[0])
+			if err != nil {
+				return err
+			}
+			report, err := offline.Analyze(files, config)
+			if err != nil {
+				return err
+			}
+			return report.Write(cmd.OutOrStdout())
+		},
+	}
+}
+
 func runBugReportCommand(_ *cobra.Command, logOpts *log.Options) error {
 	if err := configLogs(logOpts); err != nil {
 		return err
@@ -109,6 +147,10 @@ func runBugReportCommand(_ *cobra.Command, logOpts *log.Options) error {
 	if err != nil {
 		return err
 	}
+	redactor, err = redact.New(redact.Options{KeepSecretData: config.FullSecrets, Patterns: config.RedactPatterns})
+	if err != nil {
+		return err
+	}
 	clusterCtxStr := ""
 	if config.Context == "" {
 		var err error
@@ -160,6 +202,9 @@ func runBugReportCommand(_ *cobra.Command, logOpts *log.Options) error {
 		}
 		writeFile(filepath.Join(archive.ProxyOutputPath(tempDir, namespace, pod), common.ProxyContainerName+".log"), text)
 	}
+	if err := writeRedactionManifest(); err != nil {
+		return err
+	}
 
 	outDir, err := os.Getwd()
 	if err != nil {
@@ -275,7 +320,9 @@ func gatherInfo(client kube.ExtendedClient, config *config.BugReportConfig, reso
 	getFromCluster(content.GetEvents, params, clusterDir, &mandatoryWg)
 	getFromCluster(content.GetClusterInfo, params, clusterDir, &mandatoryWg)
 	getFromCluster(content.GetNodeInfo, params, clusterDir, &mandatoryWg)
-	getFromCluster(content.GetSecrets, params.SetVerbose(config.FullSecrets), clusterDir, &mandatoryWg)
+	for _, namespace := range secretNamespaces(config) {
+		getFromCluster(content.GetSecrets, params.SetVerbose(config.FullSecrets).SetNamespace(namespace), clusterDir, &mandatoryWg)
+	}
 	getFromCluster(content.GetDescribePods, params.SetIstioNamespace(config.IstioNamespace), clusterDir, &mandatoryWg)
 
 	// optionalWg is subject to timer.
@@ -321,6 +368,33 @@ func gatherInfo(client kube.ExtendedClient, config *config.BugReportConfig, reso
 	runAnalyze(config, resources, params)
 }
 
+// secretNamespaces returns the namespaces to fetch the secrets of: the Istio namespace and the namespaces of the
+// include specs. It returns an empty namespace, for all namespaces, if an include spec doesn't restrict namespaces.
+func secretNamespaces(config *config.BugReportConfig) []string {
+	if len(config.Include) == 0 {
+		return []string{""}
+	}
+	namespaces := map[string]struct{}{config.IstioNamespace: {}}
+	for _, spec := range config.Include {
+		if len(spec.Namespaces) == 0 {
+			return []string{""}
+		}
+		for _, ns := range spec.Namespaces {
+			ns = strings.TrimSpace(ns)
+			if ns == "" || strings.Contains(ns, "*") {
+				return []string{""}
+			}
+			namespaces[ns] = struct{}{}
+		}
+	}
+	var out []string
+	for ns := range namespaces {
+		out = append(out, ns)
+	}
+	sort.Strings(out)
+	return out
+}
+
 // getFromCluster runs a cluster info fetching function f against the cluster and writes the results to fileName.
 // Runs if a goroutine, with errors reported through gErrors.
 func getFromCluster(f func(params *content.Params) (map[string]string, error), params *content.Params, dir string, wg *sync.WaitGroup) {
@@ -433,12 +507,31 @@ func writeFile(path, text string) {
 	if strings.TrimSpace(text) == "" {
 		return
 	}
+	// Core dumps are binary files.
+	if redactor != nil && filepath.Ext(path) != ".core" {
+		archivePath, err := filepath.Rel(archive.OutputRootDir(tempDir), path)
+		if err != nil {
+			archivePath = path
+		}
+		text = redactor.Redact(archivePath, text)
+	}
 	mkdirOrExit(path)
 	if err := ioutil.WriteFile(path, []byte(text), 0o644); err != nil {
 		log.Errorf(err.Error())
 	}
 }
 
+// writeRedactionManifest writes the list of the values redacted from the files of the archive.
+func writeRedactionManifest() error {
+	manifest, err := redactor.ManifestJSON()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(archive.OutputRootDir(tempDir), redactionManifestFile)
+	mkdirOrExit(path)
+	return ioutil.WriteFile(path, []byte(manifest), 0o644)
+}
+
 func mkdirOrExit(fpath string) {
 	if err := os.MkdirAll(path.Dir(fpath), 0o755); err != nil {
 		fmt.Printf("Could not create output directories: %s", err)
@@ -53,7 +53,12 @@ func addFlags(cmd *cobra.Command, args *config2.BugReportConfig) {
 
 	// full secrets
 	cmd.PersistentFlags().BoolVarP(&args.FullSecrets, "full-secrets", "", false,
-		"If set, secret contents are included in output.")
+		"If set, secret contents are included in output. Otherwise, only secret names are listed.")
+
+	// redaction
+	cmd.PersistentFlags().StringSliceVar(&args.RedactPatterns, "redact-patterns", nil,
+		"List of comma separated regular expressions of values to redact from all the files of the archive. "+
+			"Private keys, bearer tokens and JWTs are always redacted, as well as secret data unless --full-secrets is set.")
 
 	// istio namespaces
 	cmd.PersistentFlags().StringVar(&args.IstioNamespace, "istio-namespace", bugReportDefaultIstioNamespace,
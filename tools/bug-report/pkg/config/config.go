@@ -125,9 +125,13 @@ type BugReportConfig struct {
 	// DryRun controls whether logs are actually captured and saved.
 	DryRun bool `json:"dryRun,omitempty"`
 
-	// FullSecrets controls whether secret contents are included.
+	// FullSecrets controls whether secret contents are included. Otherwise only the secret names are listed.
 	FullSecrets bool `json:"fullSecrets,omitempty"`
 
+	// RedactPatterns are regular expressions of values to redact from all the files of the archive, in addition
+	// to the secret data, private keys and tokens which are always redacted.
+	RedactPatterns []string `json:"redactPatterns,omitempty"`
+
 	// CommandTimeout is the maximum amount of time running the command
 	// before giving up, even if not all logs are captured. Upon timeout,
 	// the command creates an archive with only the logs captured so far.
@@ -168,6 +172,9 @@ func (b *BugReportConfig) String() string {
 	}
 	out += fmt.Sprintf("istio-namespace: %s\n", b.IstioNamespace)
 	out += fmt.Sprintf("full-secrets: %v\n", b.FullSecrets)
+	if len(b.RedactPatterns) > 0 {
+		out += fmt.Sprintf("redact-patterns: %s\n", strings.Join(b.RedactPatterns, ","))
+	}
 	out += fmt.Sprintf("timeout (mins): %v\n", math.Round(float64(int(b.CommandTimeout))/float64(time.Minute)))
 	out += fmt.Sprintf("include: %s\n", b.Include)
 	out += fmt.Sprintf("exclude: %s\n", b.Exclude)
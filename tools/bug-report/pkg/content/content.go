@@ -107,14 +107,19 @@ func GetK8sResources(p *Params) (map[string]string, error) {
 	return retMap("k8s-resources", out, err)
 }
 
-// GetSecrets returns all k8s secrets. If full is set, the secret contents are also returned.
+// GetSecrets returns the k8s secrets of the namespace, or of all namespaces if the namespace is not set. Only the
+// secret names are listed, unless verbose is set to fetch the secret contents as well.
 func GetSecrets(p *Params) (map[string]string, error) {
-	cmdStr := "get secrets --all-namespaces"
+	cmdStr := "get secrets"
 	if p.Verbose {
 		cmdStr += " -o yaml"
 	}
-	out, err := kubectlcmd.RunCmd(cmdStr, "", p.DryRun)
-	return retMap("secrets", out, err)
+	if p.Namespace == "" {
+		out, err := kubectlcmd.RunCmd(cmdStr+" --all-namespaces", "", p.DryRun)
+		return retMap("secrets", out, err)
+	}
+	out, err := kubectlcmd.RunCmd(cmdStr, p.Namespace, p.DryRun)
+	return retMap("secrets-"+p.Namespace, out, err)
 }
 
 // GetCRs returns CR contents for all CRDs in the cluster.
@@ -0,0 +1,444 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package offline analyzes the content of a bug-report archive, without access to the cluster it was captured from.
+package offline
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	v1 "k8s.io/api/core/v1"
+
+	"istio.io/istio/galley/pkg/config/analysis/analyzers"
+	"istio.io/istio/galley/pkg/config/analysis/diag"
+	"istio.io/istio/galley/pkg/config/analysis/local"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/xds/debugapi"
+	"istio.io/istio/pkg/config/resource"
+	"istio.io/istio/pkg/config/schema"
+	"istio.io/istio/tools/bug-report/pkg/archive"
+	"istio.io/istio/tools/bug-report/pkg/common"
+	"istio.io/istio/tools/bug-report/pkg/config"
+	"istio.io/istio/tools/bug-report/pkg/processlog"
+)
+
+const (
+	analysisTimeout = 5 * time.Minute
+
+	istiodAppLabel     = "istiod"
+	istioRevisionLabel = "istio.io/rev"
+	meshConfigMapName  = "istio"
+	meshConfigKey      = "mesh"
+	synczFile          = "debug/syncz"
+	// podsFile is the cluster info file holding the pods, along with the other Kubernetes resources.
+	podsFile = "k8s-resources"
+)
+
+// Cluster info files holding the resources analyzed by the Istio config analyzers.
+var resourceFiles = []string{podsFile, "crs"}
+
+// Report is the result of the analysis of an archive.
+type Report struct {
+	// Messages are the messages of the Istio config analyzers run on the resources of the archive.
+	Messages diag.Messages
+	// ResourceErrors are the errors reading the resources of the archive. The resources that could be read are
+	// analyzed anyway.
+	ResourceErrors []string
+	// Proxies are the sync status of the proxies connected to the Istiod pods of the archive.
+	Proxies []*ProxyStatus
+	// Istiods are the versions of the Istiod pods of the archive.
+	Istiods []*IstiodVersion
+	// VersionSkews are the proxies with another version than the Istiod they are connected to.
+	VersionSkews []*VersionSkew
+	// LogPatterns are the error patterns of the logs of the archive, keyed by the path of the log.
+	LogPatterns map[string][]*processlog.Pattern
+}
+
+// ProxyStatus is the sync status of a proxy, as reported by the syncz debug output of an Istiod.
+type ProxyStatus struct {
+	ProxyID string
+	// Istiod is the namespace/pod of the Istiod the proxy is connected to.
+	Istiod  string
+	Version string
+	CDS     string
+	LDS     string
+	EDS     string
+	RDS     string
+}
+
+// Synced returns true if the proxy acknowledged the last config sent for each type.
+func (p *ProxyStatus) Synced() bool {
+	for _, s := range []string{p.CDS, p.LDS, p.EDS, p.RDS} {
+		if s != synced && s != notSent {
+			return false
+		}
+	}
+	return true
+}
+
+// IstiodVersion is the version of an Istiod pod, as found in the tag of its image.
+type IstiodVersion struct {
+	// Istiod is the namespace/pod of the Istiod.
+	Istiod   string
+	Revision string
+	Version  string
+}
+
+// VersionSkew is a proxy with another version than the Istiod it is connected to.
+type VersionSkew struct {
+	ProxyID       string
+	ProxyVersion  string
+	Istiod        string
+	IstiodVersion string
+	// Supported is true if the proxy is at most one minor version older than Istiod.
+	Supported bool
+}
+
+// Analyze analyzes the files of an archive, as returned by archive.Read.
+func Analyze(files map[string]string, config *config.BugReportConfig) (*Report, error) {
+	report := &Report{}
+	clusterFiles := archive.ClusterInfoFiles(files)
+	pods, err := readPods(clusterFiles[podsFile])
+	if err != nil {
+		report.ResourceErrors = append(report.ResourceErrors, fmt.Sprintf("%s: %v", podsFile, err))
+	}
+	if err := report.analyzeConfig(clusterFiles, config.IstioNamespace); err != nil {
+		return nil, err
+	}
+	report.analyzeSyncStatus(files)
+	report.analyzeVersions(pods)
+	report.analyzeLogs(files, config)
+	return report, nil
+}
+
+// analyzeConfig runs the Istio config analyzers on the resources of the cluster info files of the archive.
+func (r *Report) analyzeConfig(clusterFiles map[string]string, istioNamespace string) error {
+	schemas := schema.MustGet()
+	apiVersions := knownAPIVersions(schemas)
+	var readers []local.ReaderSource
+	meshConfig := ""
+	for name, text := range clusterFiles {
+		if !isResourceFile(name) {
+			continue
+		}
+		items, err := splitList(text)
+		if err != nil {
+			r.ResourceErrors = append(r.ResourceErrors, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		for _, item := range items {
+			setKnownAPIVersion(item, apiVersions)
+		}
+		if mc := findMeshConfig(items, istioNamespace); mc != "" {
+			meshConfig = mc
+		}
+		readers = append(readers, local.ReaderSource{Name: name, Reader: strings.NewReader(joinItems(items))})
+	}
+	if len(readers) == 0 {
+		r.ResourceErrors = append(r.ResourceErrors, "the archive has no cluster resources to analyze")
+		return nil
+	}
+	sort.Slice(readers, func(i, j int) bool {
+		return readers[i].Name < readers[j].Name
+	})
+
+	sa := local.NewSourceAnalyzer(schemas, analyzers.AllCombined(),
+		"", resource.Namespace(istioNamespace), nil, true, analysisTimeout)
+	if meshConfig != "" {
+		if err := sa.AddKubeMeshConfig(meshConfig); err != nil {
+			r.ResourceErrors = append(r.ResourceErrors, fmt.Sprintf("mesh config: %v", err))
+		}
+	}
+	if err := sa.AddReaderKubeSource(readers); err != nil {
+		r.ResourceErrors = append(r.ResourceErrors, err.Error())
+	}
+	result, err := sa.Analyze(make(chan struct{}))
+	if err != nil {
+		return err
+	}
+	r.Messages = result.Messages.SetDocRef("istioctl-analyze").FilterOutLowerThan(diag.Info)
+	r.Messages.Sort()
+	return nil
+}
+
+// knownAPIVersions returns the API versions of the resources known to the analyzers, keyed by group/kind.
+func knownAPIVersions(schemas *schema.Metadata) map[string][]string {
+	out := make(map[string][]string)
+	for _, s := range schemas.KubeCollections().All() {
+		r := s.Resource()
+		key := r.Group() + "/" + r.Kind()
+		out[key] = append(out[key], r.APIVersion())
+	}
+	return out
+}
+
+// setKnownAPIVersion sets the API version of an item to a version known to the analyzers, if its kind is known
+// with other versions only. The analyzers know a single version of most custom resources, while the archive has
+// the version preferred by the cluster.
+func setKnownAPIVersion(item map[string]interface{}, apiVersions map[string][]string) {
+	apiVersion, _ := item["apiVersion"].(string)
+	kind, _ := item["kind"].(string)
+	group := ""
+	if i := strings.LastIndex(apiVersion, "/"); i >= 0 {
+		group = apiVersion[:i]
+	}
+	known := apiVersions[group+"/"+kind]
+	if len(known) == 0 {
+		return
+	}
+	for _, v := range known {
+		if v == apiVersion {
+			return
+		}
+	}
+	item["apiVersion"] = known[0]
+}
+
+// isResourceFile returns true for the cluster info files holding resources to analyze: the Kubernetes resources,
+// the custom resources and the secrets of each namespace.
+func isResourceFile(name string) bool {
+	for _, f := range resourceFiles {
+		if name == f {
+			return true
+		}
+	}
+	return name == "secrets" || strings.HasPrefix(name, "secrets-")
+}
+
+// splitList returns the items of a list, as captured with `kubectl get -o yaml`, or the object itself if it isn't a
+// list. The data of secrets is dropped, as it is redacted in most archives.
+func splitList(text string) ([]map[string]interface{}, error) {
+	var obj map[string]interface{}
+	if err := yaml.Unmarshal([]byte(text), &obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, nil
+	}
+	var items []map[string]interface{}
+	if list, ok := obj["items"].([]interface{}); ok && strings.HasSuffix(fmt.Sprint(obj["kind"]), "List") {
+		for _, item := range list {
+			if m, ok := item.(map[string]interface{}); ok {
+				items = append(items, m)
+			}
+		}
+	} else {
+		items = append(items, obj)
+	}
+	for _, item := range items {
+		if item["kind"] == "Secret" {
+			delete(item, "data")
+			delete(item, "stringData")
+		}
+	}
+	return items, nil
+}
+
+func joinItems(items []map[string]interface{}) string {
+	docs := make([]string, 0, len(items))
+	for _, item := range items {
+		b, err := yaml.Marshal(item)
+		if err != nil {
+			continue
+		}
+		docs = append(docs, string(b))
+	}
+	return strings.Join(docs, "---\n")
+}
+
+// findMeshConfig returns the mesh config of the istio config map of the Istio namespace, if it is one of the items.
+func findMeshConfig(items []map[string]interface{}, istioNamespace string) string {
+	for _, item := range items {
+		if item["kind"] != "ConfigMap" {
+			continue
+		}
+		metadata, _ := item["metadata"].(map[string]interface{})
+		if metadata["name"] != meshConfigMapName || metadata["namespace"] != istioNamespace {
+			continue
+		}
+		data, _ := item["data"].(map[string]interface{})
+		if mc, ok := data[meshConfigKey].(string); ok {
+			return mc
+		}
+	}
+	return ""
+}
+
+// readPods returns the pods of the Kubernetes resources, keyed by namespace/name.
+func readPods(text string) (map[string]*v1.Pod, error) {
+	pods := make(map[string]*v1.Pod)
+	if text == "" {
+		return pods, nil
+	}
+	items, err := splitList(text)
+	if err != nil {
+		return pods, err
+	}
+	for _, item := range items {
+		if item["kind"] != "Pod" {
+			continue
+		}
+		b, err := json.Marshal(item)
+		if err != nil {
+			continue
+		}
+		pod := &v1.Pod{}
+		if err := json.Unmarshal(b, pod); err != nil {
+			continue
+		}
+		pods[pod.Namespace+"/"+pod.Name] = pod
+	}
+	return pods, nil
+}
+
+// Sync status of a type of config, as shown by `istioctl proxy-status`.
+const (
+	synced   = "SYNCED"
+	notSent  = "NOT SENT"
+	stale    = "STALE"
+	neverAck = "STALE (Never Acknowledged)"
+)
+
+func syncStatus(sent, acked string) string {
+	switch {
+	case sent == "":
+		return notSent
+	case sent == acked:
+		return synced
+	case acked == "":
+		return neverAck
+	default:
+		return stale
+	}
+}
+
+// analyzeSyncStatus reads the sync status of the proxies from the syncz debug output of each Istiod.
+func (r *Report) analyzeSyncStatus(files map[string]string) {
+	for istiod, istiodFiles := range archive.IstiodFiles(files) {
+		text, f := istiodFiles[synczFile]
+		if !f {
+			continue
+		}
+		var statuses []debugapi.SyncStatus
+		if err := json.Unmarshal([]byte(text), &statuses); err != nil {
+			r.ResourceErrors = append(r.ResourceErrors, fmt.Sprintf("syncz of %s: %v", istiod, err))
+			continue
+		}
+		for _, s := range statuses {
+			r.Proxies = append(r.Proxies, &ProxyStatus{
+				ProxyID: s.ProxyID,
+				Istiod:  istiod,
+				Version: s.IstioVersion,
+				CDS:     syncStatus(s.ClusterSent, s.ClusterAcked),
+				LDS:     syncStatus(s.ListenerSent, s.ListenerAcked),
+				EDS:     syncStatus(s.EndpointSent, s.EndpointAcked),
+				RDS:     syncStatus(s.RouteSent, s.RouteAcked),
+			})
+		}
+	}
+	sort.Slice(r.Proxies, func(i, j int) bool {
+		if r.Proxies[i].ProxyID != r.Proxies[j].ProxyID {
+			return r.Proxies[i].ProxyID < r.Proxies[j].ProxyID
+		}
+		return r.Proxies[i].Istiod < r.Proxies[j].Istiod
+	})
+}
+
+// analyzeVersions finds the versions of the Istiod pods and compares them with the versions of their proxies.
+func (r *Report) analyzeVersions(pods map[string]*v1.Pod) {
+	versions := make(map[string]string)
+	for name, pod := range pods {
+		if pod.Labels["app"] != istiodAppLabel {
+			continue
+		}
+		for _, c := range pod.Spec.Containers {
+			if c.Name != common.DiscoveryContainerName {
+				continue
+			}
+			versions[name] = imageTag(c.Image)
+			r.Istiods = append(r.Istiods, &IstiodVersion{
+				Istiod:   name,
+				Revision: pod.Labels[istioRevisionLabel],
+				Version:  versions[name],
+			})
+		}
+	}
+	sort.Slice(r.Istiods, func(i, j int) bool {
+		return r.Istiods[i].Istiod < r.Istiods[j].Istiod
+	})
+
+	for _, p := range r.Proxies {
+		istiodVersion, f := versions[p.Istiod]
+		if !f || istiodVersion == "" || p.Version == "" || p.Version == istiodVersion {
+			continue
+		}
+		r.VersionSkews = append(r.VersionSkews, &VersionSkew{
+			ProxyID:       p.ProxyID,
+			ProxyVersion:  p.Version,
+			Istiod:        p.Istiod,
+			IstiodVersion: istiodVersion,
+			Supported:     supportedSkew(istiodVersion, p.Version),
+		})
+	}
+}
+
+// imageTag returns the tag of an image, or an empty string if the image is referenced by digest only.
+func imageTag(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+// supportedSkew returns true if the proxy version is the same minor version as Istiod, or the previous one.
+func supportedSkew(istiodVersion, proxyVersion string) bool {
+	istiod, proxy := model.ParseIstioVersion(istiodVersion), model.ParseIstioVersion(proxyVersion)
+	if istiod == model.MaxIstioVersion || proxy == model.MaxIstioVersion || istiod.Major != proxy.Major {
+		return false
+	}
+	skew := istiod.Minor - proxy.Minor
+	return skew == 0 || skew == 1
+}
+
+// analyzeLogs summarizes the error patterns of the proxy, Istiod and operator logs.
+func (r *Report) analyzeLogs(files map[string]string, config *config.BugReportConfig) {
+	r.LogPatterns = make(map[string][]*processlog.Pattern)
+	for name, text := range files {
+		if path.Ext(name) != ".log" || !isPodLog(name) {
+			continue
+		}
+		if patterns := processlog.ErrorPatterns(config, text); len(patterns) > 0 {
+			r.LogPatterns[name] = patterns
+		}
+	}
+}
+
+// isPodLog returns true for the logs of the proxy, Istiod and operator containers.
+func isPodLog(name string) bool {
+	switch path.Base(name) {
+	case common.ProxyContainerName + ".log", "discovery.log", "operator.log":
+		return true
+	}
+	return false
+}
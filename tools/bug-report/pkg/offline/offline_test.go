@@ -0,0 +1,84 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offline
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"istio.io/istio/pilot/test/util"
+	"istio.io/istio/pkg/test/env"
+	"istio.io/istio/tools/bug-report/pkg/archive"
+	"istio.io/istio/tools/bug-report/pkg/config"
+)
+
+func TestAnalyze(t *testing.T) {
+	testDataDir := filepath.Join(env.IstioSrc, "tools/bug-report/pkg/testdata/")
+	files, err := archive.Read(filepath.Join(testDataDir, "archive"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Analyze(files, &config.BugReportConfig{IstioNamespace: "istio-system"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Proxies) != 2 || !report.Proxies[0].Synced() || report.Proxies[1].Synced() {
+		t.Errorf("unexpected proxy status %+v", report.Proxies)
+	}
+	if len(report.VersionSkews) != 1 || report.VersionSkews[0].Supported {
+		t.Errorf("expected an unsupported version skew, got %+v", report.VersionSkews)
+	}
+
+	var out bytes.Buffer
+	if err := report.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	util.CompareContent(out.Bytes(), filepath.Join(testDataDir, "output/analyze.txt"), t)
+}
+
+func TestImageTag(t *testing.T) {
+	cases := map[string]string{
+		"docker.io/istio/pilot:1.8.0":                "1.8.0",
+		"localhost:5000/istio/pilot:1.9-dev":         "1.9-dev",
+		"localhost:5000/istio/pilot":                 "",
+		"gcr.io/istio-release/pilot:1.8.0@sha256:ab": "1.8.0",
+		"gcr.io/istio-release/pilot@sha256:ab":       "",
+	}
+	for image, want := range cases {
+		if got := imageTag(image); got != want {
+			t.Errorf("imageTag(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
+
+func TestSupportedSkew(t *testing.T) {
+	cases := []struct {
+		istiod, proxy string
+		want          bool
+	}{
+		{"1.8.0", "1.8.2", true},
+		{"1.8.0", "1.7.5", true},
+		{"1.8.0", "1.6.8", false},
+		{"1.7.0", "1.8.0", false},
+		{"1.8.0", "latest", false},
+	}
+	for _, tc := range cases {
+		if got := supportedSkew(tc.istiod, tc.proxy); got != tc.want {
+			t.Errorf("supportedSkew(%q, %q) = %v, want %v", tc.istiod, tc.proxy, got, tc.want)
+		}
+	}
+}
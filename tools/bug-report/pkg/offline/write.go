@@ -0,0 +1,148 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offline
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"istio.io/istio/istioctl/pkg/util/formatting"
+)
+
+// maxLogPatterns is the number of error patterns written for each log.
+const maxLogPatterns = 10
+
+// Write writes the report in a human readable form.
+func (r *Report) Write(w io.Writer) error {
+	if err := r.writeConfigAnalysis(w); err != nil {
+		return err
+	}
+	r.writeSyncStatus(w)
+	r.writeVersions(w)
+	r.writeLogPatterns(w)
+	return nil
+}
+
+func (r *Report) writeConfigAnalysis(w io.Writer) error {
+	fmt.Fprintln(w, "Istio config analysis:")
+	for _, e := range r.ResourceErrors {
+		fmt.Fprintf(w, "Error reading the archive: %s\n", e)
+	}
+	if len(r.Messages) == 0 {
+		fmt.Fprintln(w, "No validation issues found.")
+	} else {
+		out, err := formatting.Print(r.Messages, formatting.LogFormat, false)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, out)
+	}
+	fmt.Fprintln(w)
+	return nil
+}
+
+func (r *Report) writeSyncStatus(w io.Writer) {
+	fmt.Fprintln(w, "Proxy sync status:")
+	if len(r.Proxies) == 0 {
+		fmt.Fprintln(w, "No proxy status found in the Istiod debug output.")
+		fmt.Fprintln(w)
+		return
+	}
+	var notSynced []*ProxyStatus
+	for _, p := range r.Proxies {
+		if !p.Synced() {
+			notSynced = append(notSynced, p)
+		}
+	}
+	if len(notSynced) == 0 {
+		fmt.Fprintf(w, "All %d proxies are synced.\n\n", len(r.Proxies))
+		return
+	}
+	fmt.Fprintf(w, "%d of %d proxies are not synced:\n", len(notSynced), len(r.Proxies))
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCDS\tLDS\tEDS\tRDS\tISTIOD")
+	for _, p := range notSynced {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", p.ProxyID, p.CDS, p.LDS, p.EDS, p.RDS, p.Istiod)
+	}
+	_ = tw.Flush()
+	fmt.Fprintln(w)
+}
+
+func (r *Report) writeVersions(w io.Writer) {
+	fmt.Fprintln(w, "Control plane and proxy versions:")
+	if len(r.Istiods) == 0 {
+		fmt.Fprintln(w, "No Istiod pod found in the cluster resources.")
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	if len(r.Istiods) > 0 {
+		fmt.Fprintln(tw, "ISTIOD\tREVISION\tVERSION")
+		for _, i := range r.Istiods {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", i.Istiod, valueOrDefault(i.Revision, "default"), valueOrDefault(i.Version, "unknown"))
+		}
+		_ = tw.Flush()
+	}
+	if len(r.VersionSkews) == 0 {
+		fmt.Fprintln(w, "All proxies have the version of their Istiod.")
+		fmt.Fprintln(w)
+		return
+	}
+	fmt.Fprintf(w, "%d proxies have another version than their Istiod:\n", len(r.VersionSkews))
+	fmt.Fprintln(tw, "NAME\tVERSION\tISTIOD\tISTIOD VERSION\tSUPPORTED")
+	for _, s := range r.VersionSkews {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%v\n", s.ProxyID, s.ProxyVersion, s.Istiod, s.IstiodVersion, s.Supported)
+	}
+	_ = tw.Flush()
+	fmt.Fprintln(w)
+}
+
+func (r *Report) writeLogPatterns(w io.Writer) {
+	fmt.Fprintln(w, "Log error patterns:")
+	if len(r.LogPatterns) == 0 {
+		fmt.Fprintln(w, "No errors or warnings found in the logs.")
+		return
+	}
+	logs := make([]string, 0, len(r.LogPatterns))
+	for l := range r.LogPatterns {
+		logs = append(logs, l)
+	}
+	sort.Strings(logs)
+	for _, l := range logs {
+		patterns := r.LogPatterns[l]
+		fmt.Fprintf(w, "%s:\n", l)
+		tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+		fmt.Fprintln(tw, "  COUNT\tLEVEL\tFIRST\tLAST\tMESSAGE")
+		for i, p := range patterns {
+			if i == maxLogPatterns {
+				break
+			}
+			fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\t%s\n", p.Count, p.Level,
+				p.First.Format(time.RFC3339), p.Last.Format(time.RFC3339), p.Text)
+		}
+		_ = tw.Flush()
+		if len(patterns) > maxLogPatterns {
+			fmt.Fprintf(w, "  ... and %d other patterns\n", len(patterns)-maxLogPatterns)
+		}
+	}
+}
+
+func valueOrDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
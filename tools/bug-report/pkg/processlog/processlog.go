@@ -15,6 +15,8 @@
 package processlog
 
 import (
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -121,3 +123,103 @@ func processLogLine(line string) (timeStamp *time.Time, level string, text strin
 	valid = true
 	return
 }
+
+// Pattern is a message logged at a fatal, error or warning level, with its variable parts replaced by placeholders.
+type Pattern struct {
+	Level string
+	Text  string
+	// Count is the number of matching log entries.
+	Count int
+	// First and Last are the times of the first and last matching log entries.
+	First time.Time
+	Last  time.Time
+}
+
+// envoySourceRegexp matches the source location Envoy logs before its messages.
+var envoySourceRegexp = regexp.MustCompile(`\[[^\]\s]+:\d+\] `)
+
+var patternReplacements = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`), "<uuid>"},
+	{regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`\b0x[0-9a-fA-F]+\b|\b[0-9a-f]*[a-f][0-9a-f]*\d[0-9a-f]*\b|\b[0-9a-f]*\d[0-9a-f]*[a-f][0-9a-f]*\b`), "<hex>"},
+	{regexp.MustCompile(`\d+(\.\d+)?`), "<num>"},
+}
+
+// Envoy logs warnings and fatal errors with their own level names.
+var envoyLevels = map[string]string{
+	"warning":  levelWarn,
+	"critical": levelFatal,
+}
+
+// ErrorPatterns returns the patterns of the fatal, error and warning messages of the log, the most frequent first.
+// Messages matching the ignored errors of the config are skipped.
+func ErrorPatterns(config *config.BugReportConfig, logStr string) []*Pattern {
+	patterns := make(map[string]*Pattern)
+	for _, l := range strings.Split(logStr, "\n") {
+		lv := strings.Split(l, "\t")
+		if level, f := envoyLevels[strings.TrimSpace(safeIndex(lv, 1))]; f {
+			lv[1] = level
+			l = strings.Join(lv, "\t")
+		}
+		t, level, text, valid := processLogLine(l)
+		if !valid {
+			continue
+		}
+		switch level {
+		case levelFatal, levelError, levelWarn:
+		default:
+			continue
+		}
+		text = strings.ReplaceAll(envoySourceRegexp.ReplaceAllString(text, ""), "\t", " ")
+		if len(config.IgnoredErrors) > 0 && match.MatchesGlobs(text, config.IgnoredErrors) {
+			continue
+		}
+		for _, r := range patternReplacements {
+			text = r.re.ReplaceAllString(text, r.repl)
+		}
+		key := level + "\t" + text
+		p, f := patterns[key]
+		if !f {
+			p = &Pattern{Level: level, Text: text, First: *t}
+			patterns[key] = p
+		}
+		p.Count++
+		p.Last = *t
+	}
+
+	out := make([]*Pattern, 0, len(patterns))
+	for _, p := range patterns {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		if out[i].Level != out[j].Level {
+			return levelRank(out[i].Level) < levelRank(out[j].Level)
+		}
+		return out[i].Text < out[j].Text
+	})
+	return out
+}
+
+func levelRank(level string) int {
+	switch level {
+	case levelFatal:
+		return 0
+	case levelError:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func safeIndex(s []string, i int) string {
+	if i < len(s) {
+		return s[i]
+	}
+	return ""
+}
@@ -15,12 +15,16 @@
 package processlog
 
 import (
+	"fmt"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"istio.io/istio/pilot/test/util"
 	"istio.io/istio/pkg/test/env"
+	"istio.io/istio/tools/bug-report/pkg/config"
 )
 
 func TestTimeRangeFilter(t *testing.T) {
@@ -83,3 +87,40 @@ func TestTimeRangeFilter(t *testing.T) {
 		})
 	}
 }
+
+func TestErrorPatterns(t *testing.T) {
+	testDataDir := filepath.Join(env.IstioSrc, "tools/bug-report/pkg/testdata/")
+	inLog := string(util.ReadFile(filepath.Join(testDataDir, "input/ingress.log"), t))
+	tests := []struct {
+		name    string
+		ignored []string
+		want    []string
+	}{
+		{
+			name: "all",
+			want: []string{
+				"4 warn envoy config StreamAggregatedResources gRPC config stream closed: <num>,",
+				"2 warn envoy config StreamAggregatedResources gRPC config stream closed: <num>, no healthy upstream",
+				"2 warn envoy config Unable to establish new stream",
+			},
+		},
+		{
+			name:    "ignored",
+			ignored: []string{"*closed*"},
+			want: []string{
+				"2 warn envoy config Unable to establish new stream",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, p := range ErrorPatterns(&config.BugReportConfig{IgnoredErrors: tt.ignored}, inLog) {
+				got = append(got, fmt.Sprintf("%d %s %s", p.Count, p.Level, p.Text))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got:\n%s\n\nwant:\n%s\n", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redact removes sensitive values, like secret data, private keys and tokens, from the content of the
+// bug-report archive.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ghodss/yaml"
+)
+
+// Marker replaces the redacted values.
+const Marker = "<redacted>"
+
+// Kinds of redacted values.
+const (
+	// SecretData is a value of the data or stringData of a Kubernetes secret.
+	SecretData = "secret-data"
+	// PrivateKey is a private key of an Envoy config dump, or a PEM encoded private key.
+	PrivateKey = "private-key"
+	// BearerToken is a bearer token of an authorization header.
+	BearerToken = "bearer-token"
+	// JWT is a JSON web token.
+	JWT = "jwt"
+	// Pattern is a match of a user configured regular expression.
+	Pattern = "pattern"
+	// Unparsable is a file holding secret data or private keys that could not be parsed to redact them. The whole
+	// file is replaced by Marker.
+	Unparsable = "unparsable"
+)
+
+const lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+var (
+	pemPrivateKeyRegexp = regexp.MustCompile(`-----BEGIN ([A-Z]+ )?PRIVATE KEY-----[\s\S]*?-----END ([A-Z]+ )?PRIVATE KEY-----`)
+	bearerTokenRegexp   = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9\-._~+/]+=*`)
+	jwtRegexp           = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+	// secretKindRegexp matches the kind field of a Kubernetes secret in YAML, and secretKindJSONRegexp in JSON.
+	secretKindRegexp     = regexp.MustCompile(`(?m)^\s*(- )?kind: "?Secret"?\s*$`)
+	secretKindJSONRegexp = regexp.MustCompile(`"kind"\s*:\s*"Secret"`)
+	privateKeyJSONRegexp = regexp.MustCompile(`"(private_key|privateKey|generic_secret|genericSecret)"\s*:`)
+	yamlSeparatorRegexp  = regexp.MustCompile(`(?m)^---\s*$`)
+
+	// Keys of the Envoy config dump objects holding private keys or secrets.
+	privateKeyFields = map[string]bool{
+		"private_key":    true,
+		"privateKey":     true,
+		"generic_secret": true,
+		"genericSecret":  true,
+	}
+)
+
+// Entry records the values of a kind redacted from a file of the archive.
+type Entry struct {
+	// File is the path of the file in the archive.
+	File string `json:"file"`
+	Kind string `json:"kind"`
+	// Location of the values in the file, if known: the secret and key for secret data, the path of the field in
+	// a config dump, the regular expression of a pattern, or why an unparsable file couldn't be parsed.
+	Location string `json:"location,omitempty"`
+	// Count is the number of values redacted.
+	Count int `json:"count"`
+}
+
+// Options control what is redacted.
+type Options struct {
+	// KeepSecretData keeps the data of Kubernetes secrets.
+	KeepSecretData bool
+	// Patterns are regular expressions of additional values to redact.
+	Patterns []string
+}
+
+// Redactor redacts the files of the archive, and keeps track of what was redacted in a manifest. It is safe for
+// concurrent use.
+type Redactor struct {
+	keepSecretData bool
+	patterns       []*regexp.Regexp
+
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// New returns a Redactor for the options.
+func New(opts Options) (*Redactor, error) {
+	r := &Redactor{keepSecretData: opts.KeepSecretData}
+	for _, p := range opts.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %v", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// Redact returns the text of the file with the sensitive values replaced by Marker. Kubernetes secrets in YAML and
+// private keys in JSON config dumps are redacted structurally, the other rules apply to any text. If the file holds
+// secrets or private keys that can't be parsed, the whole file is replaced by Marker and recorded as Unparsable.
+func (r *Redactor) Redact(file, text string) string {
+	entries := map[string]*Entry{}
+	record := func(kind, location string) {
+		key := kind + "/" + location
+		if e, f := entries[key]; f {
+			e.Count++
+			return
+		}
+		entries[key] = &Entry{File: file, Kind: kind, Location: location, Count: 1}
+	}
+
+	var err error
+	trimmed := strings.TrimSpace(text)
+	switch {
+	case strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "["):
+		text, err = redactJSON(text, r.keepSecretData, record)
+	case !r.keepSecretData && secretKindRegexp.MatchString(text):
+		text, err = redactSecrets(text, record)
+	}
+	if err != nil {
+		r.mu.Lock()
+		r.entries = append(r.entries, Entry{File: file, Kind: Unparsable, Location: err.Error(), Count: 1})
+		r.mu.Unlock()
+		return Marker + "\n"
+	}
+
+	replace := func(re *regexp.Regexp, kind, location, repl string) {
+		text = re.ReplaceAllStringFunc(text, func(match string) string {
+			record(kind, location)
+			return re.ReplaceAllString(match, repl)
+		})
+	}
+	replace(pemPrivateKeyRegexp, PrivateKey, "", Marker)
+	replace(bearerTokenRegexp, BearerToken, "", "${1}"+Marker)
+	replace(jwtRegexp, JWT, "", Marker)
+	for _, re := range r.patterns {
+		replace(re, Pattern, re.String(), Marker)
+	}
+
+	if len(entries) > 0 {
+		r.mu.Lock()
+		for _, e := range entries {
+			r.entries = append(r.entries, *e)
+		}
+		r.mu.Unlock()
+	}
+	return text
+}
+
+// Manifest returns what was redacted, sorted by file, kind and location.
+func (r *Redactor) Manifest() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := append([]Entry{}, r.entries...)
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Location < b.Location
+	})
+	return out
+}
+
+// ManifestJSON returns the manifest in JSON.
+func (r *Redactor) ManifestJSON() (string, error) {
+	b, err := json.MarshalIndent(r.Manifest(), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// redactSecrets redacts the data of the Kubernetes secrets of a YAML stream, for example the output of
+// `kubectl get secrets -o yaml`. The documents without a secret are returned as is. An error is returned if a
+// document with a secret can't be parsed or written back.
+func redactSecrets(text string, record func(kind, location string)) (string, error) {
+	docs := yamlSeparatorRegexp.Split(text, -1)
+	redacted := false
+	for i, doc := range docs {
+		if !secretKindRegexp.MatchString(doc) {
+			continue
+		}
+		var obj interface{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			return "", fmt.Errorf("failed to parse YAML document %d: %v", i, err)
+		}
+		if !redactSecretObjects(obj, record) {
+			continue
+		}
+		out, err := yaml.Marshal(obj)
+		if err != nil {
+			return "", fmt.Errorf("failed to write YAML document %d: %v", i, err)
+		}
+		if i > 0 {
+			out = append([]byte("\n"), out...)
+		}
+		docs[i] = string(out)
+		redacted = true
+	}
+	if !redacted {
+		return text, nil
+	}
+	return strings.Join(docs, "---"), nil
+}
+
+// redactSecretObjects redacts the secrets found in obj, including the items of lists, and returns true if a value
+// was redacted.
+func redactSecretObjects(obj interface{}, record func(kind, location string)) bool {
+	redacted := false
+	switch o := obj.(type) {
+	case []interface{}:
+		for _, item := range o {
+			redacted = redactSecretObjects(item, record) || redacted
+		}
+	case map[string]interface{}:
+		if o["kind"] != "Secret" {
+			if items, f := o["items"]; f {
+				return redactSecretObjects(items, record)
+			}
+			return false
+		}
+		name := secretName(o)
+		for _, field := range []string{"data", "stringData"} {
+			data, ok := o[field].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for key := range data {
+				data[key] = Marker
+				record(SecretData, name+":"+key)
+				redacted = true
+			}
+		}
+		if metadata, ok := o["metadata"].(map[string]interface{}); ok {
+			if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+				if _, f := annotations[lastAppliedConfigAnnotation]; f {
+					annotations[lastAppliedConfigAnnotation] = Marker
+					record(SecretData, name+":"+lastAppliedConfigAnnotation)
+					redacted = true
+				}
+			}
+		}
+	}
+	return redacted
+}
+
+func secretName(secret map[string]interface{}) string {
+	metadata, _ := secret["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	if namespace, _ := metadata["namespace"].(string); namespace != "" {
+		return namespace + "/" + name
+	}
+	return name
+}
+
+// redactJSON redacts the private keys and generic secrets of a stream of JSON values, like an Envoy config dump, and
+// the data of the Kubernetes secrets it holds. Text that isn't JSON, like an Envoy log, is returned as is unless it
+// looks like it holds a secret or private key, in which case an error is returned.
+func redactJSON(text string, keepSecretData bool, record func(kind, location string)) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var objs []interface{}
+	for {
+		var obj interface{}
+		err := decoder.Decode(&obj)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if privateKeyJSONRegexp.MatchString(text) || (!keepSecretData && secretKindJSONRegexp.MatchString(text)) {
+				return "", fmt.Errorf("failed to parse JSON value %d: %v", len(objs), err)
+			}
+			return text, nil
+		}
+		objs = append(objs, obj)
+	}
+	redacted := false
+	for _, obj := range objs {
+		redacted = redactJSONFields(obj, "", record) || redacted
+		if !keepSecretData {
+			redacted = redactSecretObjects(obj, record) || redacted
+		}
+	}
+	if !redacted {
+		return text, nil
+	}
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if len(objs) == 1 {
+		encoder.SetIndent("", " ")
+	}
+	for i, obj := range objs {
+		if err := encoder.Encode(obj); err != nil {
+			return "", fmt.Errorf("failed to write JSON value %d: %v", i, err)
+		}
+	}
+	return b.String(), nil
+}
+
+func redactJSONFields(obj interface{}, path string, record func(kind, location string)) bool {
+	redacted := false
+	switch o := obj.(type) {
+	case []interface{}:
+		for i, item := range o {
+			redacted = redactJSONFields(item, fmt.Sprintf("%s[%d]", path, i), record) || redacted
+		}
+	case map[string]interface{}:
+		for key, value := range o {
+			fieldPath := path + "." + key
+			if privateKeyFields[key] {
+				if hasValues(value) {
+					o[key] = replaceValues(value)
+					record(PrivateKey, strings.TrimPrefix(fieldPath, "."))
+					redacted = true
+				}
+				continue
+			}
+			redacted = redactJSONFields(value, fieldPath, record) || redacted
+		}
+	}
+	return redacted
+}
+
+// hasValues returns true if the value holds at least one string or number that isn't already redacted by Envoy.
+func hasValues(value interface{}) bool {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if hasValues(item) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if hasValues(item) {
+				return true
+			}
+		}
+	case string:
+		return v != "" && v != Marker && v != "[redacted]"
+	case json.Number:
+		return true
+	}
+	return false
+}
+
+// replaceValues returns the value with all its strings and numbers replaced by Marker.
+func replaceValues(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		for i, item := range v {
+			v[i] = replaceValues(item)
+		}
+		return v
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = replaceValues(item)
+		}
+		return v
+	case string, json.Number:
+		return Marker
+	}
+	return value
+}
@@ -0,0 +1,182 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redact
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"istio.io/istio/pilot/test/util"
+	"istio.io/istio/pkg/test/env"
+)
+
+func TestRedact(t *testing.T) {
+	testDataDir := filepath.Join(env.IstioSrc, "tools/bug-report/pkg/testdata/")
+	tests := []struct {
+		name     string
+		input    string
+		opts     Options
+		manifest []Entry
+	}{
+		{
+			name:  "secrets.yaml",
+			input: "secrets.yaml",
+			manifest: []Entry{
+				{File: "secrets.yaml", Kind: SecretData, Location: "default/db-credentials:kubectl.kubernetes.io/last-applied-configuration", Count: 1},
+				{File: "secrets.yaml", Kind: SecretData, Location: "default/db-credentials:password", Count: 1},
+				{File: "secrets.yaml", Kind: SecretData, Location: "default/db-credentials:username", Count: 1},
+				{File: "secrets.yaml", Kind: SecretData, Location: "istio-system/istio-ca-secret:ca-cert.pem", Count: 1},
+				{File: "secrets.yaml", Kind: SecretData, Location: "istio-system/istio-ca-secret:ca-key.pem", Count: 1},
+			},
+		},
+		{
+			name:  "secrets_full.yaml",
+			input: "secrets.yaml",
+			opts:  Options{KeepSecretData: true},
+		},
+		{
+			name:  "config_dump.json",
+			input: "config_dump.json",
+			manifest: []Entry{
+				{File: "config_dump.json", Kind: PrivateKey, Location: "configs[1].dynamic_active_secrets[0].secret.tls_certificate.private_key", Count: 1},
+			},
+		},
+		{
+			name:  "requests.log",
+			input: "requests.log",
+			manifest: []Entry{
+				{File: "requests.log", Kind: BearerToken, Count: 2},
+				{File: "requests.log", Kind: JWT, Count: 1},
+				{File: "requests.log", Kind: PrivateKey, Count: 1},
+			},
+		},
+		{
+			name:  "requests_patterns.log",
+			input: "requests.log",
+			opts:  Options{Patterns: []string{`k-\d+-[a-z]+`}},
+			manifest: []Entry{
+				{File: "requests.log", Kind: BearerToken, Count: 2},
+				{File: "requests.log", Kind: JWT, Count: 1},
+				{File: "requests.log", Kind: Pattern, Location: `k-\d+-[a-z]+`, Count: 1},
+				{File: "requests.log", Kind: PrivateKey, Count: 1},
+			},
+		},
+		{
+			name:  "ingress.log",
+			input: "ingress.log",
+			opts:  Options{Patterns: []string{`10\.36\.1\.5\b`}},
+			manifest: []Entry{
+				{File: "ingress.log", Kind: Pattern, Location: `10\.36\.1\.5\b`, Count: 3},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			in := string(util.ReadFile(filepath.Join(testDataDir, "input", tt.input), t))
+			got := r.Redact(tt.input, in)
+			util.CompareContent([]byte(got), filepath.Join(testDataDir, "output/redacted", tt.name), t)
+
+			manifest := r.Manifest()
+			if len(manifest) == 0 {
+				manifest = nil
+			}
+			if !reflect.DeepEqual(manifest, tt.manifest) {
+				t.Errorf("got manifest %+v, want %+v", manifest, tt.manifest)
+			}
+		})
+	}
+}
+
+func TestRedactKeepsCertificates(t *testing.T) {
+	testDataDir := filepath.Join(env.IstioSrc, "tools/bug-report/pkg/testdata/")
+	in := string(util.ReadFile(filepath.Join(testDataDir, "input/ingress.log"), t))
+	r, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Redact("ingress.log", in); got != in {
+		t.Errorf("log without sensitive values was modified")
+	}
+	if !strings.Contains(in, "-----BEGIN CERTIFICATE-----") {
+		t.Fatalf("input is expected to hold a certificate")
+	}
+	if len(r.Manifest()) != 0 {
+		t.Errorf("got manifest %+v, want empty", r.Manifest())
+	}
+}
+
+func TestRedactUnparsable(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{
+			name: "secret yaml",
+			in:   "apiVersion: v1\nkind: Secret\ndata:\n  password: c2VjcmV0\n\tbroken: [\n",
+		},
+		{
+			name: "config dump",
+			in:   `{"configs": [{"private_key": {"inline_string": "secret"}}]` + "\n" + `{"configs": [`,
+		},
+		{
+			name: "secret json",
+			in:   `[{"kind": "Secret", "data": {"password": "c2VjcmV0"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.Redact("file", tt.in); got != Marker+"\n" {
+				t.Errorf("got %q, want the file to be replaced by the marker", got)
+			}
+			manifest := r.Manifest()
+			if len(manifest) != 1 || manifest[0].Kind != Unparsable || manifest[0].Location == "" {
+				t.Errorf("got manifest %+v, want an unparsable entry", manifest)
+			}
+		})
+	}
+}
+
+func TestRedactSecretsStream(t *testing.T) {
+	in := "apiVersion: v1\nkind: ConfigMap\ndata:\n  key: value\n---\napiVersion: v1\nkind: Secret\n" +
+		"metadata:\n  name: creds\ndata:\n  password: c2VjcmV0\n"
+	r, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "apiVersion: v1\nkind: ConfigMap\ndata:\n  key: value\n---\napiVersion: v1\ndata:\n  password: <redacted>\n" +
+		"kind: Secret\nmetadata:\n  name: creds\n"
+	if got := r.Redact("file", in); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !reflect.DeepEqual(r.Manifest(), []Entry{{File: "file", Kind: SecretData, Location: "creds:password", Count: 1}}) {
+		t.Errorf("got manifest %+v", r.Manifest())
+	}
+}
+
+func TestNewInvalidPattern(t *testing.T) {
+	if _, err := New(Options{Patterns: []string{"("}}); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+}
@@ -62,6 +62,12 @@ func cleanup(cfg *config.Config) {
 		ext = &dep.RealDependencies{}
 	}
 
+	if cfg.Nftables {
+		// All the rules are in the istio table.
+		ext.RunQuietlyAndIgnore(constants.NFT, "delete", "table", constants.NftablesFamily, constants.NftablesTable)
+		return
+	}
+
 	defer func() {
 		for _, cmd := range []string{constants.IPTABLESSAVE, constants.IP6TABLESSAVE} {
 			// iptables-save is best efforts
@@ -55,6 +55,7 @@ func constructConfig() *config.Config {
 		ProxyUID:    viper.GetString(constants.ProxyUID),
 		ProxyGID:    viper.GetString(constants.ProxyGID),
 		RedirectDNS: viper.GetBool(constants.RedirectDNS),
+		Nftables:    viper.GetBool(constants.Nftables),
 	}
 
 	// TODO: Make this more configurable, maybe with an allowlist of users to be captured for output instead of a denylist.
@@ -114,6 +115,11 @@ func bindFlags(cmd *cobra.Command, args []string) {
 		handleError(err)
 	}
 	viper.SetDefault(constants.RedirectDNS, dnsCaptureByAgent)
+
+	if err := viper.BindPFlag(constants.Nftables, cmd.Flags().Lookup(constants.Nftables)); err != nil {
+		handleError(err)
+	}
+	viper.SetDefault(constants.Nftables, false)
 }
 
 // https://github.com/spf13/viper/issues/233.
@@ -129,6 +135,8 @@ func init() {
 		"Specify the GID of the user for which the redirection is not applied. (same default value as -u param)")
 
 	rootCmd.Flags().Bool(constants.RedirectDNS, dnsCaptureByAgent, "Enable capture of dns traffic by istio-agent")
+
+	rootCmd.Flags().Bool(constants.Nftables, false, "Delete the \"inet istio\" nftables table instead of the iptables rules")
 }
 
 func GetCommand() *cobra.Command {
@@ -28,6 +28,7 @@ type Config struct {
 	ProxyUID     string   `json:"PROXY_UID"`
 	ProxyGID     string   `json:"PROXY_GID"`
 	RedirectDNS  bool     `json:"REDIRECT_DNS"`
+	Nftables     bool     `json:"NFTABLES"`
 	DNSServersV4 []string `json:"DNS_SERVERS_V4"`
 	DNSServersV6 []string `json:"DNS_SERVERS_V6"`
 }
@@ -47,5 +48,6 @@ func (c *Config) Print() {
 	fmt.Printf("PROXY_GID=%s\n", c.ProxyGID)
 	fmt.Printf("DNS_CAPTURE=%t\n", c.RedirectDNS)
 	fmt.Printf("DNS_SERVERS=%s,%s\n", c.DNSServersV4, c.DNSServersV6)
+	fmt.Printf("NFTABLES=%t\n", c.Nftables)
 	fmt.Println("")
 }
@@ -0,0 +1,80 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ChainRules are the rules of a chain of a table, in the order they end up in once all the appends and inserts
+// are applied.
+type ChainRules struct {
+	Table string
+	Chain string
+	// Rules holds the matches and target of each rule, without the append or insert command.
+	Rules [][]string
+}
+
+// BuildV4Chains returns the IPv4 chains, in the order they are first used, with their final rules.
+func (rb *IptablesBuilderImpl) BuildV4Chains() ([]*ChainRules, error) {
+	return orderedChains(rb.rules.rulesv4)
+}
+
+// BuildV6Chains returns the IPv6 chains, in the order they are first used, with their final rules.
+func (rb *IptablesBuilderImpl) BuildV6Chains() ([]*ChainRules, error) {
+	return orderedChains(rb.rules.rulesv6)
+}
+
+func orderedChains(rules []*Rule) ([]*ChainRules, error) {
+	chains := []*ChainRules{}
+	chainsByName := map[string]*ChainRules{}
+	for _, r := range rules {
+		key := fmt.Sprintf("%s:%s", r.chain, r.table)
+		c, f := chainsByName[key]
+		if !f {
+			c = &ChainRules{Table: r.table, Chain: r.chain}
+			chains = append(chains, c)
+			chainsByName[key] = c
+		}
+		position, params, err := splitRuleParams(r)
+		if err != nil {
+			return nil, err
+		}
+		if position < 0 || position > len(c.Rules) {
+			c.Rules = append(c.Rules, params)
+		} else {
+			c.Rules = append(c.Rules[:position], append([][]string{params}, c.Rules[position:]...)...)
+		}
+	}
+	return chains, nil
+}
+
+// splitRuleParams returns the 0 based insert position of the rule, or -1 to append it, and the matches and target
+// of the rule.
+func splitRuleParams(r *Rule) (int, []string, error) {
+	if len(r.params) >= 2 && r.params[0] == "-A" {
+		return -1, r.params[2:], nil
+	}
+	if len(r.params) >= 3 && r.params[0] == "-I" {
+		position, err := strconv.Atoi(r.params[2])
+		if err != nil || position < 1 {
+			return 0, nil, fmt.Errorf("invalid position %q for chain %s", r.params[2], r.chain)
+		}
+		return position - 1, r.params[3:], nil
+	}
+	return 0, nil, fmt.Errorf("unsupported operation %q for chain %s", strings.Join(r.params, " "), r.chain)
+}
@@ -0,0 +1,340 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"istio.io/istio/tools/istio-iptables/pkg/constants"
+)
+
+// Priorities of the base chains, matching the priorities of the iptables tables so that the rules are evaluated
+// at the same point as with iptables.
+var nftablesPriorities = map[string]map[string]int{
+	constants.NAT: {
+		constants.PREROUTING:  -100,
+		constants.OUTPUT:      -100,
+		constants.INPUT:       100,
+		constants.POSTROUTING: 100,
+	},
+	constants.MANGLE: {
+		constants.PREROUTING:  -150,
+		constants.INPUT:       -150,
+		constants.FORWARD:     -150,
+		constants.OUTPUT:      -150,
+		constants.POSTROUTING: -150,
+	},
+	constants.FILTER: {
+		constants.INPUT:   0,
+		constants.FORWARD: 0,
+		constants.OUTPUT:  0,
+	},
+}
+
+// nftChain is a chain of the nftables ruleset, holding the rules of an iptables chain of a table.
+type nftChain struct {
+	table string
+	chain string
+	rules []string
+}
+
+// NftablesChainName returns the name of the nftables chain for an iptables chain. All the chains are in the same
+// nftables table, so the name of the iptables table is used as prefix.
+func NftablesChainName(table, chain string) string {
+	return fmt.Sprintf("%s_%s", table, chain)
+}
+
+// BuildNftables returns the IPv4 and IPv6 rules as a single nftables ruleset for `nft -f`. The ruleset replaces
+// the content of the istio table atomically. The rules are translated from their iptables form, with the same
+// order and semantics: rules of each IP family only apply to the packets of that family.
+func (rb *IptablesBuilderImpl) BuildNftables() (string, error) {
+	chains := []*nftChain{}
+	chainsByName := map[string]*nftChain{}
+	jumps := map[string]string{}
+	getChain := func(table, chain string) *nftChain {
+		name := NftablesChainName(table, chain)
+		if c, f := chainsByName[name]; f {
+			return c
+		}
+		c := &nftChain{table: table, chain: chain}
+		chains = append(chains, c)
+		chainsByName[name] = c
+		return c
+	}
+
+	for _, family := range []struct {
+		nfproto string
+		rules   []*Rule
+	}{
+		{"ipv4", rb.rules.rulesv4},
+		{"ipv6", rb.rules.rulesv6},
+	} {
+		familyChains, err := orderedChains(family.rules)
+		if err != nil {
+			return "", err
+		}
+		for _, fc := range familyChains {
+			c := getChain(fc.Table, fc.Chain)
+			for _, params := range fc.Rules {
+				expr, jump, err := nftablesRule(fc.Table, family.nfproto, params)
+				if err != nil {
+					return "", fmt.Errorf("failed to translate rule %q of chain %s in table %s: %v",
+						strings.Join(params, " "), fc.Chain, fc.Table, err)
+				}
+				if jump != "" {
+					jumps[jump] = fmt.Sprintf("rule %q of chain %s in table %s", strings.Join(params, " "), fc.Chain, fc.Table)
+				}
+				c.rules = append(c.rules, expr)
+			}
+		}
+	}
+
+	for jump, rule := range jumps {
+		if _, f := chainsByName[jump]; !f {
+			return "", fmt.Errorf("%s jumps to an unknown chain or uses an unsupported target", rule)
+		}
+	}
+
+	var b strings.Builder
+	table := fmt.Sprintf("table %s %s", constants.NftablesFamily, constants.NftablesTable)
+	// Creating the table before deleting it makes the deletion succeed when the table doesn't exist yet.
+	fmt.Fprintln(&b, table)
+	fmt.Fprintf(&b, "delete %s\n", table)
+	if len(chains) == 0 {
+		return b.String(), nil
+	}
+
+	// Declare all the chains first, so that rules can jump to chains declared after them.
+	fmt.Fprintf(&b, "%s {\n", table)
+	for _, c := range chains {
+		fmt.Fprintf(&b, "\tchain %s {\n", NftablesChainName(c.table, c.chain))
+		if _, builtin := constants.BuiltInChainsMap[c.chain]; builtin {
+			hook, err := nftablesHook(c.table, c.chain)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&b, "\t\t%s\n", hook)
+		}
+		fmt.Fprintln(&b, "\t}")
+	}
+	fmt.Fprintln(&b, "}")
+
+	fmt.Fprintf(&b, "%s {\n", table)
+	for _, c := range chains {
+		if len(c.rules) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\tchain %s {\n", NftablesChainName(c.table, c.chain))
+		for _, r := range c.rules {
+			fmt.Fprintf(&b, "\t\t%s\n", r)
+		}
+		fmt.Fprintln(&b, "\t}")
+	}
+	fmt.Fprintln(&b, "}")
+	return b.String(), nil
+}
+
+func nftablesHook(table, chain string) (string, error) {
+	priority, f := nftablesPriorities[table][chain]
+	if !f {
+		return "", fmt.Errorf("chain %s is not supported in table %s", chain, table)
+	}
+	chainType := "filter"
+	switch {
+	case table == constants.NAT:
+		chainType = "nat"
+	case table == constants.MANGLE && chain == constants.OUTPUT:
+		// Packets rerouted after their mark changes, as with the iptables mangle table.
+		chainType = "route"
+	}
+	return fmt.Sprintf("type %s hook %s priority %d; policy accept;", chainType, strings.ToLower(chain), priority), nil
+}
+
+// nftablesRule translates the iptables matches and target of a rule into an nftables rule, and returns the chain
+// the rule jumps to, if any. Only the options used by istio-iptables are supported.
+func nftablesRule(table, nfproto string, params []string) (string, string, error) {
+	addressProto := "ip"
+	if nfproto == "ipv6" {
+		addressProto = "ip6"
+	}
+	exprs := []string{}
+	// Index of the protocol match, replaced by the port match when there is one.
+	protoIdx := -1
+	proto := ""
+	module := ""
+	familyMatched := false
+	negate := false
+	jump := ""
+
+	value := func(i int) (string, error) {
+		if i+1 >= len(params) {
+			return "", fmt.Errorf("missing value of %s", params[i])
+		}
+		return params[i+1], nil
+	}
+	op := func() string {
+		if negate {
+			return "!= "
+		}
+		return ""
+	}
+
+	for i := 0; i < len(params); i++ {
+		p := params[i]
+		if p == "!" {
+			negate = true
+			continue
+		}
+		if p == "-j" {
+			target, err := nftablesTarget(table, addressProto, params[i+1:])
+			if err != nil {
+				return "", "", err
+			}
+			exprs = append(exprs, target)
+			if strings.HasPrefix(target, "jump ") {
+				jump = strings.TrimPrefix(target, "jump ")
+			}
+			break
+		}
+		v, err := value(i)
+		if err != nil {
+			return "", "", err
+		}
+		i++
+		switch p {
+		case "-p":
+			proto = v
+			protoIdx = len(exprs)
+			exprs = append(exprs, fmt.Sprintf("meta l4proto %s%s", op(), v))
+		case "--dport":
+			if proto == "" {
+				return "", "", fmt.Errorf("--dport requires a protocol")
+			}
+			expr := fmt.Sprintf("%s dport %s%s", proto, op(), v)
+			if protoIdx >= 0 && !strings.Contains(exprs[protoIdx], "!=") {
+				// The port match implies the protocol match.
+				exprs[protoIdx] = expr
+				protoIdx = -1
+			} else {
+				exprs = append(exprs, expr)
+			}
+		case "-d":
+			familyMatched = true
+			exprs = append(exprs, fmt.Sprintf("%s daddr %s%s", addressProto, op(), v))
+		case "-s":
+			familyMatched = true
+			exprs = append(exprs, fmt.Sprintf("%s saddr %s%s", addressProto, op(), v))
+		case "-o":
+			exprs = append(exprs, fmt.Sprintf("oifname %s%q", op(), v))
+		case "-i":
+			exprs = append(exprs, fmt.Sprintf("iifname %s%q", op(), v))
+		case "-m":
+			module = v
+		case "--uid-owner":
+			exprs = append(exprs, fmt.Sprintf("meta skuid %s%s", op(), v))
+		case "--gid-owner":
+			exprs = append(exprs, fmt.Sprintf("meta skgid %s%s", op(), v))
+		case "--ctstate":
+			exprs = append(exprs, fmt.Sprintf("ct state %s%s", op(), strings.ToLower(v)))
+		case "--mark":
+			switch module {
+			case "mark":
+				exprs = append(exprs, fmt.Sprintf("meta mark %s%s", op(), v))
+			case "connmark":
+				exprs = append(exprs, fmt.Sprintf("ct mark %s%s", op(), v))
+			default:
+				return "", "", fmt.Errorf("--mark is not supported for module %q", module)
+			}
+		default:
+			return "", "", fmt.Errorf("unsupported option %s", p)
+		}
+		negate = false
+	}
+
+	if !familyMatched {
+		exprs = append([]string{"meta nfproto " + nfproto}, exprs...)
+	}
+	return strings.Join(exprs, " "), jump, nil
+}
+
+// nftablesTarget translates the iptables target and its options, starting with the name of the target.
+func nftablesTarget(table, addressProto string, params []string) (string, error) {
+	if len(params) == 0 {
+		return "", fmt.Errorf("missing target")
+	}
+	target, opts := params[0], map[string]string{}
+	for i := 1; i < len(params); i++ {
+		if i+1 < len(params) && !strings.HasPrefix(params[i+1], "--") {
+			opts[params[i]] = params[i+1]
+			i++
+		} else {
+			opts[params[i]] = ""
+		}
+	}
+
+	switch target {
+	case constants.RETURN:
+		return "return", nil
+	case constants.ACCEPT:
+		return "accept", nil
+	case constants.REJECT:
+		return "reject", nil
+	case constants.REDIRECT:
+		port, f := opts["--to-ports"]
+		if !f {
+			port, f = opts["--to-port"]
+		}
+		if !f {
+			return "", fmt.Errorf("missing port of %s target", target)
+		}
+		return fmt.Sprintf("redirect to :%s", port), nil
+	case constants.MARK:
+		mark, f := opts["--set-mark"]
+		if !f {
+			return "", fmt.Errorf("missing mark of %s target", target)
+		}
+		return fmt.Sprintf("meta mark set %s", mark), nil
+	case constants.TPROXY:
+		port, f := opts["--on-port"]
+		if !f {
+			return "", fmt.Errorf("missing port of %s target", target)
+		}
+		tproxy := fmt.Sprintf("tproxy %s to :%s", addressProto, port)
+		mark, f := opts["--tproxy-mark"]
+		if !f {
+			return tproxy, nil
+		}
+		if parts := strings.SplitN(mark, "/", 2); len(parts) == 2 {
+			if mask, err := strconv.ParseUint(parts[1], 0, 32); err != nil || mask != 0xffffffff {
+				return "", fmt.Errorf("unsupported mark mask %q", parts[1])
+			}
+			mark = parts[0]
+		}
+		return fmt.Sprintf("meta mark set %s %s", mark, tproxy), nil
+	case constants.CONNMARK:
+		if _, f := opts["--save-mark"]; f {
+			return "ct mark set meta mark", nil
+		}
+		if _, f := opts["--restore-mark"]; f {
+			return "meta mark set ct mark", nil
+		}
+		return "", fmt.Errorf("unsupported options of %s target", target)
+	default:
+		// Any other target is a chain of the same table, checked once all the chains are known.
+		return fmt.Sprintf("jump %s", NftablesChainName(table, target)), nil
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"strings"
+	"testing"
+
+	"istio.io/istio/tools/istio-iptables/pkg/constants"
+)
+
+func TestBuildNftablesEmpty(t *testing.T) {
+	iptables := NewIptablesBuilder()
+	actual, err := iptables.BuildNftables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "table inet istio\ndelete table inet istio\n"
+	if actual != expected {
+		t.Errorf("Output didn't match: Got: %s, Expected: %s", actual, expected)
+	}
+}
+
+func TestBuildNftablesInsertRules(t *testing.T) {
+	iptables := NewIptablesBuilder()
+	iptables.AppendRuleV4(constants.PREROUTING, constants.NAT, "-p", constants.TCP, "-j", constants.RETURN)
+	iptables.InsertRuleV4(constants.PREROUTING, constants.NAT, 1, "-i", "eth0", "-j", constants.RETURN)
+	iptables.InsertRuleV4(constants.PREROUTING, constants.NAT, 2, "-i", "eth1", "-j", constants.RETURN)
+	iptables.AppendRuleV6(constants.PREROUTING, constants.NAT, "-s", "::1/128", "-j", constants.RETURN)
+	actual, err := iptables.BuildNftables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `table inet istio
+delete table inet istio
+table inet istio {
+	chain nat_PREROUTING {
+		type nat hook prerouting priority -100; policy accept;
+	}
+}
+table inet istio {
+	chain nat_PREROUTING {
+		meta nfproto ipv4 iifname "eth0" return
+		meta nfproto ipv4 iifname "eth1" return
+		meta nfproto ipv4 meta l4proto tcp return
+		ip6 saddr ::1/128 return
+	}
+}
+`
+	if actual != expected {
+		t.Errorf("Output didn't match: Got: %s, Expected: %s", actual, expected)
+	}
+}
+
+func TestBuildNftablesErrors(t *testing.T) {
+	cases := []struct {
+		name  string
+		rules func(iptables *IptablesBuilderImpl)
+		err   string
+	}{
+		{
+			name: "unsupported option",
+			rules: func(iptables *IptablesBuilderImpl) {
+				iptables.AppendRuleV4("ISTIO_FOO", constants.NAT, "-m", "comment", "--comment", "foo", "-j", constants.RETURN)
+			},
+			err: "unsupported option --comment",
+		},
+		{
+			name: "port without protocol",
+			rules: func(iptables *IptablesBuilderImpl) {
+				iptables.AppendRuleV4("ISTIO_FOO", constants.NAT, "--dport", "80", "-j", constants.RETURN)
+			},
+			err: "--dport requires a protocol",
+		},
+		{
+			name: "unknown chain",
+			rules: func(iptables *IptablesBuilderImpl) {
+				iptables.AppendRuleV4(constants.OUTPUT, constants.NAT, "-j", "DNAT", "--to-destination", "1.1.1.1")
+			},
+			err: "jumps to an unknown chain or uses an unsupported target",
+		},
+		{
+			name: "unsupported chain",
+			rules: func(iptables *IptablesBuilderImpl) {
+				iptables.AppendRuleV4(constants.FORWARD, constants.NAT, "-j", constants.RETURN)
+			},
+			err: "chain FORWARD is not supported in table nat",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			iptables := NewIptablesBuilder()
+			tc.rules(iptables)
+			if _, err := iptables.BuildNftables(); err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"istio.io/istio/tools/istio-iptables/pkg/builder"
+	"istio.io/istio/tools/istio-iptables/pkg/constants"
+	"istio.io/istio/tools/istio-iptables/pkg/drift"
+)
+
+// quietDependencies ignores the commands run while building the rules.
+type quietDependencies struct{}
+
+func (quietDependencies) RunOrFail(string, ...string) {}
+
+func (quietDependencies) Run(string, ...string) error { return nil }
+
+func (quietDependencies) RunQuietlyAndIgnore(string, ...string) {}
+
+func (quietDependencies) RunWithOutput(string, ...string) (string, error) { return "", nil }
+
+// driftReport compares the rules of the configuration with the rules listed by iptables-save, and ip6tables-save
+// when IPv6 is enabled. It returns the expected chains of each family along with the report.
+func (iptConfigurator *IptablesConfigurator) driftReport() (*drift.Report, map[string][]*builder.ChainRules, error) {
+	if iptConfigurator.cfg.Nftables {
+		return nil, nil, fmt.Errorf("drift detection is not supported with --%s", constants.Nftables)
+	}
+	// Build the rules without running the routing commands of the TPROXY mode again.
+	ext := iptConfigurator.ext
+	iptConfigurator.ext = quietDependencies{}
+	iptConfigurator.buildRules()
+	iptConfigurator.ext = ext
+
+	families := []string{drift.IPv4}
+	if iptConfigurator.cfg.EnableInboundIPv6 {
+		families = append(families, drift.IPv6)
+	}
+	report := drift.NewReport()
+	expected := map[string][]*builder.ChainRules{}
+	for _, family := range families {
+		chains, err := iptConfigurator.iptables.BuildV4Chains()
+		saveCmd := constants.IPTABLESSAVE
+		if family == drift.IPv6 {
+			chains, err = iptConfigurator.iptables.BuildV6Chains()
+			saveCmd = constants.IP6TABLESSAVE
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		save, err := iptConfigurator.ext.RunWithOutput(saveCmd)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list the rules with %s: %v", saveCmd, err)
+		}
+		current, err := drift.ParseSave(save)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse the output of %s: %v", saveCmd, err)
+		}
+		report.Compare(family, chains, current)
+		expected[family] = chains
+	}
+	return report, expected, nil
+}
+
+// checkDrift prints the drift report as JSON and, with --reconcile, reprograms the drifted ISTIO_* chains.
+// It returns true if the rules differ from the expected ones and were not reconciled.
+func (iptConfigurator *IptablesConfigurator) checkDrift() (bool, error) {
+	report, expected, err := iptConfigurator.driftReport()
+	if err != nil {
+		return false, err
+	}
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	fmt.Println(string(out))
+	if !report.HasDrift() || !iptConfigurator.cfg.Reconcile {
+		return report.HasDrift(), nil
+	}
+
+	for _, family := range []string{drift.IPv4, drift.IPv6} {
+		chains, f := expected[family]
+		if !f {
+			continue
+		}
+		data := drift.ReconcileRestore(report, family, chains)
+		if data == "" {
+			continue
+		}
+		if err := iptConfigurator.executeRestore(family == drift.IPv4, data); err != nil {
+			return true, err
+		}
+	}
+	// Differences of the built-in chains are left as is.
+	for _, rules := range [][]drift.Rule{report.Missing, report.OutOfOrder} {
+		for _, r := range rules {
+			if _, builtin := constants.BuiltInChainsMap[r.Chain]; builtin {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
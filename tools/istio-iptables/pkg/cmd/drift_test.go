@@ -0,0 +1,149 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	testutil "istio.io/istio/pilot/test/util"
+	"istio.io/istio/tools/istio-iptables/pkg/config"
+	"istio.io/istio/tools/istio-iptables/pkg/constants"
+)
+
+// fakeDependencies returns the content of a file for iptables-save, and records the commands and the content of
+// the files given to iptables-restore.
+type fakeDependencies struct {
+	t        *testing.T
+	save     string
+	commands []string
+	restored string
+}
+
+func (f *fakeDependencies) RunOrFail(cmd string, args ...string) {
+	f.commands = append(f.commands, strings.Join(append([]string{cmd}, args...), " "))
+	if cmd == constants.IPTABLESRESTORE {
+		b, err := ioutil.ReadFile(args[len(args)-1])
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		f.restored += string(b)
+	}
+}
+
+func (f *fakeDependencies) Run(cmd string, args ...string) error {
+	f.RunOrFail(cmd, args...)
+	return nil
+}
+
+func (f *fakeDependencies) RunQuietlyAndIgnore(cmd string, args ...string) {
+	f.RunOrFail(cmd, args...)
+}
+
+func (f *fakeDependencies) RunWithOutput(cmd string, args ...string) (string, error) {
+	if cmd != constants.IPTABLESSAVE {
+		f.t.Fatalf("unexpected command %s", cmd)
+	}
+	b, err := ioutil.ReadFile(filepath.Join("testdata/drift", f.save+".save"))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return string(b), nil
+}
+
+func constructDriftTestConfig() *config.Config {
+	cfg := constructTestConfig()
+	cfg.CheckDrift = true
+	cfg.InboundInterceptionMode = constants.TPROXY
+	cfg.InboundPortsInclude = "*"
+	cfg.InboundPortsExclude = "15020"
+	cfg.OutboundIPRangesInclude = "*"
+	cfg.RedirectDNS = true
+	cfg.DNSServersV4 = []string{"10.96.0.10"}
+	return cfg
+}
+
+func TestDriftReportInSync(t *testing.T) {
+	ext := &fakeDependencies{t: t, save: "tproxy"}
+	iptConfigurator := NewIptablesConfigurator(constructDriftTestConfig(), ext)
+	report, _, err := iptConfigurator.driftReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.HasDrift() {
+		t.Fatalf("unexpected drift: %+v", report)
+	}
+	if len(ext.commands) != 0 {
+		t.Fatalf("unexpected commands: %v", ext.commands)
+	}
+}
+
+func TestDriftReport(t *testing.T) {
+	ext := &fakeDependencies{t: t, save: "tproxy-drifted"}
+	iptConfigurator := NewIptablesConfigurator(constructDriftTestConfig(), ext)
+	report, _, err := iptConfigurator.driftReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CompareContent(out, "testdata/drift/tproxy-drifted.golden.json", t)
+}
+
+func TestCheckDriftReconcile(t *testing.T) {
+	cases := []struct {
+		name      string
+		reconcile bool
+		drifted   bool
+	}{
+		{name: "check", reconcile: false, drifted: true},
+		// The jump from the built-in OUTPUT chain is still missing
+		{name: "reconcile", reconcile: true, drifted: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := constructDriftTestConfig()
+			cfg.Reconcile = tc.reconcile
+			ext := &fakeDependencies{t: t, save: "tproxy-drifted"}
+			drifted, err := NewIptablesConfigurator(cfg, ext).checkDrift()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if drifted != tc.drifted {
+				t.Fatalf("expected drifted %v, got %v", tc.drifted, drifted)
+			}
+			if !tc.reconcile {
+				if len(ext.commands) != 0 {
+					t.Fatalf("unexpected commands: %v", ext.commands)
+				}
+				return
+			}
+			testutil.CompareContent([]byte(ext.restored), "testdata/drift/tproxy-drifted-reconcile.golden", t)
+		})
+	}
+}
+
+func TestCheckDriftNftables(t *testing.T) {
+	cfg := constructDriftTestConfig()
+	cfg.Nftables = true
+	if _, err := NewIptablesConfigurator(cfg, &fakeDependencies{t: t}).checkDrift(); err == nil {
+		t.Fatal("expected an error with nftables")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	testutil "istio.io/istio/pilot/test/util"
+	"istio.io/istio/tools/istio-iptables/pkg/config"
+	"istio.io/istio/tools/istio-iptables/pkg/constants"
+	dep "istio.io/istio/tools/istio-iptables/pkg/dependencies"
+)
+
+func TestNftablesRuleset(t *testing.T) {
+	cases := []struct {
+		name   string
+		config func(cfg *config.Config)
+	}{
+		{
+			name: "default",
+			config: func(cfg *config.Config) {
+				cfg.InboundPortsInclude = "*"
+				cfg.InboundPortsExclude = "15090,15021,15020"
+				cfg.OutboundIPRangesInclude = "*"
+			},
+		},
+		{
+			name: "ip-ranges-and-dns",
+			config: func(cfg *config.Config) {
+				cfg.InboundPortsInclude = "8080"
+				cfg.OutboundIPRangesExclude = "1.1.0.0/16"
+				cfg.OutboundIPRangesInclude = "9.9.0.0/16"
+				cfg.OutboundPortsExclude = "3306"
+				cfg.KubevirtInterfaces = "eth1"
+				cfg.RedirectDNS = true
+				cfg.DNSServersV4 = []string{"127.0.0.53"}
+			},
+		},
+		{
+			name: "tproxy",
+			config: func(cfg *config.Config) {
+				cfg.InboundInterceptionMode = constants.TPROXY
+				cfg.InboundPortsInclude = "*"
+				cfg.OutboundIPRangesInclude = "*"
+			},
+		},
+		{
+			name: "ipv6",
+			config: func(cfg *config.Config) {
+				cfg.InboundPortsInclude = "*"
+				cfg.InboundPortsExclude = "15020"
+				cfg.OutboundIPRangesInclude = "*"
+				cfg.OutboundIPRangesExclude = "fd00::/8"
+				cfg.KubevirtInterfaces = "eth1"
+				cfg.EnableInboundIPv6 = true
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := constructTestConfig()
+			cfg.DryRun = true
+			cfg.Nftables = true
+			tc.config(cfg)
+			iptConfigurator := NewIptablesConfigurator(cfg, &dep.StdoutStubDependencies{})
+			iptConfigurator.run()
+			ruleset, err := iptConfigurator.iptables.BuildNftables()
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.CompareContent([]byte(ruleset), filepath.Join("testdata/nftables", tc.name+".golden"), t)
+		})
+	}
+}
@@ -56,6 +56,16 @@ var rootCmd = &cobra.Command{
 		}
 
 		iptConfigurator := NewIptablesConfigurator(cfg, ext)
+		if cfg.CheckDrift {
+			drifted, err := iptConfigurator.checkDrift()
+			if err != nil {
+				handleError(err)
+			}
+			if drifted {
+				os.Exit(constants.DriftErrorCode)
+			}
+			return
+		}
 		if !cfg.SkipRuleApply {
 			iptConfigurator.run()
 		}
@@ -78,6 +88,9 @@ func constructConfig() *config.Config {
 	cfg := &config.Config{
 		DryRun:                  viper.GetBool(constants.DryRun),
 		RestoreFormat:           viper.GetBool(constants.RestoreFormat),
+		Nftables:                viper.GetBool(constants.Nftables),
+		CheckDrift:              viper.GetBool(constants.CheckDrift),
+		Reconcile:               viper.GetBool(constants.Reconcile),
 		ProxyPort:               viper.GetString(constants.EnvoyPort),
 		InboundCapturePort:      viper.GetString(constants.InboundCapturePort),
 		InboundTunnelPort:       viper.GetString(constants.InboundTunnelPort),
@@ -257,6 +270,21 @@ func bindFlags(cmd *cobra.Command, args []string) {
 	}
 	viper.SetDefault(constants.RestoreFormat, true)
 
+	if err := viper.BindPFlag(constants.Nftables, cmd.Flags().Lookup(constants.Nftables)); err != nil {
+		handleError(err)
+	}
+	viper.SetDefault(constants.Nftables, false)
+
+	if err := viper.BindPFlag(constants.CheckDrift, cmd.Flags().Lookup(constants.CheckDrift)); err != nil {
+		handleError(err)
+	}
+	viper.SetDefault(constants.CheckDrift, false)
+
+	if err := viper.BindPFlag(constants.Reconcile, cmd.Flags().Lookup(constants.Reconcile)); err != nil {
+		handleError(err)
+	}
+	viper.SetDefault(constants.Reconcile, false)
+
 	if err := viper.BindPFlag(constants.IptablesProbePort, cmd.Flags().Lookup(constants.IptablesProbePort)); err != nil {
 		handleError(err)
 	}
@@ -337,6 +365,16 @@ func init() {
 
 	rootCmd.Flags().BoolP(constants.RestoreFormat, "f", true, "Print iptables rules in iptables-restore interpretable format")
 
+	rootCmd.Flags().Bool(constants.Nftables, false,
+		"Program the rules as a single nftables ruleset in the \"inet istio\" table with nft, instead of using iptables")
+
+	rootCmd.Flags().Bool(constants.CheckDrift, false,
+		"Instead of programming the rules, compare them with the rules listed by iptables-save, print the missing, extra and "+
+			"out of order rules as JSON, and exit with code "+strconv.Itoa(constants.DriftErrorCode)+" if they differ")
+
+	rootCmd.Flags().Bool(constants.Reconcile, false,
+		"With --check-drift, reprogram the ISTIO_* chains that differ. Built-in chains are never modified")
+
 	rootCmd.Flags().String(constants.IptablesProbePort, strconv.Itoa(constants.DefaultIptablesProbePort), "set listen port for failure detection")
 
 	rootCmd.Flags().Duration(constants.ProbeTimeout, constants.DefaultProbeTimeout, "failure detection timeout")
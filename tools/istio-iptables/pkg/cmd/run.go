@@ -367,12 +367,29 @@ func SplitV4V6(ips []string) (ipv4 []string, ipv6 []string) {
 func (iptConfigurator *IptablesConfigurator) run() {
 	defer func() {
 		// Best effort since we don't know if the commands exist
+		if iptConfigurator.cfg.Nftables {
+			_ = iptConfigurator.ext.Run(constants.NFT, "list", "table", constants.NftablesFamily, constants.NftablesTable)
+			return
+		}
 		_ = iptConfigurator.ext.Run(constants.IPTABLESSAVE)
 		if iptConfigurator.cfg.EnableInboundIPv6 {
 			_ = iptConfigurator.ext.Run(constants.IP6TABLESSAVE)
 		}
 	}()
 
+	iptConfigurator.logConfig()
+
+	if iptConfigurator.cfg.EnableInboundIPv6 {
+		// TODO: (abhide): Move this out of this method
+		iptConfigurator.ext.RunOrFail(constants.IP, "-6", "addr", "add", "::6/128", "dev", "lo")
+	}
+
+	iptConfigurator.buildRules()
+	iptConfigurator.executeCommands()
+}
+
+// buildRules adds the rules for the configuration to the builder, without running any command.
+func (iptConfigurator *IptablesConfigurator) buildRules() {
 	// Since OUTBOUND_IP_RANGES_EXCLUDE could carry ipv4 and ipv6 ranges
 	// need to split them in different arrays one for ipv4 and one for ipv6
 	// in order to not to fail
@@ -391,12 +408,6 @@ func (iptConfigurator *IptablesConfigurator) run() {
 	}
 
 	redirectDNS := iptConfigurator.cfg.RedirectDNS
-	iptConfigurator.logConfig()
-
-	if iptConfigurator.cfg.EnableInboundIPv6 {
-		// TODO: (abhide): Move this out of this method
-		iptConfigurator.ext.RunOrFail(constants.IP, "-6", "addr", "add", "::6/128", "dev", "lo")
-	}
 
 	// Do not capture internal interface.
 	iptConfigurator.shortCircuitKubeInternalInterface()
@@ -554,7 +565,6 @@ func (iptConfigurator *IptablesConfigurator) run() {
 		iptConfigurator.iptables.InsertRuleV4(constants.ISTIOINBOUND, constants.MANGLE, 1,
 			"-p", constants.TCP, "-m", "mark", "--mark", iptConfigurator.cfg.InboundTProxyMark, "-j", constants.RETURN)
 	}
-	iptConfigurator.executeCommands()
 }
 
 // HandleDNSUDP is a helper function to tackle with DNS UDP specific operations.
@@ -650,13 +660,19 @@ func (iptConfigurator *IptablesConfigurator) executeIptablesCommands(commands []
 }
 
 func (iptConfigurator *IptablesConfigurator) executeIptablesRestoreCommand(isIpv4 bool) error {
-	var data, filename, cmd string
 	if isIpv4 {
-		data = iptConfigurator.iptables.BuildV4Restore()
+		return iptConfigurator.executeRestore(true, iptConfigurator.iptables.BuildV4Restore())
+	}
+	return iptConfigurator.executeRestore(false, iptConfigurator.iptables.BuildV6Restore())
+}
+
+// executeRestore runs iptables-restore or ip6tables-restore with the data, keeping the other rules of the tables.
+func (iptConfigurator *IptablesConfigurator) executeRestore(isIpv4 bool, data string) error {
+	var filename, cmd string
+	if isIpv4 {
 		filename = fmt.Sprintf("iptables-rules-%d.txt", time.Now().UnixNano())
 		cmd = constants.IPTABLESRESTORE
 	} else {
-		data = iptConfigurator.iptables.BuildV6Restore()
 		filename = fmt.Sprintf("ip6tables-rules-%d.txt", time.Now().UnixNano())
 		cmd = constants.IP6TABLESRESTORE
 	}
@@ -673,8 +689,31 @@ func (iptConfigurator *IptablesConfigurator) executeIptablesRestoreCommand(isIpv
 	return nil
 }
 
+// executeNftablesCommand programs the IPv4 and IPv6 rules at once, replacing the istio nftables table atomically.
+func (iptConfigurator *IptablesConfigurator) executeNftablesCommand() error {
+	data, err := iptConfigurator.iptables.BuildNftables()
+	if err != nil {
+		return fmt.Errorf("unable to build nftables ruleset: %v", err)
+	}
+	rulesFile, err := ioutil.TempFile("", fmt.Sprintf("nftables-rules-%d.nft", time.Now().UnixNano()))
+	if err != nil {
+		return fmt.Errorf("unable to create nftables rules file: %v", err)
+	}
+	defer os.Remove(rulesFile.Name())
+	if err := iptConfigurator.createRulesFile(rulesFile, data); err != nil {
+		return err
+	}
+	iptConfigurator.ext.RunOrFail(constants.NFT, "-f", rulesFile.Name())
+	return nil
+}
+
 func (iptConfigurator *IptablesConfigurator) executeCommands() {
-	if iptConfigurator.cfg.RestoreFormat {
+	if iptConfigurator.cfg.Nftables {
+		if err := iptConfigurator.executeNftablesCommand(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	} else if iptConfigurator.cfg.RestoreFormat {
 		// Execute iptables-restore
 		err := iptConfigurator.executeIptablesRestoreCommand(true)
 		if err != nil {
@@ -44,6 +44,9 @@ type Config struct {
 	ProbeTimeout            time.Duration `json:"PROBE_TIMEOUT"`
 	DryRun                  bool          `json:"DRY_RUN"`
 	RestoreFormat           bool          `json:"RESTORE_FORMAT"`
+	Nftables                bool          `json:"NFTABLES"`
+	CheckDrift              bool          `json:"CHECK_DRIFT"`
+	Reconcile               bool          `json:"RECONCILE"`
 	SkipRuleApply           bool          `json:"SKIP_RULE_APPLY"`
 	RunValidation           bool          `json:"RUN_VALIDATION"`
 	RedirectDNS             bool          `json:"REDIRECT_DNS"`
@@ -81,5 +84,6 @@ func (c *Config) Print() {
 	fmt.Printf("ENABLE_INBOUND_IPV6=%t\n", c.EnableInboundIPv6)
 	fmt.Printf("DNS_CAPTURE=%t\n", c.RedirectDNS)
 	fmt.Printf("DNS_SERVERS=%s,%s\n", c.DNSServersV4, c.DNSServersV6)
+	fmt.Printf("NFTABLES=%t\n", c.Nftables)
 	fmt.Println("")
 }
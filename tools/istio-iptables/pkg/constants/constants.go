@@ -51,6 +51,7 @@ const (
 	REJECT   = "REJECT"
 	REDIRECT = "REDIRECT"
 	MARK     = "MARK"
+	CONNMARK = "CONNMARK"
 )
 
 // iptables chains
@@ -88,6 +89,9 @@ const (
 	IptablesProbePort         = "iptables-probe-port"
 	ProbeTimeout              = "probe-timeout"
 	RedirectDNS               = "redirect-dns"
+	Nftables                  = "nftables"
+	CheckDrift                = "check-drift"
+	Reconcile                 = "reconcile"
 )
 
 const (
@@ -109,6 +113,13 @@ const (
 	IP6TABLESRESTORE = "ip6tables-restore"
 	IP6TABLESSAVE    = "ip6tables-save"
 	IP               = "ip"
+	NFT              = "nft"
+)
+
+// nftables table holding all the rules, in the inet family to handle both IPv4 and IPv6
+const (
+	NftablesFamily = "inet"
+	NftablesTable  = "istio"
 )
 
 // Constants for syscall
@@ -127,6 +138,11 @@ const (
 	ValidationErrorCode     = 126
 )
 
+const (
+	// DriftErrorCode is the exit code of --check-drift when the rules differ from the expected ones.
+	DriftErrorCode = 3
+)
+
 // DNS ports
 const (
 	IstioAgentDNSListenerPort = "15053"
@@ -15,6 +15,7 @@
 package dependencies
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
@@ -52,3 +53,14 @@ func (r *RealDependencies) Run(cmd string, args ...string) error {
 func (r *RealDependencies) RunQuietlyAndIgnore(cmd string, args ...string) {
 	_ = r.execute(cmd, true, args...)
 }
+
+// RunWithOutput runs a command and returns its standard output. The command is not printed, so that the
+// output of the caller can be parsed.
+func (r *RealDependencies) RunWithOutput(cmd string, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	externalCommand := exec.Command(cmd, args...)
+	externalCommand.Stdout = &stdout
+	externalCommand.Stderr = os.Stderr
+	err := externalCommand.Run()
+	return stdout.String(), err
+}
@@ -16,6 +16,7 @@ package dependencies
 
 import (
 	"fmt"
+	"os"
 	"strings"
 )
 
@@ -37,3 +38,10 @@ func (s *StdoutStubDependencies) Run(cmd string, args ...string) error {
 func (s *StdoutStubDependencies) RunQuietlyAndIgnore(cmd string, args ...string) {
 	fmt.Printf("%s %s\n", cmd, strings.Join(args, " "))
 }
+
+// RunWithOutput runs a command and returns an empty output. The command is printed to stderr, so that it is
+// not mixed with the output of the caller, such as the drift report.
+func (s *StdoutStubDependencies) RunWithOutput(cmd string, args ...string) (string, error) {
+	fmt.Fprintf(os.Stderr, "%s %s\n", cmd, strings.Join(args, " "))
+	return "", nil
+}
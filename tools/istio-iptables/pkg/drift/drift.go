@@ -0,0 +1,386 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package drift compares the iptables rules of a network namespace, as listed by iptables-save, with the rules
+// istio-iptables programs.
+package drift
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"istio.io/istio/tools/istio-iptables/pkg/builder"
+	"istio.io/istio/tools/istio-iptables/pkg/constants"
+)
+
+// IP families of the rules of a report.
+const (
+	IPv4 = "ipv4"
+	IPv6 = "ipv6"
+)
+
+// istioChainPrefix is the prefix of the chains owned by istio-iptables.
+const istioChainPrefix = "ISTIO_"
+
+// Rule is a rule of a report.
+type Rule struct {
+	Family string `json:"family"`
+	Table  string `json:"table"`
+	Chain  string `json:"chain"`
+	// Position of the rule in the chain, starting at 1. It is the expected position for missing and out of order
+	// rules, and the current position for extra rules.
+	Position int `json:"position"`
+	// Rule in iptables-save form, for example "-A ISTIO_OUTPUT -d 127.0.0.1/32 -j RETURN".
+	Rule string `json:"rule"`
+}
+
+// Report lists the differences between the current and the expected rules.
+type Report struct {
+	// Missing rules are expected but not present in their chain.
+	Missing []Rule `json:"missing"`
+	// Extra rules are present in a chain owned by istio-iptables but not expected. Rules added to built-in chains
+	// by others are not reported.
+	Extra []Rule `json:"extra"`
+	// OutOfOrder rules are present in their chain, at another position relative to the other expected rules.
+	OutOfOrder []Rule `json:"outOfOrder"`
+}
+
+// NewReport returns a report without differences.
+func NewReport() *Report {
+	return &Report{
+		Missing:    []Rule{},
+		Extra:      []Rule{},
+		OutOfOrder: []Rule{},
+	}
+}
+
+// HasDrift returns true if the report has differences.
+func (r *Report) HasDrift() bool {
+	return len(r.Missing)+len(r.Extra)+len(r.OutOfOrder) > 0
+}
+
+// Tables are the chains of each table, with their rules, as listed by iptables-save.
+type Tables map[string]map[string][]string
+
+// ParseSave parses the output of iptables-save. The rules are kept without their append command.
+func ParseSave(save string) (Tables, error) {
+	tables := Tables{}
+	var table string
+	for i, line := range strings.Split(save, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "*"):
+			table = strings.TrimSpace(line[1:])
+			tables[table] = map[string][]string{}
+		case line == "COMMIT":
+			table = ""
+		case table == "":
+			return nil, fmt.Errorf("line %d: %q is outside of a table", i+1, line)
+		case strings.HasPrefix(line, ":"):
+			fields := strings.Fields(line[1:])
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("line %d: missing chain name", i+1)
+			}
+			tables[table][fields[0]] = []string{}
+		case strings.HasPrefix(line, "-A "):
+			fields := strings.SplitN(line[len("-A "):], " ", 2)
+			rule := ""
+			if len(fields) == 2 {
+				rule = fields[1]
+			}
+			tables[table][fields[0]] = append(tables[table][fields[0]], rule)
+		default:
+			return nil, fmt.Errorf("line %d: unexpected line %q", i+1, line)
+		}
+	}
+	return tables, nil
+}
+
+// Compare adds the differences between the expected chains of the family and the current tables to the report.
+func (r *Report) Compare(family string, expected []*builder.ChainRules, current Tables) {
+	expectedChains := map[string]bool{}
+	for _, c := range expected {
+		expectedChains[c.Table+"/"+c.Chain] = true
+		exp := make([]string, 0, len(c.Rules))
+		for _, params := range c.Rules {
+			exp = append(exp, strings.Join(params, " "))
+		}
+		r.compareChain(family, c.Table, c.Chain, exp, current[c.Table][c.Chain])
+	}
+
+	// Chains left over by istio-iptables, for example by a previous interception mode.
+	tables := make([]string, 0, len(current))
+	for table := range current {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		chains := make([]string, 0, len(current[table]))
+		for chain := range current[table] {
+			if strings.HasPrefix(chain, istioChainPrefix) && !expectedChains[table+"/"+chain] {
+				chains = append(chains, chain)
+			}
+		}
+		sort.Strings(chains)
+		for _, chain := range chains {
+			r.compareChain(family, table, chain, nil, current[table][chain])
+		}
+	}
+}
+
+func (r *Report) compareChain(family, table, chain string, expected, current []string) {
+	rule := func(position int, params string) Rule {
+		return Rule{
+			Family:   family,
+			Table:    table,
+			Chain:    chain,
+			Position: position + 1,
+			Rule:     strings.TrimSpace(fmt.Sprintf("-A %s %s", chain, params)),
+		}
+	}
+	expectedKeys := make([]string, 0, len(expected))
+	for _, e := range expected {
+		expectedKeys = append(expectedKeys, normalize(e))
+	}
+	currentKeys := make([]string, 0, len(current))
+	for _, c := range current {
+		currentKeys = append(currentKeys, normalize(c))
+	}
+
+	// The rules in the longest common subsequence are in order. The other rules are either at another position,
+	// missing, or extra.
+	inOrderExpected, inOrderCurrent := longestCommonSubsequence(expectedKeys, currentKeys)
+	unmatched := map[string]int{}
+	for i, key := range currentKeys {
+		if !inOrderCurrent[i] {
+			unmatched[key]++
+		}
+	}
+	for i, key := range expectedKeys {
+		if inOrderExpected[i] {
+			continue
+		}
+		if unmatched[key] > 0 {
+			unmatched[key]--
+			r.OutOfOrder = append(r.OutOfOrder, rule(i, expected[i]))
+		} else {
+			r.Missing = append(r.Missing, rule(i, expected[i]))
+		}
+	}
+	if _, builtin := constants.BuiltInChainsMap[chain]; builtin {
+		return
+	}
+	// The last occurrences of the unmatched rules are the extra ones, the others are out of order.
+	extra := []Rule{}
+	for i := len(currentKeys) - 1; i >= 0; i-- {
+		key := currentKeys[i]
+		if inOrderCurrent[i] || unmatched[key] == 0 {
+			continue
+		}
+		unmatched[key]--
+		extra = append([]Rule{rule(i, current[i])}, extra...)
+	}
+	r.Extra = append(r.Extra, extra...)
+}
+
+// longestCommonSubsequence returns which elements of a and b are part of their longest common subsequence.
+func longestCommonSubsequence(a, b []string) ([]bool, []bool) {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			case lengths[i+1][j] >= lengths[i][j+1]:
+				lengths[i][j] = lengths[i+1][j]
+			default:
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+	inA, inB := make([]bool, len(a)), make([]bool, len(b))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			inA[i], inB[j] = true, true
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return inA, inB
+}
+
+// Options with a default value that iptables-save prints even when the rule was added without them.
+var defaultOptions = map[string][]string{
+	"--on-ip":  {"0.0.0.0", "::"},
+	"--nfmask": {"0xffffffff"},
+	"--ctmask": {"0xffffffff"},
+}
+
+// Options with a mark value, printed in hexadecimal by iptables-save.
+var markOptions = map[string]bool{
+	"--mark":        true,
+	"--set-xmark":   true,
+	"--tproxy-mark": true,
+}
+
+// normalize returns a canonical form of the matches and target of a rule, so that the rules programmed by
+// istio-iptables compare equal to their iptables-save listing: the options are sorted, the implicit protocol
+// matches and default values are dropped, and the marks and addresses use a single notation.
+func normalize(rule string) string {
+	fields := strings.Fields(rule)
+	options := []string{}
+	for i := 0; i < len(fields); {
+		negated := false
+		if fields[i] == "!" {
+			negated = true
+			i++
+			if i == len(fields) {
+				break
+			}
+		}
+		name := fields[i]
+		i++
+		values := []string{}
+		for i < len(fields) && fields[i] != "!" && !strings.HasPrefix(fields[i], "-") {
+			values = append(values, strings.Trim(fields[i], `"`))
+			i++
+		}
+		value := strings.Join(values, " ")
+
+		switch name {
+		case "--to-port":
+			name = "--to-ports"
+		case "--destination-port":
+			name = "--dport"
+		case "--source-port":
+			name = "--sport"
+		case "--set-mark":
+			name = "--set-xmark"
+			if !strings.Contains(value, "/") {
+				value += "/0xffffffff"
+			}
+		case "-m":
+			if value == constants.TCP || value == constants.UDP {
+				continue
+			}
+		case "-s", "-d":
+			if !strings.Contains(value, "/") {
+				if strings.Contains(value, ":") {
+					value += "/128"
+				} else {
+					value += "/32"
+				}
+			}
+		}
+		if isDefault(name, value) {
+			continue
+		}
+		if markOptions[name] {
+			value = normalizeMark(value)
+		}
+		option := strings.TrimSpace(name + " " + value)
+		if negated {
+			option = "! " + option
+		}
+		options = append(options, option)
+	}
+	sort.Strings(options)
+	return strings.Join(options, " ")
+}
+
+func isDefault(name, value string) bool {
+	for _, def := range defaultOptions[name] {
+		if value == def {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeMark returns the decimal form of a mark and its optional mask.
+func normalizeMark(mark string) string {
+	parts := strings.Split(mark, "/")
+	for i, p := range parts {
+		if v, err := strconv.ParseUint(p, 0, 32); err == nil {
+			parts[i] = strconv.FormatUint(v, 10)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// ReconcileRestore returns the input of `iptables-restore --noflush` reprogramming the chains owned by
+// istio-iptables that have differences in the report for the family. The built-in chains are never modified,
+// as other components of the node may own rules in them. Chains left over by istio-iptables are flushed.
+func ReconcileRestore(report *Report, family string, expected []*builder.ChainRules) string {
+	drifted := map[string]map[string]bool{}
+	for _, rules := range [][]Rule{report.Missing, report.Extra, report.OutOfOrder} {
+		for _, r := range rules {
+			if r.Family != family || !strings.HasPrefix(r.Chain, istioChainPrefix) {
+				continue
+			}
+			if drifted[r.Table] == nil {
+				drifted[r.Table] = map[string]bool{}
+			}
+			drifted[r.Table][r.Chain] = true
+		}
+	}
+	if len(drifted) == 0 {
+		return ""
+	}
+
+	expectedRules := map[string]map[string][][]string{}
+	for _, c := range expected {
+		if expectedRules[c.Table] == nil {
+			expectedRules[c.Table] = map[string][][]string{}
+		}
+		expectedRules[c.Table][c.Chain] = c.Rules
+	}
+	tables := make([]string, 0, len(drifted))
+	for table := range drifted {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	var b strings.Builder
+	for _, table := range tables {
+		chains := make([]string, 0, len(drifted[table]))
+		for chain := range drifted[table] {
+			chains = append(chains, chain)
+		}
+		sort.Strings(chains)
+		fmt.Fprintf(&b, "* %s\n", table)
+		// Declaring a chain flushes it.
+		for _, chain := range chains {
+			fmt.Fprintf(&b, ":%s - [0:0]\n", chain)
+		}
+		for _, chain := range chains {
+			for _, params := range expectedRules[table][chain] {
+				fmt.Fprintf(&b, "-A %s %s\n", chain, strings.Join(params, " "))
+			}
+		}
+		fmt.Fprintln(&b, "COMMIT")
+	}
+	return b.String()
+}
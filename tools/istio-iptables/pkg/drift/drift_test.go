@@ -0,0 +1,127 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drift
+
+import (
+	"reflect"
+	"testing"
+
+	"istio.io/istio/tools/istio-iptables/pkg/builder"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		programmed string
+		saved      string
+	}{
+		{"-o lo -s 127.0.0.6/32 -j RETURN", "-s 127.0.0.6/32 -o lo -j RETURN"},
+		{"-p tcp ! --dport 53 -m owner ! --uid-owner 1337 -j RETURN", "-p tcp -m tcp ! --dport 53 -m owner ! --uid-owner 1337 -j RETURN"},
+		{"-p udp --dport 53 -d 10.96.0.10/32 -j REDIRECT --to-port 15053", "-d 10.96.0.10/32 -p udp -m udp --dport 53 -j REDIRECT --to-ports 15053"},
+		{"-j MARK --set-mark 1337", "-j MARK --set-xmark 0x539/0xffffffff"},
+		{"-p tcp -m mark --mark 1337 -j CONNMARK --save-mark", "-p tcp -m mark --mark 0x539 -j CONNMARK --save-mark --nfmask 0xffffffff --ctmask 0xffffffff"},
+		{"! -d 127.0.0.1/32 -p tcp -j TPROXY --tproxy-mark 1337/0xffffffff --on-port 15006",
+			"! -d 127.0.0.1/32 -p tcp -j TPROXY --on-port 15006 --on-ip 0.0.0.0 --tproxy-mark 0x539/0xffffffff"},
+		{"-d ::1 -j RETURN", "-d ::1/128 -j RETURN"},
+	}
+	for _, tc := range cases {
+		if p, s := normalize(tc.programmed), normalize(tc.saved); p != s {
+			t.Errorf("%q normalized to %q, %q to %q", tc.programmed, p, tc.saved, s)
+		}
+	}
+	if normalize("-o lo -m owner --uid-owner 1337 -j RETURN") == normalize("-o lo -m owner ! --uid-owner 1337 -j RETURN") {
+		t.Errorf("negation must be kept")
+	}
+}
+
+func TestParseSave(t *testing.T) {
+	tables, err := ParseSave(`# Generated by iptables-save
+*nat
+:OUTPUT ACCEPT [0:0]
+:ISTIO_OUTPUT - [0:0]
+:ISTIO_REDIRECT - [0:0]
+-A OUTPUT -p tcp -j ISTIO_OUTPUT
+-A ISTIO_OUTPUT -j ISTIO_REDIRECT
+COMMIT
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Tables{"nat": {
+		"OUTPUT":         {"-p tcp -j ISTIO_OUTPUT"},
+		"ISTIO_OUTPUT":   {"-j ISTIO_REDIRECT"},
+		"ISTIO_REDIRECT": {},
+	}}
+	if !reflect.DeepEqual(tables, expected) {
+		t.Fatalf("expected %v, got %v", expected, tables)
+	}
+
+	for _, invalid := range []string{"-A OUTPUT -j RETURN", "*nat\n-I OUTPUT 1 -j RETURN\nCOMMIT"} {
+		if _, err := ParseSave(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	expected := []*builder.ChainRules{
+		{Table: "nat", Chain: "OUTPUT", Rules: [][]string{{"-p", "tcp", "-j", "ISTIO_OUTPUT"}}},
+		{Table: "nat", Chain: "ISTIO_OUTPUT", Rules: [][]string{
+			{"-d", "127.0.0.1/32", "-j", "RETURN"},
+			{"-m", "owner", "--uid-owner", "1337", "-j", "RETURN"},
+			{"-j", "ISTIO_REDIRECT"},
+		}},
+	}
+	current := Tables{"nat": {
+		// Rules of others in built-in chains are ignored
+		"OUTPUT": {"-j DOCKER", "-p tcp -j ISTIO_OUTPUT"},
+		"ISTIO_OUTPUT": {
+			"-j ISTIO_REDIRECT",
+			"-d 127.0.0.1/32 -j RETURN",
+			"-j ISTIO_REDIRECT",
+		},
+		"ISTIO_DIVERT": {"-j ACCEPT"},
+	}}
+	report := NewReport()
+	report.Compare(IPv4, expected, current)
+	expectedReport := &Report{
+		Missing: []Rule{
+			{Family: IPv4, Table: "nat", Chain: "ISTIO_OUTPUT", Position: 2, Rule: "-A ISTIO_OUTPUT -m owner --uid-owner 1337 -j RETURN"},
+		},
+		Extra: []Rule{
+			{Family: IPv4, Table: "nat", Chain: "ISTIO_OUTPUT", Position: 1, Rule: "-A ISTIO_OUTPUT -j ISTIO_REDIRECT"},
+			{Family: IPv4, Table: "nat", Chain: "ISTIO_DIVERT", Position: 1, Rule: "-A ISTIO_DIVERT -j ACCEPT"},
+		},
+		OutOfOrder: []Rule{},
+	}
+	if !reflect.DeepEqual(report, expectedReport) {
+		t.Fatalf("expected %+v, got %+v", expectedReport, report)
+	}
+
+	restore := ReconcileRestore(report, IPv4, expected)
+	expectedRestore := `* nat
+:ISTIO_DIVERT - [0:0]
+:ISTIO_OUTPUT - [0:0]
+-A ISTIO_OUTPUT -d 127.0.0.1/32 -j RETURN
+-A ISTIO_OUTPUT -m owner --uid-owner 1337 -j RETURN
+-A ISTIO_OUTPUT -j ISTIO_REDIRECT
+COMMIT
+`
+	if restore != expectedRestore {
+		t.Fatalf("expected restore %q, got %q", expectedRestore, restore)
+	}
+	if restore := ReconcileRestore(report, IPv6, expected); restore != "" {
+		t.Fatalf("unexpected IPv6 restore %q", restore)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"istio.io/istio/tools/istio-iptables/pkg/builder"
+	"istio.io/istio/tools/istio-iptables/pkg/constants"
+)
+
+// listNftablesRuleset returns the istio nftables table, as listed by nft.
+func listNftablesRuleset() (string, error) {
+	out, err := exec.Command(constants.NFT, "list", "table", constants.NftablesFamily, constants.NftablesTable).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to list the nftables ruleset: %v: %s", err, out)
+	}
+	return string(out), nil
+}
+
+// CheckNftablesRuleset verifies that the istio nftables table, as listed by `nft list table inet istio`, redirects
+// the outbound and inbound traffic to the proxy ports. It doesn't replace the validation of the redirection with
+// actual connections, but reports a missing or incomplete ruleset with a clearer error.
+func CheckNftablesRuleset(ruleset, proxyPort, inboundCapturePort string) error {
+	chains := map[string][]string{}
+	inTable := false
+	chain := ""
+	scanner := bufio.NewScanner(strings.NewReader(ruleset))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == fmt.Sprintf("table %s %s {", constants.NftablesFamily, constants.NftablesTable):
+			inTable = true
+		case !inTable:
+		case strings.HasPrefix(line, "chain ") && strings.HasSuffix(line, "{"):
+			chain = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "chain "), "{"))
+			chains[chain] = []string{}
+		case line == "}":
+			if chain == "" {
+				inTable = false
+			}
+			chain = ""
+		case chain != "":
+			chains[chain] = append(chains[chain], line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(chains) == 0 {
+		return fmt.Errorf("nftables table %s %s not found", constants.NftablesFamily, constants.NftablesTable)
+	}
+
+	expected := []struct {
+		chain string
+		rule  string
+	}{
+		{builder.NftablesChainName(constants.NAT, constants.OUTPUT), "jump " + builder.NftablesChainName(constants.NAT, constants.ISTIOOUTPUT)},
+		{builder.NftablesChainName(constants.NAT, constants.ISTIOREDIRECT), "redirect to :" + proxyPort},
+		{builder.NftablesChainName(constants.NAT, constants.ISTIOINREDIRECT), "redirect to :" + inboundCapturePort},
+	}
+	for _, e := range expected {
+		rules, f := chains[e.chain]
+		if !f {
+			return fmt.Errorf("nftables chain %s not found", e.chain)
+		}
+		found := false
+		for _, r := range rules {
+			if strings.HasSuffix(r, e.rule) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("nftables chain %s has no rule %q", e.chain, e.rule)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+// Output of `nft list table inet istio`
+const listedRuleset = `table inet istio {
+	chain nat_ISTIO_REDIRECT {
+		meta nfproto ipv4 meta l4proto tcp redirect to :15001
+	}
+
+	chain nat_ISTIO_IN_REDIRECT {
+		meta nfproto ipv4 meta l4proto tcp redirect to :15006
+	}
+
+	chain nat_OUTPUT {
+		type nat hook output priority -100; policy accept;
+		meta nfproto ipv4 meta l4proto tcp jump nat_ISTIO_OUTPUT
+	}
+
+	chain nat_ISTIO_OUTPUT {
+		oifname "lo" ip saddr 127.0.0.6 return
+		meta nfproto ipv4 jump nat_ISTIO_REDIRECT
+	}
+}
+`
+
+func TestCheckNftablesRuleset(t *testing.T) {
+	cases := []struct {
+		name               string
+		ruleset            string
+		inboundCapturePort string
+		err                string
+	}{
+		{"valid", listedRuleset, "15006", ""},
+		{"other capture port", listedRuleset, "15007", `nftables chain nat_ISTIO_IN_REDIRECT has no rule "redirect to :15007"`},
+		{"missing chain", strings.Replace(listedRuleset, "chain nat_OUTPUT", "chain nat_FOO", 1), "15006", "nftables chain nat_OUTPUT not found"},
+		{"missing table", "", "15006", "nftables table inet istio not found"},
+		{"other table", strings.Replace(listedRuleset, "inet istio", "inet other", 1), "15006", "nftables table inet istio not found"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckNftablesRuleset(tc.ruleset, "15001", tc.inboundCapturePort)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
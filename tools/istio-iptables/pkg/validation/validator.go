@@ -44,6 +44,8 @@ type Config struct {
 	ServerOriginalIP    net.IP
 	ServerReadyBarrier  chan ReturnCode
 	ProbeTimeout        time.Duration
+	// RulesetCheck verifies the programmed rules before the redirection is validated, if set.
+	RulesetCheck func() error
 }
 
 type Service struct {
@@ -55,6 +57,12 @@ type Client struct {
 }
 
 func (validator *Validator) Run() error {
+	if validator.Config.RulesetCheck != nil {
+		if err := validator.Config.RulesetCheck(); err != nil {
+			fmt.Println("validation failed:" + err.Error())
+			return err
+		}
+	}
 	s := Service{
 		validator.Config,
 	}
@@ -115,7 +123,7 @@ func NewValidator(config *config.Config, hostIP net.IP) *Validator {
 		listenIP = net.IPv6loopback
 		serverIP = istioLocalIPv6
 	}
-	return &Validator{
+	validator := &Validator{
 		Config: &Config{
 			ServerListenAddress: genListenerAddress(listenIP, []string{config.ProxyPort, config.InboundCapturePort}),
 			ServerOriginalPort:  config.IptablesProbePort,
@@ -124,6 +132,17 @@ func NewValidator(config *config.Config, hostIP net.IP) *Validator {
 			ProbeTimeout:        config.ProbeTimeout,
 		},
 	}
+	if config.Nftables {
+		// The redirection is validated the same way, the original destination being restored by conntrack.
+		validator.Config.RulesetCheck = func() error {
+			ruleset, err := listNftablesRuleset()
+			if err != nil {
+				return err
+			}
+			return CheckNftablesRuleset(ruleset, config.ProxyPort, config.InboundCapturePort)
+		}
+	}
+	return validator
 }
 
 // Write human readable response